@@ -0,0 +1,247 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/fissile/compilator"
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	"github.com/fatih/color"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// BuildAllOptions are the options of building all role manifests of a
+// directory
+type BuildAllOptions struct {
+	ManifestDir            string
+	Stemcell               string
+	CompilationCacheConfig string
+	DockerNetworkMode      string
+	WithoutDocker          bool
+	StreamPackages         bool
+	Hermetic               bool
+	WarmContainers         bool
+	ContainerSettings      compilator.ContainerSettings
+	Images                 BuildImagesOptions   // Options of the image builds; the stemcell is set from Stemcell
+	Helm                   *kube.ExportSettings // Settings of the helm charts, written to subdirectories of OutputDir; nil builds no charts
+}
+
+// The stages of building a role manifest, in order
+const (
+	BuildStageLoad    = "load"
+	BuildStageCompile = "compile"
+	BuildStageImages  = "images"
+	BuildStageHelm    = "helm"
+	BuildStageDone    = "done"
+)
+
+// BuildAllResult is the outcome of building a role manifest: the stage it
+// reached, and the error it failed with, if any
+type BuildAllResult struct {
+	Name           string        `json:"name" yaml:"name"`
+	RoleManifest   string        `json:"role_manifest" yaml:"role_manifest"`
+	InstanceGroups int           `json:"instance_groups" yaml:"instance_groups"`
+	Stage          string        `json:"stage" yaml:"stage"`
+	Chart          string        `json:"chart,omitempty" yaml:"chart,omitempty"`
+	Duration       time.Duration `json:"duration" yaml:"duration"`
+	Error          string        `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// FindRoleManifests returns the role manifests in the directory, i.e. the
+// YAML files with instance groups, by name.  The name of a role manifest is
+// its file name without the extension.
+func FindRoleManifests(dir string) (map[string]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error listing role manifests in %s: %v", dir, err)
+	}
+
+	manifests := make(map[string]string)
+	for _, file := range files {
+		ext := filepath.Ext(file.Name())
+		if file.IsDir() || (ext != ".yml" && ext != ".yaml") {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var document struct {
+			InstanceGroups []interface{} `yaml:"instance_groups"`
+		}
+		if err := yaml.Unmarshal(contents, &document); err != nil || len(document.InstanceGroups) == 0 {
+			// Opinions and other files living with the role manifests
+			continue
+		}
+		name := strings.TrimSuffix(file.Name(), ext)
+		if other, ok := manifests[name]; ok {
+			return nil, fmt.Errorf("Role manifests %s and %s have the same name", other, path)
+		}
+		manifests[name] = path
+	}
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("No role manifests found in %s", dir)
+	}
+	return manifests, nil
+}
+
+// BuildAll builds the packages, images, and helm charts of all role
+// manifests of a directory.  All role manifests are loaded before anything
+// is built, and their packages are compiled before any image is built, into
+// the compilation directory they share, so that packages used by several
+// role manifests are compiled once.  A role manifest failing to build does
+// not stop the others; the summary lists the outcome of each.  Each role
+// manifest has its own lockfile, `<name>.fissile.lock`, next to it, which is
+// checked with --locked and written otherwise.
+func (f *Fissile) BuildAll(ctx context.Context, opt BuildAllOptions) error {
+	manifests, err := FindRoleManifests(opt.ManifestDir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(manifests))
+	for name := range manifests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]*BuildAllResult, len(names))
+	loaded := make([]*model.RoleManifest, len(names))
+	fail := func(result *BuildAllResult, err error) {
+		result.Error = err.Error()
+		f.UI.Printf("%s %s: %v\n", color.RedString("Failed to build"), color.YellowString(result.Name), err)
+	}
+	// Each role manifest is loaded once, and made the manifest in use for
+	// each stage of its build
+	useManifest := func(index int) {
+		f.Options.RoleManifest = results[index].RoleManifest
+		f.Options.Lockfile = filepath.Join(filepath.Dir(results[index].RoleManifest), names[index]+"."+LockfileName)
+		f.Manifest = loaded[index]
+	}
+
+	for index, name := range names {
+		results[index] = &BuildAllResult{Name: name, RoleManifest: manifests[name], Stage: BuildStageLoad}
+		useManifest(index)
+		if err := f.LoadManifest(); err != nil {
+			fail(results[index], err)
+			continue
+		}
+		loaded[index] = f.Manifest
+		results[index].InstanceGroups = len(f.Manifest.InstanceGroups)
+		results[index].Stage = BuildStageCompile
+	}
+
+	for index, result := range results {
+		if result.Error != "" {
+			continue
+		}
+		start := time.Now()
+		f.UI.Printf("%s %s\n", color.GreenString("Compiling packages of"), color.YellowString(result.Name))
+		useManifest(index)
+		err := f.Compile(ctx, opt.Stemcell, f.StemcellCompilationDir(opt.Stemcell), f.Options.RoleManifest, f.Options.Metrics,
+			nil, nil, f.Options.Workers, opt.DockerNetworkMode, opt.WithoutDocker, f.Options.Verbose,
+			opt.CompilationCacheConfig, opt.StreamPackages, opt.Hermetic, opt.WarmContainers, opt.ContainerSettings)
+		// Compiling is shared, and only counts for the first role manifest
+		// needing the packages
+		result.Duration += time.Since(start)
+		if err != nil {
+			fail(result, err)
+			continue
+		}
+		result.Stage = BuildStageImages
+	}
+
+	for index, result := range results {
+		if result.Error != "" {
+			continue
+		}
+		start := time.Now()
+		f.UI.Printf("%s %s\n", color.GreenString("Building images of"), color.YellowString(result.Name))
+		useManifest(index)
+		images := opt.Images
+		images.Stemcell = opt.Stemcell
+		if err := f.BuildImages(ctx, images); err != nil {
+			result.Duration += time.Since(start)
+			fail(result, err)
+			continue
+		}
+
+		if opt.Helm != nil {
+			result.Stage = BuildStageHelm
+			f.UI.Printf("%s %s\n", color.GreenString("Generating the helm chart of"), color.YellowString(result.Name))
+			settings := *opt.Helm
+			settings.OutputDir = filepath.Join(opt.Helm.OutputDir, result.Name)
+			err := os.MkdirAll(settings.OutputDir, 0755)
+			if err == nil {
+				err = f.Export(ctx, "helm", settings)
+			}
+			if err != nil {
+				result.Duration += time.Since(start)
+				fail(result, err)
+				continue
+			}
+			result.Chart = settings.OutputDir
+		}
+		result.Duration += time.Since(start)
+		result.Stage = BuildStageDone
+	}
+
+	if err := f.showBuildAllResults(results); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d role manifests failed to build", failed, len(results))
+	}
+	return nil
+}
+
+func (f *Fissile) showBuildAllResults(results []*BuildAllResult) error {
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman:
+		f.UI.Println(color.GreenString("Summary:"))
+		table := termui.NewTable("Role Manifest", "Instance Groups", "Outcome", "Chart", "Duration")
+		for _, result := range results {
+			outcome := color.GreenString("built")
+			if result.Error != "" {
+				outcome = color.RedString("failed to %s", result.Stage)
+			}
+			table.Add(result.Name,
+				fmt.Sprintf("%d", result.InstanceGroups),
+				outcome,
+				result.Chart,
+				result.Duration.Round(time.Second).String())
+		}
+		f.printTable(table)
+	case OutputFormatJSON:
+		buf, err := json.Marshal(results)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(results)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", f.Options.OutputFormat)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindRoleManifests(t *testing.T) {
+	t.Parallel()
+
+	tempDir, err := ioutil.TempDir("", "fissile-build-all-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	write := func(name, contents string) {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(tempDir, name), []byte(contents), 0644))
+	}
+
+	_, err = FindRoleManifests(tempDir)
+	assert.EqualError(t, err, "No role manifests found in "+tempDir)
+
+	write("cf.yml", "instance_groups:\n- name: api\n")
+	write("uaa.yaml", "instance_groups:\n- name: uaa\n")
+	write("opinions.yml", "properties: {}\n")
+	write("README.md", "instance_groups:\n- name: docs\n")
+	require.NoError(t, os.Mkdir(filepath.Join(tempDir, "charts.yml"), 0755))
+
+	manifests, err := FindRoleManifests(tempDir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"cf":  filepath.Join(tempDir, "cf.yml"),
+		"uaa": filepath.Join(tempDir, "uaa.yaml"),
+	}, manifests)
+
+	write("cf.yaml", "instance_groups:\n- name: router\n")
+	_, err = FindRoleManifests(tempDir)
+	assert.EqualError(t, err, "Role manifests "+filepath.Join(tempDir, "cf.yaml")+" and "+filepath.Join(tempDir, "cf.yml")+" have the same name")
+}
@@ -3,9 +3,11 @@ package app
 import (
 	"archive/tar"
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"code.cloudfoundry.org/fissile/builder"
 	"code.cloudfoundry.org/fissile/docker"
@@ -21,24 +23,29 @@ type BuildImagesOptions struct {
 	NoBuild                  bool
 	OutputDirectory          string
 	PatchPropertiesDirective string
+	Reproducible             bool
 	Roles                    []string
+	Scan                     ImageScanOptions
 	Stemcell                 string
 	StemcellID               string
 	TagExtra                 string
+	VersionRecord            string
 }
 
-// BuildImages builds all role images using releases.
-func (f *Fissile) BuildImages(opt BuildImagesOptions) error {
-	err := f.LoadManifest()
-	if err != nil {
-		return err
-	}
+// BuildImages builds all role images using releases.  Cancelling ctx stops
+// further role images from being built.
+func (f *Fissile) BuildImages(ctx context.Context, opt BuildImagesOptions) (err error) {
+	defer f.startOperation(OperationBuildImages)(&err)
+
 	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
 		return fmt.Errorf("Releases not loaded")
 	}
-	if errs := f.Validate(); len(errs) != 0 {
+	if errs := f.Validate(ValidateOptions{}); len(errs) != 0 {
 		return errs
 	}
+	if err := opt.Scan.validate(opt); err != nil {
+		return err
+	}
 
 	if opt.OutputDirectory != "" {
 		err := os.MkdirAll(opt.OutputDirectory, 0755)
@@ -57,29 +64,38 @@ func (f *Fissile) BuildImages(opt BuildImagesOptions) error {
 		defer stampy.Stamp(f.Options.Metrics, "fissile", "create-images", "done")
 	}
 
-	if opt.StemcellID == "" {
-		imageManager, err := docker.NewImageManager()
-		if err != nil {
-			return err
-		}
-
-		stemcellImage, err := imageManager.FindImage(opt.Stemcell)
-		if err != nil {
-			if _, ok := err.(docker.ErrImageNotFound); ok {
-				return fmt.Errorf("Stemcell %v", err)
-			}
-			return err
-		}
+	// The compiled packages are keyed by the stemcell name as given,
+	// independent of the registry it is pulled from
+	compilationDir := f.StemcellCompilationDir(opt.Stemcell)
+	stemcellName := opt.Stemcell
+	opt.Stemcell = f.MirrorImageName(opt.Stemcell)
 
+	// The stemcell image is looked up even with a given ID, for the digest
+	// recorded in the provenance of the images
+	imageManager, err := f.newImageManager()
+	if err != nil {
+		return err
+	}
+	stemcellImage, err := f.findStemcellImage(imageManager, opt.Stemcell)
+	if err != nil {
+		return err
+	}
+	if opt.StemcellID == "" {
 		opt.StemcellID = stemcellImage.ID
 	}
+	stemcellDigest := builder.StemcellDigest(opt.Stemcell, stemcellImage.RepoDigests, stemcellImage.ID)
+
+	if err := f.checkLock(stemcellName, opt.StemcellID); err != nil {
+		return err
+	}
 
 	packagesImageBuilder := &builder.PackagesImageBuilder{
 		RepositoryPrefix:     f.Options.RepositoryPrefix,
 		StemcellImageName:    opt.Stemcell,
 		StemcellImageID:      opt.StemcellID,
-		CompiledPackagesPath: f.StemcellCompilationDir(opt.Stemcell),
+		CompiledPackagesPath: compilationDir,
 		FissileVersion:       f.Version,
+		Reproducible:         opt.Reproducible,
 	}
 
 	instanceGroups, err := f.Manifest.SelectInstanceGroups(opt.Roles)
@@ -95,12 +111,28 @@ func (f *Fissile) BuildImages(opt BuildImagesOptions) error {
 	if err != nil {
 		return err
 	}
+	// The packages layer, and one image per instance group
+	done, total := 1, 1+len(instanceGroups)
+	f.emit(Event{
+		Type:      EventProgress,
+		Operation: OperationBuildImages,
+		Subject:   "packages",
+		Message:   "built packages layer",
+		Done:      done,
+		Total:     total,
+	})
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
 	imageName, err := packagesImageBuilder.GetImageName(f.Manifest, instanceGroups, f)
 	if err != nil {
 		return err
 	}
 
+	timings := f.Timings()
+	defer f.saveTimings(timings)
+
 	roleImageBuilder := &builder.RoleImageBuilder{
 		BaseImageName:      imageName,
 		DarkOpinionsPath:   f.Options.DarkOpinions,
@@ -109,18 +141,66 @@ func (f *Fissile) BuildImages(opt BuildImagesOptions) error {
 		FissileVersion:     f.Version,
 		Force:              opt.Force,
 		Grapher:            f,
+		ImageOptions:       f.roleImageOptions(),
 		LightOpinionsPath:  f.Options.LightOpinions,
 		ManifestPath:       f.Manifest.ManifestFilePath,
 		MetricsPath:        f.Options.Metrics,
 		NoBuild:            opt.NoBuild,
 		OutputDirectory:    opt.OutputDirectory,
 		RepositoryPrefix:   f.Options.RepositoryPrefix,
+		Reproducible:       opt.Reproducible,
+		StemcellDigest:     stemcellDigest,
+		StemcellImageID:    opt.StemcellID,
 		TagExtra:           opt.TagExtra,
 		UI:                 f.UI,
 		WorkerCount:        f.Options.Workers,
+		ResultHandler: func(instanceGroup *model.InstanceGroup, duration time.Duration, err error) {
+			if err == nil && duration > 0 {
+				timings.RecordImage(instanceGroup, duration)
+			}
+			done++
+			event := Event{
+				Type:      EventProgress,
+				Operation: OperationBuildImages,
+				Subject:   instanceGroup.Name,
+				Message:   "built image",
+				Err:       err,
+				Done:      done,
+				Total:     total,
+			}
+			if err != nil {
+				event.Message = "failed"
+			}
+			f.emit(event)
+		},
+	}
+
+	err = roleImageBuilder.Build(ctx, instanceGroups)
+	if err != nil {
+		return err
 	}
 
-	return roleImageBuilder.Build(instanceGroups)
+	if opt.VersionRecord != "" {
+		err = f.WriteImageSetRecord(opt.VersionRecord, instanceGroups, opt.TagExtra)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opt.Scan.Scanner != "" {
+		return f.ScanImages(instanceGroups, opt.TagExtra, opt.Scan)
+	}
+
+	return nil
+}
+
+// roleImageOptions returns the options of the role images changing their
+// contents, and thus their tags
+func (f *Fissile) roleImageOptions() model.RoleImageOptions {
+	return model.RoleImageOptions{
+		NoHealthcheck: f.Options.NoHealthcheck,
+		Attributions:  f.Options.Attributions,
+	}
 }
 
 // buildPackagesImage builds the docker image for the packages layer
@@ -131,7 +211,7 @@ func (f *Fissile) buildPackagesImage(
 	packagesImageBuilder *builder.PackagesImageBuilder,
 ) error {
 
-	dockerManager, err := docker.NewImageManager()
+	dockerManager, err := f.newImageManager()
 	if err != nil {
 		return fmt.Errorf("Error connecting to docker: %v", err)
 	}
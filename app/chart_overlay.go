@@ -0,0 +1,115 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/kube"
+	"github.com/fatih/color"
+)
+
+// recordGeneratedFile notes that a file was written by the current
+// GenerateKube.
+func (f *Fissile) recordGeneratedFile(path string) {
+	if f.generatedFiles != nil {
+		f.generatedFiles[filepath.Clean(path)] = true
+	}
+}
+
+// applyChartOverlay copies the files of the overlay directory into the output
+// directory, at the same relative paths: extra templates, helpers, icons and
+// the like which are maintained by hand and must survive regenerating the
+// chart.  Overlay files may not replace generated files, as that would hide
+// changes to them; all collisions are reported before anything is copied.
+func (f *Fissile) applyChartOverlay(settings kube.ExportSettings) error {
+	info, err := os.Stat(settings.OverlayDir)
+	if err != nil {
+		return fmt.Errorf("Error reading chart overlay directory: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("Chart overlay %s is not a directory", settings.OverlayDir)
+	}
+
+	var files []string
+	err = filepath.Walk(settings.OverlayDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			relativePath, err := filepath.Rel(settings.OverlayDir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, relativePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error reading chart overlay directory: %v", err)
+	}
+	sort.Strings(files)
+
+	var collisions []string
+	for _, file := range files {
+		if f.generatedFiles[filepath.Join(settings.OutputDir, file)] {
+			collisions = append(collisions, file)
+		}
+	}
+	if len(collisions) > 0 {
+		return fmt.Errorf("Chart overlay files collide with generated files:\n  %s", strings.Join(collisions, "\n  "))
+	}
+
+	for _, file := range files {
+		outputPath := filepath.Join(settings.OutputDir, file)
+		f.UI.Printf("Writing overlay %s\n", color.CyanString(outputPath))
+		var rewrite func(string) string
+		if settings.SubCharts && isChartTemplate(file) {
+			// Overlay templates use the chart values like the generated ones
+			rewrite = globalValues
+		}
+		if err := copyOverlayFile(filepath.Join(settings.OverlayDir, file), outputPath, rewrite); err != nil {
+			return fmt.Errorf("Error copying chart overlay file %s: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// copyOverlayFile copies a file, keeping its permissions.  The contents are
+// passed through rewrite, unless it is nil.
+func copyOverlayFile(source, destination string, rewrite func(string) string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	input, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return err
+	}
+	output, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if rewrite == nil {
+		_, err = io.Copy(output, input)
+	} else {
+		var contents []byte
+		contents, err = ioutil.ReadAll(input)
+		if err == nil {
+			_, err = io.WriteString(output, rewrite(string(contents)))
+		}
+	}
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/helm/render"
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKubeChartOverlay(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/two-roles.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	tempDir, err := ioutil.TempDir("", "fissile-test-chart-overlay")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	overlayDir := filepath.Join(tempDir, "overlay")
+	require.NoError(t, os.MkdirAll(filepath.Join(overlayDir, "templates"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(overlayDir, "templates", "_extra.tpl"), []byte("{{- define \"extra\" }}{{- end }}\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(overlayDir, "icon.svg"), []byte("<svg/>\n"), 0644))
+
+	opinions, err := model.NewOpinions(
+		filepath.Join(workDir, "../test-assets/tor-opinions/opinions.yml"),
+		filepath.Join(workDir, "../test-assets/tor-opinions/dark-opinions.yml"))
+	require.NoError(t, err)
+	settings := kube.ExportSettings{
+		OutputDir:       filepath.Join(tempDir, "chart"),
+		CreateHelmChart: true,
+		Opinions:        opinions,
+		OverlayDir:      overlayDir,
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(settings.OutputDir, "templates"), 0755))
+
+	require.NoError(t, f.GenerateKube(context.Background(), settings))
+	contents, err := ioutil.ReadFile(filepath.Join(settings.OutputDir, "templates", "_extra.tpl"))
+	require.NoError(t, err)
+	assert.Contains(t, string(contents), "extra")
+	_, err = os.Stat(filepath.Join(settings.OutputDir, "icon.svg"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(settings.OutputDir, "values.yaml"))
+	assert.NoError(t, err)
+
+	// Overlay files must not replace generated files
+	require.NoError(t, ioutil.WriteFile(filepath.Join(overlayDir, "values.yaml"), []byte("{}\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(overlayDir, "templates", "secrets.yaml"), []byte("{}\n"), 0644))
+	err = f.GenerateKube(context.Background(), settings)
+	assert.EqualError(t, err, "Chart overlay files collide with generated files:\n  templates/secrets.yaml\n  values.yaml")
+
+	settings.OverlayDir = filepath.Join(tempDir, "missing")
+	err = f.GenerateKube(context.Background(), settings)
+	assert.Error(t, err)
+}
+
+func TestGenerateKubeChartOverlayHelpers(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/two-roles.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	tempDir, err := ioutil.TempDir("", "fissile-test-chart-overlay")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Charts conventionally have a _helpers.tpl of their own, which must
+	// not collide with the generated helpers
+	overlayDir := filepath.Join(tempDir, "overlay")
+	require.NoError(t, os.MkdirAll(filepath.Join(overlayDir, "templates"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(overlayDir, "templates", "_helpers.tpl"),
+		[]byte("{{- define \"overlay.name\" }}overlay-{{ .Release.Name }}{{- end }}\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(overlayDir, "templates", "extra.yaml"), []byte(`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ include "overlay.name" . }}
+data:
+  image: {{ include "fissile.ImageName" (dict "kube" .Values.kube "image" "extra:1") }}
+`), 0644))
+
+	settings := kube.ExportSettings{
+		OutputDir:       filepath.Join(tempDir, "chart"),
+		CreateHelmChart: true,
+		Opinions:        model.NewEmptyOpinions(),
+		OverlayDir:      overlayDir,
+		Organization:    "splatform",
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(settings.OutputDir, "templates"), 0755))
+	require.NoError(t, f.GenerateKube(context.Background(), settings))
+	assert.FileExists(t, filepath.Join(settings.OutputDir, "templates", kube.HelmHelpersFileName))
+
+	chart, err := render.LoadChart(settings.OutputDir)
+	require.NoError(t, err)
+	documents, err := chart.RenderTemplate("extra.yaml", nil)
+	require.NoError(t, err)
+	require.Len(t, documents, 1)
+	configMap := documents[0].(map[interface{}]interface{})
+	assert.Equal(t, "overlay-MyRelease", configMap["metadata"].(map[interface{}]interface{})["name"])
+	assert.Equal(t, "docker.io/splatform/extra:1", configMap["data"].(map[interface{}]interface{})["image"])
+}
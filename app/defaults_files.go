@@ -0,0 +1,171 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+	"code.cloudfoundry.org/fissile/validation"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ApplyDefaultsFiles returns a copy of the role manifest in which the defaults
+// of the variables are replaced by the values from the defaults files; the
+// role manifest itself is not changed.  Without files it is returned as is.
+// The files are layered:
+// values from later files take precedence.  Files with a .yml or .yaml
+// extension contain a mapping of variable names to values; all others are
+// environment files with KEY=value lines.  Values are converted to the type of
+// the default in the role manifest, if it has one.  Files encrypted with SOPS
+// are decrypted with sops.  The error lists all
+// unknown variables and values which cannot be converted.
+func ApplyDefaultsFiles(roleManifest *model.RoleManifest, paths []string) (*model.RoleManifest, error) {
+	if len(paths) == 0 {
+		return roleManifest, nil
+	}
+	roleManifest = roleManifest.Copy()
+	variables := make(map[string]*model.VariableDefinition)
+	for _, variable := range roleManifest.Variables {
+		variables[variable.Name] = variable
+	}
+
+	allErrs := validation.ErrorList{}
+	for _, path := range paths {
+		values, err := readDefaultsFile(path)
+		if err != nil {
+			return nil, err
+		}
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			variable, ok := variables[name]
+			if !ok {
+				allErrs = append(allErrs, validation.NotFound(path, name))
+				continue
+			}
+			field := fmt.Sprintf("%s[%s]", path, name)
+			value, err := coerceDefault(variable.CVOptions.Default, values[name])
+			if err != nil {
+				allErrs = append(allErrs, validation.Invalid(field, values[name], err.Error()))
+				continue
+			}
+			variable.CVOptions.Default = value
+		}
+	}
+
+	if len(allErrs) != 0 {
+		return nil, fmt.Errorf("Invalid defaults files:\n%s", allErrs.Error())
+	}
+	return roleManifest, nil
+}
+
+// readDefaultsFile returns the values of a YAML or environment defaults file.
+func readDefaultsFile(path string) (map[string]interface{}, error) {
+	format := util.SopsFormatDotenv
+	switch filepath.Ext(path) {
+	case ".yml", ".yaml":
+		format = util.SopsFormatYAML
+	}
+	contents, err := util.ReadSopsFile(path, format)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading defaults file %s: %v", path, err)
+	}
+
+	if format == util.SopsFormatYAML {
+		var values map[string]interface{}
+		if err := yaml.Unmarshal(contents, &values); err != nil {
+			return nil, fmt.Errorf("Error reading defaults file %s: %v", path, err)
+		}
+		return values, nil
+	}
+
+	values := make(map[string]interface{})
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("Error reading defaults file %s: line %d: expected KEY=value", path, lineNumber)
+		}
+		value := strings.TrimSpace(parts[1])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			if value[0] == '"' {
+				unquoted, err := strconv.Unquote(value)
+				if err != nil {
+					return nil, fmt.Errorf("Error reading defaults file %s: line %d: %v", path, lineNumber, err)
+				}
+				value = unquoted
+			} else {
+				value = value[1 : len(value)-1]
+			}
+		}
+		values[strings.TrimSpace(parts[0])] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Error reading defaults file %s: %v", path, err)
+	}
+	return values, nil
+}
+
+// coerceDefault converts the value to the type of the current default.  Text
+// is parsed as YAML for defaults which are not strings; scalars become text
+// for defaults which are strings, or missing.
+func coerceDefault(current, value interface{}) (interface{}, error) {
+	expected := valueKind(current)
+	if text, ok := value.(string); ok && expected != "" && expected != "string" {
+		if err := yaml.Unmarshal([]byte(text), &value); err != nil {
+			return nil, fmt.Errorf("expected a %s: %v", expected, err)
+		}
+	}
+
+	actual := valueKind(value)
+	switch {
+	case expected == "" || expected == "string":
+		switch actual {
+		case "string":
+			return value, nil
+		case "boolean", "number":
+			return fmt.Sprintf("%v", value), nil
+		case "":
+			return nil, nil
+		}
+		if expected == "" {
+			return value, nil
+		}
+	case actual == expected:
+		return value, nil
+	}
+	return nil, fmt.Errorf("expected a %s, not a %s", expected, actual)
+}
+
+// valueKind returns the kind of a value read from YAML, or the empty string
+// for nil.
+func valueKind(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	switch reflect.TypeOf(value).Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int64, reflect.Uint64, reflect.Float64:
+		return "number"
+	case reflect.Map:
+		return "mapping"
+	case reflect.Slice:
+		return "list"
+	}
+	return "string"
+}
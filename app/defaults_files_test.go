@@ -0,0 +1,96 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func defaultsFilesTestManifest() *model.RoleManifest {
+	return &model.RoleManifest{
+		Variables: model.Variables{
+			{Name: "HOSTNAME", CVOptions: model.CVOptions{Default: "localhost"}},
+			{Name: "PORT", CVOptions: model.CVOptions{Default: 8080}},
+			{Name: "DEBUG", CVOptions: model.CVOptions{Default: false}},
+			{Name: "PASSWORD", CVOptions: model.CVOptions{Secret: true}},
+		},
+	}
+}
+
+func writeDefaultsFile(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	return path
+}
+
+func TestApplyDefaultsFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fissile-defaults-files-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("Layering", func(t *testing.T) {
+		base := writeDefaultsFile(t, dir, "base.yml", "HOSTNAME: base.example.com\nPORT: 9090\n")
+		environment := writeDefaultsFile(t, dir, "environment.env", "# environment\nexport HOSTNAME=\"env.example.com\"\nDEBUG=true\n")
+		secrets := writeDefaultsFile(t, dir, "secrets.env", "PASSWORD='hunter2'\n")
+
+		original := defaultsFilesTestManifest()
+		roleManifest, err := ApplyDefaultsFiles(original, []string{base, environment, secrets})
+		require.NoError(t, err)
+		assert.Equal(t, defaultsFilesTestManifest().Variables, original.Variables, "The role manifest is not changed")
+
+		defaults := make(map[string]interface{})
+		for _, variable := range roleManifest.Variables {
+			defaults[variable.Name] = variable.CVOptions.Default
+		}
+		assert.Equal(t, map[string]interface{}{
+			"HOSTNAME": "env.example.com",
+			"PORT":     9090,
+			"DEBUG":    true,
+			"PASSWORD": "hunter2",
+		}, defaults)
+	})
+
+	t.Run("Coercion", func(t *testing.T) {
+		path := writeDefaultsFile(t, dir, "coercion.yml", "HOSTNAME: 42\nPASSWORD: true\n")
+
+		roleManifest, err := ApplyDefaultsFiles(defaultsFilesTestManifest(), []string{path})
+		require.NoError(t, err)
+		assert.Equal(t, "42", roleManifest.Variables[0].CVOptions.Default)
+		assert.Equal(t, "true", roleManifest.Variables[3].CVOptions.Default)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		path := writeDefaultsFile(t, dir, "errors.env", "PORT=http\nUNKNOWN=1\n")
+
+		_, err := ApplyDefaultsFiles(defaultsFilesTestManifest(), []string{path})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), path+"[PORT]: Invalid value: \"http\": expected a number, not a string")
+		assert.Contains(t, err.Error(), path+": Not found: \"UNKNOWN\"")
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		path := writeDefaultsFile(t, dir, "malformed.env", "HOSTNAME\n")
+
+		_, err := ApplyDefaultsFiles(defaultsFilesTestManifest(), []string{path})
+		assert.EqualError(t, err, "Error reading defaults file "+path+": line 1: expected KEY=value")
+	})
+
+	t.Run("Encrypted", func(t *testing.T) {
+		fakeSops := writeDefaultsFile(t, dir, "sops", "#!/bin/sh\necho 'HOSTNAME: decrypted.example.com'\n")
+		require.NoError(t, os.Chmod(fakeSops, 0755))
+		defer func(command string) { util.SopsCommand = command }(util.SopsCommand)
+		util.SopsCommand = fakeSops
+
+		path := writeDefaultsFile(t, dir, "encrypted.yml", "HOSTNAME: ENC[AES256_GCM,data:x]\nsops:\n  mac: ENC[AES256_GCM,data:y]\n")
+
+		roleManifest, err := ApplyDefaultsFiles(defaultsFilesTestManifest(), []string{path})
+		require.NoError(t, err)
+		assert.Equal(t, "decrypted.example.com", roleManifest.Variables[0].CVOptions.Default)
+	})
+}
@@ -0,0 +1,168 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/fatih/color"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DockerComposeOptions are the options of GenerateDockerCompose
+type DockerComposeOptions struct {
+	OutputFile     string   // Path of the compose file to write
+	InstanceGroups []string // Instance groups to run, along with those they depend on; all if empty
+	DefaultsFiles  []string // Files overriding the defaults of variables, later files take precedence
+	TagExtra       string   // Additional information used to compute the image tags
+}
+
+// composeFile is a docker compose file, version 3
+type composeFile struct {
+	Version  string                     `yaml:"version"`
+	Services map[string]*composeService `yaml:"services"`
+	Volumes  map[string]struct{}        `yaml:"volumes,omitempty"`
+}
+
+// composeService is a service of a docker compose file
+type composeService struct {
+	Image       string                     `yaml:"image"`
+	Entrypoint  []string                   `yaml:"entrypoint,omitempty"`
+	Command     []string                   `yaml:"command,omitempty"`
+	Environment map[string]string          `yaml:"environment,omitempty"`
+	Ports       []string                   `yaml:"ports,omitempty"`
+	Volumes     []string                   `yaml:"volumes,omitempty"`
+	DependsOn   []string                   `yaml:"depends_on,omitempty"`
+	NetworkMode string                     `yaml:"network_mode,omitempty"`
+	Networks    map[string]*composeNetwork `yaml:"networks,omitempty"`
+	Privileged  bool                       `yaml:"privileged,omitempty"`
+	CapAdd      []string                   `yaml:"cap_add,omitempty"`
+	Restart     string                     `yaml:"restart,omitempty"`
+}
+
+// composeNetwork is the configuration of a service on a network
+type composeNetwork struct {
+	Aliases []string `yaml:"aliases,omitempty"`
+}
+
+// GenerateDockerCompose writes a docker compose file running the role images
+// of the instance groups on a single host, one service per instance group,
+// so that developers can run a subset of them without a cluster.  The images
+// must have been built before.
+func (f *Fissile) GenerateDockerCompose(opts DockerComposeOptions) error {
+	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
+		return fmt.Errorf("Releases not loaded")
+	}
+	roleManifest, err := ApplyDefaultsFiles(f.Manifest, opts.DefaultsFiles)
+	if err != nil {
+		return err
+	}
+
+	instanceGroups, err := localInstanceGroups(roleManifest, opts.InstanceGroups)
+	if err != nil {
+		return err
+	}
+
+	opinions, err := model.NewOpinions(f.Options.LightOpinions, f.Options.DarkOpinions)
+	if err != nil {
+		return fmt.Errorf("Error loading opinions: %v", err)
+	}
+	settings := kube.ExportSettings{
+		RoleManifest: roleManifest,
+		Opinions:     opinions,
+		TagExtra:     opts.TagExtra,
+	}
+
+	compose := composeFile{
+		Version:  "3",
+		Services: make(map[string]*composeService),
+	}
+	for _, instanceGroup := range instanceGroups {
+		service, err := newComposeService(instanceGroup, settings)
+		if err != nil {
+			return fmt.Errorf("Instance group %s: %v", instanceGroup.Name, err)
+		}
+		service.Image, err = f.localImageName(instanceGroup, opinions, opts.TagExtra)
+		if err != nil {
+			return err
+		}
+		for _, volume := range instanceGroup.Run.Volumes {
+			if volume.Type == model.VolumeTypePersistent || volume.Type == model.VolumeTypeShared {
+				if compose.Volumes == nil {
+					compose.Volumes = make(map[string]struct{})
+				}
+				compose.Volumes[localVolumeName(instanceGroup, volume)] = struct{}{}
+			}
+		}
+		compose.Services[instanceGroup.Name] = service
+	}
+
+	contents, err := yaml.Marshal(compose)
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(opts.OutputFile); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	manifestPath := filepath.Join(filepath.Dir(opts.OutputFile), localDeploymentManifestName)
+	f.UI.Printf("Writing deployment manifest %s\n", color.CyanString(manifestPath))
+	if err := writeLocalDeploymentManifest(roleManifest, manifestPath); err != nil {
+		return err
+	}
+	f.UI.Printf("Writing docker compose file %s\n", color.CyanString(opts.OutputFile))
+	return ioutil.WriteFile(opts.OutputFile, contents, 0644)
+}
+
+// newComposeService creates the service running the instance group, except for
+// its image.  Colocated containers share the network of their main instance
+// group, like they share its pod, and the main instance group publishes their
+// ports.  All services mount the deployment manifest written next to the
+// compose file.
+func newComposeService(instanceGroup *model.InstanceGroup, settings kube.ExportSettings) (*composeService, error) {
+	service := &composeService{
+		Entrypoint: instanceGroup.Run.Command,
+		Command:    instanceGroup.Run.Args,
+		Ports:      localPorts(instanceGroup),
+		Volumes:    append(localVolumes(instanceGroup), fmt.Sprintf("./%s:%s:ro", localDeploymentManifestName, localDeploymentManifestPath)),
+		Privileged: instanceGroup.Run.Privileged,
+		CapAdd:     instanceGroup.Run.Capabilities,
+		DependsOn:  linkDependencies(instanceGroup),
+		Restart:    "unless-stopped",
+	}
+	if instanceGroup.Type == model.RoleTypeBoshTask {
+		service.Restart = "on-failure"
+	}
+
+	environment, secrets, err := localEnvironment(instanceGroup, settings)
+	if err != nil {
+		return nil, err
+	}
+	service.Environment = make(map[string]string)
+	for name, value := range environment {
+		service.Environment[name] = composeEscape(value)
+	}
+	for _, name := range secrets {
+		service.Environment[name] = fmt.Sprintf("${%s}", name)
+	}
+
+	if parent := colocationParent(instanceGroup); parent != "" {
+		service.NetworkMode = "service:" + parent
+		service.DependsOn = append(service.DependsOn, parent)
+	} else if aliases := localServiceAliases(instanceGroup); len(aliases) > 0 {
+		service.Networks = map[string]*composeNetwork{"default": {Aliases: aliases}}
+	}
+
+	return service, nil
+}
+
+// composeEscape escapes the value for docker compose, which would otherwise
+// interpolate variables into it
+func composeEscape(value string) string {
+	return strings.Replace(value, "$", "$$", -1)
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestGenerateDockerCompose(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+	outputDir, err := ioutil.TempDir("", "fissile-docker-compose-")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/docker-compose.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/ntp-release"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	f.Options.LightOpinions = filepath.Join(workDir, "../test-assets/ntp-opinions/opinions.yml")
+	f.Options.DarkOpinions = filepath.Join(workDir, "../test-assets/ntp-opinions/dark-opinions.yml")
+	f.Options.RepositoryPrefix = "fissile"
+	require.NoError(t, f.LoadManifest())
+
+	outputFile := filepath.Join(outputDir, "docker-compose.yml")
+	require.NoError(t, f.GenerateDockerCompose(DockerComposeOptions{
+		OutputFile:     outputFile,
+		InstanceGroups: []string{"client"},
+	}))
+	contents, err := ioutil.ReadFile(outputFile)
+	require.NoError(t, err)
+
+	var compose composeFile
+	require.NoError(t, yaml.Unmarshal(contents, &compose))
+	assert.Equal(t, "3", compose.Version)
+	require.Len(t, compose.Services, 3, "The unrelated instance group is left out")
+	assert.Contains(t, compose.Volumes, "server-store")
+
+	client := compose.Services["client"]
+	require.NotNil(t, client)
+	assert.Equal(t, []string{"server"}, client.DependsOn)
+	assert.Equal(t, "unless-stopped", client.Restart)
+	assert.Contains(t, client.Image, "fissile-client:")
+
+	server := compose.Services["server"]
+	require.NotNil(t, server)
+	assert.Empty(t, server.DependsOn)
+	assert.Equal(t, []string{"123:123/udp", "8080:8080/tcp"}, server.Ports, "The ports of colocated containers are published by the main service")
+	assert.Equal(t, []string{
+		"server-store:/var/vcap/store",
+		"./deployment-manifest.yml:/opt/fissile/config/deployment-manifest.yml:ro",
+	}, server.Volumes)
+	assert.Equal(t, []string{"SYS_TIME"}, server.CapAdd)
+	assert.Equal(t, []string{"server-ntpd"}, server.Networks["default"].Aliases)
+	assert.Equal(t, "server $$POOL", server.Environment["NTP_CONF"], "Literal values are escaped")
+	assert.Equal(t, "${PRIVATE_KEY}", server.Environment["PRIVATE_KEY"], "Secrets without a default are read from the environment")
+	assert.Equal(t, localNamespace, server.Environment["KUBERNETES_NAMESPACE"])
+	assert.NotContains(t, server.Environment, "CONFIGGIN_SA_TOKEN")
+
+	sidecar := compose.Services["sidecar"]
+	require.NotNil(t, sidecar)
+	assert.Equal(t, "service:server", sidecar.NetworkMode)
+	assert.Empty(t, sidecar.Ports)
+	assert.Contains(t, sidecar.Volumes, "./deployment-manifest.yml:/opt/fissile/config/deployment-manifest.yml:ro")
+
+	manifest, err := ioutil.ReadFile(filepath.Join(outputDir, "deployment-manifest.yml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(manifest), `name: "server"`)
+
+	assert.EqualError(t, f.GenerateDockerCompose(DockerComposeOptions{
+		OutputFile:     outputFile,
+		InstanceGroups: []string{"bogus"},
+	}), "Instance group bogus not found")
+}
@@ -0,0 +1,299 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/compilator"
+	"code.cloudfoundry.org/fissile/docker"
+	"code.cloudfoundry.org/fissile/util"
+	"github.com/fatih/color"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DoctorOptions are the options of the environment diagnostics
+type DoctorOptions struct {
+	Stemcell               string // stemcell image to look for; not checked if empty
+	CompilationCacheConfig string // configuration of the compiled package cache
+}
+
+// DoctorStatus is the outcome of a diagnostic check
+type DoctorStatus string
+
+// The outcomes of diagnostic checks
+const (
+	DoctorOK      DoctorStatus = "ok"
+	DoctorWarning DoctorStatus = "warning"
+	DoctorFailed  DoctorStatus = "failed"
+	DoctorSkipped DoctorStatus = "skipped"
+)
+
+// DoctorResult is the outcome of a diagnostic check, with the steps to take
+// to fix a problem
+type DoctorResult struct {
+	Check       string       `json:"check" yaml:"check"`
+	Status      DoctorStatus `json:"status" yaml:"status"`
+	Summary     string       `json:"summary" yaml:"summary"`
+	Remediation string       `json:"remediation,omitempty" yaml:"remediation,omitempty"`
+}
+
+// doctorDocker is the part of the docker image manager the checks use
+type doctorDocker interface {
+	ServerVersion() (string, string, error)
+	HasImage(imageName string) (bool, error)
+}
+
+// minimumFreeDiskSpace is the free space in the work directory below which
+// compiling packages and building images is likely to run out of space
+const minimumFreeDiskSpace = 20 << 30
+
+// minimumOpenFilesLimit is the limit of open files below which compiling
+// packages with many workers is likely to fail
+const minimumOpenFilesLimit = 4096
+
+// Doctor checks the environment fissile runs in and reports the problems
+// found, with the steps to fix them.  It returns an error if any check
+// failed; warnings only point out problems some commands may run into.
+func (f *Fissile) Doctor(opts DoctorOptions) error {
+	var dockerManager doctorDocker
+	imageManager, dockerErr := f.newImageManager()
+	if dockerErr == nil {
+		dockerManager = imageManager
+	}
+
+	results := []DoctorResult{}
+	dockerResult := checkDocker(dockerManager, dockerErr)
+	results = append(results, dockerResult)
+	if dockerResult.Status == DoctorFailed {
+		dockerManager = nil
+	}
+	results = append(results,
+		f.checkStemcell(dockerManager, opts.Stemcell),
+		checkWorkDir(f.Options.WorkDir),
+	)
+	results = append(results, platformDoctorChecks(f.Options.WorkDir)...)
+	results = append(results, checkPackageCache(opts.CompilationCacheConfig, f.StemcellCompilationDir(opts.Stemcell), opts.Stemcell))
+
+	if err := f.showDoctorResults(results); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Status == DoctorFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
+
+func (f *Fissile) showDoctorResults(results []DoctorResult) error {
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman:
+		for _, result := range results {
+			f.UI.Printf("[%s] %s: %s\n", doctorStatusString(result.Status), result.Check, result.Summary)
+			if result.Remediation != "" && (result.Status == DoctorWarning || result.Status == DoctorFailed) {
+				f.UI.Printf("    Fix: %s\n", result.Remediation)
+			}
+		}
+	case OutputFormatJSON:
+		buf, err := json.Marshal(results)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(results)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", f.Options.OutputFormat)
+	}
+	return nil
+}
+
+// doctorStatusString returns the status for humans, colored and padded to
+// the same width
+func doctorStatusString(status DoctorStatus) string {
+	switch status {
+	case DoctorOK:
+		return color.GreenString("  OK   ")
+	case DoctorWarning:
+		return color.YellowString("WARNING")
+	case DoctorFailed:
+		return color.RedString("FAILED ")
+	}
+	return color.CyanString("SKIPPED")
+}
+
+// checkDocker checks that the docker daemon can be reached, and supports the
+// API fissile uses
+func checkDocker(dockerManager doctorDocker, clientErr error) DoctorResult {
+	result := DoctorResult{Check: "Docker daemon"}
+	if clientErr != nil {
+		result.Status = DoctorFailed
+		result.Summary = fmt.Sprintf("Cannot create a docker client: %v", clientErr)
+		result.Remediation = "Fix the DOCKER_HOST, DOCKER_TLS_VERIFY, and DOCKER_CERT_PATH environment variables, or unset them to use the local daemon"
+		return result
+	}
+
+	version, apiVersion, err := dockerManager.ServerVersion()
+	if err != nil {
+		result.Status = DoctorFailed
+		result.Summary = fmt.Sprintf("Cannot connect to the docker daemon: %v", err)
+		result.Remediation = "Start the docker daemon, and make sure your user can access its socket, e.g. by adding it to the docker group"
+		return result
+	}
+	if err := docker.CheckAPIVersion(apiVersion); err != nil {
+		result.Status = DoctorFailed
+		result.Summary = err.Error()
+		result.Remediation = fmt.Sprintf("Upgrade docker to a version supporting API %s or later", docker.MinimumAPIVersion)
+		return result
+	}
+
+	result.Status = DoctorOK
+	result.Summary = fmt.Sprintf("Docker %s (API %s)", version, apiVersion)
+	return result
+}
+
+// checkStemcell checks that the stemcell image is available, or can be pulled
+func (f *Fissile) checkStemcell(dockerManager doctorDocker, stemcell string) DoctorResult {
+	result := DoctorResult{Check: "Stemcell image"}
+	if stemcell == "" {
+		result.Status = DoctorSkipped
+		result.Summary = "No stemcell given; use --stemcell to check it"
+		return result
+	}
+	if dockerManager == nil {
+		result.Status = DoctorSkipped
+		result.Summary = "The docker daemon is not available"
+		return result
+	}
+
+	stemcell = f.MirrorImageName(stemcell)
+	hasImage, err := dockerManager.HasImage(stemcell)
+	switch {
+	case err != nil:
+		result.Status = DoctorFailed
+		result.Summary = fmt.Sprintf("Error looking up stemcell image %s: %v", stemcell, err)
+		result.Remediation = "Check that the docker daemon is healthy, e.g. with `docker images`"
+	case hasImage:
+		result.Status = DoctorOK
+		result.Summary = fmt.Sprintf("%s is available", stemcell)
+	case f.Options.Offline:
+		result.Status = DoctorFailed
+		result.Summary = util.NewOfflineError(fmt.Sprintf("Pulling stemcell image %s", stemcell), "load it with `docker load` first").Error()
+		result.Remediation = fmt.Sprintf("Load the stemcell with `docker load`, or pull it with `docker pull %s` while online", stemcell)
+	default:
+		result.Status = DoctorWarning
+		result.Summary = fmt.Sprintf("%s is not available locally", stemcell)
+		result.Remediation = fmt.Sprintf("Pull the stemcell ahead of time with `docker pull %s`", stemcell)
+	}
+	return result
+}
+
+// checkWorkDir checks that files can be written to the work directory
+func checkWorkDir(workDir string) DoctorResult {
+	result := DoctorResult{Check: "Work directory"}
+	err := os.MkdirAll(workDir, 0755)
+	if err == nil {
+		var file *os.File
+		file, err = ioutil.TempFile(workDir, ".fissile-doctor-")
+		if err == nil {
+			file.Close()
+			err = os.Remove(file.Name())
+		}
+	}
+	if err != nil {
+		result.Status = DoctorFailed
+		result.Summary = fmt.Sprintf("Cannot write to %s: %v", workDir, err)
+		result.Remediation = "Make the directory writable, or use --work-dir to pick another one"
+		return result
+	}
+	result.Status = DoctorOK
+	result.Summary = fmt.Sprintf("%s is writable", workDir)
+	return result
+}
+
+// checkDiskSpace checks that the free space in the work directory is enough
+// for compiling packages and building images
+func checkDiskSpace(workDir string, free uint64) DoctorResult {
+	result := DoctorResult{
+		Check:   "Disk space",
+		Status:  DoctorOK,
+		Summary: fmt.Sprintf("%s free in %s", formatBytes(free), workDir),
+	}
+	if free < minimumFreeDiskSpace {
+		result.Status = DoctorWarning
+		result.Summary = fmt.Sprintf("Only %s free in %s, less than the recommended %s", formatBytes(free), workDir, formatBytes(minimumFreeDiskSpace))
+		result.Remediation = "Free up space, e.g. with `fissile build cleancache` and `docker system prune`, or use --work-dir on a larger disk"
+	}
+	return result
+}
+
+// checkOpenFilesLimit checks that the limit of open files is high enough for
+// compiling packages
+func checkOpenFilesLimit(limit uint64) DoctorResult {
+	result := DoctorResult{
+		Check:   "Open files limit",
+		Status:  DoctorOK,
+		Summary: fmt.Sprintf("%d open files", limit),
+	}
+	if limit < minimumOpenFilesLimit {
+		result.Status = DoctorWarning
+		result.Summary = fmt.Sprintf("Only %d open files allowed, less than the recommended %d", limit, minimumOpenFilesLimit)
+		result.Remediation = fmt.Sprintf("Raise the limit with `ulimit -n %d` before running fissile, or in /etc/security/limits.conf", minimumOpenFilesLimit)
+	}
+	return result
+}
+
+// checkPackageCache checks that the compiled package cache, if configured,
+// can be reached
+func checkPackageCache(configPath, compilationDir, stemcell string) DoctorResult {
+	result := DoctorResult{Check: "Compiled package cache"}
+	storage, err := compilator.NewPackageStorageFromConfig(configPath, compilationDir, stemcell)
+	if err != nil {
+		result.Status = DoctorFailed
+		result.Summary = fmt.Sprintf("Invalid configuration: %v", err)
+		result.Remediation = "Fix the configuration given with --compilation-cache-config"
+		return result
+	}
+	if storage == nil {
+		result.Status = DoctorSkipped
+		result.Summary = "No compiled package cache configured"
+		return result
+	}
+	if err := storage.Check(); err != nil {
+		result.Status = DoctorFailed
+		result.Summary = fmt.Sprintf("Cannot reach the %s cache: %v", storage.Kind, err)
+		result.Remediation = "Check the network connection, and the location and credentials given with --compilation-cache-config"
+		return result
+	}
+	result.Status = DoctorOK
+	mode := ""
+	if storage.ReadOnly {
+		mode = ", read only"
+	}
+	result.Summary = fmt.Sprintf("The %s cache is reachable%s", storage.Kind, mode)
+	return result
+}
+
+// formatBytes returns the size in the largest binary unit it has
+func formatBytes(size uint64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", value), ".0") + " " + units[unit]
+}
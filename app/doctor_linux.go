@@ -0,0 +1,125 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// capSysAdmin is the bit of CAP_SYS_ADMIN in the capability sets
+const capSysAdmin = 21
+
+// platformDoctorChecks returns the checks of the resources of the host,
+// and of the kernel features needed to compile packages without docker
+func platformDoctorChecks(workDir string) []DoctorResult {
+	var results []DoctorResult
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(existingAncestor(workDir), &stat); err != nil {
+		results = append(results, DoctorResult{
+			Check:   "Disk space",
+			Status:  DoctorWarning,
+			Summary: fmt.Sprintf("Cannot determine the free space in %s: %v", workDir, err),
+		})
+	} else {
+		results = append(results, checkDiskSpace(workDir, stat.Bavail*uint64(stat.Bsize)))
+	}
+
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		results = append(results, DoctorResult{
+			Check:   "Open files limit",
+			Status:  DoctorWarning,
+			Summary: fmt.Sprintf("Cannot determine the limit of open files: %v", err),
+		})
+	} else {
+		results = append(results, checkOpenFilesLimit(limit.Cur))
+	}
+
+	// Without the status, CAP_SYS_ADMIN is reported as missing
+	status, _ := ioutil.ReadFile("/proc/self/status")
+	results = append(results, checkMountNS(string(status), namespaceSupported("mnt"), namespaceSupported("net")))
+
+	return results
+}
+
+// checkMountNS checks the requirements of compiling packages without docker
+// (the mountns backend): mount namespaces, CAP_SYS_ADMIN, and bash; network
+// namespaces are needed for hermetic builds.  Problems are only warnings, as
+// compiling with docker does not need any of these.
+func checkMountNS(procStatus string, mountNamespaces, networkNamespaces bool) DoctorResult {
+	result := DoctorResult{Check: "Compilation without docker"}
+	var problems, fixes []string
+
+	if !mountNamespaces {
+		problems = append(problems, "the kernel does not support mount namespaces")
+		fixes = append(fixes, "use a kernel built with CONFIG_NAMESPACES")
+	}
+	if hasCap, err := hasCapability(procStatus, capSysAdmin); err != nil || !hasCap {
+		problems = append(problems, "fissile does not have CAP_SYS_ADMIN")
+		fixes = append(fixes, "run fissile as root")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		problems = append(problems, "bash is not on the PATH")
+		fixes = append(fixes, "install bash")
+	}
+	if len(problems) > 0 {
+		result.Status = DoctorWarning
+		result.Summary = fmt.Sprintf("--without-docker will not work: %s", strings.Join(problems, ", "))
+		result.Remediation = fmt.Sprintf("Compile packages with docker, or %s", strings.Join(fixes, ", "))
+		return result
+	}
+
+	if !networkNamespaces {
+		result.Status = DoctorWarning
+		result.Summary = "--without-docker --hermetic will not work: the kernel does not support network namespaces"
+		result.Remediation = "Compile hermetic builds with docker, or use a kernel built with CONFIG_NET_NS"
+		return result
+	}
+
+	result.Status = DoctorOK
+	result.Summary = "Mount and network namespaces are available"
+	return result
+}
+
+// hasCapability returns whether the effective capabilities in the contents of
+// /proc/<pid>/status include the capability
+func hasCapability(procStatus string, capability uint) (bool, error) {
+	for _, line := range strings.Split(procStatus, "\n") {
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+		capabilities, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "CapEff:")), 16, 64)
+		if err != nil {
+			return false, err
+		}
+		return capabilities&(1<<capability) != 0, nil
+	}
+	return false, fmt.Errorf("No effective capabilities found")
+}
+
+// namespaceSupported returns whether the kernel supports the kind of namespace
+func namespaceSupported(kind string) bool {
+	_, err := os.Stat(filepath.Join("/proc/self/ns", kind))
+	return err == nil
+}
+
+// existingAncestor returns the path, or its closest ancestor which exists
+func existingAncestor(path string) string {
+	path = filepath.Clean(path)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
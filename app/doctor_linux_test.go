@@ -0,0 +1,38 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasCapability(t *testing.T) {
+	t.Parallel()
+
+	hasCap, err := hasCapability("Name:\tfissile\nCapEff:\t0000003fffffffff\n", capSysAdmin)
+	assert.NoError(t, err)
+	assert.True(t, hasCap)
+
+	hasCap, err = hasCapability("CapEff:\t0000000000000000\n", capSysAdmin)
+	assert.NoError(t, err)
+	assert.False(t, hasCap)
+
+	_, err = hasCapability("Name:\tfissile\n", capSysAdmin)
+	assert.Error(t, err)
+}
+
+func TestCheckMountNS(t *testing.T) {
+	t.Parallel()
+
+	root := "CapEff:\t0000003fffffffff\n"
+	assert.Equal(t, DoctorOK, checkMountNS(root, true, true).Status)
+
+	result := checkMountNS("CapEff:\t0000000000000000\n", false, true)
+	assert.Equal(t, DoctorWarning, result.Status)
+	assert.Contains(t, result.Summary, "the kernel does not support mount namespaces, fissile does not have CAP_SYS_ADMIN")
+	assert.Contains(t, result.Remediation, "use a kernel built with CONFIG_NAMESPACES, run fissile as root")
+
+	result = checkMountNS(root, true, false)
+	assert.Equal(t, DoctorWarning, result.Status)
+	assert.Contains(t, result.Summary, "--hermetic")
+}
@@ -0,0 +1,13 @@
+// +build !linux
+
+package app
+
+// platformDoctorChecks returns the checks of the resources of the host,
+// which are only implemented on Linux
+func platformDoctorChecks(workDir string) []DoctorResult {
+	return []DoctorResult{{
+		Check:   "Host resources",
+		Status:  DoctorSkipped,
+		Summary: "Disk space, limits, and kernel features are only checked on Linux",
+	}}
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/docker"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDoctorDocker struct {
+	version    string
+	apiVersion string
+	err        error
+	images     map[string]bool
+}
+
+func (d fakeDoctorDocker) ServerVersion() (string, string, error) {
+	return d.version, d.apiVersion, d.err
+}
+
+func (d fakeDoctorDocker) HasImage(imageName string) (bool, error) {
+	return d.images[imageName], nil
+}
+
+func TestCheckDocker(t *testing.T) {
+	t.Parallel()
+
+	result := checkDocker(fakeDoctorDocker{version: "18.09.7", apiVersion: "1.39"}, nil)
+	assert.Equal(t, DoctorOK, result.Status)
+	assert.Equal(t, "Docker 18.09.7 (API 1.39)", result.Summary)
+
+	result = checkDocker(fakeDoctorDocker{version: "1.8.3", apiVersion: "1.20"}, nil)
+	assert.Equal(t, DoctorFailed, result.Status)
+	assert.Contains(t, result.Remediation, "API "+docker.MinimumAPIVersion)
+
+	result = checkDocker(fakeDoctorDocker{err: fmt.Errorf("connection refused")}, nil)
+	assert.Equal(t, DoctorFailed, result.Status)
+	assert.Equal(t, "Cannot connect to the docker daemon: connection refused", result.Summary)
+
+	result = checkDocker(nil, fmt.Errorf("invalid endpoint"))
+	assert.Equal(t, DoctorFailed, result.Status)
+	assert.Contains(t, result.Remediation, "DOCKER_HOST")
+}
+
+func TestCheckStemcell(t *testing.T) {
+	t.Parallel()
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+	dockerManager := fakeDoctorDocker{images: map[string]bool{"stemcell:present": true}}
+
+	assert.Equal(t, DoctorSkipped, f.checkStemcell(dockerManager, "").Status)
+	assert.Equal(t, DoctorSkipped, f.checkStemcell(nil, "stemcell:present").Status)
+	assert.Equal(t, DoctorOK, f.checkStemcell(dockerManager, "stemcell:present").Status)
+
+	result := f.checkStemcell(dockerManager, "stemcell:missing")
+	assert.Equal(t, DoctorWarning, result.Status)
+	assert.Equal(t, "Pull the stemcell ahead of time with `docker pull stemcell:missing`", result.Remediation)
+
+	f.Options.Offline = true
+	result = f.checkStemcell(dockerManager, "stemcell:missing")
+	assert.Equal(t, DoctorFailed, result.Status)
+	assert.Contains(t, result.Summary, "not available in offline mode")
+}
+
+func TestCheckHostResources(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, DoctorOK, checkDiskSpace("/work", 100<<30).Status)
+	result := checkDiskSpace("/work", 1536<<20)
+	assert.Equal(t, DoctorWarning, result.Status)
+	assert.Equal(t, "Only 1.5 GiB free in /work, less than the recommended 20 GiB", result.Summary)
+
+	assert.Equal(t, DoctorOK, checkOpenFilesLimit(65536).Status)
+	result = checkOpenFilesLimit(1024)
+	assert.Equal(t, DoctorWarning, result.Status)
+	assert.Contains(t, result.Remediation, "ulimit -n 4096")
+}
+
+func TestCheckPackageCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fissile-doctor-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	result := checkPackageCache(filepath.Join(dir, "missing.yaml"), dir, "stemcell:latest")
+	assert.Equal(t, DoctorSkipped, result.Status)
+
+	config := fmt.Sprintf(`{"boshPackageCacheKind": "local", "boshPackageCacheLocation": "cache", "path": "%s"}`, dir)
+	result = checkPackageCache(config, dir, "stemcell:latest")
+	assert.Equal(t, DoctorOK, result.Status)
+	assert.Equal(t, "The local cache is reachable", result.Summary)
+
+	result = checkPackageCache(`{"boshPackageCacheKind": "unknown"}`, dir, "stemcell:latest")
+	assert.Equal(t, DoctorFailed, result.Status)
+}
+
+func TestShowDoctorResults(t *testing.T) {
+	t.Parallel()
+
+	output := &bytes.Buffer{}
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+	f.Options.OutputFormat = OutputFormatJSON
+	require.NoError(t, f.showDoctorResults([]DoctorResult{checkOpenFilesLimit(1024)}))
+	assert.JSONEq(t, `[{
+		"check": "Open files limit",
+		"status": "warning",
+		"summary": "Only 1024 open files allowed, less than the recommended 4096",
+		"remediation": "Raise the limit with `+"`ulimit -n 4096`"+` before running fissile, or in /etc/security/limits.conf"
+	}]`, output.String())
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/kube"
+	"github.com/SUSE/termui"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// InstanceGroupEnvVars lists the environment variables of the containers of
+// an instance group
+type InstanceGroupEnvVars struct {
+	InstanceGroup string        `json:"instance_group" yaml:"instance_group"`
+	EnvVars       []kube.EnvVar `json:"env_vars" yaml:"env_vars"`
+}
+
+// ShowEnvVars displays every environment variable the helm chart injects into
+// the containers of each instance group, and where its value comes from.
+func (f *Fissile) ShowEnvVars() error {
+	if f.Manifest == nil {
+		return fmt.Errorf("Role manifest not loaded")
+	}
+
+	settings := kube.ExportSettings{
+		RoleManifest:    f.Manifest,
+		CreateHelmChart: true,
+	}
+	report := make([]InstanceGroupEnvVars, 0, len(f.Manifest.InstanceGroups))
+	for _, instanceGroup := range f.Manifest.InstanceGroups {
+		envVars, err := kube.GetEnvVars(instanceGroup, settings)
+		if err != nil {
+			return fmt.Errorf("Instance group %s: %v", instanceGroup.Name, err)
+		}
+		report = append(report, InstanceGroupEnvVars{
+			InstanceGroup: instanceGroup.Name,
+			EnvVars:       envVars,
+		})
+	}
+
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman:
+		f.showEnvVarsForHuman(report)
+	case OutputFormatJSON:
+		buf, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(report)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", f.Options.OutputFormat)
+	}
+
+	return nil
+}
+
+func (f *Fissile) showEnvVarsForHuman(report []InstanceGroupEnvVars) {
+	if len(report) == 0 {
+		f.UI.Println("No instance groups")
+		return
+	}
+
+	table := termui.NewTable("Instance group", "Variable", "Source", "Value")
+	for _, instanceGroup := range report {
+		for _, envVar := range instanceGroup.EnvVars {
+			var value string
+			switch {
+			case len(envVar.Secrets) > 0:
+				value = "secret " + strings.Join(envVar.Secrets, ", ")
+			case envVar.Source == kube.EnvVarSourceUser:
+				value = "default " + envVar.Default
+			default:
+				value = envVar.Value
+			}
+			table.Add(instanceGroup.InstanceGroup, envVar.Name, string(envVar.Source), value)
+		}
+	}
+
+	f.printTable(table)
+}
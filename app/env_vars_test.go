@@ -0,0 +1,63 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/kube"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShowEnvVars(t *testing.T) {
+	output := &bytes.Buffer{}
+	ui := termui.New(&bytes.Buffer{}, output, nil)
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", ui)
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/links.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/ntp-release"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	t.Run("json", func(t *testing.T) {
+		output.Reset()
+		f.Options.OutputFormat = OutputFormatJSON
+		require.NoError(t, f.ShowEnvVars())
+		var actual []InstanceGroupEnvVars
+		require.NoError(t, json.Unmarshal(output.Bytes(), &actual))
+		require.Len(t, actual, 1)
+		assert.Equal(t, "myrole", actual[0].InstanceGroup)
+		assert.Contains(t, actual[0].EnvVars, kube.EnvVar{
+			Name:   "KUBERNETES_NAMESPACE",
+			Source: kube.EnvVarSourceBuiltIn,
+			Value:  "metadata.namespace",
+		})
+	})
+
+	t.Run("human", func(t *testing.T) {
+		output.Reset()
+		f.Options.OutputFormat = OutputFormatHuman
+		require.NoError(t, f.ShowEnvVars())
+		assert.Contains(t, output.String(), "KUBERNETES_NAMESPACE")
+		assert.Contains(t, output.String(), "built-in")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		f.Options.OutputFormat = "bogus"
+		assert.EqualError(t, f.ShowEnvVars(), "Invalid output format 'bogus', expected one of human, json, or yaml")
+	})
+}
+
+func TestShowEnvVarsNotLoaded(t *testing.T) {
+	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
+	f := NewFissileApplication(".", ui)
+	assert.Error(t, f.ShowEnvVars())
+}
@@ -0,0 +1,73 @@
+package app
+
+// EventType identifies the kind of an Event.
+type EventType string
+
+// The kinds of events reported by fissile operations
+const (
+	EventStarted  EventType = "started"  // an operation has started
+	EventProgress EventType = "progress" // a step of an operation has completed
+	EventFinished EventType = "finished" // an operation completed successfully
+	EventFailed   EventType = "failed"   // an operation failed; see Err
+)
+
+// Fissile operations, as reported in Event.Operation
+const (
+	OperationCompile      = "compile-packages"
+	OperationBuildImages  = "build-images"
+	OperationCleanCache   = "clean-cache"
+	OperationGenerateKube = "generate-kube"
+)
+
+// Event is a structured progress report for a fissile operation.  Progress
+// events name the item they are about in Subject (e.g. `release/package`
+// when compiling), and count the items done so far and in total, if known.
+type Event struct {
+	Type      EventType
+	Operation string
+	Subject   string
+	Message   string
+	Err       error
+	Done      int
+	Total     int
+}
+
+// EventHandler receives the events of fissile operations.  This allows
+// programs embedding fissile to report progress without parsing the output
+// written to the UI.  Handlers may be called from multiple goroutines, but
+// never concurrently for the same operation.
+type EventHandler interface {
+	HandleEvent(Event)
+}
+
+// EventHandlerFunc adapts a function to the EventHandler interface.
+type EventHandlerFunc func(Event)
+
+// HandleEvent calls the function.
+func (h EventHandlerFunc) HandleEvent(event Event) {
+	h(event)
+}
+
+// emit reports an event to the registered handler, if any.
+func (f *Fissile) emit(event Event) {
+	if f.Events != nil {
+		f.Events.HandleEvent(event)
+	}
+}
+
+// startOperation reports the start of an operation and returns a function
+// reporting its outcome; use it as
+//
+//	defer f.startOperation(operation)(&err)
+func (f *Fissile) startOperation(operation string) func(*error) {
+	f.emit(Event{Type: EventStarted, Operation: operation})
+	reportMemory := f.reportMemory(operation)
+	return func(err *error) {
+		reportMemory()
+		if *err != nil {
+			f.emit(Event{Type: EventFailed, Operation: operation, Err: *err})
+			return
+		}
+		f.emit(Event{Type: EventFinished, Operation: operation})
+	}
+}
@@ -0,0 +1,344 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// PackageExplanation explains why a package is compiled: the jobs needing it,
+// directly or through the dependencies of their packages, and the instance
+// groups those jobs are part of.
+type PackageExplanation struct {
+	Package     string       `json:"package" yaml:"package"`
+	Release     string       `json:"release" yaml:"release"`
+	Fingerprint string       `json:"fingerprint" yaml:"fingerprint"`
+	Uses        []PackageUse `json:"uses" yaml:"uses"`
+}
+
+// PackageUse is a job of an instance group needing a package.  The chain
+// leads from the job through the packages it depends on to the package.
+type PackageUse struct {
+	InstanceGroup string   `json:"instance_group" yaml:"instance_group"`
+	Job           string   `json:"job" yaml:"job"`
+	Chain         []string `json:"chain" yaml:"chain"`
+}
+
+// JobExplanation explains why a job is included: the instance groups it is
+// part of, and the packages it needs.
+type JobExplanation struct {
+	Job            string             `json:"job" yaml:"job"`
+	Release        string             `json:"release" yaml:"release"`
+	Fingerprint    string             `json:"fingerprint" yaml:"fingerprint"`
+	InstanceGroups []JobInstanceGroup `json:"instance_groups" yaml:"instance_groups"`
+	Packages       []string           `json:"packages" yaml:"packages"`
+}
+
+// JobInstanceGroup is an instance group including a job, and the feature
+// condition under which it is included, if any.
+type JobInstanceGroup struct {
+	Name      string `json:"name" yaml:"name"`
+	Condition string `json:"condition,omitempty" yaml:"condition,omitempty"`
+}
+
+// VariableExplanation explains where a variable is used: the job properties
+// whose templates reference it, and the instance groups it is passed to.
+type VariableExplanation struct {
+	Variable       string        `json:"variable" yaml:"variable"`
+	Type           model.CVType  `json:"type" yaml:"type"`
+	Generator      string        `json:"generator,omitempty" yaml:"generator,omitempty"`
+	Secret         bool          `json:"secret" yaml:"secret"`
+	Internal       bool          `json:"internal" yaml:"internal"`
+	Uses           []VariableUse `json:"uses" yaml:"uses"`
+	InstanceGroups []string      `json:"instance_groups" yaml:"instance_groups"`
+}
+
+// VariableUse is a job property whose template references a variable
+type VariableUse struct {
+	InstanceGroup string `json:"instance_group" yaml:"instance_group"`
+	Job           string `json:"job" yaml:"job"`
+	Property      string `json:"property" yaml:"property"`
+	Template      string `json:"template" yaml:"template"`
+}
+
+// ExplainPackage displays why the named package is compiled
+func (f *Fissile) ExplainPackage(name string) error {
+	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
+		return fmt.Errorf("Releases not loaded")
+	}
+
+	var explanations []*PackageExplanation
+	for _, release := range f.Manifest.LoadedReleases {
+		pkg, err := release.LookupPackage(name)
+		if err != nil {
+			continue
+		}
+		explanation := &PackageExplanation{
+			Package:     pkg.Name,
+			Release:     release.Name,
+			Fingerprint: pkg.Fingerprint,
+			Uses:        []PackageUse{},
+		}
+		for _, instanceGroup := range f.Manifest.InstanceGroups {
+			for _, jobReference := range instanceGroup.JobReferences {
+				if jobReference.Release != release {
+					continue
+				}
+				if chain := packageChain(jobReference.Job, pkg); chain != nil {
+					explanation.Uses = append(explanation.Uses, PackageUse{
+						InstanceGroup: instanceGroup.Name,
+						Job:           jobReference.Name,
+						Chain:         chain,
+					})
+				}
+			}
+		}
+		explanations = append(explanations, explanation)
+	}
+	if len(explanations) == 0 {
+		return fmt.Errorf("Package %s not found in any release", name)
+	}
+
+	return f.printExplanation(explanations, func() {
+		for _, explanation := range explanations {
+			f.UI.Printf("Package %s of release %s (fingerprint %s)\n",
+				explanation.Package, explanation.Release, explanation.Fingerprint)
+			if len(explanation.Uses) == 0 {
+				f.UI.Println("is not needed by any job of the instance groups")
+				continue
+			}
+			table := termui.NewTable("Instance group", "Job", "Dependency chain")
+			for _, use := range explanation.Uses {
+				table.Add(use.InstanceGroup, use.Job, strings.Join(use.Chain, " -> "))
+			}
+			f.printTable(table)
+		}
+	})
+}
+
+// packageChain returns the shortest chain from the job through the
+// dependencies of its packages to the package, or nil if the job does not
+// need the package.
+func packageChain(job *model.Job, target *model.Package) []string {
+	type step struct {
+		pkg   *model.Package
+		chain []string
+	}
+	var queue []step
+	seen := make(map[*model.Package]bool)
+	for _, pkg := range job.Packages {
+		queue = append(queue, step{pkg, []string{job.Name, pkg.Name}})
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current.pkg == target {
+			return current.chain
+		}
+		if seen[current.pkg] {
+			continue
+		}
+		seen[current.pkg] = true
+		for _, dependency := range current.pkg.Dependencies {
+			chain := append(append([]string{}, current.chain...), dependency.Name)
+			queue = append(queue, step{dependency, chain})
+		}
+	}
+	return nil
+}
+
+// ExplainJob displays why the named job is included
+func (f *Fissile) ExplainJob(name string) error {
+	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
+		return fmt.Errorf("Releases not loaded")
+	}
+
+	var explanations []*JobExplanation
+	for _, release := range f.Manifest.LoadedReleases {
+		job, err := release.LookupJob(name)
+		if err != nil {
+			continue
+		}
+		explanation := &JobExplanation{
+			Job:            job.Name,
+			Release:        release.Name,
+			Fingerprint:    job.Fingerprint,
+			InstanceGroups: []JobInstanceGroup{},
+			Packages:       []string{},
+		}
+		for _, instanceGroup := range f.Manifest.InstanceGroups {
+			jobReference := instanceGroup.LookupJob(name)
+			if jobReference == nil || jobReference.Release != release {
+				continue
+			}
+			var condition string
+			if feature, enabled := jobReference.FeatureCondition(); feature != "" {
+				if enabled {
+					condition = "if_feature " + feature
+				} else {
+					condition = "unless_feature " + feature
+				}
+			}
+			explanation.InstanceGroups = append(explanation.InstanceGroups, JobInstanceGroup{
+				Name:      instanceGroup.Name,
+				Condition: condition,
+			})
+		}
+		for _, pkg := range job.Packages {
+			explanation.Packages = append(explanation.Packages, pkg.Name)
+		}
+		sort.Strings(explanation.Packages)
+		explanations = append(explanations, explanation)
+	}
+	if len(explanations) == 0 {
+		return fmt.Errorf("Job %s not found in any release", name)
+	}
+
+	return f.printExplanation(explanations, func() {
+		for _, explanation := range explanations {
+			f.UI.Printf("Job %s of release %s (fingerprint %s)\n",
+				explanation.Job, explanation.Release, explanation.Fingerprint)
+			f.UI.Printf("Packages: %s\n", strings.Join(explanation.Packages, ", "))
+			if len(explanation.InstanceGroups) == 0 {
+				f.UI.Println("is not part of any instance group")
+				continue
+			}
+			table := termui.NewTable("Instance group", "Condition")
+			for _, instanceGroup := range explanation.InstanceGroups {
+				table.Add(instanceGroup.Name, instanceGroup.Condition)
+			}
+			f.printTable(table)
+		}
+	})
+}
+
+// ExplainVariable displays where the named variable is used
+func (f *Fissile) ExplainVariable(name string) error {
+	if f.Manifest == nil {
+		return fmt.Errorf("Role manifest not loaded")
+	}
+
+	variable, ok := model.MakeMapOfVariables(f.Manifest)[name]
+	if !ok {
+		return fmt.Errorf("Variable %s not found", name)
+	}
+	explanation := &VariableExplanation{
+		Variable:       variable.Name,
+		Type:           variable.CVOptions.Type,
+		Generator:      variable.Type,
+		Secret:         variable.CVOptions.Secret,
+		Internal:       variable.CVOptions.Internal,
+		Uses:           []VariableUse{},
+		InstanceGroups: []string{},
+	}
+	if explanation.Type == "" {
+		explanation.Type = model.CVTypeUser
+	}
+
+	for _, instanceGroup := range f.Manifest.InstanceGroups {
+		for _, jobReference := range instanceGroup.JobReferences {
+			for _, property := range jobReference.Properties {
+				propertyName := fmt.Sprintf("properties.%s", property.Name)
+				for templateName, template := range instanceGroup.Configuration.Templates {
+					if templateName != propertyName && !strings.HasPrefix(templateName, propertyName+".") {
+						continue
+					}
+					names, err := model.ParseTemplate(template.Value)
+					if err != nil {
+						return err
+					}
+					for _, variableName := range names {
+						if variableName == name {
+							explanation.Uses = append(explanation.Uses, VariableUse{
+								InstanceGroup: instanceGroup.Name,
+								Job:           jobReference.Name,
+								Property:      strings.TrimPrefix(templateName, "properties."),
+								Template:      template.Value,
+							})
+							break
+						}
+					}
+				}
+			}
+		}
+
+		variables, err := instanceGroup.GetVariablesForRole()
+		if err != nil {
+			return err
+		}
+		for _, variable := range variables {
+			if variable.Name == name {
+				explanation.InstanceGroups = append(explanation.InstanceGroups, instanceGroup.Name)
+				break
+			}
+		}
+	}
+	sort.Slice(explanation.Uses, func(i, j int) bool {
+		a, b := explanation.Uses[i], explanation.Uses[j]
+		if a.InstanceGroup != b.InstanceGroup {
+			return a.InstanceGroup < b.InstanceGroup
+		}
+		if a.Job != b.Job {
+			return a.Job < b.Job
+		}
+		return a.Property < b.Property
+	})
+
+	return f.printExplanation(explanation, func() {
+		var attributes []string
+		attributes = append(attributes, string(explanation.Type))
+		if explanation.Generator != "" {
+			attributes = append(attributes, "generated "+explanation.Generator)
+		}
+		if explanation.Secret {
+			attributes = append(attributes, "secret")
+		}
+		if explanation.Internal {
+			attributes = append(attributes, "internal")
+		}
+		f.UI.Printf("Variable %s (%s)\n", explanation.Variable, strings.Join(attributes, ", "))
+		if len(explanation.InstanceGroups) == 0 {
+			f.UI.Println("is not passed to any instance group")
+		} else {
+			f.UI.Printf("Passed to instance groups: %s\n", strings.Join(explanation.InstanceGroups, ", "))
+		}
+		if len(explanation.Uses) == 0 {
+			f.UI.Println("is not used by the templates of any job property")
+			return
+		}
+		table := termui.NewTable("Instance group", "Job", "Property", "Template")
+		for _, use := range explanation.Uses {
+			table.Add(use.InstanceGroup, use.Job, use.Property, use.Template)
+		}
+		f.printTable(table)
+	})
+}
+
+// printExplanation prints the explanation in the selected output format,
+// using printHuman for human readable output.
+func (f *Fissile) printExplanation(explanation interface{}, printHuman func()) error {
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman:
+		printHuman()
+	case OutputFormatJSON:
+		buf, err := json.Marshal(explanation)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(explanation)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", f.Options.OutputFormat)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func explainTestApplication(t *testing.T, output *bytes.Buffer) *Fissile {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/explain.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+	return f
+}
+
+func TestExplainPackage(t *testing.T) {
+	output := &bytes.Buffer{}
+	f := explainTestApplication(t, output)
+
+	f.Options.OutputFormat = OutputFormatJSON
+	require.NoError(t, f.ExplainPackage("libevent"))
+	var actual []PackageExplanation
+	require.NoError(t, json.Unmarshal(output.Bytes(), &actual))
+	require.Len(t, actual, 1)
+	assert.Equal(t, "libevent", actual[0].Package)
+	assert.Equal(t, "tor", actual[0].Release)
+	assert.Equal(t, []PackageUse{
+		{InstanceGroup: "myrole", Job: "tor", Chain: []string{"tor", "libevent"}},
+		{InstanceGroup: "myrole", Job: "new_hostname", Chain: []string{"new_hostname", "libevent"}},
+		{InstanceGroup: "otherrole", Job: "tor", Chain: []string{"tor", "libevent"}},
+	}, actual[0].Uses)
+
+	output.Reset()
+	f.Options.OutputFormat = OutputFormatHuman
+	require.NoError(t, f.ExplainPackage("tor"))
+	assert.Contains(t, output.String(), "Package tor of release tor")
+	assert.Contains(t, output.String(), "tor -> tor")
+
+	assert.EqualError(t, f.ExplainPackage("nats"), "Package nats not found in any release")
+}
+
+func TestPackageChain(t *testing.T) {
+	c := &model.Package{Name: "c"}
+	b := &model.Package{Name: "b", Dependencies: model.Packages{c}}
+	a := &model.Package{Name: "a", Dependencies: model.Packages{b}}
+	job := &model.Job{Name: "job", Packages: model.Packages{a}}
+
+	assert.Equal(t, []string{"job", "a", "b", "c"}, packageChain(job, c))
+	job.Packages = append(job.Packages, c)
+	assert.Equal(t, []string{"job", "c"}, packageChain(job, c), "The shortest chain is used")
+	assert.Nil(t, packageChain(job, &model.Package{Name: "d"}))
+}
+
+func TestExplainJob(t *testing.T) {
+	output := &bytes.Buffer{}
+	f := explainTestApplication(t, output)
+
+	f.Options.OutputFormat = OutputFormatJSON
+	require.NoError(t, f.ExplainJob("new_hostname"))
+	var actual []JobExplanation
+	require.NoError(t, json.Unmarshal(output.Bytes(), &actual))
+	require.Len(t, actual, 1)
+	assert.Equal(t, []JobInstanceGroup{{Name: "myrole", Condition: "if_feature extra"}}, actual[0].InstanceGroups)
+
+	output.Reset()
+	require.NoError(t, f.ExplainJob("tor"))
+	actual = nil
+	require.NoError(t, json.Unmarshal(output.Bytes(), &actual))
+	require.Len(t, actual, 1)
+	assert.Equal(t, []string{"libevent", "tor"}, actual[0].Packages)
+	assert.Len(t, actual[0].InstanceGroups, 2)
+
+	assert.EqualError(t, f.ExplainJob("nats"), "Job nats not found in any release")
+}
+
+func TestExplainVariable(t *testing.T) {
+	output := &bytes.Buffer{}
+	f := explainTestApplication(t, output)
+
+	f.Options.OutputFormat = OutputFormatJSON
+	require.NoError(t, f.ExplainVariable("HOSTNAME"))
+	var actual VariableExplanation
+	require.NoError(t, json.Unmarshal(output.Bytes(), &actual))
+	assert.Equal(t, model.CVTypeUser, actual.Type)
+	assert.Equal(t, []VariableUse{
+		{InstanceGroup: "myrole", Job: "tor", Property: "tor.hostname", Template: "((HOSTNAME))"},
+		{InstanceGroup: "otherrole", Job: "tor", Property: "tor.hostname", Template: "((HOSTNAME))"},
+	}, actual.Uses)
+	assert.Equal(t, []string{"myrole", "otherrole"}, actual.InstanceGroups)
+
+	output.Reset()
+	f.Options.OutputFormat = OutputFormatHuman
+	require.NoError(t, f.ExplainVariable("PASSWORD"))
+	assert.Contains(t, output.String(), "Variable PASSWORD (user, generated password, secret, internal)")
+	assert.Contains(t, output.String(), "is not used by the templates of any job property")
+
+	assert.EqualError(t, f.ExplainVariable("BOGUS"), "Variable BOGUS not found")
+
+	f.Options.OutputFormat = "bogus"
+	assert.EqualError(t, f.ExplainVariable("HOSTNAME"), "Invalid output format 'bogus', expected one of human, json, or yaml")
+}
+
+func TestExplainNotLoaded(t *testing.T) {
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+	assert.Error(t, f.ExplainPackage("tor"))
+	assert.Error(t, f.ExplainJob("tor"))
+	assert.Error(t, f.ExplainVariable("HOSTNAME"))
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/kube"
+)
+
+// Exporter writes the configuration running the instance groups of the
+// loaded role manifest on a target platform.  The settings are specific to
+// the exporter; exporters reject settings of any other type.
+type Exporter interface {
+	Export(ctx context.Context, f *Fissile, settings interface{}) error
+}
+
+// ExporterFunc adapts a function to the Exporter interface.
+type ExporterFunc func(ctx context.Context, f *Fissile, settings interface{}) error
+
+// Export calls the function.
+func (e ExporterFunc) Export(ctx context.Context, f *Fissile, settings interface{}) error {
+	return e(ctx, f, settings)
+}
+
+// KubeJSONSettings are the settings of the kube-json exporter
+type KubeJSONSettings struct {
+	kube.ExportSettings
+	ValuesFiles []string // Values files rendering the helm chart, later files take precedence
+}
+
+// exporters holds the registered exporters by name
+var exporters = make(map[string]Exporter)
+
+// RegisterExporter makes an exporter available under the name.  It is meant
+// to be called from init functions, and panics if the name is already taken.
+func RegisterExporter(name string, exporter Exporter) {
+	if _, ok := exporters[name]; ok {
+		panic(fmt.Sprintf("Exporter %s registered twice", name))
+	}
+	exporters[name] = exporter
+}
+
+// ExporterNames returns the sorted names of the registered exporters
+func ExporterNames() []string {
+	var names []string
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Export writes the configuration of the loaded role manifest with the named
+// exporter
+func (f *Fissile) Export(ctx context.Context, name string, settings interface{}) error {
+	exporter, ok := exporters[name]
+	if !ok {
+		return fmt.Errorf("Unknown exporter %s, expected one of %s", name, strings.Join(ExporterNames(), ", "))
+	}
+	if f.Manifest == nil {
+		return fmt.Errorf("Role manifest not loaded")
+	}
+	return exporter.Export(ctx, f, settings)
+}
+
+// invalidExporterSettings returns the error for settings of the wrong type
+func invalidExporterSettings(name string, expected, actual interface{}) error {
+	return fmt.Errorf("Exporter %s expects settings of type %T, got %T", name, expected, actual)
+}
+
+func init() {
+	RegisterExporter("kube", ExporterFunc(func(ctx context.Context, f *Fissile, settings interface{}) error {
+		kubeSettings, ok := settings.(kube.ExportSettings)
+		if !ok {
+			return invalidExporterSettings("kube", kube.ExportSettings{}, settings)
+		}
+		kubeSettings.CreateHelmChart = false
+		return f.GenerateKube(ctx, kubeSettings)
+	}))
+	RegisterExporter("helm", ExporterFunc(func(ctx context.Context, f *Fissile, settings interface{}) error {
+		helmSettings, ok := settings.(kube.ExportSettings)
+		if !ok {
+			return invalidExporterSettings("helm", kube.ExportSettings{}, settings)
+		}
+		helmSettings.CreateHelmChart = true
+		return f.GenerateKube(ctx, helmSettings)
+	}))
+	RegisterExporter("kube-json", ExporterFunc(func(ctx context.Context, f *Fissile, settings interface{}) error {
+		jsonSettings, ok := settings.(KubeJSONSettings)
+		if !ok {
+			return invalidExporterSettings("kube-json", KubeJSONSettings{}, settings)
+		}
+		return f.GenerateKubeJSON(ctx, jsonSettings.ExportSettings, jsonSettings.ValuesFiles)
+	}))
+	RegisterExporter("docker-compose", ExporterFunc(func(ctx context.Context, f *Fissile, settings interface{}) error {
+		opts, ok := settings.(DockerComposeOptions)
+		if !ok {
+			return invalidExporterSettings("docker-compose", DockerComposeOptions{}, settings)
+		}
+		return f.GenerateDockerCompose(opts)
+	}))
+	RegisterExporter("systemd", ExporterFunc(func(ctx context.Context, f *Fissile, settings interface{}) error {
+		opts, ok := settings.(SystemdOptions)
+		if !ok {
+			return invalidExporterSettings("systemd", SystemdOptions{}, settings)
+		}
+		return f.GenerateSystemd(opts)
+	}))
+}
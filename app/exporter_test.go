@@ -0,0 +1,47 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporterNames(t *testing.T) {
+	assert.Subset(t, ExporterNames(), []string{"docker-compose", "helm", "kube", "kube-json", "systemd"})
+}
+
+func TestRegisterExporterTwice(t *testing.T) {
+	assert.Panics(t, func() {
+		RegisterExporter("kube", ExporterFunc(func(context.Context, *Fissile, interface{}) error { return nil }))
+	})
+}
+
+func TestExport(t *testing.T) {
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+
+	err := f.Export(context.Background(), "bogus", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Unknown exporter bogus, expected one of ")
+
+	err = f.Export(context.Background(), "kube", nil)
+	assert.EqualError(t, err, "Role manifest not loaded")
+
+	f.Manifest = &model.RoleManifest{}
+	err = f.Export(context.Background(), "helm", DockerComposeOptions{})
+	assert.EqualError(t, err, "Exporter helm expects settings of type kube.ExportSettings, got app.DockerComposeOptions")
+
+	var exported interface{}
+	RegisterExporter("test-export", ExporterFunc(func(ctx context.Context, f *Fissile, settings interface{}) error {
+		exported = settings
+		return nil
+	}))
+	defer delete(exporters, "test-export")
+	require.NoError(t, f.Export(context.Background(), "test-export", "settings"))
+	assert.Equal(t, "settings", exported)
+}
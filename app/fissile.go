@@ -1,12 +1,16 @@
 package app
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"code.cloudfoundry.org/fissile/builder"
 	"code.cloudfoundry.org/fissile/compilator"
@@ -21,6 +25,7 @@ import (
 	"github.com/SUSE/stampy"
 	"github.com/SUSE/termui"
 	"github.com/fatih/color"
+	dockerclient "github.com/fsouza/go-dockerclient"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -33,6 +38,7 @@ const (
 	OutputFormatHuman = "human" // output for human consumption
 	OutputFormatJSON  = "json"  // output as JSON
 	OutputFormatYAML  = "yaml"  // output as YAML
+	OutputFormatDOT   = "dot"   // output as a graphviz graph (only for 'show links')
 )
 
 // Fissile represents a fissile application.
@@ -41,8 +47,18 @@ type Fissile struct {
 	UI        *termui.UI
 	Manifest  *model.RoleManifest
 	Options   FissileOptions
+	Events    EventHandler // optional; receives progress of long running operations
 	cmdErr    error
 	graphFile *os.File
+	// generatedFiles are the files written by the current GenerateKube, to
+	// detect chart overlay files replacing them
+	generatedFiles map[string]bool
+	// generatedObjects are the objects written by the current GenerateKube
+	// without a helm chart, for the objects manifest
+	generatedObjects map[kubeObjectRef]bool
+	// timings is the timing database of the work directory; see Timings
+	timings       *TimingDatabase
+	timingsLoaded bool
 }
 
 // FissileOptions contains the values of all global fissile application options.
@@ -65,6 +81,14 @@ type FissileOptions struct {
 	OutputFormat       string
 	Metrics            string
 	Verbose            bool
+	Offline            bool
+	RetryPolicy        util.RetryPolicy
+	RegistryMirrors    docker.RegistryMirrors
+	ReportMemory       bool
+	Lockfile           string
+	Locked             bool
+	NoHealthcheck      bool
+	Attributions       bool
 }
 
 // NewFissileApplication creates a new app.Fissile.
@@ -72,6 +96,7 @@ func NewFissileApplication(version string, ui *termui.UI) *Fissile {
 	return &Fissile{
 		Version: version,
 		UI:      ui,
+		Options: FissileOptions{RetryPolicy: util.DefaultRetryPolicy()},
 	}
 }
 
@@ -90,8 +115,52 @@ func (f *Fissile) StemcellCompilationDir(stemcell string) string {
 	return filepath.Join(f.CompilationDir(), util.Hash(stemcell))
 }
 
+// MirrorImageName returns the name to use for a docker image, taking the
+// configured registry mirrors into account.
+func (f *Fissile) MirrorImageName(imageName string) string {
+	return f.Options.RegistryMirrors.Resolve(imageName)
+}
+
+// newImageManager connects to docker, retrying registry operations with the
+// retry policy of the options.
+func (f *Fissile) newImageManager() (*docker.ImageManager, error) {
+	dockerManager, err := docker.NewImageManager()
+	if err != nil {
+		return nil, err
+	}
+	dockerManager.RetryPolicy = f.Options.RetryPolicy
+	return dockerManager, nil
+}
+
+// findStemcellImage looks up the stemcell image, pulling it first if it is
+// missing.
+func (f *Fissile) findStemcellImage(dockerManager *docker.ImageManager, stemcellImage string) (*dockerclient.Image, error) {
+	image, err := dockerManager.FindImage(stemcellImage)
+	if _, ok := err.(docker.ErrImageNotFound); !ok {
+		if err != nil {
+			return nil, fmt.Errorf("Error looking up stemcell image %s: %v", stemcellImage, err)
+		}
+		return image, nil
+	}
+	if f.Options.Offline {
+		return nil, util.NewOfflineError(fmt.Sprintf("Pulling stemcell image %s", stemcellImage), "load it with `docker load` first")
+	}
+
+	f.UI.Printf("Pulling stemcell image %s ...\n", color.YellowString(stemcellImage))
+	if err := dockerManager.PullImage(stemcellImage, nil); err != nil {
+		return nil, err
+	}
+	image, err = dockerManager.FindImage(stemcellImage)
+	if err != nil {
+		return nil, fmt.Errorf("Error looking up stemcell image %s: %v", stemcellImage, err)
+	}
+	return image, nil
+}
+
 // LoadManifest loads the manifest in use by fissile.
 func (f *Fissile) LoadManifest() error {
+	defer f.reportMemory("load-manifest")()
+
 	roleManifest, err := loader.LoadRoleManifest(
 		f.Options.RoleManifest,
 		model.LoadRoleManifestOptions{
@@ -101,6 +170,8 @@ func (f *Fissile) LoadManifest() error {
 				ReleaseVersions:  f.Options.ReleaseVersions,
 				BOSHCacheDir:     f.Options.CacheDir,
 				FinalReleasesDir: f.Options.FinalReleasesDir,
+				Offline:          f.Options.Offline,
+				RetryPolicy:      f.Options.RetryPolicy,
 			},
 			Grapher: f,
 		},
@@ -266,6 +337,13 @@ func (f *Fissile) SerializeJobs() (map[string]interface{}, error) {
 	return jobs, nil
 }
 
+// printTable prints the table through the UI
+func (f *Fissile) printTable(table *termui.Table) {
+	buf := &bytes.Buffer{}
+	table.PrintTo(buf)
+	f.UI.Printf("%s", buf)
+}
+
 func (f *Fissile) listPropertiesForHuman() {
 	// Human readable output.
 	for _, release := range f.Manifest.LoadedReleases {
@@ -328,18 +406,36 @@ func (f *Fissile) collectPropertyDefaults() model.PropertyDefaults {
 	return result
 }
 
-// Compile will compile a list of dev BOSH releases.
-func (f *Fissile) Compile(stemcellImageName string, targetPath, roleManifestPath, metricsPath string, instanceGroupNames, releaseNames []string, workerCount int, dockerNetworkMode string, withoutDocker, verbose bool, packageCacheConfigFilename string, streamPackages bool) error {
+// Compile will compile a list of dev BOSH releases.  Cancelling ctx stops
+// compilation of further packages.
+func (f *Fissile) Compile(ctx context.Context, stemcellImageName string, targetPath, roleManifestPath, metricsPath string, instanceGroupNames, releaseNames []string, workerCount int, dockerNetworkMode string, withoutDocker, verbose bool, packageCacheConfigFilename string, streamPackages, hermetic, warmContainers bool, containerSettings compilator.ContainerSettings) (err error) {
+	defer f.startOperation(OperationCompile)(&err)
+
 	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
 		return fmt.Errorf("Releases not loaded")
 	}
 
+	if hermetic && dockerNetworkMode != "" {
+		return fmt.Errorf("Hermetic compilation cannot be combined with a docker network mode")
+	}
+
+	if warmContainers && withoutDocker {
+		return fmt.Errorf("Warm compilation containers require docker")
+	}
+
+	if err := containerSettings.Validate(); err != nil {
+		return err
+	}
+	if containerSettings.HasNetworkSettings() && withoutDocker {
+		return fmt.Errorf("DNS servers and extra hosts of compilation containers require docker")
+	}
+
 	if metricsPath != "" {
 		stampy.Stamp(metricsPath, "fissile", "compile-packages", "start")
 		defer stampy.Stamp(metricsPath, "fissile", "compile-packages", "done")
 	}
 
-	dockerManager, err := docker.NewImageManager()
+	dockerManager, err := f.newImageManager()
 	if err != nil {
 		return fmt.Errorf("Error connecting to docker: %v", err)
 	}
@@ -358,34 +454,142 @@ func (f *Fissile) Compile(stemcellImageName string, targetPath, roleManifestPath
 	if err != nil {
 		return err
 	}
+
+	// The package cache is keyed by the stemcell name as given, independent
+	// of the registry it is pulled from
+	stemcellImage := f.MirrorImageName(stemcellImageName)
+
+	if f.Options.Offline && packageStorage != nil && packageStorage.IsRemote() {
+		return util.NewOfflineError(fmt.Sprintf("The %s package cache", packageStorage.Kind), "use a local package cache instead")
+	}
+	var stemcellDigest string
+	if !withoutDocker {
+		image, err := f.findStemcellImage(dockerManager, stemcellImage)
+		if err != nil {
+			return err
+		}
+		stemcellDigest = image.ID
+	}
+	if err := f.checkLock(stemcellImageName, stemcellDigest); err != nil {
+		return err
+	}
+
 	var comp *compilator.Compilator
 	if withoutDocker {
-		comp, err = compilator.NewMountNSCompilator(targetPath, metricsPath, stemcellImageName, compilation.LinuxBase, f.Version, f.UI, f, packageStorage)
+		comp, err = compilator.NewMountNSCompilator(targetPath, metricsPath, stemcellImage, compilation.LinuxBase, f.Version, f.UI, f, packageStorage)
 		if err != nil {
 			return fmt.Errorf("Error creating a new compilator: %v", err)
 		}
 	} else {
-		comp, err = compilator.NewDockerCompilator(dockerManager, targetPath, metricsPath, stemcellImageName, compilation.LinuxBase, f.Version, dockerNetworkMode, false, f.UI, f, packageStorage, streamPackages)
+		comp, err = compilator.NewDockerCompilator(dockerManager, targetPath, metricsPath, stemcellImage, compilation.LinuxBase, f.Version, dockerNetworkMode, false, f.UI, f, packageStorage, streamPackages)
 		if err != nil {
 			return fmt.Errorf("Error creating a new compilator: %v", err)
 		}
 	}
 
+	comp.SetHermetic(hermetic)
+	comp.SetWarmContainers(warmContainers)
+	comp.SetContainerSettings(containerSettings)
+	comp.SetStemcellCompatibility(f.Manifest.Stemcell)
+	timings := f.Timings()
+	defer f.saveTimings(timings)
+	comp.SetDurationEstimator(timings.EstimatePackage)
+
+	var done, total int
+	comp.SetPlanHandler(func(packages model.Packages) {
+		total = len(packages)
+	})
+	comp.SetResultHandler(func(pkg *model.Package, duration time.Duration, err error) {
+		if err == nil && duration > 0 {
+			timings.RecordPackage(pkg, duration)
+		}
+		done++
+		event := Event{
+			Type:      EventProgress,
+			Operation: OperationCompile,
+			Subject:   fmt.Sprintf("%s/%s", pkg.Release.Name, pkg.Name),
+			Message:   "compiled",
+			Err:       err,
+			Done:      done,
+			Total:     total,
+		}
+		if err == nil && duration > 0 && len(pkg.VerifyScripts) > 0 {
+			// Only packages compiled just now ran the verification scripts
+			event.Message = "compiled and verified"
+		}
+		if err != nil {
+			event.Message = "failed"
+		} else if equivalents := comp.EquivalentPackages(pkg); len(equivalents) > 0 {
+			// Packages of other releases with the same fingerprint
+			// are compiled along with this one
+			names := make([]string, 0, len(equivalents))
+			for _, equivalent := range equivalents {
+				names = append(names, fmt.Sprintf("%s/%s", equivalent.Release.Name, equivalent.Name))
+			}
+			event.Message = fmt.Sprintf("%s (also as %s)", event.Message, strings.Join(names, ", "))
+		}
+		f.emit(event)
+	})
+
 	instanceGroups, err := f.Manifest.SelectInstanceGroups(instanceGroupNames)
 	if err != nil {
 		return fmt.Errorf("Error selecting packages to build: %v", err)
 	}
 
-	if err := comp.Compile(workerCount, releases, instanceGroups, verbose); err != nil {
+	if err := comp.Compile(ctx, workerCount, releases, instanceGroups, verbose); err != nil {
+		if err == ctx.Err() {
+			return err
+		}
 		return fmt.Errorf("Error compiling packages: %v", err)
 	}
 
 	return nil
 }
 
+// Prefetch prepares compiling the packages of the selected releases and
+// instance groups offline or hermetically, without compiling anything: it
+// downloads the compiled packages found in the package cache, and checks
+// that the sources of all other packages are available locally.
+func (f *Fissile) Prefetch(stemcellImageName string, targetPath string, instanceGroupNames, releaseNames []string, packageCacheConfigFilename string) error {
+	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
+		return fmt.Errorf("Releases not loaded")
+	}
+
+	releases, err := f.getReleasesByName(releaseNames)
+	if err != nil {
+		return err
+	}
+
+	packageStorage, err := compilator.NewPackageStorageFromConfig(packageCacheConfigFilename, targetPath, stemcellImageName)
+	if err != nil {
+		return err
+	}
+	if f.Options.Offline && packageStorage != nil && packageStorage.IsRemote() {
+		return util.NewOfflineError(fmt.Sprintf("The %s package cache", packageStorage.Kind), "use a local package cache instead")
+	}
+
+	// Nothing is compiled, so no docker is needed
+	comp, err := compilator.NewDockerCompilator(nil, targetPath, "", stemcellImageName, compilation.LinuxBase, f.Version, "", false, f.UI, f, packageStorage, false)
+	if err != nil {
+		return fmt.Errorf("Error creating a new compilator: %v", err)
+	}
+
+	instanceGroups, err := f.Manifest.SelectInstanceGroups(instanceGroupNames)
+	if err != nil {
+		return fmt.Errorf("Error selecting packages to prefetch: %v", err)
+	}
+
+	if err := comp.Prefetch(releases, instanceGroups); err != nil {
+		return fmt.Errorf("Error prefetching packages: %v", err)
+	}
+	return nil
+}
+
 // CleanCache inspects the compilation cache and removes all packages
 // which are not referenced (anymore).
-func (f *Fissile) CleanCache() error {
+func (f *Fissile) CleanCache(ctx context.Context) (err error) {
+	defer f.startOperation(OperationCleanCache)(&err)
+
 	targetPath := f.CompilationDir()
 	// 1. Collect list of packages referenced by the releases. A
 	//    variant of the code in ListPackages, we keep only the
@@ -414,6 +618,10 @@ func (f *Fissile) CleanCache() error {
 
 	removed := 0
 	for _, cache := range cached {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		key := filepath.Base(cache)
 		if _, ok := referenced[key]; ok {
 			continue
@@ -460,7 +668,7 @@ func (f *Fissile) ListRoleImages(existingOnDocker, withVirtualSize bool, tagExtr
 	var err error
 
 	if existingOnDocker {
-		dockerManager, err = docker.NewImageManager()
+		dockerManager, err = f.newImageManager()
 		if err != nil {
 			return fmt.Errorf("Error connecting to docker: %v", err)
 		}
@@ -472,7 +680,7 @@ func (f *Fissile) ListRoleImages(existingOnDocker, withVirtualSize bool, tagExtr
 	}
 
 	for _, instanceGroup := range f.Manifest.InstanceGroups {
-		devVersion, err := instanceGroup.GetRoleDevVersion(opinions, tagExtra, f.Version, f)
+		devVersion, err := instanceGroup.GetRoleDevVersion(opinions, tagExtra, f.Version, f.roleImageOptions(), f)
 		if err != nil {
 			return fmt.Errorf("Error creating instance group checksum: %v", err)
 		}
@@ -548,10 +756,11 @@ func (f *Fissile) GetDiffConfigurationBases(releasePaths []string, cacheDir stri
 	}
 	defaultValues := []string{}
 	releases, err := releaseresolver.LoadReleasesFromDisk(model.ReleaseOptions{
-		ReleasePaths:    releasePaths,
-		ReleaseNames:    defaultValues,
-		ReleaseVersions: defaultValues,
-		BOSHCacheDir:    cacheDir})
+		ReleasePaths:     releasePaths,
+		ReleaseNames:     defaultValues,
+		ReleaseVersions:  defaultValues,
+		BOSHCacheDir:     cacheDir,
+		FinalReleasesDir: f.Options.FinalReleasesDir})
 	if err != nil {
 		return nil, fmt.Errorf("dev config diff: error loading release information: %v", err)
 	}
@@ -677,24 +886,87 @@ func compareHashes(v1Hash, v2Hash keyHash) *HashDiffs {
 
 // GenerateKube will create a set of configuration files suitable for deployment
 // on Kubernetes.
-func (f *Fissile) GenerateKube(settings kube.ExportSettings) error {
-	var err error
+func (f *Fissile) GenerateKube(ctx context.Context, settings kube.ExportSettings) (err error) {
+	defer f.startOperation(OperationGenerateKube)(&err)
+
 	settings.RoleManifest = f.Manifest
+	settings.ImageOptions = f.roleImageOptions()
+	f.generatedFiles = make(map[string]bool)
+	f.generatedObjects = make(map[kubeObjectRef]bool)
 
-	cvs := model.MakeMapOfVariables(settings.RoleManifest)
-	for key, value := range cvs {
-		if !value.CVOptions.Secret {
-			delete(cvs, key)
-		}
+	settings.RoleManifest, err = ApplyDefaultsFiles(settings.RoleManifest, settings.DefaultsFiles)
+	if err != nil {
+		return err
+	}
+	if err := ApplyVMTypes(settings.RoleManifest, settings.VMTypes); err != nil {
+		return err
 	}
-	// cvs now holds only the secrets.
-	var secrets helm.Node
-	secrets, err = kube.MakeSecrets(cvs, settings)
+	f.warnBudgetExceeded(settings.RoleManifest)
+	settings.RoleManifest, err = f.selectKubeInstanceGroups(settings)
 	if err != nil {
 		return err
 	}
 
-	err = f.generateSecrets("secrets.yaml", secrets, settings)
+	if errs := kube.ValidateNames(settings); len(errs) != 0 {
+		return fmt.Errorf("Invalid kubernetes names:\n%s", errs.Error())
+	}
+	if errs := kube.ValidateServiceNames(settings); len(errs) != 0 {
+		return fmt.Errorf("Invalid service names:\n%s", errs.Error())
+	}
+	if errs := kube.ValidateServicePorts(settings); len(errs) != 0 {
+		return fmt.Errorf("Invalid service ports:\n%s", errs.Error())
+	}
+	for _, name := range settings.DebugRoles {
+		if settings.RoleManifest.LookupInstanceGroup(name) == nil {
+			return fmt.Errorf("Unknown instance group '%s' to debug", name)
+		}
+	}
+	if err := validateLayout(settings); err != nil {
+		return err
+	}
+	if err := validateSubCharts(settings); err != nil {
+		return err
+	}
+	if err := validatePrune(settings); err != nil {
+		return err
+	}
+	switch settings.ConfigChecksum {
+	case "", kube.ConfigChecksumChart, kube.ConfigChecksumInstanceGroup:
+	default:
+		return fmt.Errorf("Invalid config checksum '%s', expected one of chart or instance-group", settings.ConfigChecksum)
+	}
+	switch settings.ValuesDocs {
+	case "", kube.ValuesDocsMarkdown, kube.ValuesDocsCSV:
+	default:
+		return fmt.Errorf("Invalid values documentation format '%s', expected one of markdown or csv", settings.ValuesDocs)
+	}
+
+	var secrets []helm.Node
+	switch settings.SecretGrouping {
+	case "", kube.SecretGroupingSingle:
+		cvs := model.MakeMapOfVariables(settings.RoleManifest)
+		for key, value := range cvs {
+			if !value.CVOptions.Secret {
+				delete(cvs, key)
+			}
+		}
+		// cvs now holds only the secrets.
+		var secret helm.Node
+		secret, err = kube.MakeSecrets(cvs, settings)
+		if err != nil {
+			return err
+		}
+		secrets = append(secrets, secret)
+	case kube.SecretGroupingInstanceGroup:
+		secrets, err = kube.MakeInstanceGroupSecrets(settings)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Invalid secret grouping '%s', expected one of single or instance-group", settings.SecretGrouping)
+	}
+
+	err = f.generateSecrets("secrets.yaml", settings, secrets...)
 	if err != nil {
 		return err
 	}
@@ -704,7 +976,7 @@ func (f *Fissile) GenerateKube(settings kube.ExportSettings) error {
 		return err
 	}
 
-	err = f.generateSecrets("registry-secret.yaml", registryCredentials, settings)
+	err = f.generateSecrets("registry-secret.yaml", settings, registryCredentials)
 	if err != nil {
 		return err
 	}
@@ -719,25 +991,102 @@ func (f *Fissile) GenerateKube(settings kube.ExportSettings) error {
 		return err
 	}
 
-	err = f.generateSecrets("deployment-manifest-secret.yaml", manifestSecret, settings)
+	err = f.generateSecrets("deployment-manifest-secret.yaml", settings, manifestSecret)
+	if err != nil {
+		return err
+	}
+
+	err = f.generateDeploymentInfo(settings)
+	if err != nil {
+		return err
+	}
+
+	err = f.generateAttributions(settings)
+	if err != nil {
+		return err
+	}
+
+	err = f.generateMonitoring(settings)
 	if err != nil {
 		return err
 	}
 
 	if settings.CreateHelmChart {
-		values := kube.MakeValues(settings)
-		err = f.writeHelmNode(settings.OutputDir, "values.yaml", values)
+		var values helm.Node
+		if settings.SubCharts {
+			values = makeUmbrellaValues(settings)
+		} else {
+			values = kube.MakeValues(settings)
+		}
+		err = f.writeHelmNode(settings, settings.OutputDir, "values.yaml", values)
 		if err != nil {
 			return err
 		}
 
-		err = f.generateHelmHelpers("_fissileHelpers.yaml", settings)
+		err = f.generateHelmHelpers(kube.HelmHelpersFileName, settings)
 		if err != nil {
 			return err
 		}
+
+		if settings.ValuesDocs != "" {
+			err = f.generateValuesDocs(settings)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	return f.generateKubeRoles(settings)
+	if settings.SubCharts {
+		umbrellaSettings := settings
+		umbrellaSettings.RoleManifest = manifestOfGroup(settings.RoleManifest, "")
+		err = f.generateKubeRoles(ctx, umbrellaSettings)
+		if err != nil {
+			return err
+		}
+		err = f.generateSubCharts(ctx, settings)
+	} else {
+		err = f.generateKubeRoles(ctx, settings)
+	}
+	if err != nil {
+		return err
+	}
+
+	if settings.OverlayDir != "" {
+		err = f.applyChartOverlay(settings)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = f.generateObjectsManifest(settings)
+	if err != nil {
+		return err
+	}
+
+	err = f.generateKustomization(settings)
+	if err != nil {
+		return err
+	}
+
+	if settings.KubeSchemaDir != "" {
+		return f.validateKubeSchemas(settings)
+	}
+	return nil
+}
+
+// generateValuesDocs writes the documentation of the chart values next to the
+// values.yaml, as values.md or values.csv depending on the format.
+func (f *Fissile) generateValuesDocs(settings kube.ExportSettings) error {
+	fileName := "values.md"
+	if settings.ValuesDocs == kube.ValuesDocsCSV {
+		fileName = "values.csv"
+	}
+	var buf bytes.Buffer
+	err := kube.WriteValuesDocs(&buf, kube.MakeValuesDocs(settings), settings.ValuesDocs)
+	if err != nil {
+		return err
+	}
+	return f.writeChangedFile(filepath.Join(settings.OutputDir, fileName), buf.Bytes(), 0644)
 }
 
 // generateHelmHelpers will write out helm helper files.
@@ -746,20 +1095,39 @@ func (f *Fissile) generateHelmHelpers(fileName string, settings kube.ExportSetti
 		panic("generateHelmHelpers called when not generating helm chart")
 	}
 	outputDir := filepath.Join(settings.OutputDir, "templates")
-	return f.writeHelmNode(outputDir, fileName, kube.GetHelmTemplateHelpers()...)
+	return f.writeHelmNode(settings, outputDir, fileName, kube.GetHelmTemplateHelpers()...)
 }
 
-func (f *Fissile) generateSecrets(fileName string, secrets helm.Node, settings kube.ExportSettings) error {
+func (f *Fissile) generateSecrets(fileName string, settings kube.ExportSettings, secrets ...helm.Node) error {
 	subDir := "secrets"
 	if settings.CreateHelmChart {
 		subDir = "templates"
 	}
 	secretsDir := filepath.Join(settings.OutputDir, subDir)
-	err := os.MkdirAll(secretsDir, 0755)
+	return f.writeHelmNode(settings, secretsDir, fileName, secrets...)
+}
+
+// generateDeploymentInfo writes the ConfigMap describing the deployment
+func (f *Fissile) generateDeploymentInfo(settings kube.ExportSettings) error {
+	deploymentInfo, err := kube.MakeDeploymentInfo(settings, f)
 	if err != nil {
 		return err
 	}
-	return f.writeHelmNode(secretsDir, fileName, secrets)
+	subDir := "config"
+	if settings.CreateHelmChart {
+		subDir = "templates"
+	}
+	return f.writeHelmNode(settings, filepath.Join(settings.OutputDir, subDir), "deployment-info.yaml", deploymentInfo)
+}
+
+// generateMonitoring writes the Grafana dashboard and the alert rules of the
+// instance groups serving metrics, if there are any
+func (f *Fissile) generateMonitoring(settings kube.ExportSettings) error {
+	nodes, err := kube.MakeMonitoring(settings)
+	if err != nil || len(nodes) == 0 {
+		return err
+	}
+	return f.writeHelmNode(settings, filepath.Join(settings.OutputDir, "templates"), "monitoring.yaml", nodes...)
 }
 
 func (f *Fissile) generateAuth(settings kube.ExportSettings) error {
@@ -768,13 +1136,12 @@ func (f *Fissile) generateAuth(settings kube.ExportSettings) error {
 		subDir = "templates"
 	}
 	authDir := filepath.Join(settings.OutputDir, subDir)
-	err := os.MkdirAll(authDir, 0755)
-	if err != nil {
-		return err
-	}
 
 	// Generate accounts (and any associated role bindings / cluster role bindings)
-	for accountName, accountSpec := range settings.RoleManifest.Configuration.Authorization.Accounts {
+	// The names are sorted so that the objects are always written in the same order
+	accounts := settings.RoleManifest.Configuration.Authorization.Accounts
+	for _, accountName := range sortedMapKeys(accounts) {
+		accountSpec := accounts[accountName]
 		// Ignore accounts referenced by a single instance group. These are not
 		// written as their own files, but as part of the instance group.
 		if len(accountSpec.UsedBy) < 2 {
@@ -785,14 +1152,16 @@ func (f *Fissile) generateAuth(settings kube.ExportSettings) error {
 		if err != nil {
 			return err
 		}
-		err = f.writeHelmNode(authDir, fmt.Sprintf("account-%s.yaml", accountName), nodes...)
+		err = f.writeHelmNode(settings, authDir, fmt.Sprintf("account-%s.yaml", accountName), nodes...)
 		if err != nil {
 			return err
 		}
 	}
 
 	// Generate roles
-	for roleName, roleSpec := range settings.RoleManifest.Configuration.Authorization.Roles {
+	roles := settings.RoleManifest.Configuration.Authorization.Roles
+	for _, roleName := range sortedMapKeys(roles) {
+		roleSpec := roles[roleName]
 		var accountNames []string
 		for accountName := range settings.RoleManifest.Configuration.Authorization.RoleUsedBy[roleName] {
 			accountNames = append(accountNames, fmt.Sprintf("- %s", accountName))
@@ -812,73 +1181,130 @@ func (f *Fissile) generateAuth(settings kube.ExportSettings) error {
 			return err
 		}
 		node.Set(helm.Comment(fmt.Sprintf("Role \"%s\" used by accounts:\n%s", roleName, strings.Join(accountNames, "\n"))))
-		err = f.writeHelmNode(authDir, fmt.Sprintf("auth-role-%s.yaml", roleName), node)
+		err = f.writeHelmNode(settings, authDir, fmt.Sprintf("auth-role-%s.yaml", roleName), node)
 		if err != nil {
 			return err
 		}
 	}
 
-	// Generate cluster roles
-	for roleName, roleSpec := range settings.RoleManifest.Configuration.Authorization.ClusterRoles {
+	// Generate cluster roles, including the aggregated ones
+	auth := settings.RoleManifest.Configuration.Authorization
+	clusterRoleNames := make([]string, 0, len(auth.ClusterRoles)+len(auth.AggregatedClusterRoles))
+	clusterRoleNames = append(clusterRoleNames, sortedMapKeys(auth.ClusterRoles)...)
+	clusterRoleNames = append(clusterRoleNames, sortedMapKeys(auth.AggregatedClusterRoles)...)
+	sort.Strings(clusterRoleNames)
+	for _, roleName := range clusterRoleNames {
 		var accountNames []string
-		for accountName := range settings.RoleManifest.Configuration.Authorization.ClusterRoleUsedBy[roleName] {
+		for accountName := range auth.ClusterRoleUsedBy[roleName] {
 			accountNames = append(accountNames, fmt.Sprintf("- %s", accountName))
 		}
-		if len(accountNames) < 1 {
+		_, aggregated := auth.AggregatedClusterRoles[roleName]
+		_, labeled := auth.ClusterRoleLabels[roleName]
+		if len(accountNames) < 1 && !aggregated && !labeled {
 			panic(fmt.Sprintf("Cluster role \"%s\" used by no accounts", roleName))
 		}
-		if len(accountNames) < 2 {
+		if len(accountNames) == 1 {
 			// Ignore cluster roles referenced by a single account. These are not written as their own files,
 			// but as part of the account.
 			continue
 		}
 		sort.Strings(accountNames)
 
-		node, err := kube.NewRBACRole(roleName, kube.RBACRoleKindClusterRole, roleSpec, settings)
+		node, err := kube.NewRBACClusterRole(roleName, auth, settings)
 		if err != nil {
 			return err
 		}
-		node.Set(helm.Comment(fmt.Sprintf("Cluster role \"%s\" used by accounts:\n%s", roleName, strings.Join(accountNames, "\n"))))
-		err = f.writeHelmNode(authDir, fmt.Sprintf("auth-cluster-role-%s.yaml", roleName), node)
+		if len(accountNames) < 1 {
+			// Only there to be aggregated, or to aggregate others
+			node.Set(helm.Comment(fmt.Sprintf("Cluster role \"%s\" used by no accounts", roleName)))
+		} else {
+			node.Set(helm.Comment(fmt.Sprintf("Cluster role \"%s\" used by accounts:\n%s", roleName, strings.Join(accountNames, "\n"))))
+		}
+		err = f.writeHelmNode(settings, authDir, fmt.Sprintf("auth-cluster-role-%s.yaml", roleName), node)
 		if err != nil {
 			return err
 		}
 	}
 
 	// Generate pod security policies
-	for pspName, psp := range settings.RoleManifest.Configuration.Authorization.PodSecurityPolicies {
+	psps := settings.RoleManifest.Configuration.Authorization.PodSecurityPolicies
+	for _, pspName := range sortedMapKeys(psps) {
+		psp := psps[pspName]
 		// TODO: embed PSPs into instance group definitions as appropriate
 		node, err := kube.NewRBACPSP(pspName, psp, settings)
 		if err != nil {
 			return err
 		}
-		err = f.writeHelmNode(authDir, fmt.Sprintf("auth-psp-%s.yaml", pspName), node)
+		err = f.writeHelmNode(settings, authDir, fmt.Sprintf("auth-psp-%s.yaml", pspName), node)
 		if err != nil {
 			return err
 		}
+
+		if settings.OpenShift {
+			node, err = kube.NewSecurityContextConstraints(pspName, psp, settings)
+			if err != nil {
+				return err
+			}
+			err = f.writeHelmNode(settings, authDir, fmt.Sprintf("auth-scc-%s.yaml", pspName), node)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-func (f *Fissile) writeHelmNode(dirName, fileName string, nodes ...helm.Node) error {
+// writeHelmNode writes the nodes into the named file, or according to the
+// layout of the settings.
+func (f *Fissile) writeHelmNode(settings kube.ExportSettings, dirName, fileName string, nodes ...helm.Node) error {
+	if settings.SubCharts && fileName != "values.yaml" {
+		// The templates of the umbrella chart and of the sub-charts share
+		// the global values
+		for _, node := range nodes {
+			helm.RewriteTemplates(node, globalValues)
+		}
+	}
+	f.recordGeneratedObjects(settings, nodes...)
+	switch settings.Layout {
+	case kube.LayoutStream:
+		return encodeHelmNodes(settings.Stream, nodes...)
+	case kube.LayoutObject:
+		return f.writeKubeObjects(settings, dirName, nodes...)
+	case kube.LayoutGitOps:
+		return f.writeKubeObjects(settings, settings.OutputDir, nodes...)
+	}
+
+	if err := os.MkdirAll(dirName, 0755); err != nil {
+		return err
+	}
 	outputPath := filepath.Join(dirName, fileName)
 	f.UI.Printf("Writing config %s\n", color.CyanString(outputPath))
+	f.recordGeneratedFile(outputPath)
 
 	outputFile, err := os.Create(outputPath)
 	if err != nil {
 		return err
 	}
 
+	err = encodeHelmNodes(outputFile, nodes...)
+	if err != nil {
+		_ = outputFile.Close()
+		return err
+	}
+	err = outputFile.Close()
+	return err
+}
+
+// encodeHelmNodes writes the nodes as YAML documents
+func encodeHelmNodes(writer io.Writer, nodes ...helm.Node) error {
 	for _, node := range nodes {
-		err = helm.NewEncoder(outputFile, helm.EmptyLines(true)).Encode(node)
+		err := helm.NewEncoder(writer, helm.EmptyLines(true), helm.Validation(true)).Encode(node)
 		if err != nil {
-			_ = outputFile.Close()
 			return err
 		}
 	}
-	err = outputFile.Close()
-	return err
+	return nil
 }
 
 func (f *Fissile) generateBoshTaskRole(instanceGroup *model.InstanceGroup, settings kube.ExportSettings) ([]helm.Node, error) {
@@ -937,12 +1363,23 @@ func (f *Fissile) instanceGroupHasStorage(instanceGroup *model.InstanceGroup) bo
 	return false
 }
 
-func (f *Fissile) generateKubeRoles(settings kube.ExportSettings) error {
+func (f *Fissile) generateKubeRoles(ctx context.Context, settings kube.ExportSettings) error {
+	skip := func(instanceGroup *model.InstanceGroup) bool {
+		return instanceGroup.IsColocated() ||
+			(settings.CreateHelmChart && instanceGroup.Run.FlightStage == model.FlightStageManual)
+	}
+	done, total := 0, 0
 	for _, instanceGroup := range settings.RoleManifest.InstanceGroups {
-		if instanceGroup.IsColocated() {
-			continue
+		if !skip(instanceGroup) {
+			total++
 		}
-		if settings.CreateHelmChart && instanceGroup.Run.FlightStage == model.FlightStageManual {
+	}
+
+	for _, instanceGroup := range settings.RoleManifest.InstanceGroups {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if skip(instanceGroup) {
 			continue
 		}
 
@@ -951,10 +1388,6 @@ func (f *Fissile) generateKubeRoles(settings kube.ExportSettings) error {
 			subDir = "templates"
 		}
 		roleTypeDir := filepath.Join(settings.OutputDir, subDir)
-		err := os.MkdirAll(roleTypeDir, 0755)
-		if err != nil {
-			return err
-		}
 
 		switch instanceGroup.Type {
 		case model.RoleTypeBoshTask:
@@ -963,7 +1396,7 @@ func (f *Fissile) generateKubeRoles(settings kube.ExportSettings) error {
 				return err
 			}
 
-			err = f.writeHelmNode(roleTypeDir, fmt.Sprintf("%s.yaml", instanceGroup.Name), nodes...)
+			err = f.writeHelmNode(settings, roleTypeDir, fmt.Sprintf("%s.yaml", instanceGroup.Name), nodes...)
 			if err != nil {
 				return err
 			}
@@ -979,17 +1412,35 @@ func (f *Fissile) generateKubeRoles(settings kube.ExportSettings) error {
 				return err
 			}
 
+			logForwarderConfig, err := kube.NewLogForwarderConfig(instanceGroup, settings)
+			if err != nil {
+				return err
+			}
+
 			nodes := authNodes
 			if deps != nil {
 				nodes = append(nodes, deps)
 			}
+			if logForwarderConfig != nil {
+				nodes = append(nodes, logForwarderConfig)
+			}
 			nodes = append(nodes, statefulSet)
 
-			err = f.writeHelmNode(roleTypeDir, fmt.Sprintf("%s.yaml", instanceGroup.Name), nodes...)
+			err = f.writeHelmNode(settings, roleTypeDir, fmt.Sprintf("%s.yaml", instanceGroup.Name), nodes...)
 			if err != nil {
 				return err
 			}
 		}
+
+		done++
+		f.emit(Event{
+			Type:      EventProgress,
+			Operation: OperationGenerateKube,
+			Subject:   instanceGroup.Name,
+			Message:   "generated",
+			Done:      done,
+			Total:     total,
+		})
 	}
 
 	return nil
@@ -2,6 +2,7 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -36,11 +37,59 @@ func TestCleanCacheEmpty(t *testing.T) {
 
 	err = f.LoadManifest()
 	if assert.NoError(err) {
-		err = f.CleanCache()
+		err = f.CleanCache(context.Background())
 		assert.Nil(err, "Expected CleanCache to find the release")
 	}
 }
 
+func TestCleanCacheEvents(t *testing.T) {
+	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	tempDir, err := ioutil.TempDir("", "fissile-clean-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	f := NewFissileApplication(".", ui)
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/no-instance-groups/no-instance-groups.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/ntp-release"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	f.Options.WorkDir = tempDir
+
+	var events []Event
+	f.Events = EventHandlerFunc(func(event Event) {
+		events = append(events, event)
+	})
+
+	stalePackage := filepath.Join(f.CompilationDir(), "stemcell", "stale-fingerprint")
+	require.NoError(t, os.MkdirAll(stalePackage, 0755))
+
+	require.NoError(t, f.LoadManifest())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = f.CleanCache(ctx)
+	assert.Equal(context.Canceled, err)
+	assert.DirExists(stalePackage, "Cancelled clean up should not remove anything")
+	if assert.Len(events, 2) {
+		assert.Equal(Event{Type: EventStarted, Operation: OperationCleanCache}, events[0])
+		assert.Equal(Event{Type: EventFailed, Operation: OperationCleanCache, Err: context.Canceled}, events[1])
+	}
+
+	events = nil
+	err = f.CleanCache(context.Background())
+	assert.NoError(err)
+	_, err = os.Stat(stalePackage)
+	assert.True(os.IsNotExist(err), "Stale package should have been removed")
+	if assert.Len(events, 2) {
+		assert.Equal(Event{Type: EventStarted, Operation: OperationCleanCache}, events[0])
+		assert.Equal(Event{Type: EventFinished, Operation: OperationCleanCache}, events[1])
+	}
+}
+
 func TestListPackages(t *testing.T) {
 	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
 	assert := assert.New(t)
@@ -647,6 +696,57 @@ func TestDevDiffConfigurations(t *testing.T) {
 	assert.False(ok)
 }
 
+func TestCompareImageSetRecords(t *testing.T) {
+	assert := assert.New(t)
+
+	newRecord := func(devVersion string) *model.RoleVersionRecord {
+		return &model.RoleVersionRecord{
+			DevVersion:     devVersion,
+			FissileVersion: "1.0.0",
+			Jobs:           map[string]string{"tor/tor": "aaa"},
+			Packages:       map[string]string{"tor/tor": "bbb", "tor/libevent": "ccc"},
+			Scripts:        map[string]string{},
+			Templates:      map[string]string{"properties.tor.hostname": "ggg"},
+			Properties:     map[string]string{"tor/tor.hostname": "ddd"},
+		}
+	}
+
+	from := &model.ImageSetRecord{Roles: map[string]*model.RoleVersionRecord{
+		"unchanged": newRecord("1"),
+		"changed":   newRecord("2"),
+		"removed":   newRecord("3"),
+	}}
+	to := &model.ImageSetRecord{Roles: map[string]*model.RoleVersionRecord{
+		"unchanged": newRecord("1"),
+		"changed":   newRecord("4"),
+		"added":     newRecord("5"),
+	}}
+	changed := to.Roles["changed"]
+	changed.Packages["tor/libevent"] = "eee"
+	delete(changed.Packages, "tor/tor")
+	changed.Packages["tor/openssl"] = "fff"
+	changed.Templates["properties.tor.hostname"] = "hhh"
+
+	changes := CompareImageSetRecords(from, to)
+	assert.Equal([]string{"added"}, changes.AddedRoles)
+	assert.Equal([]string{"removed"}, changes.RemovedRoles)
+	if assert.Len(changes.ChangedRoles, 1) {
+		role := changes.ChangedRoles[0]
+		assert.Equal("changed", role.Name)
+		assert.Equal("2", role.OldDevVersion)
+		assert.Equal("4", role.NewDevVersion)
+		assert.Equal([2]string{}, role.FissileVersion)
+		assert.Empty(role.Jobs.AddedKeys)
+		assert.Empty(role.Jobs.DeletedKeys)
+		assert.Empty(role.Jobs.ChangedValues)
+		assert.Equal([]string{"tor/openssl"}, role.Packages.AddedKeys)
+		assert.Equal([]string{"tor/tor"}, role.Packages.DeletedKeys)
+		assert.Equal(map[string][2]string{"tor/libevent": {"ccc", "eee"}}, role.Packages.ChangedValues)
+		assert.Equal(map[string][2]string{"properties.tor.hostname": {"ggg", "hhh"}}, role.Templates.ChangedValues)
+		assert.Empty(role.Properties.ChangedValues)
+	}
+}
+
 func TestFissileSelectRolesToBuild(t *testing.T) {
 	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
 	workDir, err := os.Getwd()
@@ -763,7 +863,7 @@ func TestFissileGenerateKubeRoles(t *testing.T) {
 	require.NoError(t, err)
 	defer os.RemoveAll(outDir)
 
-	err = f.generateKubeRoles(kube.ExportSettings{OutputDir: outDir, RoleManifest: roleManifest})
+	err = f.generateKubeRoles(context.Background(), kube.ExportSettings{OutputDir: outDir, RoleManifest: roleManifest})
 	assert.NoError(t, err)
 
 	for _, name := range []string{"myrole-deployment.yaml", "myrole-clustered.yaml"} {
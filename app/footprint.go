@@ -0,0 +1,157 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	"github.com/fatih/color"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FootprintReport is the footprint of the role manifest at a sizing profile,
+// with the budget it is checked against
+type FootprintReport struct {
+	Sizing         model.SizingProfile      `json:"sizing" yaml:"sizing"`
+	Total          model.Footprint          `json:"total" yaml:"total"`
+	Budget         *model.ResourceBudget    `json:"budget,omitempty" yaml:"budget,omitempty"`
+	Exceeded       []string                 `json:"exceeded,omitempty" yaml:"exceeded,omitempty"`
+	InstanceGroups []InstanceGroupFootprint `json:"instance_groups" yaml:"instance_groups"`
+}
+
+// InstanceGroupFootprint is the footprint of an instance group
+type InstanceGroupFootprint struct {
+	Name            string `json:"name" yaml:"name"`
+	model.Footprint `yaml:",inline"`
+}
+
+// FootprintReports returns the footprint of the role manifest at every sizing
+// profile.  Instance groups without a footprint, i.e. tasks and colocated
+// containers, are left out.
+func FootprintReports(roleManifest *model.RoleManifest) []FootprintReport {
+	var reports []FootprintReport
+	for _, profile := range model.SizingProfiles {
+		report := FootprintReport{
+			Sizing:         profile,
+			Total:          roleManifest.Footprint(profile),
+			Budget:         roleManifest.Budget(profile),
+			InstanceGroups: []InstanceGroupFootprint{},
+		}
+		report.Exceeded = report.Total.ExceededBudget(report.Budget)
+		for _, instanceGroup := range roleManifest.InstanceGroups {
+			footprint := instanceGroup.Footprint(profile)
+			if footprint.Replicas == 0 {
+				continue
+			}
+			report.InstanceGroups = append(report.InstanceGroups, InstanceGroupFootprint{
+				Name:      instanceGroup.Name,
+				Footprint: footprint,
+			})
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// ShowFootprint displays the resources requested by all instance groups
+// together at every sizing profile, and whether they fit the budget of the
+// role manifest.  The requests of instance groups with a vm_type are taken
+// from the vm_types file, if given.
+func (f *Fissile) ShowFootprint(vmTypes string) error {
+	if f.Manifest == nil {
+		return fmt.Errorf("Role manifest not loaded")
+	}
+	if err := ApplyVMTypes(f.Manifest, vmTypes); err != nil {
+		return err
+	}
+	reports := FootprintReports(f.Manifest)
+
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman:
+		f.showFootprintForHuman(reports)
+	case OutputFormatJSON:
+		buf, err := json.Marshal(reports)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(reports)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", f.Options.OutputFormat)
+	}
+
+	return nil
+}
+
+func (f *Fissile) showFootprintForHuman(reports []FootprintReport) {
+	memory := func(size int64, unlimited int) string {
+		if unlimited > 0 {
+			return fmt.Sprintf("%d MiB + %d unlimited", size, unlimited)
+		}
+		return fmt.Sprintf("%d MiB", size)
+	}
+	cpu := func(cores float64, unlimited int) string {
+		if unlimited > 0 {
+			return fmt.Sprintf("%g + %d unlimited", cores, unlimited)
+		}
+		return fmt.Sprintf("%g", cores)
+	}
+
+	for index, report := range reports {
+		if index > 0 {
+			f.UI.Println()
+		}
+		f.UI.Println(color.GreenString("Sizing %s:", report.Sizing))
+		table := termui.NewTable("Instance Group", "Replicas", "Memory Request", "Memory Limit", "CPU Request", "CPU Limit")
+		rows := append(report.InstanceGroups, InstanceGroupFootprint{Name: "Total", Footprint: report.Total})
+		for _, row := range rows {
+			table.Add(row.Name,
+				fmt.Sprintf("%d", row.Replicas),
+				memory(row.MemoryRequest, 0),
+				memory(row.MemoryLimit, row.UnlimitedMemory),
+				cpu(row.CPURequest, 0),
+				cpu(row.CPULimit, row.UnlimitedCPU))
+		}
+		f.printTable(table)
+
+		switch {
+		case report.Budget == nil:
+			f.UI.Println("No budget")
+		case len(report.Exceeded) == 0:
+			f.UI.Printf("Within the budget of %s\n", budgetString(report.Budget))
+		default:
+			for _, exceeded := range report.Exceeded {
+				f.UI.Printf("%s %s\n", color.YellowString("Over budget:"), exceeded)
+			}
+		}
+	}
+}
+
+// budgetString describes the resource budget
+func budgetString(budget *model.ResourceBudget) string {
+	switch {
+	case budget.Memory != nil && budget.CPU != nil:
+		return fmt.Sprintf("%d MiB and %g cores", *budget.Memory, *budget.CPU)
+	case budget.Memory != nil:
+		return fmt.Sprintf("%d MiB", *budget.Memory)
+	case budget.CPU != nil:
+		return fmt.Sprintf("%g cores", *budget.CPU)
+	}
+	return "nothing"
+}
+
+// warnBudgetExceeded warns about the sizing profiles at which the resource
+// requests of the instance groups exceed the budget of the role manifest
+func (f *Fissile) warnBudgetExceeded(roleManifest *model.RoleManifest) {
+	for _, profile := range model.SizingProfiles {
+		for _, exceeded := range roleManifest.Footprint(profile).ExceededBudget(roleManifest.Budget(profile)) {
+			f.UI.Printf("%s at %s sizing, %s\n", color.YellowString("Warning:"), profile, exceeded)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func footprintTestFissile(t *testing.T, output *bytes.Buffer) *Fissile {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/footprint/resource-budget.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+	return f
+}
+
+func TestShowFootprint(t *testing.T) {
+	output := &bytes.Buffer{}
+	f := footprintTestFissile(t, output)
+	f.Options.OutputFormat = OutputFormatJSON
+	require.NoError(t, f.ShowFootprint(""))
+
+	var reports []FootprintReport
+	require.NoError(t, json.Unmarshal(output.Bytes(), &reports))
+	require.Len(t, reports, 2)
+
+	assert.Equal(t, model.SizingDefault, reports[0].Sizing)
+	assert.Equal(t, int64(704), reports[0].Total.MemoryRequest)
+	assert.Empty(t, reports[0].Exceeded)
+	if assert.Len(t, reports[0].InstanceGroups, 2) {
+		assert.Equal(t, "main-role", reports[0].InstanceGroups[0].Name)
+		assert.Equal(t, 1, reports[0].InstanceGroups[0].Replicas)
+		assert.Equal(t, "other-role", reports[0].InstanceGroups[1].Name)
+		assert.Equal(t, int64(512), reports[0].InstanceGroups[1].MemoryRequest)
+	}
+
+	assert.Equal(t, model.SizingHA, reports[1].Sizing)
+	assert.Equal(t, 5, reports[1].Total.Replicas)
+	assert.Equal(t, int64(2048), *reports[1].Budget.Memory)
+	assert.Equal(t, []string{"the CPU requests add up to 1.5 cores, more than the budget of 1 cores"}, reports[1].Exceeded)
+}
+
+func TestShowFootprintForHuman(t *testing.T) {
+	output := &bytes.Buffer{}
+	f := footprintTestFissile(t, output)
+	f.Options.OutputFormat = OutputFormatHuman
+	require.NoError(t, f.ShowFootprint(""))
+
+	assert.Contains(t, output.String(), "Sizing default:")
+	assert.Contains(t, output.String(), "1280 MiB + 1 unlimited")
+	assert.Contains(t, output.String(), "Within the budget of 1024 MiB and 2 cores")
+	assert.Contains(t, output.String(), "Over budget: the CPU requests add up to 1.5 cores, more than the budget of 1 cores")
+}
+
+func TestWarnBudgetExceeded(t *testing.T) {
+	output := &bytes.Buffer{}
+	f := footprintTestFissile(t, output)
+	f.warnBudgetExceeded(f.Manifest)
+	assert.Equal(t, "Warning: at ha sizing, the CPU requests add up to 1.5 cores, more than the budget of 1 cores\n", output.String())
+}
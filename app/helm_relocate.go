@@ -0,0 +1,317 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// HelmRelocateOptions contains all option values for the `fissile helm
+// relocate` command.
+type HelmRelocateOptions struct {
+	ChartDir string
+	Registry string
+}
+
+// ImageRelocation maps an image of a chart to its name in the registry the
+// chart was relocated to
+type ImageRelocation struct {
+	Source string `json:"source" yaml:"source"`
+	Target string `json:"target" yaml:"target"`
+}
+
+// chartImagePattern matches the images the templates of generated charts
+// pass to fissile.ImageName
+var chartImagePattern = regexp.MustCompile(`"fissile.ImageName" \(dict "kube" \.Values\.(?:global\.)?kube "image" "([^"]+)"\)`)
+
+// chartEnvImagePattern matches the environment variables naming images, whose
+// values the templates of generated charts pass to fissile.EnvImageName
+var chartEnvImagePattern = regexp.MustCompile(`"fissile.EnvImageName" \(dict "kube" \.Values\.(?:global\.)?kube "value" \.Values\.env\.(\w+) `)
+
+// valuesKeyPattern matches the lines of values files setting a mapping key
+var valuesKeyPattern = regexp.MustCompile(`^( *)([\w-]+):(.*)$`)
+
+// sidecarImageValues are the values naming the images of the log sidecars.
+// They are not generated by fissile, so they are relocated by their name
+// without their registry and organization.
+var sidecarImageValues = []string{"logging.forwarder.image", "logging.tail.image"}
+
+// skopeoSyncRegistry lists the images of a registry to copy, in the YAML
+// source format of `skopeo sync`: the tags of the images, keyed by their
+// repository.
+type skopeoSyncRegistry struct {
+	Images map[string][]string `json:"images" yaml:"images"`
+}
+
+// valueRelocation returns the relocated value of a chart value from its
+// current one.  Values that are not optional must be in the chart.
+type valueRelocation struct {
+	relocate func(current string) string
+	optional bool
+}
+
+// RelocateHelmChart relocates the images of a helm chart generated by
+// `fissile build helm` to another registry, for installs without access to
+// the original one: the registry and organization in the values of the chart
+// are replaced, and the current images of the chart are printed as the input
+// of `skopeo sync --src yaml`, to copy them into the registry.
+func (f *Fissile) RelocateHelmChart(opt HelmRelocateOptions) error {
+	relocations, err := RelocateHelmChartImages(opt)
+	if err != nil {
+		return err
+	}
+	input := skopeoSyncInput(relocations)
+
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman, OutputFormatYAML:
+		buf, err := yaml.Marshal(input)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatJSON:
+		buf, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", f.Options.OutputFormat)
+	}
+	return nil
+}
+
+// RelocateHelmChartImages rewrites the kube.registry.hostname and
+// kube.organization values of the chart (or their global values, with
+// sub-charts) to the registry, given as <hostname>/<prefix>, and returns the
+// relocations of the images of the chart, sorted by source.  The images of
+// the log sidecars and the values of the environment variables naming images
+// are moved to the registry too; like the images of the log sidecars, images
+// naming their registry or organization keep only their name.  The target
+// of each image is thus the registry followed by the last component of its
+// repository, as with `skopeo sync` (without --scoped).  The chart is left
+// unchanged on errors.
+func RelocateHelmChartImages(opt HelmRelocateOptions) ([]ImageRelocation, error) {
+	parts := strings.SplitN(opt.Registry, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || strings.Trim(parts[1], "/") == "" {
+		return nil, fmt.Errorf("Invalid registry '%s', expected <hostname>/<prefix>", opt.Registry)
+	}
+	hostname, organization := parts[0], strings.Trim(parts[1], "/")
+
+	images, envImages, err := chartImages(opt.ChartDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("Chart %s has no images generated by fissile", opt.ChartDir)
+	}
+
+	valuesPath := filepath.Join(opt.ChartDir, "values.yaml")
+	values, err := ioutil.ReadFile(valuesPath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the values of chart %s: %v", opt.ChartDir, err)
+	}
+	relocations := map[string]valueRelocation{
+		"kube.registry.hostname": {relocate: func(string) string { return hostname }},
+		"kube.organization":      {relocate: func(string) string { return organization }},
+	}
+	relocateImage := func(current string) string {
+		return fmt.Sprintf("%s/%s/%s", hostname, organization, path.Base(current))
+	}
+	for _, name := range sidecarImageValues {
+		relocations[name] = valueRelocation{relocate: relocateImage, optional: true}
+	}
+	for _, name := range envImages {
+		// Images without a slash are prefixed with the registry and
+		// organization of the chart, so they are relocated with them.
+		relocations["env."+name] = valueRelocation{
+			relocate: func(current string) string {
+				if strings.Contains(current, "/") {
+					return relocateImage(current)
+				}
+				return current
+			},
+			optional: true,
+		}
+	}
+	relocated, current, err := relocateValues(string(values), relocations)
+	if err != nil {
+		return nil, fmt.Errorf("Error relocating %s: %v", valuesPath, err)
+	}
+
+	sources := map[string]string{}
+	for _, image := range images {
+		source := fmt.Sprintf("%s/%s/%s", current["kube.registry.hostname"], current["kube.organization"], image)
+		sources[source] = fmt.Sprintf("%s/%s/%s", hostname, organization, image)
+	}
+	for _, name := range sidecarImageValues {
+		if image, ok := current[name]; ok {
+			sources[image] = relocateImage(image)
+		}
+	}
+	for _, name := range envImages {
+		image := current["env."+name]
+		if image == "" {
+			// Without a default, the image is only known at install time
+			continue
+		}
+		if strings.Contains(image, "/") {
+			sources[image] = relocateImage(image)
+		} else {
+			sources[fmt.Sprintf("%s/%s/%s", current["kube.registry.hostname"], current["kube.organization"], image)] = relocateImage(image)
+		}
+	}
+
+	imageRelocations := make([]ImageRelocation, 0, len(sources))
+	for source, target := range sources {
+		imageRelocations = append(imageRelocations, ImageRelocation{Source: source, Target: target})
+	}
+	sort.Slice(imageRelocations, func(i, j int) bool {
+		return imageRelocations[i].Source < imageRelocations[j].Source
+	})
+
+	if err := ioutil.WriteFile(valuesPath, []byte(relocated), 0644); err != nil {
+		return nil, fmt.Errorf("Error writing %s: %v", valuesPath, err)
+	}
+	return imageRelocations, nil
+}
+
+// relocateValues relocates the values of the values file, keyed by their path
+// (below global, with sub-charts), keeping the rest of the file as is.  It
+// returns the new file and the values it replaced.
+func relocateValues(values string, relocations map[string]valueRelocation) (string, map[string]string, error) {
+	type key struct {
+		indent int
+		name   string
+	}
+	var stack []key
+	current := map[string]string{}
+	lines := strings.Split(values, "\n")
+	for i, line := range lines {
+		match := valuesKeyPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		indent := len(match[1])
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, key{indent: indent, name: match[2]})
+
+		var path []string
+		for _, k := range stack {
+			path = append(path, k.name)
+		}
+		if len(path) > 0 && path[0] == "global" {
+			path = path[1:]
+		}
+		name := strings.Join(path, ".")
+		relocation, ok := relocations[name]
+		if !ok {
+			continue
+		}
+		var value string
+		if err := yaml.Unmarshal([]byte(match[3]), &value); err != nil {
+			return "", nil, fmt.Errorf("Invalid value of %s: %v", name, err)
+		}
+		current[name] = value
+		lines[i] = fmt.Sprintf("%s%s: %s", match[1], match[2], strconv.Quote(relocation.relocate(value)))
+	}
+
+	var missing []string
+	for name, relocation := range relocations {
+		if _, ok := current[name]; !ok && !relocation.optional {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return "", nil, fmt.Errorf("Missing values %s", strings.Join(missing, ", "))
+	}
+	return strings.Join(lines, "\n"), current, nil
+}
+
+// skopeoSyncInput returns the source images of the relocations as the input
+// of `skopeo sync --src yaml`, keyed by their registry.  Images without a
+// registry are on docker.io, and images without a tag or digest are tagged
+// latest, as with docker.
+func skopeoSyncInput(relocations []ImageRelocation) map[string]skopeoSyncRegistry {
+	input := map[string]skopeoSyncRegistry{}
+	for _, relocation := range relocations {
+		registry, repository := "docker.io", relocation.Source
+		if parts := strings.SplitN(repository, "/", 2); len(parts) == 2 &&
+			(strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+			registry, repository = parts[0], parts[1]
+		}
+		if registry == "docker.io" && !strings.Contains(repository, "/") {
+			repository = "library/" + repository
+		}
+
+		tag := "latest"
+		if i := strings.LastIndex(repository, "@"); i >= 0 {
+			repository, tag = repository[:i], repository[i+1:]
+		} else if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+			repository, tag = repository[:i], repository[i+1:]
+		}
+
+		if _, ok := input[registry]; !ok {
+			input[registry] = skopeoSyncRegistry{Images: map[string][]string{}}
+		}
+		input[registry].Images[repository] = append(input[registry].Images[repository], tag)
+	}
+	for _, registry := range input {
+		for _, tags := range registry.Images {
+			sort.Strings(tags)
+		}
+	}
+	return input
+}
+
+// chartImages returns the sorted images referenced by the templates of the
+// chart and of its sub-charts, and the sorted names of the environment
+// variables naming images they use
+func chartImages(chartDir string) ([]string, []string, error) {
+	seen := map[string]bool{}
+	seenEnv := map[string]bool{}
+	var images, envImages []string
+	err := filepath.Walk(chartDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Base(filepath.Dir(path)) != "templates" {
+			return nil
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, match := range chartImagePattern.FindAllStringSubmatch(string(contents), -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				images = append(images, match[1])
+			}
+		}
+		for _, match := range chartEnvImagePattern.FindAllStringSubmatch(string(contents), -1) {
+			if !seenEnv[match[1]] {
+				seenEnv[match[1]] = true
+				envImages = append(envImages, match[1])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading the templates of chart %s: %v", chartDir, err)
+	}
+	sort.Strings(images)
+	sort.Strings(envImages)
+	return images, envImages, nil
+}
@@ -0,0 +1,180 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/kube"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestRelocateHelmChart(t *testing.T) {
+	output := &bytes.Buffer{}
+	ui := termui.New(&bytes.Buffer{}, output, nil)
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", ui)
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/relocate.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	f.Options.OutputFormat = OutputFormatHuman
+	require.NoError(t, f.LoadManifest())
+
+	chartDir, err := ioutil.TempDir("", "fissile-test-helm-relocate")
+	require.NoError(t, err)
+	defer os.RemoveAll(chartDir)
+
+	err = f.GenerateKube(context.Background(), kube.ExportSettings{
+		OutputDir:       chartDir,
+		CreateHelmChart: true,
+		Registry:        "docker.example.com",
+		Organization:    "splat",
+	})
+	require.NoError(t, err)
+	values, err := ioutil.ReadFile(filepath.Join(chartDir, "values.yaml"))
+	require.NoError(t, err)
+
+	err = f.RelocateHelmChart(HelmRelocateOptions{ChartDir: chartDir, Registry: "my.internal"})
+	assert.EqualError(t, err, "Invalid registry 'my.internal', expected <hostname>/<prefix>")
+
+	output.Reset()
+	err = f.RelocateHelmChart(HelmRelocateOptions{ChartDir: chartDir, Registry: "my.internal/air/gap"})
+	require.NoError(t, err)
+	var input map[string]skopeoSyncRegistry
+	require.NoError(t, yaml.Unmarshal(output.Bytes(), &input), "The output is the input of skopeo sync")
+	assert.Equal(t, skopeoSyncRegistry{Images: map[string][]string{
+		"library/busybox":   {"1.31"},
+		"fluent/fluent-bit": {"1.3"},
+	}}, input["docker.io"], "The images of the log sidecars are copied")
+	assert.Equal(t, skopeoSyncRegistry{Images: map[string][]string{
+		"tools/debug": {"1.0"},
+	}}, input["quay.io"], "Images in other registries are copied")
+	if assert.Contains(t, input, "docker.example.com") {
+		var repositories []string
+		for repository, tags := range input["docker.example.com"].Images {
+			repositories = append(repositories, repository)
+			assert.Len(t, tags, 1)
+		}
+		sort.Strings(repositories)
+		if assert.Len(t, repositories, 3, "Both instance groups and the helper have an image") {
+			assert.Equal(t, "splat/helper", repositories[0])
+			assert.True(t, strings.HasPrefix(repositories[1], "splat/myrole-"), repositories[1])
+			assert.True(t, strings.HasPrefix(repositories[2], "splat/myrole-"), repositories[2])
+		}
+	}
+	assert.Len(t, input, 3)
+
+	relocated, err := ioutil.ReadFile(filepath.Join(chartDir, "values.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(relocated), `  organization: "air/gap"`)
+	assert.Contains(t, string(relocated), `    hostname: "my.internal"`)
+	assert.Contains(t, string(relocated), `  DEBUG_IMAGE: "my.internal/air/gap/debug:1.0"`)
+	assert.Contains(t, string(relocated), `  HELPER_IMAGE: "helper:2.1"`)
+	assert.Equal(t, len(strings.Split(string(values), "\n")), len(strings.Split(string(relocated), "\n")),
+		"The rest of the values should be kept")
+
+	output.Reset()
+	require.NoError(t, f.RenderHelmTemplates(HelmTemplateOptions{ChartDir: chartDir}))
+	assert.Contains(t, output.String(), "image: my.internal/air/gap/myrole-clustered:")
+	assert.Contains(t, output.String(), `"my.internal/air/gap/helper:2.1"`)
+	assert.NotContains(t, output.String(), "docker.example.com")
+
+	for sidecar, image := range map[string]string{"tail": "busybox:1.31", "forwarder": "fluent-bit:1.3"} {
+		output.Reset()
+		require.NoError(t, f.RenderHelmTemplates(HelmTemplateOptions{
+			ChartDir: chartDir,
+			Set:      []string{"logging.sidecar=" + sidecar},
+		}))
+		assert.Contains(t, output.String(), `image: "my.internal/air/gap/`+image+`"`, "The %s sidecar is relocated", sidecar)
+	}
+
+	err = f.RelocateHelmChart(HelmRelocateOptions{ChartDir: filepath.Join(chartDir, "templates"), Registry: "my.internal/air"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Error reading the values of chart ")
+}
+
+func TestRelocateValues(t *testing.T) {
+	t.Parallel()
+
+	values := strings.Join([]string{
+		"global:",
+		"  # The registry",
+		"  kube:",
+		"    organization: ~",
+		"    registry:",
+		`      hostname: "docker.io"`,
+		"  organization: other",
+		"sizing:",
+		"  kube:",
+		"    organization: sizing",
+		"logging:",
+		"  tail:",
+		"    image: busybox",
+	}, "\n")
+	replace := func(value string) valueRelocation {
+		return valueRelocation{relocate: func(string) string { return value }}
+	}
+	relocated, current, err := relocateValues(values, map[string]valueRelocation{
+		"kube.registry.hostname": replace("my.internal"),
+		"kube.organization":      replace("prefix"),
+		"logging.tail.image":     {relocate: strings.ToUpper, optional: true},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"kube.registry.hostname": "docker.io", "kube.organization": "", "logging.tail.image": "busybox"}, current)
+	assert.Equal(t, strings.Join([]string{
+		"global:",
+		"  # The registry",
+		"  kube:",
+		`    organization: "prefix"`,
+		"    registry:",
+		`      hostname: "my.internal"`,
+		"  organization: other",
+		"sizing:",
+		"  kube:",
+		"    organization: sizing",
+		"logging:",
+		"  tail:",
+		`    image: "BUSYBOX"`,
+	}, "\n"), relocated)
+
+	_, _, err = relocateValues("kube:\n  organization: splat\n", map[string]valueRelocation{
+		"kube.registry.hostname": replace("my.internal"),
+		"kube.organization":      replace("prefix"),
+	})
+	assert.EqualError(t, err, "Missing values kube.registry.hostname")
+}
+
+func TestSkopeoSyncInput(t *testing.T) {
+	t.Parallel()
+
+	input := skopeoSyncInput([]ImageRelocation{
+		{Source: "busybox"},
+		{Source: "fluent/fluent-bit:1.3"},
+		{Source: "localhost/image:2"},
+		{Source: "registry:5000/org/image:1"},
+		{Source: "registry:5000/org/image@sha256:0123"},
+		{Source: "registry:5000/org/image:0"},
+	})
+	assert.Equal(t, map[string]skopeoSyncRegistry{
+		"docker.io": {Images: map[string][]string{
+			"library/busybox":   {"latest"},
+			"fluent/fluent-bit": {"1.3"},
+		}},
+		"localhost": {Images: map[string][]string{
+			"image": {"2"},
+		}},
+		"registry:5000": {Images: map[string][]string{
+			"org/image": {"0", "1", "sha256:0123"},
+		}},
+	}, input)
+}
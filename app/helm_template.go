@@ -0,0 +1,121 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/helm/render"
+)
+
+// HelmTemplateOptions contains all option values for the `fissile helm template` command.
+type HelmTemplateOptions struct {
+	ChartDir       string
+	ValuesFiles    []string
+	Set            []string
+	ReleaseName    string
+	KubeVersion    string
+	ReleaseService string
+	OutputDir      string
+}
+
+// helmRenderOptions are the values and built-in objects the commands
+// rendering helm charts render them with.  Each entry of Set holds comma
+// separated assignments, like the --set flag of helm.
+type helmRenderOptions struct {
+	ValuesFiles    []string
+	Set            []string
+	ReleaseName    string
+	KubeVersion    string
+	ReleaseService string
+}
+
+// RenderHelmTemplates renders all templates of a helm chart with the given
+// values, the way `helm template` would, and either prints the result or
+// writes it to the output directory.  Every template is rendered and parsed as
+// YAML; the error lists all templates that failed.
+func (f *Fissile) RenderHelmTemplates(opt HelmTemplateOptions) error {
+	chart, overrides, err := loadHelmChart(opt.ChartDir, helmRenderOptions{
+		ValuesFiles:    opt.ValuesFiles,
+		Set:            opt.Set,
+		ReleaseName:    opt.ReleaseName,
+		KubeVersion:    opt.KubeVersion,
+		ReleaseService: opt.ReleaseService,
+	})
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, name := range chart.TemplateNames() {
+		rendered, err := chart.RenderTemplateText(name, overrides)
+		var documents []interface{}
+		if err == nil {
+			documents, err = render.ParseDocuments(rendered)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if len(documents) == 0 {
+			// Disabled by the values, like helm would skip it
+			continue
+		}
+
+		source := filepath.Join(chart.Name, "templates", name)
+		if opt.OutputDir == "" {
+			f.UI.Printf("---\n# Source: %s\n%s\n", source, strings.TrimSpace(string(rendered)))
+			continue
+		}
+
+		outputPath := filepath.Join(opt.OutputDir, source)
+		if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(outputPath, rendered, 0644); err != nil {
+			return fmt.Errorf("Error writing %s: %v", outputPath, err)
+		}
+		f.UI.Printf("wrote %s\n", outputPath)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Error rendering chart %s:\n%s", opt.ChartDir, strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// loadHelmChart loads the chart in the directory with the values files and
+// the `--set` assignments merged in, and returns it with the overrides for
+// the release name.
+func loadHelmChart(chartDir string, opt helmRenderOptions) (*render.Chart, map[string]interface{}, error) {
+	chart, err := render.LoadChart(chartDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error loading chart %s: %v", chartDir, err)
+	}
+	if len(chart.Templates) == 0 {
+		return nil, nil, fmt.Errorf("Chart %s has no templates", chartDir)
+	}
+	chart.KubeVersion = opt.KubeVersion
+	chart.ReleaseService = opt.ReleaseService
+
+	for _, valuesFile := range opt.ValuesFiles {
+		if err := chart.MergeValuesFile(valuesFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, set := range opt.Set {
+		values, err := render.ParseSetValues(set)
+		if err != nil {
+			return nil, nil, err
+		}
+		chart.MergeValues(values)
+	}
+
+	overrides := make(map[string]interface{})
+	if opt.ReleaseName != "" {
+		overrides["Release.Name"] = opt.ReleaseName
+	}
+	return chart, overrides, nil
+}
@@ -0,0 +1,129 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderHelmTemplatesGeneratedChart(t *testing.T) {
+	output := &bytes.Buffer{}
+	ui := termui.New(&bytes.Buffer{}, output, nil)
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", ui)
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/two-roles.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	outDir, err := ioutil.TempDir("", "fissile-test-helm-template")
+	require.NoError(t, err)
+	defer os.RemoveAll(outDir)
+
+	opinions, err := model.NewOpinions(
+		filepath.Join(workDir, "../test-assets/tor-opinions/opinions.yml"),
+		filepath.Join(workDir, "../test-assets/tor-opinions/dark-opinions.yml"))
+	require.NoError(t, err)
+	err = f.GenerateKube(context.Background(), kube.ExportSettings{
+		OutputDir:       outDir,
+		CreateHelmChart: true,
+		Opinions:        opinions,
+	})
+	require.NoError(t, err)
+
+	output.Reset()
+	err = f.RenderHelmTemplates(HelmTemplateOptions{ChartDir: outDir})
+	assert.NoError(t, err)
+	assert.Contains(t, output.String(), `kind: "StatefulSet"`)
+	assert.Contains(t, output.String(), "checksum/config: ", "Included templates should be rendered")
+	assert.NotContains(t, output.String(), "registry-secret.yaml", "Empty templates should be skipped")
+}
+
+func TestRenderHelmTemplates(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+	chartDir := filepath.Join(workDir, "../test-assets/charttest/chart")
+
+	t.Run("Print", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+
+		valuesFile, err := ioutil.TempFile("", "values")
+		require.NoError(t, err)
+		defer os.Remove(valuesFile.Name())
+		_, err = valuesFile.WriteString("services: {loadbalanced: true}\nports: [8080]\n")
+		require.NoError(t, err)
+		require.NoError(t, valuesFile.Close())
+
+		err = f.RenderHelmTemplates(HelmTemplateOptions{
+			ChartDir:    chartDir,
+			ValuesFiles: []string{valuesFile.Name()},
+			Set:         []string{"ports={8443}"},
+			ReleaseName: "Test",
+		})
+		require.NoError(t, err)
+		assert.Contains(t, output.String(), "# Source: example/templates/service.yaml\n")
+		assert.Contains(t, output.String(), "name: example-test\n")
+		assert.Contains(t, output.String(), "type: LoadBalancer\n")
+		assert.Contains(t, output.String(), "- port: 8443\n")
+		assert.NotContains(t, output.String(), "- port: 8080\n")
+	})
+
+	t.Run("OutputDir", func(t *testing.T) {
+		outDir, err := ioutil.TempDir("", "fissile-test-helm-template")
+		require.NoError(t, err)
+		defer os.RemoveAll(outDir)
+
+		f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+		err = f.RenderHelmTemplates(HelmTemplateOptions{ChartDir: chartDir, OutputDir: outDir})
+		require.NoError(t, err)
+
+		contents, err := ioutil.ReadFile(filepath.Join(outDir, "example", "templates", "service.yaml"))
+		require.NoError(t, err)
+		assert.Contains(t, string(contents), "name: example-myrelease")
+	})
+
+	t.Run("InvalidAssignment", func(t *testing.T) {
+		f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+		err := f.RenderHelmTemplates(HelmTemplateOptions{ChartDir: chartDir, Set: []string{"ports"}})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "Invalid value assignment 'ports': key ports has no value")
+		}
+	})
+
+	t.Run("BrokenTemplate", func(t *testing.T) {
+		brokenDir, err := ioutil.TempDir("", "fissile-test-helm-template")
+		require.NoError(t, err)
+		defer os.RemoveAll(brokenDir)
+
+		require.NoError(t, os.MkdirAll(filepath.Join(brokenDir, "templates"), 0755))
+		templates := map[string]string{
+			"good.yaml":     "kind: Service\n",
+			"bad-yaml.yaml": "kind: [Service\n",
+			"failing.yaml":  `{{ fail "deliberate" }}`,
+		}
+		for name, text := range templates {
+			require.NoError(t, ioutil.WriteFile(filepath.Join(brokenDir, "templates", name), []byte(text), 0644))
+		}
+
+		f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+		err = f.RenderHelmTemplates(HelmTemplateOptions{ChartDir: brokenDir})
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "bad-yaml.yaml: ")
+			assert.Contains(t, err.Error(), "failing.yaml: ")
+			assert.Contains(t, err.Error(), "deliberate")
+			assert.NotContains(t, err.Error(), "good.yaml")
+		}
+	})
+}
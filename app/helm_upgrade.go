@@ -0,0 +1,295 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/helm/render"
+	"code.cloudfoundry.org/fissile/util"
+	"github.com/SUSE/termui"
+	"github.com/fatih/color"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// HelmUpgradeCheckOptions contains all option values for the `fissile helm
+// upgrade-check` command.
+type HelmUpgradeCheckOptions struct {
+	OldChartDir    string
+	NewChartDir    string
+	ValuesFiles    []string
+	Set            []string
+	ReleaseName    string
+	KubeVersion    string
+	ReleaseService string
+}
+
+// These are the kinds of changes reported by the upgrade check
+const (
+	UpgradeValueRemoved          = "value-removed"
+	UpgradeDefaultChanged        = "default-changed"
+	UpgradeRoleRemoved           = "role-removed"
+	UpgradeImmutableFieldChanged = "immutable-field-changed"
+)
+
+// UpgradeChange describes one difference between two charts which may affect
+// an upgrade from the old chart to the new one, with a suggestion on how to
+// deal with it
+type UpgradeChange struct {
+	Kind       string      `json:"kind" yaml:"kind"`
+	Path       string      `json:"path" yaml:"path"`
+	Old        interface{} `json:"old,omitempty" yaml:"old,omitempty"`
+	New        interface{} `json:"new,omitempty" yaml:"new,omitempty"`
+	Breaking   bool        `json:"breaking" yaml:"breaking"`
+	Suggestion string      `json:"suggestion" yaml:"suggestion"`
+}
+
+// workloadKinds are the kinds of objects fissile generates for instance groups
+var workloadKinds = map[string]bool{"Deployment": true, "StatefulSet": true, "Job": true, "Pod": true}
+
+// immutableFields lists, per kind, the fields kubernetes refuses to change on
+// existing objects
+var immutableFields = map[string][]string{
+	"Deployment":  {"spec.selector"},
+	"StatefulSet": {"spec.selector", "spec.serviceName", "spec.podManagementPolicy", "spec.volumeClaimTemplates"},
+}
+
+// CheckHelmUpgrade compares two helm charts, usually generated by `fissile
+// build helm` from two versions of a role manifest, and reports the changes
+// which may break an upgrade from the old chart to the new one: removed
+// values, changed defaults, removed instance groups, and changes to fields of
+// existing objects which kubernetes does not allow.  Both charts are rendered
+// with the given values.  The error lists the number of breaking changes.
+func (f *Fissile) CheckHelmUpgrade(opt HelmUpgradeCheckOptions) error {
+	changes, err := CollectHelmUpgradeChanges(opt)
+	if err != nil {
+		return err
+	}
+
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman:
+		f.showHelmUpgradeChangesForHuman(changes)
+	case OutputFormatJSON:
+		buf, err := json.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", f.Options.OutputFormat)
+	}
+
+	breaking := 0
+	for _, change := range changes {
+		if change.Breaking {
+			breaking++
+		}
+	}
+	if breaking > 0 {
+		return fmt.Errorf("Upgrading from chart %s to chart %s has %d breaking changes", opt.OldChartDir, opt.NewChartDir, breaking)
+	}
+	return nil
+}
+
+// CollectHelmUpgradeChanges returns the changes between the charts, sorted by
+// kind and path.
+func CollectHelmUpgradeChanges(opt HelmUpgradeCheckOptions) ([]UpgradeChange, error) {
+	oldDefaults, oldObjects, err := loadUpgradeChart(opt.OldChartDir, opt)
+	if err != nil {
+		return nil, err
+	}
+	newDefaults, newObjects, err := loadUpgradeChart(opt.NewChartDir, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]UpgradeChange, 0)
+	for path, oldValue := range oldDefaults {
+		newValue, ok := newDefaults[path]
+		if !ok {
+			changes = append(changes, UpgradeChange{
+				Kind:       UpgradeValueRemoved,
+				Path:       path,
+				Old:        oldValue,
+				Breaking:   true,
+				Suggestion: fmt.Sprintf("Remove %s from the values files; the new chart ignores it", path),
+			})
+			continue
+		}
+		if !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, UpgradeChange{
+				Kind:       UpgradeDefaultChanged,
+				Path:       path,
+				Old:        oldValue,
+				New:        newValue,
+				Suggestion: fmt.Sprintf("Set %s to %s in the values files to keep the old default", path, upgradeValueText(oldValue)),
+			})
+		}
+	}
+
+	for key, oldObject := range oldObjects {
+		kind := fmt.Sprintf("%v", oldObject["kind"])
+		newObject, ok := newObjects[key]
+		if !ok {
+			if workloadKinds[kind] {
+				changes = append(changes, UpgradeChange{
+					Kind:       UpgradeRoleRemoved,
+					Path:       key,
+					Breaking:   true,
+					Suggestion: fmt.Sprintf("Migrate any data of %s before upgrading; helm deletes it", key),
+				})
+			}
+			continue
+		}
+		for _, field := range immutableFields[kind] {
+			oldValue := jsonValue(lookupPath(oldObject, field))
+			newValue := jsonValue(lookupPath(newObject, field))
+			if reflect.DeepEqual(oldValue, newValue) {
+				continue
+			}
+			changes = append(changes, UpgradeChange{
+				Kind:     UpgradeImmutableFieldChanged,
+				Path:     fmt.Sprintf("%s %s", key, field),
+				Old:      oldValue,
+				New:      newValue,
+				Breaking: true,
+				Suggestion: fmt.Sprintf("Delete %s without its pods (kubectl delete %s --cascade=false) before upgrading",
+					key, strings.ToLower(key)),
+			})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return changes[i].Kind < changes[j].Kind
+		}
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// loadUpgradeChart returns the default values of the chart in the directory by
+// path, and the objects of the chart rendered with the given values, by kind
+// and name.
+func loadUpgradeChart(chartDir string, opt HelmUpgradeCheckOptions) (map[string]interface{}, map[string]map[interface{}]interface{}, error) {
+	chart, err := render.LoadChart(chartDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error loading chart %s: %v", chartDir, err)
+	}
+	defaults := make(map[string]interface{})
+	flattenValues("", chart.Values, defaults)
+	for path, value := range defaults {
+		defaults[path] = jsonValue(value)
+	}
+
+	chart, overrides, err := loadHelmChart(chartDir, helmRenderOptions{
+		ValuesFiles:    opt.ValuesFiles,
+		Set:            opt.Set,
+		ReleaseName:    opt.ReleaseName,
+		KubeVersion:    opt.KubeVersion,
+		ReleaseService: opt.ReleaseService,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	rendered, err := chart.RenderAll(overrides)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error rendering chart %s: %v", chartDir, err)
+	}
+
+	objects := make(map[string]map[interface{}]interface{})
+	for name, documents := range rendered {
+		for _, document := range documents {
+			object, ok := document.(map[interface{}]interface{})
+			if !ok {
+				return nil, nil, fmt.Errorf("%s: expected a Kubernetes object, found %T", name, document)
+			}
+			objects[fmt.Sprintf("%v/%v", object["kind"], lookupPath(object, "metadata.name"))] = object
+		}
+	}
+	return defaults, objects, nil
+}
+
+// flattenValues adds the leaves of the values to the result by their dotted
+// path.  Lists are leaves.
+func flattenValues(prefix string, value interface{}, result map[string]interface{}) {
+	join := func(key interface{}) string {
+		if prefix == "" {
+			return fmt.Sprintf("%v", key)
+		}
+		return fmt.Sprintf("%s.%v", prefix, key)
+	}
+	switch mapping := value.(type) {
+	case map[string]interface{}:
+		for key, element := range mapping {
+			flattenValues(join(key), element, result)
+		}
+	case map[interface{}]interface{}:
+		for key, element := range mapping {
+			flattenValues(join(key), element, result)
+		}
+	default:
+		result[prefix] = value
+	}
+}
+
+// lookupPath returns the element of the object at the dotted path, or nil.
+func lookupPath(object interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		mapping, ok := object.(map[interface{}]interface{})
+		if !ok {
+			return nil
+		}
+		object = mapping[key]
+	}
+	return object
+}
+
+// jsonValue converts the value to the types encoding/json uses, so that values
+// from YAML can be compared and serialized as JSON.
+func jsonValue(value interface{}) interface{} {
+	buf, err := util.JSONMarshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	var result interface{}
+	if err := json.Unmarshal(buf, &result); err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return result
+}
+
+// upgradeValueText returns the value as it would be written in a values file
+func upgradeValueText(value interface{}) string {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(buf)
+}
+
+func (f *Fissile) showHelmUpgradeChangesForHuman(changes []UpgradeChange) {
+	if len(changes) == 0 {
+		f.UI.Println(color.GreenString("No upgrade problems found"))
+		return
+	}
+
+	table := termui.NewTable("Change", "Path", "Breaking", "Suggestion")
+	for _, change := range changes {
+		breaking := "no"
+		if change.Breaking {
+			breaking = color.RedString("yes")
+		}
+		table.Add(change.Kind, change.Path, breaking, change.Suggestion)
+	}
+
+	f.printTable(table)
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckHelmUpgrade(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+	opt := HelmUpgradeCheckOptions{
+		OldChartDir: filepath.Join(workDir, "../test-assets/charttest/upgrade/old"),
+		NewChartDir: filepath.Join(workDir, "../test-assets/charttest/upgrade/new"),
+	}
+
+	t.Run("Changes", func(t *testing.T) {
+		changes, err := CollectHelmUpgradeChanges(opt)
+		require.NoError(t, err)
+
+		var summary [][]interface{}
+		for _, change := range changes {
+			summary = append(summary, []interface{}{change.Kind, change.Path, change.Breaking})
+		}
+		assert.Equal(t, [][]interface{}{
+			{UpgradeDefaultChanged, "sizing.database.disk_sizes.data", false},
+			{UpgradeDefaultChanged, "sizing.router.count", false},
+			{UpgradeImmutableFieldChanged, "StatefulSet/database spec.serviceName", true},
+			{UpgradeImmutableFieldChanged, "StatefulSet/database spec.volumeClaimTemplates", true},
+			{UpgradeRoleRemoved, "Deployment/worker", true},
+			{UpgradeValueRemoved, "env.OLD_SETTING", true},
+			{UpgradeValueRemoved, "sizing.worker.count", true},
+		}, summary)
+
+		assert.Equal(t, "database-set", changes[2].Old)
+		assert.Equal(t, "database-headless", changes[2].New)
+		assert.Equal(t, "Set sizing.router.count to 2 in the values files to keep the old default", changes[1].Suggestion)
+		assert.Contains(t, changes[2].Suggestion, "kubectl delete statefulset/database --cascade=false")
+	})
+
+	t.Run("Values", func(t *testing.T) {
+		opt := opt
+		opt.Set = []string{"sizing.database.disk_sizes.data=20"}
+		changes, err := CollectHelmUpgradeChanges(opt)
+		require.NoError(t, err)
+		for _, change := range changes {
+			assert.NotEqual(t, "StatefulSet/database spec.volumeClaimTemplates", change.Path,
+				"The rendered volume claims are the same for the same values")
+		}
+	})
+
+	t.Run("Output", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+
+		f.Options.OutputFormat = OutputFormatJSON
+		err := f.CheckHelmUpgrade(opt)
+		assert.EqualError(t, err, "Upgrading from chart "+opt.OldChartDir+" to chart "+opt.NewChartDir+" has 5 breaking changes")
+		var actual []UpgradeChange
+		require.NoError(t, json.Unmarshal(output.Bytes(), &actual))
+		assert.Len(t, actual, 7)
+
+		output.Reset()
+		f.Options.OutputFormat = OutputFormatHuman
+		assert.Error(t, f.CheckHelmUpgrade(opt))
+		assert.Contains(t, termui.Decolorize(output.String()), "Remove env.OLD_SETTING from the values files")
+
+		output.Reset()
+		opt := opt
+		opt.NewChartDir = opt.OldChartDir
+		assert.NoError(t, f.CheckHelmUpgrade(opt))
+		assert.Contains(t, termui.Decolorize(output.String()), "No upgrade problems found")
+	})
+
+	t.Run("MissingChart", func(t *testing.T) {
+		opt := opt
+		opt.NewChartDir = filepath.Join(workDir, "../test-assets/charttest/no-such-chart")
+		_, err := CollectHelmUpgradeChanges(opt)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,240 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/fatih/color"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// RoleChanges describes how a single instance group changed between two
+// image sets, split up by the inputs of its dev version.
+type RoleChanges struct {
+	Name           string     `json:"name" yaml:"name"`
+	OldDevVersion  string     `json:"old_dev_version" yaml:"old_dev_version"`
+	NewDevVersion  string     `json:"new_dev_version" yaml:"new_dev_version"`
+	FissileVersion [2]string  `json:"fissile_version,omitempty" yaml:"fissile_version,omitempty"`
+	TagExtra       [2]string  `json:"tag_extra,omitempty" yaml:"tag_extra,omitempty"`
+	Dockerfile     [2]string  `json:"dockerfile,omitempty" yaml:"dockerfile,omitempty"`
+	Healthcheck    [2]string  `json:"healthcheck,omitempty" yaml:"healthcheck,omitempty"`
+	Jobs           *HashDiffs `json:"jobs" yaml:"jobs"`
+	Packages       *HashDiffs `json:"packages" yaml:"packages"`
+	Scripts        *HashDiffs `json:"scripts" yaml:"scripts"`
+	Templates      *HashDiffs `json:"templates" yaml:"templates"`
+	Properties     *HashDiffs `json:"properties" yaml:"properties"`
+}
+
+// ImageChanges is the change report between two image sets
+type ImageChanges struct {
+	AddedRoles   []string       `json:"added_roles" yaml:"added_roles"`
+	RemovedRoles []string       `json:"removed_roles" yaml:"removed_roles"`
+	ChangedRoles []*RoleChanges `json:"changed_roles" yaml:"changed_roles"`
+}
+
+// WriteImageSetRecord writes the version records of the given instance groups
+// to a JSON file, for later use with ReportImageChanges.
+func (f *Fissile) WriteImageSetRecord(path string, instanceGroups model.InstanceGroups, tagExtra string) error {
+	opinions, err := model.NewOpinions(f.Options.LightOpinions, f.Options.DarkOpinions)
+	if err != nil {
+		return fmt.Errorf("Error loading opinions: %v", err)
+	}
+
+	record := model.ImageSetRecord{Roles: make(map[string]*model.RoleVersionRecord)}
+	for _, instanceGroup := range instanceGroups {
+		roleRecord, err := instanceGroup.GetRoleVersionRecord(opinions, tagExtra, f.Version, f.roleImageOptions())
+		if err != nil {
+			return fmt.Errorf("Error recording version of instance group %s: %v", instanceGroup.Name, err)
+		}
+		record.Roles[instanceGroup.Name] = roleRecord
+	}
+
+	buf, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf, 0644)
+}
+
+// loadImageSetRecord reads an image set record written by WriteImageSetRecord
+func loadImageSetRecord(path string) (*model.ImageSetRecord, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var record model.ImageSetRecord
+	if err := json.Unmarshal(buf, &record); err != nil {
+		return nil, fmt.Errorf("Error reading image set record %s: %v", path, err)
+	}
+	return &record, nil
+}
+
+// CompareImageSetRecords calculates the changes between two image sets
+func CompareImageSetRecords(from, to *model.ImageSetRecord) *ImageChanges {
+	changes := &ImageChanges{
+		AddedRoles:   []string{},
+		RemovedRoles: []string{},
+		ChangedRoles: []*RoleChanges{},
+	}
+
+	for name := range from.Roles {
+		if _, ok := to.Roles[name]; !ok {
+			changes.RemovedRoles = append(changes.RemovedRoles, name)
+		}
+	}
+
+	names := make([]string, 0, len(to.Roles))
+	for name := range to.Roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		newRecord := to.Roles[name]
+		oldRecord, ok := from.Roles[name]
+		if !ok {
+			changes.AddedRoles = append(changes.AddedRoles, name)
+			continue
+		}
+		if oldRecord.DevVersion == newRecord.DevVersion {
+			continue
+		}
+
+		roleChanges := &RoleChanges{
+			Name:          name,
+			OldDevVersion: oldRecord.DevVersion,
+			NewDevVersion: newRecord.DevVersion,
+			Jobs:          compareHashes(oldRecord.Jobs, newRecord.Jobs),
+			Packages:      compareHashes(oldRecord.Packages, newRecord.Packages),
+			Scripts:       compareHashes(oldRecord.Scripts, newRecord.Scripts),
+			Templates:     compareHashes(oldRecord.Templates, newRecord.Templates),
+			Properties:    compareHashes(oldRecord.Properties, newRecord.Properties),
+		}
+		if oldRecord.FissileVersion != newRecord.FissileVersion {
+			roleChanges.FissileVersion = [2]string{oldRecord.FissileVersion, newRecord.FissileVersion}
+		}
+		if oldRecord.TagExtra != newRecord.TagExtra {
+			roleChanges.TagExtra = [2]string{oldRecord.TagExtra, newRecord.TagExtra}
+		}
+		if oldRecord.Dockerfile != newRecord.Dockerfile {
+			roleChanges.Dockerfile = [2]string{oldRecord.Dockerfile, newRecord.Dockerfile}
+		}
+		if oldRecord.Healthcheck != newRecord.Healthcheck {
+			roleChanges.Healthcheck = [2]string{oldRecord.Healthcheck, newRecord.Healthcheck}
+		}
+		for _, diffs := range []*HashDiffs{roleChanges.Jobs, roleChanges.Packages, roleChanges.Scripts, roleChanges.Templates, roleChanges.Properties} {
+			sort.Strings(diffs.AddedKeys)
+			sort.Strings(diffs.DeletedKeys)
+		}
+		changes.ChangedRoles = append(changes.ChangedRoles, roleChanges)
+	}
+
+	sort.Strings(changes.RemovedRoles)
+
+	return changes
+}
+
+// ReportImageChanges prints a report of the changes between the image sets
+// recorded in the two given files.
+func (f *Fissile) ReportImageChanges(fromPath, toPath string) error {
+	from, err := loadImageSetRecord(fromPath)
+	if err != nil {
+		return err
+	}
+	to, err := loadImageSetRecord(toPath)
+	if err != nil {
+		return err
+	}
+
+	changes := CompareImageSetRecords(from, to)
+
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman:
+		f.reportImageChangesForHuman(changes)
+	case OutputFormatJSON:
+		buf, err := json.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", f.Options.OutputFormat)
+	}
+
+	return nil
+}
+
+func (f *Fissile) reportImageChangesForHuman(changes *ImageChanges) {
+	if len(changes.AddedRoles) > 0 {
+		f.UI.Println(color.GreenString("Added instance groups:"))
+		for _, name := range changes.AddedRoles {
+			f.UI.Printf("  %s\n", name)
+		}
+	}
+	if len(changes.RemovedRoles) > 0 {
+		f.UI.Println(color.RedString("Removed instance groups:"))
+		for _, name := range changes.RemovedRoles {
+			f.UI.Printf("  %s\n", name)
+		}
+	}
+	if len(changes.ChangedRoles) == 0 {
+		if len(changes.AddedRoles) == 0 && len(changes.RemovedRoles) == 0 {
+			f.UI.Println("No changes")
+		}
+		return
+	}
+
+	f.UI.Println(color.BlueString("Changed instance groups:"))
+	for _, role := range changes.ChangedRoles {
+		f.UI.Printf("  %s (%s -> %s)\n", color.YellowString(role.Name), role.OldDevVersion, role.NewDevVersion)
+		if role.FissileVersion[0] != role.FissileVersion[1] {
+			f.UI.Printf("    fissile version: %s -> %s\n", role.FissileVersion[0], role.FissileVersion[1])
+		}
+		if role.TagExtra[0] != role.TagExtra[1] {
+			f.UI.Printf("    tag extra: %q -> %q\n", role.TagExtra[0], role.TagExtra[1])
+		}
+		if role.Dockerfile[0] != role.Dockerfile[1] {
+			f.UI.Printf("    dockerfile snippet: %q -> %q\n", role.Dockerfile[0], role.Dockerfile[1])
+		}
+		if role.Healthcheck[0] != role.Healthcheck[1] {
+			f.UI.Printf("    healthcheck: %q -> %q\n", role.Healthcheck[0], role.Healthcheck[1])
+		}
+		f.reportRoleInputChanges("jobs", role.Jobs)
+		f.reportRoleInputChanges("packages", role.Packages)
+		f.reportRoleInputChanges("scripts", role.Scripts)
+		f.reportRoleInputChanges("templates", role.Templates)
+		f.reportRoleInputChanges("properties", role.Properties)
+	}
+}
+
+// reportRoleInputChanges prints the changes of one kind of input of a role
+// dev version.  Only the keys are shown, as the values are hashes.
+func (f *Fissile) reportRoleInputChanges(kind string, diffs *HashDiffs) {
+	if len(diffs.AddedKeys) == 0 && len(diffs.DeletedKeys) == 0 && len(diffs.ChangedValues) == 0 {
+		return
+	}
+	f.UI.Printf("    %s:\n", kind)
+	for _, key := range diffs.AddedKeys {
+		f.UI.Printf("      %s %s\n", color.GreenString("added"), key)
+	}
+	for _, key := range diffs.DeletedKeys {
+		f.UI.Printf("      %s %s\n", color.RedString("removed"), key)
+	}
+	changedKeys := make([]string, 0, len(diffs.ChangedValues))
+	for key := range diffs.ChangedValues {
+		changedKeys = append(changedKeys, key)
+	}
+	sort.Strings(changedKeys)
+	for _, key := range changedKeys {
+		f.UI.Printf("      %s %s\n", color.BlueString("changed"), key)
+	}
+}
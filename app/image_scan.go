@@ -0,0 +1,365 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/builder"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/fatih/color"
+)
+
+// These are the supported formats of image scan reports
+const (
+	ScanReportFormatJSON  = "json"
+	ScanReportFormatSARIF = "sarif"
+)
+
+// scanSeverities are the severities of vulnerabilities, from the lowest to
+// the highest
+var scanSeverities = []string{"UNKNOWN", "NEGLIGIBLE", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// scanThresholds are the severities the build can fail on
+var scanThresholds = []string{"LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// ImageScanOptions contains the options to scan the role images for
+// vulnerabilities after building them
+type ImageScanOptions struct {
+	Scanner      string // The scanner to run, trivy or grype; no scan if empty
+	FailSeverity string // Fail the build on vulnerabilities of at least this severity; never if empty
+	Report       string // The path of the report; scan-report.<format> in the current directory if empty
+	ReportFormat string // ScanReportFormatJSON or ScanReportFormatSARIF
+}
+
+// ImageVulnerability is a vulnerability found in an image
+type ImageVulnerability struct {
+	ID               string `json:"id"`
+	Package          string `json:"package"`
+	InstalledVersion string `json:"installed_version"`
+	FixedVersion     string `json:"fixed_version,omitempty"`
+	Severity         string `json:"severity"`
+	Title            string `json:"title,omitempty"`
+}
+
+// ImageScanResult holds the vulnerabilities found in the image of an instance
+// group, and their number per severity
+type ImageScanResult struct {
+	InstanceGroup   string               `json:"instance_group"`
+	Image           string               `json:"image"`
+	Counts          map[string]int       `json:"counts"`
+	Vulnerabilities []ImageVulnerability `json:"vulnerabilities"`
+}
+
+// imageScanner finds the vulnerabilities of an image
+type imageScanner interface {
+	Name() string
+	Scan(image string) ([]ImageVulnerability, error)
+}
+
+// commandScanner is an imageScanner running a scanner binary that reports the
+// vulnerabilities as JSON on stdout
+type commandScanner struct {
+	command string
+	args    func(image string) []string
+	parse   func(output []byte) ([]ImageVulnerability, error)
+}
+
+// imageScanners are the supported scanners, by name
+var imageScanners = map[string]imageScanner{
+	"grype": commandScanner{
+		command: "grype",
+		args:    func(image string) []string { return []string{image, "--output", "json", "--quiet"} },
+		parse:   parseGrypeReport,
+	},
+	"trivy": commandScanner{
+		command: "trivy",
+		args:    func(image string) []string { return []string{"image", "--format", "json", "--quiet", image} },
+		parse:   parseTrivyReport,
+	},
+}
+
+// Name implements imageScanner.
+func (s commandScanner) Name() string {
+	return s.command
+}
+
+// Scan implements imageScanner.
+func (s commandScanner) Scan(image string) ([]ImageVulnerability, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(s.command, s.args(image)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("Error scanning image %s with %s: %v: %s", image, s.command, err, strings.TrimSpace(stderr.String()))
+	}
+	vulnerabilities, err := s.parse(stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the %s report of image %s: %v", s.command, image, err)
+	}
+	return vulnerabilities, nil
+}
+
+// parseTrivyReport reads the vulnerabilities of a trivy JSON report
+func parseTrivyReport(output []byte) ([]ImageVulnerability, error) {
+	var report struct {
+		Results []struct {
+			Vulnerabilities []struct {
+				VulnerabilityID  string
+				PkgName          string
+				InstalledVersion string
+				FixedVersion     string
+				Severity         string
+				Title            string
+			}
+		}
+	}
+	if err := json.Unmarshal(output, &report); err != nil {
+		return nil, err
+	}
+	var vulnerabilities []ImageVulnerability
+	for _, result := range report.Results {
+		for _, v := range result.Vulnerabilities {
+			vulnerabilities = append(vulnerabilities, ImageVulnerability{
+				ID:               v.VulnerabilityID,
+				Package:          v.PkgName,
+				InstalledVersion: v.InstalledVersion,
+				FixedVersion:     v.FixedVersion,
+				Severity:         strings.ToUpper(v.Severity),
+				Title:            v.Title,
+			})
+		}
+	}
+	return vulnerabilities, nil
+}
+
+// parseGrypeReport reads the vulnerabilities of a grype JSON report
+func parseGrypeReport(output []byte) ([]ImageVulnerability, error) {
+	var report struct {
+		Matches []struct {
+			Vulnerability struct {
+				ID          string `json:"id"`
+				Severity    string `json:"severity"`
+				Description string `json:"description"`
+				Fix         struct {
+					Versions []string `json:"versions"`
+				} `json:"fix"`
+			} `json:"vulnerability"`
+			Artifact struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			} `json:"artifact"`
+		} `json:"matches"`
+	}
+	if err := json.Unmarshal(output, &report); err != nil {
+		return nil, err
+	}
+	var vulnerabilities []ImageVulnerability
+	for _, match := range report.Matches {
+		vulnerabilities = append(vulnerabilities, ImageVulnerability{
+			ID:               match.Vulnerability.ID,
+			Package:          match.Artifact.Name,
+			InstalledVersion: match.Artifact.Version,
+			FixedVersion:     strings.Join(match.Vulnerability.Fix.Versions, ", "),
+			Severity:         strings.ToUpper(match.Vulnerability.Severity),
+			Title:            match.Vulnerability.Description,
+		})
+	}
+	return vulnerabilities, nil
+}
+
+// severityRank returns the position of the severity in scanSeverities; unknown
+// severities rank lowest
+func severityRank(severity string) int {
+	for i, candidate := range scanSeverities {
+		if candidate == severity {
+			return i
+		}
+	}
+	return 0
+}
+
+// validate checks the scan options before the images are built
+func (opt *ImageScanOptions) validate(build BuildImagesOptions) error {
+	if opt.Scanner == "" {
+		return nil
+	}
+	if _, ok := imageScanners[opt.Scanner]; !ok {
+		return fmt.Errorf("Invalid image scanner '%s', expected one of grype or trivy", opt.Scanner)
+	}
+	if build.NoBuild || build.OutputDirectory != "" {
+		return fmt.Errorf("Images can only be scanned when they are built with docker")
+	}
+	opt.FailSeverity = strings.ToUpper(opt.FailSeverity)
+	if opt.FailSeverity != "" && severityRank(opt.FailSeverity) < severityRank(scanThresholds[0]) {
+		return fmt.Errorf("Invalid scan severity '%s', expected one of %s", opt.FailSeverity, strings.ToLower(strings.Join(scanThresholds, ", ")))
+	}
+	switch opt.ReportFormat {
+	case "":
+		opt.ReportFormat = ScanReportFormatJSON
+	case ScanReportFormatJSON, ScanReportFormatSARIF:
+	default:
+		return fmt.Errorf("Invalid scan report format '%s', expected one of json or sarif", opt.ReportFormat)
+	}
+	if opt.Report == "" {
+		// The current directory is the default output directory of the
+		// other build commands
+		opt.Report = "scan-report." + opt.ReportFormat
+	}
+	return nil
+}
+
+// ScanImages scans the images of the instance groups with the scanner of the
+// options, writes the consolidated report, and prints the number of
+// vulnerabilities per instance group.  It fails if any image has
+// vulnerabilities of the severity of the options or higher.
+func (f *Fissile) ScanImages(instanceGroups model.InstanceGroups, tagExtra string, opt ImageScanOptions) error {
+	return f.scanImages(imageScanners[opt.Scanner], instanceGroups, tagExtra, opt)
+}
+
+func (f *Fissile) scanImages(scanner imageScanner, instanceGroups model.InstanceGroups, tagExtra string, opt ImageScanOptions) error {
+	opinions, err := model.NewOpinions(f.Options.LightOpinions, f.Options.DarkOpinions)
+	if err != nil {
+		return fmt.Errorf("Error loading opinions: %v", err)
+	}
+
+	var results []ImageScanResult
+	var failed []string
+	for _, instanceGroup := range instanceGroups {
+		devVersion, err := instanceGroup.GetRoleDevVersion(opinions, tagExtra, f.Version, f.roleImageOptions(), f)
+		if err != nil {
+			return err
+		}
+		image := builder.GetRoleDevImageName(f.Options.DockerRegistry, f.Options.DockerOrganization, f.Options.RepositoryPrefix, instanceGroup, devVersion)
+		f.UI.Printf("Scanning image %s with %s\n", color.CyanString(image), scanner.Name())
+		vulnerabilities, err := scanner.Scan(image)
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(vulnerabilities, func(i, j int) bool {
+			return severityRank(vulnerabilities[i].Severity) > severityRank(vulnerabilities[j].Severity)
+		})
+
+		result := ImageScanResult{
+			InstanceGroup:   instanceGroup.Name,
+			Image:           image,
+			Counts:          map[string]int{},
+			Vulnerabilities: vulnerabilities,
+		}
+		if result.Vulnerabilities == nil {
+			result.Vulnerabilities = []ImageVulnerability{}
+		}
+		failing := false
+		for _, vulnerability := range vulnerabilities {
+			result.Counts[vulnerability.Severity]++
+			if opt.FailSeverity != "" && severityRank(vulnerability.Severity) >= severityRank(opt.FailSeverity) {
+				failing = true
+			}
+		}
+		if failing {
+			failed = append(failed, instanceGroup.Name)
+		}
+		results = append(results, result)
+		f.showImageScanResult(result)
+	}
+
+	var report []byte
+	if opt.ReportFormat == ScanReportFormatSARIF {
+		report, err = json.MarshalIndent(makeSARIFReport(scanner.Name(), results), "", "  ")
+	} else {
+		report, err = json.MarshalIndent(results, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(opt.Report, report, 0644); err != nil {
+		return fmt.Errorf("Error writing scan report %s: %v", opt.Report, err)
+	}
+	f.UI.Printf("Wrote scan report %s\n", color.CyanString(opt.Report))
+
+	if len(failed) > 0 {
+		return fmt.Errorf("Images of instance groups %s have vulnerabilities of severity %s or higher",
+			strings.Join(failed, ", "), strings.ToLower(opt.FailSeverity))
+	}
+	return nil
+}
+
+// showImageScanResult prints the number of vulnerabilities of an image per
+// severity, from the highest
+func (f *Fissile) showImageScanResult(result ImageScanResult) {
+	var counts []string
+	for i := len(scanSeverities) - 1; i >= 0; i-- {
+		if count := result.Counts[scanSeverities[i]]; count > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", count, strings.ToLower(scanSeverities[i])))
+		}
+	}
+	if len(counts) == 0 {
+		f.UI.Printf("  %s: no vulnerabilities\n", result.InstanceGroup)
+		return
+	}
+	f.UI.Printf("  %s: %s\n", result.InstanceGroup, strings.Join(counts, ", "))
+}
+
+// makeSARIFReport converts the scan results into a SARIF 2.1.0 log, with a
+// rule per vulnerability and a result per vulnerable package of an image
+func makeSARIFReport(scanner string, results []ImageScanResult) map[string]interface{} {
+	ruleIndex := map[string]bool{}
+	rules := []interface{}{}
+	sarifResults := []interface{}{}
+	for _, result := range results {
+		for _, vulnerability := range result.Vulnerabilities {
+			if !ruleIndex[vulnerability.ID] {
+				ruleIndex[vulnerability.ID] = true
+				rule := map[string]interface{}{"id": vulnerability.ID}
+				if vulnerability.Title != "" {
+					rule["shortDescription"] = map[string]interface{}{"text": vulnerability.Title}
+				}
+				rules = append(rules, rule)
+			}
+			message := fmt.Sprintf("%s %s in package %s %s of instance group %s",
+				strings.ToLower(vulnerability.Severity), vulnerability.ID, vulnerability.Package,
+				vulnerability.InstalledVersion, result.InstanceGroup)
+			if vulnerability.FixedVersion != "" {
+				message += fmt.Sprintf(", fixed in %s", vulnerability.FixedVersion)
+			}
+			sarifResults = append(sarifResults, map[string]interface{}{
+				"ruleId":  vulnerability.ID,
+				"level":   sarifLevel(vulnerability.Severity),
+				"message": map[string]interface{}{"text": message},
+				"locations": []interface{}{
+					map[string]interface{}{
+						"physicalLocation": map[string]interface{}{
+							"artifactLocation": map[string]interface{}{"uri": result.Image},
+						},
+					},
+				},
+			})
+		}
+	}
+	return map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []interface{}{
+			map[string]interface{}{
+				"tool":    map[string]interface{}{"driver": map[string]interface{}{"name": scanner, "rules": rules}},
+				"results": sarifResults,
+			},
+		},
+	}
+}
+
+// sarifLevel returns the SARIF level of a vulnerability severity
+func sarifLevel(severity string) string {
+	switch {
+	case severityRank(severity) >= severityRank("HIGH"):
+		return "error"
+	case severityRank(severity) >= severityRank("MEDIUM"):
+		return "warning"
+	default:
+		return "note"
+	}
+}
@@ -0,0 +1,172 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeScanner is an imageScanner returning canned vulnerabilities per image
+// name prefix
+type fakeScanner map[string][]ImageVulnerability
+
+func (s fakeScanner) Name() string {
+	return "fake"
+}
+
+func (s fakeScanner) Scan(image string) ([]ImageVulnerability, error) {
+	for prefix, vulnerabilities := range s {
+		if strings.Contains(image, prefix) {
+			return append([]ImageVulnerability{}, vulnerabilities...), nil
+		}
+	}
+	return nil, nil
+}
+
+func TestParseTrivyReport(t *testing.T) {
+	t.Parallel()
+
+	vulnerabilities, err := parseTrivyReport([]byte(`{
+		"Results": [
+			{"Target": "image (ubuntu 18.04)", "Vulnerabilities": [
+				{"VulnerabilityID": "CVE-1", "PkgName": "openssl", "InstalledVersion": "1.1.1", "FixedVersion": "1.1.1a", "Severity": "HIGH", "Title": "Bad"}
+			]},
+			{"Target": "Ruby", "Vulnerabilities": null}
+		]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, []ImageVulnerability{
+		{ID: "CVE-1", Package: "openssl", InstalledVersion: "1.1.1", FixedVersion: "1.1.1a", Severity: "HIGH", Title: "Bad"},
+	}, vulnerabilities)
+
+	_, err = parseTrivyReport([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestParseGrypeReport(t *testing.T) {
+	t.Parallel()
+
+	vulnerabilities, err := parseGrypeReport([]byte(`{
+		"matches": [
+			{"vulnerability": {"id": "CVE-2", "severity": "Medium", "description": "Meh", "fix": {"versions": ["2.0", "1.9.1"]}},
+			 "artifact": {"name": "zlib", "version": "1.9"}}
+		]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, []ImageVulnerability{
+		{ID: "CVE-2", Package: "zlib", InstalledVersion: "1.9", FixedVersion: "2.0, 1.9.1", Severity: "MEDIUM", Title: "Meh"},
+	}, vulnerabilities)
+}
+
+func TestImageScanOptionsValidate(t *testing.T) {
+	t.Parallel()
+
+	opt := ImageScanOptions{}
+	assert.NoError(t, opt.validate(BuildImagesOptions{NoBuild: true}), "No scan, nothing to check")
+
+	opt = ImageScanOptions{Scanner: "clair"}
+	assert.EqualError(t, opt.validate(BuildImagesOptions{}), "Invalid image scanner 'clair', expected one of grype or trivy")
+
+	opt = ImageScanOptions{Scanner: "trivy"}
+	assert.EqualError(t, opt.validate(BuildImagesOptions{OutputDirectory: "/tmp"}), "Images can only be scanned when they are built with docker")
+
+	opt = ImageScanOptions{Scanner: "trivy", FailSeverity: "unknown"}
+	assert.EqualError(t, opt.validate(BuildImagesOptions{}), "Invalid scan severity 'UNKNOWN', expected one of low, medium, high, critical")
+
+	opt = ImageScanOptions{Scanner: "trivy", ReportFormat: "html"}
+	assert.EqualError(t, opt.validate(BuildImagesOptions{}), "Invalid scan report format 'html', expected one of json or sarif")
+
+	opt = ImageScanOptions{Scanner: "grype", FailSeverity: "high"}
+	require.NoError(t, opt.validate(BuildImagesOptions{}))
+	assert.Equal(t, "HIGH", opt.FailSeverity)
+	assert.Equal(t, ScanReportFormatJSON, opt.ReportFormat)
+	assert.Equal(t, "scan-report.json", opt.Report, "The report is written to the current directory by default")
+
+	opt = ImageScanOptions{Scanner: "grype", ReportFormat: ScanReportFormatSARIF, Report: "/tmp/report.json"}
+	require.NoError(t, opt.validate(BuildImagesOptions{}))
+	assert.Equal(t, "/tmp/report.json", opt.Report)
+}
+
+func TestScanImages(t *testing.T) {
+	output := &bytes.Buffer{}
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/two-roles.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	f.Options.RepositoryPrefix = "fissile"
+	f.Options.LightOpinions = filepath.Join(workDir, "../test-assets/tor-opinions/opinions.yml")
+	f.Options.DarkOpinions = filepath.Join(workDir, "../test-assets/tor-opinions/dark-opinions.yml")
+	require.NoError(t, f.LoadManifest())
+
+	f.Options.WorkDir, err = ioutil.TempDir("", "fissile-test-scan")
+	require.NoError(t, err)
+	defer os.RemoveAll(f.Options.WorkDir)
+
+	scanner := fakeScanner{
+		"myrole-clustered": {
+			{ID: "CVE-1", Package: "openssl", InstalledVersion: "1.1.1", Severity: "MEDIUM"},
+			{ID: "CVE-2", Package: "zlib", InstalledVersion: "1.9", FixedVersion: "2.0", Severity: "CRITICAL", Title: "Bad"},
+		},
+	}
+
+	opt := ImageScanOptions{Scanner: "fake", FailSeverity: "HIGH", ReportFormat: ScanReportFormatJSON,
+		Report: filepath.Join(f.Options.WorkDir, "scan-report.json")}
+	err = f.scanImages(scanner, f.Manifest.InstanceGroups, "", opt)
+	assert.EqualError(t, err, "Images of instance groups myrole-clustered have vulnerabilities of severity high or higher")
+	assert.Contains(t, output.String(), "  myrole-clustered: 1 critical, 1 medium\n")
+	assert.Contains(t, output.String(), "  myrole-deployment: no vulnerabilities\n")
+
+	buf, err := ioutil.ReadFile(opt.Report)
+	require.NoError(t, err)
+	var results []ImageScanResult
+	require.NoError(t, json.Unmarshal(buf, &results))
+	require.Len(t, results, 2)
+	assert.Equal(t, "myrole-deployment", results[0].InstanceGroup, "Results are in the order of the role manifest")
+	assert.Empty(t, results[0].Vulnerabilities)
+	assert.Equal(t, "myrole-clustered", results[1].InstanceGroup)
+	assert.Equal(t, map[string]int{"CRITICAL": 1, "MEDIUM": 1}, results[1].Counts)
+	assert.Equal(t, "CVE-2", results[1].Vulnerabilities[0].ID, "Vulnerabilities are sorted by severity")
+
+	opt = ImageScanOptions{Scanner: "fake", FailSeverity: "CRITICAL", ReportFormat: ScanReportFormatSARIF,
+		Report: filepath.Join(f.Options.WorkDir, "report.sarif")}
+	scanner["myrole-clustered"] = scanner["myrole-clustered"][:1]
+	require.NoError(t, f.scanImages(scanner, f.Manifest.InstanceGroups, "", opt))
+
+	buf, err = ioutil.ReadFile(opt.Report)
+	require.NoError(t, err)
+	var sarif struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string
+					Rules []struct{ ID string }
+				}
+			}
+			Results []struct {
+				RuleID  string
+				Level   string
+				Message struct{ Text string }
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(buf, &sarif))
+	assert.Equal(t, "2.1.0", sarif.Version)
+	require.Len(t, sarif.Runs, 1)
+	assert.Equal(t, "fake", sarif.Runs[0].Tool.Driver.Name)
+	require.Len(t, sarif.Runs[0].Results, 1)
+	assert.Equal(t, "CVE-1", sarif.Runs[0].Results[0].RuleID)
+	assert.Equal(t, "warning", sarif.Runs[0].Results[0].Level)
+	assert.Equal(t, "medium CVE-1 in package openssl 1.1.1 of instance group myrole-clustered", sarif.Runs[0].Results[0].Message.Text)
+}
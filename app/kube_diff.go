@@ -0,0 +1,211 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// KubeDiffOptions contains all option values for the `fissile kube diff` command.
+type KubeDiffOptions struct {
+	ChartDir       string
+	ValuesFiles    []string
+	Set            []string
+	ReleaseName    string
+	KubeVersion    string
+	ReleaseService string
+	Kubeconfig     string
+	Namespace      string
+}
+
+// clusterClient reads objects from a Kubernetes cluster.
+type clusterClient interface {
+	// Get returns the live object, or nil if it does not exist.
+	Get(apiVersion, kind, namespace, name string) (map[interface{}]interface{}, error)
+}
+
+// kubectlClient is a clusterClient using the kubectl command.
+type kubectlClient struct {
+	kubeconfig string
+}
+
+// Get implements clusterClient.
+func (c kubectlClient) Get(apiVersion, kind, namespace, name string) (map[interface{}]interface{}, error) {
+	args := []string{"get", kubectlResource(apiVersion, kind), name, "--output", "yaml", "--ignore-not-found"}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	if c.kubeconfig != "" {
+		args = append(args, "--kubeconfig", c.kubeconfig)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("kubectl", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("Error getting %s %s: %v: %s", kind, name, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if stdout.Len() == 0 {
+		return nil, nil
+	}
+	var object map[interface{}]interface{}
+	if err := yaml.Unmarshal(stdout.Bytes(), &object); err != nil {
+		return nil, fmt.Errorf("Error reading %s %s: %v", kind, name, err)
+	}
+	return object, nil
+}
+
+// kubectlResource qualifies the kind with the version and group of the API
+// version for kubectl, e.g. statefulset.v1.apps
+func kubectlResource(apiVersion, kind string) string {
+	resource := strings.ToLower(kind)
+	if parts := strings.SplitN(apiVersion, "/", 2); len(parts) == 2 {
+		resource = fmt.Sprintf("%s.%s.%s", resource, parts[1], parts[0])
+	}
+	return resource
+}
+
+// DiffKube renders a helm chart like `fissile helm template` and compares
+// the resulting objects with the ones in the cluster, reporting for every
+// template (and thus instance group) whether applying the chart would create
+// or change objects.
+func (f *Fissile) DiffKube(opt KubeDiffOptions) error {
+	return f.diffKube(opt, kubectlClient{kubeconfig: opt.Kubeconfig})
+}
+
+func (f *Fissile) diffKube(opt KubeDiffOptions, client clusterClient) error {
+	chart, overrides, err := loadHelmChart(opt.ChartDir, helmRenderOptions{
+		ValuesFiles:    opt.ValuesFiles,
+		Set:            opt.Set,
+		ReleaseName:    opt.ReleaseName,
+		KubeVersion:    opt.KubeVersion,
+		ReleaseService: opt.ReleaseService,
+	})
+	if err != nil {
+		return err
+	}
+	rendered, err := chart.RenderAll(overrides)
+	if err != nil {
+		return err
+	}
+
+	changedTemplates := 0
+	for _, name := range chart.TemplateNames() {
+		var report []string
+		for _, document := range rendered[name] {
+			desired, ok := document.(map[interface{}]interface{})
+			if !ok {
+				return fmt.Errorf("%s: expected a Kubernetes object, found %T", name, document)
+			}
+			apiVersion := fmt.Sprintf("%v", desired["apiVersion"])
+			kind := fmt.Sprintf("%v", desired["kind"])
+			objectName := ""
+			if metadata, ok := desired["metadata"].(map[interface{}]interface{}); ok {
+				objectName = fmt.Sprintf("%v", metadata["name"])
+			}
+
+			live, err := client.Get(apiVersion, kind, opt.Namespace, objectName)
+			if err != nil {
+				return err
+			}
+			if live == nil {
+				report = append(report, fmt.Sprintf("  %s/%s: %s", kind, objectName, color.GreenString("would be created")))
+				continue
+			}
+			for _, difference := range diffObjects("", desired, normalizeLiveObject(live)) {
+				report = append(report, fmt.Sprintf("  %s/%s: %s", kind, objectName, difference))
+			}
+		}
+
+		if len(report) == 0 {
+			f.UI.Printf("%s: %s\n", name, color.WhiteString("unchanged"))
+			continue
+		}
+		changedTemplates++
+		f.UI.Printf("%s: %s\n%s\n", name, color.YellowString("changed"), strings.Join(report, "\n"))
+	}
+
+	f.UI.Printf("%d of %d templates would change\n", changedTemplates, len(rendered))
+	return nil
+}
+
+// normalizeLiveObject removes the parts of a live object maintained by the
+// cluster, which never appear in generated objects.
+func normalizeLiveObject(live map[interface{}]interface{}) map[interface{}]interface{} {
+	delete(live, "status")
+	if metadata, ok := live["metadata"].(map[interface{}]interface{}); ok {
+		for _, key := range []string{"uid", "resourceVersion", "generation", "creationTimestamp", "selfLink", "managedFields"} {
+			delete(metadata, key)
+		}
+		if annotations, ok := metadata["annotations"].(map[interface{}]interface{}); ok {
+			delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+		}
+	}
+	return live
+}
+
+// diffObjects compares the desired value with the live one, returning a
+// description of every difference.  Fields which are only present in the live
+// value are ignored, as they are usually defaults filled in by the cluster.
+// Scalars are compared by their text, as generated charts quote most values.
+func diffObjects(path string, desired, live interface{}) []string {
+	join := func(key interface{}) string {
+		if path == "" {
+			return fmt.Sprintf("%v", key)
+		}
+		return fmt.Sprintf("%s.%v", path, key)
+	}
+
+	switch desiredValue := desired.(type) {
+	case map[interface{}]interface{}:
+		liveValue, ok := live.(map[interface{}]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: %v -> %v", path, live, desired)}
+		}
+		keys := make([]string, 0, len(desiredValue))
+		for key := range desiredValue {
+			keys = append(keys, fmt.Sprintf("%v", key))
+		}
+		sort.Strings(keys)
+		var differences []string
+		for _, key := range keys {
+			element, exists := liveValue[key]
+			if !exists {
+				if desiredValue[key] != nil {
+					differences = append(differences, fmt.Sprintf("%s: added", join(key)))
+				}
+				continue
+			}
+			differences = append(differences, diffObjects(join(key), desiredValue[key], element)...)
+		}
+		return differences
+
+	case []interface{}:
+		liveValue, ok := live.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: %v -> %v", path, live, desired)}
+		}
+		if len(liveValue) != len(desiredValue) {
+			return []string{fmt.Sprintf("%s: %d -> %d elements", path, len(liveValue), len(desiredValue))}
+		}
+		var differences []string
+		for i := range desiredValue {
+			differences = append(differences, diffObjects(fmt.Sprintf("%s[%d]", path, i), desiredValue[i], liveValue[i])...)
+		}
+		return differences
+
+	default:
+		if desired == nil || reflect.DeepEqual(desired, live) || fmt.Sprintf("%v", desired) == fmt.Sprintf("%v", live) {
+			return nil
+		}
+		return []string{fmt.Sprintf("%s: %v -> %v", path, live, desired)}
+	}
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// fakeClusterClient serves objects parsed from YAML, keyed by kind/name.
+type fakeClusterClient map[string]string
+
+func (c fakeClusterClient) Get(apiVersion, kind, namespace, name string) (map[interface{}]interface{}, error) {
+	text, ok := c[kind+"/"+name]
+	if !ok {
+		return nil, nil
+	}
+	var object map[interface{}]interface{}
+	if err := yaml.Unmarshal([]byte(text), &object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+func TestDiffKube(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+	chartDir := filepath.Join(workDir, "../test-assets/charttest/chart")
+
+	liveService := `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: example-myrelease
+  uid: 1234
+  resourceVersion: "42"
+  labels:
+    app.kubernetes.io/version: "4.5.6"
+spec:
+  clusterIP: 10.0.0.1
+  ports:
+  - port: 80
+    protocol: TCP
+  - port: 443
+    protocol: TCP
+status:
+  loadBalancer: {}
+`
+
+	t.Run("Unchanged", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+
+		err := f.diffKube(KubeDiffOptions{ChartDir: chartDir}, fakeClusterClient{
+			"Service/example-myrelease": liveService,
+		})
+		require.NoError(t, err)
+		assert.Contains(t, output.String(), "service.yaml: unchanged")
+		assert.Contains(t, output.String(), "0 of 1 templates would change")
+	})
+
+	t.Run("Changed", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+
+		err := f.diffKube(KubeDiffOptions{
+			ChartDir: chartDir,
+			Set:      []string{"services.loadbalanced=true,ports={80}"},
+		}, fakeClusterClient{
+			"Service/example-myrelease": liveService,
+		})
+		require.NoError(t, err)
+		assert.Contains(t, output.String(), "service.yaml: changed")
+		assert.Contains(t, output.String(), "Service/example-myrelease: spec.ports: 2 -> 1 elements")
+		assert.Contains(t, output.String(), "Service/example-myrelease: spec.type: added")
+		assert.Contains(t, output.String(), "ConfigMap/example-myrelease-lb: would be created")
+		assert.Contains(t, output.String(), "1 of 1 templates would change")
+	})
+
+	t.Run("ClusterError", func(t *testing.T) {
+		f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, &bytes.Buffer{}, nil))
+		err := f.diffKube(KubeDiffOptions{ChartDir: chartDir}, failingClusterClient{})
+		assert.EqualError(t, err, "cluster unreachable")
+	})
+}
+
+type failingClusterClient struct{}
+
+func (failingClusterClient) Get(apiVersion, kind, namespace, name string) (map[interface{}]interface{}, error) {
+	return nil, fmt.Errorf("cluster unreachable")
+}
+
+func TestDiffObjects(t *testing.T) {
+	assert := assert.New(t)
+
+	desired := map[interface{}]interface{}{
+		"replicas": "3",
+		"labels":   map[interface{}]interface{}{"app": "router", "removed": nil},
+		"list":     []interface{}{1, "two"},
+	}
+	live := map[interface{}]interface{}{
+		"replicas": 3,
+		"labels":   map[interface{}]interface{}{"app": "api", "extra": "default"},
+		"list":     []interface{}{1, "three"},
+	}
+	assert.Equal([]string{
+		"labels.app: api -> router",
+		"list[1]: three -> two",
+	}, diffObjects("", desired, live))
+	assert.Empty(diffObjects("", desired, desired))
+}
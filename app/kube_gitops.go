@@ -0,0 +1,115 @@
+package app
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/kube"
+	"github.com/fatih/color"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// The gitops layout is meant to be committed and applied by ArgoCD or Flux.
+// Every object is written to its own file in the output directory, listed in
+// a kustomization.yaml.  Files whose contents did not change are not
+// rewritten, and the files of objects no longer generated are removed, so
+// that the history of the repository only records actual changes.
+
+// KustomizationFileName is the name of the kustomization listing the files of
+// the objects of the gitops layout
+const KustomizationFileName = "kustomization.yaml"
+
+// kustomization is the part of a kustomization.yaml written by fissile
+type kustomization struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Resources  []string `yaml:"resources"`
+}
+
+// writeChangedFile writes a file of the current GenerateKube, unless it
+// already exists with the same contents and mode
+func (f *Fissile) writeChangedFile(outputPath string, contents []byte, mode os.FileMode) error {
+	f.recordGeneratedFile(outputPath)
+	if existing, err := ioutil.ReadFile(outputPath); err == nil && sha256.Sum256(existing) == sha256.Sum256(contents) {
+		if info, err := os.Stat(outputPath); err == nil && info.Mode().Perm() == mode {
+			if f.Options.Verbose {
+				f.UI.Printf("Unchanged config %s\n", color.CyanString(outputPath))
+			}
+			return nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	f.UI.Printf("Writing config %s\n", color.CyanString(outputPath))
+	if err := ioutil.WriteFile(outputPath, contents, mode); err != nil {
+		return err
+	}
+	// WriteFile only applies the mode to new files
+	return os.Chmod(outputPath, mode)
+}
+
+// generateKustomization writes the kustomization of the gitops layout, and
+// removes the files its previous version listed which are no longer generated
+func (f *Fissile) generateKustomization(settings kube.ExportSettings) error {
+	if settings.Layout != kube.LayoutGitOps {
+		return nil
+	}
+	outputPath := filepath.Join(settings.OutputDir, KustomizationFileName)
+
+	var resources []string
+	for path := range f.generatedFiles {
+		if filepath.Dir(path) == filepath.Clean(settings.OutputDir) && strings.HasSuffix(path, ".yaml") {
+			resources = append(resources, filepath.Base(path))
+		}
+	}
+	sort.Strings(resources)
+
+	previous, err := loadKustomization(outputPath)
+	if err != nil {
+		return err
+	}
+	for _, resource := range previous.Resources {
+		path := filepath.Join(settings.OutputDir, resource)
+		// Only remove the files of objects fissile wrote
+		if filepath.Base(resource) != resource || f.generatedFiles[path] {
+			continue
+		}
+		f.UI.Printf("Removing config %s\n", color.CyanString(path))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	contents, err := yaml.Marshal(kustomization{
+		APIVersion: "kustomize.config.k8s.io/v1beta1",
+		Kind:       "Kustomization",
+		Resources:  resources,
+	})
+	if err != nil {
+		return err
+	}
+	return f.writeChangedFile(outputPath, contents, 0644)
+}
+
+// loadKustomization reads the kustomization of a previous generation; it is
+// empty if there is none
+func loadKustomization(path string) (kustomization, error) {
+	var result kustomization
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	if err := yaml.Unmarshal(contents, &result); err != nil {
+		return result, fmt.Errorf("Error reading the kustomization %s: %v", path, err)
+	}
+	return result, nil
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/util"
+	"github.com/fatih/color"
+)
+
+// KubeJSONIndexFile is the name of the index file written by GenerateKubeJSON.
+const KubeJSONIndexFile = "index.json"
+
+// KubeJSONObject describes an object written by GenerateKubeJSON.
+type KubeJSONObject struct {
+	// Path is the path of the JSON file, relative to the output directory.
+	Path string `json:"path"`
+	// Template is the name of the helm template the object was rendered
+	// from, which is named after the instance group for role objects.
+	Template   string `json:"template"`
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+}
+
+// GenerateKubeJSON creates the Kubernetes objects with concrete values, for
+// tools that cannot use helm, like the Terraform kubernetes provider.  The
+// helm chart is generated into a temporary directory and rendered with the
+// values files; every object is then written as a minified JSON file named
+// <template>/<kind>-<name>.json in the output directory.  The index file
+// lists all objects, sorted by template and in the order of the documents of
+// each template.  The files of objects listed in the index of a previous run
+// which are no longer generated are removed.
+func (f *Fissile) GenerateKubeJSON(ctx context.Context, settings kube.ExportSettings, valuesFiles []string) error {
+	chartDir, err := ioutil.TempDir("", "fissile-kube-json")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(chartDir)
+
+	outputDir := settings.OutputDir
+	settings.OutputDir = chartDir
+	settings.CreateHelmChart = true
+	if err := f.GenerateKube(ctx, settings); err != nil {
+		return err
+	}
+
+	chart, overrides, err := loadHelmChart(chartDir, helmRenderOptions{ValuesFiles: valuesFiles})
+	if err != nil {
+		return err
+	}
+	previous, err := loadKubeJSONIndex(filepath.Join(outputDir, KubeJSONIndexFile))
+	if err != nil {
+		return err
+	}
+	// Only the JSON files are generated files of the output directory
+	f.generatedFiles = make(map[string]bool)
+	rendered, err := chart.RenderAll(overrides)
+	if err != nil {
+		return err
+	}
+
+	index := []KubeJSONObject{}
+	for _, templateName := range chart.TemplateNames() {
+		templateDir := strings.TrimSuffix(templateName, filepath.Ext(templateName))
+		for _, document := range rendered[templateName] {
+			object, ok := document.(map[interface{}]interface{})
+			if !ok {
+				return fmt.Errorf("%s: expected a Kubernetes object, found %T", templateName, document)
+			}
+			entry := KubeJSONObject{
+				Template:   templateName,
+				APIVersion: fmt.Sprintf("%v", object["apiVersion"]),
+				Kind:       fmt.Sprintf("%v", object["kind"]),
+			}
+			if metadata, ok := object["metadata"].(map[interface{}]interface{}); ok {
+				entry.Name = fmt.Sprintf("%v", metadata["name"])
+			}
+			entry.Path = filepath.ToSlash(filepath.Join(templateDir,
+				fmt.Sprintf("%s-%s.json", strings.ToLower(entry.Kind), entry.Name)))
+
+			contents, err := util.JSONMarshal(object)
+			if err != nil {
+				return fmt.Errorf("%s: %v", templateName, err)
+			}
+			if err := f.writeKubeJSONFile(outputDir, entry.Path, contents); err != nil {
+				return err
+			}
+			index = append(index, entry)
+		}
+	}
+
+	for _, entry := range previous {
+		path := filepath.Join(outputDir, filepath.FromSlash(entry.Path))
+		// Only remove the files of objects fissile wrote
+		if strings.HasPrefix(filepath.ToSlash(filepath.Clean(entry.Path)), "../") || f.generatedFiles[path] {
+			continue
+		}
+		f.UI.Printf("Removing object %s\n", color.CyanString(path))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	contents, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return f.writeKubeJSONFile(outputDir, KubeJSONIndexFile, append(contents, '\n'))
+}
+
+// writeKubeJSONFile writes a file of the current GenerateKubeJSON
+func (f *Fissile) writeKubeJSONFile(outputDir, name string, contents []byte) error {
+	outputPath := filepath.Join(outputDir, filepath.FromSlash(name))
+	f.UI.Printf("Writing object %s\n", color.CyanString(outputPath))
+	f.recordGeneratedFile(outputPath)
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outputPath, contents, 0644)
+}
+
+// loadKubeJSONIndex reads the index of a previous GenerateKubeJSON; it is
+// empty if there is none
+func loadKubeJSONIndex(path string) ([]KubeJSONObject, error) {
+	var index []KubeJSONObject
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &index); err != nil {
+		return nil, fmt.Errorf("Error reading the object index %s: %v", path, err)
+	}
+	return index, nil
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKubeJSON(t *testing.T) {
+	ui := termui.New(&bytes.Buffer{}, &bytes.Buffer{}, nil)
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", ui)
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/two-roles.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	opinions, err := model.NewOpinions(
+		filepath.Join(workDir, "../test-assets/tor-opinions/opinions.yml"),
+		filepath.Join(workDir, "../test-assets/tor-opinions/dark-opinions.yml"))
+	require.NoError(t, err)
+
+	outDir, err := ioutil.TempDir("", "fissile-test-kube-json")
+	require.NoError(t, err)
+	defer os.RemoveAll(outDir)
+
+	valuesFile := filepath.Join(outDir, "values.yaml")
+	err = ioutil.WriteFile(valuesFile, []byte("sizing:\n  myrole_clustered:\n    count: 2\n"), 0644)
+	require.NoError(t, err)
+
+	err = f.GenerateKubeJSON(context.Background(), kube.ExportSettings{
+		OutputDir: outDir,
+		Opinions:  opinions,
+	}, []string{valuesFile})
+	require.NoError(t, err)
+
+	contents, err := ioutil.ReadFile(filepath.Join(outDir, KubeJSONIndexFile))
+	require.NoError(t, err)
+	var index []KubeJSONObject
+	require.NoError(t, json.Unmarshal(contents, &index))
+
+	var statefulSet *KubeJSONObject
+	for i, entry := range index {
+		assert.FileExists(t, filepath.Join(outDir, entry.Path))
+		if entry.Kind == "StatefulSet" && entry.Name == "myrole-clustered" {
+			statefulSet = &index[i]
+		}
+	}
+	require.NotNil(t, statefulSet, "Index should list the stateful set")
+	assert.Equal(t, KubeJSONObject{
+		Path:       "myrole-clustered/statefulset-myrole-clustered.json",
+		Template:   "myrole-clustered.yaml",
+		APIVersion: "apps/v1",
+		Kind:       "StatefulSet",
+		Name:       "myrole-clustered",
+	}, *statefulSet)
+
+	contents, err = ioutil.ReadFile(filepath.Join(outDir, statefulSet.Path))
+	require.NoError(t, err)
+	assert.NotContains(t, string(contents), "\n", "Objects should be minified")
+	assert.NotContains(t, string(contents), "{{", "Objects should not contain templates")
+
+	var object struct {
+		Spec struct {
+			Replicas int `json:"replicas"`
+		} `json:"spec"`
+	}
+	require.NoError(t, json.Unmarshal(contents, &object))
+	assert.Equal(t, 2, object.Spec.Replicas, "Values file should be used")
+
+	// The objects of the previous index which are no longer generated are
+	// removed, other files are kept
+	stale := filepath.Join(outDir, "gone", "service-gone.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(stale), 0755))
+	require.NoError(t, ioutil.WriteFile(stale, []byte("{}"), 0644))
+	index = append(index, KubeJSONObject{Path: "gone/service-gone.json", Kind: "Service", Name: "gone"})
+	contents, err = json.Marshal(index)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outDir, KubeJSONIndexFile), contents, 0644))
+
+	err = f.GenerateKubeJSON(context.Background(), kube.ExportSettings{
+		OutputDir: outDir,
+		Opinions:  opinions,
+	}, []string{valuesFile})
+	require.NoError(t, err)
+	_, err = os.Stat(stale)
+	assert.True(t, os.IsNotExist(err), "Objects no longer generated are removed")
+	assert.FileExists(t, valuesFile)
+	assert.FileExists(t, filepath.Join(outDir, statefulSet.Path))
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/kube"
+	"github.com/fatih/color"
+)
+
+// validateLayout checks that the layout of the settings can be used
+func validateLayout(settings kube.ExportSettings) error {
+	switch settings.Layout {
+	case "", kube.LayoutInstanceGroup:
+		return nil
+	case kube.LayoutObject, kube.LayoutGitOps, kube.LayoutStream:
+	default:
+		return fmt.Errorf("Invalid layout '%s', expected one of instance-group, object, gitops, or stream", settings.Layout)
+	}
+	if settings.CreateHelmChart {
+		return fmt.Errorf("The %s layout cannot be used for helm charts", settings.Layout)
+	}
+	if settings.Layout == kube.LayoutStream && settings.KubeSchemaDir != "" {
+		return fmt.Errorf("The stream layout cannot be used with kube schema validation, which reads the written files")
+	}
+	if settings.Layout == kube.LayoutStream && settings.Stream == nil {
+		return fmt.Errorf("The stream layout requires a writer for the stream")
+	}
+	return nil
+}
+
+// writeKubeObjects writes every Kubernetes object of the nodes into its own
+// file in the directory, named <kind>-<name>.yaml.  The items of lists are
+// written as separate objects.  With the gitops layout, files whose contents
+// did not change are left alone.
+func (f *Fissile) writeKubeObjects(settings kube.ExportSettings, dirName string, nodes ...helm.Node) error {
+	objects := kubeObjects(nodes)
+	if len(objects) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dirName, 0755); err != nil {
+		return err
+	}
+	for _, object := range objects {
+		kind, name := kubeObjectField(object, "kind"), kubeObjectField(object, "metadata", "name")
+		if kind == "" || name == "" {
+			return fmt.Errorf("Cannot name the file of an object without kind and name in %s", dirName)
+		}
+		outputPath := filepath.Join(dirName, fmt.Sprintf("%s-%s.yaml", strings.ToLower(kind), name))
+		if f.generatedFiles[outputPath] {
+			return fmt.Errorf("Duplicate %s %s in %s", kind, name, dirName)
+		}
+		if settings.Layout == kube.LayoutGitOps {
+			var buf bytes.Buffer
+			if err := encodeHelmNodes(&buf, object); err != nil {
+				return err
+			}
+			if err := f.writeChangedFile(outputPath, buf.Bytes(), 0644); err != nil {
+				return err
+			}
+			continue
+		}
+		f.UI.Printf("Writing config %s\n", color.CyanString(outputPath))
+		f.recordGeneratedFile(outputPath)
+
+		outputFile, err := os.Create(outputPath)
+		if err != nil {
+			return err
+		}
+		err = encodeHelmNodes(outputFile, object)
+		if closeErr := outputFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kubeObjects returns the objects of the nodes, replacing lists by their items
+func kubeObjects(nodes []helm.Node) []helm.Node {
+	var objects []helm.Node
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		if kubeObjectField(node, "kind") == "List" {
+			if items := node.Get("items"); items != nil {
+				objects = append(objects, kubeObjects(items.Values())...)
+			}
+			continue
+		}
+		objects = append(objects, node)
+	}
+	return objects
+}
+
+// kubeObjectField returns the value of a scalar field of an object, or the
+// empty string if it is missing.
+func kubeObjectField(object helm.Node, names ...string) string {
+	if _, ok := object.(*helm.Mapping); !ok {
+		return ""
+	}
+	field, ok := object.Get(names...).(*helm.Scalar)
+	if !ok || field == nil {
+		return ""
+	}
+	return field.String()
+}
+
+// sortedMapKeys returns the sorted keys of a map with string keys
+func sortedMapKeys(m interface{}) []string {
+	var keys []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,219 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func layoutTestSettings(t *testing.T, output *bytes.Buffer) (*Fissile, kube.ExportSettings) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/two-roles.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	opinions, err := model.NewOpinions(
+		filepath.Join(workDir, "../test-assets/tor-opinions/opinions.yml"),
+		filepath.Join(workDir, "../test-assets/tor-opinions/dark-opinions.yml"))
+	require.NoError(t, err)
+	return f, kube.ExportSettings{Opinions: opinions}
+}
+
+func TestGenerateKubeLayoutObject(t *testing.T) {
+	f, settings := layoutTestSettings(t, &bytes.Buffer{})
+	outputDir, err := ioutil.TempDir("", "fissile-test-kube-layout")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	settings.OutputDir = outputDir
+	settings.Layout = kube.LayoutObject
+	require.NoError(t, f.GenerateKube(context.Background(), settings))
+
+	assert.FileExists(t, filepath.Join(outputDir, "bosh", "statefulset-myrole-clustered.yaml"))
+	assert.FileExists(t, filepath.Join(outputDir, "bosh", "statefulset-myrole-deployment.yaml"))
+	assert.FileExists(t, filepath.Join(outputDir, "secrets", "secret-secrets.yaml"))
+	assert.FileExists(t, filepath.Join(outputDir, "secrets", "secret-registry-credentials.yaml"))
+	_, err = os.Stat(filepath.Join(outputDir, "bosh", "myrole-clustered.yaml"))
+	assert.True(t, os.IsNotExist(err), "No files per instance group are written")
+
+	contents, err := ioutil.ReadFile(filepath.Join(outputDir, "bosh", "statefulset-myrole-clustered.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(contents), "kind: \"StatefulSet\"")
+	assert.NotContains(t, string(contents), "kind: \"Secret\"")
+}
+
+func TestKubeObjects(t *testing.T) {
+	service := helm.NewMapping("apiVersion", "v1", "kind", "Service", "metadata", helm.NewMapping("name", "svc"))
+	list := helm.NewMapping("apiVersion", "v1", "kind", "List", "items", helm.NewList(service))
+	pod := helm.NewMapping("apiVersion", "v1", "kind", "Pod", "metadata", helm.NewMapping("name", "pod"))
+
+	objects := kubeObjects([]helm.Node{list, nil, pod})
+	require.Len(t, objects, 2, "List items replace the list")
+	assert.Equal(t, "Service", kubeObjectField(objects[0], "kind"))
+	assert.Equal(t, "svc", kubeObjectField(objects[0], "metadata", "name"))
+	assert.Equal(t, "pod", kubeObjectField(objects[1], "metadata", "name"))
+	assert.Equal(t, "", kubeObjectField(objects[1], "spec"))
+}
+
+func TestGenerateKubeLayoutStream(t *testing.T) {
+	output := &bytes.Buffer{}
+	f, settings := layoutTestSettings(t, output)
+	outputDir, err := ioutil.TempDir("", "fissile-test-kube-layout")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	// Progress and other messages go to the UI, never into the stream
+	reporter, err := NewProgressReporter(ProgressPlain, output, nil)
+	require.NoError(t, err)
+	f.Events = reporter
+
+	stream := &bytes.Buffer{}
+	settings.OutputDir = outputDir
+	settings.Layout = kube.LayoutStream
+	settings.Stream = stream
+	require.NoError(t, f.GenerateKube(context.Background(), settings))
+
+	assert.Contains(t, output.String(), OperationGenerateKube+" finished")
+	assert.NotContains(t, output.String(), "kind:")
+	decoder := yaml.NewDecoder(bytes.NewReader(stream.Bytes()))
+	kinds := map[string]bool{}
+	for {
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err != nil {
+			require.Equal(t, io.EOF, err, "The stream holds nothing but YAML documents")
+			break
+		}
+		if object == nil {
+			continue
+		}
+		require.Contains(t, object, "kind", "The stream holds nothing but objects")
+		kinds[object["kind"].(string)] = true
+	}
+	assert.True(t, kinds["StatefulSet"])
+	assert.True(t, kinds["Secret"])
+	files, err := ioutil.ReadDir(outputDir)
+	require.NoError(t, err)
+	assert.Empty(t, files, "No files are written")
+
+	first := stream.String()
+	stream.Reset()
+	require.NoError(t, f.GenerateKube(context.Background(), settings))
+	assert.Equal(t, first, stream.String(), "The stream is deterministic")
+
+	settings.Stream = nil
+	err = f.GenerateKube(context.Background(), settings)
+	assert.EqualError(t, err, "The stream layout requires a writer for the stream")
+}
+
+func TestGenerateKubeLayoutInvalid(t *testing.T) {
+	f, settings := layoutTestSettings(t, &bytes.Buffer{})
+
+	settings.Layout = "bogus"
+	err := f.GenerateKube(context.Background(), settings)
+	assert.EqualError(t, err, "Invalid layout 'bogus', expected one of instance-group, object, gitops, or stream")
+
+	settings.Layout = kube.LayoutStream
+	settings.KubeSchemaDir = "schemas"
+	err = f.GenerateKube(context.Background(), settings)
+	assert.EqualError(t, err, "The stream layout cannot be used with kube schema validation, which reads the written files")
+
+	settings.Layout = kube.LayoutObject
+	settings.CreateHelmChart = true
+	err = f.GenerateKube(context.Background(), settings)
+	assert.EqualError(t, err, "The object layout cannot be used for helm charts")
+}
+
+func TestGenerateKubeLayoutGitOps(t *testing.T) {
+	output := &bytes.Buffer{}
+	f, settings := layoutTestSettings(t, output)
+	outputDir, err := ioutil.TempDir("", "fissile-test-kube-layout")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	settings.OutputDir = outputDir
+	settings.Layout = kube.LayoutGitOps
+	require.NoError(t, f.GenerateKube(context.Background(), settings))
+
+	statefulSet := filepath.Join(outputDir, "statefulset-myrole-clustered.yaml")
+	assert.FileExists(t, statefulSet)
+	assert.FileExists(t, filepath.Join(outputDir, "secret-secrets.yaml"))
+	_, err = os.Stat(filepath.Join(outputDir, "bosh"))
+	assert.True(t, os.IsNotExist(err), "All objects are written to the output directory")
+
+	index, err := loadKustomization(filepath.Join(outputDir, KustomizationFileName))
+	require.NoError(t, err)
+	assert.Equal(t, "Kustomization", index.Kind)
+	assert.Contains(t, index.Resources, "statefulset-myrole-clustered.yaml")
+	assert.Contains(t, index.Resources, "secret-secrets.yaml")
+	assert.NotContains(t, index.Resources, KustomizationFileName)
+	assert.True(t, sort.StringsAreSorted(index.Resources))
+
+	// A stale object of the previous generation is removed, and unchanged
+	// files are not rewritten
+	stale := filepath.Join(outputDir, "service-gone.yaml")
+	require.NoError(t, ioutil.WriteFile(stale, []byte("kind: Service\n"), 0644))
+	index.Resources = append(index.Resources, "service-gone.yaml")
+	indexContents, err := yaml.Marshal(index)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outputDir, KustomizationFileName), indexContents, 0644))
+	unrelated := filepath.Join(outputDir, "notes.yaml")
+	require.NoError(t, ioutil.WriteFile(unrelated, []byte("notes: kept\n"), 0644))
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(statefulSet, past, past))
+
+	output.Reset()
+	require.NoError(t, f.GenerateKube(context.Background(), settings))
+	_, err = os.Stat(stale)
+	assert.True(t, os.IsNotExist(err), "Objects no longer generated are removed")
+	assert.FileExists(t, unrelated, "Files not listed in the kustomization are kept")
+	info, err := os.Stat(statefulSet)
+	require.NoError(t, err)
+	assert.Equal(t, past, info.ModTime(), "Unchanged files are not rewritten")
+	assert.NotContains(t, output.String(), "statefulset-myrole-clustered.yaml")
+	assert.Contains(t, output.String(), "Writing config "+filepath.Join(outputDir, KustomizationFileName))
+	assert.NotContains(t, output.String(), "Writing config "+filepath.Join(outputDir, ObjectsManifestFileName))
+}
+
+func TestGenerateKubeLayoutGitOpsSchemaValidation(t *testing.T) {
+	f, settings := layoutTestSettings(t, &bytes.Buffer{})
+	outputDir, err := ioutil.TempDir("", "fissile-test-kube-layout")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	// A schema which does not allow the data of the secrets
+	schemaDir, err := ioutil.TempDir("", "fissile-test-kube-schema-strict")
+	require.NoError(t, err)
+	defer os.RemoveAll(schemaDir)
+	err = ioutil.WriteFile(filepath.Join(schemaDir, "secret-v1.json"), []byte(`{
+		"type": "object",
+		"properties": {"apiVersion": {"type": "string"}, "kind": {"type": "string"}},
+		"additionalProperties": false
+	}`), 0644)
+	require.NoError(t, err)
+
+	settings.OutputDir = outputDir
+	settings.Layout = kube.LayoutGitOps
+	settings.KubeSchemaDir = schemaDir
+	err = f.GenerateKube(context.Background(), settings)
+	if assert.Error(t, err, "The objects of the flat layout are validated") {
+		assert.Contains(t, err.Error(), "secret-secrets.yaml: Secret/secrets: metadata: Forbidden: unknown field")
+	}
+}
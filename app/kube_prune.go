@@ -0,0 +1,181 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/kube"
+)
+
+// Without a helm chart nothing removes the objects of instance groups dropped
+// from the role manifest on upgrades.  `fissile build kube` therefore writes
+// the objects it generated to an objects manifest; given the manifest of the
+// previous generation, it also writes a script deleting the objects which are
+// no longer generated.
+
+const (
+	// ObjectsManifestFileName is the name of the file listing the generated
+	// objects, one `<apiVersion> <kind> <name>` line each
+	ObjectsManifestFileName = "objects.txt"
+	// PruneScriptFileName is the name of the script deleting the objects of
+	// the previous generation which are no longer generated
+	PruneScriptFileName = "prune.sh"
+)
+
+// kubeObjectRef identifies a generated Kubernetes object
+type kubeObjectRef struct {
+	APIVersion string
+	Kind       string
+	Name       string
+}
+
+func (ref kubeObjectRef) String() string {
+	return fmt.Sprintf("%s %s %s", ref.APIVersion, ref.Kind, ref.Name)
+}
+
+// sameObject returns whether both refer to the same object.  The API version
+// is ignored, so that objects moving to another API version (e.g. from
+// extensions/v1beta1 to apps/v1) are not pruned.
+func (ref kubeObjectRef) sameObject(other kubeObjectRef) bool {
+	return ref.Kind == other.Kind && ref.Name == other.Name
+}
+
+// validatePrune checks that the settings can be used to prune objects
+func validatePrune(settings kube.ExportSettings) error {
+	if settings.PruneFrom == "" {
+		return nil
+	}
+	if settings.CreateHelmChart {
+		return fmt.Errorf("Pruning cannot be used for helm charts, which helm prunes on upgrades")
+	}
+	if settings.Layout == kube.LayoutStream {
+		return fmt.Errorf("The stream layout cannot be used with pruning, which writes files")
+	}
+	if len(settings.Roles) != 0 || len(settings.SkipRoles) != 0 {
+		return fmt.Errorf("Pruning cannot be used when selecting instance groups, as the objects of the others would be deleted")
+	}
+	return nil
+}
+
+// recordGeneratedObjects notes the objects of the nodes written by the current
+// GenerateKube, for the objects manifest
+func (f *Fissile) recordGeneratedObjects(settings kube.ExportSettings, nodes ...helm.Node) {
+	if settings.CreateHelmChart || f.generatedObjects == nil {
+		return
+	}
+	for _, object := range kubeObjects(nodes) {
+		ref := kubeObjectRef{
+			APIVersion: kubeObjectField(object, "apiVersion"),
+			Kind:       kubeObjectField(object, "kind"),
+			Name:       kubeObjectField(object, "metadata", "name"),
+		}
+		if ref.Kind != "" && ref.Name != "" {
+			f.generatedObjects[ref] = true
+		}
+	}
+}
+
+// generateObjectsManifest writes the objects manifest and, if the manifest of
+// the previous generation is given, the prune script deleting the previous
+// objects whose kind and name are no longer generated
+func (f *Fissile) generateObjectsManifest(settings kube.ExportSettings) error {
+	if settings.CreateHelmChart || settings.Layout == kube.LayoutStream {
+		return nil
+	}
+
+	objects := make([]kubeObjectRef, 0, len(f.generatedObjects))
+	for ref := range f.generatedObjects {
+		objects = append(objects, ref)
+	}
+	sortObjectRefs(objects)
+
+	var lines []string
+	for _, ref := range objects {
+		lines = append(lines, ref.String()+"\n")
+	}
+	err := f.writeChangedFile(filepath.Join(settings.OutputDir, ObjectsManifestFileName), []byte(strings.Join(lines, "")), 0644)
+	if err != nil {
+		return err
+	}
+
+	if settings.PruneFrom == "" {
+		return nil
+	}
+	previous, err := loadObjectsManifest(settings.PruneFrom)
+	if err != nil {
+		return err
+	}
+	var removed []kubeObjectRef
+	for _, ref := range previous {
+		generated := false
+		for _, object := range objects {
+			if object.sameObject(ref) {
+				generated = true
+				break
+			}
+		}
+		if !generated {
+			removed = append(removed, ref)
+		}
+	}
+	return f.writeChangedFile(filepath.Join(settings.OutputDir, PruneScriptFileName), []byte(makePruneScript(removed)), 0755)
+}
+
+// loadObjectsManifest reads the objects of an objects manifest
+func loadObjectsManifest(path string) ([]kubeObjectRef, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the objects manifest %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var objects []kubeObjectRef
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("Invalid line %d of the objects manifest %s, expected <apiVersion> <kind> <name>", lineNumber, path)
+		}
+		objects = append(objects, kubeObjectRef{APIVersion: fields[0], Kind: fields[1], Name: fields[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Error reading the objects manifest %s: %v", path, err)
+	}
+	sortObjectRefs(objects)
+	return objects, nil
+}
+
+// makePruneScript returns a shell script deleting the objects with kubectl.
+// Its arguments, e.g. --namespace, are passed on to kubectl.
+func makePruneScript(objects []kubeObjectRef) string {
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\n")
+	script.WriteString("# Deletes the objects of the previous configs which are no longer generated.\n")
+	script.WriteString("# The arguments, e.g. --namespace, are passed on to kubectl.\n")
+	script.WriteString("set -o errexit\n")
+	for _, ref := range objects {
+		fmt.Fprintf(&script, "kubectl delete %s %s --ignore-not-found \"$@\"\n", kubectlResource(ref.APIVersion, ref.Kind), ref.Name)
+	}
+	return script.String()
+}
+
+// sortObjectRefs sorts the objects by kind, name, and API version
+func sortObjectRefs(objects []kubeObjectRef) {
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].Kind != objects[j].Kind {
+			return objects[i].Kind < objects[j].Kind
+		}
+		if objects[i].Name != objects[j].Name {
+			return objects[i].Name < objects[j].Name
+		}
+		return objects[i].APIVersion < objects[j].APIVersion
+	})
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/kube"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKubePrune(t *testing.T) {
+	f, settings := layoutTestSettings(t, &bytes.Buffer{})
+	outputDir, err := ioutil.TempDir("", "fissile-test-kube-prune")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	previous := filepath.Join(outputDir, "previous-objects.txt")
+	require.NoError(t, ioutil.WriteFile(previous, []byte(
+		"apps/v1beta1 StatefulSet myrole-clustered\n"+
+			"\n"+
+			"apps/v1 StatefulSet removed-role\n"+
+			"v1 Service removed-role-set\n"), 0644))
+
+	settings.OutputDir = filepath.Join(outputDir, "configs")
+	settings.PruneFrom = previous
+	require.NoError(t, f.GenerateKube(context.Background(), settings))
+
+	objects, err := loadObjectsManifest(filepath.Join(settings.OutputDir, ObjectsManifestFileName))
+	require.NoError(t, err)
+	assert.Contains(t, objects, kubeObjectRef{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "myrole-clustered"})
+	assert.Contains(t, objects, kubeObjectRef{APIVersion: "v1", Kind: "Secret", Name: "registry-credentials"})
+	assert.NotContains(t, objects, kubeObjectRef{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "removed-role"})
+	assert.NotContains(t, objects, kubeObjectRef{APIVersion: "apps/v1beta1", Kind: "StatefulSet", Name: "myrole-clustered"})
+
+	script, err := ioutil.ReadFile(filepath.Join(settings.OutputDir, PruneScriptFileName))
+	require.NoError(t, err)
+	assert.Equal(t, `#!/bin/sh
+# Deletes the objects of the previous configs which are no longer generated.
+# The arguments, e.g. --namespace, are passed on to kubectl.
+set -o errexit
+kubectl delete service removed-role-set --ignore-not-found "$@"
+kubectl delete statefulset.v1.apps removed-role --ignore-not-found "$@"
+`, string(script))
+}
+
+func TestGenerateKubePruneInvalid(t *testing.T) {
+	f, settings := layoutTestSettings(t, &bytes.Buffer{})
+	outputDir, err := ioutil.TempDir("", "fissile-test-kube-prune")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	settings.OutputDir = outputDir
+	settings.PruneFrom = filepath.Join(outputDir, "missing.txt")
+	err = f.GenerateKube(context.Background(), settings)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Error reading the objects manifest")
+
+	settings.Layout = kube.LayoutStream
+	settings.Stream = &bytes.Buffer{}
+	err = f.GenerateKube(context.Background(), settings)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "The stream layout cannot be used with pruning")
+
+	settings.Layout = kube.LayoutInstanceGroup
+	settings.Stream = nil
+	settings.Roles = []string{"myrole-clustered"}
+	err = f.GenerateKube(context.Background(), settings)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Pruning cannot be used when selecting instance groups")
+
+	require.NoError(t, ioutil.WriteFile(settings.PruneFrom, []byte("v1 Service\n"), 0644))
+	settings.Roles = nil
+	err = f.GenerateKube(context.Background(), settings)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Invalid line 1 of the objects manifest")
+}
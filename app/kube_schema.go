@@ -0,0 +1,128 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/helm/render"
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/fatih/color"
+)
+
+// validateKubeSchemas checks the objects written by GenerateKube against the
+// Kubernetes schemas in settings.KubeSchemaDir.  Helm charts are rendered
+// with their default values first.  Each problem is reported with the file
+// that produced it, which is named after the instance group.
+func (f *Fissile) validateKubeSchemas(settings kube.ExportSettings) error {
+	validator, err := kube.NewSchemaValidator(settings.KubeSchemaDir)
+	if err != nil {
+		return err
+	}
+
+	objects, err := f.loadGeneratedObjects(settings)
+	if err != nil {
+		return err
+	}
+
+	files := make([]string, 0, len(objects))
+	for file := range objects {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var problems []string
+	unknownKinds := make(map[string]bool)
+	for _, file := range files {
+		for _, object := range objects[file] {
+			errs, known := validator.Validate(object)
+			if !known {
+				unknownKinds[objectKind(object)] = true
+				continue
+			}
+			for _, e := range errs {
+				problems = append(problems, fmt.Sprintf("%s: %s", file, e.Error()))
+			}
+		}
+	}
+
+	for _, kind := range sortedKeys(unknownKinds) {
+		f.UI.Printf("%s no schema for %s in %s, not validated\n",
+			color.YellowString("Warning:"), kind, settings.KubeSchemaDir)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("Generated objects do not match the Kubernetes schemas:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// loadGeneratedObjects returns the objects of the generated files, by the
+// path of the file relative to the output directory.
+func (f *Fissile) loadGeneratedObjects(settings kube.ExportSettings) (map[string][]interface{}, error) {
+	if settings.CreateHelmChart {
+		chart, err := render.LoadChart(settings.OutputDir)
+		if err != nil {
+			return nil, err
+		}
+		rendered, err := chart.RenderAll(nil)
+		if err != nil {
+			return nil, err
+		}
+		objects := make(map[string][]interface{}, len(rendered))
+		for name, documents := range rendered {
+			objects[filepath.Join("templates", name)] = documents
+		}
+		return objects, nil
+	}
+
+	objects := make(map[string][]interface{})
+	subDirs := []string{"secrets", "auth", string(model.RoleTypeBosh), string(model.RoleTypeBoshTask)}
+	if settings.Layout == kube.LayoutGitOps {
+		// All objects are written to the output directory itself
+		subDirs = []string{""}
+	}
+	for _, subDir := range subDirs {
+		files, err := filepath.Glob(filepath.Join(settings.OutputDir, subDir, "*.yaml"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if settings.Layout == kube.LayoutGitOps && (!f.generatedFiles[file] || filepath.Base(file) == KustomizationFileName) {
+				// Only the objects fissile wrote; the kustomization is not one
+				continue
+			}
+			contents, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			documents, err := render.ParseDocuments(contents)
+			if err != nil {
+				return nil, fmt.Errorf("Error parsing %s: %v", file, err)
+			}
+			objects[filepath.Join(subDir, filepath.Base(file))] = documents
+		}
+	}
+	return objects, nil
+}
+
+// objectKind returns the apiVersion and kind of a generated object.
+func objectKind(object interface{}) string {
+	obj, ok := object.(map[interface{}]interface{})
+	if !ok {
+		return fmt.Sprintf("%T", object)
+	}
+	return fmt.Sprintf("%v %v", obj["apiVersion"], obj["kind"])
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKubeSchemaValidation(t *testing.T) {
+	output := &bytes.Buffer{}
+	ui := termui.New(&bytes.Buffer{}, output, nil)
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", ui)
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/two-roles.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	opinions, err := model.NewOpinions(
+		filepath.Join(workDir, "../test-assets/tor-opinions/opinions.yml"),
+		filepath.Join(workDir, "../test-assets/tor-opinions/dark-opinions.yml"))
+	require.NoError(t, err)
+
+	schemaDir := filepath.Join(workDir, "../test-assets/kube-schemas")
+
+	for _, createHelmChart := range []bool{false, true} {
+		outDir, err := ioutil.TempDir("", "fissile-test-kube-schema")
+		require.NoError(t, err)
+		defer os.RemoveAll(outDir)
+
+		output.Reset()
+		err = f.GenerateKube(context.Background(), kube.ExportSettings{
+			OutputDir:       outDir,
+			CreateHelmChart: createHelmChart,
+			Opinions:        opinions,
+			KubeSchemaDir:   schemaDir,
+		})
+		assert.NoError(t, err, "helm: %v", createHelmChart)
+		assert.Contains(t, output.String(), "no schema for apps/v1 StatefulSet", "helm: %v", createHelmChart)
+	}
+
+	// A schema which does not allow the data of the secrets
+	strictDir, err := ioutil.TempDir("", "fissile-test-kube-schema-strict")
+	require.NoError(t, err)
+	defer os.RemoveAll(strictDir)
+	err = ioutil.WriteFile(filepath.Join(strictDir, "secret-v1.json"), []byte(`{
+		"type": "object",
+		"properties": {"apiVersion": {"type": "string"}, "kind": {"type": "string"}},
+		"additionalProperties": false
+	}`), 0644)
+	require.NoError(t, err)
+
+	outDir, err := ioutil.TempDir("", "fissile-test-kube-schema")
+	require.NoError(t, err)
+	defer os.RemoveAll(outDir)
+
+	err = f.GenerateKube(context.Background(), kube.ExportSettings{
+		OutputDir:     outDir,
+		Opinions:      opinions,
+		KubeSchemaDir: strictDir,
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "secrets/secrets.yaml: Secret/secrets: metadata: Forbidden: unknown field")
+	}
+}
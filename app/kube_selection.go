@@ -0,0 +1,77 @@
+package app
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/fatih/color"
+)
+
+// selectKubeInstanceGroups returns the role manifest to generate the
+// Kubernetes configs from: a copy of the manifest holding only the instance
+// groups selected by the Roles and SkipRoles settings, plus the colocated
+// containers of those.  Warnings are printed for links consumed from instance
+// groups that are left out.  The manifest is returned unchanged if no
+// selection is made.
+func (f *Fissile) selectKubeInstanceGroups(settings kube.ExportSettings) (*model.RoleManifest, error) {
+	roleManifest := settings.RoleManifest
+	if len(settings.Roles) == 0 && len(settings.SkipRoles) == 0 {
+		return roleManifest, nil
+	}
+
+	for _, name := range append(append([]string{}, settings.Roles...), settings.SkipRoles...) {
+		if roleManifest.LookupInstanceGroup(name) == nil {
+			return nil, fmt.Errorf("Unknown instance group '%s' to select", name)
+		}
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range settings.Roles {
+		selected[name] = true
+	}
+	if len(settings.Roles) == 0 {
+		for _, instanceGroup := range roleManifest.InstanceGroups {
+			if !instanceGroup.IsColocated() {
+				selected[instanceGroup.Name] = true
+			}
+		}
+	}
+	for _, name := range settings.SkipRoles {
+		delete(selected, name)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("No instance groups selected")
+	}
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		if selected[instanceGroup.Name] {
+			for _, colocated := range instanceGroup.GetColocatedRoles() {
+				selected[colocated.Name] = true
+			}
+		}
+	}
+
+	filtered := manifestWithInstanceGroups(roleManifest, selected)
+	for _, instanceGroup := range filtered.InstanceGroups {
+		for _, dependency := range linkDependencies(instanceGroup) {
+			if !selected[dependency] {
+				f.UI.Printf("%s instance group %s consumes links provided by %s, which is not generated\n",
+					color.YellowString("Warning:"), instanceGroup.Name, dependency)
+			}
+		}
+	}
+	return filtered, nil
+}
+
+// manifestWithInstanceGroups returns a copy of the role manifest holding only
+// the selected instance groups, in the order of the role manifest
+func manifestWithInstanceGroups(roleManifest *model.RoleManifest, selected map[string]bool) *model.RoleManifest {
+	filtered := *roleManifest
+	filtered.InstanceGroups = nil
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		if selected[instanceGroup.Name] {
+			filtered.InstanceGroups = append(filtered.InstanceGroups, instanceGroup)
+		}
+	}
+	return &filtered
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/kube"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKubeSelectedInstanceGroups(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	output := &bytes.Buffer{}
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/docker-compose.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/ntp-release"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	generate := func(settings kube.ExportSettings) (string, error) {
+		outputDir, err := ioutil.TempDir("", "fissile-test-kube-selection")
+		require.NoError(t, err)
+		defer os.RemoveAll(outputDir)
+		settings.OutputDir = outputDir
+		output.Reset()
+		err = f.GenerateKube(context.Background(), settings)
+		if err != nil {
+			return "", err
+		}
+
+		var files []string
+		for _, name := range []string{"server", "client", "unrelated"} {
+			if _, err := os.Stat(filepath.Join(outputDir, "bosh", name+".yaml")); err == nil {
+				files = append(files, name)
+			}
+		}
+		return filepath.Join(files...), nil
+	}
+
+	files, err := generate(kube.ExportSettings{Roles: []string{"client"}})
+	require.NoError(t, err)
+	assert.Equal(t, "client", files)
+	assert.Contains(t, output.String(), "instance group client consumes links provided by server, which is not generated")
+
+	files, err = generate(kube.ExportSettings{SkipRoles: []string{"unrelated"}})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("server", "client"), files)
+	assert.NotContains(t, output.String(), "Warning:")
+
+	files, err = generate(kube.ExportSettings{Roles: []string{"server", "client"}, SkipRoles: []string{"client"}})
+	require.NoError(t, err)
+	assert.Equal(t, "server", files)
+
+	assert.Equal(t, 4, len(f.Manifest.InstanceGroups), "The loaded role manifest is not changed")
+
+	_, err = generate(kube.ExportSettings{Roles: []string{"bogus"}})
+	assert.EqualError(t, err, "Unknown instance group 'bogus' to select")
+
+	_, err = generate(kube.ExportSettings{Roles: []string{"client"}, SkipRoles: []string{"client"}})
+	assert.EqualError(t, err, "No instance groups selected")
+}
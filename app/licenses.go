@@ -0,0 +1,73 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"code.cloudfoundry.org/fissile/builder"
+	"code.cloudfoundry.org/fissile/kube"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ShowLicenses displays the LICENSE and NOTICE files of all loaded releases
+// and of their packages
+func (f *Fissile) ShowLicenses() error {
+	if f.Manifest == nil {
+		return fmt.Errorf("Role manifest not loaded")
+	}
+
+	attributions, err := builder.CollectAttributions(f.Manifest.LoadedReleases)
+	if err != nil {
+		return err
+	}
+
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman:
+		var buf bytes.Buffer
+		if err := builder.WriteAttributions(&buf, attributions); err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf.String())
+	case OutputFormatJSON:
+		buf, err := json.Marshal(attributions)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(attributions)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", f.Options.OutputFormat)
+	}
+	return nil
+}
+
+// generateAttributions writes the licenses of the releases of the role
+// manifest and of their packages into the chart or output directory, if asked
+// for with --attributions
+func (f *Fissile) generateAttributions(settings kube.ExportSettings) error {
+	if !f.Options.Attributions {
+		return nil
+	}
+	if settings.Layout == kube.LayoutStream {
+		// There is no directory to write the attributions to
+		return nil
+	}
+
+	attributions, err := builder.CollectAttributions(settings.RoleManifest.LoadedReleases)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := builder.WriteAttributions(&buf, attributions); err != nil {
+		return err
+	}
+
+	return f.writeChangedFile(filepath.Join(settings.OutputDir, builder.AttributionsFileName), buf.Bytes(), 0644)
+}
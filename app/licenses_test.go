@@ -0,0 +1,83 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/builder"
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestPackageArchives replaces the archives of the packages of the
+// loaded releases, which are not in the test BOSH cache, with ones holding a
+// license file
+func writeTestPackageArchives(t *testing.T, f *Fissile) func() {
+	archiveDir, err := ioutil.TempDir("", "fissile-test-packages")
+	require.NoError(t, err)
+	for _, release := range f.Manifest.LoadedReleases {
+		for _, pkg := range release.Packages {
+			pkg.Path = filepath.Join(archiveDir, pkg.Name+".tgz")
+			require.NoError(t, testhelpers.WriteTarGz(pkg.Path, map[string]string{
+				"./" + pkg.Name + "/LICENSE": "license of " + pkg.Name,
+			}))
+		}
+	}
+	return func() { os.RemoveAll(archiveDir) }
+}
+
+func TestShowLicenses(t *testing.T) {
+	output := &bytes.Buffer{}
+	f, _ := layoutTestSettings(t, output)
+	defer writeTestPackageArchives(t, f)()
+
+	f.Options.OutputFormat = OutputFormatJSON
+	require.NoError(t, f.ShowLicenses())
+	var attributions []builder.Attribution
+	require.NoError(t, json.Unmarshal(output.Bytes(), &attributions))
+	require.NotEmpty(t, attributions)
+	assert.Equal(t, "tor", attributions[0].Release)
+	require.Len(t, attributions[0].Files, 1)
+	assert.Equal(t, "LICENSE", attributions[0].Files[0].Name)
+
+	output.Reset()
+	f.Options.OutputFormat = OutputFormatHuman
+	require.NoError(t, f.ShowLicenses())
+	assert.Contains(t, output.String(), "Release tor ")
+	assert.Contains(t, output.String(), attributions[0].Files[0].Contents)
+
+	f.Options.OutputFormat = "xml"
+	assert.EqualError(t, f.ShowLicenses(), "Invalid output format 'xml', expected one of human, json, or yaml")
+}
+
+func TestGenerateKubeAttributions(t *testing.T) {
+	f, settings := layoutTestSettings(t, &bytes.Buffer{})
+	outputDir, err := ioutil.TempDir("", "fissile-test-attributions")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	settings.OutputDir = outputDir
+	settings.CreateHelmChart = true
+	require.NoError(t, f.GenerateKube(context.Background(), settings))
+	_, err = os.Stat(filepath.Join(outputDir, builder.AttributionsFileName))
+	assert.True(t, os.IsNotExist(err), "Attributions are only written with --attributions")
+
+	f.Options.Attributions = true
+	err = f.GenerateKube(context.Background(), settings)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is not in the BOSH cache")
+
+	defer writeTestPackageArchives(t, f)()
+	require.NoError(t, f.GenerateKube(context.Background(), settings))
+	contents, err := ioutil.ReadFile(filepath.Join(outputDir, builder.AttributionsFileName))
+	require.NoError(t, err)
+	assert.Contains(t, string(contents), "Release tor ")
+	assert.Contains(t, string(contents), ": LICENSE\n")
+	assert.Contains(t, string(contents), ", package libevent: libevent/LICENSE\n")
+}
@@ -0,0 +1,244 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// LinkUnresolved is the resolution reported for optional consumers which were
+// not matched to any provider
+const LinkUnresolved = "unresolved"
+
+// LinkReport describes how one link consumed by a job was resolved
+type LinkReport struct {
+	InstanceGroup string              `json:"instance_group" yaml:"instance_group"`
+	Job           string              `json:"job" yaml:"job"`
+	Link          string              `json:"link,omitempty" yaml:"link,omitempty"`
+	Type          string              `json:"type,omitempty" yaml:"type,omitempty"`
+	Optional      bool                `json:"optional" yaml:"optional"`
+	Resolution    string              `json:"resolution" yaml:"resolution"`
+	Provider      *LinkReportProvider `json:"provider,omitempty" yaml:"provider,omitempty"`
+}
+
+// LinkReportProvider describes the provider a consumed link resolved to.
+// Providers outside of the role manifest have either an address, or a
+// namespace in addition to the instance group and job.
+type LinkReportProvider struct {
+	InstanceGroup string `json:"instance_group,omitempty" yaml:"instance_group,omitempty"`
+	Job           string `json:"job,omitempty" yaml:"job,omitempty"`
+	ServiceName   string `json:"service_name,omitempty" yaml:"service_name,omitempty"`
+	Address       string `json:"address,omitempty" yaml:"address,omitempty"`
+	Namespace     string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+}
+
+// String returns a short description of the provider
+func (p *LinkReportProvider) String() string {
+	switch {
+	case p.Address != "":
+		return p.Address
+	case p.Namespace != "":
+		return fmt.Sprintf("%s/%s/%s (%s)", p.Namespace, p.InstanceGroup, p.Job, p.ServiceName)
+	}
+	return fmt.Sprintf("%s/%s (%s)", p.InstanceGroup, p.Job, p.ServiceName)
+}
+
+// ShowLinks displays which provider every link consumer of the loaded role
+// manifest resolved to, and how.
+func (f *Fissile) ShowLinks() error {
+	if f.Manifest == nil {
+		return fmt.Errorf("Role manifest not loaded")
+	}
+
+	links := CollectLinks(f.Manifest)
+
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman:
+		f.showLinksForHuman(links)
+	case OutputFormatJSON:
+		buf, err := json.Marshal(links)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(links)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatDOT:
+		f.UI.Printf("%s", linksToDOT(links))
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, yaml, or dot", f.Options.OutputFormat)
+	}
+
+	return nil
+}
+
+// CollectLinks returns a report of all the links consumed by the jobs of the
+// resolved role manifest, per instance group and job, sorted by link.
+// Optional links without a provider are reported as unresolved, required
+// links can only lack a provider when ignored in the role manifest, and are
+// left out.
+func CollectLinks(roleManifest *model.RoleManifest) []LinkReport {
+	links := make([]LinkReport, 0)
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		for _, jobReference := range instanceGroup.JobReferences {
+			resolved := make(map[string]bool)
+			var jobLinks []LinkReport
+			for name, consumer := range jobReference.ResolvedConsumes {
+				resolved[name] = true
+				link := LinkReport{
+					InstanceGroup: instanceGroup.Name,
+					Job:           jobReference.Name,
+					Link:          name,
+					Type:          consumer.Type,
+					Resolution:    string(consumer.Resolution),
+				}
+				if external := consumer.External; external != nil {
+					link.Provider = &LinkReportProvider{
+						InstanceGroup: external.InstanceGroup,
+						Job:           external.Job,
+						ServiceName:   external.ServiceName,
+						Address:       external.Address,
+						Namespace:     external.Namespace,
+					}
+				} else {
+					link.Provider = &LinkReportProvider{
+						InstanceGroup: consumer.RoleName,
+						Job:           consumer.JobName,
+						ServiceName:   consumer.ServiceName,
+					}
+				}
+				jobLinks = append(jobLinks, link)
+			}
+			if jobReference.Job == nil {
+				continue
+			}
+			for _, consumer := range jobReference.Job.DesiredConsumers {
+				if consumer.Name != "" && resolved[consumer.Name] {
+					continue
+				}
+				if consumer.Name == "" && consumerResolvedByType(jobReference, consumer.Type) {
+					continue
+				}
+				if !consumer.Optional {
+					continue
+				}
+				jobLinks = append(jobLinks, LinkReport{
+					InstanceGroup: instanceGroup.Name,
+					Job:           jobReference.Name,
+					Link:          consumer.Name,
+					Type:          consumer.Type,
+					Resolution:    LinkUnresolved,
+				})
+			}
+			for i := range jobLinks {
+				jobLinks[i].Optional = consumerOptional(jobReference.Job, jobLinks[i])
+			}
+			sort.Slice(jobLinks, func(i, j int) bool {
+				if jobLinks[i].Link != jobLinks[j].Link {
+					return jobLinks[i].Link < jobLinks[j].Link
+				}
+				return jobLinks[i].Type < jobLinks[j].Type
+			})
+			links = append(links, jobLinks...)
+		}
+	}
+	return links
+}
+
+// consumerResolvedByType returns whether an unnamed consumer of the given
+// type was resolved; the resolver stores those under the provider name.
+func consumerResolvedByType(jobReference *model.JobReference, linkType string) bool {
+	for _, consumer := range jobReference.ResolvedConsumes {
+		if consumer.Type == linkType && consumer.Resolution == model.LinkResolutionType {
+			return true
+		}
+	}
+	return false
+}
+
+// consumerOptional returns whether the job spec marks the consumer of a link
+// as optional.
+func consumerOptional(job *model.Job, link LinkReport) bool {
+	if job == nil {
+		return false
+	}
+	for _, consumer := range job.DesiredConsumers {
+		if consumer.Name != "" && consumer.Name == link.Link {
+			return consumer.Optional
+		}
+		if consumer.Name == "" && consumer.Type == link.Type {
+			return consumer.Optional
+		}
+	}
+	return false
+}
+
+func (f *Fissile) showLinksForHuman(links []LinkReport) {
+	if len(links) == 0 {
+		f.UI.Println("No links")
+		return
+	}
+
+	table := termui.NewTable("Instance group", "Job", "Link", "Type", "Resolution", "Provider")
+	for _, link := range links {
+		name := link.Link
+		if name == "" {
+			name = "-"
+		}
+		resolution := link.Resolution
+		if link.Optional {
+			resolution += " (optional)"
+		}
+		provider := "-"
+		if link.Provider != nil {
+			provider = link.Provider.String()
+		}
+		table.Add(link.InstanceGroup, link.Job, name, link.Type, resolution, provider)
+	}
+
+	f.printTable(table)
+}
+
+// linksToDOT renders the links as a graphviz digraph from consumers to
+// providers.  Implicitly resolved links are dashed, and unresolved optional
+// links point to a dotted placeholder node.
+func linksToDOT(links []LinkReport) string {
+	var b strings.Builder
+	b.WriteString("digraph links {\n")
+	for _, link := range links {
+		consumer := fmt.Sprintf("%s/%s", link.InstanceGroup, link.Job)
+		label := link.Link
+		if label == "" {
+			label = link.Type
+		}
+		var target, style string
+		switch {
+		case link.Provider == nil:
+			target = fmt.Sprintf("unresolved %s", label)
+			fmt.Fprintf(&b, "  %q [style=dotted];\n", target)
+			style = "dotted"
+		case link.Provider.Address != "" || link.Provider.Namespace != "":
+			target = link.Provider.String()
+			fmt.Fprintf(&b, "  %q [shape=box];\n", target)
+			style = "solid"
+		default:
+			target = fmt.Sprintf("%s/%s", link.Provider.InstanceGroup, link.Provider.Job)
+			style = "solid"
+			if link.Resolution != string(model.LinkResolutionExplicit) {
+				style = "dashed"
+			}
+		}
+		fmt.Fprintf(&b, "  %q -> %q [label=%q, style=%s];\n", consumer, target, label, style)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShowLinks(t *testing.T) {
+	output := &bytes.Buffer{}
+	ui := termui.New(&bytes.Buffer{}, output, nil)
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", ui)
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/links.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/ntp-release"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	provider := &LinkReportProvider{InstanceGroup: "myrole", Job: "ntpd", ServiceName: "myrole-ntpd"}
+	expected := []LinkReport{
+		{InstanceGroup: "myrole", Job: "ntpd", Type: "missing", Optional: true, Resolution: LinkUnresolved},
+		{InstanceGroup: "myrole", Job: "ntpd", Link: "ntp-client", Type: "ntp", Optional: true, Resolution: "type", Provider: provider},
+		{InstanceGroup: "myrole", Job: "ntpd", Link: "ntp-server", Type: "ntpd", Resolution: "explicit", Provider: provider},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		output.Reset()
+		f.Options.OutputFormat = OutputFormatJSON
+		require.NoError(t, f.ShowLinks())
+		var actual []LinkReport
+		require.NoError(t, json.Unmarshal(output.Bytes(), &actual))
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("human", func(t *testing.T) {
+		output.Reset()
+		f.Options.OutputFormat = OutputFormatHuman
+		require.NoError(t, f.ShowLinks())
+		lines := termui.Decolorize(output.String())
+		assert.Contains(t, lines, "type (optional)")
+		assert.Contains(t, lines, "myrole/ntpd (myrole-ntpd)")
+		assert.Contains(t, lines, "unresolved (optional)")
+	})
+
+	t.Run("dot", func(t *testing.T) {
+		output.Reset()
+		f.Options.OutputFormat = OutputFormatDOT
+		require.NoError(t, f.ShowLinks())
+		assert.Equal(t, `digraph links {
+  "unresolved missing" [style=dotted];
+  "myrole/ntpd" -> "unresolved missing" [label="missing", style=dotted];
+  "myrole/ntpd" -> "myrole/ntpd" [label="ntp-client", style=dashed];
+  "myrole/ntpd" -> "myrole/ntpd" [label="ntp-server", style=solid];
+}
+`, output.String())
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		f.Options.OutputFormat = "xml"
+		assert.Error(t, f.ShowLinks())
+	})
+}
+
+func TestShowLinksNotLoaded(t *testing.T) {
+	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
+	f := NewFissileApplication(".", ui)
+	assert.Error(t, f.ShowLinks())
+}
@@ -0,0 +1,235 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/builder"
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/model"
+)
+
+// This file holds what the outputs running the role images on a single host
+// without a cluster (docker compose, systemd units) have in common.
+
+// localNamespace is the value of KUBERNETES_NAMESPACE in the containers, which
+// is taken from the pod on Kubernetes
+const localNamespace = "default"
+
+const (
+	// localDeploymentManifestName is the name of the BOSH deployment manifest
+	// written along with the outputs
+	localDeploymentManifestName = "deployment-manifest.yml"
+	// localDeploymentManifestPath is where configgin reads the deployment
+	// manifest in the containers, like the secret mounted into the pods
+	localDeploymentManifestPath = "/opt/fissile/config/" + localDeploymentManifestName
+)
+
+// writeLocalDeploymentManifest writes the BOSH deployment manifest the
+// containers mount at localDeploymentManifestPath
+func writeLocalDeploymentManifest(roleManifest *model.RoleManifest, path string) error {
+	var manifest bytes.Buffer
+	if err := helm.NewEncoder(&manifest).Encode(kube.MakeDeploymentManifest(roleManifest)); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, manifest.Bytes(), 0644)
+}
+
+// localInstanceGroups returns the instance groups to run: the named ones, the
+// instance groups providing the links they consume, and the colocated
+// containers of all of those, in the order of the role manifest.  Manual
+// tasks are only included when named.
+func localInstanceGroups(roleManifest *model.RoleManifest, names []string) (model.InstanceGroups, error) {
+	selected := make(map[string]bool)
+	var queue []*model.InstanceGroup
+	for _, name := range names {
+		instanceGroup := roleManifest.LookupInstanceGroup(name)
+		if instanceGroup == nil {
+			return nil, fmt.Errorf("Instance group %s not found", name)
+		}
+		queue = append(queue, instanceGroup)
+	}
+	if len(names) == 0 {
+		for _, instanceGroup := range roleManifest.InstanceGroups {
+			if instanceGroup.Run.FlightStage != model.FlightStageManual {
+				queue = append(queue, instanceGroup)
+			}
+		}
+	}
+
+	for len(queue) > 0 {
+		instanceGroup := queue[0]
+		queue = queue[1:]
+		if selected[instanceGroup.Name] {
+			continue
+		}
+		selected[instanceGroup.Name] = true
+		for _, dependency := range linkDependencies(instanceGroup) {
+			queue = append(queue, roleManifest.LookupInstanceGroup(dependency))
+		}
+		queue = append(queue, instanceGroup.GetColocatedRoles()...)
+	}
+
+	var result model.InstanceGroups
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		if selected[instanceGroup.Name] {
+			result = append(result, instanceGroup)
+		}
+	}
+	return result, nil
+}
+
+// linkDependencies returns the sorted names of the other instance groups
+// providing the links consumed by the jobs of the instance group
+func linkDependencies(instanceGroup *model.InstanceGroup) []string {
+	seen := map[string]bool{instanceGroup.Name: true}
+	var dependencies []string
+	for _, job := range instanceGroup.JobReferences {
+		for _, consumer := range job.ResolvedConsumes {
+			if consumer.External != nil || consumer.RoleName == "" || seen[consumer.RoleName] {
+				continue
+			}
+			seen[consumer.RoleName] = true
+			dependencies = append(dependencies, consumer.RoleName)
+		}
+	}
+	sort.Strings(dependencies)
+	return dependencies
+}
+
+// colocationParent returns the name of the instance group a colocated
+// container runs next to, or the empty string for other instance groups
+func colocationParent(instanceGroup *model.InstanceGroup) string {
+	if !instanceGroup.IsColocated() {
+		return ""
+	}
+	for _, parent := range instanceGroup.Manifest().InstanceGroups {
+		for _, colocated := range parent.ColocatedContainers() {
+			if colocated == instanceGroup.Name {
+				return parent.Name
+			}
+		}
+	}
+	return ""
+}
+
+// localImageName returns the name of the role image of the instance group
+func (f *Fissile) localImageName(instanceGroup *model.InstanceGroup, opinions *model.Opinions, tagExtra string) (string, error) {
+	devVersion, err := instanceGroup.GetRoleDevVersion(opinions, tagExtra, f.Version, f.roleImageOptions(), f)
+	if err != nil {
+		return "", fmt.Errorf("Error creating instance group checksum: %v", err)
+	}
+	return builder.GetRoleDevImageName(f.Options.DockerRegistry, f.Options.DockerOrganization, f.Options.RepositoryPrefix, instanceGroup, devVersion), nil
+}
+
+// localServiceAliases returns the names of the Kubernetes services of the
+// jobs of the instance group, which other containers use to reach it, and the
+// DNS aliases of their link providers
+func localServiceAliases(instanceGroup *model.InstanceGroup) []string {
+	var aliases []string
+	for _, job := range instanceGroup.JobReferences {
+		if len(job.ContainerProperties.BoshContainerization.Ports) > 0 {
+			aliases = append(aliases, job.ServiceName(instanceGroup.Name))
+			for _, alias := range job.ProviderAliases() {
+				aliases = append(aliases, alias.Domain)
+			}
+		}
+	}
+	return aliases
+}
+
+// localPorts returns the public ports of the instance group to publish on the
+// host, as <host port>:<container port>/<protocol>.  Colocated containers share
+// the network of their main instance group, so their ports are published by
+// the main instance group, and none by the colocated containers themselves.
+func localPorts(instanceGroup *model.InstanceGroup) []string {
+	if colocationParent(instanceGroup) != "" {
+		return nil
+	}
+	var ports []string
+	for _, group := range append(model.InstanceGroups{instanceGroup}, instanceGroup.GetColocatedRoles()...) {
+		for _, job := range group.JobReferences {
+			for _, port := range job.ContainerProperties.BoshContainerization.Ports {
+				if !port.Public {
+					continue
+				}
+				for i := 0; i < port.Count; i++ {
+					ports = append(ports, fmt.Sprintf("%d:%d/%s",
+						port.ExternalPort+i, port.InternalPort+i, strings.ToLower(port.Protocol)))
+				}
+			}
+		}
+	}
+	return ports
+}
+
+// localVolumes returns the volumes of the instance group as <source>:<path>.
+// Persistent and shared volumes are named volumes, see localVolumeName.
+func localVolumes(instanceGroup *model.InstanceGroup) []string {
+	var volumes []string
+	for _, volume := range instanceGroup.Run.Volumes {
+		switch volume.Type {
+		case model.VolumeTypePersistent, model.VolumeTypeShared:
+			volumes = append(volumes, fmt.Sprintf("%s:%s", localVolumeName(instanceGroup, volume), volume.Path))
+		case model.VolumeTypeHost:
+			volumes = append(volumes, fmt.Sprintf("%s:%s", volume.Path, volume.Path))
+		}
+	}
+	return volumes
+}
+
+// localVolumeName returns the name of the named volume for a persistent or
+// shared volume of the instance group
+func localVolumeName(instanceGroup *model.InstanceGroup, volume *model.RoleRunVolume) string {
+	if volume.Type == model.VolumeTypeShared {
+		return volume.Tag
+	}
+	return fmt.Sprintf("%s-%s", instanceGroup.Name, volume.Tag)
+}
+
+// localEnvironment returns the environment variables of the containers of the
+// instance group, as computed for Kubernetes configs, and the sorted names of
+// the secrets without a default, which must be provided by the user as there
+// is nothing to generate them.
+func localEnvironment(instanceGroup *model.InstanceGroup, settings kube.ExportSettings) (map[string]string, []string, error) {
+	envVars, err := kube.GetEnvVars(instanceGroup, settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	configs, err := instanceGroup.GetVariablesForRole()
+	if err != nil {
+		return nil, nil, err
+	}
+	configsByName := make(map[string]*model.VariableDefinition)
+	for _, config := range configs {
+		configsByName[config.Name] = config
+	}
+
+	environment := make(map[string]string)
+	var secrets []string
+	for _, envVar := range envVars {
+		switch {
+		case envVar.Name == "KUBERNETES_NAMESPACE":
+			environment[envVar.Name] = localNamespace
+		case len(envVar.Secrets) > 0:
+			config, ok := configsByName[envVar.Name]
+			if !ok {
+				// Secrets created by fissile's helpers, like the configgin token
+				continue
+			}
+			if ok, value := config.Value(); ok {
+				environment[envVar.Name] = value
+			} else {
+				secrets = append(secrets, envVar.Name)
+			}
+		default:
+			environment[envVar.Name] = envVar.Value
+		}
+	}
+	sort.Strings(secrets)
+	return environment, secrets, nil
+}
@@ -0,0 +1,196 @@
+package app
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// LockfileName is the name of the lockfile, next to the role manifest by
+// default.
+const LockfileName = "fissile.lock"
+
+// Lockfile pins the inputs of a build: the exact releases, the stemcell image
+// and the fissile version.  Building with --locked fails if any of them
+// differs, so that builds on different machines use the same inputs.
+type Lockfile struct {
+	FissileVersion string          `yaml:"fissile_version"`
+	Stemcell       *LockedStemcell `yaml:"stemcell,omitempty"`
+	Releases       []LockedRelease `yaml:"releases"`
+}
+
+// LockedStemcell is the stemcell image a build used
+type LockedStemcell struct {
+	Image  string `yaml:"image"`
+	Digest string `yaml:"digest,omitempty"`
+}
+
+// LockedRelease is a release a build used; the SHA1 is the one of its release
+// manifest, which covers the fingerprints of all jobs and packages.
+type LockedRelease struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+	Commit  string `yaml:"commit,omitempty"`
+	SHA1    string `yaml:"sha1"`
+}
+
+// LoadLockfile reads a lockfile
+func LoadLockfile(path string) (*Lockfile, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lockfile := &Lockfile{}
+	if err := yaml.Unmarshal(contents, lockfile); err != nil {
+		return nil, fmt.Errorf("Error parsing lockfile %s: %v", path, err)
+	}
+	return lockfile, nil
+}
+
+// Save writes the lockfile, through a temporary file so that an interrupted
+// write never leaves a truncated lockfile behind.
+func (l *Lockfile) Save(path string) error {
+	contents, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(path), ".fissile-lock-")
+	if err != nil {
+		return err
+	}
+	_, err = tempFile.Write(contents)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+	}
+	return err
+}
+
+// Diff returns the differences of the current inputs against the locked ones,
+// one line each.  A stemcell digest which is not known for the current build
+// (e.g. when compiling without docker) is not compared.
+func (l *Lockfile) Diff(current *Lockfile) []string {
+	var diffs []string
+	if l.FissileVersion != current.FissileVersion {
+		diffs = append(diffs, fmt.Sprintf("fissile version: locked %s, using %s", l.FissileVersion, current.FissileVersion))
+	}
+
+	if l.Stemcell != nil && current.Stemcell != nil {
+		if l.Stemcell.Image != current.Stemcell.Image {
+			diffs = append(diffs, fmt.Sprintf("stemcell image: locked %s, using %s", l.Stemcell.Image, current.Stemcell.Image))
+		} else if current.Stemcell.Digest != "" && l.Stemcell.Digest != current.Stemcell.Digest {
+			diffs = append(diffs, fmt.Sprintf("stemcell digest: locked %s, using %s", l.Stemcell.Digest, current.Stemcell.Digest))
+		}
+	} else if l.Stemcell == nil && current.Stemcell != nil {
+		diffs = append(diffs, fmt.Sprintf("stemcell image: not locked, using %s", current.Stemcell.Image))
+	}
+
+	locked := make(map[string]LockedRelease)
+	for _, release := range l.Releases {
+		locked[release.Name] = release
+	}
+	for _, release := range current.Releases {
+		lockedRelease, ok := locked[release.Name]
+		delete(locked, release.Name)
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("release %s: not locked, using version %s", release.Name, release.Version))
+		case lockedRelease.Version != release.Version:
+			diffs = append(diffs, fmt.Sprintf("release %s: locked version %s, using %s", release.Name, lockedRelease.Version, release.Version))
+		case lockedRelease.SHA1 != release.SHA1:
+			diffs = append(diffs, fmt.Sprintf("release %s: locked sha1 %s, using %s", release.Name, lockedRelease.SHA1, release.SHA1))
+		}
+	}
+	var missing []string
+	for name := range locked {
+		missing = append(missing, name)
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		diffs = append(diffs, fmt.Sprintf("release %s: locked version %s, not used", name, locked[name].Version))
+	}
+
+	return diffs
+}
+
+// DefaultLockfilePath returns the path of the lockfile for a role manifest,
+// next to it.
+func DefaultLockfilePath(roleManifestPath string) string {
+	return filepath.Join(filepath.Dir(roleManifestPath), LockfileName)
+}
+
+// currentLock returns the lockfile for the loaded releases and the given
+// stemcell image; the stemcell is omitted if no image is given.
+func (f *Fissile) currentLock(stemcellImage, stemcellDigest string) (*Lockfile, error) {
+	lockfile := &Lockfile{
+		FissileVersion: f.Version,
+		Releases:       []LockedRelease{},
+	}
+	if stemcellImage != "" {
+		lockfile.Stemcell = &LockedStemcell{Image: stemcellImage, Digest: stemcellDigest}
+	}
+	for _, release := range f.Manifest.LoadedReleases {
+		manifestContents, err := ioutil.ReadFile(release.ManifestFilePath())
+		if err != nil {
+			return nil, fmt.Errorf("Error reading manifest of release %s: %v", release.Name, err)
+		}
+		lockfile.Releases = append(lockfile.Releases, LockedRelease{
+			Name:    release.Name,
+			Version: release.Version,
+			Commit:  release.CommitHash,
+			SHA1:    fmt.Sprintf("%x", sha1.Sum(manifestContents)),
+		})
+	}
+	sort.Slice(lockfile.Releases, func(i, j int) bool {
+		return lockfile.Releases[i].Name < lockfile.Releases[j].Name
+	})
+	return lockfile, nil
+}
+
+// checkLock compares the inputs of the build with the lockfile when building
+// with --locked, in which case the lockfile must exist.  Otherwise the inputs
+// are only recorded in the lockfile, creating or refreshing it.  Nothing is
+// done without a lockfile path.
+func (f *Fissile) checkLock(stemcellImage, stemcellDigest string) error {
+	path := f.Options.Lockfile
+	if path == "" {
+		if f.Options.Locked {
+			return fmt.Errorf("Building with --locked requires a lockfile")
+		}
+		return nil
+	}
+	current, err := f.currentLock(stemcellImage, stemcellDigest)
+	if err != nil {
+		return err
+	}
+
+	if !f.Options.Locked {
+		if err := current.Save(path); err != nil {
+			return fmt.Errorf("Error writing lockfile %s: %v", path, err)
+		}
+		return nil
+	}
+
+	locked, err := LoadLockfile(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("Lockfile %s does not exist; build without --locked to create it", path)
+	}
+	if err != nil {
+		return err
+	}
+	if diffs := locked.Diff(current); len(diffs) > 0 {
+		return fmt.Errorf("Build inputs differ from lockfile %s:\n  %s", path, strings.Join(diffs, "\n  "))
+	}
+	return nil
+}
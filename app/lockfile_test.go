@@ -0,0 +1,102 @@
+package app
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockfileDiff(t *testing.T) {
+	locked := &Lockfile{
+		FissileVersion: "1.0.0",
+		Stemcell:       &LockedStemcell{Image: "stemcell:1", Digest: "sha256:aaa"},
+		Releases: []LockedRelease{
+			{Name: "cf", Version: "1", SHA1: "abc"},
+			{Name: "nats", Version: "2", SHA1: "def"},
+			{Name: "tor", Version: "3", SHA1: "ghi"},
+		},
+	}
+	assert.Empty(t, locked.Diff(locked))
+
+	current := &Lockfile{
+		FissileVersion: "1.0.1",
+		Stemcell:       &LockedStemcell{Image: "stemcell:1", Digest: "sha256:bbb"},
+		Releases: []LockedRelease{
+			{Name: "cf", Version: "1", SHA1: "xyz"},
+			{Name: "nats", Version: "3", SHA1: "def"},
+			{Name: "ntp", Version: "4", SHA1: "jkl"},
+		},
+	}
+	assert.Equal(t, []string{
+		"fissile version: locked 1.0.0, using 1.0.1",
+		"stemcell digest: locked sha256:aaa, using sha256:bbb",
+		"release cf: locked sha1 abc, using xyz",
+		"release nats: locked version 2, using 3",
+		"release ntp: not locked, using version 4",
+		"release tor: locked version 3, not used",
+	}, locked.Diff(current))
+
+	// Unknown stemcell digests are not compared
+	current = &Lockfile{
+		FissileVersion: "1.0.0",
+		Stemcell:       &LockedStemcell{Image: "stemcell:1"},
+		Releases:       locked.Releases,
+	}
+	assert.Empty(t, locked.Diff(current))
+	current.Stemcell.Image = "stemcell:2"
+	assert.Equal(t, []string{"stemcell image: locked stemcell:1, using stemcell:2"}, locked.Diff(current))
+}
+
+func TestCheckLock(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+	tempDir, err := ioutil.TempDir("", "fissile-lockfile-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	release, err := model.NewFinalRelease(filepath.Join(workDir, "../test-assets/ntp-final-release"))
+	require.NoError(t, err)
+
+	f := NewFissileApplication("1.0.0", termui.New(&bytes.Buffer{}, &bytes.Buffer{}, nil))
+	f.Manifest = &model.RoleManifest{LoadedReleases: model.Releases{release}}
+
+	require.NoError(t, f.checkLock("stemcell:1", "sha256:aaa"), "Without a lockfile path nothing is done")
+	f.Options.Locked = true
+	assert.EqualError(t, f.checkLock("stemcell:1", "sha256:aaa"), "Building with --locked requires a lockfile")
+
+	f.Options.Lockfile = filepath.Join(tempDir, LockfileName)
+	assert.EqualError(t, f.checkLock("stemcell:1", "sha256:aaa"),
+		"Lockfile "+f.Options.Lockfile+" does not exist; build without --locked to create it")
+	_, err = os.Stat(f.Options.Lockfile)
+	assert.True(t, os.IsNotExist(err), "The lockfile is not written with --locked")
+
+	f.Options.Locked = false
+	require.NoError(t, f.checkLock("stemcell:1", "sha256:aaa"), "A missing lockfile is only required with --locked")
+	lockfile, err := LoadLockfile(f.Options.Lockfile)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", lockfile.FissileVersion)
+	assert.Equal(t, &LockedStemcell{Image: "stemcell:1", Digest: "sha256:aaa"}, lockfile.Stemcell)
+	require.Len(t, lockfile.Releases, 1)
+	assert.Equal(t, "ntp", lockfile.Releases[0].Name)
+	assert.Equal(t, "4", lockfile.Releases[0].Version)
+	assert.Len(t, lockfile.Releases[0].SHA1, 40)
+
+	f.Options.Locked = true
+	assert.NoError(t, f.checkLock("stemcell:1", "sha256:aaa"))
+	f.Version = "1.0.1"
+	assert.EqualError(t, f.checkLock("stemcell:1", "sha256:aaa"),
+		"Build inputs differ from lockfile "+f.Options.Lockfile+":\n  fissile version: locked 1.0.0, using 1.0.1")
+
+	f.Options.Locked = false
+	require.NoError(t, f.checkLock("stemcell:1", "sha256:aaa"), "Without --locked, differing inputs refresh the lockfile")
+	lockfile, err = LoadLockfile(f.Options.Lockfile)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.1", lockfile.FissileVersion)
+}
@@ -0,0 +1,187 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ResolvedManifest is the role manifest as the generators see it after
+// resolution, for debugging their output: the exported model, along with the
+// global configuration templates and the properties and links of each job
+// which the exported model leaves out.  Unlike the exported model, it is not
+// a stable format.
+type ResolvedManifest struct {
+	*ExportedModel
+	Templates      map[string]string        `json:"templates"`
+	InstanceGroups []*ResolvedInstanceGroup `json:"instance_groups"`
+}
+
+// ResolvedInstanceGroup is an exported instance group with its resolved jobs
+type ResolvedInstanceGroup struct {
+	*ExportedInstanceGroup
+	Jobs []*ResolvedJob `json:"jobs"`
+}
+
+// ResolvedJob is an exported job with its properties, the links it provides,
+// and the jobs consuming them
+type ResolvedJob struct {
+	*ExportedJob
+	Properties json.RawMessage           `json:"properties,omitempty"`
+	Provides   map[string]*ResolvedLink  `json:"provides,omitempty"`
+	ConsumedBy map[string][]ResolvedLink `json:"consumed_by,omitempty"`
+}
+
+// ResolvedLink is a link provided by a job, or a consumer of it; for
+// consumers, the instance group, job, and service name are those of the
+// consumer.
+type ResolvedLink struct {
+	Type          string `json:"type,omitempty"`
+	Alias         string `json:"alias,omitempty"`
+	Shared        bool   `json:"shared,omitempty"`
+	InstanceGroup string `json:"instance_group,omitempty"`
+	Job           string `json:"job,omitempty"`
+	ServiceName   string `json:"service_name,omitempty"`
+}
+
+// NewResolvedManifest collects the resolved model of a loaded role manifest
+func NewResolvedManifest(m *model.RoleManifest, fissileVersion string) (*ResolvedManifest, error) {
+	exported, err := NewExportedModel(m, fissileVersion)
+	if err != nil {
+		return nil, err
+	}
+	resolved := &ResolvedManifest{
+		ExportedModel:  exported,
+		Templates:      map[string]string{},
+		InstanceGroups: make([]*ResolvedInstanceGroup, 0, len(exported.InstanceGroups)),
+	}
+	if m.Configuration != nil {
+		for name, template := range m.Configuration.Templates {
+			resolved.Templates[name] = template.Value
+		}
+	}
+
+	for index, instanceGroup := range m.InstanceGroups {
+		group := &ResolvedInstanceGroup{
+			ExportedInstanceGroup: exported.InstanceGroups[index],
+			Jobs:                  make([]*ResolvedJob, 0, len(instanceGroup.JobReferences)),
+		}
+		for jobIndex, jobReference := range instanceGroup.JobReferences {
+			job, err := newResolvedJob(jobReference, group.ExportedInstanceGroup.Jobs[jobIndex])
+			if err != nil {
+				return nil, fmt.Errorf("Error resolving job %s of instance group %s: %v", jobReference.Name, instanceGroup.Name, err)
+			}
+			group.Jobs = append(group.Jobs, job)
+		}
+		resolved.InstanceGroups = append(resolved.InstanceGroups, group)
+	}
+
+	return resolved, nil
+}
+
+// newResolvedJob collects the properties and provided links of an exported
+// job
+func newResolvedJob(jobReference *model.JobReference, exported *ExportedJob) (*ResolvedJob, error) {
+	job := &ResolvedJob{
+		ExportedJob: exported,
+		Provides:    map[string]*ResolvedLink{},
+		ConsumedBy:  map[string][]ResolvedLink{},
+	}
+	if properties := jobReference.ContainerProperties.Properties; len(properties) > 0 {
+		// Properties read from YAML may have maps with interface{} keys
+		buf, err := util.JSONMarshal(properties)
+		if err != nil {
+			return nil, err
+		}
+		job.Properties = buf
+	}
+	for name, provides := range jobReference.ExportedProvides {
+		job.Provides[name] = &ResolvedLink{
+			Type:          provides.Type,
+			Alias:         provides.Alias,
+			Shared:        provides.Shared,
+			InstanceGroup: provides.RoleName,
+			Job:           provides.JobName,
+			ServiceName:   provides.ServiceName,
+		}
+	}
+	for name, consumers := range jobReference.ResolvedConsumedBy {
+		links := make([]ResolvedLink, 0, len(consumers))
+		for _, consumer := range consumers {
+			links = append(links, ResolvedLink{
+				Type:          consumer.Type,
+				InstanceGroup: consumer.RoleName,
+				Job:           consumer.JobName,
+				ServiceName:   consumer.ServiceName,
+			})
+		}
+		sort.Slice(links, func(i, j int) bool {
+			if links[i].InstanceGroup != links[j].InstanceGroup {
+				return links[i].InstanceGroup < links[j].InstanceGroup
+			}
+			return links[i].Job < links[j].Job
+		})
+		job.ConsumedBy[name] = links
+	}
+	return job, nil
+}
+
+// ShowManifest displays the loaded role manifest, after decrypting it and
+// expanding its anchors, or with resolved, the model resolved from it.  Both
+// the human and yaml output formats print YAML.
+func (f *Fissile) ShowManifest(resolved bool) error {
+	if f.Manifest == nil {
+		return fmt.Errorf("Role manifest not loaded")
+	}
+
+	var data interface{}
+	if resolved {
+		manifest, err := NewResolvedManifest(f.Manifest, f.Version)
+		if err != nil {
+			return err
+		}
+		buf, err := json.Marshal(manifest)
+		if err != nil {
+			return err
+		}
+		// JSON is YAML; a map slice keeps the order of the fields
+		var fields yaml.MapSlice
+		if err := yaml.Unmarshal(buf, &fields); err != nil {
+			return err
+		}
+		data = fields
+	} else if err := yaml.Unmarshal(f.Manifest.ParsedContent(), &data); err != nil {
+		return err
+	}
+
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman, OutputFormatYAML:
+		buf, err := yaml.Marshal(data)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatJSON:
+		// Go through YAML, for the same keys as the YAML output
+		buf, err := yaml.Marshal(data)
+		if err != nil {
+			return err
+		}
+		var generic interface{}
+		if err := yaml.Unmarshal(buf, &generic); err != nil {
+			return err
+		}
+		buf, err = util.JSONMarshal(generic)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", f.Options.OutputFormat)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestShowManifest(t *testing.T) {
+	output := &bytes.Buffer{}
+	ui := termui.New(&bytes.Buffer{}, output, nil)
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", ui)
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/links.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/ntp-release"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	t.Run("resolved", func(t *testing.T) {
+		output.Reset()
+		f.Options.OutputFormat = OutputFormatJSON
+		require.NoError(t, f.ShowManifest(true))
+
+		var actual struct {
+			InstanceGroups []struct {
+				Name   string `json:"name"`
+				Memory struct {
+					Request float64 `json:"request"`
+				} `json:"memory"`
+				Run  interface{} `json:"run"`
+				Jobs []struct {
+					Name     string `json:"name"`
+					Consumes []struct {
+						Name       string              `json:"name"`
+						Resolution string              `json:"resolution"`
+						Provider   *LinkReportProvider `json:"provider"`
+					} `json:"consumes"`
+					Provides map[string]interface{} `json:"provides"`
+				} `json:"jobs"`
+			} `json:"instance_groups"`
+			SchemaVersion string `json:"schema_version"`
+		}
+		require.NoError(t, json.Unmarshal(output.Bytes(), &actual))
+		require.Len(t, actual.InstanceGroups, 1)
+		group := actual.InstanceGroups[0]
+		assert.Equal(t, "myrole", group.Name)
+		assert.Equal(t, 1.0, group.Memory.Request)
+		assert.Nil(t, group.Run, "The internal run block should not be shown")
+		assert.Equal(t, ModelSchemaVersion, actual.SchemaVersion)
+		require.Len(t, group.Jobs, 1)
+		require.Len(t, group.Jobs[0].Consumes, 3)
+		consumes := group.Jobs[0].Consumes[2]
+		assert.Equal(t, "ntp-server", consumes.Name)
+		assert.Equal(t, "explicit", consumes.Resolution)
+		require.NotNil(t, consumes.Provider)
+		assert.Equal(t, "myrole", consumes.Provider.InstanceGroup)
+		assert.Equal(t, "ntpd", consumes.Provider.Job)
+		assert.Contains(t, group.Jobs[0].Provides, "ntp-server")
+	})
+
+	t.Run("as loaded", func(t *testing.T) {
+		output.Reset()
+		f.Options.OutputFormat = OutputFormatYAML
+		require.NoError(t, f.ShowManifest(false))
+
+		var actual map[string]interface{}
+		require.NoError(t, yaml.Unmarshal(output.Bytes(), &actual))
+		assert.Contains(t, actual, "instance_groups")
+		assert.NotContains(t, actual, "features", "The role manifest should not be resolved")
+	})
+}
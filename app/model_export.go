@@ -0,0 +1,330 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+	"code.cloudfoundry.org/fissile/validation"
+)
+
+// ModelSchemaVersion identifies the version of the format of the model
+// written with --model-out, described by docs/model-schema.json.  Fields may
+// be added within a version; renaming or removing fields, or changing their
+// meaning, needs a new version.
+const ModelSchemaVersion = "fissile.model/v1"
+
+// ExportedModel is the resolved model of a role manifest in the documented,
+// stable format for external generators.  ResolvedManifest extends it with
+// more details for debugging.
+type ExportedModel struct {
+	SchemaVersion  string                   `json:"schema_version"`
+	FissileVersion string                   `json:"fissile_version"`
+	Releases       []ExportedRelease        `json:"releases"`
+	Features       map[string]bool          `json:"features"`
+	Variables      []ExportedVariable       `json:"variables"`
+	InstanceGroups []*ExportedInstanceGroup `json:"instance_groups"`
+}
+
+// ExportedRelease is a release used by the role manifest
+type ExportedRelease struct {
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	CommitHash string `json:"commit_hash,omitempty"`
+}
+
+// ExportedVariable is a variable of the role manifest
+type ExportedVariable struct {
+	Name          string          `json:"name"`
+	Kind          string          `json:"kind"`
+	Generator     string          `json:"generator,omitempty"`
+	Description   string          `json:"description,omitempty"`
+	Example       string          `json:"example,omitempty"`
+	Default       json.RawMessage `json:"default,omitempty"`
+	Internal      bool            `json:"internal"`
+	Secret        bool            `json:"secret"`
+	Required      bool            `json:"required"`
+	Immutable     bool            `json:"immutable"`
+	PreviousNames []string        `json:"previous_names,omitempty"`
+}
+
+// ExportedInstanceGroup is an instance group with its computed run settings;
+// memory is in MiB, CPU in cores.
+type ExportedInstanceGroup struct {
+	Name           string             `json:"name"`
+	Type           string             `json:"type"`
+	Description    string             `json:"description,omitempty"`
+	DefaultFeature string             `json:"default_feature,omitempty"`
+	IfFeature      string             `json:"if_feature,omitempty"`
+	UnlessFeature  string             `json:"unless_feature,omitempty"`
+	Tags           []string           `json:"tags"`
+	Scaling        *ExportedScaling   `json:"scaling,omitempty"`
+	Memory         *ExportedResources `json:"memory,omitempty"`
+	CPU            *ExportedResources `json:"cpu,omitempty"`
+	ServiceAccount string             `json:"service_account,omitempty"`
+	FlightStage    string             `json:"flight_stage,omitempty"`
+	Volumes        []ExportedVolume   `json:"volumes"`
+	Jobs           []*ExportedJob     `json:"jobs"`
+	Templates      []ExportedTemplate `json:"templates"`
+}
+
+// ExportedScaling is the number of instances of an instance group
+type ExportedScaling struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+	HA  int `json:"ha"`
+}
+
+// ExportedResources is the request and limit of memory or CPU; either may
+// be missing
+type ExportedResources struct {
+	Request *float64 `json:"request,omitempty"`
+	Limit   *float64 `json:"limit,omitempty"`
+}
+
+// ExportedVolume is a volume of an instance group; the size is in GiB
+type ExportedVolume struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	Tag  string `json:"tag"`
+	Size int    `json:"size,omitempty"`
+}
+
+// ExportedJob is a job of an instance group, with its ports and consumed links
+type ExportedJob struct {
+	Name          string         `json:"name"`
+	Release       string         `json:"release"`
+	IfFeature     string         `json:"if_feature,omitempty"`
+	UnlessFeature string         `json:"unless_feature,omitempty"`
+	Ports         []ExportedPort `json:"ports"`
+	Consumes      []ExportedLink `json:"consumes"`
+}
+
+// ExportedPort is a port exposed by a job
+type ExportedPort struct {
+	Name     string `json:"name"`
+	Protocol string `json:"protocol"`
+	Internal int    `json:"internal"`
+	External int    `json:"external"`
+	Count    int    `json:"count"`
+	Public   bool   `json:"public"`
+}
+
+// ExportedLink is a link consumed by a job.  Unresolved optional links have
+// no provider.
+type ExportedLink struct {
+	Name       string              `json:"name,omitempty"`
+	Type       string              `json:"type,omitempty"`
+	Optional   bool                `json:"optional"`
+	Resolution string              `json:"resolution"`
+	Provider   *LinkReportProvider `json:"provider,omitempty"`
+}
+
+// ExportedTemplate is a configuration template of an instance group, merged
+// with the global ones
+type ExportedTemplate struct {
+	Property string `json:"property"`
+	Value    string `json:"value"`
+	Global   bool   `json:"global"`
+}
+
+// NewExportedModel collects the resolved model of a loaded role manifest in
+// the exported format
+func NewExportedModel(m *model.RoleManifest, fissileVersion string) (*ExportedModel, error) {
+	exported := &ExportedModel{
+		SchemaVersion:  ModelSchemaVersion,
+		FissileVersion: fissileVersion,
+		Releases:       make([]ExportedRelease, 0, len(m.LoadedReleases)),
+		Features:       map[string]bool{},
+		Variables:      make([]ExportedVariable, 0, len(m.Variables)),
+		InstanceGroups: make([]*ExportedInstanceGroup, 0, len(m.InstanceGroups)),
+	}
+
+	for _, release := range m.LoadedReleases {
+		exported.Releases = append(exported.Releases, ExportedRelease{
+			Name:       release.Name,
+			Version:    release.Version,
+			CommitHash: release.CommitHash,
+		})
+	}
+	sort.Slice(exported.Releases, func(i, j int) bool {
+		return exported.Releases[i].Name < exported.Releases[j].Name
+	})
+
+	for feature, enabled := range m.Features {
+		exported.Features[feature] = enabled
+	}
+
+	for _, variable := range m.Variables {
+		kind := string(variable.CVOptions.Type)
+		if kind == "" {
+			kind = string(model.CVTypeUser)
+		}
+		var defaultValue json.RawMessage
+		if variable.CVOptions.Default != nil {
+			// Defaults read from YAML may have maps with interface{} keys
+			buf, err := util.JSONMarshal(variable.CVOptions.Default)
+			if err != nil {
+				return nil, fmt.Errorf("Error converting the default of variable %s: %v", variable.Name, err)
+			}
+			defaultValue = buf
+		}
+		exported.Variables = append(exported.Variables, ExportedVariable{
+			Name:          variable.Name,
+			Kind:          kind,
+			Generator:     variable.Type,
+			Description:   variable.CVOptions.Description,
+			Example:       variable.CVOptions.Example,
+			Default:       defaultValue,
+			Internal:      variable.CVOptions.Internal,
+			Secret:        variable.CVOptions.Secret,
+			Required:      variable.CVOptions.Required,
+			Immutable:     variable.CVOptions.Immutable,
+			PreviousNames: variable.CVOptions.PreviousNames,
+		})
+	}
+
+	links := make(map[string][]ExportedLink)
+	for _, link := range CollectLinks(m) {
+		key := link.InstanceGroup + "/" + link.Job
+		links[key] = append(links[key], ExportedLink{
+			Name:       link.Link,
+			Type:       link.Type,
+			Optional:   link.Optional,
+			Resolution: link.Resolution,
+			Provider:   link.Provider,
+		})
+	}
+
+	for _, instanceGroup := range m.InstanceGroups {
+		exported.InstanceGroups = append(exported.InstanceGroups, newExportedInstanceGroup(instanceGroup, links))
+	}
+
+	return exported, nil
+}
+
+// newExportedInstanceGroup converts an instance group to the exported
+// format; links holds the consumed links by instance group and job name.
+func newExportedInstanceGroup(instanceGroup *model.InstanceGroup, links map[string][]ExportedLink) *ExportedInstanceGroup {
+	group := &ExportedInstanceGroup{
+		Name:           instanceGroup.Name,
+		Type:           string(instanceGroup.Type),
+		Description:    instanceGroup.Description,
+		DefaultFeature: instanceGroup.DefaultFeature,
+		IfFeature:      instanceGroup.IfFeature,
+		UnlessFeature:  instanceGroup.UnlessFeature,
+		Tags:           make([]string, 0, len(instanceGroup.Tags)),
+		Volumes:        []ExportedVolume{},
+		Jobs:           make([]*ExportedJob, 0, len(instanceGroup.JobReferences)),
+		Templates:      []ExportedTemplate{},
+	}
+	for _, tag := range instanceGroup.Tags {
+		group.Tags = append(group.Tags, string(tag))
+	}
+
+	if run := instanceGroup.Run; run != nil {
+		if run.Scaling != nil {
+			group.Scaling = &ExportedScaling{Min: run.Scaling.Min, Max: run.Scaling.Max, HA: run.Scaling.HA}
+		}
+		if run.Memory != nil {
+			group.Memory = &ExportedResources{Request: int64ToFloat(run.Memory.Request), Limit: int64ToFloat(run.Memory.Limit)}
+		}
+		if run.CPU != nil {
+			group.CPU = &ExportedResources{Request: run.CPU.Request, Limit: run.CPU.Limit}
+		}
+		group.ServiceAccount = run.ServiceAccount
+		group.FlightStage = string(run.FlightStage)
+		for _, volume := range run.Volumes {
+			group.Volumes = append(group.Volumes, ExportedVolume{
+				Type: string(volume.Type),
+				Path: volume.Path,
+				Tag:  volume.Tag,
+				Size: volume.Size,
+			})
+		}
+	}
+
+	for _, jobReference := range instanceGroup.JobReferences {
+		job := &ExportedJob{
+			Name:          jobReference.Name,
+			Release:       jobReference.ReleaseName,
+			IfFeature:     jobReference.IfFeature,
+			UnlessFeature: jobReference.UnlessFeature,
+			Ports:         []ExportedPort{},
+			Consumes:      links[instanceGroup.Name+"/"+jobReference.Name],
+		}
+		if job.Consumes == nil {
+			job.Consumes = []ExportedLink{}
+		}
+		for _, port := range jobReference.ContainerProperties.BoshContainerization.Ports {
+			job.Ports = append(job.Ports, ExportedPort{
+				Name:     port.Name,
+				Protocol: port.Protocol,
+				Internal: port.InternalPort,
+				External: port.ExternalPort,
+				Count:    port.Count,
+				Public:   port.Public,
+			})
+		}
+		group.Jobs = append(group.Jobs, job)
+	}
+
+	if instanceGroup.Configuration != nil {
+		for property, template := range instanceGroup.Configuration.Templates {
+			group.Templates = append(group.Templates, ExportedTemplate{
+				Property: property,
+				Value:    template.Value,
+				Global:   template.IsGlobal,
+			})
+		}
+		sort.Slice(group.Templates, func(i, j int) bool {
+			return group.Templates[i].Property < group.Templates[j].Property
+		})
+	}
+
+	return group
+}
+
+// int64ToFloat converts an optional integer to an optional float
+func int64ToFloat(value *int64) *float64 {
+	if value == nil {
+		return nil
+	}
+	converted := float64(*value)
+	return &converted
+}
+
+// WriteModel writes the resolved model of the loaded role manifest, in the
+// exported format, as JSON to the given path.
+func (f *Fissile) WriteModel(path string) error {
+	if f.Manifest == nil {
+		return fmt.Errorf("Role manifest not loaded")
+	}
+
+	exported, err := NewExportedModel(f.Manifest, f.Version)
+	if err != nil {
+		return err
+	}
+	buf, err := json.MarshalIndent(exported, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, append(buf, '\n'), 0644); err != nil {
+		return fmt.Errorf("Error writing the model to %s: %v", path, err)
+	}
+	return nil
+}
+
+// ValidateModel checks a model written by WriteModel (as unmarshalled from
+// JSON) against a JSON schema of the exported format, like
+// docs/model-schema.json.
+func ValidateModel(schemaDocument []byte, model interface{}) (validation.ErrorList, error) {
+	var schema validation.JSONSchema
+	if err := json.Unmarshal(schemaDocument, &schema); err != nil {
+		return nil, fmt.Errorf("Error reading schema: %v", err)
+	}
+	return schema.Validate(validation.NormalizeObject(model), "(root):"), nil
+}
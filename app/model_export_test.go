@@ -0,0 +1,109 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteModel(t *testing.T) {
+	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	outDir, err := ioutil.TempDir("", "fissile-model-out")
+	require.NoError(t, err)
+	defer os.RemoveAll(outDir)
+	modelPath := filepath.Join(outDir, "model.json")
+
+	f := NewFissileApplication("1.2.3", ui)
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/secrets.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+	require.NoError(t, f.WriteModel(modelPath))
+
+	contents, err := ioutil.ReadFile(modelPath)
+	require.NoError(t, err)
+
+	t.Run("schema", func(t *testing.T) {
+		schema, err := ioutil.ReadFile(filepath.Join(workDir, "../docs/model-schema.json"))
+		require.NoError(t, err)
+		var document interface{}
+		require.NoError(t, json.Unmarshal(contents, &document))
+		errs, err := ValidateModel(schema, document)
+		require.NoError(t, err)
+		assert.Empty(t, errs.ErrorStrings(), "The model must match the documented schema")
+	})
+
+	t.Run("contents", func(t *testing.T) {
+		var exported ExportedModel
+		require.NoError(t, json.Unmarshal(contents, &exported))
+		assert.Equal(t, ModelSchemaVersion, exported.SchemaVersion)
+		assert.Equal(t, "1.2.3", exported.FissileVersion)
+		require.Len(t, exported.Releases, 1)
+		assert.Equal(t, "tor", exported.Releases[0].Name)
+
+		require.Len(t, exported.Variables, 5)
+		assert.Equal(t, ExportedVariable{
+			Name:        "CONTROL_PASSWORD",
+			Kind:        "user",
+			Generator:   "password",
+			Description: "The tor control password",
+			Secret:      true,
+		}, exported.Variables[0])
+
+		require.Len(t, exported.InstanceGroups, 2)
+		otherrole := exported.InstanceGroups[1]
+		assert.Equal(t, "otherrole", otherrole.Name)
+		require.NotNil(t, otherrole.Memory)
+		require.NotNil(t, otherrole.Memory.Request)
+		assert.Equal(t, 1.0, *otherrole.Memory.Request)
+		require.Len(t, otherrole.Jobs, 1)
+		assert.Equal(t, "tor", otherrole.Jobs[0].Name)
+		assert.Contains(t, otherrole.Templates, ExportedTemplate{
+			Property: "properties.tor.private_key",
+			Value:    "((OTHER_PRIVATE_KEY))",
+		})
+		assert.Contains(t, otherrole.Templates, ExportedTemplate{
+			Property: "properties.tor.hostname",
+			Value:    "((HOSTNAME))",
+			Global:   true,
+		})
+	})
+}
+
+func TestValidateModel(t *testing.T) {
+	schema := []byte(`{
+  "type": "object",
+  "required": ["name"],
+  "additionalProperties": false,
+  "properties": {
+    "name": {"type": "string"},
+    "count": {"type": "integer"}
+  }
+}`)
+
+	errs, err := ValidateModel(schema, map[string]interface{}{"name": "web", "count": 2.0})
+	require.NoError(t, err)
+	assert.Empty(t, errs)
+
+	errs, err = ValidateModel(schema, map[string]interface{}{"count": "two", "size": 3.0})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		`(root): name: Required value`,
+		`(root): count: Invalid value: "two": expected integer, found string`,
+		`(root): size: Forbidden: unknown field`,
+	}, errs.ErrorStrings())
+
+	_, err = ValidateModel([]byte("{"), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// memoryBallast is allocated, but never used, to make the garbage collector
+// run less often for the small heaps of short operations; see TuneGC.
+var memoryBallast []byte
+
+// TuneGC configures the garbage collector.  A positive gcPercent replaces the
+// GOGC setting.  A positive ballast (in MiB) is allocated up front; since the
+// collector runs when the heap has grown by gcPercent since the last
+// collection, this avoids frequent collections, and their pauses, while the
+// heap is still small.  The ballast is never touched, so it costs virtual
+// memory only.
+func TuneGC(gcPercent, ballast int) {
+	if gcPercent > 0 {
+		debug.SetGCPercent(gcPercent)
+	}
+	if ballast > 0 {
+		memoryBallast = make([]byte, ballast<<20)
+	}
+}
+
+// ServeProfiles serves the pprof endpoints under /debug/pprof/ at the address
+// in the background, for as long as fissile runs.  It returns the address
+// actually listened on, which differs from the given one for port 0.  Should
+// serving fail later on, a warning is written to the UI.
+func (f *Fissile) ServeProfiles(address string) (net.Addr, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("Error listening for profiling at %s: %v", address, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			f.UI.Println(color.YellowString("Warning: Stopped serving profiles at %s: %v", listener.Addr(), err))
+		}
+	}()
+	return listener.Addr(), nil
+}
+
+// MemoryUsage is the heap usage of a phase of a fissile operation
+type MemoryUsage struct {
+	Phase      string
+	Duration   time.Duration
+	HeapInUse  uint64 // bytes in use at the end of the phase
+	HeapGrowth int64  // change of the bytes in use during the phase
+	Allocated  uint64 // bytes allocated during the phase
+	GCCycles   uint32
+	GCPause    time.Duration
+}
+
+// String formats the usage for the UI
+func (usage MemoryUsage) String() string {
+	return fmt.Sprintf("%s: heap %.1f MiB (%+.1f MiB), allocated %.1f MiB, %d GC cycles pausing %v, took %v",
+		usage.Phase,
+		float64(usage.HeapInUse)/(1<<20),
+		float64(usage.HeapGrowth)/(1<<20),
+		float64(usage.Allocated)/(1<<20),
+		usage.GCCycles,
+		usage.GCPause,
+		usage.Duration.Round(time.Millisecond))
+}
+
+// measureMemory starts measuring the heap usage of a phase, and returns a
+// function which ends the measurement and returns the usage.
+func measureMemory(phase string) func() MemoryUsage {
+	start := time.Now()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	return func() MemoryUsage {
+		var after runtime.MemStats
+		runtime.ReadMemStats(&after)
+		return MemoryUsage{
+			Phase:      phase,
+			Duration:   time.Since(start),
+			HeapInUse:  after.HeapInuse,
+			HeapGrowth: int64(after.HeapInuse) - int64(before.HeapInuse),
+			Allocated:  after.TotalAlloc - before.TotalAlloc,
+			GCCycles:   after.NumGC - before.NumGC,
+			GCPause:    time.Duration(after.PauseTotalNs - before.PauseTotalNs),
+		}
+	}
+}
+
+// reportMemory starts measuring the heap usage of a phase if enabled by the
+// options, and returns a function which writes the usage to the UI.
+func (f *Fissile) reportMemory(phase string) func() {
+	if !f.Options.ReportMemory {
+		return func() {}
+	}
+	done := measureMemory(phase)
+	return func() {
+		f.UI.Println(color.MagentaString("Memory %s", done()))
+	}
+}
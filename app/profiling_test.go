@@ -0,0 +1,38 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeProfiles(t *testing.T) {
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+	addr, err := f.ServeProfiles("127.0.0.1:0")
+	require.NoError(t, err)
+
+	response, err := http.Get(fmt.Sprintf("http://%s/debug/pprof/", addr))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+}
+
+func TestReportMemory(t *testing.T) {
+	output := &bytes.Buffer{}
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+
+	f.reportMemory("quiet")()
+	assert.Empty(t, output.String())
+
+	f.Options.ReportMemory = true
+	var err error
+	f.startOperation(OperationGenerateKube)(&err)
+	assert.Contains(t, output.String(), "Memory generate-kube: heap ")
+	assert.Contains(t, output.String(), "GC cycles")
+}
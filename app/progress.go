@@ -0,0 +1,197 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// These are the supported styles of progress reports
+const (
+	ProgressPlain = "plain" // one line per step
+	ProgressFancy = "fancy" // a status line redrawn in place, for terminals
+	ProgressJSON  = "json"  // one JSON object per event
+)
+
+// progressBarWidth is the number of characters of the fancy progress bar
+const progressBarWidth = 30
+
+// ProgressReporter is an EventHandler reporting the progress of operations,
+// with an estimate of the remaining time.  The estimate uses the average time
+// per step of the running operation; before the first step completes, it uses
+// the time per step of past runs, which is kept in the timing database.
+type ProgressReporter struct {
+	style   string
+	writer  io.Writer
+	timings *TimingDatabase
+	now     func() time.Time
+
+	mutex      sync.Mutex
+	operations map[string]*operationProgress
+}
+
+// operationProgress is the state of a running operation
+type operationProgress struct {
+	started time.Time
+	done    int
+	total   int
+}
+
+// progressRecord is what the JSON style writes for every event
+type progressRecord struct {
+	Type      EventType `json:"type"`
+	Operation string    `json:"operation"`
+	Subject   string    `json:"subject,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Done      int       `json:"done,omitempty"`
+	Total     int       `json:"total,omitempty"`
+	Elapsed   float64   `json:"elapsed"`
+	ETA       float64   `json:"eta,omitempty"`
+}
+
+// NewProgressReporter returns a reporter writing progress in the given style.
+// The time per step of finished operations is recorded in the timing
+// database, which may be nil.
+func NewProgressReporter(style string, writer io.Writer, timings *TimingDatabase) (*ProgressReporter, error) {
+	switch style {
+	case ProgressPlain, ProgressFancy, ProgressJSON:
+	default:
+		return nil, fmt.Errorf("Invalid progress style '%s', expected one of plain, fancy, or json", style)
+	}
+
+	return &ProgressReporter{
+		style:      style,
+		writer:     writer,
+		timings:    timings,
+		now:        time.Now,
+		operations: make(map[string]*operationProgress),
+	}, nil
+}
+
+// HandleEvent implements EventHandler
+func (p *ProgressReporter) HandleEvent(event Event) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.now()
+	operation, ok := p.operations[event.Operation]
+	if !ok || event.Type == EventStarted {
+		operation = &operationProgress{started: now}
+		p.operations[event.Operation] = operation
+	}
+	if event.Type == EventProgress {
+		operation.done = event.Done
+		operation.total = event.Total
+	}
+	elapsed := now.Sub(operation.started)
+	eta, hasETA := p.estimate(event.Operation, operation, elapsed)
+
+	switch p.style {
+	case ProgressJSON:
+		record := progressRecord{
+			Type:      event.Type,
+			Operation: event.Operation,
+			Subject:   event.Subject,
+			Message:   event.Message,
+			Done:      event.Done,
+			Total:     event.Total,
+			Elapsed:   elapsed.Seconds(),
+		}
+		if event.Err != nil {
+			record.Error = event.Err.Error()
+		}
+		if hasETA && event.Type == EventProgress {
+			record.ETA = eta.Seconds()
+		}
+		if buf, err := json.Marshal(record); err == nil {
+			fmt.Fprintf(p.writer, "%s\n", buf)
+		}
+	case ProgressPlain:
+		if line := p.describe(event, elapsed, eta, hasETA); line != "" {
+			fmt.Fprintln(p.writer, line)
+		}
+	case ProgressFancy:
+		switch event.Type {
+		case EventProgress:
+			fmt.Fprintf(p.writer, "\r\033[K%s", p.statusLine(event, elapsed, eta, hasETA))
+		case EventFinished, EventFailed:
+			fmt.Fprintf(p.writer, "\r\033[K%s\n", p.describe(event, elapsed, eta, hasETA))
+		}
+	}
+
+	if event.Type == EventFinished || event.Type == EventFailed {
+		if event.Type == EventFinished && operation.done > 0 {
+			p.timings.RecordStep(event.Operation, elapsed/time.Duration(operation.done))
+			// Failing to save only loses the estimate of the next run
+			_ = p.timings.Save()
+		}
+		delete(p.operations, event.Operation)
+	}
+}
+
+// estimate returns the remaining time of the operation, if it can be
+// estimated.
+func (p *ProgressReporter) estimate(name string, operation *operationProgress, elapsed time.Duration) (time.Duration, bool) {
+	if operation.total == 0 {
+		return 0, false
+	}
+	var perStep time.Duration
+	if operation.done > 0 {
+		perStep = elapsed / time.Duration(operation.done)
+	} else if historical, ok := p.timings.EstimateStep(name); ok {
+		perStep = historical
+	} else {
+		return 0, false
+	}
+	return perStep * time.Duration(operation.total-operation.done), true
+}
+
+// describe returns the plain text line for an event, or the empty string if
+// the event is not reported.
+func (p *ProgressReporter) describe(event Event, elapsed, eta time.Duration, hasETA bool) string {
+	switch event.Type {
+	case EventStarted:
+		return fmt.Sprintf("%s started", event.Operation)
+	case EventProgress:
+		line := fmt.Sprintf("%s: %s %s", event.Operation, event.Subject, event.Message)
+		if event.Total > 0 {
+			line = fmt.Sprintf("[%d/%d] %s", event.Done, event.Total, line)
+		}
+		if hasETA {
+			line = fmt.Sprintf("%s (ETA %s)", line, roundDuration(eta))
+		}
+		return line
+	case EventFinished:
+		return color.GreenString("%s finished in %s", event.Operation, roundDuration(elapsed))
+	case EventFailed:
+		return color.RedString("%s failed after %s", event.Operation, roundDuration(elapsed))
+	}
+	return ""
+}
+
+// statusLine returns the status line of the fancy style for a progress event
+func (p *ProgressReporter) statusLine(event Event, elapsed, eta time.Duration, hasETA bool) string {
+	bar := ""
+	if event.Total > 0 {
+		filled := progressBarWidth * event.Done / event.Total
+		bar = fmt.Sprintf("[%s%s] %d/%d ",
+			strings.Repeat("=", filled),
+			strings.Repeat(" ", progressBarWidth-filled),
+			event.Done, event.Total)
+	}
+	line := fmt.Sprintf("%s%s %s, elapsed %s", bar, color.CyanString(event.Operation), event.Subject, roundDuration(elapsed))
+	if hasETA {
+		line = fmt.Sprintf("%s, ETA %s", line, roundDuration(eta))
+	}
+	return line
+}
+
+func roundDuration(duration time.Duration) time.Duration {
+	return duration.Round(time.Second)
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock returns a clock for ProgressReporter.now, and a function
+// advancing it.
+func fakeClock() (func() time.Time, func(time.Duration)) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time { return now }, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestNewProgressReporterInvalidStyle(t *testing.T) {
+	_, err := NewProgressReporter("bogus", &bytes.Buffer{}, nil)
+	assert.EqualError(t, err, "Invalid progress style 'bogus', expected one of plain, fancy, or json")
+}
+
+func TestProgressReporterPlain(t *testing.T) {
+	color.NoColor = true
+
+	workDir, err := ioutil.TempDir("", "fissile-progress-")
+	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
+	timingsPath := filepath.Join(workDir, timingsFileName)
+	timings, err := LoadTimingDatabase(timingsPath)
+	require.NoError(t, err)
+
+	output := &bytes.Buffer{}
+	reporter, err := NewProgressReporter(ProgressPlain, output, timings)
+	require.NoError(t, err)
+	now, advance := fakeClock()
+	reporter.now = now
+
+	reporter.HandleEvent(Event{Type: EventStarted, Operation: OperationCompile})
+	advance(10 * time.Second)
+	reporter.HandleEvent(Event{Type: EventProgress, Operation: OperationCompile, Subject: "rel/one", Message: "compiled", Done: 1, Total: 4})
+	advance(10 * time.Second)
+	reporter.HandleEvent(Event{Type: EventProgress, Operation: OperationCompile, Subject: "rel/two", Message: "compiled", Done: 2, Total: 4})
+	advance(20 * time.Second)
+	reporter.HandleEvent(Event{Type: EventFinished, Operation: OperationCompile})
+
+	assert.Equal(t, strings.Join([]string{
+		"compile-packages started",
+		"[1/4] compile-packages: rel/one compiled (ETA 30s)",
+		"[2/4] compile-packages: rel/two compiled (ETA 20s)",
+		"compile-packages finished in 40s",
+		"",
+	}, "\n"), output.String())
+
+	// The time per step of the finished operation is kept in the timing
+	// database, and used for estimates of the next run before its first
+	// step completes
+	timings, err = LoadTimingDatabase(timingsPath)
+	require.NoError(t, err)
+	if assert.Contains(t, timings.Steps, OperationCompile) {
+		assert.Equal(t, []float64{20}, timings.Steps[OperationCompile].Durations)
+	}
+
+	output.Reset()
+	reporter, err = NewProgressReporter(ProgressPlain, output, timings)
+	require.NoError(t, err)
+	reporter.now = now
+	reporter.HandleEvent(Event{Type: EventStarted, Operation: OperationCompile})
+	reporter.HandleEvent(Event{Type: EventProgress, Operation: OperationCompile, Subject: "rel", Message: "planned", Total: 3})
+	assert.Contains(t, output.String(), "[0/3] compile-packages: rel planned (ETA 1m0s)")
+}
+
+func TestProgressReporterJSON(t *testing.T) {
+	output := &bytes.Buffer{}
+	reporter, err := NewProgressReporter(ProgressJSON, output, nil)
+	require.NoError(t, err)
+	now, advance := fakeClock()
+	reporter.now = now
+
+	reporter.HandleEvent(Event{Type: EventStarted, Operation: OperationBuildImages})
+	advance(5 * time.Second)
+	reporter.HandleEvent(Event{Type: EventProgress, Operation: OperationBuildImages, Subject: "api", Message: "built image", Done: 1, Total: 2})
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 2)
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &record))
+	assert.Equal(t, map[string]interface{}{
+		"type":      "progress",
+		"operation": OperationBuildImages,
+		"subject":   "api",
+		"message":   "built image",
+		"done":      float64(1),
+		"total":     float64(2),
+		"elapsed":   float64(5),
+		"eta":       float64(5),
+	}, record)
+}
+
+func TestProgressReporterFancy(t *testing.T) {
+	color.NoColor = true
+
+	output := &bytes.Buffer{}
+	reporter, err := NewProgressReporter(ProgressFancy, output, nil)
+	require.NoError(t, err)
+	now, advance := fakeClock()
+	reporter.now = now
+
+	reporter.HandleEvent(Event{Type: EventStarted, Operation: OperationGenerateKube})
+	advance(time.Second)
+	reporter.HandleEvent(Event{Type: EventProgress, Operation: OperationGenerateKube, Subject: "api", Done: 1, Total: 2})
+	assert.Equal(t, "\r\033[K["+strings.Repeat("=", 15)+strings.Repeat(" ", 15)+"] 1/2 generate-kube api, elapsed 1s, ETA 1s", output.String())
+}
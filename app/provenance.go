@@ -0,0 +1,88 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"code.cloudfoundry.org/fissile/builder"
+	"github.com/fatih/color"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ShowProvenance displays the provenance recorded in the labels of a role image
+func (f *Fissile) ShowProvenance(imageName string) error {
+	dockerManager, err := f.newImageManager()
+	if err != nil {
+		return fmt.Errorf("Error connecting to docker: %v", err)
+	}
+
+	image, err := dockerManager.FindImage(imageName)
+	if err != nil {
+		return fmt.Errorf("Error looking up image: %v", err)
+	}
+
+	var labels map[string]string
+	if image.Config != nil {
+		labels = image.Config.Labels
+	}
+	provenance, err := builder.NewProvenanceFromLabels(labels)
+	if err != nil {
+		return fmt.Errorf("Error reading provenance of image %s: %v", imageName, err)
+	}
+
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman:
+		f.showProvenanceForHuman(provenance)
+	case OutputFormatJSON:
+		buf, err := json.Marshal(provenance)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(provenance)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", f.Options.OutputFormat)
+	}
+
+	return nil
+}
+
+func (f *Fissile) showProvenanceForHuman(provenance *builder.Provenance) {
+	f.UI.Printf("%s: %s\n", color.BlueString("Instance group"), color.YellowString(provenance.InstanceGroup))
+	f.UI.Printf("%s: %s\n", color.BlueString("Fissile version"), provenance.FissileVersion)
+	f.UI.Printf("%s: %s\n", color.BlueString("Role manifest SHA256"), provenance.RoleManifestSHA256)
+	if provenance.LightOpinionsSHA != "" {
+		f.UI.Printf("%s: %s\n", color.BlueString("Light opinions SHA256"), provenance.LightOpinionsSHA)
+	}
+	if provenance.DarkOpinionsSHA != "" {
+		f.UI.Printf("%s: %s\n", color.BlueString("Dark opinions SHA256"), provenance.DarkOpinionsSHA)
+	}
+	if provenance.StemcellDigest != "" {
+		f.UI.Printf("%s: %s\n", color.BlueString("Stemcell"), provenance.StemcellDigest)
+	}
+
+	f.UI.Println(color.BlueString("Releases:"))
+	for _, release := range provenance.Releases {
+		if release.Commit == "" {
+			f.UI.Printf("  %s (%s)\n", color.GreenString(release.Name), release.Version)
+		} else {
+			f.UI.Printf("  %s (%s, commit %s)\n", color.GreenString(release.Name), release.Version, release.Commit)
+		}
+	}
+
+	jobs := make([]string, 0, len(provenance.JobFingerprints))
+	for job := range provenance.JobFingerprints {
+		jobs = append(jobs, job)
+	}
+	sort.Strings(jobs)
+	f.UI.Println(color.BlueString("Jobs:"))
+	for _, job := range jobs {
+		f.UI.Printf("  %s: %s\n", color.GreenString(job), provenance.JobFingerprints[job])
+	}
+}
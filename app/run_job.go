@@ -0,0 +1,121 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"code.cloudfoundry.org/fissile/builder"
+	"code.cloudfoundry.org/fissile/docker"
+	"code.cloudfoundry.org/fissile/harness"
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+	"github.com/fatih/color"
+	"github.com/pborman/uuid"
+)
+
+// RunJobOptions are the options of RunJob
+type RunJobOptions struct {
+	InstanceGroup  string   // Name of the instance group whose image to use
+	Job            string   // Name of the job to run
+	PropertiesFile string   // YAML file with the properties of the job
+	Env            []string // Additional environment variables (KEY=VALUE)
+	TagExtra       string   // Additional information used to compute the image tag
+}
+
+// RunJob runs a single job of an instance group in a local container created
+// from the role image, rendering its templates with the given properties and
+// streaming its output, so that job authors can iterate without deploying to
+// a cluster.  The role image must have been built before.
+func (f *Fissile) RunJob(opts RunJobOptions) error {
+	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
+		return fmt.Errorf("Releases not loaded")
+	}
+	instanceGroup := f.Manifest.LookupInstanceGroup(opts.InstanceGroup)
+	if instanceGroup == nil {
+		return fmt.Errorf("Instance group %s not found", opts.InstanceGroup)
+	}
+	h, err := harness.New(instanceGroup, opts.Job)
+	if err != nil {
+		return err
+	}
+	if opts.PropertiesFile != "" {
+		if err := h.LoadProperties(opts.PropertiesFile); err != nil {
+			return err
+		}
+	}
+
+	opinions, err := model.NewOpinions(f.Options.LightOpinions, f.Options.DarkOpinions)
+	if err != nil {
+		return fmt.Errorf("Error loading opinions: %v", err)
+	}
+	devVersion, err := instanceGroup.GetRoleDevVersion(opinions, opts.TagExtra, f.Version, f.roleImageOptions(), f)
+	if err != nil {
+		return fmt.Errorf("Error creating instance group checksum: %v", err)
+	}
+	imageName := builder.GetRoleDevImageName(f.Options.DockerRegistry, f.Options.DockerOrganization, f.Options.RepositoryPrefix, instanceGroup, devVersion)
+
+	dockerManager, err := f.newImageManager()
+	if err != nil {
+		return fmt.Errorf("Error connecting to docker: %v", err)
+	}
+	hasImage, err := dockerManager.HasImage(imageName)
+	if err != nil {
+		return fmt.Errorf("Error looking up image: %v", err)
+	}
+	if !hasImage {
+		return fmt.Errorf("Image %s of instance group %s not found; build it with `fissile build images` first", imageName, instanceGroup.Name)
+	}
+
+	if err := os.MkdirAll(f.Options.WorkDir, 0755); err != nil {
+		return err
+	}
+	harnessDir, err := ioutil.TempDir(f.Options.WorkDir, "run-job-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(harnessDir)
+	// Docker only bind mounts absolute paths
+	if harnessDir, err = filepath.Abs(harnessDir); err != nil {
+		return err
+	}
+	if err := h.WriteTo(harnessDir); err != nil {
+		return fmt.Errorf("Error writing the job harness: %v", err)
+	}
+
+	prefix := color.MagentaString("%s/%s", instanceGroup.Name, opts.Job)
+	stdoutWriter := docker.NewFormattingWriter(f.UI, func(line string) string {
+		return fmt.Sprintf("%s > %s", prefix, line)
+	})
+	stderrWriter := docker.NewFormattingWriter(f.UI, func(line string) string {
+		return fmt.Sprintf("%s > %s", prefix, color.RedString("%s", line))
+	})
+
+	f.UI.Printf("Running job %s of instance group %s in image %s\n",
+		color.MagentaString(opts.Job), color.MagentaString(instanceGroup.Name), color.YellowString(imageName))
+	containerName := util.SanitizeDockerName(fmt.Sprintf("fissile-run-%s-%s-%s", instanceGroup.Name, opts.Job, uuid.New()))
+	exitCode, container, err := dockerManager.RunInContainer(docker.RunInContainerOpts{
+		ContainerName: containerName,
+		ImageName:     imageName,
+		EntryPoint:    []string{},
+		Cmd:           []string{"/bin/bash", path.Join(harness.ContainerPath, harness.ScriptName)},
+		Env:           opts.Env,
+		Mounts:        map[string]string{harnessDir: harness.ContainerPath},
+		StdoutWriter:  stdoutWriter,
+		StderrWriter:  stderrWriter,
+	})
+	if container != nil {
+		if removeErr := dockerManager.RemoveContainer(container.ID); removeErr != nil && err == nil {
+			err = removeErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("Error running job %s of instance group %s: %v", opts.Job, instanceGroup.Name, err)
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("Job %s of instance group %s exited with code %d", opts.Job, instanceGroup.Name, exitCode)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+	"github.com/SUSE/termui"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// These are the parameters the secret generator uses for the secrets it
+// creates; they cannot be changed by the variables
+const (
+	GeneratedPasswordLength     = 64
+	GeneratedSSHKeyBits         = 2048
+	GeneratedCertificateKeyBits = 4096
+)
+
+// SecretGenerationReport describes one secret the secret generator creates
+type SecretGenerationReport struct {
+	Name      string   `json:"name" yaml:"name"`
+	Type      string   `json:"type" yaml:"type"`
+	Length    int      `json:"length,omitempty" yaml:"length,omitempty"`
+	KeyBits   int      `json:"key_bits,omitempty" yaml:"key_bits,omitempty"`
+	IsCA      bool     `json:"is_ca,omitempty" yaml:"is_ca,omitempty"`
+	Names     []string `json:"names,omitempty" yaml:"names,omitempty"`
+	Immutable bool     `json:"immutable" yaml:"immutable"`
+	Rotated   bool     `json:"rotated" yaml:"rotated"`
+}
+
+// ShowSecretGeneration displays the secrets the secret generator would create
+// for the loaded role manifest, with their parameters, and which of them are
+// generated again when the secrets generation counter is incremented. Nothing
+// is generated.
+func (f *Fissile) ShowSecretGeneration() error {
+	if f.Manifest == nil {
+		return fmt.Errorf("Role manifest not loaded")
+	}
+
+	secrets := CollectSecretGeneration(f.Manifest)
+
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman:
+		f.showSecretGenerationForHuman(secrets)
+	case OutputFormatJSON:
+		buf, err := json.Marshal(secrets)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(secrets)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", f.Options.OutputFormat)
+	}
+
+	return nil
+}
+
+// CollectSecretGeneration returns a report of all the variables of the role
+// manifest with a generator, sorted by name. Immutable secrets are generated
+// once and kept when the secrets generation counter is incremented; all others
+// are rotated. Mutable secrets can also be set by the user, who then has to
+// rotate them instead.
+func CollectSecretGeneration(roleManifest *model.RoleManifest) []SecretGenerationReport {
+	secrets := make([]SecretGenerationReport, 0)
+	for _, variable := range roleManifest.Variables {
+		if variable.Type == "" {
+			continue
+		}
+		secret := SecretGenerationReport{
+			Name:      variable.Name,
+			Type:      variable.Type,
+			Immutable: variable.CVOptions.Immutable,
+			Rotated:   !variable.CVOptions.Immutable,
+		}
+		switch variable.Type {
+		case "password":
+			secret.Length = GeneratedPasswordLength
+		case "ssh":
+			secret.KeyBits = GeneratedSSHKeyBits
+		case "certificate":
+			secret.KeyBits = GeneratedCertificateKeyBits
+			secret.IsCA = variable.CVOptions.IsCA
+			if !secret.IsCA {
+				secret.Names = certificateNames(variable)
+			}
+		}
+		secrets = append(secrets, secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	return secrets
+}
+
+// certificateNames returns the names a (non-CA) certificate is generated for;
+// see also the comments kube.MakeValues writes for certificates.
+func certificateNames(variable *model.VariableDefinition) []string {
+	var names []string
+	if variable.CVOptions.RoleName != "" {
+		names = append(names, variable.CVOptions.RoleName)
+	} else if variable.CVOptions.AltNames == nil {
+		names = append(names, util.ConvertNameToKey(variable.Name))
+	}
+	return append(names, variable.CVOptions.AltNames...)
+}
+
+func (f *Fissile) showSecretGenerationForHuman(secrets []SecretGenerationReport) {
+	if len(secrets) == 0 {
+		f.UI.Println("No generated secrets")
+		return
+	}
+
+	table := termui.NewTable("Secret", "Type", "Parameters", "On counter increment")
+	for _, secret := range secrets {
+		var parameters []string
+		if secret.Length > 0 {
+			parameters = append(parameters, fmt.Sprintf("length %d", secret.Length))
+		}
+		if secret.KeyBits > 0 {
+			parameters = append(parameters, fmt.Sprintf("rsa %d bits", secret.KeyBits))
+		}
+		if secret.IsCA {
+			parameters = append(parameters, "CA")
+		}
+		if len(secret.Names) > 0 {
+			parameters = append(parameters, fmt.Sprintf("names %s", strings.Join(secret.Names, ", ")))
+		}
+		rotation := "regenerated, unless set by the user"
+		if !secret.Rotated {
+			rotation = "kept (immutable)"
+		}
+		table.Add(secret.Name, secret.Type, strings.Join(parameters, "; "), rotation)
+	}
+
+	f.printTable(table)
+}
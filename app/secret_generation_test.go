@@ -0,0 +1,71 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShowSecretGeneration(t *testing.T) {
+	output := &bytes.Buffer{}
+	ui := termui.New(&bytes.Buffer{}, output, nil)
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", ui)
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/secret-generation.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	expected := []SecretGenerationReport{
+		{Name: "CONTROL_PASSWORD", Type: "password", Length: GeneratedPasswordLength, Rotated: true},
+		{Name: "INTERNAL_CA_CERT", Type: "certificate", KeyBits: GeneratedCertificateKeyBits, IsCA: true, Immutable: true},
+		{Name: "SSH_KEY", Type: "ssh", KeyBits: GeneratedSSHKeyBits, Rotated: true},
+		{
+			Name:    "TOR_CERT",
+			Type:    "certificate",
+			KeyBits: GeneratedCertificateKeyBits,
+			Names:   []string{"tor", "tor.example.com", "*.tor.example.com"},
+			Rotated: true,
+		},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		output.Reset()
+		f.Options.OutputFormat = OutputFormatJSON
+		require.NoError(t, f.ShowSecretGeneration())
+		var actual []SecretGenerationReport
+		require.NoError(t, json.Unmarshal(output.Bytes(), &actual))
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("human", func(t *testing.T) {
+		output.Reset()
+		f.Options.OutputFormat = OutputFormatHuman
+		require.NoError(t, f.ShowSecretGeneration())
+		lines := termui.Decolorize(output.String())
+		assert.Contains(t, lines, "length 64")
+		assert.Contains(t, lines, "kept (immutable)")
+		assert.Contains(t, lines, "names tor, tor.example.com, *.tor.example.com")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		f.Options.OutputFormat = "dot"
+		assert.Error(t, f.ShowSecretGeneration())
+	})
+}
+
+func TestShowSecretGenerationNotLoaded(t *testing.T) {
+	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
+	f := NewFissileApplication(".", ui)
+	assert.Error(t, f.ShowSecretGeneration())
+}
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// SecretReport describes one secret variable of the role manifest, and the
+// instance groups and jobs consuming it
+type SecretReport struct {
+	Name      string           `json:"name" yaml:"name"`
+	Generator string           `json:"generator,omitempty" yaml:"generator,omitempty"`
+	Generated bool             `json:"generated" yaml:"generated"`
+	Immutable bool             `json:"immutable" yaml:"immutable"`
+	Consumers []SecretConsumer `json:"consumers" yaml:"consumers"`
+}
+
+// SecretConsumer describes an instance group consuming a secret. Jobs lists
+// the jobs with property templates referring to the secret; it is empty for
+// internal secrets, which are made available to the scripts of every
+// instance group.
+type SecretConsumer struct {
+	InstanceGroup string   `json:"instance_group" yaml:"instance_group"`
+	Jobs          []string `json:"jobs,omitempty" yaml:"jobs,omitempty"`
+}
+
+// ShowSecrets displays every secret variable of the loaded role manifest,
+// whether it is generated or provided by the user, whether it is immutable,
+// and where it is consumed.
+func (f *Fissile) ShowSecrets() error {
+	if f.Manifest == nil {
+		return fmt.Errorf("Role manifest not loaded")
+	}
+
+	secrets, err := CollectSecrets(f.Manifest)
+	if err != nil {
+		return err
+	}
+
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman:
+		f.showSecretsForHuman(secrets)
+	case OutputFormatJSON:
+		buf, err := json.Marshal(secrets)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(secrets)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", f.Options.OutputFormat)
+	}
+
+	return nil
+}
+
+// CollectSecrets returns a report of all the secret variables of the role
+// manifest, sorted by name. The consumers of a secret are the instance groups
+// which get the variable (see GetVariablesForRole), in the order of the role
+// manifest.
+func CollectSecrets(roleManifest *model.RoleManifest) ([]SecretReport, error) {
+	secrets := make([]SecretReport, 0)
+	index := make(map[string]int)
+	for _, variable := range roleManifest.Variables {
+		if !variable.CVOptions.Secret || variable.CVOptions.Type == model.CVTypeEnv {
+			continue
+		}
+		index[variable.Name] = len(secrets)
+		secrets = append(secrets, SecretReport{
+			Name:      variable.Name,
+			Generator: variable.Type,
+			Generated: variable.Type != "",
+			Immutable: variable.CVOptions.Immutable,
+			Consumers: make([]SecretConsumer, 0),
+		})
+	}
+
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		variables, err := instanceGroup.GetVariablesForRole()
+		if err != nil {
+			return nil, err
+		}
+		for _, variable := range variables {
+			i, ok := index[variable.Name]
+			if !ok {
+				continue
+			}
+			jobs, err := secretConsumingJobs(instanceGroup, variable.Name)
+			if err != nil {
+				return nil, err
+			}
+			secrets[i].Consumers = append(secrets[i].Consumers, SecretConsumer{
+				InstanceGroup: instanceGroup.Name,
+				Jobs:          jobs,
+			})
+		}
+	}
+
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	return secrets, nil
+}
+
+// secretConsumingJobs returns the names of the jobs of the instance group
+// with a property template referring to the variable, matching properties the
+// same way as GetVariablesForRole.
+func secretConsumingJobs(instanceGroup *model.InstanceGroup, name string) ([]string, error) {
+	var jobs []string
+	for _, jobReference := range instanceGroup.JobReferences {
+		consumes, err := jobReferencesVariable(instanceGroup, jobReference, name)
+		if err != nil {
+			return nil, err
+		}
+		if consumes {
+			jobs = append(jobs, jobReference.Name)
+		}
+	}
+	return jobs, nil
+}
+
+func jobReferencesVariable(instanceGroup *model.InstanceGroup, jobReference *model.JobReference, name string) (bool, error) {
+	for _, property := range jobReference.Properties {
+		propertyName := fmt.Sprintf("properties.%s", property.Name)
+		for templatePropName, template := range instanceGroup.Configuration.Templates {
+			if templatePropName != propertyName && !strings.HasPrefix(templatePropName, propertyName+".") {
+				continue
+			}
+			varsInTemplate, err := model.ParseTemplate(template.Value)
+			if err != nil {
+				return false, err
+			}
+			for _, varName := range varsInTemplate {
+				if varName == name {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+func (f *Fissile) showSecretsForHuman(secrets []SecretReport) {
+	if len(secrets) == 0 {
+		f.UI.Println("No secrets")
+		return
+	}
+
+	table := termui.NewTable("Secret", "Source", "Lifecycle", "Consumers")
+	for _, secret := range secrets {
+		source := "user"
+		if secret.Generated {
+			source = fmt.Sprintf("generated (%s)", secret.Generator)
+		}
+		lifecycle := "rotatable"
+		if secret.Immutable {
+			lifecycle = "immutable"
+		}
+		var consumers []string
+		for _, consumer := range secret.Consumers {
+			if len(consumer.Jobs) == 0 {
+				consumers = append(consumers, consumer.InstanceGroup)
+				continue
+			}
+			for _, job := range consumer.Jobs {
+				consumers = append(consumers, fmt.Sprintf("%s/%s", consumer.InstanceGroup, job))
+			}
+		}
+		if len(consumers) == 0 {
+			consumers = append(consumers, "-")
+		}
+		table.Add(secret.Name, source, lifecycle, strings.Join(consumers, ", "))
+	}
+
+	f.printTable(table)
+}
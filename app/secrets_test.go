@@ -0,0 +1,90 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShowSecrets(t *testing.T) {
+	output := &bytes.Buffer{}
+	ui := termui.New(&bytes.Buffer{}, output, nil)
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", ui)
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/secrets.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	expected := []SecretReport{
+		{
+			Name:      "CONTROL_PASSWORD",
+			Generator: "password",
+			Generated: true,
+			Consumers: []SecretConsumer{
+				{InstanceGroup: "myrole", Jobs: []string{"tor"}},
+				{InstanceGroup: "otherrole", Jobs: []string{"tor"}},
+			},
+		},
+		{
+			Name: "INTERNAL_TOKEN",
+			Consumers: []SecretConsumer{
+				{InstanceGroup: "myrole"},
+				{InstanceGroup: "otherrole"},
+			},
+		},
+		{
+			Name: "OTHER_PRIVATE_KEY",
+			Consumers: []SecretConsumer{
+				{InstanceGroup: "otherrole", Jobs: []string{"tor"}},
+			},
+		},
+		{
+			Name:      "PRIVATE_KEY",
+			Immutable: true,
+			Consumers: []SecretConsumer{
+				{InstanceGroup: "myrole", Jobs: []string{"tor"}},
+			},
+		},
+	}
+
+	t.Run("json", func(t *testing.T) {
+		output.Reset()
+		f.Options.OutputFormat = OutputFormatJSON
+		require.NoError(t, f.ShowSecrets())
+		var actual []SecretReport
+		require.NoError(t, json.Unmarshal(output.Bytes(), &actual))
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("human", func(t *testing.T) {
+		output.Reset()
+		f.Options.OutputFormat = OutputFormatHuman
+		require.NoError(t, f.ShowSecrets())
+		lines := termui.Decolorize(output.String())
+		assert.Contains(t, lines, "generated (password)")
+		assert.Contains(t, lines, "immutable")
+		assert.Contains(t, lines, "myrole/tor, otherrole/tor")
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		f.Options.OutputFormat = "dot"
+		assert.Error(t, f.ShowSecrets())
+	})
+}
+
+func TestShowSecretsNotLoaded(t *testing.T) {
+	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
+	f := NewFissileApplication(".", ui)
+	assert.Error(t, f.ShowSecrets())
+}
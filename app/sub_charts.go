@@ -0,0 +1,191 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/fatih/color"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// With sub-charts, the instance groups of each group of the role manifest are
+// written to a sub-chart of their own in the charts directory of the umbrella
+// chart.  The umbrella chart keeps the shared objects (secrets, accounts, the
+// deployment manifest) and the instance groups without a group.  All values
+// are shared through the global values, which helm passes on to the
+// sub-charts, as templates also use the sizing of instance groups of other
+// charts (e.g. the deployment info and the KUBE_SIZING_* variables).
+
+// subChartsDir is the directory of the sub-charts in the umbrella chart
+const subChartsDir = "charts"
+
+// validateSubCharts checks that the settings can be used with sub-charts
+func validateSubCharts(settings kube.ExportSettings) error {
+	if !settings.SubCharts {
+		return nil
+	}
+	if !settings.CreateHelmChart {
+		return fmt.Errorf("Sub-charts can only be generated for helm charts")
+	}
+	if settings.ValuesDocs != "" {
+		return fmt.Errorf("Values documentation cannot be generated with sub-charts")
+	}
+	return nil
+}
+
+// subChartGroups returns the sorted groups of the instance groups of the role
+// manifest
+func subChartGroups(roleManifest *model.RoleManifest) []string {
+	seen := make(map[string]bool)
+	var groups []string
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		if instanceGroup.Group != "" && !instanceGroup.IsColocated() && !seen[instanceGroup.Group] {
+			seen[instanceGroup.Group] = true
+			groups = append(groups, instanceGroup.Group)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// manifestOfGroup returns a copy of the role manifest holding only the
+// instance groups of the group, with their colocated containers.  The empty
+// group selects the instance groups of the umbrella chart.
+func manifestOfGroup(roleManifest *model.RoleManifest, group string) *model.RoleManifest {
+	selected := make(map[string]bool)
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		if instanceGroup.IsColocated() || instanceGroup.Group != group {
+			continue
+		}
+		selected[instanceGroup.Name] = true
+		for _, colocated := range instanceGroup.GetColocatedRoles() {
+			selected[colocated.Name] = true
+		}
+	}
+	return manifestWithInstanceGroups(roleManifest, selected)
+}
+
+// valuesReferencePattern matches the references to chart values in templates
+var valuesReferencePattern = regexp.MustCompile(`\.Values\.(\w+)`)
+
+// globalValues rewrites the references to the chart values in template text
+// to the global values
+func globalValues(text string) string {
+	return valuesReferencePattern.ReplaceAllStringFunc(text, func(reference string) string {
+		key := valuesReferencePattern.FindStringSubmatch(reference)[1]
+		if key == "global" {
+			return reference
+		}
+		return ".Values.global." + key
+	})
+}
+
+// isChartTemplate returns whether the path, relative to the umbrella chart,
+// is a template of the umbrella chart or of one of its sub-charts
+func isChartTemplate(path string) bool {
+	for _, dir := range strings.Split(filepath.ToSlash(filepath.Dir(path)), "/") {
+		if dir == "templates" {
+			return true
+		}
+	}
+	return false
+}
+
+// makeUmbrellaValues returns the values of the umbrella chart: the values of
+// the whole role manifest, including the sizing of the instance groups of
+// the sub-charts, as global values
+func makeUmbrellaValues(settings kube.ExportSettings) helm.Node {
+	return helm.NewMapping("global", kube.MakeValues(settings).(*helm.Mapping).Sort())
+}
+
+// chartVersion returns the version of the umbrella chart, from its Chart.yaml
+// in the output directory or else in the overlay directory.  The sub-charts
+// need the same version, as it is part of the name of the generated secrets.
+func chartVersion(settings kube.ExportSettings) (string, error) {
+	dirs := []string{settings.OutputDir}
+	if settings.OverlayDir != "" {
+		dirs = append(dirs, settings.OverlayDir)
+	}
+	for _, dir := range dirs {
+		contents, err := ioutil.ReadFile(filepath.Join(dir, "Chart.yaml"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		var chart struct {
+			Version string `yaml:"version"`
+		}
+		if err := yaml.Unmarshal(contents, &chart); err != nil {
+			return "", fmt.Errorf("Error reading the umbrella chart %s: %v", filepath.Join(dir, "Chart.yaml"), err)
+		}
+		if chart.Version == "" {
+			return "", fmt.Errorf("The umbrella chart %s has no version", filepath.Join(dir, "Chart.yaml"))
+		}
+		return chart.Version, nil
+	}
+	return "", fmt.Errorf("Sub-charts need the Chart.yaml of the umbrella chart in the output or overlay directory")
+}
+
+// generateSubCharts writes a sub-chart for each group of instance groups
+func (f *Fissile) generateSubCharts(ctx context.Context, settings kube.ExportSettings) error {
+	version, err := chartVersion(settings)
+	if err != nil {
+		return err
+	}
+
+	for _, group := range subChartGroups(settings.RoleManifest) {
+		groupSettings := settings
+		groupSettings.OutputDir = filepath.Join(settings.OutputDir, subChartsDir, group)
+		groupSettings.RoleManifest = manifestOfGroup(settings.RoleManifest, group)
+		// The secrets are in the umbrella chart, so the pods cannot use its checksum
+		groupSettings.ConfigChecksum = kube.ConfigChecksumInstanceGroup
+
+		err := f.writeSubChartMetadata(groupSettings.OutputDir, group, version)
+		if err != nil {
+			return err
+		}
+
+		err = f.generateHelmHelpers(kube.HelmHelpersFileName, groupSettings)
+		if err != nil {
+			return err
+		}
+
+		err = f.generateKubeRoles(ctx, groupSettings)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSubChartMetadata writes the Chart.yaml of a sub-chart
+func (f *Fissile) writeSubChartMetadata(dir, group, version string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	outputPath := filepath.Join(dir, "Chart.yaml")
+	f.UI.Printf("Writing config %s\n", color.CyanString(outputPath))
+	f.recordGeneratedFile(outputPath)
+
+	contents, err := yaml.Marshal(yaml.MapSlice{
+		{Key: "apiVersion", Value: "v1"},
+		{Key: "name", Value: group},
+		{Key: "version", Value: version},
+		{Key: "description", Value: fmt.Sprintf("The %s instance groups", group)},
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outputPath, contents, 0644)
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/helm/render"
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKubeSubCharts(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/sub-charts.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	outputDir, err := ioutil.TempDir("", "fissile-test-sub-charts")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	settings := kube.ExportSettings{
+		OutputDir:       outputDir,
+		CreateHelmChart: true,
+		SubCharts:       true,
+	}
+	err = f.GenerateKube(context.Background(), settings)
+	assert.EqualError(t, err, "Sub-charts need the Chart.yaml of the umbrella chart in the output or overlay directory")
+
+	chart := "apiVersion: v1\nname: umbrella\nversion: 1.2.3\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(outputDir, "Chart.yaml"), []byte(chart), 0644))
+	require.NoError(t, f.GenerateKube(context.Background(), settings))
+
+	readFile := func(path ...string) string {
+		contents, err := ioutil.ReadFile(filepath.Join(append([]string{outputDir}, path...)...))
+		require.NoError(t, err)
+		return string(contents)
+	}
+
+	values := readFile("values.yaml")
+	assert.Contains(t, values, "\nglobal:\n")
+	assert.Contains(t, values, "\n    PRIVATE_KEY: ~\n", "Secrets are global values")
+	assert.Contains(t, values, "\n    helper:\n", "The sizing is global")
+	assert.Contains(t, values, "\n    api:\n", "The sizing of the instance groups of sub-charts is global")
+	assert.NotContains(t, values, "\nsizing:\n")
+	assert.Contains(t, readFile("templates", "secrets.yaml"), ".Values.global.secrets.PRIVATE_KEY")
+
+	helper := readFile("templates", "helper.yaml")
+	assert.Contains(t, helper, ".Values.global.sizing.helper.count")
+	assert.NotContains(t, helper, ".Values.kube.")
+	assert.NotContains(t, helper, ".Values.sizing.")
+
+	assert.Equal(t, "apiVersion: v1\nname: control-plane\nversion: 1.2.3\ndescription: The control-plane instance groups\n",
+		readFile("charts", "control-plane", "Chart.yaml"))
+	api := readFile("charts", "control-plane", "templates", "api.yaml")
+	assert.Contains(t, api, ".Values.global.sizing.api.count")
+	assert.Contains(t, api, ".Values.global.kube.registry")
+	assert.Contains(t, api, ".Values.global.secrets.PRIVATE_KEY", "The checksum covers the secrets consumed by the instance group")
+	assert.NotContains(t, api, "secrets.yaml")
+	_, err = os.Stat(filepath.Join(outputDir, "charts", "control-plane", "values.yaml"))
+	assert.True(t, os.IsNotExist(err), "Sub-charts only use the global values")
+	assert.FileExists(t, filepath.Join(outputDir, "charts", "control-plane", "templates", kube.HelmHelpersFileName))
+	assert.FileExists(t, filepath.Join(outputDir, "charts", "routing", "templates", "router.yaml"))
+	_, err = os.Stat(filepath.Join(outputDir, "templates", "api.yaml"))
+	assert.True(t, os.IsNotExist(err), "Instance groups of sub-charts are not in the umbrella chart")
+
+	settings.CreateHelmChart = false
+	assert.EqualError(t, f.GenerateKube(context.Background(), settings), "Sub-charts can only be generated for helm charts")
+}
+
+func TestGenerateKubeSubChartsRender(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/sub-charts.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	tempDir, err := ioutil.TempDir("", "fissile-test-sub-charts")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// The overlay templates reference the chart values like the generated
+	// templates, and must be moved to the global values too
+	overlayDir := filepath.Join(tempDir, "overlay")
+	require.NoError(t, os.MkdirAll(filepath.Join(overlayDir, "templates"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(overlayDir, "Chart.yaml"),
+		[]byte("apiVersion: v1\nname: umbrella\nversion: 1.2.3\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(overlayDir, "templates", "extra.yaml"), []byte(`---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: extra
+data:
+  registry: {{ .Values.kube.registry.hostname | quote }}
+  count: {{ .Values.sizing.api.count | quote }}
+`), 0644))
+
+	settings := kube.ExportSettings{
+		OutputDir:       filepath.Join(tempDir, "chart"),
+		CreateHelmChart: true,
+		SubCharts:       true,
+		OverlayDir:      overlayDir,
+		Opinions:        model.NewEmptyOpinions(),
+		Repository:      "fissile",
+	}
+	require.NoError(t, f.GenerateKube(context.Background(), settings))
+
+	umbrella, err := render.LoadChart(settings.OutputDir)
+	require.NoError(t, err)
+	overrides := map[string]interface{}{
+		"Values.global.kube.registry.hostname": "registry.example.com",
+		"Values.global.sizing.api.count":       1,
+	}
+	rendered, err := umbrella.RenderAll(overrides)
+	require.NoError(t, err, "All templates of the umbrella chart must render")
+	require.Len(t, rendered["extra.yaml"], 1)
+	data := rendered["extra.yaml"][0].(map[interface{}]interface{})["data"].(map[interface{}]interface{})
+	assert.Equal(t, "registry.example.com", data["registry"])
+	assert.Equal(t, "1", data["count"], "The umbrella chart can use the sizing of the sub-charts")
+	assert.NotEmpty(t, rendered["deployment-info.yaml"], "The deployment info covers the instance groups of the sub-charts")
+
+	// Helm passes the global values of the umbrella chart on to the sub-charts
+	var image string
+	for _, group := range []string{"control-plane", "routing"} {
+		subChart, err := render.LoadChart(filepath.Join(settings.OutputDir, "charts", group))
+		require.NoError(t, err)
+		subChart.Values["global"] = umbrella.Values["global"]
+		rendered, err := subChart.RenderAll(overrides)
+		require.NoError(t, err, "All templates of the %s sub-chart must render", group)
+		for _, document := range rendered["api.yaml"] {
+			object := document.(map[interface{}]interface{})
+			if object["kind"] == "StatefulSet" {
+				spec := object["spec"].(map[interface{}]interface{})["template"].(map[interface{}]interface{})["spec"].(map[interface{}]interface{})
+				image = spec["containers"].([]interface{})[0].(map[interface{}]interface{})["image"].(string)
+			}
+		}
+	}
+	assert.Contains(t, image, "registry.example.com/")
+}
+
+func TestGlobalValues(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t,
+		`{{ if .Values.global.kube.x }}{{ $.Values.global.sizing.a.count }}{{ .Values.global.env.B }}{{ end }}`,
+		globalValues(`{{ if .Values.kube.x }}{{ $.Values.sizing.a.count }}{{ .Values.global.env.B }}{{ end }}`))
+}
@@ -0,0 +1,314 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/kube"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/fatih/color"
+)
+
+// SystemdOptions are the options of GenerateSystemd
+type SystemdOptions struct {
+	OutputDir      string   // Directory to write the units, environment files, and install script to
+	Runtime        string   // Container runtime running the role images, podman or docker
+	InstanceGroups []string // Instance groups to run, along with those they depend on; all if empty
+	DefaultsFiles  []string // Files overriding the defaults of variables, later files take precedence
+	TagExtra       string   // Additional information used to compute the image tags
+}
+
+const (
+	// systemdNetwork is the container network the units are attached to
+	systemdNetwork = "fissile"
+	// systemdEnvDir is where install.sh puts the environment files and the
+	// deployment manifest
+	systemdEnvDir = "/etc/fissile"
+	// systemdUnitDir is where install.sh puts the units
+	systemdUnitDir = "/etc/systemd/system"
+)
+
+// GenerateSystemd writes a systemd unit per instance group running its role
+// image with podman or docker on a single host, the environment files of the
+// units, and an install script enabling them.  The images must have been
+// built before.
+func (f *Fissile) GenerateSystemd(opts SystemdOptions) error {
+	if f.Manifest == nil || len(f.Manifest.LoadedReleases) == 0 {
+		return fmt.Errorf("Releases not loaded")
+	}
+	if opts.Runtime != "podman" && opts.Runtime != "docker" {
+		return fmt.Errorf("Invalid container runtime %s, must be podman or docker", opts.Runtime)
+	}
+	roleManifest, err := ApplyDefaultsFiles(f.Manifest, opts.DefaultsFiles)
+	if err != nil {
+		return err
+	}
+
+	instanceGroups, err := localInstanceGroups(roleManifest, opts.InstanceGroups)
+	if err != nil {
+		return err
+	}
+
+	opinions, err := model.NewOpinions(f.Options.LightOpinions, f.Options.DarkOpinions)
+	if err != nil {
+		return fmt.Errorf("Error loading opinions: %v", err)
+	}
+	settings := kube.ExportSettings{
+		RoleManifest: roleManifest,
+		Opinions:     opinions,
+		TagExtra:     opts.TagExtra,
+	}
+
+	if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
+		return err
+	}
+
+	var units []string
+	for _, instanceGroup := range instanceGroups {
+		image, err := f.localImageName(instanceGroup, opinions, opts.TagExtra)
+		if err != nil {
+			return err
+		}
+		environment, secrets, err := localEnvironment(instanceGroup, settings)
+		if err != nil {
+			return fmt.Errorf("Instance group %s: %v", instanceGroup.Name, err)
+		}
+
+		unit := systemdUnitName(instanceGroup.Name)
+		unitPath := filepath.Join(opts.OutputDir, unit)
+		f.UI.Printf("Writing systemd unit %s\n", color.CyanString(unitPath))
+		err = ioutil.WriteFile(unitPath, newSystemdUnit(instanceGroup, image, environment, secrets, opts.Runtime), 0644)
+		if err != nil {
+			return err
+		}
+
+		envPath := filepath.Join(opts.OutputDir, instanceGroup.Name+".env")
+		err = ioutil.WriteFile(envPath, newSystemdEnvFile(environment, secrets), 0600)
+		if err != nil {
+			return err
+		}
+		units = append(units, unit)
+	}
+
+	manifestPath := filepath.Join(opts.OutputDir, localDeploymentManifestName)
+	f.UI.Printf("Writing deployment manifest %s\n", color.CyanString(manifestPath))
+	if err := writeLocalDeploymentManifest(roleManifest, manifestPath); err != nil {
+		return err
+	}
+
+	scriptPath := filepath.Join(opts.OutputDir, "install.sh")
+	f.UI.Printf("Writing install script %s\n", color.CyanString(scriptPath))
+	return ioutil.WriteFile(scriptPath, newSystemdInstallScript(units, opts.Runtime), 0755)
+}
+
+// systemdUnitName returns the name of the unit running the instance group
+func systemdUnitName(instanceGroupName string) string {
+	return systemdContainerName(instanceGroupName) + ".service"
+}
+
+// systemdContainerName returns the name of the container running the
+// instance group
+func systemdContainerName(instanceGroupName string) string {
+	return "fissile-" + instanceGroupName
+}
+
+// newSystemdUnit returns the unit running the instance group.  The units of
+// the instance groups providing consumed links are required, and so is the
+// unit of the main instance group of colocated containers, whose network they
+// share like they share its pod.  The environment variables are passed by name
+// from the environment file of the unit, and the deployment manifest installed
+// next to it is mounted into the container.
+func newSystemdUnit(instanceGroup *model.InstanceGroup, image string, environment map[string]string, secrets []string, runtime string) []byte {
+	containerName := systemdContainerName(instanceGroup.Name)
+	command := "/usr/bin/" + runtime
+
+	var dependencies []string
+	for _, dependency := range linkDependencies(instanceGroup) {
+		dependencies = append(dependencies, systemdUnitName(dependency))
+	}
+
+	args := []string{command, "run", "--rm", "--name", containerName}
+	if parent := colocationParent(instanceGroup); parent != "" {
+		dependencies = append(dependencies, systemdUnitName(parent))
+		args = append(args, "--network", "container:"+systemdContainerName(parent))
+	} else {
+		args = append(args, "--network", systemdNetwork)
+		for _, alias := range localServiceAliases(instanceGroup) {
+			args = append(args, "--network-alias", alias)
+		}
+		for _, port := range localPorts(instanceGroup) {
+			args = append(args, "--publish", port)
+		}
+	}
+
+	var names []string
+	for name := range environment {
+		names = append(names, name)
+	}
+	names = append(names, secrets...)
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "--env", name)
+	}
+
+	for _, volume := range localVolumes(instanceGroup) {
+		args = append(args, "--volume", volume)
+	}
+	args = append(args, "--volume", fmt.Sprintf("%s/%s:%s:ro", systemdEnvDir, localDeploymentManifestName, localDeploymentManifestPath))
+	for _, capability := range instanceGroup.Run.Capabilities {
+		args = append(args, "--cap-add", capability)
+	}
+	if instanceGroup.Run.Privileged {
+		args = append(args, "--privileged")
+	}
+	args = append(args, systemdHealthCheck(instanceGroup)...)
+	if len(instanceGroup.Run.Command) > 0 {
+		args = append(args, "--entrypoint", instanceGroup.Run.Command[0])
+	}
+	args = append(args, image)
+	if len(instanceGroup.Run.Command) > 1 {
+		args = append(args, instanceGroup.Run.Command[1:]...)
+	}
+	args = append(args, instanceGroup.Run.Args...)
+
+	restart := "always"
+	if instanceGroup.Type == model.RoleTypeBoshTask {
+		restart = "on-failure"
+	}
+
+	var quoted []string
+	for _, arg := range args {
+		quoted = append(quoted, systemdQuote(arg))
+	}
+
+	var unit bytes.Buffer
+	fmt.Fprintf(&unit, "# Generated by fissile for instance group %s\n", instanceGroup.Name)
+	fmt.Fprintf(&unit, "[Unit]\n")
+	fmt.Fprintf(&unit, "Description=%s\n", instanceGroup.Name)
+	fmt.Fprintf(&unit, "Wants=network-online.target\n")
+	fmt.Fprintf(&unit, "After=%s\n", strings.Join(append([]string{"network-online.target"}, dependencies...), " "))
+	if len(dependencies) > 0 {
+		fmt.Fprintf(&unit, "Requires=%s\n", strings.Join(dependencies, " "))
+	}
+	fmt.Fprintf(&unit, "\n[Service]\n")
+	fmt.Fprintf(&unit, "EnvironmentFile=%s/%s.env\n", systemdEnvDir, instanceGroup.Name)
+	fmt.Fprintf(&unit, "ExecStartPre=-%s rm --force %s\n", command, containerName)
+	fmt.Fprintf(&unit, "ExecStart=%s\n", strings.Join(quoted, " "))
+	fmt.Fprintf(&unit, "ExecStop=%s stop %s\n", command, containerName)
+	fmt.Fprintf(&unit, "Restart=%s\n", restart)
+	fmt.Fprintf(&unit, "\n[Install]\n")
+	fmt.Fprintf(&unit, "WantedBy=multi-user.target\n")
+	return unit.Bytes()
+}
+
+// systemdHealthCheck returns the options of the run command checking the
+// health of the container like its readiness probe would on Kubernetes.  Only
+// BOSH instance groups have one.
+func systemdHealthCheck(instanceGroup *model.InstanceGroup) []string {
+	if instanceGroup.Type != model.RoleTypeBosh {
+		return nil
+	}
+
+	var command []string
+	if instanceGroup.Run.ActivePassiveProbe != "" {
+		command = append(command, "/usr/bin/env", "FISSILE_ACTIVE_PASSIVE_PROBE="+instanceGroup.Run.ActivePassiveProbe)
+	}
+	command = append(command, "/opt/fissile/readiness-probe.sh")
+	var probe *model.HealthProbe
+	if instanceGroup.Run.HealthCheck != nil {
+		probe = instanceGroup.Run.HealthCheck.Readiness
+	}
+	if probe != nil {
+		command = append(command, probe.Command...)
+	}
+
+	var quoted []string
+	for _, arg := range command {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	options := []string{"--health-cmd", strings.Join(quoted, " ")}
+	if probe != nil {
+		// addOption is a helper to avoid adding an option for a zero value
+		addOption := func(name string, value int, unit string) {
+			if value != 0 {
+				options = append(options, name, fmt.Sprintf("%d%s", value, unit))
+			}
+		}
+		addOption("--health-start-period", probe.InitialDelay, "s")
+		addOption("--health-interval", probe.Period, "s")
+		addOption("--health-timeout", probe.Timeout, "s")
+		addOption("--health-retries", probe.FailureThreshold, "")
+	}
+	return options
+}
+
+// newSystemdEnvFile returns the environment file of a unit.  Secrets without
+// a default are left empty, for the user to fill in.
+func newSystemdEnvFile(environment map[string]string, secrets []string) []byte {
+	var names []string
+	for name := range environment {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var contents bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&contents, "%s=%s\n", name, systemdEnvQuote(environment[name]))
+	}
+	for _, name := range secrets {
+		fmt.Fprintf(&contents, "# %s is a secret without a default, it must be set\n", name)
+		fmt.Fprintf(&contents, "%s=\n", name)
+	}
+	return contents.Bytes()
+}
+
+// newSystemdInstallScript returns the script installing and starting the
+// units.  Existing environment files are kept, so that values set by the user
+// survive upgrades, while the deployment manifest is replaced.
+func newSystemdInstallScript(units []string, runtime string) []byte {
+	var script bytes.Buffer
+	fmt.Fprintf(&script, "#!/bin/sh\n")
+	fmt.Fprintf(&script, "# Generated by fissile: installs and starts the systemd units next to it\n")
+	fmt.Fprintf(&script, "set -o errexit -o nounset\n")
+	fmt.Fprintf(&script, "cd \"$(dirname \"$0\")\"\n\n")
+	fmt.Fprintf(&script, "%[1]s network inspect %[2]s >/dev/null 2>&1 || %[1]s network create %[2]s\n\n", runtime, systemdNetwork)
+	fmt.Fprintf(&script, "mkdir -p %s\n", systemdEnvDir)
+	fmt.Fprintf(&script, "for env in *.env ; do\n")
+	fmt.Fprintf(&script, "    if [ ! -e \"%s/${env}\" ] ; then\n", systemdEnvDir)
+	fmt.Fprintf(&script, "        install -m 0600 \"${env}\" \"%s/${env}\"\n", systemdEnvDir)
+	fmt.Fprintf(&script, "    fi\n")
+	fmt.Fprintf(&script, "done\n")
+	fmt.Fprintf(&script, "install -m 0644 %[1]s \"%[2]s/%[1]s\"\n\n", localDeploymentManifestName, systemdEnvDir)
+	fmt.Fprintf(&script, "install -m 0644 %s %s\n", strings.Join(units, " "), systemdUnitDir)
+	fmt.Fprintf(&script, "systemctl daemon-reload\n")
+	fmt.Fprintf(&script, "systemctl enable --now %s\n", strings.Join(units, " "))
+	return script.Bytes()
+}
+
+// systemdQuote quotes an argument of a systemd command line, which systemd
+// would otherwise split on whitespace and expand specifiers and variables in
+func systemdQuote(arg string) string {
+	arg = strings.Replace(arg, "%", "%%", -1)
+	arg = strings.Replace(arg, "$", "$$", -1)
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\;") {
+		return arg
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`)
+	return `"` + replacer.Replace(arg) + `"`
+}
+
+// systemdEnvQuote quotes a value of an environment file, keeping newlines
+func systemdEnvQuote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// shellQuote quotes an argument of a shell command line
+func shellQuote(arg string) string {
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateSystemd(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+	outputDir, err := ioutil.TempDir("", "fissile-systemd-")
+	require.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, ioutil.Discard, nil))
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/docker-compose.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/ntp-release"))
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	f.Options.LightOpinions = filepath.Join(workDir, "../test-assets/ntp-opinions/opinions.yml")
+	f.Options.DarkOpinions = filepath.Join(workDir, "../test-assets/ntp-opinions/dark-opinions.yml")
+	f.Options.RepositoryPrefix = "fissile"
+	require.NoError(t, f.LoadManifest())
+
+	require.NoError(t, f.GenerateSystemd(SystemdOptions{
+		OutputDir:      outputDir,
+		Runtime:        "podman",
+		InstanceGroups: []string{"client"},
+	}))
+
+	readFile := func(name string) string {
+		contents, err := ioutil.ReadFile(filepath.Join(outputDir, name))
+		require.NoError(t, err)
+		return string(contents)
+	}
+	_, err = os.Stat(filepath.Join(outputDir, "fissile-unrelated.service"))
+	assert.True(t, os.IsNotExist(err), "The unrelated instance group is left out")
+
+	client := readFile("fissile-client.service")
+	assert.Contains(t, client, "After=network-online.target fissile-server.service\n")
+	assert.Contains(t, client, "Requires=fissile-server.service\n")
+	assert.Contains(t, client, "EnvironmentFile=/etc/fissile/client.env\n")
+	assert.Contains(t, client, "ExecStartPre=-/usr/bin/podman rm --force fissile-client\n")
+	assert.Contains(t, client, "ExecStart=/usr/bin/podman run --rm --name fissile-client --network fissile --env KUBERNETES_CLUSTER_DOMAIN")
+	assert.Contains(t, client, "--env NTP_CONF --env PRIVATE_KEY")
+	assert.Contains(t, client, "Restart=always\n")
+	assert.Contains(t, client, "fissile-client:")
+
+	server := readFile("fissile-server.service")
+	assert.NotContains(t, server, "Requires=")
+	assert.Contains(t, server, "--network-alias server-ntpd --publish 123:123/udp --publish 8080:8080/tcp", "The ports of colocated containers are published by the main container")
+	assert.Contains(t, server, "--volume server-store:/var/vcap/store --volume /etc/fissile/deployment-manifest.yml:/opt/fissile/config/deployment-manifest.yml:ro --cap-add SYS_TIME")
+	assert.Contains(t, server, `--health-cmd "'/opt/fissile/readiness-probe.sh' 'ntpq -p'" --health-interval 5s`)
+	assert.Contains(t, server, "--env PRIVATE_KEY")
+
+	sidecar := readFile("fissile-sidecar.service")
+	assert.Contains(t, sidecar, "--network container:fissile-server")
+	assert.NotContains(t, sidecar, "--publish")
+	assert.Contains(t, sidecar, "--volume /etc/fissile/deployment-manifest.yml:/opt/fissile/config/deployment-manifest.yml:ro")
+	assert.Contains(t, readFile("deployment-manifest.yml"), `name: "server"`)
+
+	env := readFile("server.env")
+	assert.Contains(t, env, "NTP_CONF=\"server \\$POOL\"\n", "Values are quoted")
+	assert.Contains(t, env, "KUBERNETES_NAMESPACE=\"default\"\n")
+	assert.Contains(t, env, "\nPRIVATE_KEY=\n", "Secrets without a default are left empty")
+	assert.NotContains(t, env, "CONFIGGIN_SA_TOKEN")
+
+	script := readFile("install.sh")
+	assert.Contains(t, script, "podman network inspect fissile >/dev/null 2>&1 || podman network create fissile\n")
+	assert.Contains(t, script, "install -m 0644 deployment-manifest.yml \"/etc/fissile/deployment-manifest.yml\"\n")
+	assert.Contains(t, script, "systemctl enable --now fissile-server.service fissile-client.service fissile-sidecar.service\n")
+
+	assert.EqualError(t, f.GenerateSystemd(SystemdOptions{
+		OutputDir: outputDir,
+		Runtime:   "rkt",
+	}), "Invalid container runtime rkt, must be podman or docker")
+}
+
+func TestSystemdQuote(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "plain", systemdQuote("plain"))
+	assert.Equal(t, `""`, systemdQuote(""))
+	assert.Equal(t, `"two words"`, systemdQuote("two words"))
+	assert.Equal(t, `"say \"hi\""`, systemdQuote(`say "hi"`))
+	assert.Equal(t, "100%%$$HOME", systemdQuote("100%$HOME"))
+}
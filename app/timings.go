@@ -0,0 +1,488 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	"github.com/fatih/color"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// timingsFileName is the name of the timing database in the work directory
+const timingsFileName = "timings.json"
+
+// maxTimingSamples is the number of most recent durations kept per item
+const maxTimingSamples = 10
+
+// maxTimingEntries is the number of items of each kind kept in the database;
+// the items recorded least recently (e.g. of packages which were removed
+// from their release) are dropped first.
+const maxTimingEntries = 500
+
+// TimingDatabase holds the durations of package compilations and image
+// builds of past runs, to find the bottlenecks of a build, and the time per
+// step of operations, for estimating their remaining time.  A nil database
+// (when there is no work directory) records nothing.
+type TimingDatabase struct {
+	Packages map[string]*TimingEntry `json:"packages"`        // by release/package
+	Images   map[string]*TimingEntry `json:"images"`          // by instance group
+	Steps    map[string]*TimingEntry `json:"steps,omitempty"` // by operation
+
+	path    string
+	changed bool
+	mutex   sync.Mutex
+}
+
+// TimingEntry holds the most recent durations of an item, in seconds, oldest
+// first, and when the last of them was recorded (in unix seconds).  Packages
+// also list their dependencies, for finding the critical path of the
+// compilation.
+type TimingEntry struct {
+	Dependencies []string  `json:"dependencies,omitempty"`
+	Durations    []float64 `json:"durations"`
+	Recorded     int64     `json:"recorded,omitempty"`
+}
+
+// NewTimingDatabase returns an empty timing database saved to path
+func NewTimingDatabase(path string) *TimingDatabase {
+	return &TimingDatabase{
+		Packages: make(map[string]*TimingEntry),
+		Images:   make(map[string]*TimingEntry),
+		Steps:    make(map[string]*TimingEntry),
+		path:     path,
+	}
+}
+
+// LoadTimingDatabase reads the timing database at path; a missing file
+// results in an empty database.
+func LoadTimingDatabase(path string) (*TimingDatabase, error) {
+	db := NewTimingDatabase(path)
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading timing database %s: %v", path, err)
+	}
+	if err := json.Unmarshal(contents, db); err != nil {
+		return nil, fmt.Errorf("Error parsing timing database %s: %v", path, err)
+	}
+	if db.Packages == nil {
+		db.Packages = make(map[string]*TimingEntry)
+	}
+	if db.Images == nil {
+		db.Images = make(map[string]*TimingEntry)
+	}
+	if db.Steps == nil {
+		db.Steps = make(map[string]*TimingEntry)
+	}
+	return db, nil
+}
+
+// RecordPackage adds the compilation time of a package
+func (db *TimingDatabase) RecordPackage(pkg *model.Package, duration time.Duration) {
+	if db == nil {
+		return
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	dependencies := make([]string, 0, len(pkg.Dependencies))
+	for _, dependency := range pkg.Dependencies {
+		dependencies = append(dependencies, packageTimingName(dependency))
+	}
+	sort.Strings(dependencies)
+	entry := db.entry(db.Packages, packageTimingName(pkg))
+	entry.Dependencies = dependencies
+	entry.add(duration)
+	db.changed = true
+}
+
+// RecordImage adds the build time of the image of an instance group
+func (db *TimingDatabase) RecordImage(instanceGroup *model.InstanceGroup, duration time.Duration) {
+	if db == nil {
+		return
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.entry(db.Images, instanceGroup.Name).add(duration)
+	db.changed = true
+}
+
+// RecordStep adds the average time per step of a completed operation
+func (db *TimingDatabase) RecordStep(operation string, duration time.Duration) {
+	if db == nil {
+		return
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.entry(db.Steps, operation).add(duration)
+	db.changed = true
+}
+
+// EstimatePackage returns the average recorded compilation time of a
+// package, if any
+func (db *TimingDatabase) EstimatePackage(pkg *model.Package) (time.Duration, bool) {
+	if db == nil {
+		return 0, false
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.Packages[packageTimingName(pkg)].estimate()
+}
+
+// EstimateStep returns the average recorded time per step of an operation,
+// if any
+func (db *TimingDatabase) EstimateStep(operation string) (time.Duration, bool) {
+	if db == nil {
+		return 0, false
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	return db.Steps[operation].estimate()
+}
+
+// Save writes the database back to its file, if anything was recorded
+func (db *TimingDatabase) Save() error {
+	if db == nil {
+		return nil
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	if !db.changed {
+		return nil
+	}
+	for _, entries := range []map[string]*TimingEntry{db.Packages, db.Images, db.Steps} {
+		pruneTimingEntries(entries, maxTimingEntries)
+	}
+	contents, err := json.Marshal(db)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(db.path), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(db.path, contents, 0644); err != nil {
+		return err
+	}
+	db.changed = false
+	return nil
+}
+
+func (db *TimingDatabase) entry(entries map[string]*TimingEntry, name string) *TimingEntry {
+	entry, ok := entries[name]
+	if !ok {
+		entry = &TimingEntry{}
+		entries[name] = entry
+	}
+	return entry
+}
+
+// pruneTimingEntries removes the entries recorded least recently, so that at
+// most max entries are left
+func pruneTimingEntries(entries map[string]*TimingEntry, max int) {
+	if len(entries) <= max {
+		return
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := entries[names[i]], entries[names[j]]
+		if a.Recorded != b.Recorded {
+			return a.Recorded < b.Recorded
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names[:len(names)-max] {
+		delete(entries, name)
+	}
+}
+
+func (entry *TimingEntry) add(duration time.Duration) {
+	entry.Durations = append(entry.Durations, duration.Seconds())
+	if len(entry.Durations) > maxTimingSamples {
+		entry.Durations = entry.Durations[len(entry.Durations)-maxTimingSamples:]
+	}
+	entry.Recorded = time.Now().Unix()
+}
+
+// estimate returns the average of the recorded durations, if there are any
+func (entry *TimingEntry) estimate() (time.Duration, bool) {
+	if entry == nil || len(entry.Durations) == 0 {
+		return 0, false
+	}
+	return time.Duration(entry.average() * float64(time.Second)), true
+}
+
+// average returns the mean of the recorded durations
+func (entry *TimingEntry) average() float64 {
+	if len(entry.Durations) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, duration := range entry.Durations {
+		sum += duration
+	}
+	return sum / float64(len(entry.Durations))
+}
+
+func packageTimingName(pkg *model.Package) string {
+	return fmt.Sprintf("%s/%s", pkg.Release.Name, pkg.Name)
+}
+
+// TimingReport is the analysis of a timing database.  All durations are
+// averages, in seconds.
+type TimingReport struct {
+	Packages []TimingSummary `json:"packages" yaml:"packages"`
+	Images   []TimingSummary `json:"images" yaml:"images"`
+
+	// CriticalPath is the chain of dependent packages taking the longest
+	// to compile; no number of workers compiles faster than it.
+	CriticalPath         []string `json:"critical_path" yaml:"critical_path"`
+	CriticalPathDuration float64  `json:"critical_path_duration" yaml:"critical_path_duration"`
+	CompileDuration      float64  `json:"compile_duration" yaml:"compile_duration"`
+	ImagesDuration       float64  `json:"images_duration" yaml:"images_duration"`
+
+	// The worker counts beyond which adding workers is not expected to
+	// make compiling packages or building images faster
+	SuggestedCompileWorkers int `json:"suggested_compile_workers" yaml:"suggested_compile_workers"`
+	SuggestedImageWorkers   int `json:"suggested_image_workers" yaml:"suggested_image_workers"`
+}
+
+// TimingSummary is the timing of a single package or image
+type TimingSummary struct {
+	Name    string  `json:"name" yaml:"name"`
+	Runs    int     `json:"runs" yaml:"runs"`
+	Last    float64 `json:"last" yaml:"last"`
+	Average float64 `json:"average" yaml:"average"`
+}
+
+// Report analyzes the database.  Packages and images are sorted by their
+// average duration, longest first.
+func (db *TimingDatabase) Report() TimingReport {
+	report := TimingReport{
+		Packages: summarizeTimings(db.Packages),
+		Images:   summarizeTimings(db.Images),
+	}
+
+	longestImage := 0.0
+	for _, summary := range report.Images {
+		report.ImagesDuration += summary.Average
+		longestImage = math.Max(longestImage, summary.Average)
+	}
+	for _, summary := range report.Packages {
+		report.CompileDuration += summary.Average
+	}
+
+	report.CriticalPath, report.CriticalPathDuration = db.criticalPath()
+	report.SuggestedCompileWorkers = suggestWorkers(report.CompileDuration, report.CriticalPathDuration, len(report.Packages))
+	report.SuggestedImageWorkers = suggestWorkers(report.ImagesDuration, longestImage, len(report.Images))
+	return report
+}
+
+// criticalPath returns the chain of dependent packages with the longest
+// total compilation time, dependencies first.  Dependencies without
+// recorded timings (e.g. compiled before the database existed) are ignored.
+func (db *TimingDatabase) criticalPath() ([]string, float64) {
+	type pathInfo struct {
+		duration float64
+		next     string // the dependency continuing the path
+	}
+	paths := make(map[string]pathInfo)
+	visiting := make(map[string]bool)
+
+	var longest func(name string) float64
+	longest = func(name string) float64 {
+		if info, ok := paths[name]; ok {
+			return info.duration
+		}
+		entry, ok := db.Packages[name]
+		if !ok || visiting[name] {
+			return 0
+		}
+		visiting[name] = true
+		info := pathInfo{}
+		for _, dependency := range entry.Dependencies {
+			if _, ok := db.Packages[dependency]; !ok {
+				continue
+			}
+			if duration := longest(dependency); info.next == "" || duration > info.duration {
+				info = pathInfo{duration: duration, next: dependency}
+			}
+		}
+		info.duration += entry.average()
+		visiting[name] = false
+		paths[name] = info
+		return info.duration
+	}
+
+	names := make([]string, 0, len(db.Packages))
+	for name := range db.Packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	start := ""
+	duration := 0.0
+	for _, name := range names {
+		if pathDuration := longest(name); start == "" || pathDuration > duration {
+			start, duration = name, pathDuration
+		}
+	}
+
+	path := []string{}
+	for name := start; name != ""; name = paths[name].next {
+		path = append([]string{name}, path...)
+	}
+	return path, duration
+}
+
+// suggestWorkers returns the number of workers needed to finish the total
+// work in the time of the longest sequence of it, capped by the number of
+// items.
+func suggestWorkers(total, longest float64, items int) int {
+	if items == 0 {
+		return 0
+	}
+	if longest <= 0 {
+		return 1
+	}
+	workers := int(math.Ceil(total/longest - 1e-9))
+	if workers > items {
+		workers = items
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+func summarizeTimings(entries map[string]*TimingEntry) []TimingSummary {
+	summaries := make([]TimingSummary, 0, len(entries))
+	for name, entry := range entries {
+		if len(entry.Durations) == 0 {
+			continue
+		}
+		summaries = append(summaries, TimingSummary{
+			Name:    name,
+			Runs:    len(entry.Durations),
+			Last:    entry.Durations[len(entry.Durations)-1],
+			Average: entry.average(),
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Average != summaries[j].Average {
+			return summaries[i].Average > summaries[j].Average
+		}
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries
+}
+
+// Timings returns the timing database of the work directory, which is read
+// on first use.  Timings only help analyzing builds, so a broken database is
+// replaced.
+func (f *Fissile) Timings() *TimingDatabase {
+	if f.timingsLoaded {
+		return f.timings
+	}
+	f.timingsLoaded = true
+	if f.Options.WorkDir == "" {
+		return nil
+	}
+	path := filepath.Join(f.Options.WorkDir, timingsFileName)
+	db, err := LoadTimingDatabase(path)
+	if err != nil {
+		f.UI.Println(color.YellowString("Warning: %v; starting a new one", err))
+		db = NewTimingDatabase(path)
+	}
+	f.timings = db
+	return db
+}
+
+// saveTimings writes the timing database, warning about failures.
+func (f *Fissile) saveTimings(db *TimingDatabase) {
+	if err := db.Save(); err != nil {
+		f.UI.Println(color.YellowString("Warning: failed to save the timing database: %v", err))
+	}
+}
+
+// ShowTimings displays the durations of package compilations and image
+// builds recorded in the work directory, the critical path of compiling the
+// packages, and the worker counts beyond which builds do not get faster.
+func (f *Fissile) ShowTimings() error {
+	db, err := LoadTimingDatabase(filepath.Join(f.Options.WorkDir, timingsFileName))
+	if err != nil {
+		return err
+	}
+	report := db.Report()
+
+	switch f.Options.OutputFormat {
+	case OutputFormatHuman:
+		f.showTimingsForHuman(report)
+	case OutputFormatJSON:
+		buf, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	case OutputFormatYAML:
+		buf, err := yaml.Marshal(report)
+		if err != nil {
+			return err
+		}
+		f.UI.Printf("%s", buf)
+	default:
+		return fmt.Errorf("Invalid output format '%s', expected one of human, json, or yaml", f.Options.OutputFormat)
+	}
+
+	return nil
+}
+
+func (f *Fissile) showTimingsForHuman(report TimingReport) {
+	if len(report.Packages) == 0 && len(report.Images) == 0 {
+		f.UI.Println("No timings recorded yet; compile packages or build images first.")
+		return
+	}
+
+	seconds := func(value float64) string {
+		return time.Duration(value * float64(time.Second)).Round(time.Second).String()
+	}
+
+	if len(report.Packages) > 0 {
+		f.UI.Println(color.GreenString("Package compilation:"))
+		table := termui.NewTable("Package", "Runs", "Last", "Average")
+		for _, summary := range report.Packages {
+			table.Add(summary.Name, fmt.Sprintf("%d", summary.Runs), seconds(summary.Last), seconds(summary.Average))
+		}
+		f.printTable(table)
+
+		f.UI.Printf("\nCritical path (%s of %s total):\n",
+			color.YellowString(seconds(report.CriticalPathDuration)),
+			seconds(report.CompileDuration))
+		for _, name := range report.CriticalPath {
+			f.UI.Printf("  %s\n", name)
+		}
+		f.UI.Printf("Suggested compilation workers: %s\n\n", color.YellowString("%d", report.SuggestedCompileWorkers))
+	}
+
+	if len(report.Images) > 0 {
+		f.UI.Println(color.GreenString("Image builds:"))
+		table := termui.NewTable("Instance Group", "Runs", "Last", "Average")
+		for _, summary := range report.Images {
+			table.Add(summary.Name, fmt.Sprintf("%d", summary.Runs), seconds(summary.Last), seconds(summary.Average))
+		}
+		f.printTable(table)
+		f.UI.Printf("Suggested image build workers: %s\n", color.YellowString("%d", report.SuggestedImageWorkers))
+	}
+}
@@ -0,0 +1,161 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimingDatabaseRecord(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "fissile-timings-")
+	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
+	path := filepath.Join(workDir, timingsFileName)
+
+	db, err := LoadTimingDatabase(path)
+	require.NoError(t, err)
+	require.NoError(t, db.Save())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "Nothing recorded, nothing saved")
+
+	release := &model.Release{Name: "rel"}
+	golang := &model.Package{Name: "golang", Release: release}
+	app := &model.Package{Name: "app", Release: release, Dependencies: model.Packages{golang}}
+	for i := 1; i <= maxTimingSamples+2; i++ {
+		db.RecordPackage(app, time.Duration(i)*time.Second)
+	}
+	db.RecordImage(&model.InstanceGroup{Name: "api"}, 30*time.Second)
+	require.NoError(t, db.Save())
+
+	db, err = LoadTimingDatabase(path)
+	require.NoError(t, err)
+	require.Contains(t, db.Packages, "rel/app")
+	assert.Equal(t, []string{"rel/golang"}, db.Packages["rel/app"].Dependencies)
+	assert.Len(t, db.Packages["rel/app"].Durations, maxTimingSamples)
+	assert.Equal(t, float64(maxTimingSamples+2), db.Packages["rel/app"].Durations[maxTimingSamples-1])
+	assert.Equal(t, []float64{30}, db.Images["api"].Durations)
+
+	estimate, ok := db.EstimatePackage(app)
+	assert.True(t, ok)
+	assert.Equal(t, 7500*time.Millisecond, estimate)
+	_, ok = db.EstimatePackage(golang)
+	assert.False(t, ok)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+	_, err = LoadTimingDatabase(path)
+	assert.Contains(t, err.Error(), "Error parsing timing database")
+}
+
+func TestTimingDatabasePrune(t *testing.T) {
+	entries := map[string]*TimingEntry{
+		"new":     {Durations: []float64{1}, Recorded: 300},
+		"old":     {Durations: []float64{1}, Recorded: 100},
+		"legacy":  {Durations: []float64{1}},
+		"current": {Durations: []float64{1}, Recorded: 200},
+	}
+	pruneTimingEntries(entries, 2)
+	assert.Len(t, entries, 2)
+	assert.Contains(t, entries, "new")
+	assert.Contains(t, entries, "current")
+
+	pruneTimingEntries(entries, 5)
+	assert.Len(t, entries, 2, "Nothing is pruned below the limit")
+}
+
+func TestTimingsCorrupt(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "fissile-timings-")
+	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
+	path := filepath.Join(workDir, timingsFileName)
+	require.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+
+	output := &bytes.Buffer{}
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+	f.Options.WorkDir = workDir
+
+	db := f.Timings()
+	require.NotNil(t, db)
+	assert.Contains(t, output.String(), "Error parsing timing database")
+	assert.Contains(t, output.String(), "starting a new one")
+	assert.Empty(t, db.Packages)
+
+	// The broken database is replaced once something is recorded
+	db.RecordImage(&model.InstanceGroup{Name: "api"}, 30*time.Second)
+	f.saveTimings(db)
+	db, err = LoadTimingDatabase(path)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{30}, db.Images["api"].Durations)
+}
+
+func TestTimingDatabaseReport(t *testing.T) {
+	db := &TimingDatabase{
+		Packages: map[string]*TimingEntry{
+			"rel/golang": {Durations: []float64{50, 70}},
+			"rel/ruby":   {Durations: []float64{40}},
+			"rel/app":    {Dependencies: []string{"rel/golang", "rel/ruby"}, Durations: []float64{20}},
+			"rel/tool":   {Dependencies: []string{"rel/unknown"}, Durations: []float64{10}},
+		},
+		Images: map[string]*TimingEntry{
+			"api":    {Durations: []float64{30}},
+			"router": {Durations: []float64{10, 20}},
+		},
+	}
+
+	report := db.Report()
+	assert.Equal(t, []TimingSummary{
+		{Name: "rel/golang", Runs: 2, Last: 70, Average: 60},
+		{Name: "rel/ruby", Runs: 1, Last: 40, Average: 40},
+		{Name: "rel/app", Runs: 1, Last: 20, Average: 20},
+		{Name: "rel/tool", Runs: 1, Last: 10, Average: 10},
+	}, report.Packages)
+	assert.Equal(t, []string{"rel/golang", "rel/app"}, report.CriticalPath)
+	assert.Equal(t, 80.0, report.CriticalPathDuration)
+	assert.Equal(t, 130.0, report.CompileDuration)
+	assert.Equal(t, 2, report.SuggestedCompileWorkers)
+	assert.Equal(t, 45.0, report.ImagesDuration)
+	assert.Equal(t, 2, report.SuggestedImageWorkers)
+}
+
+func TestShowTimings(t *testing.T) {
+	workDir, err := ioutil.TempDir("", "fissile-timings-")
+	require.NoError(t, err)
+	defer os.RemoveAll(workDir)
+
+	output := &bytes.Buffer{}
+	f := NewFissileApplication(".", termui.New(&bytes.Buffer{}, output, nil))
+	f.Options.WorkDir = workDir
+	f.Options.OutputFormat = OutputFormatHuman
+
+	require.NoError(t, f.ShowTimings())
+	assert.Contains(t, output.String(), "No timings recorded yet")
+
+	db, err := LoadTimingDatabase(filepath.Join(workDir, timingsFileName))
+	require.NoError(t, err)
+	db.RecordImage(&model.InstanceGroup{Name: "api"}, 90*time.Second)
+	require.NoError(t, db.Save())
+
+	output.Reset()
+	require.NoError(t, f.ShowTimings())
+	assert.Contains(t, output.String(), "api")
+	assert.Contains(t, output.String(), "1m30s")
+	assert.Contains(t, output.String(), "Suggested image build workers: 1")
+
+	output.Reset()
+	f.Options.OutputFormat = OutputFormatJSON
+	require.NoError(t, f.ShowTimings())
+	var report TimingReport
+	require.NoError(t, json.Unmarshal(output.Bytes(), &report))
+	assert.Equal(t, []TimingSummary{{Name: "api", Runs: 1, Last: 90, Average: 90}}, report.Images)
+
+	f.Options.OutputFormat = "bogus"
+	assert.EqualError(t, f.ShowTimings(), "Invalid output format 'bogus', expected one of human, json, or yaml")
+}
@@ -5,38 +5,67 @@ import (
 	"strings"
 
 	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
 	"code.cloudfoundry.org/fissile/validation"
+	"github.com/fatih/color"
 
 	yaml "gopkg.in/yaml.v2"
 )
 
+// ValidateOptions contains all option values for the `fissile validate`
+// command.
+type ValidateOptions struct {
+	StrictVariables bool // Report unused variables as errors instead of warnings
+}
+
 // Validate applies a series of checks to the role
 // manifest and opinions, testing for consistency against each other
 // and the loaded bosh releases. The result is a (possibly empty)
-// array of any issues found.
-func (f *Fissile) Validate() validation.ErrorList {
+// array of any issues found.  Unused variables are printed as warnings,
+// unless the options make them errors.
+func (f *Fissile) Validate(opt ValidateOptions) validation.ErrorList {
 	errors := make(chan *validation.Error)
-	validator, err := newValidator(f, errors)
+	warnings := make(chan *validation.Error)
+	validator, err := newValidator(f, errors, warnings)
 	if err != nil {
 		return validation.ErrorList{err}
 	}
 	go validator.validate()
 	allErrs := validation.ErrorList{}
-	for err := range errors {
-		allErrs = append(allErrs, err)
+	for errors != nil || warnings != nil {
+		select {
+		case err, ok := <-errors:
+			if !ok {
+				errors = nil
+				continue
+			}
+			allErrs = append(allErrs, err)
+		case warning, ok := <-warnings:
+			if !ok {
+				warnings = nil
+				continue
+			}
+			if opt.StrictVariables {
+				allErrs = append(allErrs, warning)
+			} else {
+				f.UI.Printf("%s %s\n", color.YellowString("Warning:"), warning.Error())
+			}
+		}
 	}
+	f.warnBudgetExceeded(f.Manifest)
 	return allErrs
 }
 
 type validator struct {
 	errOut        chan<- *validation.Error
+	warnOut       chan<- *validation.Error
 	f             *Fissile
 	lightOpinions map[string]string
 	darkOpinions  map[string]string
 	variableUsage map[string]int
 }
 
-func newValidator(f *Fissile, errOut chan<- *validation.Error) (*validator, *validation.Error) {
+func newValidator(f *Fissile, errOut, warnOut chan<- *validation.Error) (*validator, *validation.Error) {
 	opinions, err := model.NewOpinions(f.Options.LightOpinions, f.Options.DarkOpinions)
 	if err != nil {
 		return nil, validation.GeneralError("Light are dark opinions could not be read", err)
@@ -44,6 +73,7 @@ func newValidator(f *Fissile, errOut chan<- *validation.Error) (*validator, *val
 
 	return &validator{
 		errOut:        errOut,
+		warnOut:       warnOut,
 		f:             f,
 		lightOpinions: model.FlattenOpinions(opinions.Light, false),
 		darkOpinions:  model.FlattenOpinions(opinions.Dark, false),
@@ -53,6 +83,7 @@ func newValidator(f *Fissile, errOut chan<- *validation.Error) (*validator, *val
 
 func (v *validator) validate() {
 	defer close(v.errOut)
+	defer close(v.warnOut)
 
 	allPropertyDefaults := v.f.collectPropertyDefaults()
 
@@ -121,6 +152,7 @@ func (v *validator) validate() {
 	v.checkTemplateInvalidExpansion()
 	v.checkNonConstantTemplates()
 	v.checkForSortedVariables(v.f.Manifest.Variables)
+	v.checkPatternVariables(v.f.Manifest.Variables)
 	for propertyName, templateDef := range v.f.Manifest.Configuration.Templates {
 		if templateDef.IsGlobal {
 			v.checkForUndefinedVariable("configuration.templates", propertyName, templateDef.Value)
@@ -128,7 +160,7 @@ func (v *validator) validate() {
 	}
 	for variableName, variableUsageCount := range v.variableUsage {
 		if variableUsageCount == 0 {
-			v.errOut <- validation.NotFound(
+			v.warnOut <- validation.NotFound(
 				"variables",
 				fmt.Sprintf("No templates using '%s'", variableName))
 		}
@@ -226,6 +258,58 @@ func (v *validator) checkForSortedVariables(variables model.Variables) {
 	}
 }
 
+// checkPatternVariables checks that the variables set from feature flags and
+// from the sizing of instance groups refer to existing ones
+func (v *validator) checkPatternVariables(variables model.Variables) {
+	for _, cv := range variables {
+		field := fmt.Sprintf("variables[%s]", cv.Name)
+
+		if match := model.FeatureVariablePattern.FindStringSubmatch(cv.Name); match != nil {
+			feature := strings.ToLower(match[1])
+			if _, ok := v.f.Manifest.Features[feature]; !ok {
+				v.errOut <- validation.NotFound(field, fmt.Sprintf("No feature '%s'", feature))
+			}
+			continue
+		}
+
+		var instanceGroupName, portName string
+		if match := model.SizingCountVariablePattern.FindStringSubmatch(cv.Name); match != nil {
+			instanceGroupName = util.ConvertNameToKey(match[1])
+		} else if match := model.SizingPortsVariablePattern.FindStringSubmatch(cv.Name); match != nil {
+			instanceGroupName = util.ConvertNameToKey(match[1])
+			portName = util.ConvertNameToKey(match[2])
+		} else {
+			continue
+		}
+
+		if cv.CVOptions.Secret {
+			v.errOut <- validation.Forbidden(field, "Sizing variables cannot be secrets")
+		}
+		instanceGroup := v.f.Manifest.LookupInstanceGroup(instanceGroupName)
+		if instanceGroup == nil {
+			v.errOut <- validation.NotFound(field, fmt.Sprintf("No instance group '%s'", instanceGroupName))
+			continue
+		}
+		if portName != "" && !hasConfigurablePort(instanceGroup, portName) {
+			v.errOut <- validation.NotFound(field,
+				fmt.Sprintf("No user configurable port '%s' in instance group '%s'", portName, instanceGroupName))
+		}
+	}
+}
+
+// hasConfigurablePort returns true if the instance group exposes the named
+// port with a user configurable port or count
+func hasConfigurablePort(instanceGroup *model.InstanceGroup, portName string) bool {
+	for _, jobReference := range instanceGroup.JobReferences {
+		for _, port := range jobReference.ContainerProperties.BoshContainerization.Ports {
+			if port.Name == portName && (port.PortIsConfigurable || port.CountIsConfigurable) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // checkForUndefinedVariables checks that all configuration templates are
 // defined in the variables section
 func (v *validator) checkForUndefinedVariable(label, propertyName, templateValue string) {
@@ -88,7 +88,7 @@ func TestValidation(t *testing.T) {
 				assert.NoError(t, err)
 				require.NotNil(t, f.Manifest, "error loading role manifest")
 
-				errs := f.Validate()
+				errs := f.Validate(ValidateOptions{StrictVariables: true})
 				if len(testData.Errors) == 0 {
 					assert.Empty(t, errs)
 					return
@@ -103,6 +103,31 @@ func TestValidation(t *testing.T) {
 
 }
 
+func TestValidationUnusedVariableWarnings(t *testing.T) {
+	output := &bytes.Buffer{}
+	ui := termui.New(&bytes.Buffer{}, output, nil)
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	f := NewFissileApplication(".", ui)
+	f.Options.RoleManifest = filepath.Join(workDir, "../test-assets/role-manifests/app/validation/variables-without-usage.yml")
+	f.Options.Releases = append(f.Options.Releases, filepath.Join(workDir, "../test-assets/tor-boshrelease"))
+	f.Options.LightOpinions = filepath.Join(workDir, "../test-assets/tor-opinions/opinions.yml")
+	f.Options.DarkOpinions = filepath.Join(workDir, "../test-assets/tor-opinions/dark-opinions.yml")
+	f.Options.CacheDir = filepath.Join(workDir, "../test-assets/bosh-cache")
+	require.NoError(t, f.LoadManifest())
+
+	errs := f.Validate(ValidateOptions{})
+	assert.NotContains(t, errs.ErrorStrings(), `variables: Not found: "No templates using 'UNUSED_VARIABLE'"`)
+	assert.Contains(t, output.String(), `variables: Not found: "No templates using 'UNUSED_VARIABLE'"`)
+
+	output.Reset()
+	errs = f.Validate(ValidateOptions{StrictVariables: true})
+	assert.Contains(t, errs.ErrorStrings(), `variables: Not found: "No templates using 'UNUSED_VARIABLE'"`)
+	assert.NotContains(t, output.String(), "UNUSED_VARIABLE")
+}
+
 func TestMandatoryDescriptions(t *testing.T) {
 	ui := termui.New(&bytes.Buffer{}, ioutil.Discard, nil)
 
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/model/resolver"
+	"code.cloudfoundry.org/fissile/validation"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// vmTypesFile is the file mapping the BOSH vm_type of instance groups to
+// resource requests, in the style of the vm_types of a BOSH cloud config
+type vmTypesFile struct {
+	VMTypes []vmType `yaml:"vm_types"`
+}
+
+// vmType holds the resource requests of a BOSH vm_type.  Memory is in MiB,
+// CPU in cores, like the requests of instance groups.
+type vmType struct {
+	Name   string   `yaml:"name"`
+	Memory *int64   `yaml:"memory"`
+	CPU    *float64 `yaml:"cpu"`
+}
+
+// ApplyVMTypes sets the memory and cpu requests of the instance groups of the
+// role manifest with a vm_type from the requests of that vm_type in the file.
+// Requests set in the role manifest take precedence.  Instance groups without
+// a vm_type are left as they are; the error lists the vm_types missing from
+// the file, and invalid entries of the file.  The resources of the role
+// manifest are validated again afterwards, as the requests may now exceed the
+// limits or pod budgets.  An empty path does nothing.
+func ApplyVMTypes(roleManifest *model.RoleManifest, path string) error {
+	if path == "" {
+		return nil
+	}
+
+	vmTypes, err := readVMTypesFile(path)
+	if err != nil {
+		return err
+	}
+
+	allErrs := validation.ErrorList{}
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		if instanceGroup.VMType == "" || instanceGroup.Run == nil {
+			continue
+		}
+		vmType, ok := vmTypes[instanceGroup.VMType]
+		if !ok {
+			allErrs = append(allErrs, validation.NotFound(
+				fmt.Sprintf("instance_groups[%s].vm_type", instanceGroup.Name), instanceGroup.VMType))
+			continue
+		}
+		if vmType.Memory != nil {
+			if instanceGroup.Run.Memory == nil {
+				instanceGroup.Run.Memory = &model.RoleRunMemory{}
+			}
+			if instanceGroup.Run.Memory.Request == nil {
+				request := *vmType.Memory
+				instanceGroup.Run.Memory.Request = &request
+			}
+		}
+		if vmType.CPU != nil {
+			if instanceGroup.Run.CPU == nil {
+				instanceGroup.Run.CPU = &model.RoleRunCPU{}
+			}
+			if instanceGroup.Run.CPU.Request == nil {
+				request := *vmType.CPU
+				instanceGroup.Run.CPU.Request = &request
+			}
+		}
+	}
+
+	if len(allErrs) != 0 {
+		return fmt.Errorf("Invalid vm_types of instance groups:\n%s", allErrs.Error())
+	}
+	if allErrs := resolver.ValidateResources(roleManifest); len(allErrs) != 0 {
+		return fmt.Errorf("Invalid resources of instance groups with vm_types from %s:\n%s", path, allErrs.Error())
+	}
+	return nil
+}
+
+// readVMTypesFile returns the vm_types of the file, by name
+func readVMTypesFile(path string) (map[string]vmType, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading vm_types file %s: %v", path, err)
+	}
+	var file vmTypesFile
+	if err := yaml.UnmarshalStrict(contents, &file); err != nil {
+		return nil, fmt.Errorf("Error reading vm_types file %s: %v", path, err)
+	}
+
+	allErrs := validation.ErrorList{}
+	vmTypes := make(map[string]vmType)
+	for index, vmType := range file.VMTypes {
+		field := fmt.Sprintf("%s: vm_types[%d]", path, index)
+		if vmType.Name == "" {
+			allErrs = append(allErrs, validation.Required(field+".name", ""))
+			continue
+		}
+		if _, ok := vmTypes[vmType.Name]; ok {
+			allErrs = append(allErrs, validation.Duplicate(field+".name", vmType.Name))
+			continue
+		}
+		if vmType.Memory != nil {
+			allErrs = append(allErrs, validation.ValidateNonnegativeField(*vmType.Memory, field+".memory")...)
+		}
+		if vmType.CPU != nil {
+			allErrs = append(allErrs, validation.ValidateNonnegativeFieldFloat(*vmType.CPU, field+".cpu")...)
+		}
+		vmTypes[vmType.Name] = vmType
+	}
+
+	if len(allErrs) != 0 {
+		return nil, fmt.Errorf("Invalid vm_types file %s:\n%s", path, allErrs.Error())
+	}
+	return vmTypes, nil
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func vmTypesTestManifest() *model.RoleManifest {
+	memory := int64(256)
+	return &model.RoleManifest{
+		InstanceGroups: model.InstanceGroups{
+			{
+				Name:   "small",
+				VMType: "small",
+				Run: &model.RoleRun{
+					Memory: &model.RoleRunMemory{},
+					CPU:    &model.RoleRunCPU{},
+				},
+			},
+			{
+				Name:   "explicit",
+				VMType: "large",
+				Run: &model.RoleRun{
+					Memory: &model.RoleRunMemory{Request: &memory},
+					CPU:    &model.RoleRunCPU{},
+				},
+			},
+			{
+				Name: "untyped",
+				Run: &model.RoleRun{
+					Memory: &model.RoleRunMemory{},
+					CPU:    &model.RoleRunCPU{},
+				},
+			},
+		},
+	}
+}
+
+func TestApplyVMTypes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fissile-vm-types-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("Requests", func(t *testing.T) {
+		path := writeDefaultsFile(t, dir, "vm-types.yml", `---
+vm_types:
+- name: small
+  memory: 1024
+  cpu: 0.5
+- name: large
+  memory: 4096
+  cpu: 2
+`)
+
+		roleManifest := vmTypesTestManifest()
+		require.NoError(t, ApplyVMTypes(roleManifest, path))
+
+		small := roleManifest.InstanceGroups[0].Run
+		require.NotNil(t, small.Memory.Request)
+		assert.Equal(t, int64(1024), *small.Memory.Request)
+		require.NotNil(t, small.CPU.Request)
+		assert.Equal(t, 0.5, *small.CPU.Request)
+		assert.Nil(t, small.Memory.Limit, "Limits are not set")
+
+		explicit := roleManifest.InstanceGroups[1].Run
+		assert.Equal(t, int64(256), *explicit.Memory.Request, "The role manifest takes precedence")
+		require.NotNil(t, explicit.CPU.Request)
+		assert.Equal(t, 2.0, *explicit.CPU.Request)
+
+		untyped := roleManifest.InstanceGroups[2].Run
+		assert.Nil(t, untyped.Memory.Request)
+		assert.Nil(t, untyped.CPU.Request)
+	})
+
+	t.Run("NoFile", func(t *testing.T) {
+		roleManifest := vmTypesTestManifest()
+		require.NoError(t, ApplyVMTypes(roleManifest, ""))
+		assert.Nil(t, roleManifest.InstanceGroups[0].Run.Memory.Request)
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		path := writeDefaultsFile(t, dir, "unknown.yml", "vm_types:\n- name: small\n  memory: 1024\n")
+
+		err := ApplyVMTypes(vmTypesTestManifest(), path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `instance_groups[explicit].vm_type: Not found: "large"`)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		path := writeDefaultsFile(t, dir, "invalid.yml", `---
+vm_types:
+- name: small
+  memory: -1
+- name: small
+- memory: 1024
+`)
+
+		err := ApplyVMTypes(vmTypesTestManifest(), path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "vm_types[0].memory: Invalid value: -1: must be greater than or equal to 0")
+		assert.Contains(t, err.Error(), `vm_types[1].name: Duplicate value: "small"`)
+		assert.Contains(t, err.Error(), "vm_types[2].name: Required value")
+	})
+
+	t.Run("ExceedsLimit", func(t *testing.T) {
+		path := writeDefaultsFile(t, dir, "limits.yml", "vm_types:\n- name: small\n  memory: 1024\n  cpu: 0.5\n- name: large\n")
+
+		roleManifest := vmTypesTestManifest()
+		limit := int64(512)
+		roleManifest.InstanceGroups[0].Run.Memory.Limit = &limit
+
+		err := ApplyVMTypes(roleManifest, path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "instance_groups[small].run.memory.limit: Invalid value: 512: the limit is smaller than the request of 1024")
+	})
+
+	t.Run("ExceedsPodBudget", func(t *testing.T) {
+		path := writeDefaultsFile(t, dir, "budget.yml", "vm_types:\n- name: small\n  memory: 1024\n  cpu: 0.5\n- name: large\n")
+
+		roleManifest := vmTypesTestManifest()
+		budget := int64(512)
+		roleManifest.InstanceGroups[0].Run.PodBudget = &model.RoleRunBudget{Memory: &budget}
+
+		err := ApplyVMTypes(roleManifest, path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "instance_groups[small].run.pod-budget.memory: Invalid value: 512: the memory requests of the containers add up to 1024")
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		path := writeDefaultsFile(t, dir, "malformed.yml", "vm_types:\n- name: small\n  disk: 1024\n")
+
+		err := ApplyVMTypes(vmTypesTestManifest(), path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "Error reading vm_types file")
+	})
+}
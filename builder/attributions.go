@@ -0,0 +1,145 @@
+package builder
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+)
+
+// AttributionsFileName is the name of the file holding the aggregated
+// licenses of the releases, in charts, kube configs, and images
+const AttributionsFileName = "ATTRIBUTIONS.txt"
+
+// attributionsImagePath is where the attributions are written in role images
+const attributionsImagePath = "root/usr/share/doc/fissile/" + AttributionsFileName
+
+// AttributionFile is a LICENSE or NOTICE file of a release or package
+type AttributionFile struct {
+	Name     string `json:"name" yaml:"name"`
+	Contents string `json:"contents" yaml:"contents"`
+}
+
+// Attribution holds the license files of a release, or of one of its packages
+type Attribution struct {
+	Release string            `json:"release" yaml:"release"`
+	Version string            `json:"version" yaml:"version"`
+	Package string            `json:"package,omitempty" yaml:"package,omitempty"`
+	Files   []AttributionFile `json:"files" yaml:"files"`
+}
+
+// CollectAttributions returns the license files of the releases, followed by
+// those of their packages, sorted by release and package name.  The files of
+// packages are those found in their source archives, which must have been
+// downloaded.
+func CollectAttributions(releases model.Releases) ([]Attribution, error) {
+	return collectAttributions(releases, func(*model.Package) bool { return true })
+}
+
+// collectInstanceGroupAttributions returns the license files of the releases
+// of the jobs of the instance group, and of the packages of those jobs
+func collectInstanceGroupAttributions(instanceGroup *model.InstanceGroup) ([]Attribution, error) {
+	var releases model.Releases
+	seenReleases := map[string]bool{}
+	packages := map[*model.Package]bool{}
+	for _, jobReference := range instanceGroup.JobReferences {
+		if !seenReleases[jobReference.Release.Name] {
+			seenReleases[jobReference.Release.Name] = true
+			releases = append(releases, jobReference.Release)
+		}
+		for _, pkg := range jobReference.Packages {
+			packages[pkg] = true
+		}
+	}
+	return collectAttributions(releases, func(pkg *model.Package) bool { return packages[pkg] })
+}
+
+func collectAttributions(releases model.Releases, includePackage func(*model.Package) bool) ([]Attribution, error) {
+	releases = append(model.Releases{}, releases...)
+	sort.Slice(releases, func(i, j int) bool { return releases[i].Name < releases[j].Name })
+
+	var attributions []Attribution
+	for _, release := range releases {
+		if files := attributionFiles(release.License.Files); len(files) > 0 {
+			attributions = append(attributions, Attribution{
+				Release: release.Name,
+				Version: release.Version,
+				Files:   files,
+			})
+		}
+
+		packages := append(model.Packages{}, release.Packages...)
+		sort.Sort(packages)
+		for _, pkg := range packages {
+			if !includePackage(pkg) {
+				continue
+			}
+			files, err := packageLicenseFiles(pkg)
+			if err != nil {
+				return nil, err
+			}
+			if len(files) > 0 {
+				attributions = append(attributions, Attribution{
+					Release: release.Name,
+					Version: release.Version,
+					Package: pkg.Name,
+					Files:   files,
+				})
+			}
+		}
+	}
+	return attributions, nil
+}
+
+// packageLicenseFiles returns the license files in the archive of the package
+func packageLicenseFiles(pkg *model.Package) ([]AttributionFile, error) {
+	archive, err := os.Open(pkg.Path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("The archive of package %s/%s is not in the BOSH cache, so its licenses cannot be read", pkg.Release.Name, pkg.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	files, err := util.LoadLicenseFiles(pkg.Path, archive, util.DefaultLicensePrefixFilters...)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading the licenses of package %s/%s: %v", pkg.Release.Name, pkg.Name, err)
+	}
+	return attributionFiles(files), nil
+}
+
+// attributionFiles returns the license files sorted by name
+func attributionFiles(files map[string][]byte) []AttributionFile {
+	var result []AttributionFile
+	for name, contents := range files {
+		result = append(result, AttributionFile{Name: strings.TrimPrefix(name, "./"), Contents: string(contents)})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// WriteAttributions writes the attributions as a single text document
+func WriteAttributions(w io.Writer, attributions []Attribution) error {
+	separator := strings.Repeat("=", 80)
+	if _, err := fmt.Fprintf(w, "This product includes the following BOSH releases and packages.\n"); err != nil {
+		return err
+	}
+	for _, attribution := range attributions {
+		subject := fmt.Sprintf("Release %s %s", attribution.Release, attribution.Version)
+		if attribution.Package != "" {
+			subject += fmt.Sprintf(", package %s", attribution.Package)
+		}
+		for _, file := range attribution.Files {
+			_, err := fmt.Fprintf(w, "\n%s\n%s: %s\n%s\n\n%s\n", separator, subject, file.Name, separator, strings.TrimRight(file.Contents, "\n"))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
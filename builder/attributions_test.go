@@ -0,0 +1,69 @@
+package builder
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/model/loader"
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectAttributions(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/builder/tor-good.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{filepath.Join(workDir, "../test-assets/tor-boshrelease")},
+			BOSHCacheDir:     filepath.Join(workDir, "../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+
+	_, err = CollectAttributions(roleManifest.LoadedReleases)
+	assert.EqualError(err, "The archive of package tor/libevent is not in the BOSH cache, so its licenses cannot be read")
+
+	archiveDir, err := ioutil.TempDir("", "fissile-attributions-")
+	require.NoError(t, err)
+	defer os.RemoveAll(archiveDir)
+	for _, pkg := range roleManifest.LoadedReleases[0].Packages {
+		pkg.Path = filepath.Join(archiveDir, pkg.Name+".tgz")
+		require.NoError(t, testhelpers.WriteTarGz(pkg.Path, map[string]string{
+			"./packaging":                "",
+			"./" + pkg.Name + "/LICENSE": "license of " + pkg.Name,
+		}))
+	}
+
+	attributions, err := CollectAttributions(roleManifest.LoadedReleases)
+	require.NoError(t, err)
+	require.NotEmpty(t, attributions)
+
+	release := attributions[0]
+	assert.Equal("tor", release.Release)
+	assert.Empty(release.Package)
+	require.Len(t, release.Files, 1)
+	assert.Equal("LICENSE", release.Files[0].Name)
+	assert.NotEmpty(release.Files[0].Contents)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteAttributions(&buf, attributions))
+	assert.Contains(buf.String(), "Release tor "+release.Version+": LICENSE\n")
+	assert.Contains(buf.String(), release.Files[0].Contents)
+	assert.Contains(buf.String(), "Release tor "+release.Version+", package libevent: libevent/LICENSE\n")
+
+	instanceGroupAttributions, err := collectInstanceGroupAttributions(roleManifest.InstanceGroups[0])
+	require.NoError(t, err)
+	require.NotEmpty(t, instanceGroupAttributions)
+	assert.Equal(release, instanceGroupAttributions[0])
+}
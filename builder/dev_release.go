@@ -0,0 +1,690 @@
+package builder
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+	"github.com/SUSE/termui"
+	"github.com/cppforlife/go-semi-semantic/version"
+	"github.com/fatih/color"
+	uuid "github.com/satori/go.uuid"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DevReleaseBuilder creates BOSH dev releases from release source
+// directories, without the BOSH CLI.  Like `bosh create-release`, it archives
+// the jobs, packages and license of the release into the BOSH cache
+// directory, named by their SHA1, and writes the dev release manifest into
+// the dev_releases directory of the release, which is where fissile reads dev
+// releases from.
+type DevReleaseBuilder struct {
+	CacheDir string // the BOSH cache directory the archives are written to
+	UI       *termui.UI
+}
+
+// devPackageSpec is the part of the spec file of a package needed to build it
+type devPackageSpec struct {
+	Name          string   `yaml:"name"`
+	Dependencies  []string `yaml:"dependencies"`
+	Files         []string `yaml:"files"`
+	ExcludedFiles []string `yaml:"excluded_files"`
+}
+
+// devJobSpec is the part of the spec file of a job needed to build it
+type devJobSpec struct {
+	Name      string            `yaml:"name"`
+	Templates map[string]string `yaml:"templates"`
+	Packages  []string          `yaml:"packages"`
+}
+
+// devReleaseIndex is the contents of the index.yml file listing the versions
+// of a release
+type devReleaseIndex struct {
+	Builds        map[string]map[string]string `yaml:"builds"`
+	FormatVersion string                       `yaml:"format-version"`
+}
+
+// devReleaseItem is a job, package or license of the release manifest
+type devReleaseItem struct {
+	Name         string    `yaml:"name,omitempty"`
+	Version      string    `yaml:"version"`
+	Fingerprint  string    `yaml:"fingerprint"`
+	SHA1         string    `yaml:"sha1"`
+	Dependencies *[]string `yaml:"dependencies,omitempty"`
+	Packages     *[]string `yaml:"packages,omitempty"`
+}
+
+// devReleaseManifest is the contents of the manifest of a dev release
+type devReleaseManifest struct {
+	Packages           []devReleaseItem `yaml:"packages"`
+	Jobs               []devReleaseItem `yaml:"jobs"`
+	License            *devReleaseItem  `yaml:"license,omitempty"`
+	CommitHash         string           `yaml:"commit_hash"`
+	UncommittedChanges bool             `yaml:"uncommitted_changes"`
+	Name               string           `yaml:"name"`
+	Version            string           `yaml:"version"`
+}
+
+// archiveEntry is a file to put into a job, package or license archive
+type archiveEntry struct {
+	name   string // the path in the archive
+	source string // the path of the file to archive
+}
+
+// Build creates a dev release from the release source directory at
+// releasePath, and returns it as loaded by fissile.  An empty name is taken
+// from the release configuration, as fissile does when loading dev releases;
+// an empty version is the next dev version after the latest final and dev
+// releases.
+func (b *DevReleaseBuilder) Build(releasePath, name, releaseVersion string) (*model.Release, error) {
+	if err := util.ValidatePath(releasePath, true, "release directory"); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if name == "" {
+		name, err = model.DefaultDevReleaseName(releasePath)
+		if err != nil {
+			return nil, fmt.Errorf("Error determining the name of the release at %s: %v", releasePath, err)
+		}
+	}
+
+	devReleasesDir := filepath.Join(releasePath, "dev_releases", name)
+	indexPath := filepath.Join(devReleasesDir, "index.yml")
+	index, err := readDevReleaseIndex(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	if releaseVersion == "" {
+		releaseVersion, err = nextDevVersion(releasePath, name, index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, build := range index.Builds {
+		if build["version"] == releaseVersion {
+			return nil, fmt.Errorf("Release %s version %s already exists", name, releaseVersion)
+		}
+	}
+
+	if err := os.MkdirAll(b.CacheDir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating the BOSH cache directory %s: %v", b.CacheDir, err)
+	}
+
+	manifest := devReleaseManifest{Name: name, Version: releaseVersion}
+	manifest.CommitHash, manifest.UncommittedChanges = gitCommit(releasePath)
+
+	manifest.Packages, err = b.buildPackages(releasePath)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Jobs, err = b.buildJobs(releasePath, manifest.Packages)
+	if err != nil {
+		return nil, err
+	}
+	manifest.License, err = b.buildLicense(releasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := yaml.Marshal(&manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(devReleasesDir, 0755); err != nil {
+		return nil, err
+	}
+	manifestPath := filepath.Join(devReleasesDir, fmt.Sprintf("%s-%s.yml", name, releaseVersion))
+	if err := ioutil.WriteFile(manifestPath, append([]byte("---\n"), contents...), 0644); err != nil {
+		return nil, fmt.Errorf("Error writing release manifest %s: %v", manifestPath, err)
+	}
+
+	index.Builds[uuid.NewV4().String()] = map[string]string{"version": releaseVersion}
+	contents, err = yaml.Marshal(&index)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(indexPath, append([]byte("---\n"), contents...), 0644); err != nil {
+		return nil, fmt.Errorf("Error writing release index %s: %v", indexPath, err)
+	}
+
+	b.UI.Printf("Created dev release %s version %s\n", color.GreenString(name), color.YellowString(releaseVersion))
+	return model.NewDevRelease(releasePath, name, releaseVersion, b.CacheDir)
+}
+
+// buildPackages archives the packages of the release, sorted by name.
+func (b *DevReleaseBuilder) buildPackages(releasePath string) ([]devReleaseItem, error) {
+	packageDirs, err := subdirectories(filepath.Join(releasePath, "packages"))
+	if err != nil {
+		return nil, err
+	}
+	blobs, err := readBlobNames(releasePath)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]devReleaseItem, 0, len(packageDirs))
+	for _, packageDir := range packageDirs {
+		var spec devPackageSpec
+		if err := readSpec(filepath.Join(packageDir, "spec"), &spec); err != nil {
+			return nil, err
+		}
+		if spec.Name == "" {
+			spec.Name = filepath.Base(packageDir)
+		}
+
+		entries, err := packageFiles(releasePath, spec, blobs)
+		if err != nil {
+			return nil, err
+		}
+		fingerprinted := append([]archiveEntry{{name: "packaging", source: filepath.Join(packageDir, "packaging")}}, entries...)
+		prePackaging := filepath.Join(packageDir, "pre_packaging")
+		if _, err := os.Stat(prePackaging); err == nil {
+			fingerprinted = append(fingerprinted, archiveEntry{name: "pre_packaging", source: prePackaging})
+		}
+		dependencies := append([]string{}, spec.Dependencies...)
+		sort.Strings(dependencies)
+		fingerprint, err := fingerprintEntries(fingerprinted, dependencies)
+		if err != nil {
+			return nil, fmt.Errorf("Error fingerprinting package %s: %v", spec.Name, err)
+		}
+
+		archiveEntries := append([]archiveEntry{{name: "packaging", source: filepath.Join(packageDir, "packaging")}}, entries...)
+		var stagingDir string
+		if _, err := os.Stat(prePackaging); err == nil {
+			stagingDir, archiveEntries, err = runPrePackaging(spec.Name, prePackaging, archiveEntries)
+			if stagingDir != "" {
+				defer os.RemoveAll(stagingDir)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		sum, err := b.writeArchive(archiveEntries)
+		if err != nil {
+			return nil, fmt.Errorf("Error archiving package %s: %v", spec.Name, err)
+		}
+		items = append(items, devReleaseItem{
+			Name:         spec.Name,
+			Version:      fingerprint,
+			Fingerprint:  fingerprint,
+			SHA1:         sum,
+			Dependencies: &dependencies,
+		})
+	}
+
+	known := make(map[string]bool)
+	for _, item := range items {
+		known[item.Name] = true
+	}
+	for _, item := range items {
+		for _, dependency := range *item.Dependencies {
+			if !known[dependency] {
+				return nil, fmt.Errorf("Package %s depends on unknown package %s", item.Name, dependency)
+			}
+		}
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items, nil
+}
+
+// buildJobs archives the jobs of the release, sorted by name.
+func (b *DevReleaseBuilder) buildJobs(releasePath string, packages []devReleaseItem) ([]devReleaseItem, error) {
+	jobDirs, err := subdirectories(filepath.Join(releasePath, "jobs"))
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	for _, pkg := range packages {
+		known[pkg.Name] = true
+	}
+
+	items := make([]devReleaseItem, 0, len(jobDirs))
+	for _, jobDir := range jobDirs {
+		var spec devJobSpec
+		if err := readSpec(filepath.Join(jobDir, "spec"), &spec); err != nil {
+			return nil, err
+		}
+		if spec.Name == "" {
+			spec.Name = filepath.Base(jobDir)
+		}
+		for _, pkg := range spec.Packages {
+			if !known[pkg] {
+				return nil, fmt.Errorf("Job %s uses unknown package %s", spec.Name, pkg)
+			}
+		}
+
+		entries := []archiveEntry{
+			{name: "job.MF", source: filepath.Join(jobDir, "spec")},
+			{name: "monit", source: filepath.Join(jobDir, "monit")},
+		}
+		for source := range spec.Templates {
+			entries = append(entries, archiveEntry{
+				name:   path.Join("templates", source),
+				source: filepath.Join(jobDir, "templates", filepath.FromSlash(source)),
+			})
+		}
+		for _, entry := range entries {
+			if _, err := os.Stat(entry.source); err != nil {
+				return nil, fmt.Errorf("Error reading job %s: %v", spec.Name, err)
+			}
+		}
+
+		fingerprint, err := fingerprintEntries(entries, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Error fingerprinting job %s: %v", spec.Name, err)
+		}
+		sum, err := b.writeArchive(entries)
+		if err != nil {
+			return nil, fmt.Errorf("Error archiving job %s: %v", spec.Name, err)
+		}
+		jobPackages := append([]string{}, spec.Packages...)
+		sort.Strings(jobPackages)
+		items = append(items, devReleaseItem{
+			Name:        spec.Name,
+			Version:     fingerprint,
+			Fingerprint: fingerprint,
+			SHA1:        sum,
+			Packages:    &jobPackages,
+		})
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items, nil
+}
+
+// buildLicense archives the LICENSE and NOTICE files of the release, if any.
+func (b *DevReleaseBuilder) buildLicense(releasePath string) (*devReleaseItem, error) {
+	var entries []archiveEntry
+	for _, name := range []string{"LICENSE", "NOTICE"} {
+		source := filepath.Join(releasePath, name)
+		if _, err := os.Stat(source); err == nil {
+			entries = append(entries, archiveEntry{name: name, source: source})
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	fingerprint, err := fingerprintEntries(entries, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error fingerprinting the license: %v", err)
+	}
+	sum, err := b.writeArchive(entries)
+	if err != nil {
+		return nil, fmt.Errorf("Error archiving the license: %v", err)
+	}
+	return &devReleaseItem{Version: fingerprint, Fingerprint: fingerprint, SHA1: sum}, nil
+}
+
+// writeArchive writes a reproducible tgz archive of the entries into the
+// cache directory, named by its SHA1, and returns the SHA1.
+func (b *DevReleaseBuilder) writeArchive(entries []archiveEntry) (string, error) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	tempFile, err := ioutil.TempFile(b.CacheDir, ".fissile-release-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	hash := sha1.New()
+	gzipWriter := gzip.NewWriter(io.MultiWriter(tempFile, hash))
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, entry := range entries {
+		info, err := os.Stat(entry.source)
+		if err != nil {
+			return "", err
+		}
+		header := &tar.Header{
+			Name: "./" + entry.name,
+			Mode: int64(fileMode(info)),
+			Size: info.Size(),
+		}
+		util.NormalizeTarHeader(header)
+		if err := util.CopyFileToTarStream(tarWriter, entry.source, header); err != nil {
+			return "", err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return "", err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return "", err
+	}
+	if err := tempFile.Close(); err != nil {
+		return "", err
+	}
+
+	sum := fmt.Sprintf("%x", hash.Sum(nil))
+	if err := os.Rename(tempFile.Name(), filepath.Join(b.CacheDir, sum)); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// fingerprintEntries computes the fingerprint of a job, package or license:
+// the SHA1 of the names, contents and modes of its files, sorted by name,
+// followed by the extra chunks (the dependencies of packages).
+func fingerprintEntries(entries []archiveEntry, extra []string) (string, error) {
+	sorted := append([]archiveEntry{}, entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+
+	chunks := []string{"v2"}
+	for _, entry := range sorted {
+		info, err := os.Stat(entry.source)
+		if err != nil {
+			return "", err
+		}
+		file, err := os.Open(entry.source)
+		if err != nil {
+			return "", err
+		}
+		hash := sha1.New()
+		_, err = io.Copy(hash, file)
+		file.Close()
+		if err != nil {
+			return "", err
+		}
+		chunks = append(chunks, fmt.Sprintf("%s%x%o", entry.name, hash.Sum(nil), 0100000|fileMode(info)))
+	}
+	chunks = append(chunks, extra...)
+	return fmt.Sprintf("%x", sha1.Sum([]byte(strings.Join(chunks, "")))), nil
+}
+
+// fileMode returns the mode of a file in an archive: executable or not
+func fileMode(info os.FileInfo) os.FileMode {
+	if info.Mode()&0111 != 0 {
+		return 0755
+	}
+	return 0644
+}
+
+// packageFiles returns the files of a package, as listed by the globs in
+// its spec; they are found in the src directory of the release, or, failing
+// that, the blobs directory.  Blobs which are not available locally are an
+// error, as fissile cannot download them.
+func packageFiles(releasePath string, spec devPackageSpec, blobs []string) ([]archiveEntry, error) {
+	srcFiles, err := relativeFiles(filepath.Join(releasePath, "src"))
+	if err != nil {
+		return nil, err
+	}
+	blobFiles, err := relativeFiles(filepath.Join(releasePath, "blobs"))
+	if err != nil {
+		return nil, err
+	}
+	localBlobs := make(map[string]bool)
+	for _, name := range blobFiles {
+		localBlobs[name] = true
+	}
+
+	selected := make(map[string]string)
+	for _, pattern := range spec.Files {
+		matched := false
+		for _, name := range srcFiles {
+			if matchGlob(pattern, name) {
+				selected[name] = filepath.Join(releasePath, "src", filepath.FromSlash(name))
+				matched = true
+			}
+		}
+		for _, name := range blobFiles {
+			if _, ok := selected[name]; !ok && matchGlob(pattern, name) {
+				selected[name] = filepath.Join(releasePath, "blobs", filepath.FromSlash(name))
+				matched = true
+			}
+		}
+		for _, name := range blobs {
+			if !localBlobs[name] && matchGlob(pattern, name) {
+				return nil, fmt.Errorf("Blob %s of package %s is not available locally; fetch it with `bosh sync-blobs`", name, spec.Name)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("Package %s has no files matching %s", spec.Name, pattern)
+		}
+	}
+	for _, pattern := range spec.ExcludedFiles {
+		for name := range selected {
+			if matchGlob(pattern, name) {
+				delete(selected, name)
+			}
+		}
+	}
+
+	entries := make([]archiveEntry, 0, len(selected))
+	for name, source := range selected {
+		entries = append(entries, archiveEntry{name: name, source: source})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, nil
+}
+
+// runPrePackaging runs the deprecated pre_packaging script of a package in a
+// staging directory holding the files of the package, with BUILD_DIR pointing
+// to it, and returns the staging directory and the files in it afterwards.
+func runPrePackaging(name, script string, entries []archiveEntry) (string, []archiveEntry, error) {
+	stagingDir, err := ioutil.TempDir("", "fissile-pre-packaging-")
+	if err != nil {
+		return "", nil, err
+	}
+	for _, entry := range entries {
+		target := filepath.Join(stagingDir, filepath.FromSlash(entry.name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return stagingDir, nil, err
+		}
+		info, err := os.Stat(entry.source)
+		if err != nil {
+			return stagingDir, nil, err
+		}
+		contents, err := ioutil.ReadFile(entry.source)
+		if err != nil {
+			return stagingDir, nil, err
+		}
+		if err := ioutil.WriteFile(target, contents, fileMode(info)); err != nil {
+			return stagingDir, nil, err
+		}
+	}
+
+	cmd := exec.Command("bash", "-e", script)
+	cmd.Dir = stagingDir
+	cmd.Env = append(os.Environ(), "BUILD_DIR="+stagingDir)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return stagingDir, nil, fmt.Errorf("Error running pre_packaging of package %s: %v\n%s", name, err, output)
+	}
+
+	names, err := relativeFiles(stagingDir)
+	if err != nil {
+		return stagingDir, nil, err
+	}
+	staged := make([]archiveEntry, 0, len(names))
+	for _, name := range names {
+		staged = append(staged, archiveEntry{name: name, source: filepath.Join(stagingDir, filepath.FromSlash(name))})
+	}
+	return stagingDir, staged, nil
+}
+
+// matchGlob reports whether the slash separated name matches the pattern,
+// where `**` matches any number of directories.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// relativeFiles returns the slash separated paths of all regular files below
+// the directory, which may be missing.
+func relativeFiles(dir string) ([]string, error) {
+	var names []string
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && file == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relative, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(relative))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// subdirectories returns the directories in dir, which may be missing.
+func subdirectories(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, info := range infos {
+		if info.IsDir() {
+			dirs = append(dirs, filepath.Join(dir, info.Name()))
+		}
+	}
+	return dirs, nil
+}
+
+// readSpec parses the spec file of a job or package
+func readSpec(specPath string, spec interface{}) error {
+	contents, err := ioutil.ReadFile(specPath)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(contents, spec); err != nil {
+		return fmt.Errorf("Error parsing %s: %v", specPath, err)
+	}
+	return nil
+}
+
+// readBlobNames returns the names of the blobs listed in config/blobs.yml
+func readBlobNames(releasePath string) ([]string, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(releasePath, "config", "blobs.yml"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var blobs map[string]interface{}
+	if err := yaml.Unmarshal(contents, &blobs); err != nil {
+		return nil, fmt.Errorf("Error parsing the blobs of the release at %s: %v", releasePath, err)
+	}
+	names := make([]string, 0, len(blobs))
+	for name := range blobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readDevReleaseIndex reads the index of dev releases, which may be missing
+func readDevReleaseIndex(indexPath string) (devReleaseIndex, error) {
+	index := devReleaseIndex{FormatVersion: "2"}
+	contents, err := ioutil.ReadFile(indexPath)
+	if err != nil && !os.IsNotExist(err) {
+		return index, err
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(contents, &index); err != nil {
+			return index, fmt.Errorf("Error parsing release index %s: %v", indexPath, err)
+		}
+	}
+	if index.Builds == nil {
+		index.Builds = make(map[string]map[string]string)
+	}
+	return index, nil
+}
+
+// nextDevVersion returns the version following the latest dev release of the
+// latest final release (or 0), e.g. 2+dev.4 after 2+dev.3.
+func nextDevVersion(releasePath, name string, devIndex devReleaseIndex) (string, error) {
+	finalIndex, err := readDevReleaseIndex(filepath.Join(releasePath, "releases", name, "index.yml"))
+	if err != nil {
+		return "", err
+	}
+	base := ""
+	var latest version.Version
+	for _, build := range finalIndex.Builds {
+		finalVersion, err := version.NewVersionFromString(build["version"])
+		if err != nil {
+			return "", fmt.Errorf("Invalid final release version %s of release %s: %v", build["version"], name, err)
+		}
+		if base == "" || finalVersion.IsGt(latest) {
+			base, latest = build["version"], finalVersion
+		}
+	}
+	if base == "" {
+		base = "0"
+	}
+
+	build := 0
+	prefix := base + "+dev."
+	for _, devBuild := range devIndex.Builds {
+		if !strings.HasPrefix(devBuild["version"], prefix) {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimPrefix(devBuild["version"], prefix)); err == nil && n > build {
+			build = n
+		}
+	}
+	return fmt.Sprintf("%s%d", prefix, build+1), nil
+}
+
+// gitCommit returns the short commit hash of the release source directory,
+// and whether it has uncommitted changes; "non-git" if it is not a git
+// repository.
+func gitCommit(releasePath string) (string, bool) {
+	output, err := exec.Command("git", "-C", releasePath, "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return "non-git", false
+	}
+	status, err := exec.Command("git", "-C", releasePath, "status", "--porcelain").Output()
+	return strings.TrimSpace(string(output)), err == nil && len(strings.TrimSpace(string(status))) > 0
+}
@@ -0,0 +1,201 @@
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/util"
+	"github.com/SUSE/termui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeReleaseSources writes the source directory of a release with a job
+// using an app package, which depends on a lib package.
+func writeReleaseSources(t *testing.T, dir string) {
+	files := map[string]string{
+		"config/final.yml":           "---\nfinal_name: test\n",
+		"config/blobs.yml":           "---\nlib/blob.tgz:\n  size: 4\n  sha1: abc\n",
+		"LICENSE":                    "license text",
+		"packages/app/spec":          "---\nname: app\ndependencies: [lib]\nfiles: [app/**/*]\n",
+		"packages/app/packaging":     "cp -a app ${BOSH_INSTALL_TARGET}\n",
+		"packages/lib/spec":          "---\nname: lib\nfiles: [lib/*]\nexcluded_files: [lib/skip.txt]\n",
+		"packages/lib/packaging":     "cp -a lib ${BOSH_INSTALL_TARGET}\n",
+		"src/app/main.sh":            "echo app\n",
+		"src/app/sub/data.txt":       "data\n",
+		"src/lib/lib.txt":            "lib\n",
+		"src/lib/skip.txt":           "skip\n",
+		"blobs/lib/blob.tgz":         "blob",
+		"jobs/web/spec":              "---\nname: web\ntemplates:\n  run.erb: bin/run\npackages: [app]\nproperties:\n  port:\n    default: 80\n",
+		"jobs/web/monit":             "check process web\n",
+		"jobs/web/templates/run.erb": "#!/bin/sh\nexec app --port <%= p('port') %>\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+	require.NoError(t, os.Chmod(filepath.Join(dir, "src/app/main.sh"), 0755))
+}
+
+// archiveContents returns the files of a tgz archive by name
+func archiveContents(t *testing.T, path string) map[string]string {
+	contents := make(map[string]string)
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	err = util.TargzIterate(path, file, func(reader *tar.Reader, header *tar.Header) error {
+		data, err := ioutil.ReadAll(reader)
+		contents[header.Name] = string(data)
+		return err
+	})
+	require.NoError(t, err)
+	return contents
+}
+
+func TestDevReleaseBuilder(t *testing.T) {
+	releaseDir, err := ioutil.TempDir("", "fissile-release-")
+	require.NoError(t, err)
+	defer os.RemoveAll(releaseDir)
+	cacheDir, err := ioutil.TempDir("", "fissile-bosh-cache-")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	writeReleaseSources(t, releaseDir)
+	devReleaseBuilder := &DevReleaseBuilder{
+		CacheDir: cacheDir,
+		UI:       termui.New(&bytes.Buffer{}, &bytes.Buffer{}, nil),
+	}
+
+	release, err := devReleaseBuilder.Build(releaseDir, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "test", release.Name)
+	assert.Equal(t, "0+dev.1", release.Version)
+	assert.Equal(t, "license text", string(release.License.Files["LICENSE"]))
+
+	app, err := release.LookupPackage("app")
+	require.NoError(t, err)
+	lib, err := release.LookupPackage("lib")
+	require.NoError(t, err)
+	require.Len(t, app.Dependencies, 1)
+	assert.Equal(t, lib, app.Dependencies[0])
+	assert.NoError(t, app.ValidateSHA1())
+	assert.Equal(t, map[string]string{
+		"./packaging":        "cp -a app ${BOSH_INSTALL_TARGET}\n",
+		"./app/main.sh":      "echo app\n",
+		"./app/sub/data.txt": "data\n",
+	}, archiveContents(t, app.Path))
+	assert.Equal(t, map[string]string{
+		"./packaging":    "cp -a lib ${BOSH_INSTALL_TARGET}\n",
+		"./lib/lib.txt":  "lib\n",
+		"./lib/blob.tgz": "blob",
+	}, archiveContents(t, lib.Path), "Blobs are included and excluded files are not")
+
+	job, err := release.LookupJob("web")
+	require.NoError(t, err)
+	require.Len(t, job.Packages, 1)
+	assert.Equal(t, "app", job.Packages[0].Name)
+	require.Len(t, job.Templates, 1)
+	require.NoError(t, job.Templates[0].Load())
+	assert.Contains(t, job.Templates[0].Content, "p('port')")
+
+	// Building again gives the next dev version with the same archives
+	again, err := devReleaseBuilder.Build(releaseDir, "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "0+dev.2", again.Version)
+	appAgain, err := again.LookupPackage("app")
+	require.NoError(t, err)
+	assert.Equal(t, app.Fingerprint, appAgain.Fingerprint)
+	assert.Equal(t, app.SHA1, appAgain.SHA1, "Archives should be reproducible")
+
+	// Changing the sources of lib changes its fingerprint only
+	require.NoError(t, ioutil.WriteFile(filepath.Join(releaseDir, "src/lib/lib.txt"), []byte("changed\n"), 0644))
+	changed, err := devReleaseBuilder.Build(releaseDir, "", "3.0")
+	require.NoError(t, err)
+	assert.Equal(t, "3.0", changed.Version)
+	libChanged, err := changed.LookupPackage("lib")
+	require.NoError(t, err)
+	assert.NotEqual(t, lib.Fingerprint, libChanged.Fingerprint)
+	appChanged, err := changed.LookupPackage("app")
+	require.NoError(t, err)
+	assert.Equal(t, app.Fingerprint, appChanged.Fingerprint)
+
+	_, err = devReleaseBuilder.Build(releaseDir, "", "3.0")
+	assert.EqualError(t, err, "Release test version 3.0 already exists")
+}
+
+func TestDevReleaseBuilderErrors(t *testing.T) {
+	for _, sample := range []struct {
+		name     string
+		file     string
+		contents string
+		err      string
+	}{
+		{
+			name:     "missing blob",
+			file:     "config/blobs.yml",
+			contents: "---\nlib/blob.tgz: {}\nlib/other.tgz: {}\n",
+			err:      "Blob lib/other.tgz of package lib is not available locally; fetch it with `bosh sync-blobs`",
+		},
+		{
+			name:     "unknown dependency",
+			file:     "packages/app/spec",
+			contents: "---\nname: app\ndependencies: [missing]\nfiles: [app/**/*]\n",
+			err:      "Package app depends on unknown package missing",
+		},
+		{
+			name:     "unmatched files",
+			file:     "packages/app/spec",
+			contents: "---\nname: app\nfiles: [nothing/*]\n",
+			err:      "Package app has no files matching nothing/*",
+		},
+		{
+			name:     "unknown job package",
+			file:     "jobs/web/spec",
+			contents: "---\nname: web\npackages: [missing]\n",
+			err:      "Job web uses unknown package missing",
+		},
+	} {
+		t.Run(sample.name, func(t *testing.T) {
+			releaseDir, err := ioutil.TempDir("", "fissile-release-")
+			require.NoError(t, err)
+			defer os.RemoveAll(releaseDir)
+			cacheDir, err := ioutil.TempDir("", "fissile-bosh-cache-")
+			require.NoError(t, err)
+			defer os.RemoveAll(cacheDir)
+
+			writeReleaseSources(t, releaseDir)
+			require.NoError(t, ioutil.WriteFile(filepath.Join(releaseDir, sample.file), []byte(sample.contents), 0644))
+
+			devReleaseBuilder := &DevReleaseBuilder{
+				CacheDir: cacheDir,
+				UI:       termui.New(&bytes.Buffer{}, &bytes.Buffer{}, nil),
+			}
+			_, err = devReleaseBuilder.Build(releaseDir, "", "")
+			assert.EqualError(t, err, sample.err)
+		})
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	for _, sample := range []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"lib/*", "lib/a.txt", true},
+		{"lib/*", "lib/sub/a.txt", false},
+		{"lib/**/*", "lib/a.txt", true},
+		{"lib/**/*", "lib/sub/deep/a.txt", true},
+		{"**/*.txt", "a.txt", true},
+		{"**/*.txt", "lib/a.tgz", false},
+		{"lib/a.txt", "lib/a.txt", true},
+		{"lib", "lib/a.txt", false},
+	} {
+		assert.Equal(t, sample.match, matchGlob(sample.pattern, sample.name), "%s matching %s", sample.pattern, sample.name)
+	}
+}
@@ -26,6 +26,7 @@ type PackagesImageBuilder struct {
 	StemcellImageName    string
 	CompiledPackagesPath string
 	FissileVersion       string
+	Reproducible         bool
 }
 
 // baseImageOverride is used for tests; if not set, we use the correct one
@@ -33,9 +34,10 @@ var baseImageOverride string
 
 // tarWalker is a helper to copy files into a tar stream
 type tarWalker struct {
-	stream *tar.Writer // The stream to copy the files into
-	root   string      // The base directory on disk where the walking started
-	prefix string      // The prefix in the tar file the names should have
+	stream    *tar.Writer // The stream to copy the files into
+	root      string      // The base directory on disk where the walking started
+	prefix    string      // The prefix in the tar file the names should have
+	normalize bool        // Whether to strip timestamps and ownership from the headers
 }
 
 func (w *tarWalker) walk(path string, info os.FileInfo, err error) error {
@@ -56,6 +58,10 @@ func (w *tarWalker) walk(path string, info os.FileInfo, err error) error {
 		header.Linkname = linkname
 	}
 
+	if w.normalize {
+		util.NormalizeTarHeader(header)
+	}
+
 	relPath, err := filepath.Rel(w.root, path)
 	if err != nil {
 		return err
@@ -146,7 +152,8 @@ func (p *PackagesImageBuilder) NewDockerPopulator(instanceGroups model.InstanceG
 		var packages model.Packages
 		for _, instanceGroup := range instanceGroups {
 			for _, jobReference := range instanceGroup.JobReferences {
-				for _, pkg := range jobReference.Packages {
+				for _, link := range instanceGroup.PackageLinks(jobReference) {
+					pkg := link.Package
 					if _, ok := foundFingerprints[pkg.Fingerprint]; ok {
 						// Package has already been found (possibly due to a different instance group)
 						continue
@@ -166,6 +173,9 @@ func (p *PackagesImageBuilder) NewDockerPopulator(instanceGroups model.InstanceG
 				return err
 			}
 		}
+		if p.Reproducible {
+			sort.Sort(packages)
+		}
 		if err = p.generateDockerfile(baseImageName, packages, labels, &dockerfile); err != nil {
 			return err
 		}
@@ -189,9 +199,10 @@ func (p *PackagesImageBuilder) NewDockerPopulator(instanceGroups model.InstanceG
 		// Actually insert the packages into the tar stream
 		for _, pkg := range packages {
 			walker := &tarWalker{
-				stream: tarWriter,
-				root:   pkg.GetPackageCompiledDir(p.CompiledPackagesPath),
-				prefix: filepath.Join("packages-src", pkg.Fingerprint),
+				stream:    tarWriter,
+				root:      pkg.GetPackageCompiledDir(p.CompiledPackagesPath),
+				prefix:    filepath.Join("packages-src", pkg.Fingerprint),
+				normalize: p.Reproducible,
 			}
 			if err = filepath.Walk(walker.root, walker.walk); err != nil {
 				return err
@@ -230,8 +241,8 @@ func (p *PackagesImageBuilder) GetImageName(roleManifest *model.RoleManifest, in
 	pkgMap := make(map[string]*model.Package)
 	for _, r := range instanceGroups {
 		for _, j := range r.JobReferences {
-			for _, pkg := range j.Packages {
-				pkgMap[pkg.Fingerprint] = pkg
+			for _, link := range r.PackageLinks(j) {
+				pkgMap[link.Package.Fingerprint] = link.Package
 			}
 		}
 	}
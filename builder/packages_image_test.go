@@ -11,6 +11,7 @@ import (
 	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"code.cloudfoundry.org/fissile/docker"
 	"code.cloudfoundry.org/fissile/model"
@@ -426,3 +427,60 @@ func TestGetRolePackageImageName(t *testing.T) {
 		assert.NotEqual(t, oldImageName, newImageName, "Changing package name should change package layer hash")
 	})
 }
+
+func TestNewDockerPopulatorReproducible(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/builder/tor-good.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{releasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+
+	// Work on a copy of the compiled packages so we can change their timestamps
+	compiledPackagesDir, err := ioutil.TempDir("", "fissile-reproducible")
+	require.NoError(t, err)
+	defer os.RemoveAll(compiledPackagesDir)
+	for _, pkg := range []string{"libevent", "tor"} {
+		compiledDir := getPackage(roleManifest.InstanceGroups, "myrole", "tor", pkg).GetPackageCompiledDir(compiledPackagesDir)
+		require.NoError(t, os.MkdirAll(compiledDir, 0755))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(compiledDir, "bin"), []byte(pkg), 0755))
+	}
+
+	packagesImageBuilder := PackagesImageBuilder{
+		RepositoryPrefix:     "foo",
+		StemcellImageName:    dockerImageName,
+		FissileVersion:       "3.14.15",
+		CompiledPackagesPath: compiledPackagesDir,
+		Reproducible:         true,
+	}
+
+	build := func() []byte {
+		tarFile := &bytes.Buffer{}
+		tarWriter := tar.NewWriter(tarFile)
+		tarPopulator := packagesImageBuilder.NewDockerPopulator(roleManifest.InstanceGroups, nil, true)
+		require.NoError(t, tarPopulator(tarWriter))
+		require.NoError(t, tarWriter.Close())
+		return tarFile.Bytes()
+	}
+
+	first := build()
+
+	later := time.Now().Add(time.Hour)
+	err = filepath.Walk(compiledPackagesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, later, later)
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, util.Hash(string(first)), util.Hash(string(build())), "Package layer tarball is not reproducible")
+}
@@ -0,0 +1,210 @@
+package builder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/model"
+)
+
+// Labels used to record the provenance of role images
+const (
+	ProvenanceLabelPrefix      = "org.cloudfoundry.fissile.provenance."
+	provenanceRoleManifest     = ProvenanceLabelPrefix + "role-manifest.sha256"
+	provenanceLightOpinions    = ProvenanceLabelPrefix + "light-opinions.sha256"
+	provenanceDarkOpinions     = ProvenanceLabelPrefix + "dark-opinions.sha256"
+	provenanceStemcell         = ProvenanceLabelPrefix + "stemcell.digest"
+	provenanceFissileVersion   = ProvenanceLabelPrefix + "fissile.version"
+	provenanceReleases         = ProvenanceLabelPrefix + "releases"
+	provenanceJobFingerprints  = ProvenanceLabelPrefix + "job-fingerprints"
+	ociImageTitleLabel         = "org.opencontainers.image.title"
+	ociImageDescriptionLabel   = "org.opencontainers.image.description"
+	ociImageDescriptionContent = "BOSH instance group image built by fissile"
+)
+
+// ProvenanceRelease describes a BOSH release used to build a role image
+type ProvenanceRelease struct {
+	Name    string `json:"name" yaml:"name"`
+	Version string `json:"version" yaml:"version"`
+	Commit  string `json:"commit" yaml:"commit"`
+}
+
+// Provenance records the inputs a role image was built from
+type Provenance struct {
+	InstanceGroup      string              `json:"instance_group" yaml:"instance_group"`
+	RoleManifestSHA256 string              `json:"role_manifest_sha256" yaml:"role_manifest_sha256"`
+	LightOpinionsSHA   string              `json:"light_opinions_sha256,omitempty" yaml:"light_opinions_sha256,omitempty"`
+	DarkOpinionsSHA    string              `json:"dark_opinions_sha256,omitempty" yaml:"dark_opinions_sha256,omitempty"`
+	StemcellDigest     string              `json:"stemcell_digest,omitempty" yaml:"stemcell_digest,omitempty"`
+	FissileVersion     string              `json:"fissile_version" yaml:"fissile_version"`
+	Releases           []ProvenanceRelease `json:"releases" yaml:"releases"`
+	JobFingerprints    map[string]string   `json:"job_fingerprints" yaml:"job_fingerprints"`
+}
+
+// sha256File returns the hex encoded SHA256 of the file contents, or an
+// empty string if no path is given.
+func sha256File(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// StemcellDigest returns the digest recorded as the provenance of the
+// stemcell image, from the repository digests docker knows for the image:
+// the one of the repository of the stemcell name, if any, or the first one.
+// Images which were never pushed or pulled by digest have no repository
+// digest; their content addressed image ID is used instead.
+func StemcellDigest(stemcellName string, repoDigests []string, imageID string) string {
+	repository := stemcellName
+	if i := strings.LastIndex(repository, "@"); i >= 0 {
+		repository = repository[:i]
+	} else if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository = repository[:i]
+	}
+
+	digest := ""
+	for _, repoDigest := range repoDigests {
+		parts := strings.SplitN(repoDigest, "@", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if parts[0] == repository {
+			return parts[1]
+		}
+		if digest == "" {
+			digest = parts[1]
+		}
+	}
+	if digest == "" {
+		return imageID
+	}
+	return digest
+}
+
+// GetProvenance collects the provenance information of the image for the
+// given instance group.
+func (r *RoleImageBuilder) GetProvenance(instanceGroup *model.InstanceGroup) (*Provenance, error) {
+	provenance := &Provenance{
+		InstanceGroup:   instanceGroup.Name,
+		StemcellDigest:  r.StemcellDigest,
+		FissileVersion:  r.FissileVersion,
+		Releases:        []ProvenanceRelease{},
+		JobFingerprints: make(map[string]string),
+	}
+
+	var err error
+	if provenance.RoleManifestSHA256, err = sha256File(r.ManifestPath); err != nil {
+		return nil, fmt.Errorf("Error hashing role manifest: %v", err)
+	}
+	if provenance.LightOpinionsSHA, err = sha256File(r.LightOpinionsPath); err != nil {
+		return nil, fmt.Errorf("Error hashing light opinions: %v", err)
+	}
+	if provenance.DarkOpinionsSHA, err = sha256File(r.DarkOpinionsPath); err != nil {
+		return nil, fmt.Errorf("Error hashing dark opinions: %v", err)
+	}
+
+	releasesSeen := map[string]struct{}{}
+	for _, jobReference := range instanceGroup.JobReferences {
+		provenance.JobFingerprints[fmt.Sprintf("%s/%s", jobReference.Release.Name, jobReference.Name)] = jobReference.Fingerprint
+
+		if _, ok := releasesSeen[jobReference.Release.Name]; ok {
+			continue
+		}
+		releasesSeen[jobReference.Release.Name] = struct{}{}
+		provenance.Releases = append(provenance.Releases, ProvenanceRelease{
+			Name:    jobReference.Release.Name,
+			Version: jobReference.Release.Version,
+			Commit:  jobReference.Release.CommitHash,
+		})
+	}
+	sort.Slice(provenance.Releases, func(i, j int) bool {
+		return provenance.Releases[i].Name < provenance.Releases[j].Name
+	})
+
+	return provenance, nil
+}
+
+// Labels returns the image labels recording the provenance
+func (p *Provenance) Labels() (map[string]string, error) {
+	releases, err := json.Marshal(p.Releases)
+	if err != nil {
+		return nil, err
+	}
+	jobFingerprints, err := json.Marshal(p.JobFingerprints)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		ociImageTitleLabel:        p.InstanceGroup,
+		ociImageDescriptionLabel:  ociImageDescriptionContent,
+		provenanceRoleManifest:    p.RoleManifestSHA256,
+		provenanceFissileVersion:  p.FissileVersion,
+		provenanceReleases:        string(releases),
+		provenanceJobFingerprints: string(jobFingerprints),
+	}
+	if p.LightOpinionsSHA != "" {
+		labels[provenanceLightOpinions] = p.LightOpinionsSHA
+	}
+	if p.DarkOpinionsSHA != "" {
+		labels[provenanceDarkOpinions] = p.DarkOpinionsSHA
+	}
+	if p.StemcellDigest != "" {
+		labels[provenanceStemcell] = p.StemcellDigest
+	}
+	return labels, nil
+}
+
+// NewProvenanceFromLabels reads back the provenance recorded in the labels
+// of a role image.
+func NewProvenanceFromLabels(labels map[string]string) (*Provenance, error) {
+	if _, ok := labels[provenanceRoleManifest]; !ok {
+		return nil, fmt.Errorf("image has no provenance labels")
+	}
+
+	provenance := &Provenance{
+		InstanceGroup:      labels[ociImageTitleLabel],
+		RoleManifestSHA256: labels[provenanceRoleManifest],
+		LightOpinionsSHA:   labels[provenanceLightOpinions],
+		DarkOpinionsSHA:    labels[provenanceDarkOpinions],
+		StemcellDigest:     labels[provenanceStemcell],
+		FissileVersion:     labels[provenanceFissileVersion],
+		Releases:           []ProvenanceRelease{},
+		JobFingerprints:    make(map[string]string),
+	}
+	if value, ok := labels[provenanceReleases]; ok {
+		if err := json.Unmarshal([]byte(value), &provenance.Releases); err != nil {
+			return nil, fmt.Errorf("Error reading label %s: %v", provenanceReleases, err)
+		}
+	}
+	if value, ok := labels[provenanceJobFingerprints]; ok {
+		if err := json.Unmarshal([]byte(value), &provenance.JobFingerprints); err != nil {
+			return nil, fmt.Errorf("Error reading label %s: %v", provenanceJobFingerprints, err)
+		}
+	}
+	return provenance, nil
+}
+
+// dockerfileQuote quotes a string for use as a double quoted value in a
+// Dockerfile instruction, escaping characters docker would interpret.
+func dockerfileQuote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+	return `"` + replacer.Replace(value) + `"`
+}
@@ -0,0 +1,95 @@
+package builder
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/model/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleImageProvenance(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/builder/tor-good.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{releasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+
+	torOpinionsDir := filepath.Join(workDir, "../test-assets/tor-opinions")
+	roleImageBuilder := newRoleImageBuilder(roleManifestPath, filepath.Join(torOpinionsDir, "opinions.yml"), "")
+	roleImageBuilder.StemcellDigest = "sha256:0123456789abcdef"
+
+	instanceGroup := roleManifest.InstanceGroups[0]
+	provenance, err := roleImageBuilder.GetProvenance(instanceGroup)
+	require.NoError(t, err)
+
+	assert.Equal(instanceGroup.Name, provenance.InstanceGroup)
+	assert.Len(provenance.RoleManifestSHA256, 64)
+	assert.Len(provenance.LightOpinionsSHA, 64)
+	assert.Empty(provenance.DarkOpinionsSHA)
+	assert.Equal("sha256:0123456789abcdef", provenance.StemcellDigest)
+	assert.Equal("6.28.30", provenance.FissileVersion)
+	if assert.Len(provenance.Releases, 1) {
+		assert.Equal("tor", provenance.Releases[0].Name)
+		assert.Equal(instanceGroup.JobReferences[0].Release.Version, provenance.Releases[0].Version)
+	}
+	assert.Equal(instanceGroup.JobReferences[0].Fingerprint,
+		provenance.JobFingerprints["tor/"+instanceGroup.JobReferences[0].Name])
+
+	labels, err := provenance.Labels()
+	require.NoError(t, err)
+	assert.Equal(instanceGroup.Name, labels["org.opencontainers.image.title"])
+	assert.NotContains(labels, ProvenanceLabelPrefix+"dark-opinions.sha256")
+
+	roundTrip, err := NewProvenanceFromLabels(labels)
+	require.NoError(t, err)
+	assert.Equal(provenance, roundTrip)
+
+	_, err = NewProvenanceFromLabels(map[string]string{"instance_group": instanceGroup.Name})
+	assert.EqualError(err, "image has no provenance labels")
+
+	var dockerfile bytes.Buffer
+	err = roleImageBuilder.generateDockerfile(instanceGroup, &dockerfile)
+	require.NoError(t, err)
+	assert.Contains(dockerfile.String(),
+		`LABEL "`+ProvenanceLabelPrefix+`stemcell.digest"="sha256:0123456789abcdef"`)
+	assert.Contains(dockerfile.String(),
+		`LABEL "`+ProvenanceLabelPrefix+`releases"="[{\"name\":\"tor\"`)
+}
+
+func TestStemcellDigest(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	repoDigests := []string{"mirror.example.com/stemcell@sha256:mirror", "splatform/stemcell@sha256:origin"}
+	assert.Equal("sha256:origin", StemcellDigest("splatform/stemcell:42.1", repoDigests, "sha256:id"),
+		"The digest of the repository of the stemcell should be used")
+	assert.Equal("sha256:origin", StemcellDigest("splatform/stemcell@sha256:origin", repoDigests, "sha256:id"))
+	assert.Equal("sha256:mirror", StemcellDigest("localhost:5000/stemcell:42.1", repoDigests, "sha256:id"),
+		"Other repositories should fall back to the first digest")
+	assert.Equal("sha256:id", StemcellDigest("splatform/stemcell:42.1", nil, "sha256:id"),
+		"Images without repository digests should use their ID")
+}
+
+func TestDockerfileQuote(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(`"plain"`, dockerfileQuote("plain"))
+	assert.Equal(`"{\"a\":\"b\\\\c\"}"`, dockerfileQuote(`{"a":"b\\c"}`))
+	assert.Equal(`"\$HOME"`, dockerfileQuote("$HOME"))
+}
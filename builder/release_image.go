@@ -3,6 +3,7 @@ package builder
 import (
 	"archive/tar"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -39,6 +40,7 @@ type ReleasesImageBuilder struct {
 	Grapher                util.ModelGrapher
 	MetricsPath            string
 	NoBuild                bool
+	Offline                bool
 	OutputDirectory        string
 	RepositoryPrefix       string
 	StemcellName           string
@@ -212,6 +214,9 @@ func (j releaseBuildJob) CompileRelease() error {
 	if err != nil {
 		return err
 	}
+	if r.Offline && packageStorage != nil && packageStorage.IsRemote() {
+		return util.NewOfflineError(fmt.Sprintf("The %s package cache", packageStorage.Kind), "use a local package cache instead")
+	}
 	var comp *compilator.Compilator
 	if r.WithoutDocker {
 		comp, err = compilator.NewMountNSCompilator(
@@ -252,7 +257,7 @@ func (j releaseBuildJob) CompileRelease() error {
 		}
 	}
 
-	err = comp.Compile(j.builder.WorkerCount, model.Releases{j.release}, nil, j.builder.Verbose)
+	err = comp.Compile(context.Background(), j.builder.WorkerCount, model.Releases{j.release}, nil, j.builder.Verbose)
 	if err != nil {
 		return fmt.Errorf("Error compiling packages: %s", err.Error())
 	}
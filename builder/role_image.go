@@ -3,13 +3,16 @@ package builder
 import (
 	"archive/tar"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"text/template"
+	"time"
 
 	"code.cloudfoundry.org/fissile/docker"
 	"code.cloudfoundry.org/fissile/model"
@@ -51,18 +54,27 @@ type RoleImageBuilder struct {
 	LightOpinionsPath  string
 	ManifestPath       string
 	MetricsPath        string
+	ImageOptions       model.RoleImageOptions
 	NoBuild            bool
 	OutputDirectory    string
 	RepositoryPrefix   string
+	Reproducible       bool
+	StemcellDigest     string
+	StemcellImageID    string
 	TagExtra           string
 	UI                 *termui.UI
 	Verbose            bool
 	WorkerCount        int
+
+	// ResultHandler, if set, is told about every instance group as the
+	// build of its image finishes, successfully or not, and how long the
+	// build took (zero if nothing was built, e.g. the image existed).
+	ResultHandler func(*model.InstanceGroup, time.Duration, error)
 }
 
 // NewDockerPopulator returns a function which can populate a tar stream with the docker context to build the packages layer image with
 func (r *RoleImageBuilder) NewDockerPopulator(instanceGroup *model.InstanceGroup) func(*tar.Writer) error {
-	return func(tarWriter *tar.Writer) error {
+	populator := func(tarWriter *tar.Writer) error {
 		if len(instanceGroup.JobReferences) == 0 {
 			return fmt.Errorf("Error - instance group %s has 0 jobs", instanceGroup.Name)
 		}
@@ -89,24 +101,41 @@ func (r *RoleImageBuilder) NewDockerPopulator(instanceGroup *model.InstanceGroup
 			}
 		}
 
+		if r.ImageOptions.Attributions {
+			attributions, err := collectInstanceGroupAttributions(instanceGroup)
+			if err != nil {
+				return err
+			}
+			var buf bytes.Buffer
+			if err := WriteAttributions(&buf, attributions); err != nil {
+				return err
+			}
+			err = util.WriteToTarStream(tarWriter, buf.Bytes(), tar.Header{Name: attributionsImagePath})
+			if err != nil {
+				return fmt.Errorf("failed to write out the attributions: %v", err)
+			}
+		}
+
 		// Symlink compiled packages
+		r.warnPackageOverrides(instanceGroup)
 		packageSet := map[string]string{}
 		for _, jobReference := range instanceGroup.JobReferences {
-			for _, pkg := range jobReference.Packages {
-				if _, ok := packageSet[pkg.Name]; !ok {
+			for _, link := range instanceGroup.PackageLinks(jobReference) {
+				pkg := link.Package
+				if _, ok := packageSet[link.Name]; !ok {
 					err := util.WriteToTarStream(tarWriter, nil, tar.Header{
-						Name:     filepath.Join("root/var/vcap/packages", pkg.Name),
+						Name:     filepath.Join("root/var/vcap/packages", link.Name),
 						Typeflag: tar.TypeSymlink,
 						Linkname: filepath.Join(".src", pkg.Fingerprint),
 					})
 					if err != nil {
-						return fmt.Errorf("failed to write package symlink for %s: %s", pkg.Name, err)
+						return fmt.Errorf("failed to write package symlink for %s: %s", link.Name, err)
 					}
-					packageSet[pkg.Name] = pkg.Fingerprint
+					packageSet[link.Name] = pkg.Fingerprint
 				} else {
-					if pkg.Fingerprint != packageSet[pkg.Name] {
+					if pkg.Fingerprint != packageSet[link.Name] {
 						r.UI.Printf("WARNING: duplicate package %s. Using package with fingerprint %s.\n",
-							color.CyanString(pkg.Name), color.RedString(packageSet[pkg.Name]))
+							color.CyanString(link.Name), color.RedString(packageSet[link.Name]))
 					}
 				}
 			}
@@ -208,6 +237,11 @@ func (r *RoleImageBuilder) NewDockerPopulator(instanceGroup *model.InstanceGroup
 			return err
 		}
 
+		// Copy the assets of the Dockerfile snippet
+		if err := addDockerfileAssets(instanceGroup, tarWriter); err != nil {
+			return err
+		}
+
 		// Generate Dockerfile
 		buf := &bytes.Buffer{}
 		if err := r.generateDockerfile(instanceGroup, buf); err != nil {
@@ -222,6 +256,11 @@ func (r *RoleImageBuilder) NewDockerPopulator(instanceGroup *model.InstanceGroup
 
 		return nil
 	}
+
+	if r.Reproducible {
+		return util.NewReproducibleTarPopulator(populator)
+	}
+	return populator
 }
 
 func (r *RoleImageBuilder) generateRunScript(instanceGroup *model.InstanceGroup, assetName string) ([]byte, error) {
@@ -270,9 +309,15 @@ func (r *RoleImageBuilder) generateRunScript(instanceGroup *model.InstanceGroup,
 }
 
 func (r *RoleImageBuilder) generateJobsConfig(instanceGroup *model.InstanceGroup) ([]byte, error) {
+	return GenerateJobsConfig(instanceGroup, instanceGroup.JobReferences)
+}
+
+// GenerateJobsConfig returns the configgin job configuration (job_config.json)
+// rendering the templates of the given jobs of an instance group.
+func GenerateJobsConfig(instanceGroup *model.InstanceGroup, jobReferences model.JobReferences) ([]byte, error) {
 	jobsConfig := make(map[string]map[string]interface{})
 
-	for index, jobReference := range instanceGroup.JobReferences {
+	for index, jobReference := range jobReferences {
 		jobsConfig[jobReference.Name] = make(map[string]interface{})
 		jobsConfig[jobReference.Name]["base"] = fmt.Sprintf("/var/vcap/jobs-src/%s/config_spec.json", jobReference.Name)
 
@@ -316,12 +361,35 @@ func (r *RoleImageBuilder) generateDockerfile(instanceGroup *model.InstanceGroup
 
 	dockerfileTemplate := template.New("Dockerfile-role")
 
+	provenance, err := r.GetProvenance(instanceGroup)
+	if err != nil {
+		return err
+	}
+	labels, err := provenance.Labels()
+	if err != nil {
+		return err
+	}
+
+	healthcheck := ""
+	if !r.ImageOptions.NoHealthcheck {
+		healthcheck, err = instanceGroup.DockerHealthcheck()
+		if err != nil {
+			return err
+		}
+	}
+
 	context := map[string]interface{}{
 		"base_image":     r.BaseImageName,
+		"healthcheck":    healthcheck,
 		"instance_group": instanceGroup,
+		"labels":         labels,
 		"licenses":       instanceGroup.JobReferences[0].Release.License.Files,
 	}
 
+	dockerfileTemplate.Funcs(template.FuncMap{
+		"copy_args": dockerfileCopyArgs,
+		"quote":     dockerfileQuote,
+	})
 	dockerfileTemplate, err = dockerfileTemplate.Parse(string(asset))
 	if err != nil {
 		return err
@@ -330,29 +398,111 @@ func (r *RoleImageBuilder) generateDockerfile(instanceGroup *model.InstanceGroup
 	return dockerfileTemplate.Execute(outputFile, context)
 }
 
+// warnPackageOverrides warns about the packages left out of or substituted
+// in the image of the instance group, as its jobs break if they need them
+func (r *RoleImageBuilder) warnPackageOverrides(instanceGroup *model.InstanceGroup) {
+	overrides := instanceGroup.PackageOverrides
+	if overrides == nil {
+		return
+	}
+	for _, name := range overrides.Exclude {
+		r.UI.Printf("%s: package %s is excluded from the image of instance group %s\n",
+			color.RedString("WARNING"), color.CyanString(name), color.YellowString(instanceGroup.Name))
+	}
+	names := make([]string, 0, len(overrides.Substitute))
+	for name := range overrides.Substitute {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		r.UI.Printf("%s: package %s is substituted with %s in the image of instance group %s\n",
+			color.RedString("WARNING"), color.CyanString(name), color.CyanString(overrides.Substitute[name]), color.YellowString(instanceGroup.Name))
+	}
+}
+
+// dockerfileCopyArgs returns the arguments of the COPY instruction copying
+// a file from the assets of the Dockerfile snippet, in the exec form so that
+// paths with spaces need no escaping
+func dockerfileCopyArgs(source, destination string) (string, error) {
+	args, err := json.Marshal([]string{path.Join(model.DockerfileAssetsDir, filepath.ToSlash(source)), destination})
+	if err != nil {
+		return "", err
+	}
+	return string(args), nil
+}
+
+// addDockerfileAssets writes the assets directory of the Dockerfile snippet
+// of the instance group into the docker build context
+func addDockerfileAssets(instanceGroup *model.InstanceGroup, tarWriter *tar.Writer) error {
+	assetsPath := instanceGroup.GetDockerfileAssetsPath()
+	if assetsPath == "" {
+		return nil
+	}
+	err := filepath.Walk(assetsPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relpath, err := filepath.Rel(assetsPath, filePath)
+		if err != nil {
+			return err
+		}
+		header := tar.Header{
+			Name: path.Join(model.DockerfileAssetsDir, filepath.ToSlash(relpath)),
+			Mode: int64(info.Mode().Perm()),
+		}
+		switch {
+		case info.IsDir():
+			header.Typeflag = tar.TypeDir
+			return util.WriteToTarStream(tarWriter, nil, header)
+		case info.Mode()&os.ModeSymlink != 0:
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname, err = os.Readlink(filePath)
+			if err != nil {
+				return err
+			}
+			return util.WriteToTarStream(tarWriter, nil, header)
+		}
+		return util.CopyFileToTarStream(tarWriter, filePath, &header)
+	})
+	if err != nil {
+		return fmt.Errorf("Error writing the Dockerfile assets of instance group %s: %s", instanceGroup.Name, err)
+	}
+	return nil
+}
+
 type roleBuildJob struct {
 	instanceGroup *model.InstanceGroup
 	builder       *RoleImageBuilder
 	dockerManager dockerImageBuilder
-	resultsCh     chan<- error
+	resultsCh     chan<- roleBuildResult
 	abort         <-chan struct{}
 }
 
+// roleBuildResult is the outcome of a roleBuildJob; skipped jobs were not run
+// because the build was aborted.
+type roleBuildResult struct {
+	instanceGroup *model.InstanceGroup
+	err           error
+	skipped       bool
+	duration      time.Duration // time spent building; zero if not built
+}
+
 func (j roleBuildJob) Run() {
 	select {
 	case <-j.abort:
-		j.resultsCh <- nil
+		j.resultsCh <- roleBuildResult{instanceGroup: j.instanceGroup, skipped: true}
 		return
 	default:
 	}
 
-	j.resultsCh <- func() error {
+	result := roleBuildResult{instanceGroup: j.instanceGroup}
+	result.err = func() error {
 		opinions, err := model.NewOpinions(j.builder.LightOpinionsPath, j.builder.DarkOpinionsPath)
 		if err != nil {
 			return err
 		}
 
-		devVersion, err := j.instanceGroup.GetRoleDevVersion(opinions, j.builder.TagExtra, j.builder.FissileVersion, j.builder.Grapher)
+		devVersion, err := j.instanceGroup.GetRoleDevVersion(opinions, j.builder.TagExtra, j.builder.FissileVersion, j.builder.ImageOptions, j.builder.Grapher)
 		if err != nil {
 			return err
 		}
@@ -410,6 +560,9 @@ func (j roleBuildJob) Run() {
 			return nil
 		}
 
+		started := time.Now()
+		defer func() { result.duration = time.Since(started) }()
+
 		if j.builder.OutputDirectory == "" {
 			j.builder.UI.Printf("Building docker image of %s...\n", color.YellowString(j.instanceGroup.Name))
 
@@ -445,10 +598,13 @@ func (j roleBuildJob) Run() {
 		}
 		return nil
 	}()
+	j.resultsCh <- result
 }
 
-// Build triggers the building of the role docker images in parallel
-func (r *RoleImageBuilder) Build(instanceGroups model.InstanceGroups) error {
+// Build triggers the building of the role docker images in parallel.
+// Once ctx is cancelled, no further images are started and ctx.Err() is
+// returned after the running builds complete.
+func (r *RoleImageBuilder) Build(ctx context.Context, instanceGroups model.InstanceGroups) error {
 	if r.WorkerCount < 1 {
 		return fmt.Errorf("Invalid worker count %d", r.WorkerCount)
 	}
@@ -467,7 +623,7 @@ func (r *RoleImageBuilder) Build(instanceGroups model.InstanceGroups) error {
 	workerLib.MaxJobs = r.WorkerCount
 	worker := workerLib.NewWorker()
 
-	resultsCh := make(chan error)
+	resultsCh := make(chan roleBuildResult)
 	abort := make(chan struct{})
 	for _, instanceGroup := range instanceGroups {
 		worker.Add(roleBuildJob{
@@ -482,17 +638,34 @@ func (r *RoleImageBuilder) Build(instanceGroups model.InstanceGroups) error {
 	go worker.RunUntilDone()
 
 	aborted := false
-	for i := 0; i < len(instanceGroups); i++ {
-		result := <-resultsCh
-		if result != nil {
+	cancelled := ctx.Done()
+	for i := 0; i < len(instanceGroups); {
+		select {
+		case <-cancelled:
+			// Jobs not yet started will be skipped; keep collecting results
+			cancelled = nil
 			if !aborted {
 				close(abort)
 				aborted = true
 			}
-			err = result
+		case result := <-resultsCh:
+			i++
+			if r.ResultHandler != nil && !result.skipped {
+				r.ResultHandler(result.instanceGroup, result.duration, result.err)
+			}
+			if result.err != nil {
+				if !aborted {
+					close(abort)
+					aborted = true
+				}
+				err = result.err
+			}
 		}
 	}
 
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	return err
 }
 
@@ -3,6 +3,7 @@ package builder
 import (
 	"archive/tar"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -16,8 +17,10 @@ import (
 
 	"code.cloudfoundry.org/fissile/model"
 	"code.cloudfoundry.org/fissile/model/loader"
+	"code.cloudfoundry.org/fissile/util"
 	"github.com/SUSE/termui"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func newRoleImageBuilder(manifestPath, lightOpinionsPath, darkOpinionsPath string) *RoleImageBuilder {
@@ -82,6 +85,25 @@ func TestGenerateRoleImageDockerfile(t *testing.T) {
 	assert.NoError(err)
 	dockerfileString = dockerfileContents.String()
 	assert.Contains(dockerfileString, "MAINTAINER", "dev mode should generate a maintainer layer")
+	assert.Contains(dockerfileString, `HEALTHCHECK CMD ["/opt/fissile/readiness-probe.sh"]`)
+
+	dockerfileContents.Reset()
+	roleImageBuilder.ImageOptions.NoHealthcheck = true
+	err = roleImageBuilder.generateDockerfile(roleManifest.InstanceGroups[0], &dockerfileContents)
+	assert.NoError(err)
+	assert.NotContains(dockerfileContents.String(), "HEALTHCHECK")
+
+	instanceGroup := roleManifest.InstanceGroups[0]
+	opinions := model.NewEmptyOpinions()
+	withHealthcheck, err := instanceGroup.GetRoleDevVersion(opinions, "", "", model.RoleImageOptions{}, nil)
+	assert.NoError(err)
+	withoutHealthcheck, err := instanceGroup.GetRoleDevVersion(opinions, "", "", model.RoleImageOptions{NoHealthcheck: true}, nil)
+	assert.NoError(err)
+	assert.NotEqual(withHealthcheck, withoutHealthcheck, "Leaving out the HEALTHCHECK changes the image")
+	instanceGroup.Run.HealthCheck = &model.HealthCheck{Readiness: &model.HealthProbe{Command: []string{"true"}}}
+	withOtherHealthcheck, err := instanceGroup.GetRoleDevVersion(opinions, "", "", model.RoleImageOptions{}, nil)
+	assert.NoError(err)
+	assert.NotEqual(withHealthcheck, withOtherHealthcheck, "Changing the readiness probe changes the HEALTHCHECK")
 }
 
 func TestGenerateRoleImageRunScript(t *testing.T) {
@@ -148,6 +170,155 @@ func TestGenerateRoleImageRunScript(t *testing.T) {
 	}
 }
 
+func TestGenerateRoleImageRunScriptJobFeatures(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/builder/job-features.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{releasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+	torOpinionsDir := filepath.Join(workDir, "../test-assets/tor-opinions")
+	roleImageBuilder := newRoleImageBuilder(roleManifestPath,
+		filepath.Join(torOpinionsDir, "opinions.yml"),
+		filepath.Join(torOpinionsDir, "dark-opinions.yml"))
+
+	runScriptContents, err := roleImageBuilder.generateRunScript(roleManifest.InstanceGroups[0], "run.sh")
+	require.NoError(t, err)
+	runScript := string(runScriptContents)
+	assert.Contains(t, runScript, `if [ "$FEATURE_HOSTNAME_ENABLED" != "true" ] ; then
+  rm -rf /var/vcap/jobs/new_hostname /var/vcap/monit/new_hostname.monitrc
+fi`)
+	assert.Contains(t, runScript, `if [ "$FEATURE_HOSTNAME_ENABLED" = "true" ] ; then
+  rm -rf /var/vcap/jobs/hashmat /var/vcap/monit/hashmat.monitrc
+fi`)
+	assert.NotContains(t, runScript, "rm -rf /var/vcap/jobs/tor")
+}
+
+func TestGenerateRoleImageRunScriptLogToStdout(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/builder/log-to-stdout.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{releasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+	torOpinionsDir := filepath.Join(workDir, "../test-assets/tor-opinions")
+	roleImageBuilder := newRoleImageBuilder(roleManifestPath,
+		filepath.Join(torOpinionsDir, "opinions.yml"),
+		filepath.Join(torOpinionsDir, "dark-opinions.yml"))
+
+	runScriptContents, err := roleImageBuilder.generateRunScript(roleManifest.InstanceGroups[0], "run.sh")
+	require.NoError(t, err)
+	runScript := string(runScriptContents)
+	assert.Contains(t, runScript,
+		"    for file in /var/vcap/sys/log/tor/*.log /var/vcap/sys/log/tor/*.stderr.log /var/vcap/sys/log/new_hostname/*.log; do\n")
+	assert.True(t, strings.Index(runScript, "declare -A tailed") < strings.Index(runScript, "# Run pre-start scripts"),
+		"The log files are copied before the pre-start scripts run")
+
+	runScriptContents, err = roleImageBuilder.generateRunScript(roleManifest.InstanceGroups[1], "run.sh")
+	require.NoError(t, err)
+	assert.NotContains(t, string(runScriptContents), "declare -A tailed")
+
+	opinions := model.NewEmptyOpinions()
+	withLogs, err := roleManifest.InstanceGroups[0].GetRoleDevVersion(opinions, "", "", model.RoleImageOptions{}, nil)
+	require.NoError(t, err)
+	logPaths := roleManifest.InstanceGroups[0].Run.LogPaths
+	roleManifest.InstanceGroups[0].Run.LogPaths = logPaths[:len(logPaths)-1]
+	withOtherLogs, err := roleManifest.InstanceGroups[0].GetRoleDevVersion(opinions, "", "", model.RoleImageOptions{}, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, withLogs, withOtherLogs, "Changing the log paths changes the image")
+	roleManifest.InstanceGroups[0].Run.LogToStdout = false
+	withoutLogs, err := roleManifest.InstanceGroups[0].GetRoleDevVersion(opinions, "", "", model.RoleImageOptions{}, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, withLogs, withoutLogs, "Copying the log files changes the image")
+}
+
+func TestGenerateRoleImageDockerfileSnippet(t *testing.T) {
+	t.Parallel()
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/builder/dockerfile-snippet.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{releasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+	instanceGroup := roleManifest.InstanceGroups[0]
+	torOpinionsDir := filepath.Join(workDir, "../test-assets/tor-opinions")
+	roleImageBuilder := newRoleImageBuilder(roleManifestPath,
+		filepath.Join(torOpinionsDir, "opinions.yml"),
+		filepath.Join(torOpinionsDir, "dark-opinions.yml"))
+
+	var dockerfileContents bytes.Buffer
+	err = roleImageBuilder.generateDockerfile(instanceGroup, &dockerfileContents)
+	require.NoError(t, err)
+	dockerfile := dockerfileContents.String()
+	assert.Contains(t, dockerfile, "ENV APP_CONFIG=\"/etc/app.conf\"\n")
+	assert.Contains(t, dockerfile, "ENV GREETING=\"say \\\"hi\\\"\"\n")
+	assert.Contains(t, dockerfile, "COPY [\"assets/etc/app.conf\",\"/etc/app.conf\"]\n")
+	assert.Contains(t, dockerfile, "RUN chmod 0600 /etc/app.conf\n")
+	assert.True(t, strings.Index(dockerfile, "ADD root /") < strings.Index(dockerfile, "ENV APP_CONFIG"),
+		"The snippet follows the files of the role")
+	assert.True(t, strings.Index(dockerfile, "COPY") < strings.Index(dockerfile, "RUN"),
+		"The assets are copied before the commands run")
+
+	var context bytes.Buffer
+	tarWriter := tar.NewWriter(&context)
+	require.NoError(t, addDockerfileAssets(instanceGroup, tarWriter))
+	require.NoError(t, tarWriter.Close())
+	assets := map[string]string{}
+	tarReader := tar.NewReader(&context)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		contents, err := ioutil.ReadAll(tarReader)
+		require.NoError(t, err)
+		assets[header.Name] = string(contents)
+	}
+	assert.Equal(t, map[string]string{
+		"assets":              "",
+		"assets/etc":          "",
+		"assets/etc/app.conf": "listen 8080\n",
+	}, assets)
+
+	opinions := model.NewEmptyOpinions()
+	withSnippet, err := instanceGroup.GetRoleDevVersion(opinions, "", "", model.RoleImageOptions{}, nil)
+	require.NoError(t, err)
+	instanceGroup.Dockerfile.Run = append(instanceGroup.Dockerfile.Run, "true")
+	withOtherSnippet, err := instanceGroup.GetRoleDevVersion(opinions, "", "", model.RoleImageOptions{}, nil)
+	require.NoError(t, err)
+	instanceGroup.Dockerfile = nil
+	withoutSnippet, err := instanceGroup.GetRoleDevVersion(opinions, "", "", model.RoleImageOptions{}, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, withSnippet, withOtherSnippet, "Changing the snippet changes the image")
+	assert.NotEqual(t, withSnippet, withoutSnippet, "The snippet changes the image")
+}
+
 func TestGenerateRoleImageJobsConfig(t *testing.T) {
 	assert := assert.New(t)
 
@@ -340,6 +511,51 @@ func TestGenerateRoleImageDockerfileDir(t *testing.T) {
 	}
 }
 
+func TestRoleImageNewDockerPopulatorReproducible(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	releasePath := filepath.Join(workDir, "../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../test-assets/role-manifests/builder/tor-good.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{releasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+
+	// License files are kept in a map; add enough of them that the order
+	// they are written in varies between builds
+	release := roleManifest.InstanceGroups[0].JobReferences[0].Release
+	for i := 0; i < 16; i++ {
+		release.License.Files[fmt.Sprintf("NOTICE-%d", i)] = []byte(fmt.Sprintf("notice %d", i))
+	}
+
+	torOpinionsDir := filepath.Join(workDir, "../test-assets/tor-opinions")
+	roleImageBuilder := newRoleImageBuilder(roleManifestPath,
+		filepath.Join(torOpinionsDir, "opinions.yml"),
+		filepath.Join(torOpinionsDir, "dark-opinions.yml"))
+	roleImageBuilder.BaseImageName = filepath.Join(releasePath, "config_spec")
+	roleImageBuilder.Reproducible = true
+
+	build := func() []byte {
+		tarFile := &bytes.Buffer{}
+		tarWriter := tar.NewWriter(tarFile)
+		populator := roleImageBuilder.NewDockerPopulator(roleManifest.InstanceGroups[0])
+		require.NoError(t, populator(tarWriter))
+		require.NoError(t, tarWriter.Close())
+		return tarFile.Bytes()
+	}
+
+	first := util.Hash(string(build()))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, first, util.Hash(string(build())), "Role image tarball is not reproducible")
+	}
+}
+
 // getPackage is a helper to get a package from a list of roles
 func getPackage(instanceGroups model.InstanceGroups, role, job, pkg string) *model.Package {
 	for _, r := range instanceGroups {
@@ -463,12 +679,12 @@ func TestBuildRoleImages(t *testing.T) {
 		return fmt.Errorf("Unknown docker image name %s", name)
 	}
 
-	err = roleImageBuilder.Build(roleManifest.InstanceGroups)
+	err = roleImageBuilder.Build(context.Background(), roleManifest.InstanceGroups)
 	assert.NoError(err)
 
 	// Should not allow invalid worker counts
 	roleImageBuilder.WorkerCount = 0
-	err = roleImageBuilder.Build(roleManifest.InstanceGroups)
+	err = roleImageBuilder.Build(context.Background(), roleManifest.InstanceGroups)
 	assert.Error(err, "Invalid worker count should result in an error")
 	assert.Contains(err.Error(), "count", "Building the image should have failed due to invalid worker count")
 
@@ -487,7 +703,7 @@ func TestBuildRoleImages(t *testing.T) {
 	}
 
 	roleImageBuilder.WorkerCount = 1
-	err = roleImageBuilder.Build(roleManifest.InstanceGroups)
+	err = roleImageBuilder.Build(context.Background(), roleManifest.InstanceGroups)
 	if assert.Error(err) {
 		assert.Contains(err.Error(), "Deliberate failure", "Returned error should be from first job failing")
 	}
@@ -504,7 +720,7 @@ func TestBuildRoleImages(t *testing.T) {
 		return nil
 	}
 	roleImageBuilder.WorkerCount = len(roleManifest.InstanceGroups)
-	err = roleImageBuilder.Build(roleManifest.InstanceGroups)
+	err = roleImageBuilder.Build(context.Background(), roleManifest.InstanceGroups)
 	assert.NoError(err)
 	assert.Empty(buildersRan, "should not have ran any builders")
 
@@ -521,7 +737,7 @@ func TestBuildRoleImages(t *testing.T) {
 		return nil
 	}
 	roleImageBuilder.WorkerCount = 1
-	err = roleImageBuilder.Build(roleManifest.InstanceGroups)
+	err = roleImageBuilder.Build(context.Background(), roleManifest.InstanceGroups)
 	assert.NoError(err)
 
 	expected := `.*,fissile,create-images::test-registry.com:9000/test-organization/test-repository-myrole:[a-z0-9]{40},start
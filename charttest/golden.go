@@ -0,0 +1,52 @@
+package charttest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// UpdateGoldenEnvVar is the environment variable which, when set to a non
+// empty value, makes AssertGolden write the actual output to the golden files
+// instead of comparing against them.
+const UpdateGoldenEnvVar = "CHARTTEST_UPDATE_GOLDEN"
+
+// AssertGolden asserts that the actual value (usually the result of rendering
+// a template) is equal to the YAML stored in the golden file.  Missing golden
+// files fail the assertion; run the tests with CHARTTEST_UPDATE_GOLDEN=1 to
+// create or update them, and review the changes before committing them.
+func AssertGolden(assert *assert.Assertions, goldenPath string, actual interface{}) bool {
+	if os.Getenv(UpdateGoldenEnvVar) != "" {
+		contents, err := yaml.Marshal(actual)
+		if !assert.NoError(err, "Error serializing the actual value for %s", goldenPath) {
+			return false
+		}
+		if !assert.NoError(os.MkdirAll(filepath.Dir(goldenPath), 0755)) {
+			return false
+		}
+		return assert.NoError(ioutil.WriteFile(goldenPath, contents, 0644), "Error updating golden file")
+	}
+
+	contents, err := ioutil.ReadFile(goldenPath)
+	if !assert.NoError(err, "Error reading golden file; set %s=1 to create it", UpdateGoldenEnvVar) {
+		return false
+	}
+	var expected interface{}
+	if !assert.NoError(yaml.Unmarshal(contents, &expected), "Error parsing golden file %s", goldenPath) {
+		return false
+	}
+
+	// Normalize the actual value the same way as the golden file contents
+	actualYAML, err := yaml.Marshal(actual)
+	if !assert.NoError(err, "Error serializing the actual value for %s", goldenPath) {
+		return false
+	}
+	var normalized interface{}
+	if !assert.NoError(yaml.Unmarshal(actualYAML, &normalized)) {
+		return false
+	}
+	return IsYAMLEqual(assert, expected, normalized)
+}
@@ -0,0 +1,33 @@
+package charttest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssertGoldenUpdate(t *testing.T) {
+	assert := assert.New(t)
+
+	tempDir, err := ioutil.TempDir("", "charttest")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	goldenPath := filepath.Join(tempDir, "sub", "golden.yaml")
+	actual := map[string]interface{}{"key": []interface{}{"value"}}
+
+	os.Setenv(UpdateGoldenEnvVar, "1")
+	updated := AssertGolden(assert, goldenPath, actual)
+	os.Unsetenv(UpdateGoldenEnvVar)
+	require.True(t, updated)
+
+	contents, err := ioutil.ReadFile(goldenPath)
+	require.NoError(t, err)
+	assert.Equal("key:\n- value\n", string(contents))
+
+	assert.True(AssertGolden(assert, goldenPath, actual))
+}
@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/fissile/app"
+	"code.cloudfoundry.org/fissile/compilator"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// buildAllCmd represents the all command
+var buildAllCmd = &cobra.Command{
+	Use:   "all",
+	Short: "Builds the packages, images, and Helm charts of a directory of role manifests.",
+	Long: `
+This command builds every role manifest in the ` + "`--manifest-dir`" + ` directory,
+i.e. every YAML file there with instance groups, using the releases, opinions,
+and repository of the global flags.
+
+The packages of all role manifests are compiled before any image is built, into
+the compilation directory they share, so that a package used by several role
+manifests is compiled once.  The images of each role manifest are then built,
+and with ` + "`--helm-output-dir`" + `, its Helm chart is written to a
+subdirectory named after the role manifest file, without its extension.  The
+charts are generated with the same flags as ` + "`build helm`" + `, including
+` + "`--export-config`" + `, except for the output directory.
+
+A role manifest failing to load or build does not stop the others.  At the end,
+a summary lists the outcome of each role manifest, and the command fails if any
+of them failed.
+
+Each role manifest has its own lockfile, ` + "`<name>.fissile.lock`" + ` next to
+it, which is written, or checked with ` + "`--locked`" + `, so ` + "`--lockfile`" + `
+cannot be used.  Neither can ` + "`--model-out`" + `;
+write the model of each role manifest with ` + "`validate --model-out`" + `.
+	`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if buildViper.GetString("lockfile") != "" {
+			return fmt.Errorf("--lockfile cannot be used with build all, which uses a lockfile per role manifest")
+		}
+		if viper.GetString("model-out") != "" {
+			return fmt.Errorf("--model-out cannot be used with build all, which loads several role manifests")
+		}
+		fissile.Options.Locked = buildViper.GetBool("locked")
+
+		opt := app.BuildAllOptions{
+			ManifestDir:            buildAllViper.GetString("manifest-dir"),
+			Stemcell:               buildAllViper.GetString("stemcell"),
+			CompilationCacheConfig: buildAllViper.GetString("compilation-cache-config"),
+			DockerNetworkMode:      buildAllViper.GetString("docker-network-mode"),
+			WithoutDocker:          buildAllViper.GetBool("without-docker"),
+			StreamPackages:         buildAllViper.GetBool("stream-packages"),
+			Hermetic:               buildAllViper.GetBool("hermetic"),
+			WarmContainers:         buildAllViper.GetBool("warm-containers"),
+			ContainerSettings: compilator.ContainerSettings{
+				DNS:        buildAllViper.GetStringSlice("compilation-dns"),
+				ExtraHosts: buildAllViper.GetStringSlice("compilation-add-host"),
+				Env:        buildAllViper.GetStringSlice("compilation-env"),
+			},
+			Images: app.BuildImagesOptions{
+				Force:        buildAllViper.GetBool("force"),
+				TagExtra:     buildAllViper.GetString("tag-extra"),
+				Reproducible: buildAllViper.GetBool("reproducible"),
+			},
+		}
+		if opt.ManifestDir == "" {
+			return fmt.Errorf("--manifest-dir is a required parameter")
+		}
+		if opt.Stemcell == "" {
+			return fmt.Errorf("--stemcell is a required parameter")
+		}
+		err := absolutePaths(&opt.ManifestDir)
+		if err != nil {
+			return err
+		}
+
+		if helmOutputDir := buildAllViper.GetString("helm-output-dir"); helmOutputDir != "" {
+			settings, err := buildHelmSettings(cmd, buildAllViper, helmOutputDir)
+			if err != nil {
+				return err
+			}
+			// The images and the charts referencing them must agree on the tags
+			opt.Images.TagExtra = settings.TagExtra
+			opt.Helm = &settings
+		}
+
+		err = fissile.GraphBegin(buildViper.GetString("output-graph"))
+		if err != nil {
+			return err
+		}
+
+		return fissile.BuildAll(context.Background(), opt)
+	},
+}
+
+var buildAllViper = viper.New()
+
+func init() {
+	initViper(buildAllViper)
+
+	buildCmd.AddCommand(buildAllCmd)
+
+	buildAllCmd.PersistentFlags().StringP(
+		"manifest-dir",
+		"",
+		"",
+		"Directory of the role manifests to build",
+	)
+
+	buildAllCmd.PersistentFlags().StringP(
+		"stemcell",
+		"s",
+		"",
+		"The source stemcell",
+	)
+
+	buildAllCmd.PersistentFlags().StringP(
+		"compilation-cache-config",
+		"",
+		filepath.Join(os.Getenv("HOME"), ".fissile", "package-cache.yaml"),
+		"Points to a file containing configuration for a compiled package cache or contains the configuration as valid yaml",
+	)
+
+	buildAllCmd.PersistentFlags().BoolP(
+		"without-docker",
+		"",
+		false,
+		"Build packages without docker; this may adversely affect your system.  Only supported on Linux, and requires CAP_SYS_ADMIN.",
+	)
+
+	buildAllCmd.PersistentFlags().StringP(
+		"docker-network-mode",
+		"",
+		"",
+		"Specify network mode to be used when compiling packages with docker. e.g. \"--docker-network-mode host\" is equivalent to \"docker run --network=host\"",
+	)
+
+	buildAllCmd.PersistentFlags().BoolP(
+		"stream-packages",
+		"",
+		false,
+		"If true, fissile will stream packages to the docker daemon for compilation, instead of mounting volumes",
+	)
+
+	buildAllCmd.PersistentFlags().BoolP(
+		"hermetic",
+		"",
+		false,
+		"Compile packages without network access. All package sources must be available locally; packaging scripts that try to download anything will fail.",
+	)
+
+	buildAllCmd.PersistentFlags().BoolP(
+		"warm-containers",
+		"",
+		false,
+		"Compile packages in a pool of containers, one per worker, reset between packages, instead of a fresh container per package. Faster for many small packages; only use it with trusted releases.",
+	)
+
+	buildAllCmd.PersistentFlags().StringSliceP(
+		"compilation-dns",
+		"",
+		nil,
+		"DNS servers of the compilation containers; comma separated IP addresses.",
+	)
+
+	buildAllCmd.PersistentFlags().StringSliceP(
+		"compilation-add-host",
+		"",
+		nil,
+		"Additional /etc/hosts entries of the compilation containers, as host:ip; comma separated.",
+	)
+
+	buildAllCmd.PersistentFlags().StringSliceP(
+		"compilation-env",
+		"",
+		nil,
+		"Environment variables passed to every package compilation, as KEY=VALUE; comma separated. Quote values containing commas, e.g. '\"no_proxy=a,b\"'. They do not change the package fingerprints.",
+	)
+
+	buildAllCmd.PersistentFlags().BoolP(
+		"force",
+		"F",
+		false,
+		"If specified, image creation will proceed even when images already exist.",
+	)
+
+	buildAllCmd.PersistentFlags().BoolP(
+		"reproducible",
+		"",
+		false,
+		"Normalize timestamps, ownership, and ordering of the generated build contexts so identical inputs produce identical tarballs",
+	)
+
+	buildAllCmd.PersistentFlags().StringP(
+		"helm-output-dir",
+		"",
+		"",
+		"Write the Helm chart of each role manifest to a subdirectory of this directory; no charts are written if empty",
+	)
+
+	addBuildHelmFlags(buildAllCmd.PersistentFlags())
+
+	buildAllViper.BindPFlags(buildAllCmd.PersistentFlags())
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"context"
+
 	"github.com/spf13/cobra"
 )
 
@@ -16,7 +18,7 @@ and remove all which are not required anymore.`,
 		if err != nil {
 			return err
 		}
-		return fissile.CleanCache()
+		return fissile.CleanCache(context.Background())
 	},
 }
 
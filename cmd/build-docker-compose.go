@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/fissile/app"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// buildDockerComposeCmd represents the docker-compose command
+var buildDockerComposeCmd = &cobra.Command{
+	Use:   "docker-compose",
+	Short: "Creates a docker compose file for local development.",
+	Long: `
+This command writes a docker compose file running the role images on a single
+host, so that developers can run some instance groups without a Kubernetes
+cluster.  The role images must have been built with ` + "`fissile build images`" + `
+before.
+
+Every instance group becomes a service, with the environment variables of its
+containers set to the defaults of the variables, which ` + "`--defaults-file`" + ` can
+override.  Secrets without a default are read from the environment of docker
+compose, e.g. an .env file.  Public ports are published on the host, and the
+services depend on the instance groups providing the links they consume.
+Colocated containers share the network of their main instance group.
+
+With ` + "`--instance-groups`" + `, only the named instance groups are run, along with
+the instance groups they depend on and their colocated containers.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		err := fissile.LoadManifest()
+		if err != nil {
+			return err
+		}
+
+		return fissile.Export(context.Background(), "docker-compose", app.DockerComposeOptions{
+			OutputFile:     buildDockerComposeViper.GetString("output"),
+			InstanceGroups: splitNonEmpty(buildDockerComposeViper.GetString("instance-groups"), ","),
+			DefaultsFiles:  splitNonEmpty(buildDockerComposeViper.GetString("defaults-file"), ","),
+			TagExtra:       buildDockerComposeViper.GetString("tag-extra"),
+		})
+	},
+}
+
+var buildDockerComposeViper = viper.New()
+
+func init() {
+	initViper(buildDockerComposeViper)
+
+	buildCmd.AddCommand(buildDockerComposeCmd)
+
+	buildDockerComposeCmd.PersistentFlags().StringP(
+		"output",
+		"",
+		"docker-compose.yml",
+		"Path of the docker compose file to write",
+	)
+
+	buildDockerComposeCmd.PersistentFlags().StringP(
+		"instance-groups",
+		"",
+		"",
+		"Comma separated list of instance groups to run, along with those they depend on; all by default",
+	)
+
+	buildDockerComposeCmd.PersistentFlags().StringP(
+		"defaults-file",
+		"",
+		"",
+		"Comma separated list of YAML or KEY=value files overriding the defaults of variables; later files take precedence",
+	)
+
+	buildDockerComposeCmd.PersistentFlags().StringP(
+		"tag-extra",
+		"",
+		"",
+		"Additional information to use in computing the image tags",
+	)
+
+	buildDockerComposeViper.BindPFlags(buildDockerComposeCmd.PersistentFlags())
+}
@@ -1,18 +1,35 @@
 package cmd
 
 import (
+	"context"
+
 	"code.cloudfoundry.org/fissile/kube"
 	"code.cloudfoundry.org/fissile/model"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 var (
-	flagBuildHelmOutputDir       string
-	flagBuildHelmUseMemoryLimits bool
-	flagBuildHelmUseCPULimits    bool
-	flagBuildHelmTagExtra        string
-	flagBuildHelmAuthType        string
+	flagBuildHelmUseMemoryLimits    bool
+	flagBuildHelmUseCPULimits       bool
+	flagBuildHelmTagExtra           string
+	flagBuildHelmKubeSchemaDir      string
+	flagBuildHelmServiceNaming      string
+	flagBuildHelmSecretGrouping     string
+	flagBuildHelmConfigChecksum     string
+	flagBuildHelmImmutableConfig    bool
+	flagBuildHelmValuesDocs         string
+	flagBuildHelmAuthType           string
+	flagBuildHelmRoles              string
+	flagBuildHelmSkipRoles          string
+	flagBuildHelmDebugRoles         string
+	flagBuildHelmOverlayDir         string
+	flagBuildHelmOpenShift          bool
+	flagBuildHelmPortRanges         string
+	flagBuildHelmDeploymentManifest bool
+	flagBuildHelmSubCharts          bool
+	flagBuildHelmVMTypes            string
 )
 
 // buildHelmCmd represents the helm command
@@ -21,12 +38,6 @@ var buildHelmCmd = &cobra.Command{
 	Short: "Creates Helm chart.",
 	Long:  ``,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		flagBuildHelmOutputDir = buildHelmViper.GetString("output-dir")
-		flagBuildHelmUseMemoryLimits = buildHelmViper.GetBool("use-memory-limits")
-		flagBuildHelmUseCPULimits = buildHelmViper.GetBool("use-cpu-limits")
-		flagBuildHelmTagExtra = buildHelmViper.GetString("tag-extra")
-		flagBuildHelmAuthType = buildHelmViper.GetString("auth-type")
-
 		err := fissile.GraphBegin(buildViper.GetString("output-graph"))
 		if err != nil {
 			return err
@@ -37,35 +48,87 @@ var buildHelmCmd = &cobra.Command{
 			return err
 		}
 
-		opinions, err := model.NewOpinions(
-			fissile.Options.LightOpinions,
-			fissile.Options.DarkOpinions,
-		)
+		settings, err := buildHelmSettings(cmd, buildHelmViper, buildHelmViper.GetString("output-dir"))
 		if err != nil {
 			return err
 		}
 
-		settings := kube.ExportSettings{
-			OutputDir:       flagBuildHelmOutputDir,
-			Registry:        fissile.Options.DockerRegistry,
-			Username:        fissile.Options.DockerUsername,
-			Password:        fissile.Options.DockerPassword,
-			Organization:    fissile.Options.DockerOrganization,
-			Repository:      fissile.Options.RepositoryPrefix,
-			UseMemoryLimits: flagBuildHelmUseMemoryLimits,
-			UseCPULimits:    flagBuildHelmUseCPULimits,
-			FissileVersion:  fissile.Version,
-			Opinions:        opinions,
-			CreateHelmChart: true,
-			TagExtra:        flagBuildHelmTagExtra,
-			AuthType:        flagBuildHelmAuthType,
-		}
-
-		return fissile.GenerateKube(settings)
+		return fissile.Export(context.Background(), "helm", settings)
 	},
 }
 var buildHelmViper = viper.New()
 
+// buildHelmSettings returns the export settings of a helm chart, from the
+// flags of build helm in v and the export config, writing the chart to
+// outputDir.  Commands embedding build helm, like build all, register the
+// same flags with addBuildHelmFlags.
+func buildHelmSettings(cmd *cobra.Command, v *viper.Viper, outputDir string) (kube.ExportSettings, error) {
+	flagBuildHelmUseMemoryLimits = v.GetBool("use-memory-limits")
+	flagBuildHelmUseCPULimits = v.GetBool("use-cpu-limits")
+	flagBuildHelmTagExtra = v.GetString("tag-extra")
+	flagBuildHelmKubeSchemaDir = v.GetString("kube-schema-dir")
+	flagBuildHelmServiceNaming = v.GetString("service-naming")
+	flagBuildHelmSecretGrouping = v.GetString("secret-grouping")
+	flagBuildHelmConfigChecksum = v.GetString("config-checksum")
+	flagBuildHelmImmutableConfig = v.GetBool("immutable-config")
+	flagBuildHelmValuesDocs = v.GetString("values-docs")
+	flagBuildHelmAuthType = v.GetString("auth-type")
+	flagBuildHelmDebugRoles = v.GetString("debug-roles")
+	flagBuildHelmRoles = v.GetString("roles")
+	flagBuildHelmSkipRoles = v.GetString("skip-roles")
+	flagBuildHelmOverlayDir = v.GetString("overlay-dir")
+	flagBuildHelmOpenShift = v.GetBool("openshift")
+	flagBuildHelmPortRanges = v.GetString("port-ranges")
+	flagBuildHelmDeploymentManifest = v.GetBool("deployment-manifest")
+	flagBuildHelmSubCharts = v.GetBool("sub-charts")
+	flagBuildHelmVMTypes = v.GetString("vm-types")
+
+	opinions, err := model.NewOpinions(
+		fissile.Options.LightOpinions,
+		fissile.Options.DarkOpinions,
+	)
+	if err != nil {
+		return kube.ExportSettings{}, err
+	}
+
+	settings := kube.ExportSettings{
+		OutputDir:          outputDir,
+		Registry:           fissile.Options.DockerRegistry,
+		Username:           fissile.Options.DockerUsername,
+		Password:           fissile.Options.DockerPassword,
+		Organization:       fissile.Options.DockerOrganization,
+		Repository:         fissile.Options.RepositoryPrefix,
+		UseMemoryLimits:    flagBuildHelmUseMemoryLimits,
+		UseCPULimits:       flagBuildHelmUseCPULimits,
+		FissileVersion:     fissile.Version,
+		Opinions:           opinions,
+		CreateHelmChart:    true,
+		TagExtra:           flagBuildHelmTagExtra,
+		KubeSchemaDir:      flagBuildHelmKubeSchemaDir,
+		ServiceNaming:      kube.ServiceNamingStrategy(flagBuildHelmServiceNaming),
+		SecretGrouping:     kube.SecretGrouping(flagBuildHelmSecretGrouping),
+		ConfigChecksum:     kube.ConfigChecksum(flagBuildHelmConfigChecksum),
+		ImmutableConfig:    flagBuildHelmImmutableConfig,
+		ValuesDocs:         flagBuildHelmValuesDocs,
+		AuthType:           flagBuildHelmAuthType,
+		DebugRoles:         splitNonEmpty(flagBuildHelmDebugRoles, ","),
+		Roles:              splitNonEmpty(flagBuildHelmRoles, ","),
+		SkipRoles:          splitNonEmpty(flagBuildHelmSkipRoles, ","),
+		OverlayDir:         flagBuildHelmOverlayDir,
+		OpenShift:          flagBuildHelmOpenShift,
+		PortRanges:         kube.PortRangeStrategy(flagBuildHelmPortRanges),
+		DeploymentManifest: flagBuildHelmDeploymentManifest,
+		SubCharts:          flagBuildHelmSubCharts,
+		VMTypes:            flagBuildHelmVMTypes,
+	}
+
+	err = applyExportConfig(cmd, v, v.GetString("export-config"), &settings)
+	if err != nil {
+		return kube.ExportSettings{}, err
+	}
+	return settings, nil
+}
+
 func init() {
 	initViper(buildHelmViper)
 
@@ -78,40 +141,159 @@ func init() {
 		"Helm chart files will be written to this directory",
 	)
 
-	buildHelmCmd.PersistentFlags().BoolP(
+	addBuildHelmFlags(buildHelmCmd.PersistentFlags())
+
+	buildHelmViper.BindPFlags(buildHelmCmd.PersistentFlags())
+}
+
+// addBuildHelmFlags registers the flags of build helm, other than its output
+// directory, read by buildHelmSettings.
+func addBuildHelmFlags(flags *pflag.FlagSet) {
+	flags.BoolP(
 		"use-memory-limits",
 		"",
 		true,
 		"Include memory limits when generating helm chart",
 	)
 
-	buildHelmCmd.PersistentFlags().BoolP(
+	flags.BoolP(
 		"use-cpu-limits",
 		"",
 		true,
 		"Include cpu limits when generating helm chart",
 	)
 
-	buildHelmCmd.PersistentFlags().StringP(
+	flags.StringP(
 		"tag-extra",
 		"",
 		"",
 		"Additional information to use in computing the image tags",
 	)
 
-	buildHelmCmd.PersistentFlags().BoolP(
+	flags.BoolP(
 		"use-secrets-generator",
 		"",
 		false,
 		"Passwords will not be set by helm templates, but all secrets with a generator will be set/updated at runtime via a generator job like https://github.com/SUSE/scf-seret-generator",
 	)
 
-	buildHelmCmd.PersistentFlags().StringP(
+	flags.StringP(
 		"auth-type",
 		"",
 		"",
 		"Sets the Kubernetes auth type",
 	)
 
-	buildHelmViper.BindPFlags(buildHelmCmd.PersistentFlags())
+	flags.StringP(
+		"kube-schema-dir",
+		"",
+		"",
+		"Validate the generated objects against the Kubernetes JSON schemas in this directory; no schemas are bundled, so validation is off without it",
+	)
+
+	flags.StringP(
+		"service-naming",
+		"",
+		string(kube.ServiceNamingTruncate),
+		"How to handle service names too long for Kubernetes, one of truncate (shorten with a hash suffix) or strict (fail)",
+	)
+
+	flags.StringP(
+		"port-ranges",
+		"",
+		string(kube.PortRangesExpand),
+		"How services expose port ranges, one of expand (a service port per port) or annotate (the first port, with the range in an annotation)",
+	)
+
+	flags.StringP(
+		"secret-grouping",
+		"",
+		string(kube.SecretGroupingSingle),
+		"How to split the user secrets into Secret objects, one of single (one object) or instance-group (one object per consuming instance group)",
+	)
+
+	flags.StringP(
+		"config-checksum",
+		"",
+		string(kube.ConfigChecksumChart),
+		"What the checksum rolling the pods on config changes covers, one of chart (all secrets and config maps) or instance-group (the secrets, deployment manifest entries, and config maps each instance group consumes)",
+	)
+
+	flags.BoolP(
+		"immutable-config",
+		"",
+		false,
+		"Make the secrets and config maps the pods consume immutable, named after a hash of their values, so that changes create new objects and roll the pods consuming them",
+	)
+
+	flags.StringP(
+		"values-docs",
+		"",
+		"",
+		"Also write a table documenting the chart values, in markdown (values.md) or csv (values.csv) format",
+	)
+
+	// viper is busted w/ string slice, https://github.com/spf13/viper/issues/200
+	flags.StringP(
+		"roles",
+		"",
+		"",
+		"Generate only the given instance groups (and their colocated containers); comma separated",
+	)
+
+	flags.StringP(
+		"skip-roles",
+		"",
+		"",
+		"Do not generate the given instance groups; comma separated",
+	)
+
+	flags.StringP(
+		"debug-roles",
+		"",
+		"",
+		"Comma separated list of instance groups whose containers sleep instead of running their jobs, without probes and privileged, to exec into them for debugging",
+	)
+
+	flags.StringP(
+		"overlay-dir",
+		"",
+		"",
+		"Directory of files (extra templates, helpers, icons) copied into the chart; they may not replace generated files",
+	)
+
+	flags.BoolP(
+		"openshift",
+		"",
+		false,
+		"Generate for OpenShift: routes for public ports, security context constraints for the pod security policies, and no fixed user ids",
+	)
+
+	flags.BoolP(
+		"deployment-manifest",
+		"",
+		false,
+		"Generate the default deployment manifest (the bosh values) from the role manifest",
+	)
+
+	flags.BoolP(
+		"sub-charts",
+		"",
+		false,
+		"Write the instance groups of each group of the role manifest into a sub-chart of their own, sharing the global values",
+	)
+
+	flags.StringP(
+		"vm-types",
+		"",
+		"",
+		"Path to a YAML file mapping the BOSH vm_types of instance groups to the memory and cpu requests used where the role manifest sets none",
+	)
+
+	flags.StringP(
+		"export-config",
+		"",
+		"",
+		"Path to a YAML file with the export settings; flags, FISSILE_* environment variables and the fissile config file take precedence",
+	)
 }
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"context"
+
 	"fmt"
 	"strings"
 
@@ -31,6 +33,23 @@ the image.
 
 The ` + "`--patch-properties-release`" + ` flag is used to distinguish the patchProperties release/job spec
 from other specs.  At most one is allowed.
+
+With ` + "`--scan trivy`" + ` or ` + "`--scan grype`" + `, the built images are scanned for
+vulnerabilities with the given scanner, which must be installed.  The
+vulnerabilities of all images are written to a consolidated JSON or SARIF
+report, and the build fails if an image has vulnerabilities of the
+` + "`--scan-fail-severity`" + ` or higher.
+
+With the global ` + "`--attributions`" + ` flag, the LICENSE and NOTICE files of the
+releases and packages of each instance group are written to
+` + "`/usr/share/doc/fissile/ATTRIBUTIONS.txt`" + ` in its image.  This changes the
+image tags, so pass that flag to the other commands using the images too.
+
+The images of long running instance groups have a HEALTHCHECK running the
+readiness probe, for running them outside of kubernetes, which ignores it.
+The global ` + "`--no-healthcheck`" + ` flag leaves it out.  The HEALTHCHECK is part
+of the image tags, so pass that flag to the other commands using the images
+too, like ` + "`build helm`" + `.
 	`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		var opt app.BuildImagesOptions
@@ -42,8 +61,16 @@ from other specs.  At most one is allowed.
 		opt.Stemcell = buildImagesViper.GetString("stemcell")
 		opt.StemcellID = buildImagesViper.GetString("stemcell-id")
 		opt.TagExtra = buildImagesViper.GetString("tag-extra")
+		opt.Reproducible = buildImagesViper.GetBool("reproducible")
+		opt.VersionRecord = buildImagesViper.GetString("version-record")
+		opt.Scan = app.ImageScanOptions{
+			Scanner:      buildImagesViper.GetString("scan"),
+			FailSeverity: buildImagesViper.GetString("scan-fail-severity"),
+			Report:       buildImagesViper.GetString("scan-report"),
+			ReportFormat: buildImagesViper.GetString("scan-report-format"),
+		}
 
-		opt.Roles = strings.FieldsFunc(buildImagesViper.GetString("roles"), func(r rune) bool { return r == ',' })
+		opt.Roles = splitNonEmpty(buildImagesViper.GetString("roles"), ",")
 
 		opt.Labels = make(map[string]string)
 		for _, label := range buildImagesViper.GetStringSlice("add-label") {
@@ -54,17 +81,24 @@ from other specs.  At most one is allowed.
 			opt.Labels[parts[0]] = parts[1]
 		}
 
+		setLockOptions()
+
 		err := fissile.GraphBegin(buildViper.GetString("output-graph"))
 		if err != nil {
 			return err
 		}
 
+		err = fissile.LoadManifest()
+		if err != nil {
+			return err
+		}
+
 		if opt.OutputDirectory != "" && !opt.Force {
 			fissile.UI.Printf("--force required when --output-directory is set\n")
 			opt.Force = true
 		}
 
-		return fissile.BuildImages(opt)
+		return fissile.BuildImages(context.Background(), opt)
 	},
 }
 var buildImagesViper = viper.New()
@@ -138,5 +172,47 @@ func init() {
 		"Additional label which will be set for the base layer image. Format: label=value",
 	)
 
+	buildImagesCmd.PersistentFlags().BoolP(
+		"reproducible",
+		"",
+		false,
+		"Normalize timestamps, ownership, and ordering of the generated build contexts so identical inputs produce identical tarballs",
+	)
+
+	buildImagesCmd.PersistentFlags().StringP(
+		"version-record",
+		"",
+		"",
+		"Write a record of the inputs of each instance group image version to the given JSON file, for use with 'fissile show changes'",
+	)
+
+	buildImagesCmd.PersistentFlags().StringP(
+		"scan",
+		"",
+		"",
+		"Scan the built images for vulnerabilities with the given scanner binary: trivy or grype",
+	)
+
+	buildImagesCmd.PersistentFlags().StringP(
+		"scan-fail-severity",
+		"",
+		"",
+		"Fail the build when a scanned image has vulnerabilities of this severity or higher: low, medium, high, or critical",
+	)
+
+	buildImagesCmd.PersistentFlags().StringP(
+		"scan-report",
+		"",
+		"",
+		"Path of the consolidated scan report; defaults to scan-report.<format> in the current directory",
+	)
+
+	buildImagesCmd.PersistentFlags().StringP(
+		"scan-report-format",
+		"",
+		app.ScanReportFormatJSON,
+		"Format of the scan report: json or sarif",
+	)
+
 	buildImagesViper.BindPFlags(buildImagesCmd.PersistentFlags())
 }
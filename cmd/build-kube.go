@@ -1,17 +1,40 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"os"
+
+	"code.cloudfoundry.org/fissile/app"
 	"code.cloudfoundry.org/fissile/kube"
 	"code.cloudfoundry.org/fissile/model"
+	"github.com/SUSE/termui"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var (
-	flagBuildKubeOutputDir       string
-	flagBuildKubeUseMemoryLimits bool
-	flagBuildKubeUseCPULimits    bool
-	flagBuildKubeTagExtra        string
+	flagBuildKubeOutputDir          string
+	flagBuildKubeUseMemoryLimits    bool
+	flagBuildKubeUseCPULimits       bool
+	flagBuildKubeTagExtra           string
+	flagBuildKubeKubeSchemaDir      string
+	flagBuildKubeServiceNaming      string
+	flagBuildKubeSecretGrouping     string
+	flagBuildKubeJSON               bool
+	flagBuildKubeValues             string
+	flagBuildKubeDefaultsFiles      string
+	flagBuildKubeSubstitutions      string
+	flagBuildKubeRoles              string
+	flagBuildKubeSkipRoles          string
+	flagBuildKubeDebugRoles         string
+	flagBuildKubeLayout             string
+	flagBuildKubeOpenShift          bool
+	flagBuildKubePortRanges         string
+	flagBuildKubeNodePorts          bool
+	flagBuildKubeDeploymentManifest bool
+	flagBuildKubeVMTypes            string
+	flagBuildKubePruneFrom          string
 )
 
 // buildKubeCmd represents the kube command
@@ -24,45 +47,115 @@ var buildKubeCmd = &cobra.Command{
 		flagBuildKubeUseMemoryLimits = buildKubeViper.GetBool("use-memory-limits")
 		flagBuildKubeUseCPULimits = buildKubeViper.GetBool("use-cpu-limits")
 		flagBuildKubeTagExtra = buildKubeViper.GetString("tag-extra")
+		flagBuildKubeKubeSchemaDir = buildKubeViper.GetString("kube-schema-dir")
+		flagBuildKubeServiceNaming = buildKubeViper.GetString("service-naming")
+		flagBuildKubeSecretGrouping = buildKubeViper.GetString("secret-grouping")
+		flagBuildKubeJSON = buildKubeViper.GetBool("json")
+		flagBuildKubeValues = buildKubeViper.GetString("values")
+		flagBuildKubeDefaultsFiles = buildKubeViper.GetString("defaults-file")
+		flagBuildKubeSubstitutions = buildKubeViper.GetString("substitutions")
+		flagBuildKubeDebugRoles = buildKubeViper.GetString("debug-roles")
+		flagBuildKubeRoles = buildKubeViper.GetString("roles")
+		flagBuildKubeSkipRoles = buildKubeViper.GetString("skip-roles")
+		flagBuildKubeLayout = buildKubeViper.GetString("layout")
+		flagBuildKubeOpenShift = buildKubeViper.GetBool("openshift")
+		flagBuildKubePortRanges = buildKubeViper.GetString("port-ranges")
+		flagBuildKubeNodePorts = buildKubeViper.GetBool("node-ports")
+		flagBuildKubeDeploymentManifest = buildKubeViper.GetBool("deployment-manifest")
+		flagBuildKubeVMTypes = buildKubeViper.GetString("vm-types")
+		flagBuildKubePruneFrom = buildKubeViper.GetString("prune-from")
 
-		err := fissile.GraphBegin(buildViper.GetString("output-graph"))
+		opinions, err := model.NewOpinions(
+			fissile.Options.LightOpinions,
+			fissile.Options.DarkOpinions,
+		)
 		if err != nil {
 			return err
 		}
 
-		err = fissile.LoadManifest()
+		settings := kube.ExportSettings{
+			OutputDir:          flagBuildKubeOutputDir,
+			Registry:           fissile.Options.DockerRegistry,
+			Username:           fissile.Options.DockerUsername,
+			Password:           fissile.Options.DockerPassword,
+			Organization:       fissile.Options.DockerOrganization,
+			Repository:         fissile.Options.RepositoryPrefix,
+			UseMemoryLimits:    flagBuildKubeUseMemoryLimits,
+			UseCPULimits:       flagBuildKubeUseCPULimits,
+			FissileVersion:     fissile.Version,
+			Opinions:           opinions,
+			CreateHelmChart:    false,
+			TagExtra:           flagBuildKubeTagExtra,
+			KubeSchemaDir:      flagBuildKubeKubeSchemaDir,
+			ServiceNaming:      kube.ServiceNamingStrategy(flagBuildKubeServiceNaming),
+			SecretGrouping:     kube.SecretGrouping(flagBuildKubeSecretGrouping),
+			DefaultsFiles:      splitNonEmpty(flagBuildKubeDefaultsFiles, ","),
+			DebugRoles:         splitNonEmpty(flagBuildKubeDebugRoles, ","),
+			Roles:              splitNonEmpty(flagBuildKubeRoles, ","),
+			SkipRoles:          splitNonEmpty(flagBuildKubeSkipRoles, ","),
+			Layout:             kube.Layout(flagBuildKubeLayout),
+			OpenShift:          flagBuildKubeOpenShift,
+			PortRanges:         kube.PortRangeStrategy(flagBuildKubePortRanges),
+			NodePorts:          flagBuildKubeNodePorts,
+			DeploymentManifest: flagBuildKubeDeploymentManifest,
+			VMTypes:            flagBuildKubeVMTypes,
+			PruneFrom:          flagBuildKubePruneFrom,
+		}
+
+		err = applyExportConfig(cmd, buildKubeViper, buildKubeViper.GetString("export-config"), &settings)
 		if err != nil {
 			return err
 		}
+		// Only the objects of the stream layout are written to stdout
+		if settings.Layout == kube.LayoutStream {
+			settings.Stream = os.Stdout
+			fissile.UI = stderrUI()
+		}
 
-		opinions, err := model.NewOpinions(
-			fissile.Options.LightOpinions,
-			fissile.Options.DarkOpinions,
-		)
+		err = fissile.GraphBegin(buildViper.GetString("output-graph"))
 		if err != nil {
 			return err
 		}
 
-		settings := kube.ExportSettings{
-			OutputDir:       flagBuildKubeOutputDir,
-			Registry:        fissile.Options.DockerRegistry,
-			Username:        fissile.Options.DockerUsername,
-			Password:        fissile.Options.DockerPassword,
-			Organization:    fissile.Options.DockerOrganization,
-			Repository:      fissile.Options.RepositoryPrefix,
-			UseMemoryLimits: flagBuildKubeUseMemoryLimits,
-			UseCPULimits:    flagBuildKubeUseCPULimits,
-			FissileVersion:  fissile.Version,
-			Opinions:        opinions,
-			CreateHelmChart: false,
-			TagExtra:        flagBuildKubeTagExtra,
+		err = fissile.LoadManifest()
+		if err != nil {
+			return err
 		}
 
-		return fissile.GenerateKube(settings)
+		if flagBuildKubeSubstitutions != "" {
+			if flagBuildKubeJSON {
+				return fmt.Errorf("--substitutions cannot be used with --json; use --values instead")
+			}
+			settings.Substitutions, err = kube.LoadSubstitutions(flagBuildKubeSubstitutions)
+			if err != nil {
+				return err
+			}
+		}
+
+		if flagBuildKubeJSON {
+			if settings.Layout != kube.LayoutInstanceGroup {
+				return fmt.Errorf("--layout cannot be used with --json, which always writes one file per object")
+			}
+			if settings.PruneFrom != "" {
+				return fmt.Errorf("--prune-from cannot be used with --json")
+			}
+			return fissile.Export(context.Background(), "kube-json", app.KubeJSONSettings{
+				ExportSettings: settings,
+				ValuesFiles:    splitNonEmpty(flagBuildKubeValues, ","),
+			})
+		}
+
+		return fissile.Export(context.Background(), "kube", settings)
 	},
 }
 var buildKubeViper = viper.New()
 
+// stderrUI returns a UI writing to stderr, for commands whose output to
+// stdout is meant for other programs
+func stderrUI() *termui.UI {
+	return termui.New(os.Stdin, os.Stderr, nil)
+}
+
 func init() {
 	initViper(buildKubeViper)
 
@@ -96,5 +189,132 @@ func init() {
 		"Additional information to use in computing the image tags",
 	)
 
+	buildKubeCmd.PersistentFlags().StringP(
+		"kube-schema-dir",
+		"",
+		"",
+		"Validate the generated objects against the Kubernetes JSON schemas in this directory; no schemas are bundled, so validation is off without it",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"service-naming",
+		"",
+		string(kube.ServiceNamingTruncate),
+		"How to handle service names too long for Kubernetes, one of truncate (shorten with a hash suffix) or strict (fail)",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"port-ranges",
+		"",
+		string(kube.PortRangesExpand),
+		"How services expose port ranges, one of expand (a service port per port) or annotate (the first port, with the range in an annotation)",
+	)
+
+	buildKubeCmd.PersistentFlags().BoolP(
+		"node-ports",
+		"",
+		false,
+		"Expose public services on node ports instead of external IPs",
+	)
+
+	buildKubeCmd.PersistentFlags().BoolP(
+		"deployment-manifest",
+		"",
+		false,
+		"Generate the deployment manifest secret from the role manifest instead of leaving it empty",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"secret-grouping",
+		"",
+		string(kube.SecretGroupingSingle),
+		"How to split the user secrets into Secret objects, one of single (one object) or instance-group (one object per consuming instance group)",
+	)
+
+	buildKubeCmd.PersistentFlags().BoolP(
+		"json",
+		"",
+		false,
+		"Write every object as a JSON file with concrete values instead of writing YAML, e.g. for Terraform",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"values",
+		"",
+		"",
+		"Comma separated list of helm values files used to resolve the values for --json",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"defaults-file",
+		"",
+		"",
+		"Comma separated list of YAML or KEY=value files overriding the defaults of variables; later files take precedence",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"substitutions",
+		"",
+		"",
+		"Path to a YAML file with the registry, organization, namespace, external IPs and storage classes to use in the configs",
+	)
+
+	// viper is busted w/ string slice, https://github.com/spf13/viper/issues/200
+	buildKubeCmd.PersistentFlags().StringP(
+		"roles",
+		"",
+		"",
+		"Generate only the given instance groups (and their colocated containers); comma separated",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"skip-roles",
+		"",
+		"",
+		"Do not generate the given instance groups; comma separated",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"debug-roles",
+		"",
+		"",
+		"Comma separated list of instance groups whose containers sleep instead of running their jobs, without probes and privileged, to exec into them for debugging",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"layout",
+		"",
+		string(kube.LayoutInstanceGroup),
+		"How to write the configs, one of instance-group (one file per instance group), object (one file per object), gitops (one file per object, only rewritten on changes, with a kustomization.yaml), or stream (all objects to stdout)",
+	)
+
+	buildKubeCmd.PersistentFlags().BoolP(
+		"openshift",
+		"",
+		false,
+		"Generate for OpenShift: routes for public ports, security context constraints for the pod security policies, and no fixed user ids",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"vm-types",
+		"",
+		"",
+		"Path to a YAML file mapping the BOSH vm_types of instance groups to the memory and cpu requests used where the role manifest sets none",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"prune-from",
+		"",
+		"",
+		"Path to the objects.txt of the previous configs; writes a prune.sh deleting the objects no longer generated",
+	)
+
+	buildKubeCmd.PersistentFlags().StringP(
+		"export-config",
+		"",
+		"",
+		"Path to a YAML file with the export settings; flags, FISSILE_* environment variables and the fissile config file take precedence",
+	)
+
 	buildKubeViper.BindPFlags(buildKubeCmd.PersistentFlags())
 }
@@ -1,10 +1,12 @@
 package cmd
 
 import (
+	"context"
+
 	"os"
 	"path/filepath"
-	"strings"
 
+	"code.cloudfoundry.org/fissile/compilator"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -23,10 +25,18 @@ All containers are removed, whether compilation is successful or not. However, i
 the compilation is interrupted during compilation (e.g. sending SIGINT), containers
 will most likely be left behind.
 
+With ` + "`--warm-containers`" + `, packages are compiled in a pool of containers instead,
+one per worker, which are reset between packages; only use it with trusted releases.
+
 Compiled packages are stored in ` + "`<work-dir>/compilation`" + `. Fissile uses the
 package's fingerprint as part of the directory structure. This means that if the
 same package (with the same version) is used by multiple releases, it will only be
 compiled once.
+
+With ` + "`--prefetch`" + `, nothing is compiled; instead the compiled packages found in
+the package cache are downloaded, and the sources of all other packages are
+checked to be available locally, so that a later build can run with
+` + "`--offline`" + ` and ` + "`--hermetic`" + `.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		flagBuildPackagesRoles := buildPackagesViper.GetString("roles")
@@ -36,6 +46,10 @@ compiled once.
 		flagBuildPackagesStemcell := buildPackagesViper.GetString("stemcell")
 		flagBuildCompilationCacheConfig := buildPackagesViper.GetString("compilation-cache-config")
 		flagBuildPackagesStreamPackages := buildPackagesViper.GetBool("stream-packages")
+		flagBuildPackagesHermetic := buildPackagesViper.GetBool("hermetic")
+		flagBuildPackagesWarmContainers := buildPackagesViper.GetBool("warm-containers")
+
+		setLockOptions()
 
 		err := fissile.GraphBegin(buildViper.GetString("output-graph"))
 		if err != nil {
@@ -47,19 +61,37 @@ compiled once.
 			return err
 		}
 
+		if buildPackagesViper.GetBool("prefetch") {
+			return fissile.Prefetch(
+				flagBuildPackagesStemcell,
+				fissile.StemcellCompilationDir(flagBuildPackagesStemcell),
+				splitNonEmpty(flagBuildPackagesRoles, ","),
+				splitNonEmpty(flagBuildPackagesOnlyReleases, ","),
+				flagBuildCompilationCacheConfig,
+			)
+		}
+
 		return fissile.Compile(
+			context.Background(),
 			flagBuildPackagesStemcell,
 			fissile.StemcellCompilationDir(flagBuildPackagesStemcell),
 			fissile.Options.RoleManifest,
 			fissile.Options.Metrics,
-			strings.FieldsFunc(flagBuildPackagesRoles, func(r rune) bool { return r == ',' }),
-			strings.FieldsFunc(flagBuildPackagesOnlyReleases, func(r rune) bool { return r == ',' }),
+			splitNonEmpty(flagBuildPackagesRoles, ","),
+			splitNonEmpty(flagBuildPackagesOnlyReleases, ","),
 			fissile.Options.Workers,
 			flagBuildPackagesDockerNetworkMode,
 			flagBuildPackagesWithoutDocker,
 			fissile.Options.Verbose,
 			flagBuildCompilationCacheConfig,
 			flagBuildPackagesStreamPackages,
+			flagBuildPackagesHermetic,
+			flagBuildPackagesWarmContainers,
+			compilator.ContainerSettings{
+				DNS:        buildPackagesViper.GetStringSlice("compilation-dns"),
+				ExtraHosts: buildPackagesViper.GetStringSlice("compilation-add-host"),
+				Env:        buildPackagesViper.GetStringSlice("compilation-env"),
+			},
 		)
 	},
 }
@@ -121,5 +153,47 @@ func init() {
 		"If true, fissile will stream packages to the docker daemon for compilation, instead of mounting volumes",
 	)
 
+	buildPackagesCmd.PersistentFlags().BoolP(
+		"hermetic",
+		"",
+		false,
+		"Compile packages without network access. All package sources must be available locally; packaging scripts that try to download anything will fail.",
+	)
+
+	buildPackagesCmd.PersistentFlags().BoolP(
+		"prefetch",
+		"",
+		false,
+		"Do not compile; download the compiled packages found in the package cache, and verify that the sources of all other packages are available locally, to compile offline or hermetically later.",
+	)
+
+	buildPackagesCmd.PersistentFlags().BoolP(
+		"warm-containers",
+		"",
+		false,
+		"Compile packages in a pool of containers, one per worker, reset between packages, instead of a fresh container per package. Faster for many small packages; only use it with trusted releases.",
+	)
+
+	buildPackagesCmd.PersistentFlags().StringSliceP(
+		"compilation-dns",
+		"",
+		nil,
+		"DNS servers of the compilation containers; comma separated IP addresses.",
+	)
+
+	buildPackagesCmd.PersistentFlags().StringSliceP(
+		"compilation-add-host",
+		"",
+		nil,
+		"Additional /etc/hosts entries of the compilation containers, as host:ip; comma separated.",
+	)
+
+	buildPackagesCmd.PersistentFlags().StringSliceP(
+		"compilation-env",
+		"",
+		nil,
+		"Environment variables passed to every package compilation, as KEY=VALUE; comma separated. Quote values containing commas, e.g. '\"no_proxy=a,b\"'. They do not change the package fingerprints.",
+	)
+
 	buildPackagesViper.BindPFlags(buildPackagesCmd.PersistentFlags())
 }
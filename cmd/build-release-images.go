@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"code.cloudfoundry.org/fissile/builder"
 	"code.cloudfoundry.org/fissile/model"
@@ -32,6 +31,7 @@ This command goes through builds a Docker image for each specified release.
 			Grapher:                fissile,
 			MetricsPath:            fissile.Options.Metrics,
 			NoBuild:                buildReleaseImagesViper.GetBool("no-build"),
+			Offline:                fissile.Options.Offline,
 			OutputDirectory:        buildReleaseImagesViper.GetString("output-directory"),
 			RepositoryPrefix:       fissile.Options.RepositoryPrefix,
 			StemcellName:           buildReleaseImagesViper.GetString("stemcell"),
@@ -42,6 +42,7 @@ This command goes through builds a Docker image for each specified release.
 			WorkerCount:            fissile.Options.Workers,
 		}
 		imgBuilder.CompilationDir = fissile.StemcellCompilationDir(imgBuilder.StemcellName)
+		imgBuilder.StemcellName = fissile.MirrorImageName(imgBuilder.StemcellName)
 
 		if len(imgBuilder.StemcellName) == 0 {
 			return fmt.Errorf("--stemcell is a required parameter")
@@ -52,10 +53,10 @@ This command goes through builds a Docker image for each specified release.
 			imgBuilder.Force = true
 		}
 
-		names := strings.FieldsFunc(buildReleaseImagesViper.GetString("name"), func(r rune) bool { return r == ',' })
-		sha1s := strings.FieldsFunc(buildReleaseImagesViper.GetString("sha1"), func(r rune) bool { return r == ',' })
-		urls := strings.FieldsFunc(buildReleaseImagesViper.GetString("url"), func(r rune) bool { return r == ',' })
-		versions := strings.FieldsFunc(buildReleaseImagesViper.GetString("version"), func(r rune) bool { return r == ',' })
+		names := splitNonEmpty(buildReleaseImagesViper.GetString("name"), ",")
+		sha1s := splitNonEmpty(buildReleaseImagesViper.GetString("sha1"), ",")
+		urls := splitNonEmpty(buildReleaseImagesViper.GetString("url"), ",")
+		versions := splitNonEmpty(buildReleaseImagesViper.GetString("version"), ",")
 
 		if len(names) == 0 {
 			return fmt.Errorf("Must specify at least a single release for release-images build command")
@@ -83,6 +84,8 @@ This command goes through builds a Docker image for each specified release.
 		releaseOptions := model.ReleaseOptions{
 			BOSHCacheDir:     fissile.Options.CacheDir,
 			FinalReleasesDir: fissile.Options.FinalReleasesDir,
+			Offline:          fissile.Options.Offline,
+			RetryPolicy:      fissile.Options.RetryPolicy,
 		}
 		releases, err := resolver.Load(releaseOptions, releaseRefs)
 		if err != nil {
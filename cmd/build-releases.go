@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/fissile/builder"
+	"github.com/spf13/cobra"
+)
+
+// buildReleasesCmd represents the releases command
+var buildReleasesCmd = &cobra.Command{
+	Use:   "releases",
+	Short: "Creates BOSH dev releases from release source directories.",
+	Long: `
+This command creates a dev release from each release source directory given with
+` + "`--release`" + `, like ` + "`bosh create-release`" + ` does, so that no BOSH CLI is needed
+before fissile can use the releases.
+
+The jobs, packages and license of a release are archived into the BOSH cache
+directory (` + "`--cache-dir`" + `), and the release manifest is written into the
+dev_releases directory of the release. The name of a release defaults to the one
+configured in the release; the version defaults to the next dev version (e.g.
+2+dev.4 after 2+dev.3).
+
+Blobs are taken from the blobs directory of the release; blobs which are not
+available locally must be fetched with ` + "`bosh sync-blobs`" + ` first.
+	`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(fissile.Options.Releases) == 0 {
+			return fmt.Errorf("Must specify at least one release source directory with --release")
+		}
+
+		devReleaseBuilder := &builder.DevReleaseBuilder{
+			CacheDir: fissile.Options.CacheDir,
+			UI:       fissile.UI,
+		}
+		for i, releasePath := range fissile.Options.Releases {
+			var name, version string
+			if len(fissile.Options.ReleaseNames) > 0 {
+				name = fissile.Options.ReleaseNames[i]
+			}
+			if len(fissile.Options.ReleaseVersions) > 0 {
+				version = fissile.Options.ReleaseVersions[i]
+			}
+			if _, err := devReleaseBuilder.Build(releasePath, name, version); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	buildCmd.AddCommand(buildReleasesCmd)
+}
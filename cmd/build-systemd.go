@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/fissile/app"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// buildSystemdCmd represents the systemd command
+var buildSystemdCmd = &cobra.Command{
+	Use:   "systemd",
+	Short: "Creates systemd units for single host deployments.",
+	Long: `
+This command writes a systemd unit per instance group, running its role image
+with podman or docker on a single host, for development and edge deployments
+without a Kubernetes cluster.  The role images must have been built with
+` + "`fissile build images`" + ` before.
+
+Next to the units, an environment file per instance group holds the
+environment variables of its containers, set to the defaults of the
+variables, which ` + "`--defaults-file`" + ` can override.  Secrets without a
+default are left empty and must be filled in.  The generated install.sh
+creates the container network, copies the environment files to /etc/fissile
+unless they exist, and enables the units.
+
+Public ports are published on the host, readiness probes become health checks,
+and the units require the units of the instance groups providing the links
+they consume.  Colocated containers share the network of their main instance
+group.  With ` + "`--instance-groups`" + `, only the named instance groups are run,
+along with the instance groups they depend on and their colocated containers.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+
+		err := fissile.LoadManifest()
+		if err != nil {
+			return err
+		}
+
+		return fissile.Export(context.Background(), "systemd", app.SystemdOptions{
+			OutputDir:      buildSystemdViper.GetString("output-dir"),
+			Runtime:        buildSystemdViper.GetString("runtime"),
+			InstanceGroups: splitNonEmpty(buildSystemdViper.GetString("instance-groups"), ","),
+			DefaultsFiles:  splitNonEmpty(buildSystemdViper.GetString("defaults-file"), ","),
+			TagExtra:       buildSystemdViper.GetString("tag-extra"),
+		})
+	},
+}
+
+var buildSystemdViper = viper.New()
+
+func init() {
+	initViper(buildSystemdViper)
+
+	buildCmd.AddCommand(buildSystemdCmd)
+
+	buildSystemdCmd.PersistentFlags().StringP(
+		"output-dir",
+		"",
+		"systemd",
+		"Directory to write the units, environment files, and install script to",
+	)
+
+	buildSystemdCmd.PersistentFlags().StringP(
+		"runtime",
+		"",
+		"podman",
+		"Container runtime running the role images, podman or docker",
+	)
+
+	buildSystemdCmd.PersistentFlags().StringP(
+		"instance-groups",
+		"",
+		"",
+		"Comma separated list of instance groups to run, along with those they depend on; all by default",
+	)
+
+	buildSystemdCmd.PersistentFlags().StringP(
+		"defaults-file",
+		"",
+		"",
+		"Comma separated list of YAML or KEY=value files overriding the defaults of variables; later files take precedence",
+	)
+
+	buildSystemdCmd.PersistentFlags().StringP(
+		"tag-extra",
+		"",
+		"",
+		"Additional information to use in computing the image tags",
+	)
+
+	buildSystemdViper.BindPFlags(buildSystemdCmd.PersistentFlags())
+}
@@ -1,6 +1,11 @@
 package cmd
 
 import (
+	"os"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/app"
+	"code.cloudfoundry.org/fissile/kube"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -14,6 +19,12 @@ This command has various subcommands to build artifacts.
 
 The ` + "`--output-graph`" + ` flag is used to generate a graphviz-style DOT
 language file for troubleshooting purposes.
+
+Building packages or images records the releases, the stemcell image and the
+fissile version used in the lockfile, ` + "`fissile.lock`" + ` next to the role
+manifest unless ` + "`--lockfile`" + ` names another one. With ` + "`--locked`" + ` the
+lockfile is not written; it must exist, and the build fails if any of these
+inputs differs from it.
 	`,
 }
 var buildViper = viper.New()
@@ -30,5 +41,63 @@ func init() {
 		"Output a graphviz graph to the given file name",
 	)
 
+	buildCmd.PersistentFlags().StringP(
+		"lockfile",
+		"",
+		"",
+		"Record the inputs of the build in this lockfile instead of fissile.lock next to the role manifest",
+	)
+
+	buildCmd.PersistentFlags().BoolP(
+		"locked",
+		"",
+		false,
+		"Require the lockfile, and fail if the releases, stemcell or fissile version differ from it, instead of updating it",
+	)
+
 	buildViper.BindPFlags(buildCmd.PersistentFlags())
 }
+
+// setLockOptions configures the lockfile of package and image builds from
+// the flags of the build command.  The lockfile is only enforced with
+// --locked, and written otherwise.
+func setLockOptions() {
+	fissile.Options.Locked = buildViper.GetBool("locked")
+	fissile.Options.Lockfile = buildViper.GetString("lockfile")
+	if fissile.Options.Lockfile == "" {
+		fissile.Options.Lockfile = app.DefaultLockfilePath(fissile.Options.RoleManifest)
+	}
+}
+
+// applyExportConfig sets the export settings given by the --export-config
+// file, if any.  The file only replaces the defaults of the flags: values
+// given on the command line, in FISSILE_* environment variables, or in the
+// fissile config file take precedence.  The settings the command has no flag
+// for are ignored, so that kube configs and helm charts can share the file.
+func applyExportConfig(cmd *cobra.Command, v *viper.Viper, path string, settings *kube.ExportSettings) error {
+	if path == "" {
+		return nil
+	}
+	config, err := kube.LoadExportConfig(path)
+	if err != nil {
+		return err
+	}
+	config.Apply(settings, func(name string) bool {
+		return cmd.Flags().Lookup(name) != nil && !flagIsSet(cmd, v, name)
+	})
+	return nil
+}
+
+// flagIsSet returns whether the value of the flag was given explicitly, on
+// the command line, in its FISSILE_* environment variable, or in the config
+// file of the command's viper or of the global one.  viper.IsSet cannot be
+// used, as it also reports the defaults of the flags bound to the viper.
+func flagIsSet(cmd *cobra.Command, v *viper.Viper, name string) bool {
+	if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+		return true
+	}
+	if os.Getenv("FISSILE_"+strings.ToUpper(strings.Replace(name, "-", "_", -1))) != "" {
+		return true
+	}
+	return v.InConfig(name) || viper.InConfig(name)
+}
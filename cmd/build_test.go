@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/app"
+	"code.cloudfoundry.org/fissile/kube"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyExportConfigPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fissile-test-export-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "export.yaml")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(strings.Join([]string{
+		"output_dir: helm",
+		"tag_extra: from-export-config",
+		"registry: export.example.com",
+		"organization: export-org",
+		"use_memory_limits: true",
+		"use_cpu_limits: true",
+	}, "\n")), 0644))
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("output-dir", "", "")
+	cmd.Flags().String("tag-extra", "", "")
+	cmd.Flags().String("docker-registry", "", "")
+	cmd.Flags().Bool("use-memory-limits", true, "")
+	cmd.Flags().Bool("use-cpu-limits", false, "")
+	v := viper.New()
+	v.SetEnvPrefix("FISSILE")
+	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	v.AutomaticEnv()
+	require.NoError(t, v.BindPFlags(cmd.Flags()))
+
+	// The command line, the environment and the fissile config file each
+	// override one value of the export config
+	require.NoError(t, cmd.Flags().Set("tag-extra", "from-flag"))
+	require.NoError(t, os.Setenv("FISSILE_DOCKER_REGISTRY", "env.example.com"))
+	defer os.Unsetenv("FISSILE_DOCKER_REGISTRY")
+	v.SetConfigType("yaml")
+	require.NoError(t, v.ReadConfig(strings.NewReader("use-memory-limits: false\n")))
+
+	settings := kube.ExportSettings{
+		TagExtra:        v.GetString("tag-extra"),
+		Registry:        v.GetString("docker-registry"),
+		UseMemoryLimits: v.GetBool("use-memory-limits"),
+		UseCPULimits:    v.GetBool("use-cpu-limits"),
+	}
+	require.NoError(t, applyExportConfig(cmd, v, configPath, &settings))
+
+	assert.Equal(t, filepath.Join(dir, "helm"), settings.OutputDir, "The export config replaces the defaults of the flags")
+	assert.True(t, settings.UseCPULimits, "The export config replaces the defaults of the flags")
+	assert.Equal(t, "from-flag", settings.TagExtra, "Flags take precedence over the export config")
+	assert.Equal(t, "env.example.com", settings.Registry, "The environment takes precedence over the export config")
+	assert.False(t, settings.UseMemoryLimits, "The fissile config file takes precedence over the export config")
+	assert.Empty(t, settings.Organization, "Settings without a flag in the command are ignored")
+}
+
+func TestBuildHelmSettingsWithoutOutputDirFlag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fissile-test-export-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	opinionsPath := filepath.Join(dir, "opinions.yml")
+	require.NoError(t, ioutil.WriteFile(opinionsPath, []byte("{}\n"), 0644))
+	configPath := filepath.Join(dir, "export.yaml")
+	require.NoError(t, ioutil.WriteFile(configPath, []byte(strings.Join([]string{
+		"output_dir: helm",
+		"tag_extra: from-export-config",
+		"secret_grouping: instance-group",
+	}, "\n")), 0644))
+
+	defer func(f *app.Fissile) { fissile = f }(fissile)
+	fissile = app.NewFissileApplication("0.0.0", nil)
+	fissile.Options.LightOpinions = opinionsPath
+	fissile.Options.DarkOpinions = opinionsPath
+
+	// Like build all, which embeds the flags of build helm without its
+	// output directory
+	cmd := &cobra.Command{}
+	addBuildHelmFlags(cmd.Flags())
+	v := viper.New()
+	require.NoError(t, v.BindPFlags(cmd.Flags()))
+	require.NoError(t, cmd.Flags().Set("export-config", configPath))
+	require.NoError(t, cmd.Flags().Set("use-cpu-limits", "false"))
+
+	settings, err := buildHelmSettings(cmd, v, filepath.Join(dir, "charts"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "charts"), settings.OutputDir, "The output directory is not taken from the export config")
+	assert.Equal(t, "from-export-config", settings.TagExtra)
+	assert.Equal(t, kube.SecretGroupingInstanceGroup, settings.SecretGrouping)
+	assert.False(t, settings.UseCPULimits)
+	assert.True(t, settings.UseMemoryLimits)
+	assert.True(t, settings.CreateHelmChart)
+}
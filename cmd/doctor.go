@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/fissile/app"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Checks the environment fissile runs in.",
+	Long: `
+Checks the environment fissile runs in, and prints the steps to fix the problems
+found:
+
+- the docker daemon can be reached, and supports the API fissile uses
+- the stemcell image given with --stemcell is available
+- the work directory is writable, and has enough free space
+- the limit of open files is high enough for compiling packages
+- the kernel features needed by 'fissile build packages --without-docker'
+- the compiled package cache, if configured, can be reached
+
+The command fails if any check fails; warnings point out problems only some
+commands run into.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fissile.Doctor(app.DoctorOptions{
+			Stemcell:               doctorViper.GetString("stemcell"),
+			CompilationCacheConfig: doctorViper.GetString("compilation-cache-config"),
+		})
+	},
+}
+
+var doctorViper = viper.New()
+
+func init() {
+	initViper(doctorViper)
+
+	RootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.PersistentFlags().StringP(
+		"stemcell",
+		"s",
+		"",
+		"The stemcell image to look for",
+	)
+
+	doctorCmd.PersistentFlags().StringP(
+		"compilation-cache-config",
+		"",
+		filepath.Join(os.Getenv("HOME"), ".fissile", "package-cache.yaml"),
+		"Points to a file containing configuration for a compiled package cache or contains the configuration as valid yaml",
+	)
+
+	doctorViper.BindPFlags(doctorCmd.PersistentFlags())
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// explainJobCmd represents the job command
+var explainJobCmd = &cobra.Command{
+	Use:   "job <name>",
+	Short: "Explains why a job is included.",
+	Long: `
+Answers why a job is included in the images: it lists the instance groups the job
+is part of, with the feature it depends on (if_feature or unless_feature), and
+the packages the job needs.
+
+The explanation is written as text, or as JSON or YAML with ` + "`--output`" + `.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("expected exactly one job name")
+		}
+
+		err := fissile.LoadManifest()
+		if err != nil {
+			return err
+		}
+
+		return fissile.ExplainJob(args[0])
+	},
+}
+
+func init() {
+	explainCmd.AddCommand(explainJobCmd)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// explainPackageCmd represents the package command
+var explainPackageCmd = &cobra.Command{
+	Use:   "package <name>",
+	Short: "Explains why a package is compiled.",
+	Long: `
+Answers why a package is compiled and included in the images: it lists the jobs
+needing the package, with the chain of package dependencies leading from each
+job to it, and the instance groups those jobs are part of.  Packages of the same
+name in several releases are explained separately.
+
+The explanation is written as text, or as JSON or YAML with ` + "`--output`" + `.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("expected exactly one package name")
+		}
+
+		err := fissile.LoadManifest()
+		if err != nil {
+			return err
+		}
+
+		return fissile.ExplainPackage(args[0])
+	},
+}
+
+func init() {
+	explainCmd.AddCommand(explainPackageCmd)
+}
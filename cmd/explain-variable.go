@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// explainVariableCmd represents the variable command
+var explainVariableCmd = &cobra.Command{
+	Use:   "variable <name>",
+	Short: "Explains where a variable is used.",
+	Long: `
+Answers where a variable of the role manifest is used: it lists the job
+properties whose templates reference the variable, and the instance groups the
+variable is passed to as an environment variable.
+
+The explanation is written as text, or as JSON or YAML with ` + "`--output`" + `.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("expected exactly one variable name")
+		}
+
+		err := fissile.LoadManifest()
+		if err != nil {
+			return err
+		}
+
+		return fissile.ExplainVariable(args[0])
+	},
+}
+
+func init() {
+	explainCmd.AddCommand(explainVariableCmd)
+}
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// explainCmd represents the explain command
+var explainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Has subcommands that explain why packages, jobs, and variables are used.",
+}
+
+func init() {
+	RootCmd.AddCommand(explainCmd)
+}
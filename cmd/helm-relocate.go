@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/fissile/app"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// helmRelocateCmd represents the relocate command
+var helmRelocateCmd = &cobra.Command{
+	Use:   "relocate <chart-dir>",
+	Short: "Relocates the images of a helm chart to another registry.",
+	Long: `
+This command prepares a helm chart generated by ` + "`fissile build helm`" + ` for
+installs without access to its registry, e.g. air-gapped ones.  The registry
+hostname and organization in the values of the chart are replaced by the
+given registry, as are the images of the log sidecars and the defaults of
+the variables naming images.  The current images of the chart are printed in
+the YAML source format of ` + "`skopeo sync`" + `, to copy them into the
+registry:
+
+    skopeo sync --src yaml --dest docker images.yaml my.internal/prefix
+
+The json output format prints the same images as JSON.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("expected exactly one chart directory")
+		}
+
+		return fissile.RelocateHelmChart(app.HelmRelocateOptions{
+			ChartDir: args[0],
+			Registry: helmRelocateViper.GetString("registry"),
+		})
+	},
+}
+
+var helmRelocateViper = viper.New()
+
+func init() {
+	initViper(helmRelocateViper)
+
+	helmCmd.AddCommand(helmRelocateCmd)
+
+	helmRelocateCmd.PersistentFlags().StringP(
+		"registry",
+		"",
+		"",
+		"Registry and prefix to relocate the images to, e.g. my.internal/prefix",
+	)
+
+	helmRelocateViper.BindPFlags(helmRelocateCmd.PersistentFlags())
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/fissile/app"
+	"code.cloudfoundry.org/fissile/helm/render"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// helmTemplateCmd represents the template command
+var helmTemplateCmd = &cobra.Command{
+	Use:   "template <chart-dir>",
+	Short: "Renders the templates of a helm chart locally.",
+	Long: `
+This command renders all templates of a helm chart, usually one generated by
+` + "`fissile build helm`" + `, into the final Kubernetes YAML without installing helm.
+The templates are evaluated with the sprig functions and the functions helm
+provides itself, using the chart values overridden by the given values files
+and ` + "`--set`" + ` assignments.
+
+Every template is rendered and parsed as YAML; the command fails listing all
+templates that could not be rendered, which makes it suitable for checking
+generated charts in CI.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("expected exactly one chart directory")
+		}
+
+		return fissile.RenderHelmTemplates(app.HelmTemplateOptions{
+			ChartDir:       args[0],
+			ValuesFiles:    splitNonEmpty(helmTemplateViper.GetString("values"), ","),
+			Set:            helmSetValues(helmTemplateViper.GetString("set")),
+			ReleaseName:    helmTemplateViper.GetString("name"),
+			KubeVersion:    helmTemplateViper.GetString("kube-version"),
+			ReleaseService: helmTemplateViper.GetString("release-service"),
+			OutputDir:      helmTemplateViper.GetString("output-dir"),
+		})
+	},
+}
+
+var helmTemplateViper = viper.New()
+
+func init() {
+	initViper(helmTemplateViper)
+
+	helmCmd.AddCommand(helmTemplateCmd)
+
+	helmTemplateCmd.PersistentFlags().StringP(
+		"values",
+		"f",
+		"",
+		"Comma separated list of values files; later files take precedence",
+	)
+
+	helmTemplateCmd.PersistentFlags().StringP(
+		"set",
+		"",
+		"",
+		"Comma separated key=value assignments overriding chart values, like the --set flag of helm (e.g. sizing.router.count=3,env.LIST={a,b})",
+	)
+
+	helmTemplateCmd.PersistentFlags().StringP(
+		"name",
+		"",
+		"",
+		"Release name to render the templates with",
+	)
+
+	helmTemplateCmd.PersistentFlags().StringP(
+		"kube-version",
+		"",
+		render.DefaultKubeVersion,
+		"Kubernetes version (<major>.<minor>) to render the templates for",
+	)
+
+	helmTemplateCmd.PersistentFlags().StringP(
+		"release-service",
+		"",
+		render.DefaultReleaseService,
+		"Release service to render the templates with, e.g. Tiller for helm 2",
+	)
+
+	helmTemplateCmd.PersistentFlags().StringP(
+		"output-dir",
+		"",
+		"",
+		"Write the rendered templates to files in this directory instead of printing them",
+	)
+
+	helmTemplateViper.BindPFlags(helmTemplateCmd.PersistentFlags())
+}
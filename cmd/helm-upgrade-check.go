@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/fissile/app"
+	"code.cloudfoundry.org/fissile/helm/render"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// helmUpgradeCheckCmd represents the upgrade-check command
+var helmUpgradeCheckCmd = &cobra.Command{
+	Use:   "upgrade-check <old-chart-dir> <new-chart-dir>",
+	Short: "Checks whether a helm chart can be upgraded to a newer one.",
+	Long: `
+This command compares two helm charts, usually generated by ` + "`fissile build helm`" + `
+from two versions of a role manifest, and reports the changes which may break
+an upgrade from the old chart to the new one:
+
+- values which were removed, and values whose defaults changed;
+- instance groups which were removed;
+- changes to fields kubernetes does not allow to change on existing objects,
+  like the volume claim templates and service name of stateful sets.
+
+Both charts are rendered with the given values (see ` + "`fissile helm template`" + `).
+Every change comes with a suggestion for migrating the values or the
+deployment.  The command fails when there are breaking changes.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("expected exactly two chart directories")
+		}
+
+		return fissile.CheckHelmUpgrade(app.HelmUpgradeCheckOptions{
+			OldChartDir:    args[0],
+			NewChartDir:    args[1],
+			ValuesFiles:    splitNonEmpty(helmUpgradeCheckViper.GetString("values"), ","),
+			Set:            helmSetValues(helmUpgradeCheckViper.GetString("set")),
+			ReleaseName:    helmUpgradeCheckViper.GetString("name"),
+			KubeVersion:    helmUpgradeCheckViper.GetString("kube-version"),
+			ReleaseService: helmUpgradeCheckViper.GetString("release-service"),
+		})
+	},
+}
+
+var helmUpgradeCheckViper = viper.New()
+
+func init() {
+	initViper(helmUpgradeCheckViper)
+
+	helmCmd.AddCommand(helmUpgradeCheckCmd)
+
+	helmUpgradeCheckCmd.PersistentFlags().StringP(
+		"values",
+		"f",
+		"",
+		"Comma separated list of values files; later files take precedence",
+	)
+
+	helmUpgradeCheckCmd.PersistentFlags().StringP(
+		"set",
+		"",
+		"",
+		"Comma separated key=value assignments overriding chart values, like the --set flag of helm (e.g. sizing.router.count=3,env.LIST={a,b})",
+	)
+
+	helmUpgradeCheckCmd.PersistentFlags().StringP(
+		"name",
+		"",
+		"",
+		"Release name to render the templates with",
+	)
+
+	helmUpgradeCheckCmd.PersistentFlags().StringP(
+		"kube-version",
+		"",
+		render.DefaultKubeVersion,
+		"Kubernetes version (<major>.<minor>) to render the templates for",
+	)
+
+	helmUpgradeCheckCmd.PersistentFlags().StringP(
+		"release-service",
+		"",
+		render.DefaultReleaseService,
+		"Release service to render the templates with, e.g. Tiller for helm 2",
+	)
+
+	helmUpgradeCheckViper.BindPFlags(helmUpgradeCheckCmd.PersistentFlags())
+}
@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// helmCmd represents the helm command
+var helmCmd = &cobra.Command{
+	Use:   "helm",
+	Short: "Has subcommands that work with generated helm charts.",
+}
+
+func init() {
+	RootCmd.AddCommand(helmCmd)
+}
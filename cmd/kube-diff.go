@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/fissile/app"
+	"code.cloudfoundry.org/fissile/helm/render"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// kubeDiffCmd represents the diff command
+var kubeDiffCmd = &cobra.Command{
+	Use:   "diff <chart-dir>",
+	Short: "Compares a helm chart with the objects in a Kubernetes cluster.",
+	Long: `
+This command renders a helm chart, usually one generated by ` + "`fissile build helm`" + `,
+with the given values (see ` + "`fissile helm template`" + `) and compares every resulting
+object with the live object in the cluster, which is read using kubectl.
+
+For every template, and thus every instance group, it reports whether applying
+the chart would leave the cluster unchanged, or which objects would be created
+or changed.  Fields which are only present in the cluster, like defaults and
+status, are ignored.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("expected exactly one chart directory")
+		}
+
+		return fissile.DiffKube(app.KubeDiffOptions{
+			ChartDir:       args[0],
+			ValuesFiles:    splitNonEmpty(kubeDiffViper.GetString("values"), ","),
+			Set:            helmSetValues(kubeDiffViper.GetString("set")),
+			ReleaseName:    kubeDiffViper.GetString("name"),
+			KubeVersion:    kubeDiffViper.GetString("kube-version"),
+			ReleaseService: kubeDiffViper.GetString("release-service"),
+			Kubeconfig:     kubeDiffViper.GetString("kubeconfig"),
+			Namespace:      kubeDiffViper.GetString("namespace"),
+		})
+	},
+}
+
+var kubeDiffViper = viper.New()
+
+func init() {
+	initViper(kubeDiffViper)
+
+	kubeCmd.AddCommand(kubeDiffCmd)
+
+	kubeDiffCmd.PersistentFlags().StringP(
+		"values",
+		"f",
+		"",
+		"Comma separated list of values files; later files take precedence",
+	)
+
+	kubeDiffCmd.PersistentFlags().StringP(
+		"set",
+		"",
+		"",
+		"Comma separated key=value assignments overriding chart values, like the --set flag of helm (e.g. sizing.router.count=3,env.LIST={a,b})",
+	)
+
+	kubeDiffCmd.PersistentFlags().StringP(
+		"name",
+		"",
+		"",
+		"Release name to render the templates with",
+	)
+
+	kubeDiffCmd.PersistentFlags().StringP(
+		"kube-version",
+		"",
+		render.DefaultKubeVersion,
+		"Kubernetes version (<major>.<minor>) to render the templates for",
+	)
+
+	kubeDiffCmd.PersistentFlags().StringP(
+		"release-service",
+		"",
+		render.DefaultReleaseService,
+		"Release service to render the templates with, e.g. Tiller for helm 2",
+	)
+
+	kubeDiffCmd.PersistentFlags().StringP(
+		"kubeconfig",
+		"",
+		"",
+		"Path to the kubeconfig file used to access the cluster; the kubectl default if empty",
+	)
+
+	kubeDiffCmd.PersistentFlags().StringP(
+		"namespace",
+		"",
+		"",
+		"Namespace of the deployed objects; the namespace of the kubeconfig context if empty",
+	)
+
+	kubeDiffViper.BindPFlags(kubeDiffCmd.PersistentFlags())
+}
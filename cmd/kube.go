@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// kubeCmd represents the kube command
+var kubeCmd = &cobra.Command{
+	Use:   "kube",
+	Short: "Has subcommands that work with Kubernetes clusters.",
+}
+
+func init() {
+	RootCmd.AddCommand(kubeCmd)
+}
@@ -8,8 +8,12 @@ import (
 	"strings"
 
 	"code.cloudfoundry.org/fissile/app"
+	"code.cloudfoundry.org/fissile/docker"
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 var (
@@ -35,8 +39,37 @@ agent.
 			return err
 		}
 
+		app.TuneGC(viper.GetInt("gc-percent"), viper.GetInt("memory-ballast"))
+		if address := viper.GetString("pprof-listen"); address != "" {
+			addr, err := fissile.ServeProfiles(address)
+			if err != nil {
+				return err
+			}
+			fissile.UI.Printf("Serving profiles at http://%s/debug/pprof/\n", addr)
+		}
+
+		// Progress goes to stderr, so that it does not mix with the
+		// output of commands
+		progress := viper.GetString("progress")
+		if progress == app.ProgressFancy && !terminal.IsTerminal(int(os.Stderr.Fd())) {
+			progress = app.ProgressPlain
+		}
+		reporter, err := app.NewProgressReporter(progress, os.Stderr, fissile.Timings())
+		if err != nil {
+			return err
+		}
+		fissile.Events = reporter
+
 		return validateReleaseArgs()
 	},
+	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+		// The model is written once the command is done, not every
+		// time the role manifest is loaded
+		if path := viper.GetString("model-out"); path != "" && fissile.Manifest != nil {
+			return fissile.WriteModel(path)
+		}
+		return nil
+	},
 }
 
 // Execute adds all child commands to the root command sets flags appropriately.
@@ -69,7 +102,7 @@ func init() {
 		"release",
 		"r",
 		"",
-		"Path to final or dev BOSH release(s).",
+		"Path to final or dev BOSH release(s), or to release tarball(s).",
 	)
 
 	// We can't use slices here because of https://github.com/spf13/viper/issues/112
@@ -95,6 +128,13 @@ func init() {
 		"Local BOSH cache directory.",
 	)
 
+	RootCmd.PersistentFlags().StringP(
+		"release-cache-dir",
+		"",
+		filepath.Join(os.Getenv("HOME"), ".fissile", "release-cache"),
+		"Directory caching the job specs and link properties read from the job archives of releases, so that only the archives of changed jobs are read again; empty disables the cache.",
+	)
+
 	RootCmd.PersistentFlags().StringP(
 		"final-releases-dir",
 		"",
@@ -179,6 +219,98 @@ func init() {
 		"Choose output format, one of human, json, or yaml (currently only for 'show properties')",
 	)
 
+	RootCmd.PersistentFlags().BoolP(
+		"offline",
+		"",
+		false,
+		"Fail instead of accessing the network to download releases, pull stemcells, or use remote package caches.",
+	)
+
+	// We can't use slices here because of https://github.com/spf13/viper/issues/112
+	RootCmd.PersistentFlags().StringP(
+		"registry-mirrors",
+		"",
+		"",
+		"Comma separated list of registry=mirror pairs; images from a registry are used from its mirror instead (docker.io for the docker hub).",
+	)
+
+	RootCmd.PersistentFlags().IntP(
+		"retry-attempts",
+		"",
+		util.DefaultRetryPolicy().MaxAttempts,
+		"Number of attempts for operations that access the network, like pulling the stemcell image and downloading releases.",
+	)
+
+	RootCmd.PersistentFlags().DurationP(
+		"retry-delay",
+		"",
+		util.DefaultRetryPolicy().InitialDelay,
+		"Delay before retrying a failed network operation; it doubles with every attempt.",
+	)
+
+	RootCmd.PersistentFlags().DurationP(
+		"retry-budget",
+		"",
+		0,
+		"Total time allowed for retrying a failed network operation; zero means no limit.",
+	)
+
+	RootCmd.PersistentFlags().StringP(
+		"pprof-listen",
+		"",
+		"",
+		"Address (host:port) to serve the pprof profiling endpoints at while fissile runs.",
+	)
+
+	RootCmd.PersistentFlags().BoolP(
+		"report-memory",
+		"",
+		false,
+		"Report the heap usage and garbage collection of every phase of an operation.",
+	)
+
+	RootCmd.PersistentFlags().IntP(
+		"gc-percent",
+		"",
+		0,
+		"Garbage collection target percentage, as GOGC; zero keeps the default.",
+	)
+
+	RootCmd.PersistentFlags().IntP(
+		"memory-ballast",
+		"",
+		0,
+		"Size in MiB of memory allocated up front to make garbage collection less frequent.",
+	)
+
+	RootCmd.PersistentFlags().StringP(
+		"progress",
+		"",
+		app.ProgressPlain,
+		"Choose how to report the progress of compiling, building and generating, one of plain, fancy, or json.",
+	)
+
+	RootCmd.PersistentFlags().StringP(
+		"model-out",
+		"",
+		"",
+		"Path to write the resolved model of the role manifest to, as JSON, after a command loading it; not supported by build all.",
+	)
+
+	RootCmd.PersistentFlags().BoolP(
+		"no-healthcheck",
+		"",
+		false,
+		"Leave the HEALTHCHECK derived from the readiness probe out of the role images; this changes the image tags, so pass it to every command using them.",
+	)
+
+	RootCmd.PersistentFlags().BoolP(
+		"attributions",
+		"",
+		false,
+		"Write the licenses of the releases and packages into the role images, helm charts and kube configs; this changes the image tags, so pass it to every command using them.",
+	)
+
 	RootCmd.PersistentFlags().BoolP(
 		"verbose",
 		"V",
@@ -232,6 +364,23 @@ func validateBasicFlags() error {
 	fissile.Options.OutputFormat = viper.GetString("output")
 	fissile.Options.Metrics = viper.GetString("metrics")
 	fissile.Options.Verbose = viper.GetBool("verbose")
+	fissile.Options.Offline = viper.GetBool("offline")
+	fissile.Options.ReportMemory = viper.GetBool("report-memory")
+	fissile.Options.NoHealthcheck = viper.GetBool("no-healthcheck")
+	fissile.Options.Attributions = viper.GetBool("attributions")
+
+	model.ReleaseMetadataCacheDir = viper.GetString("release-cache-dir")
+
+	fissile.Options.RetryPolicy = util.DefaultRetryPolicy()
+	fissile.Options.RetryPolicy.MaxAttempts = viper.GetInt("retry-attempts")
+	fissile.Options.RetryPolicy.InitialDelay = viper.GetDuration("retry-delay")
+	fissile.Options.RetryPolicy.Budget = viper.GetDuration("retry-budget")
+
+	registryMirrors, err := docker.ParseRegistryMirrors(splitNonEmpty(viper.GetString("registry-mirrors"), ","))
+	if err != nil {
+		return err
+	}
+	fissile.Options.RegistryMirrors = registryMirrors
 
 	// Set defaults for empty flags
 	if fissile.Options.RoleManifest == "" {
@@ -250,7 +399,7 @@ func validateBasicFlags() error {
 		fissile.Options.Workers = runtime.NumCPU()
 	}
 
-	err := absolutePaths(
+	err = absolutePaths(
 		&fissile.Options.RoleManifest,
 		&fissile.Options.CacheDir,
 		&fissile.Options.WorkDir,
@@ -326,6 +475,8 @@ func absolutePath(path string) (string, error) {
 	return path, nil
 }
 
+// splitNonEmpty splits the value of a list flag at the separator, dropping
+// empty elements.  All commands use it for their comma separated flags.
 func splitNonEmpty(value string, separator string) []string {
 	s := strings.Split(value, separator)
 
@@ -337,3 +488,14 @@ func splitNonEmpty(value string, separator string) []string {
 	}
 	return r
 }
+
+// helmSetValues returns the value of a --set flag for the commands rendering
+// helm charts.  Unlike other comma separated flags it is not split here; it is
+// parsed like the --set flag of helm, where commas may be escaped or part of
+// lists.
+func helmSetValues(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/app"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// runJobCmd represents the job command
+var runJobCmd = &cobra.Command{
+	Use:   "job <instance-group>/<job>",
+	Short: "Runs a single job in a local container.",
+	Long: `
+This command runs a single BOSH job of an instance group in a local docker
+container created from the role image, so that job authors can iterate on their
+templates and scripts without deploying to a cluster.  The role image must have
+been built with ` + "`fissile build images`" + ` before.
+
+Only the templates of the job are rendered, with the properties read from the
+` + "`--properties`" + ` file (as they would appear under the job in a BOSH deployment
+manifest).  Then the pre-start script of the job runs, followed by the job
+itself: the run script of bosh-task instance groups, or monit otherwise, in
+which case the logs of the job are followed.  The output is streamed until the
+job exits or the command is interrupted.
+
+Links to other instance groups cannot be resolved without a cluster.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 || strings.Count(args[0], "/") != 1 {
+			return fmt.Errorf("expected exactly one <instance-group>/<job> argument")
+		}
+		names := strings.Split(args[0], "/")
+
+		err := fissile.LoadManifest()
+		if err != nil {
+			return err
+		}
+
+		return fissile.RunJob(app.RunJobOptions{
+			InstanceGroup:  names[0],
+			Job:            names[1],
+			PropertiesFile: runJobViper.GetString("properties"),
+			Env:            splitNonEmpty(runJobViper.GetString("env"), ","),
+			TagExtra:       runJobViper.GetString("tag-extra"),
+		})
+	},
+}
+
+var runJobViper = viper.New()
+
+func init() {
+	initViper(runJobViper)
+
+	runCmd.AddCommand(runJobCmd)
+
+	runJobCmd.PersistentFlags().StringP(
+		"properties",
+		"",
+		"",
+		"YAML file with the properties of the job",
+	)
+
+	runJobCmd.PersistentFlags().StringP(
+		"env",
+		"",
+		"",
+		"Comma separated list of additional environment variables (KEY=VALUE) for the container",
+	)
+
+	runJobCmd.PersistentFlags().StringP(
+		"tag-extra",
+		"",
+		"",
+		"Additional information to use in computing the image tags",
+	)
+
+	runJobViper.BindPFlags(runJobCmd.PersistentFlags())
+}
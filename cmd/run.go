@@ -0,0 +1,15 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// runCmd represents the run command
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Has subcommands that run parts of a deployment locally.",
+}
+
+func init() {
+	RootCmd.AddCommand(runCmd)
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// showChangesCmd represents the changes command
+var showChangesCmd = &cobra.Command{
+	Use:   "changes",
+	Short: "Displays the changes between two sets of instance group images.",
+	Long: `
+This command compares two version records written by ` + "`fissile build images --version-record`" + `
+and reports which instance groups changed, and which of their jobs, packages,
+scripts, configuration templates, and properties caused the change.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from := showChangesViper.GetString("from")
+		to := showChangesViper.GetString("to")
+		if from == "" || to == "" {
+			return fmt.Errorf("both --from and --to version records are required")
+		}
+
+		return fissile.ReportImageChanges(from, to)
+	},
+}
+
+var showChangesViper = viper.New()
+
+func init() {
+	initViper(showChangesViper)
+
+	showCmd.AddCommand(showChangesCmd)
+
+	showChangesCmd.PersistentFlags().StringP(
+		"from",
+		"",
+		"",
+		"Version record of the older set of images",
+	)
+
+	showChangesCmd.PersistentFlags().StringP(
+		"to",
+		"",
+		"",
+		"Version record of the newer set of images",
+	)
+
+	showChangesViper.BindPFlags(showChangesCmd.PersistentFlags())
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// showEnvVarsCmd represents the env-vars command
+var showEnvVarsCmd = &cobra.Command{
+	Use:   "env-vars",
+	Short: "Displays the environment variables of every instance group.",
+	Long: `
+Displays a report of every environment variable the helm chart injects into the
+containers of each instance group, and where its value comes from: a value the
+user sets, a user or generated secret, the sizing of an instance group, a
+feature flag, or fissile itself (built-in).
+
+Variables the user sets are shown with their default; variables read from
+secrets with the names of the secrets.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := fissile.LoadManifest()
+		if err != nil {
+			return err
+		}
+
+		return fissile.ShowEnvVars()
+	},
+}
+
+func init() {
+	showCmd.AddCommand(showEnvVarsCmd)
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// showFootprintCmd represents the footprint command
+var showFootprintCmd = &cobra.Command{
+	Use:   "footprint",
+	Short: "Displays the resources requested by all instance groups together.",
+	Long: `
+Displays the memory and CPU requests and limits of every instance group, times
+its number of replicas, and their totals, at the default and at the HA sizing.
+The requests of colocated containers are part of the instance groups using
+them; tasks are left out.  The totals are checked against the budget in the
+configuration of the role manifest.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := fissile.LoadManifest()
+		if err != nil {
+			return err
+		}
+
+		return fissile.ShowFootprint(showFootprintViper.GetString("vm-types"))
+	},
+}
+
+var showFootprintViper = viper.New()
+
+func init() {
+	initViper(showFootprintViper)
+
+	showCmd.AddCommand(showFootprintCmd)
+
+	showFootprintCmd.PersistentFlags().StringP(
+		"vm-types",
+		"",
+		"",
+		"Path to a YAML file mapping the BOSH vm_types of instance groups to the memory and cpu requests used where the role manifest sets none",
+	)
+
+	showFootprintViper.BindPFlags(showFootprintCmd.PersistentFlags())
+}
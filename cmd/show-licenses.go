@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// showLicensesCmd represents the licenses command
+var showLicensesCmd = &cobra.Command{
+	Use:   "licenses",
+	Short: "Displays the licenses of the BOSH releases and their packages.",
+	Long: `
+Displays the LICENSE and NOTICE files of all referenced releases, followed by
+those found in the source archives of their packages, which must be in the
+BOSH cache.  With ` + "`--attributions`" + `, the same attributions are written to
+` + "`ATTRIBUTIONS.txt`" + ` in generated helm charts and kube configs.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := fissile.LoadManifest()
+		if err != nil {
+			return err
+		}
+
+		return fissile.ShowLicenses()
+	},
+}
+
+func init() {
+	showCmd.AddCommand(showLicensesCmd)
+}
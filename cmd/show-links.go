@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// showLinksCmd represents the links command
+var showLinksCmd = &cobra.Command{
+	Use:   "links",
+	Short: "Displays how BOSH links are resolved.",
+	Long: `
+Displays a report of every link consumed by the jobs of the role manifest: the
+provider it resolved to (instance group, job, and service name, or the external
+address or namespace), and whether it was named explicitly in the role manifest,
+matched implicitly by name or by type, or left unresolved because it is
+optional.
+
+Besides the human, json, and yaml output formats, this command supports the dot
+output format, producing a graphviz graph of the links.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := fissile.LoadManifest()
+		if err != nil {
+			return err
+		}
+
+		return fissile.ShowLinks()
+	},
+}
+
+func init() {
+	showCmd.AddCommand(showLinksCmd)
+}
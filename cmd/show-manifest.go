@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// showManifestCmd represents the manifest command
+var showManifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Displays the role manifest, optionally as resolved.",
+	Long: `
+Displays the role manifest after decrypting it and expanding its anchors.
+
+With --resolved, displays the model fissile resolves from the role manifest and
+the releases instead, as the generators see it: the model written by
+--model-out, along with the global configuration templates and the properties,
+provided links, and consumers of every job.  This is meant for debugging why
+generation produced a particular output; the fields added to the model are not
+stable.
+
+The human and yaml output formats print YAML; the json output format prints
+the same data as JSON.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := fissile.LoadManifest()
+		if err != nil {
+			return err
+		}
+
+		return fissile.ShowManifest(showManifestViper.GetBool("resolved"))
+	},
+}
+
+var showManifestViper = viper.New()
+
+func init() {
+	initViper(showManifestViper)
+
+	showCmd.AddCommand(showManifestCmd)
+
+	showManifestCmd.PersistentFlags().BoolP(
+		"resolved",
+		"",
+		false,
+		"If the flag is set, show the resolved model instead of the role manifest",
+	)
+
+	showManifestViper.BindPFlags(showManifestCmd.PersistentFlags())
+}
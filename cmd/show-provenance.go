@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// showProvenanceCmd represents the provenance command
+var showProvenanceCmd = &cobra.Command{
+	Use:   "provenance <image>",
+	Short: "Displays the provenance recorded in an instance group image.",
+	Long: `
+This command reads the provenance labels fissile stamps on every instance group
+image and displays them: the role manifest and opinions digests, the stemcell,
+the fissile version, the releases used, and the fingerprints of all jobs.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("expected exactly one image name")
+		}
+
+		return fissile.ShowProvenance(args[0])
+	},
+}
+
+func init() {
+	showCmd.AddCommand(showProvenanceCmd)
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// showSecretGenerationCmd represents the secret-generation command
+var showSecretGenerationCmd = &cobra.Command{
+	Use:   "secret-generation",
+	Short: "Displays the secrets the secret generator would create.",
+	Long: `
+Simulates the secret generation of a deployment, without deploying anything:
+displays every variable of the role manifest which has a generator, its type
+(password, certificate, or ssh), and the parameters used to generate it.
+
+It also shows which secrets are generated again when the secrets generation
+counter is incremented; immutable secrets are kept.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := fissile.LoadManifest()
+		if err != nil {
+			return err
+		}
+
+		return fissile.ShowSecretGeneration()
+	},
+}
+
+func init() {
+	showCmd.AddCommand(showSecretGenerationCmd)
+}
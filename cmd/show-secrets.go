@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// showSecretsCmd represents the secrets command
+var showSecretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Displays the secrets of the role manifest and where they are used.",
+	Long: `
+Displays a report of every secret variable of the role manifest: whether it is
+generated by fissile (and by which generator) or must be provided by the user,
+whether it is immutable or can be rotated, and which instance groups and jobs
+consume it.
+
+Internal secrets are made available to every instance group, and are listed
+without jobs.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := fissile.LoadManifest()
+		if err != nil {
+			return err
+		}
+
+		return fissile.ShowSecrets()
+	},
+}
+
+func init() {
+	showCmd.AddCommand(showSecretsCmd)
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// showTimingsCmd represents the timings command
+var showTimingsCmd = &cobra.Command{
+	Use:   "timings",
+	Short: "Displays the durations of past package compilations and image builds.",
+	Long: `
+Displays the durations of package compilations and image builds recorded in the
+work directory by past runs of 'fissile build packages' and 'fissile build
+images'; the last ten durations of every package and image are kept.
+
+The report lists the critical path of the compilation, the chain of dependent
+packages which takes the longest to compile; no number of workers compiles all
+packages faster. It also suggests the number of workers beyond which compiling
+packages or building images is not expected to get faster.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return fissile.ShowTimings()
+	},
+}
+
+func init() {
+	showCmd.AddCommand(showTimingsCmd)
+}
@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"code.cloudfoundry.org/fissile/app"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // validateCmd represents the release command
@@ -9,7 +11,8 @@ var validateCmd = &cobra.Command{
 	Use:   "validate",
 	Short: "Validates all the configuration going into fissile.",
 	Long: `
-Displays a report of all validation checks.
+Displays a report of all validation checks.  Variables no template uses are
+reported as warnings, unless --strict-variables is given.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		err := fissile.LoadManifest()
@@ -17,7 +20,9 @@ Displays a report of all validation checks.
 			return err
 		}
 
-		errs := fissile.Validate()
+		errs := fissile.Validate(app.ValidateOptions{
+			StrictVariables: validateViper.GetBool("strict-variables"),
+		})
 		if len(errs) > 0 {
 			return errs
 		}
@@ -25,6 +30,19 @@ Displays a report of all validation checks.
 	},
 }
 
+var validateViper = viper.New()
+
 func init() {
+	initViper(validateViper)
+
 	RootCmd.AddCommand(validateCmd)
+
+	validateCmd.PersistentFlags().BoolP(
+		"strict-variables",
+		"",
+		false,
+		"Report variables no template uses as errors instead of warnings",
+	)
+
+	validateViper.BindPFlags(validateCmd.PersistentFlags())
 }
@@ -3,6 +3,7 @@ package compilator
 import (
 	"bytes"
 	"container/list"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -50,6 +51,37 @@ type Compilator struct {
 	compilePackage    func(*Compilator, *model.Package) error
 	packageStorage    *PackageStorage
 	streamPackages    bool
+	hermetic          bool
+	warmContainers    bool
+
+	// warmPool holds the warm compilation containers while compiling, if
+	// enabled; see SetWarmContainers.
+	warmPool *warmContainerPool
+
+	// isolationSlots holds the slots of the isolation settings of packages
+	// with a parallelism cap.
+	isolationSlots map[*model.CompilationIsolation]*isolationSlots
+
+	// containerSettings are additional settings of the compilation
+	// containers; see SetContainerSettings.
+	containerSettings ContainerSettings
+
+	// stemcellCompatibility is checked against the stemcell before
+	// compiling anything; nil disables the check.
+	stemcellCompatibility *model.StemcellCompatibility
+
+	// planHandler, if set, is told about the packages which need to be
+	// compiled, before compilation starts.
+	planHandler func(model.Packages)
+
+	// resultHandler, if set, is told about every package as its
+	// compilation finishes, successfully or not, and how long compiling it
+	// took (zero if it was not compiled, e.g. downloaded from the cache).
+	resultHandler func(*model.Package, time.Duration, error)
+
+	// durationEstimator, if set, returns the expected compilation time of
+	// a package, if known, for scheduling long chains of packages first.
+	durationEstimator func(*model.Package) (time.Duration, bool)
 
 	// signalDependencies is a map of
 	//    (package fingerprint) -> (channel to close when done)
@@ -64,15 +96,24 @@ type Compilator struct {
 	// dependencies and resulting files.
 
 	signalDependencies map[string]chan struct{}
-	keepContainer      bool
-	ui                 *termui.UI
-	grapher            util.ModelGrapher
+
+	// equivalents is a map of
+	//    (package fingerprint) -> (packages not compiled themselves)
+	// listing the packages, usually of other releases and possibly with
+	// other names, which are satisfied by compiling the first package
+	// with the fingerprint (see %%).
+	equivalents map[string]model.Packages
+
+	keepContainer bool
+	ui            *termui.UI
+	grapher       util.ModelGrapher
 }
 
 type compileJob struct {
 	workerPackage *workerLib.Package
 	pkg           *model.Package
 	compilator    *Compilator
+	ctx           context.Context
 	doneCh        chan<- compileResult
 	killCh        <-chan struct{}
 }
@@ -108,6 +149,7 @@ func NewDockerCompilator(
 		grapher:            grapher,
 		packageStorage:     packageStorage,
 		signalDependencies: make(map[string]chan struct{}),
+		equivalents:        make(map[string]model.Packages),
 	}
 
 	return compilator, nil
@@ -137,16 +179,44 @@ func NewMountNSCompilator(
 		grapher:            grapher,
 		packageStorage:     packageStorage,
 		signalDependencies: make(map[string]chan struct{}),
+		equivalents:        make(map[string]model.Packages),
 	}
 
 	return compilator, nil
 }
 
+// SetHermetic switches the compilator into hermetic mode. Packages are then
+// compiled without network access, and all package sources must be present
+// locally before compilation starts.
+func (c *Compilator) SetHermetic(hermetic bool) {
+	c.hermetic = hermetic
+}
+
+// SetPlanHandler registers a function to be called with the packages which
+// need to be compiled (i.e. are not cached yet), for reporting progress.
+func (c *Compilator) SetPlanHandler(handler func(model.Packages)) {
+	c.planHandler = handler
+}
+
+// SetResultHandler registers a function to be called with the result of
+// each package compilation, for reporting progress.
+func (c *Compilator) SetResultHandler(handler func(*model.Package, time.Duration, error)) {
+	c.resultHandler = handler
+}
+
+// SetDurationEstimator registers a function returning the expected
+// compilation time of a package, e.g. from past compilations.  Packages
+// without an estimate get one from the size of their sources.
+func (c *Compilator) SetDurationEstimator(estimator func(*model.Package) (time.Duration, bool)) {
+	c.durationEstimator = estimator
+}
+
 var errWorkerAbort = errors.New("worker aborted")
 
 type compileResult struct {
-	pkg *model.Package
-	err error
+	pkg      *model.Package
+	err      error
+	duration time.Duration // time spent compiling; zero if not compiled
 }
 
 // Compile concurrency works like this:
@@ -155,7 +225,8 @@ type compileResult struct {
 // 1 synchronizer consuming EXACTLY 1 <-doneCh for every <-todoCh  <=> Compile() again.
 //
 // Dependencies:
-// - Packages with the least dependencies are queued first.
+// - Packages are queued after their dependencies, those heading the
+//   longest chains of compilations first (see createDepBuckets).
 // - Workers wait for their dependencies by waiting on a map of
 //   broadcasting channels that are closed by the synchronizer when
 //   something is done compiling successfully
@@ -174,18 +245,46 @@ type compileResult struct {
 // - synchronizer will greedily drain the <-todoCh to starve the
 //   workers out and won't wait for the <-doneCh for the N packages it
 //   drained.
-func (c *Compilator) Compile(workerCount int, releases []*model.Release, instanceGroups model.InstanceGroups, verbose bool) error {
+//
+// Cancelling ctx is handled like an error: the kill signal is sent, jobs
+// that have not started compiling yet abort, and ctx.Err() is returned.
+func (c *Compilator) Compile(ctx context.Context, workerCount int, releases []*model.Release, instanceGroups model.InstanceGroups, verbose bool) error {
 	packages, err := c.removeCompiledPackages(c.gatherPackages(releases, instanceGroups), verbose)
 
 	if err != nil {
 		return fmt.Errorf("failed to remove compiled packages: %v", err)
 	}
+	if c.planHandler != nil {
+		c.planHandler(packages)
+	}
 	if 0 == len(packages) {
 		c.ui.Println("No package needed to be built")
 		return nil
 	}
 	sort.Sort(packages)
 
+	if err := c.setupIsolation(packages); err != nil {
+		return err
+	}
+
+	// Packages of releases read from tarballs are extracted now, reading
+	// each tarball once rather than once per package.
+	if err := packages.ExtractArchives(); err != nil {
+		return err
+	}
+
+	if c.hermetic {
+		if err := c.verifyPackageSources(packages); err != nil {
+			return err
+		}
+	}
+
+	if err := c.checkStemcellCompatibility(); err != nil {
+		return err
+	}
+
+	defer c.startWarmContainers(workerCount)()
+
 	// Setup the queuing system ...
 	doneCh := make(chan compileResult)
 	killCh := make(chan struct{})
@@ -193,13 +292,14 @@ func (c *Compilator) Compile(workerCount int, releases []*model.Release, instanc
 	workerLib.MaxJobs = workerCount
 
 	worker := workerLib.NewWorker()
-	buckets := createDepBuckets(packages)
+	buckets := createDepBuckets(packages, c.estimateDuration)
 
 	// ... load it with the jobs to run ...
 	for _, pkg := range buckets {
 		worker.Add(compileJob{
 			pkg:        pkg,
 			compilator: c,
+			ctx:        ctx,
 			killCh:     killCh,
 			doneCh:     doneCh,
 		})
@@ -214,21 +314,56 @@ func (c *Compilator) Compile(workerCount int, releases []*model.Release, instanc
 	// (**) All jobs push their results into the single doneCh.
 	// The code below is a synchronizer which pulls the results
 	// from the channel as fast as it can and reports them to the
-	// user. In case of an error it signals this back to all jobs
-	// by closing killCh. This will cause the remaining jobs to
-	// abort when the queing system invokes them.  Note however,
-	// that the synchronizer is in a race with the dependency
-	// checker in func (j compileJob) Run() (see below), some jobs
-	// may still run to regular completion.
+	// user. In case of an error, or when the context is cancelled,
+	// it signals this back to all jobs by closing killCh. This
+	// will cause the remaining jobs to abort when the queing
+	// system invokes them.  Note however, that the synchronizer is
+	// in a race with the dependency checker in func (j compileJob)
+	// Run() (see below), some jobs may still run to regular
+	// completion.
 
 	killed := false
-	for result := range doneCh {
+	kill := func() {
+		if !killed {
+			close(killCh)
+			killed = true
+		}
+	}
+
+	cancelled := ctx.Done()
+	for {
+		var result compileResult
+		var ok bool
+		select {
+		case <-cancelled:
+			// Keep draining doneCh so that all jobs can finish
+			cancelled = nil
+			kill()
+			continue
+		case result, ok = <-doneCh:
+		}
+		if !ok {
+			break
+		}
+
+		if c.resultHandler != nil {
+			c.resultHandler(result.pkg, result.duration, result.err)
+		}
+
 		if result.err == nil {
 			close(c.signalDependencies[result.pkg.Fingerprint])
 			c.ui.Printf("%s   > success: %s/%s\n",
 				color.YellowString("result"),
 				color.GreenString(result.pkg.Release.Name),
 				color.GreenString(result.pkg.Name))
+			for _, equivalent := range c.EquivalentPackages(result.pkg) {
+				c.ui.Printf("%s   > success: %s/%s (same as %s/%s)\n",
+					color.YellowString("result"),
+					color.GreenString(equivalent.Release.Name),
+					color.GreenString(equivalent.Name),
+					result.pkg.Release.Name,
+					result.pkg.Name)
+			}
 			continue
 		}
 
@@ -241,12 +376,12 @@ func (c *Compilator) Compile(workerCount int, releases []*model.Release, instanc
 		)
 
 		err = result.err
-		if !killed {
-			close(killCh)
-			killed = true
-		}
+		kill()
 	}
 
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	return err
 }
 
@@ -265,18 +400,125 @@ func (c *Compilator) gatherPackages(releases []*model.Release, instanceGroups mo
 
 		// .. and collect for compilation. (%%) Here we ensure
 		// via the source fingerprints that only the first of
-		// several equivalent packages is taken.
+		// several equivalent packages is taken; the others are
+		// remembered as its equivalents.  Packages depending on
+		// one of the others wait for the same signal, as
+		// dependencies are tracked by fingerprint, and find its
+		// compiled files, which are stored by fingerprint.
 		for _, pkg := range releasePackages {
 			if _, known := c.signalDependencies[pkg.Fingerprint]; !known {
 				c.signalDependencies[pkg.Fingerprint] = make(chan struct{})
 				packages = append(packages, pkg)
+				continue
 			}
+			c.equivalents[pkg.Fingerprint] = append(c.equivalents[pkg.Fingerprint], pkg)
 		}
 	}
 
 	return packages
 }
 
+// EquivalentPackages returns the packages which are not compiled themselves
+// because they have the same fingerprint as the given package; they are
+// satisfied by compiling it.  This is only known once Compile has gathered
+// the packages.
+func (c *Compilator) EquivalentPackages(pkg *model.Package) model.Packages {
+	var equivalents model.Packages
+	for _, other := range c.equivalents[pkg.Fingerprint] {
+		if other != pkg {
+			equivalents = append(equivalents, other)
+		}
+	}
+	return equivalents
+}
+
+// verifyPackageSources makes sure the source archives for all of the given
+// packages are available locally and intact, so that compiling them does not
+// require any network access.
+func (c *Compilator) verifyPackageSources(packages model.Packages) error {
+	var problems []string
+	for _, pkg := range packages {
+		if err := pkg.ValidateSHA1(); err != nil {
+			problems = append(problems, fmt.Sprintf("%s/%s: %s", pkg.Release.Name, pkg.Name, err))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("hermetic compilation requires all package sources to be available locally:\n%s",
+			strings.Join(problems, "\n"))
+	}
+	if len(packages) > 0 {
+		c.ui.Printf("verified sources of %d packages for hermetic compilation\n", len(packages))
+	}
+	return nil
+}
+
+// Prefetch prepares the compilation of the packages of the releases used by
+// the instance groups for running offline or hermetic: the compiled packages
+// found in the package cache are downloaded, and the sources of all other
+// packages are checked to be available locally.  Nothing is compiled.
+func (c *Compilator) Prefetch(releases []*model.Release, instanceGroups model.InstanceGroups) error {
+	var fetched, local int
+	var toCompile model.Packages
+	for _, pkg := range c.gatherPackages(releases, instanceGroups) {
+		compiled, err := isPackageCompiledHarness(c, pkg)
+		if err != nil {
+			return err
+		}
+		if compiled {
+			local++
+			continue
+		}
+		if c.packageStorage != nil {
+			exists, err := c.packageStorage.Exists(pkg)
+			if err != nil {
+				return err
+			}
+			if exists {
+				if err := c.downloadCachedPackage(pkg); err != nil {
+					return err
+				}
+				fetched++
+				continue
+			}
+		}
+		toCompile = append(toCompile, pkg)
+	}
+
+	if err := toCompile.ExtractArchives(); err != nil {
+		return err
+	}
+	if err := c.verifyPackageSources(toCompile); err != nil {
+		return err
+	}
+
+	c.ui.Printf("prefetch: %d packages compiled already, %d downloaded from the cache, %d to compile from local sources\n",
+		local, fetched, len(toCompile))
+	return nil
+}
+
+// downloadCachedPackage downloads a compiled package from the package cache,
+// reporting the progress
+func (c *Compilator) downloadCachedPackage(pkg *model.Package) error {
+	c.ui.Printf("cache: downloading %s/%s\n", pkg.Release.Name, pkg.Name)
+	currentProgress := 0
+	previousProgress := 0
+	err := c.packageStorage.Download(pkg, func(progress float64) {
+		if progress == -1 {
+			c.ui.Printf("cache: finished downloading %s/%s\n", pkg.Release.Name, pkg.Name)
+			return
+		}
+		currentProgress = int(progress)
+		if currentProgress/20 > previousProgress {
+			c.ui.Printf("cache: %s/%s %s \n", pkg.Release.Name, pkg.Name, color.MagentaString("%d%%", currentProgress))
+			previousProgress = currentProgress / 20
+		}
+	})
+	if err != nil {
+		c.ui.Println(color.RedString("Error downloading the package"))
+	}
+	return err
+}
+
 func (j compileJob) Run() {
 	c := j.compilator
 
@@ -332,6 +574,12 @@ func (j compileJob) Run() {
 		stampy.Stamp(c.metricsPath, "fissile", waitSeriesName, "done")
 	}
 
+	// Do not start any new work once the caller has given up
+	if j.ctx.Err() != nil {
+		j.doneCh <- compileResult{pkg: j.pkg, err: errWorkerAbort}
+		return
+	}
+
 	c.ui.Printf("compile: %s/%s\n",
 		color.MagentaString(j.pkg.Release.Name),
 		color.MagentaString(j.pkg.Name))
@@ -354,30 +602,19 @@ func (j compileJob) Run() {
 	// Check to see whether a package already exists in the configured cache
 	// and either download that package or compile and upload it
 	if exists {
-		c.ui.Printf("cache: downloading %s/%s\n", j.pkg.Release.Name, j.pkg.Name)
-		currentProgress := 0
-		previousProgress := 0
-		downloadErr := c.packageStorage.Download(j.pkg, func(progress float64) {
-			if progress == -1 {
-				c.ui.Printf("cache: finished downloading %s/%s\n", j.pkg.Release.Name, j.pkg.Name)
-				return
-			}
-			currentProgress = int(progress)
-			if currentProgress/20 > previousProgress {
-				c.ui.Printf("cache: %s/%s %s \n", j.pkg.Release.Name, j.pkg.Name, color.MagentaString("%d%%", currentProgress))
-				previousProgress = currentProgress / 20
-			}
-		})
-		if downloadErr != nil {
-			c.ui.Println(color.RedString("Error downloading the package"))
-		}
-
-		j.doneCh <- compileResult{pkg: j.pkg, err: downloadErr}
+		j.doneCh <- compileResult{pkg: j.pkg, err: c.downloadCachedPackage(j.pkg)}
 
 	} else {
+		freeSlot, ok := c.tryIsolationSlot(j)
+		if !ok {
+			return
+		}
 		c.ui.Printf("compiling\n")
 		var workerErr error
+		started := time.Now()
 		workerErr = c.compilePackage(c, j.pkg)
+		duration := time.Since(started)
+		parked := freeSlot()
 
 		if workerErr == nil && c.packageStorage != nil && c.packageStorage.ReadOnly == false {
 			c.ui.Printf("uploading\n")
@@ -391,19 +628,28 @@ func (j compileJob) Run() {
 			color.MagentaString(j.pkg.Release.Name),
 			color.MagentaString(j.pkg.Name))
 
-		j.doneCh <- compileResult{pkg: j.pkg, err: workerErr}
+		j.doneCh <- compileResult{pkg: j.pkg, err: workerErr, duration: duration}
+
+		if parked != nil {
+			// Compile the package parked for the freed slot on this
+			// worker right away: queued packages depending on it may
+			// be holding all the other workers
+			parked.Run()
+		}
 	}
 }
 
-func createDepBuckets(packages []*model.Package) []*model.Package {
-	var buckets []*model.Package
-
-	// ruby takes forever and has no deps,
-	// so optimize by moving ruby packages to the front
-	var rubies []*model.Package
+// createDepBuckets orders the packages for queueing: every package X is
+// queued only after all of its dependencies, and of the packages whose
+// dependencies are queued, the one heading the longest chain of compilations
+// comes first.  The length of a chain is the sum of the estimated durations
+// of its packages; starting long chains early keeps the workers busy until
+// the end, instead of leaving a single worker compiling a long chain.
+func createDepBuckets(packages []*model.Package, estimate func(*model.Package) time.Duration) []*model.Package {
+	buckets := make([]*model.Package, 0, len(packages))
 
-	// topological sort, ensuring that each package X is queued
-	// only after all of its dependencies.
+	// topological sort (Kahn's algorithm), with the chain length as
+	// the priority of ready packages.
 
 	// helper data structures:
 	// 1. map: package fingerprint -> #(unqueued deps)
@@ -413,13 +659,8 @@ func createDepBuckets(packages []*model.Package) []*model.Package {
 	// of actual dependencies, and then counted down as
 	// these dependencies are queued up.
 	//
-	// When the counter for a package P reaches 0 then P can be
-	// queued, and in turn bumps the counters of all packages
-	// using it.
-	//
-	// The counters additionally serve as flags for when a package
-	// is queued/processed, saving us a separate boolean
-	// flag. This is done by dropping the respective depCount to -1 (**).
+	// When the counter for a package P reaches 0 then P is ready to be
+	// queued.
 
 	revDeps := make(map[string][]*model.Package)
 	depCount := make(map[string]int)
@@ -461,55 +702,79 @@ func createDepBuckets(packages []*model.Package) []*model.Package {
 		}
 	}
 
-	// Iterate until we have handled all packages.  We expect each
-	// iteration to handle at least one package, because the input
-	// is a DAG, i.e. has no cycles. Therefore each iteration will
-	// have at least one package with no dependencies, and being
-	// handled.
-
-	keepRunning := true
-	for keepRunning {
-		keepRunning = false
-
-		for _, pkg := range packages {
-
-			// The package either still has dependencies waiting (depCount > 0),
-			// or is enqueued and processed ((**) depCount == -1 < 0)
-			if depCount[pkg.Fingerprint] != 0 {
-				continue
+	// The chain length of a package is its own estimated duration plus
+	// the longest chain length of the packages using it.
+	chains := make(map[string]time.Duration)
+	var chainLength func(pkg *model.Package) time.Duration
+	chainLength = func(pkg *model.Package) time.Duration {
+		if length, ok := chains[pkg.Fingerprint]; ok {
+			return length
+		}
+		var longest time.Duration
+		for _, usr := range revDeps[pkg.Fingerprint] {
+			if length := chainLength(usr); length > longest {
+				longest = length
 			}
+		}
+		chains[pkg.Fingerprint] = estimate(pkg) + longest
+		return chains[pkg.Fingerprint]
+	}
 
-			// depCount == 0, time to
-			// - queue the package
-			// - notify the outer loop to keep running, and
-			// - force the following iterations to ignore
-			//   the package (See (**)).
-			depCount[pkg.Fingerprint]--
-			keepRunning = true
-
-			// notify the users of the queued that another
-			// of their dependencies is handled
-			for _, usr := range revDeps[pkg.Fingerprint] {
-				depCount[usr.Fingerprint]--
-			}
+	var ready []*model.Package
+	for _, pkg := range packages {
+		chainLength(pkg)
+		if depCount[pkg.Fingerprint] == 0 {
+			ready = append(ready, pkg)
+		}
+	}
 
-			// rubies are special, see notes at top of function
-			if strings.HasPrefix(pkg.Name, "ruby-2.") {
-				rubies = append(rubies, pkg)
-				continue
+	// Each iteration queues one package.  As the input is a DAG, i.e.
+	// has no cycles, there is a ready package until all are queued.
+	// Ties keep the order of the input.
+	for len(ready) > 0 {
+		next := 0
+		for i, pkg := range ready {
+			if chains[pkg.Fingerprint] > chains[ready[next].Fingerprint] {
+				next = i
+			}
+		}
+		pkg := ready[next]
+		ready = append(ready[:next], ready[next+1:]...)
+		buckets = append(buckets, pkg)
+
+		// notify the users of the queued package that another of
+		// their dependencies is handled
+		for _, usr := range revDeps[pkg.Fingerprint] {
+			depCount[usr.Fingerprint]--
+			if depCount[usr.Fingerprint] == 0 {
+				ready = append(ready, usr)
 			}
-
-			// queue regular
-			buckets = append(buckets, pkg)
 		}
 	}
 
-	// prepend rubies to get them out of the way first
-	buckets = append(rubies, buckets...)
-
 	return buckets
 }
 
+// staticSecondsPerMiB is the guessed compilation time per MiB of package
+// sources, for packages without recorded durations
+const staticSecondsPerMiB = 10
+
+// estimateDuration returns the expected compilation time of the package: the
+// one of past compilations if known, otherwise a guess from the size of its
+// sources.
+func (c *Compilator) estimateDuration(pkg *model.Package) time.Duration {
+	if c.durationEstimator != nil {
+		if duration, ok := c.durationEstimator(pkg); ok && duration > 0 {
+			return duration
+		}
+	}
+	estimate := time.Second
+	if info, err := os.Stat(pkg.Path); err == nil {
+		estimate += time.Duration(info.Size()) * staticSecondsPerMiB * time.Second / (1 << 20)
+	}
+	return estimate
+}
+
 func (c *Compilator) compilePackageInDocker(pkg *model.Package) (err error) {
 	// Prepare input dir (package plus deps)
 	if err := c.createCompilationDirStructure(pkg); err != nil {
@@ -520,6 +785,10 @@ func (c *Compilator) compilePackageInDocker(pkg *model.Package) (err error) {
 		return err
 	}
 
+	if err := c.copyVerifyScripts(pkg); err != nil {
+		return err
+	}
+
 	// Generate a compilation script
 	targetScriptName := "compile.sh"
 	hostScriptPath := filepath.Join(pkg.GetTargetPackageSourcesDir(c.hostWorkDir), targetScriptName)
@@ -553,6 +822,14 @@ func (c *Compilator) compilePackageInDocker(pkg *model.Package) (err error) {
 			return color.GreenString("compilation-%s > %s", color.MagentaString("%s", pkg.Name), color.RedString("%s", line))
 		},
 	)
+	cmd := []string{"/bin/bash", containerScriptPath, pkg.Name, pkg.Version}
+
+	// Packages with a network mode of their own get a dedicated container
+	if c.warmPool != nil && c.packageNetworkMode(pkg) == c.warmNetworkMode() {
+		exitCode, err := c.runInWarmContainer(pkg, cmd, stdoutWriter, stderrWriter)
+		return c.finishCompilation(pkg, log, exitCode, err)
+	}
+
 	sourceMountName := fmt.Sprintf("source_mount-%s", uuid.New())
 	mounts := map[string]string{
 		pkg.GetTargetPackageSourcesDir(c.hostWorkDir): docker.ContainerInPath,
@@ -585,13 +862,18 @@ func (c *Compilator) compilePackageInDocker(pkg *model.Package) (err error) {
 		streamOut[docker.ContainerOutPath] = pkg.GetPackageCompiledTempDir(c.hostWorkDir)
 	}
 
+	networkMode := c.packageNetworkMode(pkg)
+
 	exitCode, container, err := c.dockerManager.RunInContainer(docker.RunInContainerOpts{
 		ContainerName: containerName,
 		ImageName:     c.stemcellImageName,
 		EntryPoint:    []string{},
-		Cmd:           []string{"/bin/bash", containerScriptPath, pkg.Name, pkg.Version},
+		Cmd:           cmd,
+		Env:           c.compilationEnv(pkg),
 		Mounts:        mounts,
-		NetworkMode:   c.dockerNetworkMode,
+		NetworkMode:   networkMode,
+		DNS:           c.containerSettings.DNS,
+		ExtraHosts:    c.containerSettings.ExtraHosts,
 		Volumes:       volumes,
 		KeepContainer: c.keepContainer,
 		StdoutWriter:  stdoutWriter,
@@ -627,6 +909,13 @@ func (c *Compilator) compilePackageInDocker(pkg *model.Package) (err error) {
 		}()
 	}
 
+	return c.finishCompilation(pkg, log, exitCode, err)
+}
+
+// finishCompilation reports the outcome of running the compilation script of
+// a package in docker, showing its log on failure, and moves the compiled
+// package into place on success.
+func (c *Compilator) finishCompilation(pkg *model.Package, log io.WriterTo, exitCode int, err error) error {
 	if err != nil {
 		log.WriteTo(c.ui)
 		return fmt.Errorf("Error compiling package %s: %s", pkg.Name, err.Error())
@@ -634,7 +923,7 @@ func (c *Compilator) compilePackageInDocker(pkg *model.Package) (err error) {
 
 	if exitCode != 0 {
 		log.WriteTo(c.ui)
-		return fmt.Errorf("Error - compilation for package %s exited with code %d", pkg.Name, exitCode)
+		return c.compilationExitError(pkg, exitCode)
 	}
 
 	return os.Rename(
@@ -642,6 +931,24 @@ func (c *Compilator) compilePackageInDocker(pkg *model.Package) (err error) {
 		pkg.GetPackageCompiledDir(c.hostWorkDir))
 }
 
+// compilationExitError returns the error for a compilation script which
+// exited with the given non-zero code, telling failed verifications apart.
+func (c *Compilator) compilationExitError(pkg *model.Package, exitCode int) error {
+	if exitCode == compilation.VerificationFailedExitCode && len(pkg.VerifyScripts) > 0 {
+		return fmt.Errorf("Error - verification of package %s failed", pkg.Name)
+	}
+	return fmt.Errorf("Error - compilation for package %s exited with code %d%s", pkg.Name, exitCode, c.hermeticErrorHint())
+}
+
+// hermeticErrorHint returns a note to add to compilation errors, pointing out
+// that the packaging script had no network access.
+func (c *Compilator) hermeticErrorHint() string {
+	if !c.hermetic {
+		return ""
+	}
+	return " (hermetic mode: network access is disabled; packaging scripts must not download anything)"
+}
+
 func (c *Compilator) isPackageCompiled(pkg *model.Package) (bool, error) {
 	// If compiled package exists on hard disk
 	compiledPackagePath := pkg.GetPackageCompiledDir(c.hostWorkDir)
@@ -753,6 +1060,35 @@ func (c *Compilator) copyDependencies(pkg *model.Package) error {
 	return nil
 }
 
+// copyVerifyScripts copies the verification scripts of the package into its
+// sources, named for where they come from, for the compilation script to run
+// them in order against the compiled package.
+func (c *Compilator) copyVerifyScripts(pkg *model.Package) error {
+	verifyDir := pkg.GetPackageVerifyDir(c.hostWorkDir)
+	if err := os.RemoveAll(verifyDir); err != nil {
+		return err
+	}
+	if len(pkg.VerifyScripts) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(verifyDir, 0755); err != nil {
+		return err
+	}
+
+	releaseScript := pkg.ReleaseVerifyScript()
+	for _, script := range pkg.VerifyScripts {
+		name := "role-manifest"
+		if script == releaseScript {
+			name = "release"
+		}
+		if _, err := shutil.Copy(script, filepath.Join(verifyDir, name), true); err != nil {
+			return fmt.Errorf("Error copying verification script %s: %v", script, err)
+		}
+	}
+
+	return nil
+}
+
 // baseCompilationContainerName will return the compilation container's name
 func (c *Compilator) baseCompilationContainerName() string {
 	return util.SanitizeDockerName(fmt.Sprintf("%s-%s", c.stemcellImageName, c.fissileVersion))
@@ -813,7 +1149,8 @@ func (c *Compilator) gatherPackagesFromInstanceGroups(release *model.Release, in
 	// Find the initial list of packages to examine (all packages of the release in the manifest)
 	for _, instanceGroup := range instanceGroups {
 		for _, jobReference := range instanceGroup.JobReferences {
-			for _, pkg := range jobReference.Packages {
+			for _, link := range instanceGroup.PackageLinks(jobReference) {
+				pkg := link.Package
 				if pkg.Release.Name == release.Name {
 					pendingPackages.PushBack(pkg)
 					if c.grapher != nil {
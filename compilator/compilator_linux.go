@@ -24,6 +24,10 @@ func (c *Compilator) compilePackageInMountNS(pkg *model.Package) (err error) {
 		return fmt.Errorf("failed to copy dependencies: %s", err)
 	}
 
+	if err := c.copyVerifyScripts(pkg); err != nil {
+		return fmt.Errorf("failed to copy verification scripts: %s", err)
+	}
+
 	// Generate a compilation script
 	targetScriptName := "compile.sh"
 	hostScriptPath := filepath.Join(pkg.GetTargetPackageSourcesDir(c.hostWorkDir), targetScriptName)
@@ -57,15 +61,22 @@ func (c *Compilator) compilePackageInMountNS(pkg *model.Package) (err error) {
 	if err != nil {
 		return fmt.Errorf("Failed to find bash: %s", err)
 	}
+	env := append(os.Environ(), "HOST_USERID=1000", "HOST_USERGID=1000")
+	env = append(env, c.compilationEnv(pkg)...)
+	cloneFlags := uintptr(syscall.CLONE_NEWNS)
+	if c.hermetic {
+		// A new network namespace only has an unconfigured loopback device
+		cloneFlags |= syscall.CLONE_NEWNET
+	}
 	cmd := &exec.Cmd{
 		Path:   bashPath,
-		Args:   []string{"bash", hostScriptPath, pkg.Name, pkg.Version, c.hostWorkDir},
-		Env:    append(os.Environ(), "HOST_USERID=1000", "HOST_USERGID=1000"),
+		Args:   []string{"bash", hostScriptPath, pkg.Name, pkg.Version, c.hostWorkDir, pkg.Fingerprint},
+		Env:    env,
 		Dir:    c.hostWorkDir,
 		Stdout: stdoutWriter,
 		Stderr: stderrWriter,
 		SysProcAttr: &syscall.SysProcAttr{
-			Cloneflags: syscall.CLONE_NEWNS,
+			Cloneflags: cloneFlags,
 		},
 	}
 	err = cmd.Run()
@@ -73,7 +84,7 @@ func (c *Compilator) compilePackageInMountNS(pkg *model.Package) (err error) {
 		log.WriteTo(c.ui)
 		if exitError, ok := err.(*exec.ExitError); ok {
 			if waitStatus, ok := exitError.Sys().(*syscall.WaitStatus); ok {
-				return fmt.Errorf("Error - compilation for package %s exited with code %d", pkg.Name, waitStatus.ExitStatus())
+				return c.compilationExitError(pkg, waitStatus.ExitStatus())
 			}
 		}
 		return fmt.Errorf("Error compiling package %s: %s", pkg.Name, err)
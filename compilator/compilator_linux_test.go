@@ -2,6 +2,7 @@ package compilator
 
 import (
 	"bytes"
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -59,6 +60,6 @@ func TestCompilePackageInMountNS(t *testing.T) {
 	c, err := NewMountNSCompilator(tempDir, "", "repo", "linux", "0", ui, nil, nil)
 	assert.NoError(err)
 
-	err = c.Compile(2, []*model.Release{release}, nil, false)
+	err = c.Compile(context.Background(), 2, []*model.Release{release}, nil, false)
 	assert.NoError(err, stderr.String())
 }
@@ -2,6 +2,7 @@ package compilator
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -54,7 +55,7 @@ func TestCompilationEmpty(t *testing.T) {
 
 	waitCh := make(chan struct{})
 	go func() {
-		err := c.Compile(1, genTestCase(), nil, false)
+		err := c.Compile(context.Background(), 1, genTestCase(), nil, false)
 		close(waitCh)
 		assert.NoError(err)
 	}()
@@ -80,11 +81,12 @@ func TestCompilationBasic(t *testing.T) {
 		return nil
 	}
 
+	c.SetDurationEstimator(rubyTakesLongest)
 	release := genTestCase("ruby-2.5", "consul>go-1.4", "go-1.4")
 
 	waitCh := make(chan struct{})
 	go func() {
-		c.Compile(1, release, nil, false)
+		c.Compile(context.Background(), 1, release, nil, false)
 		close(waitCh)
 	}()
 
@@ -138,6 +140,49 @@ func TestCompilationBasic(t *testing.T) {
 	}
 }
 
+func TestCompilationCancelled(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := NewDockerCompilator(nil, "", "", "", "", "", "", false, ui, nil, nil, false)
+	assert.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var compiled []string
+	c.compilePackage = func(c *Compilator, pkg *model.Package) error {
+		compiled = append(compiled, pkg.Name)
+		cancel()
+		return nil
+	}
+
+	results := make(map[string]error)
+	c.SetResultHandler(func(pkg *model.Package, duration time.Duration, err error) {
+		results[pkg.Name] = err
+	})
+
+	c.SetDurationEstimator(rubyTakesLongest)
+	release := genTestCase("ruby-2.5", "consul>go-1.4", "go-1.4")
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- c.Compile(ctx, 1, release, nil, false)
+	}()
+
+	select {
+	case err = <-errCh:
+		assert.Equal(context.Canceled, err)
+	case <-time.After(10 * time.Second):
+		assert.Fail("Timed out waiting for the cancelled compilation")
+	}
+
+	assert.Equal([]string{"ruby-2.5"}, compiled)
+	assert.Len(results, 3)
+	assert.NoError(results["ruby-2.5"])
+	assert.Equal(errWorkerAbort, results["go-1.4"])
+	assert.Equal(errWorkerAbort, results["consul"])
+}
+
 func TestCompilationSkipCompiled(t *testing.T) {
 	saveIsPackageCompiled := isPackageCompiledHarness
 	defer func() {
@@ -163,7 +208,7 @@ func TestCompilationSkipCompiled(t *testing.T) {
 
 	waitCh := make(chan struct{})
 	go func() {
-		c.Compile(1, release, nil, false)
+		c.Compile(context.Background(), 1, release, nil, false)
 		close(waitCh)
 	}()
 
@@ -206,7 +251,7 @@ func TestCompilationRoleManifest(t *testing.T) {
 	waitCh := make(chan struct{})
 	errCh := make(chan error)
 	go func() {
-		errCh <- c.Compile(1, []*model.Release{roleManifest.LoadedReleases[0]}, roleManifest.InstanceGroups, false)
+		errCh <- c.Compile(context.Background(), 1, []*model.Release{roleManifest.LoadedReleases[0]}, roleManifest.InstanceGroups, false)
 	}()
 	go func() {
 		// `libevent` is a dependency of `tor` and will be compiled first
@@ -368,7 +413,7 @@ func TestCompilationMultipleErrors(t *testing.T) {
 
 	release := genTestCase("ruby-2.5", "consul>go-1.4", "go-1.4")
 
-	err = c.Compile(1, release, nil, false)
+	err = c.Compile(context.Background(), 1, release, nil, false)
 	assert.NotNil(err)
 }
 
@@ -471,7 +516,7 @@ func TestCompilationParallel(t *testing.T) {
 
 	testDoneCh := make(chan struct{})
 	go func() {
-		err = c.Compile(2, releases, nil, false)
+		err = c.Compile(context.Background(), 2, releases, nil, false)
 		assert.NoError(err)
 		close(testDoneCh)
 	}()
@@ -673,9 +718,15 @@ func TestCreateDepBuckets(t *testing.T) {
 		},
 	}
 
-	buckets := createDepBuckets(packages)
+	estimates := map[string]time.Duration{"ruby-2.5": 10 * time.Minute, "go-1.4": time.Minute}
+	buckets := createDepBuckets(packages, func(pkg *model.Package) time.Duration {
+		if estimate, ok := estimates[pkg.Name]; ok {
+			return estimate
+		}
+		return time.Second
+	})
 	assert.Equal(t, len(buckets), 4)
-	assert.Equal(t, buckets[0].Name, "ruby-2.5") // Ruby should be first
+	assert.Equal(t, buckets[0].Name, "ruby-2.5") // Ruby takes longest, so it should be first
 	assert.Equal(t, buckets[1].Name, "go-1.4")
 	assert.Equal(t, buckets[2].Name, "consul")
 	assert.Equal(t, buckets[3].Name, "cloud_controller_go")
@@ -708,13 +759,69 @@ func TestCreateDepBucketsOnChain(t *testing.T) {
 		},
 	}
 
-	buckets := createDepBuckets(packages)
+	buckets := createDepBuckets(packages, uniformEstimate)
 	assert.Equal(t, len(buckets), 3)
 	assert.Equal(t, buckets[0].Name, "A")
 	assert.Equal(t, buckets[1].Name, "C")
 	assert.Equal(t, buckets[2].Name, "B")
 }
 
+func TestCreateDepBucketsCriticalPathFirst(t *testing.T) {
+	t.Parallel()
+
+	// Two short independent packages, and a chain X -> Y -> Z; the chain
+	// is longer than either independent package, so it starts first
+	z := &model.Package{Fingerprint: "z", Name: "Z"}
+	y := &model.Package{Fingerprint: "y", Name: "Y", Dependencies: model.Packages{z}}
+	x := &model.Package{Fingerprint: "x", Name: "X", Dependencies: model.Packages{y}}
+	packages := []*model.Package{
+		{Fingerprint: "p", Name: "P"},
+		{Fingerprint: "q", Name: "Q"},
+		x,
+		y,
+		z,
+	}
+
+	buckets := createDepBuckets(packages, uniformEstimate)
+	var names []string
+	for _, pkg := range buckets {
+		names = append(names, pkg.Name)
+	}
+	assert.Equal(t, []string{"Z", "Y", "P", "Q", "X"}, names)
+}
+
+func uniformEstimate(*model.Package) time.Duration {
+	return time.Second
+}
+
+// rubyTakesLongest is a duration estimator which schedules ruby first
+func rubyTakesLongest(pkg *model.Package) (time.Duration, bool) {
+	return 10 * time.Minute, strings.HasPrefix(pkg.Name, "ruby-")
+}
+
+func TestEstimateDuration(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := NewDockerCompilator(nil, "", "", "", "", "", "", false, ui, nil, nil, false)
+	assert.NoError(err)
+
+	sources, err := ioutil.TempFile("", "fissile-package-")
+	assert.NoError(err)
+	defer os.Remove(sources.Name())
+	assert.NoError(sources.Truncate(1 << 20))
+	assert.NoError(sources.Close())
+
+	pkg := &model.Package{Name: "pkg", Path: sources.Name()}
+	assert.Equal((1+staticSecondsPerMiB)*time.Second, c.estimateDuration(pkg))
+	assert.Equal(time.Second, c.estimateDuration(&model.Package{Name: "missing"}))
+
+	c.SetDurationEstimator(func(p *model.Package) (time.Duration, bool) {
+		return time.Hour, p == pkg
+	})
+	assert.Equal(time.Hour, c.estimateDuration(pkg))
+	assert.Equal(time.Second, c.estimateDuration(&model.Package{Name: "missing"}))
+}
+
 func TestGatherPackages(t *testing.T) {
 	assert := assert.New(t)
 
@@ -729,6 +836,90 @@ func TestGatherPackages(t *testing.T) {
 	assert.Equal(packages[1].Name, "go-1.4.1")
 }
 
+func TestGatherPackagesAcrossReleases(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := NewDockerCompilator(nil, "", "", "", "", "", "", false, ui, nil, nil, false)
+	assert.NoError(err)
+
+	releases := genReleasesSharingGolang()
+	packages := c.gatherPackages(releases, nil)
+
+	if assert.Len(packages, 2) {
+		assert.Equal("go-1.4", packages[0].Name)
+		assert.Equal("app", packages[1].Name)
+
+		equivalents := c.EquivalentPackages(packages[0])
+		if assert.Len(equivalents, 1) {
+			assert.Equal("other-release", equivalents[0].Release.Name)
+			assert.Equal("golang", equivalents[0].Name)
+		}
+		assert.Empty(c.EquivalentPackages(packages[1]))
+	}
+}
+
+func TestCompilationAcrossReleases(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := NewDockerCompilator(nil, "", "", "", "", "", "", false, ui, nil, nil, false)
+	assert.NoError(err)
+
+	// The app package of the other release depends on its golang
+	// package, which is the same as go-1.4 of the test release; it must
+	// wait for go-1.4 to be compiled, even with workers to spare.
+	var mutex sync.Mutex
+	var compiled []string
+	c.compilePackage = func(c *Compilator, pkg *model.Package) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if pkg.Name == "app" {
+			assert.Equal([]string{"go-1.4"}, compiled, "app compiled before its dependency")
+		}
+		compiled = append(compiled, pkg.Name)
+		return nil
+	}
+
+	var results []string
+	c.SetResultHandler(func(pkg *model.Package, duration time.Duration, err error) {
+		assert.NoError(err)
+		results = append(results, fmt.Sprintf("%s/%s", pkg.Release.Name, pkg.Name))
+	})
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- c.Compile(context.Background(), 2, genReleasesSharingGolang(), nil, false)
+	}()
+
+	select {
+	case err = <-errCh:
+		assert.NoError(err)
+	case <-time.After(10 * time.Second):
+		assert.Fail("Timed out waiting for the compilation; app is waiting for golang")
+	}
+
+	assert.Equal([]string{"go-1.4", "app"}, compiled)
+	assert.Equal([]string{"test-release/go-1.4", "other-release/app"}, results)
+}
+
+// genReleasesSharingGolang returns two releases with the same golang
+// package under different names; the app package of the second release
+// depends on it.
+func genReleasesSharingGolang() []*model.Release {
+	release := &model.Release{Name: "test-release"}
+	release.Packages = model.Packages{
+		{Release: release, Name: "go-1.4", Fingerprint: "G"},
+	}
+
+	other := &model.Release{Name: "other-release"}
+	golang := &model.Package{Release: other, Name: "golang", Fingerprint: "G"}
+	other.Packages = model.Packages{
+		golang,
+		{Release: other, Name: "app", Fingerprint: "A", Dependencies: model.Packages{golang}},
+	}
+
+	return []*model.Release{release, other}
+}
+
 func TestRemoveCompiledPackages(t *testing.T) {
 	saveIsPackageCompiled := isPackageCompiledHarness
 	defer func() {
@@ -796,3 +987,330 @@ func genTestCase(args ...string) []*model.Release {
 
 	return []*model.Release{&release}
 }
+
+func TestCompilationHermeticMissingSources(t *testing.T) {
+	saveIsPackageCompiled := isPackageCompiledHarness
+	defer func() {
+		isPackageCompiledHarness = saveIsPackageCompiled
+	}()
+
+	isPackageCompiledHarness = func(c *Compilator, pkg *model.Package) (bool, error) {
+		return false, nil
+	}
+
+	c, err := NewDockerCompilator(nil, "", "", "", "", "", "", false, ui, nil, nil, false)
+	require.NoError(t, err)
+	c.SetHermetic(true)
+
+	c.compilePackage = func(c *Compilator, pkg *model.Package) error {
+		assert.Fail(t, "Package compiled despite missing sources", pkg.Name)
+		return nil
+	}
+
+	releases := genTestCase("consul>go-1.4", "go-1.4")
+	for _, pkg := range releases[0].Packages {
+		pkg.Path = filepath.Join(os.TempDir(), "fissile-missing-package-"+pkg.Name)
+	}
+
+	err = c.Compile(context.Background(), 1, releases, nil, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "hermetic compilation requires all package sources to be available locally")
+	assert.Contains(t, err.Error(), "test-release/consul")
+	assert.Contains(t, err.Error(), "test-release/go-1.4")
+}
+
+func TestPrefetch(t *testing.T) {
+	saveIsPackageCompiled := isPackageCompiledHarness
+	defer func() {
+		isPackageCompiledHarness = saveIsPackageCompiled
+	}()
+
+	isPackageCompiledHarness = func(c *Compilator, pkg *model.Package) (bool, error) {
+		return pkg.Name == "go-1.4", nil
+	}
+
+	t.Run("MissingSources", func(t *testing.T) {
+		c, err := NewDockerCompilator(nil, "", "", "", "", "", "", false, ui, nil, nil, false)
+		require.NoError(t, err)
+		c.compilePackage = func(c *Compilator, pkg *model.Package) error {
+			assert.Fail(t, "Package compiled while prefetching", pkg.Name)
+			return nil
+		}
+
+		releases := genTestCase("consul>go-1.4", "go-1.4")
+		for _, pkg := range releases[0].Packages {
+			pkg.Path = filepath.Join(os.TempDir(), "fissile-missing-package-"+pkg.Name)
+		}
+
+		err = c.Prefetch(releases, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "test-release/consul")
+		assert.NotContains(t, err.Error(), "test-release/go-1.4", "compiled packages need no sources")
+	})
+
+	t.Run("AllCompiled", func(t *testing.T) {
+		c, err := NewDockerCompilator(nil, "", "", "", "", "", "", false, ui, nil, nil, false)
+		require.NoError(t, err)
+
+		releases := genTestCase("go-1.4")
+		releases[0].Packages[0].Path = filepath.Join(os.TempDir(), "fissile-missing-package-go-1.4")
+		assert.NoError(t, c.Prefetch(releases, nil))
+	})
+}
+
+func TestCompilationStemcellIncompatible(t *testing.T) {
+	saveIsPackageCompiled := isPackageCompiledHarness
+	defer func() {
+		isPackageCompiledHarness = saveIsPackageCompiled
+	}()
+
+	isPackageCompiledHarness = func(c *Compilator, pkg *model.Package) (bool, error) {
+		return false, nil
+	}
+
+	c, err := NewMountNSCompilator("", "", "fake-stemcell", compilation.FakeBase, "", ui, nil, nil)
+	require.NoError(t, err)
+
+	c.SetStemcellCompatibility(&model.StemcellCompatibility{OS: "fake", OSVersion: "15.x", Libc: ">= 2.26"})
+	assert.NoError(t, c.checkStemcellCompatibility())
+
+	c.SetStemcellCompatibility(&model.StemcellCompatibility{OS: "other", Libc: ">= 2.27", Version: ">= 1.0"})
+	c.compilePackage = func(c *Compilator, pkg *model.Package) error {
+		assert.Fail(t, "Package compiled against incompatible stemcell", pkg.Name)
+		return nil
+	}
+
+	err = c.Compile(context.Background(), 1, genTestCase("go-1.4"), nil, false)
+	assert.EqualError(t, err, strings.Join([]string{
+		"Stemcell fake-stemcell is not compatible with the role manifest:",
+		`os: expected "other", found "fake"`,
+		"libc: 2.26 does not satisfy >= 2.27",
+		"version: could not be determined, expected >= 1.0",
+	}, "\n"))
+}
+
+func TestCompilationIsolation(t *testing.T) {
+	saveIsPackageCompiled := isPackageCompiledHarness
+	defer func() {
+		isPackageCompiledHarness = saveIsPackageCompiled
+	}()
+
+	isPackageCompiledHarness = func(c *Compilator, pkg *model.Package) (bool, error) {
+		return false, nil
+	}
+
+	t.Run("MaxParallel", func(t *testing.T) {
+		releases := genTestCase("one", "two", "three", "four")
+		isolation := &model.CompilationIsolation{Packages: "t*", MaxParallel: 1}
+		for _, pkg := range releases[0].Packages {
+			if isolation.Matches(pkg) {
+				pkg.CompilationIsolation = isolation
+			}
+		}
+
+		c, err := NewDockerCompilator(nil, "", "", "", "", "", "", false, ui, nil, nil, false)
+		require.NoError(t, err)
+
+		mutex := sync.Mutex{}
+		running, maxRunning := 0, 0
+		c.compilePackage = func(c *Compilator, pkg *model.Package) error {
+			if pkg.CompilationIsolation == nil {
+				return nil
+			}
+			mutex.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mutex.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+			return nil
+		}
+
+		require.NoError(t, c.Compile(context.Background(), 4, releases, nil, false))
+		assert.Equal(t, 1, maxRunning, "Packages of the isolation settings were compiled in parallel")
+	})
+
+	t.Run("SkipTakenSlots", func(t *testing.T) {
+		// With both workers on capped packages, one of them must move on
+		// to the uncapped package instead of waiting for the slot
+		releases := genTestCase("ta", "tb", "z")
+		isolation := &model.CompilationIsolation{Packages: "t*", MaxParallel: 1}
+		for _, pkg := range releases[0].Packages {
+			if isolation.Matches(pkg) {
+				pkg.CompilationIsolation = isolation
+			}
+		}
+
+		c, err := NewDockerCompilator(nil, "", "", "", "", "", "", false, ui, nil, nil, false)
+		require.NoError(t, err)
+
+		uncapped := make(chan struct{})
+		var compiled []string
+		mutex := sync.Mutex{}
+		c.compilePackage = func(c *Compilator, pkg *model.Package) error {
+			mutex.Lock()
+			compiled = append(compiled, pkg.Name)
+			first := len(compiled) == 1
+			mutex.Unlock()
+			if pkg.CompilationIsolation == nil {
+				close(uncapped)
+				return nil
+			}
+			if first {
+				select {
+				case <-uncapped:
+				case <-time.After(5 * time.Second):
+					return fmt.Errorf("%s was not compiled while %s held the slot", "z", pkg.Name)
+				}
+			}
+			return nil
+		}
+
+		require.NoError(t, c.Compile(context.Background(), 2, releases, nil, false))
+		if assert.Len(t, compiled, 3) {
+			assert.Equal(t, "z", compiled[1], "The uncapped package should be compiled while the slot is taken")
+		}
+	})
+
+	t.Run("ParkedWithQueuedDependents", func(t *testing.T) {
+		// While ta holds the slot, tb is parked and its dependents take
+		// both workers waiting for it; tb must still be compiled
+		releases := genTestCase("x", "ta", "tb>x", "d1>tb", "d2>tb", "d3>tb")
+		isolation := &model.CompilationIsolation{Packages: "t*", MaxParallel: 1}
+		for _, pkg := range releases[0].Packages {
+			if isolation.Matches(pkg) {
+				pkg.CompilationIsolation = isolation
+			}
+		}
+
+		c, err := NewDockerCompilator(nil, "", "", "", "", "", "", false, ui, nil, nil, false)
+		require.NoError(t, err)
+		// Queue the slow ta first, so that it holds the slot
+		c.SetDurationEstimator(func(pkg *model.Package) (time.Duration, bool) {
+			return time.Hour, pkg.Name == "ta"
+		})
+
+		var compiled []string
+		mutex := sync.Mutex{}
+		c.compilePackage = func(c *Compilator, pkg *model.Package) error {
+			if pkg.Name == "ta" {
+				time.Sleep(500 * time.Millisecond)
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			compiled = append(compiled, pkg.Name)
+			return nil
+		}
+
+		done := make(chan error)
+		go func() {
+			done <- c.Compile(context.Background(), 2, releases, nil, false)
+		}()
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(30 * time.Second):
+			mutex.Lock()
+			defer mutex.Unlock()
+			require.FailNow(t, "Compilation hangs", "Compiled only %v", compiled)
+		}
+		assert.Len(t, compiled, 6)
+	})
+
+	t.Run("HermeticNetworkMode", func(t *testing.T) {
+		releases := genTestCase("one")
+		releases[0].Packages[0].CompilationIsolation = &model.CompilationIsolation{NetworkMode: "host"}
+
+		c, err := NewDockerCompilator(nil, "", "", "", "", "", "", false, ui, nil, nil, false)
+		require.NoError(t, err)
+		c.SetHermetic(true)
+		c.compilePackage = func(c *Compilator, pkg *model.Package) error {
+			assert.Fail(t, "Package compiled despite conflicting settings", pkg.Name)
+			return nil
+		}
+
+		err = c.Compile(context.Background(), 1, releases, nil, false)
+		assert.EqualError(t, err, "Hermetic compilation cannot be combined with the network mode host of package test-release/one")
+	})
+}
+
+func TestContainerSettings(t *testing.T) {
+	settings := ContainerSettings{
+		DNS:        []string{"10.0.0.53", "fd00::53"},
+		ExtraHosts: []string{"proxy.corp:10.0.0.3"},
+		Env:        []string{"no_proxy=localhost,.corp", "CFLAGS=-O1"},
+	}
+	assert.NoError(t, settings.Validate())
+	assert.True(t, settings.HasNetworkSettings())
+	assert.False(t, ContainerSettings{Env: settings.Env}.HasNetworkSettings())
+
+	c, err := NewDockerCompilator(nil, "", "", "", "", "", "", false, ui, nil, nil, false)
+	require.NoError(t, err)
+	c.SetContainerSettings(settings)
+	pkg := &model.Package{CompilationEnv: []string{"CFLAGS=-O2"}}
+	assert.Equal(t, []string{"no_proxy=localhost,.corp", "CFLAGS=-O1", "CFLAGS=-O2"}, c.compilationEnv(pkg),
+		"The environment of the package must come last")
+
+	err = ContainerSettings{
+		DNS:        []string{"dns.corp"},
+		ExtraHosts: []string{"proxy.corp=10.0.0.3", ":10.0.0.3"},
+		Env:        []string{"NO_VALUE", "BAD-NAME=1"},
+	}.Validate()
+	assert.EqualError(t, err, strings.Join([]string{
+		"Invalid compilation container settings:",
+		"DNS server 'dns.corp' is not an IP address",
+		"Extra host 'proxy.corp=10.0.0.3' is not of the form host:ip",
+		"Extra host ':10.0.0.3' is not of the form host:ip",
+		"Environment variable 'NO_VALUE' is not of the form KEY=VALUE",
+		"Environment variable 'BAD-NAME=1' is not of the form KEY=VALUE",
+	}, "\n"))
+}
+
+func TestVerifyScriptsPreparation(t *testing.T) {
+	compilationWorkDir, err := util.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(compilationWorkDir)
+
+	releaseDir, err := util.TempDir("", "fissile-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(releaseDir)
+
+	releaseScript := filepath.Join(releaseDir, "packages", "tor", "verify")
+	require.NoError(t, os.MkdirAll(filepath.Dir(releaseScript), 0755))
+	require.NoError(t, ioutil.WriteFile(releaseScript, []byte("test -x bin/tor\n"), 0644))
+	userScript := filepath.Join(releaseDir, "verify-tor.sh")
+	require.NoError(t, ioutil.WriteFile(userScript, []byte("bin/tor --version\n"), 0644))
+
+	c, err := NewDockerCompilator(nil, compilationWorkDir, "", "", "", "", "", false, ui, nil, nil, false)
+	require.NoError(t, err)
+	pkg := &model.Package{
+		Name:          "tor",
+		Fingerprint:   "abc",
+		Release:       &model.Release{Name: "tor", Path: releaseDir},
+		VerifyScripts: []string{releaseScript, userScript},
+	}
+	require.NoError(t, c.copyVerifyScripts(pkg))
+
+	verifyDir := pkg.GetPackageVerifyDir(compilationWorkDir)
+	contents, err := ioutil.ReadFile(filepath.Join(verifyDir, "release"))
+	require.NoError(t, err)
+	assert.Equal(t, "test -x bin/tor\n", string(contents))
+	contents, err = ioutil.ReadFile(filepath.Join(verifyDir, "role-manifest"))
+	require.NoError(t, err)
+	assert.Equal(t, "bin/tor --version\n", string(contents))
+
+	pkg.VerifyScripts = nil
+	require.NoError(t, c.copyVerifyScripts(pkg))
+	_, err = os.Stat(verifyDir)
+	assert.True(t, os.IsNotExist(err), "Stale verification scripts must be removed")
+
+	err = c.compilationExitError(pkg, compilation.VerificationFailedExitCode)
+	assert.EqualError(t, err, "Error - compilation for package tor exited with code 86")
+	pkg.VerifyScripts = []string{userScript}
+	err = c.compilationExitError(pkg, compilation.VerificationFailedExitCode)
+	assert.EqualError(t, err, "Error - verification of package tor failed")
+}
@@ -0,0 +1,73 @@
+package compilator
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/model"
+)
+
+// ContainerSettings are additional settings of the compilation containers,
+// for the network setup of the site fissile runs at, e.g. a corporate proxy
+// and DNS.  They are not part of the package fingerprints, so they must not
+// change the compiled packages.
+type ContainerSettings struct {
+	// DNS servers, as IP addresses
+	DNS []string
+	// ExtraHosts are additional /etc/hosts entries, as host:ip
+	ExtraHosts []string
+	// Env holds environment variables (KEY=VALUE) passed to every
+	// compilation, before the compilation environment of the packages
+	Env []string
+}
+
+// containerEnvNamePattern matches valid names of environment variables
+var containerEnvNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate checks the format of the settings
+func (s ContainerSettings) Validate() error {
+	var problems []string
+	for _, server := range s.DNS {
+		if net.ParseIP(server) == nil {
+			problems = append(problems, fmt.Sprintf("DNS server '%s' is not an IP address", server))
+		}
+	}
+	for _, host := range s.ExtraHosts {
+		parts := strings.SplitN(host, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || net.ParseIP(parts[1]) == nil {
+			problems = append(problems, fmt.Sprintf("Extra host '%s' is not of the form host:ip", host))
+		}
+	}
+	for _, variable := range s.Env {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 || !containerEnvNamePattern.MatchString(parts[0]) {
+			problems = append(problems, fmt.Sprintf("Environment variable '%s' is not of the form KEY=VALUE", variable))
+		}
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("Invalid compilation container settings:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// HasNetworkSettings returns true if the settings change the network setup of
+// the containers, which needs docker
+func (s ContainerSettings) HasNetworkSettings() bool {
+	return len(s.DNS) != 0 || len(s.ExtraHosts) != 0
+}
+
+// SetContainerSettings sets additional settings of the compilation
+// containers.  Without docker, only the environment is used.
+func (c *Compilator) SetContainerSettings(settings ContainerSettings) {
+	c.containerSettings = settings
+}
+
+// compilationEnv returns the environment variables to compile the package
+// with; those of the package come last, to take precedence
+func (c *Compilator) compilationEnv(pkg *model.Package) []string {
+	env := make([]string, 0, len(c.containerSettings.Env)+len(pkg.CompilationEnv))
+	env = append(env, c.containerSettings.Env...)
+	return append(env, pkg.CompilationEnv...)
+}
@@ -0,0 +1,86 @@
+package compilator
+
+import (
+	"fmt"
+	"sync"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/fatih/color"
+)
+
+// isolationSlots tracks the packages compiling under isolation settings with
+// a parallelism cap.  Jobs finding no free slot are parked instead of keeping
+// their worker waiting, and run by the worker of the job freeing a slot.
+type isolationSlots struct {
+	mutex  sync.Mutex
+	size   int
+	free   int
+	parked []compileJob
+}
+
+// setupIsolation prepares the parallelism caps of the isolation settings of
+// the packages to compile.  Network modes of isolation settings cannot be
+// combined with hermetic compilation.
+func (c *Compilator) setupIsolation(packages model.Packages) error {
+	c.isolationSlots = make(map[*model.CompilationIsolation]*isolationSlots)
+	for _, pkg := range packages {
+		isolation := pkg.CompilationIsolation
+		if isolation == nil {
+			continue
+		}
+		if c.hermetic && isolation.NetworkMode != "" {
+			return fmt.Errorf("Hermetic compilation cannot be combined with the network mode %s of package %s/%s",
+				isolation.NetworkMode, pkg.Release.Name, pkg.Name)
+		}
+		if _, ok := c.isolationSlots[isolation]; !ok && isolation.MaxParallel > 0 {
+			c.isolationSlots[isolation] = &isolationSlots{size: isolation.MaxParallel, free: isolation.MaxParallel}
+		}
+	}
+	return nil
+}
+
+// tryIsolationSlot takes a slot of the parallelism cap of the isolation
+// settings of the package of the job, and returns the function freeing it
+// again.  If all slots are taken, the job is parked and false is returned;
+// its worker can then compile other packages.  Freeing a slot returns the
+// first parked job, if any, for the caller to run next.
+func (c *Compilator) tryIsolationSlot(j compileJob) (func() *compileJob, bool) {
+	slots, ok := c.isolationSlots[j.pkg.CompilationIsolation]
+	if !ok {
+		return func() *compileJob { return nil }, true
+	}
+	slots.mutex.Lock()
+	defer slots.mutex.Unlock()
+	if slots.free == 0 {
+		c.ui.Printf("parked:  %s/%s - %s\n",
+			color.MagentaString(j.pkg.Release.Name),
+			color.MagentaString(j.pkg.Name),
+			color.MagentaString("at most %d in parallel", slots.size))
+		slots.parked = append(slots.parked, j)
+		return nil, false
+	}
+	slots.free--
+	return func() *compileJob {
+		slots.mutex.Lock()
+		defer slots.mutex.Unlock()
+		slots.free++
+		if len(slots.parked) == 0 {
+			return nil
+		}
+		parked := slots.parked[0]
+		slots.parked = slots.parked[1:]
+		return &parked
+	}, true
+}
+
+// packageNetworkMode returns the docker network mode to compile the package
+// with
+func (c *Compilator) packageNetworkMode(pkg *model.Package) string {
+	if c.hermetic {
+		return "none"
+	}
+	if isolation := pkg.CompilationIsolation; isolation != nil && isolation.NetworkMode != "" {
+		return isolation.NetworkMode
+	}
+	return c.dockerNetworkMode
+}
@@ -0,0 +1,84 @@
+package compilator
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+
+	"code.cloudfoundry.org/fissile/docker"
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/scripts/compilation"
+	"github.com/fatih/color"
+)
+
+// SetStemcellCompatibility sets the compatibility declaration the stemcell
+// must satisfy before any packages are compiled against it.
+func (c *Compilator) SetStemcellCompatibility(compatibility *model.StemcellCompatibility) {
+	c.stemcellCompatibility = compatibility
+}
+
+// checkStemcellCompatibility inspects the stemcell and verifies it matches
+// the compatibility declaration, so that packages are not silently compiled
+// against the wrong operating system or libc.
+func (c *Compilator) checkStemcellCompatibility() error {
+	if c.stemcellCompatibility == nil {
+		return nil
+	}
+
+	c.ui.Printf("Checking stemcell %s compatibility ...\n", color.YellowString(c.stemcellImageName))
+
+	script, err := compilation.GetScript(c.baseType, compilation.StemcellProbeScript)
+	if err != nil {
+		return err
+	}
+
+	output, err := c.probeStemcell(script)
+	if err != nil {
+		return fmt.Errorf("Error inspecting stemcell %s: %v", c.stemcellImageName, err)
+	}
+
+	if err := c.stemcellCompatibility.Check(model.ParseStemcellInfo(output)); err != nil {
+		return fmt.Errorf("Stemcell %s is not compatible with the role manifest:\n%v", c.stemcellImageName, err)
+	}
+
+	return nil
+}
+
+// probeStemcell runs the probe script in the stemcell and returns its output.
+// Without docker, fissile is expected to already run inside the stemcell.
+func (c *Compilator) probeStemcell(script []byte) (output string, err error) {
+	if c.dockerManager == nil {
+		out, err := exec.Command("bash", "-c", string(script)).Output()
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	exitCode, container, err := c.dockerManager.RunInContainer(docker.RunInContainerOpts{
+		ContainerName: fmt.Sprintf("%s-stemcell-probe", c.baseCompilationContainerName()),
+		ImageName:     c.stemcellImageName,
+		EntryPoint:    []string{},
+		Cmd:           []string{"/bin/bash", "-c", string(script)},
+		NetworkMode:   "none",
+		StdoutWriter:  stdout,
+		StderrWriter:  stderr,
+	})
+	if container != nil {
+		defer func() {
+			if removeErr := c.dockerManager.RemoveContainer(container.ID); removeErr != nil && err == nil {
+				err = removeErr
+			}
+		}()
+	}
+	if err != nil {
+		return "", err
+	}
+	if exitCode != 0 {
+		return "", fmt.Errorf("probe exited with code %d: %s", exitCode, stderr.String())
+	}
+
+	return stdout.String(), nil
+}
@@ -129,6 +129,17 @@ func NewPackageStorage(kind string, readOnlyMode bool, config stow.Config, compi
 	return p, nil
 }
 
+// Check verifies that the package cache can be reached, by listing an item
+func (p *PackageStorage) Check() error {
+	_, _, err := p.container.Items("", stow.CursorStart, 1)
+	return err
+}
+
+// IsRemote returns true if accessing the package cache requires network access
+func (p *PackageStorage) IsRemote() bool {
+	return p.Kind != local.Kind
+}
+
 // Exists checks whether a package already exists in the configured
 // stow cache
 func (p *PackageStorage) Exists(pack *model.Package) (bool, error) {
@@ -0,0 +1,172 @@
+package compilator
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"code.cloudfoundry.org/fissile/docker"
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/fatih/color"
+	dockerclient "github.com/fsouza/go-dockerclient"
+	"github.com/pborman/uuid"
+)
+
+// warmContainerResetScript clears what compiling the previous package left
+// behind in a warm container: the inputs and outputs, the installed
+// dependencies, the sources, and temporary files.
+const warmContainerResetScript = `rm -rf /fissile-in /fissile-out /var/vcap/packages /var/vcap/source &&
+find /tmp -mindepth 1 -delete &&
+mkdir -p /fissile-in /fissile-out /var/vcap/source`
+
+// warmContainerPool holds the warm compilation containers which are not
+// compiling anything at the moment
+type warmContainerPool struct {
+	idle chan *dockerclient.Container
+
+	// started lists all containers of the pool, to remove them once
+	// compilation is done
+	mutex   sync.Mutex
+	started []*dockerclient.Container
+}
+
+// SetWarmContainers switches the compilator into warm container mode.  Instead
+// of starting a fresh container per package, packages are then compiled in a
+// pool of containers, one per worker, which are reset between packages.  The
+// packages are streamed into and out of the containers.  This saves the
+// startup of a container per package, but packages can see what the previous
+// packages in the container left behind outside of the reset directories, so
+// it is only meant for trusted releases.  It has no effect without docker.
+func (c *Compilator) SetWarmContainers(warm bool) {
+	c.warmContainers = warm
+}
+
+// startWarmContainers sets up the pool of warm containers for compiling with
+// the given number of workers; the returned function removes the containers.
+func (c *Compilator) startWarmContainers(workerCount int) func() {
+	if !c.warmContainers || c.dockerManager == nil {
+		return func() {}
+	}
+	if workerCount < 1 {
+		workerCount = 1
+	}
+	pool := &warmContainerPool{idle: make(chan *dockerclient.Container, workerCount)}
+	c.warmPool = pool
+
+	return func() {
+		c.warmPool = nil
+		pool.mutex.Lock()
+		defer pool.mutex.Unlock()
+		for _, container := range pool.started {
+			if err := c.dockerManager.RemoveContainer(container.ID); err != nil {
+				c.ui.Printf("%s: Error removing warm compilation container %s: %v\n",
+					color.YellowString("Warning"), container.Name, err)
+			}
+		}
+		pool.started = nil
+	}
+}
+
+// acquireWarmContainer returns an idle container of the pool, starting a new
+// one if all of them are busy
+func (c *Compilator) acquireWarmContainer() (*dockerclient.Container, error) {
+	select {
+	case container := <-c.warmPool.idle:
+		return container, nil
+	default:
+	}
+
+	container, err := c.dockerManager.StartIdleContainer(docker.RunInContainerOpts{
+		ContainerName: fmt.Sprintf("%s-warm-%s", c.baseCompilationContainerName(), uuid.New()),
+		ImageName:     c.stemcellImageName,
+		NetworkMode:   c.warmNetworkMode(),
+		DNS:           c.containerSettings.DNS,
+		ExtraHosts:    c.containerSettings.ExtraHosts,
+	})
+	if container != nil {
+		c.warmPool.mutex.Lock()
+		c.warmPool.started = append(c.warmPool.started, container)
+		c.warmPool.mutex.Unlock()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error starting a warm compilation container: %v", err)
+	}
+	return container, nil
+}
+
+// warmNetworkMode returns the docker network mode of the warm containers
+func (c *Compilator) warmNetworkMode() string {
+	if c.hermetic {
+		return "none"
+	}
+	return c.dockerNetworkMode
+}
+
+// releaseWarmContainer returns a container to the pool, for the next package
+func (c *Compilator) releaseWarmContainer(container *dockerclient.Container) {
+	select {
+	case c.warmPool.idle <- container:
+	default:
+		// More containers than workers; the container is removed with
+		// the others at the end
+	}
+}
+
+// discardWarmContainer takes a container out of the pool, for good.  It is
+// kept running, if asked to for debugging, and removed otherwise.
+func (c *Compilator) discardWarmContainer(container *dockerclient.Container) error {
+	c.warmPool.mutex.Lock()
+	for i, started := range c.warmPool.started {
+		if started == container {
+			c.warmPool.started = append(c.warmPool.started[:i], c.warmPool.started[i+1:]...)
+			break
+		}
+	}
+	c.warmPool.mutex.Unlock()
+
+	if c.keepContainer {
+		return nil
+	}
+	return c.dockerManager.RemoveContainer(container.ID)
+}
+
+// runInWarmContainer compiles a package, whose inputs are prepared, in a
+// container of the pool.  The container is reset first, and returned to the
+// pool once done; containers failing to run commands are discarded.
+func (c *Compilator) runInWarmContainer(pkg *model.Package, cmd []string, stdoutWriter, stderrWriter io.Writer) (int, error) {
+	container, err := c.acquireWarmContainer()
+	if err != nil {
+		return -1, err
+	}
+
+	exitCode, err := c.dockerManager.ExecInContainer(container, docker.ExecInContainerOpts{
+		Cmd:          []string{"/bin/bash", "-c", warmContainerResetScript},
+		StderrWriter: stderrWriter,
+	})
+	if err == nil && exitCode != 0 {
+		err = fmt.Errorf("Error resetting warm compilation container %s: exited with code %d", container.Name, exitCode)
+	}
+	if err == nil {
+		exitCode, err = c.dockerManager.ExecInContainer(container, docker.ExecInContainerOpts{
+			Cmd:          cmd,
+			Env:          c.compilationEnv(pkg),
+			StdoutWriter: stdoutWriter,
+			StderrWriter: stderrWriter,
+			StreamIn: map[string]string{
+				pkg.GetTargetPackageSourcesDir(c.hostWorkDir): docker.ContainerInPath,
+			},
+			StreamOut: map[string]string{
+				docker.ContainerOutPath: pkg.GetPackageCompiledTempDir(c.hostWorkDir),
+			},
+		})
+	}
+
+	if err != nil || (exitCode != 0 && c.keepContainer) {
+		if removeErr := c.discardWarmContainer(container); removeErr != nil && err == nil {
+			err = removeErr
+		}
+		return exitCode, err
+	}
+	c.releaseWarmContainer(container)
+	return exitCode, nil
+}
@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"os/exec"
@@ -15,6 +16,7 @@ import (
 	"sync"
 	"syscall"
 
+	"code.cloudfoundry.org/fissile/util"
 	"github.com/fatih/color"
 	dockerclient "github.com/fsouza/go-dockerclient"
 	tarstream "github.com/openshift/source-to-image/pkg/tar"
@@ -42,28 +44,35 @@ type dockerClient interface {
 	BuildImage(dockerclient.BuildImageOptions) error
 	CommitContainer(dockerclient.CommitContainerOptions) (*dockerclient.Image, error)
 	CreateContainer(dockerclient.CreateContainerOptions) (*dockerclient.Container, error)
+	CreateExec(dockerclient.CreateExecOptions) (*dockerclient.Exec, error)
 	CreateVolume(dockerclient.CreateVolumeOptions) (*dockerclient.Volume, error)
 	ImageHistory(string) ([]dockerclient.ImageHistory, error)
+	InspectExec(string) (*dockerclient.ExecInspect, error)
 	InspectImage(string) (*dockerclient.Image, error)
 	ListImages(dockerclient.ListImagesOptions) ([]dockerclient.APIImages, error)
 	ListVolumes(dockerclient.ListVolumesOptions) ([]dockerclient.Volume, error)
+	PullImage(dockerclient.PullImageOptions, dockerclient.AuthConfiguration) error
 	RemoveContainer(dockerclient.RemoveContainerOptions) error
 	RemoveImage(string) error
 	RemoveVolume(string) error
 	StartContainer(string, *dockerclient.HostConfig) error
+	StartExec(string, dockerclient.StartExecOptions) error
 	WaitContainer(string) (int, error)
 	UploadToContainer(string, dockerclient.UploadToContainerOptions) error
 	DownloadFromContainer(string, dockerclient.DownloadFromContainerOptions) error
+	Version() (*dockerclient.Env, error)
 }
 
 // ImageManager handles Docker images
 type ImageManager struct {
 	client dockerClient
+	// RetryPolicy is used for operations talking to a registry, like pulls
+	RetryPolicy util.RetryPolicy
 }
 
 // NewImageManager creates an instance of ImageManager
 func NewImageManager() (*ImageManager, error) {
-	manager := &ImageManager{}
+	manager := &ImageManager{RetryPolicy: util.DefaultRetryPolicy()}
 
 	client, err := dockerclient.NewClientFromEnv()
 	manager.client = client
@@ -75,6 +84,36 @@ func NewImageManager() (*ImageManager, error) {
 	return manager, nil
 }
 
+// MinimumAPIVersion is the oldest Docker API version fissile supports; the
+// volumes used for compilation need API 1.21
+const MinimumAPIVersion = "1.21"
+
+// ServerVersion returns the version and the API version of the docker daemon
+func (d *ImageManager) ServerVersion() (string, string, error) {
+	env, err := d.client.Version()
+	if err != nil {
+		return "", "", err
+	}
+	return env.Get("Version"), env.Get("ApiVersion"), nil
+}
+
+// CheckAPIVersion returns an error if the API version of the docker daemon is
+// older than MinimumAPIVersion
+func CheckAPIVersion(apiVersion string) error {
+	actual, err := dockerclient.NewAPIVersion(apiVersion)
+	if err != nil {
+		return fmt.Errorf("Invalid Docker API version '%s': %v", apiVersion, err)
+	}
+	minimum, err := dockerclient.NewAPIVersion(MinimumAPIVersion)
+	if err != nil {
+		return err
+	}
+	if actual.LessThan(minimum) {
+		return fmt.Errorf("Docker API version %s is older than the minimum version %s", apiVersion, MinimumAPIVersion)
+	}
+	return nil
+}
+
 // StringFormatter is a formatting string function
 type StringFormatter func(line string) string
 
@@ -425,6 +464,36 @@ func (d *ImageManager) ListImages(options dockerclient.ListImagesOptions) ([]doc
 	return d.client.ListImages(options)
 }
 
+// PullImage pulls an image from its registry, retrying failed pulls.  Docker
+// keeps the layers that were already downloaded, so a retry only fetches the
+// layers that are still missing.
+func (d *ImageManager) PullImage(imageName string, outputWriter io.Writer) error {
+	options := dockerclient.PullImageOptions{
+		OutputStream: outputWriter,
+	}
+	if strings.Contains(imageName, "@") {
+		// Pull by digest; the client splits the repository and digest
+		options.Repository = imageName
+	} else {
+		options.Repository, options.Tag = dockerclient.ParseRepositoryTag(imageName)
+		if options.Tag == "" {
+			options.Tag = "latest"
+		}
+	}
+
+	err := d.RetryPolicy.Do(func(int) error {
+		err := d.client.PullImage(options, dockerclient.AuthConfiguration{})
+		if err == dockerclient.ErrNoSuchImage {
+			return util.PermanentError(err)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Error pulling image %s: %v", imageName, err)
+	}
+	return nil
+}
+
 // CreateImage will create a Docker image
 func (d *ImageManager) CreateImage(containerID string, repository string, tag string, message string, cmd []string) (*dockerclient.Image, error) {
 	cco := dockerclient.CommitContainerOptions{
@@ -446,8 +515,15 @@ type RunInContainerOpts struct {
 	ContainerName string
 	ImageName     string
 	NetworkMode   string
-	EntryPoint    []string
-	Cmd           []string
+	// DNS servers of the container, and additional /etc/hosts entries
+	// (host:ip)
+	DNS        []string
+	ExtraHosts []string
+	EntryPoint []string
+	Cmd        []string
+	// Additional environment variables (KEY=VALUE); these override any
+	// proxy settings inherited from the host
+	Env []string
 	// Mount points, src -> dest
 	// dest may be special values ContainerInPath, ContainerOutPath
 	Mounts map[string]string
@@ -467,10 +543,6 @@ func (d *ImageManager) RunInContainer(opts RunInContainerOpts) (int, *dockerclie
 	var err error
 	var container *dockerclient.Container
 
-	// Get current user info to map to container
-	// os/user.Current() isn't supported when cross-compiling hence this code
-	currentUID := syscall.Geteuid()
-	currentGID := syscall.Getegid()
 	var actualCmd, containerCmd []string
 	if opts.KeepContainer {
 		// Sleep effectively forever so if something goes wrong we can
@@ -484,31 +556,6 @@ func (d *ImageManager) RunInContainer(opts RunInContainerOpts) (int, *dockerclie
 		// actualCmd not used
 	}
 
-	env := []string{
-		fmt.Sprintf("HOST_USERID=%d", currentUID),
-		fmt.Sprintf("HOST_USERGID=%d", currentGID),
-	}
-	for _, name := range []string{"http_proxy", "https_proxy"} {
-		var proxyURL *url.URL
-		var err error
-		if val, ok := os.LookupEnv(name); ok {
-			env = append(env, fmt.Sprintf("%s=%s", name, val))
-			if proxyURL, err = url.Parse(val); err != nil {
-				proxyURL = nil
-			}
-		}
-		name = strings.ToUpper(name)
-		if val, ok := os.LookupEnv(name); ok {
-			env = append(env, fmt.Sprintf("%s=%s", name, val))
-			if proxyURL == nil {
-				// Follow curl, lower case env vars have precedence
-				if proxyURL, err = url.Parse(val); err != nil {
-					proxyURL = nil
-				}
-			}
-		}
-	}
-
 	cco := dockerclient.CreateContainerOptions{
 		Config: &dockerclient.Config{
 			Tty:          false,
@@ -521,12 +568,14 @@ func (d *ImageManager) RunInContainer(opts RunInContainerOpts) (int, *dockerclie
 			Cmd:          containerCmd,
 			WorkingDir:   "/",
 			Image:        opts.ImageName,
-			Env:          env,
+			Env:          containerEnv(opts.Env),
 		},
 		HostConfig: &dockerclient.HostConfig{
 			Privileged:     false,
 			Binds:          []string{},
 			NetworkMode:    opts.NetworkMode,
+			DNS:            opts.DNS,
+			ExtraHosts:     opts.ExtraHosts,
 			ReadonlyRootfs: false,
 		},
 		Name: opts.ContainerName,
@@ -588,72 +637,8 @@ func (d *ImageManager) RunInContainer(opts RunInContainerOpts) (int, *dockerclie
 	attached <- <-attached
 
 	// Stream files within the container just before starting
-	fsWithSymlinks := fs.NewFileSystem()
-	fsWithSymlinks.KeepSymlinks(true)
-	for src, dest := range opts.StreamIn {
-		tarStream := tarstream.New(fsWithSymlinks)
-		r, w := io.Pipe()
-
-		go func() {
-			tarErr := tarStream.CreateTarStream(src, false, w)
-			if tarErr != nil {
-				w.CloseWithError(tarErr)
-			}
-			w.Close()
-		}()
-
-		err = d.client.UploadToContainer(container.ID, dockerclient.UploadToContainerOptions{
-			InputStream: r,
-			Path:        dest,
-		})
-		if err != nil {
-			return -1, container, fmt.Errorf("Error running in container: %s. Error streaming data into container: %s", container.ID, err)
-		}
-	}
-
-	// Function for streaming files out of the container
-	streamOutFiles := func() error {
-		for src, dest := range opts.StreamOut {
-			tarStream := tarstream.New(fsWithSymlinks)
-			r, w := io.Pipe()
-
-			go func() {
-				err := d.client.DownloadFromContainer(container.ID, dockerclient.DownloadFromContainerOptions{
-					OutputStream: w,
-					Path:         src,
-				})
-
-				if err != nil {
-					w.CloseWithError(err)
-				}
-				w.Close()
-			}()
-
-			err := tarStream.ExtractTarStream(dest, r)
-			if err != nil {
-				return err
-			}
-
-			// Docker will include the directory in the output tar stream so
-			// we need to move things arround
-			sourceDirectoryName := filepath.Base(src)
-			streamedOutputDir := filepath.Join(dest, sourceDirectoryName)
-			tmpDestDir := filepath.Join(filepath.Dir(dest), fmt.Sprintf("%s-tmp", filepath.Base(dest)))
-			err = os.Rename(streamedOutputDir, tmpDestDir)
-			if err != nil {
-				return err
-			}
-			err = os.RemoveAll(dest)
-			if err != nil {
-				return err
-			}
-			err = os.Rename(tmpDestDir, dest)
-			if err != nil {
-				return err
-			}
-		}
-
-		return nil
+	if err := d.streamIn(container.ID, opts.StreamIn); err != nil {
+		return -1, container, err
 	}
 
 	err = d.client.StartContainer(container.ID, container.HostConfig)
@@ -680,7 +665,7 @@ func (d *ImageManager) RunInContainer(opts RunInContainerOpts) (int, *dockerclie
 		}
 
 		// Stream files out of the container
-		err = streamOutFiles()
+		err = d.streamOut(container.ID, opts.StreamOut)
 		if err != nil {
 			return exitCode, container, fmt.Errorf("Error running in container: %s. Error streaming data out of container: %s", container.ID, err)
 		}
@@ -702,7 +687,7 @@ func (d *ImageManager) RunInContainer(opts RunInContainerOpts) (int, *dockerclie
 		exitCode = 0
 
 		// Stream files out of the container
-		err = streamOutFiles()
+		err = d.streamOut(container.ID, opts.StreamOut)
 		if err != nil {
 			err = fmt.Errorf("Error running in container: %s. Error streaming data out of container: %s", container.ID, err)
 		}
@@ -715,6 +700,214 @@ func (d *ImageManager) RunInContainer(opts RunInContainerOpts) (int, *dockerclie
 	return exitCode, container, err
 }
 
+// containerEnv returns the environment of the commands run in containers: the
+// host user, to map ownership of the outputs to, and the proxy settings of the
+// host, followed by the given variables (KEY=VALUE)
+func containerEnv(extra []string) []string {
+	// Get current user info to map to container
+	// os/user.Current() isn't supported when cross-compiling hence this code
+	currentUID := syscall.Geteuid()
+	currentGID := syscall.Getegid()
+
+	env := []string{
+		fmt.Sprintf("HOST_USERID=%d", currentUID),
+		fmt.Sprintf("HOST_USERGID=%d", currentGID),
+	}
+	for _, name := range []string{"http_proxy", "https_proxy"} {
+		var proxyURL *url.URL
+		var err error
+		if val, ok := os.LookupEnv(name); ok {
+			env = append(env, fmt.Sprintf("%s=%s", name, val))
+			if proxyURL, err = url.Parse(val); err != nil {
+				proxyURL = nil
+			}
+		}
+		name = strings.ToUpper(name)
+		if val, ok := os.LookupEnv(name); ok {
+			env = append(env, fmt.Sprintf("%s=%s", name, val))
+			if proxyURL == nil {
+				// Follow curl, lower case env vars have precedence
+				if proxyURL, err = url.Parse(val); err != nil {
+					proxyURL = nil
+				}
+			}
+		}
+	}
+	return append(env, extra...)
+}
+
+// streamIn copies the contents of host directories into directories of a
+// container, src -> dest
+func (d *ImageManager) streamIn(containerID string, dirs map[string]string) error {
+	fsWithSymlinks := fs.NewFileSystem()
+	fsWithSymlinks.KeepSymlinks(true)
+	for src, dest := range dirs {
+		tarStream := tarstream.New(fsWithSymlinks)
+		r, w := io.Pipe()
+
+		go func(src string) {
+			tarErr := tarStream.CreateTarStream(src, false, w)
+			if tarErr != nil {
+				w.CloseWithError(tarErr)
+			}
+			w.Close()
+		}(src)
+
+		err := d.client.UploadToContainer(containerID, dockerclient.UploadToContainerOptions{
+			InputStream: r,
+			Path:        dest,
+		})
+		if err != nil {
+			return fmt.Errorf("Error running in container: %s. Error streaming data into container: %s", containerID, err)
+		}
+	}
+	return nil
+}
+
+// streamOut copies directories of a container into host directories,
+// src -> dest, replacing their contents
+func (d *ImageManager) streamOut(containerID string, dirs map[string]string) error {
+	fsWithSymlinks := fs.NewFileSystem()
+	fsWithSymlinks.KeepSymlinks(true)
+	for src, dest := range dirs {
+		tarStream := tarstream.New(fsWithSymlinks)
+		r, w := io.Pipe()
+
+		go func(src string) {
+			err := d.client.DownloadFromContainer(containerID, dockerclient.DownloadFromContainerOptions{
+				OutputStream: w,
+				Path:         src,
+			})
+
+			if err != nil {
+				w.CloseWithError(err)
+			}
+			w.Close()
+		}(src)
+
+		err := tarStream.ExtractTarStream(dest, r)
+		if err != nil {
+			return err
+		}
+
+		// Docker will include the directory in the output tar stream so
+		// we need to move things arround
+		sourceDirectoryName := filepath.Base(src)
+		streamedOutputDir := filepath.Join(dest, sourceDirectoryName)
+		tmpDestDir := filepath.Join(filepath.Dir(dest), fmt.Sprintf("%s-tmp", filepath.Base(dest)))
+		err = os.Rename(streamedOutputDir, tmpDestDir)
+		if err != nil {
+			return err
+		}
+		err = os.RemoveAll(dest)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(tmpDestDir, dest)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StartIdleContainer creates and starts a container which does nothing but
+// wait for commands to be run in it with ExecInContainer, e.g. to compile
+// several packages in the same container.  Only the name, image, environment,
+// network settings and mounts of the options are used.  The caller has to
+// remove the container with RemoveContainer once done.
+func (d *ImageManager) StartIdleContainer(opts RunInContainerOpts) (*dockerclient.Container, error) {
+	cco := dockerclient.CreateContainerOptions{
+		Config: &dockerclient.Config{
+			Hostname:   "compiler",
+			Domainname: "fissile",
+			Entrypoint: []string{},
+			Cmd:        []string{"sleep", "365d"},
+			WorkingDir: "/",
+			Image:      opts.ImageName,
+			Env:        containerEnv(opts.Env),
+		},
+		HostConfig: &dockerclient.HostConfig{
+			Binds:       []string{},
+			NetworkMode: opts.NetworkMode,
+			DNS:         opts.DNS,
+			ExtraHosts:  opts.ExtraHosts,
+		},
+		Name: opts.ContainerName,
+	}
+	for src, dest := range opts.Mounts {
+		cco.HostConfig.Binds = append(cco.HostConfig.Binds, fmt.Sprintf("%s:%s", src, dest))
+	}
+
+	container, err := d.client.CreateContainer(cco)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.client.StartContainer(container.ID, container.HostConfig); err != nil {
+		return container, err
+	}
+	return container, nil
+}
+
+// ExecInContainerOpts encapsulates the options to ExecInContainer()
+type ExecInContainerOpts struct {
+	Cmd []string
+	// Additional environment variables (KEY=VALUE), for this command only
+	Env          []string
+	StdoutWriter io.Writer
+	StderrWriter io.Writer
+	// Directories to stream in before, and out after the command, if it
+	// succeeded.
+	StreamIn  map[string]string
+	StreamOut map[string]string
+}
+
+// ExecInContainer runs a command in a container started by
+// StartIdleContainer, and returns its exit code.  Env needs docker API 1.25.
+func (d *ImageManager) ExecInContainer(container *dockerclient.Container, opts ExecInContainerOpts) (int, error) {
+	if err := d.streamIn(container.ID, opts.StreamIn); err != nil {
+		return -1, err
+	}
+
+	stdout, stderr := opts.StdoutWriter, opts.StderrWriter
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	execution, err := d.client.CreateExec(dockerclient.CreateExecOptions{
+		Container:    container.ID,
+		Cmd:          opts.Cmd,
+		Env:          opts.Env,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return -1, fmt.Errorf("Error running in container: %s. Error creating exec: %s", container.ID, err)
+	}
+	err = d.client.StartExec(execution.ID, dockerclient.StartExecOptions{
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+	})
+	if err != nil {
+		return -1, fmt.Errorf("Error running in container: %s. Error starting exec: %s", container.ID, err)
+	}
+	inspect, err := d.client.InspectExec(execution.ID)
+	if err != nil {
+		return -1, fmt.Errorf("Error running in container: %s. Error inspecting exec: %s", container.ID, err)
+	}
+	if inspect.ExitCode != 0 {
+		return inspect.ExitCode, nil
+	}
+
+	if err := d.streamOut(container.ID, opts.StreamOut); err != nil {
+		return 0, fmt.Errorf("Error running in container: %s. Error streaming data out of container: %s", container.ID, err)
+	}
+	return 0, nil
+}
+
 // RemoveVolumes removes any temporary volumes associated with a container
 func (d *ImageManager) RemoveVolumes(container *dockerclient.Container) error {
 	volumes, err := d.client.ListVolumes(dockerclient.ListVolumesOptions{})
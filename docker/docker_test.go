@@ -756,3 +756,179 @@ func TestFindBestImageWithLabels_SimpleMandatory(t *testing.T) {
 	assert.Equal(images[2].history[0].ID, desiredImage)
 	assert.Equal(images[2].labels, foundLabels)
 }
+
+func TestPullImageRetries(t *testing.T) {
+	assert := assert.New(t)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	mockDockerClient := NewMockdockerClient(mockCtl)
+	dockerManager := &ImageManager{
+		client:      mockDockerClient,
+		RetryPolicy: util.RetryPolicy{MaxAttempts: 3},
+	}
+
+	expectedOptions := dockerclient.PullImageOptions{
+		Repository: "splatform/fissile-stemcell-opensuse",
+		Tag:        "42.2",
+	}
+	gomock.InOrder(
+		mockDockerClient.EXPECT().
+			PullImage(expectedOptions, dockerclient.AuthConfiguration{}).
+			Return(fmt.Errorf("connection reset by peer")),
+		mockDockerClient.EXPECT().
+			PullImage(expectedOptions, dockerclient.AuthConfiguration{}).
+			Return(nil),
+	)
+
+	assert.NoError(dockerManager.PullImage("splatform/fissile-stemcell-opensuse:42.2", nil))
+}
+
+func TestPullImageGivesUp(t *testing.T) {
+	assert := assert.New(t)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	mockDockerClient := NewMockdockerClient(mockCtl)
+	dockerManager := &ImageManager{
+		client:      mockDockerClient,
+		RetryPolicy: util.RetryPolicy{MaxAttempts: 2},
+	}
+
+	mockDockerClient.EXPECT().
+		PullImage(dockerclient.PullImageOptions{Repository: "ubuntu", Tag: "latest"}, dockerclient.AuthConfiguration{}).
+		Return(fmt.Errorf("timeout")).
+		Times(2)
+	assert.EqualError(dockerManager.PullImage("ubuntu", nil), "Error pulling image ubuntu: timeout")
+
+	mockDockerClient.EXPECT().
+		PullImage(dockerclient.PullImageOptions{Repository: "missing", Tag: "1"}, dockerclient.AuthConfiguration{}).
+		Return(dockerclient.ErrNoSuchImage)
+	assert.EqualError(dockerManager.PullImage("missing:1", nil), "Error pulling image missing:1: no such image")
+}
+
+func TestFindImageDoesNotRetry(t *testing.T) {
+	assert := assert.New(t)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	mockDockerClient := NewMockdockerClient(mockCtl)
+	dockerManager := &ImageManager{
+		client:      mockDockerClient,
+		RetryPolicy: util.RetryPolicy{MaxAttempts: 3},
+	}
+
+	// Local docker operations fail right away, e.g. when the daemon is down
+	mockDockerClient.EXPECT().InspectImage("stemcell").Return(nil, fmt.Errorf("EOF")).Times(1)
+	_, err := dockerManager.FindImage("stemcell")
+	assert.EqualError(err, "Error looking up image stemcell: EOF")
+
+	mockDockerClient.EXPECT().InspectImage("missing").Return(nil, dockerclient.ErrNoSuchImage)
+	_, err = dockerManager.FindImage("missing")
+	assert.Equal(ErrImageNotFound("missing"), err)
+}
+
+func TestStartIdleContainer(t *testing.T) {
+	assert := assert.New(t)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	mockDockerClient := NewMockdockerClient(mockCtl)
+	dockerManager := &ImageManager{
+		client: mockDockerClient,
+	}
+
+	container := &dockerclient.Container{ID: "warm", Name: "warm"}
+	mockDockerClient.EXPECT().
+		CreateContainer(gomock.Any()).
+		DoAndReturn(func(cco dockerclient.CreateContainerOptions) (*dockerclient.Container, error) {
+			assert.Equal("warm", cco.Name)
+			assert.Equal("stemcell", cco.Config.Image)
+			assert.Equal("none", cco.HostConfig.NetworkMode)
+			assert.Equal([]string{"10.0.0.53"}, cco.HostConfig.DNS)
+			assert.Equal([]string{"proxy.corp:10.0.0.3"}, cco.HostConfig.ExtraHosts)
+			container.HostConfig = cco.HostConfig
+			return container, nil
+		})
+	mockDockerClient.EXPECT().StartContainer("warm", gomock.Any()).Return(nil)
+
+	started, err := dockerManager.StartIdleContainer(RunInContainerOpts{
+		ContainerName: "warm",
+		ImageName:     "stemcell",
+		NetworkMode:   "none",
+		DNS:           []string{"10.0.0.53"},
+		ExtraHosts:    []string{"proxy.corp:10.0.0.3"},
+	})
+	assert.NoError(err)
+	assert.Equal(container, started)
+}
+
+func TestExecInContainer(t *testing.T) {
+	assert := assert.New(t)
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	mockDockerClient := NewMockdockerClient(mockCtl)
+	dockerManager := &ImageManager{
+		client: mockDockerClient,
+	}
+	container := &dockerclient.Container{ID: "warm", Name: "warm"}
+
+	gomock.InOrder(
+		mockDockerClient.EXPECT().
+			CreateExec(dockerclient.CreateExecOptions{
+				Container:    "warm",
+				Cmd:          []string{"true"},
+				Env:          []string{"GOPATH=/go"},
+				AttachStdout: true,
+				AttachStderr: true,
+			}).
+			Return(&dockerclient.Exec{ID: "exec-1"}, nil),
+		mockDockerClient.EXPECT().StartExec("exec-1", gomock.Any()).Return(nil),
+		mockDockerClient.EXPECT().InspectExec("exec-1").Return(&dockerclient.ExecInspect{ExitCode: 0}, nil),
+		mockDockerClient.EXPECT().CreateExec(gomock.Any()).Return(&dockerclient.Exec{ID: "exec-2"}, nil),
+		mockDockerClient.EXPECT().StartExec("exec-2", gomock.Any()).Return(nil),
+		mockDockerClient.EXPECT().InspectExec("exec-2").Return(&dockerclient.ExecInspect{ExitCode: 2}, nil),
+	)
+
+	exitCode, err := dockerManager.ExecInContainer(container, ExecInContainerOpts{
+		Cmd: []string{"true"},
+		Env: []string{"GOPATH=/go"},
+	})
+	assert.NoError(err)
+	assert.Equal(0, exitCode)
+
+	// Nothing is streamed out of failed commands
+	exitCode, err = dockerManager.ExecInContainer(container, ExecInContainerOpts{
+		Cmd:       []string{"false"},
+		StreamOut: map[string]string{ContainerOutPath: "/nonexistent"},
+	})
+	assert.NoError(err)
+	assert.Equal(2, exitCode)
+}
+
+func TestServerVersion(t *testing.T) {
+	mockCtl := gomock.NewController(t)
+	defer mockCtl.Finish()
+
+	mockDockerClient := NewMockdockerClient(mockCtl)
+	dockerManager := &ImageManager{
+		client: mockDockerClient,
+	}
+
+	env := dockerclient.Env{"Version=18.09.7", "ApiVersion=1.39"}
+	mockDockerClient.EXPECT().Version().Return(&env, nil)
+
+	version, apiVersion, err := dockerManager.ServerVersion()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "18.09.7", version)
+		assert.Equal(t, "1.39", apiVersion)
+	}
+}
+
+func TestCheckAPIVersion(t *testing.T) {
+	assert.NoError(t, CheckAPIVersion("1.39"))
+	assert.NoError(t, CheckAPIVersion(MinimumAPIVersion))
+	assert.EqualError(t, CheckAPIVersion("1.20"), "Docker API version 1.20 is older than the minimum version 1.21")
+	assert.Error(t, CheckAPIVersion("unknown"))
+}
@@ -0,0 +1,70 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultRegistry is the registry used for image names without one
+const defaultRegistry = "docker.io"
+
+// RegistryMirrors maps docker registry hosts to the mirrors that should be
+// used in their place, e.g. to use a pull-through cache or an internal
+// registry in an air-gapped environment.
+type RegistryMirrors map[string]string
+
+// ParseRegistryMirrors parses a list of registry=mirror pairs
+func ParseRegistryMirrors(pairs []string) (RegistryMirrors, error) {
+	mirrors := RegistryMirrors{}
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid registry mirror '%s', expected registry=mirror", pair)
+		}
+		mirrors[normalizeRegistry(parts[0])] = strings.TrimSuffix(parts[1], "/")
+	}
+	return mirrors, nil
+}
+
+// normalizeRegistry maps the aliases of the docker hub to a single name
+func normalizeRegistry(registry string) string {
+	registry = strings.TrimSuffix(registry, "/")
+	switch registry {
+	case "index.docker.io", "registry-1.docker.io":
+		return defaultRegistry
+	}
+	return registry
+}
+
+// splitImageName splits an image name into the registry and the remainder.
+// Images without an explicit registry are on the docker hub; official images
+// there live in the "library" organization.
+func splitImageName(imageName string) (string, string) {
+	parts := strings.SplitN(imageName, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		registry := normalizeRegistry(parts[0])
+		if registry == defaultRegistry && !strings.Contains(parts[1], "/") {
+			return registry, "library/" + parts[1]
+		}
+		return registry, parts[1]
+	}
+	if len(parts) == 1 {
+		return defaultRegistry, "library/" + imageName
+	}
+	return defaultRegistry, imageName
+}
+
+// Resolve returns the name of the image to use, taking the mirror of its
+// registry if one is configured.  Image names for registries without a
+// mirror are returned unchanged.
+func (m RegistryMirrors) Resolve(imageName string) string {
+	if len(m) == 0 {
+		return imageName
+	}
+	registry, remainder := splitImageName(imageName)
+	mirror, ok := m[registry]
+	if !ok {
+		return imageName
+	}
+	return fmt.Sprintf("%s/%s", mirror, remainder)
+}
@@ -0,0 +1,42 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRegistryMirrors(t *testing.T) {
+	mirrors, err := ParseRegistryMirrors([]string{"index.docker.io=mirror.example.com:5000/", "quay.io=quay-mirror.example.com"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, RegistryMirrors{
+			"docker.io": "mirror.example.com:5000",
+			"quay.io":   "quay-mirror.example.com",
+		}, mirrors)
+	}
+
+	_, err = ParseRegistryMirrors([]string{"docker.io"})
+	assert.EqualError(t, err, "Invalid registry mirror 'docker.io', expected registry=mirror")
+}
+
+func TestRegistryMirrorsResolve(t *testing.T) {
+	mirrors := RegistryMirrors{
+		"docker.io":      "mirror.example.com:5000",
+		"localhost:5000": "other.example.com",
+	}
+
+	testCases := map[string]string{
+		"ubuntu:14.04": "mirror.example.com:5000/library/ubuntu:14.04",
+		"splatform/fissile-stemcell-opensuse:42.2":     "mirror.example.com:5000/splatform/fissile-stemcell-opensuse:42.2",
+		"docker.io/splatform/fissile-stemcell:42.2":    "mirror.example.com:5000/splatform/fissile-stemcell:42.2",
+		"index.docker.io/ubuntu":                       "mirror.example.com:5000/library/ubuntu",
+		"localhost:5000/stemcell:1":                    "other.example.com/stemcell:1",
+		"registry.example.com/splatform/stemcell:42.2": "registry.example.com/splatform/stemcell:42.2",
+	}
+	for imageName, expected := range testCases {
+		assert.Equal(t, expected, mirrors.Resolve(imageName), imageName)
+	}
+
+	var noMirrors RegistryMirrors
+	assert.Equal(t, "ubuntu:14.04", noMirrors.Resolve("ubuntu:14.04"))
+}
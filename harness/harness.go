@@ -0,0 +1,189 @@
+// Package harness runs a single BOSH job of an instance group in a local
+// container created from the role image, so that job authors can try their
+// templates and scripts without deploying to a cluster.
+package harness
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"code.cloudfoundry.org/fissile/builder"
+	"code.cloudfoundry.org/fissile/model"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// ContainerPath is the directory the harness files are mounted at in
+	// the container
+	ContainerPath = "/opt/fissile/harness"
+	// ScriptName is the name of the script running the job
+	ScriptName = "run-job.sh"
+
+	jobsConfigName         = "job_config.json"
+	deploymentManifestName = "deployment-manifest.yml"
+)
+
+// Harness holds what is needed to run one job of an instance group: the job
+// and the properties to render its templates with.
+type Harness struct {
+	InstanceGroup *model.InstanceGroup
+	Job           *model.JobReference
+	Properties    map[interface{}]interface{}
+}
+
+// New returns a harness running the named job of the instance group, with no
+// properties.
+func New(instanceGroup *model.InstanceGroup, jobName string) (*Harness, error) {
+	job := instanceGroup.LookupJob(jobName)
+	if job == nil {
+		return nil, fmt.Errorf("Instance group %s has no job %s", instanceGroup.Name, jobName)
+	}
+	return &Harness{
+		InstanceGroup: instanceGroup,
+		Job:           job,
+		Properties:    map[interface{}]interface{}{},
+	}, nil
+}
+
+// LoadProperties reads the properties of the job from a YAML file, as they
+// would appear under the job in a BOSH deployment manifest.
+func (h *Harness) LoadProperties(path string) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	properties := map[interface{}]interface{}{}
+	if err := yaml.Unmarshal(contents, &properties); err != nil {
+		return fmt.Errorf("Error parsing properties file %s: %v", path, err)
+	}
+	h.Properties = properties
+	return nil
+}
+
+// DeploymentManifest returns a BOSH deployment manifest setting the
+// properties of the job, for configgin to render its templates with.
+func (h *Harness) DeploymentManifest() ([]byte, error) {
+	manifest := map[string]interface{}{
+		"instance_groups": []interface{}{
+			map[string]interface{}{
+				"name": h.InstanceGroup.Name,
+				"jobs": []interface{}{
+					map[string]interface{}{
+						"name":       h.Job.Name,
+						"properties": h.Properties,
+					},
+				},
+			},
+		},
+	}
+	return yaml.Marshal(manifest)
+}
+
+// Script returns the script run in the container: it renders the templates
+// of the job only, runs its pre-start script, and then either runs the job
+// (for bosh-task instance groups) or starts it with monit, following its logs.
+func (h *Harness) Script() ([]byte, error) {
+	output := &bytes.Buffer{}
+	err := scriptTemplate.Execute(output, map[string]interface{}{
+		"instance_group": h.InstanceGroup,
+		"job":            h.Job,
+		"harness":        ContainerPath,
+		"jobs_config":    jobsConfigName,
+		"manifest":       deploymentManifestName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// WriteTo writes the harness files into the directory, which is then to be
+// mounted at ContainerPath.
+func (h *Harness) WriteTo(dir string) error {
+	jobsConfig, err := builder.GenerateJobsConfig(h.InstanceGroup, model.JobReferences{h.Job})
+	if err != nil {
+		return err
+	}
+	manifest, err := h.DeploymentManifest()
+	if err != nil {
+		return err
+	}
+	script, err := h.Script()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	files := []struct {
+		name     string
+		contents []byte
+		mode     os.FileMode
+	}{
+		{jobsConfigName, jobsConfig, 0644},
+		{deploymentManifestName, manifest, 0644},
+		{ScriptName, script, 0755},
+	}
+	for _, file := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, file.name), file.contents, file.mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var scriptTemplate = template.Must(template.New(ScriptName).Parse(`#!/bin/bash
+# Runs the {{ .job.Name }} job of the {{ .instance_group.Name }} instance group; generated by fissile run job.
+
+set -e
+
+export PATH=/var/vcap/bosh/bin:$PATH
+source /usr/local/rvm/scripts/rvm
+
+export IP_ADDRESS=$(/bin/hostname -i | awk '{print $1}')
+export DNS_RECORD_NAME=$(/bin/hostname)
+export KUBE_COMPONENT_INDEX=0
+
+mkdir -p /var/vcap/instance /var/vcap/sys/run /var/vcap/sys/log/{{ .job.Name }}
+echo {{ .instance_group.Name }} > /var/vcap/instance/name
+echo 0 > /var/vcap/instance/id
+
+echo "Rendering the templates of {{ .job.Name }}"
+configgin \
+  --jobs {{ .harness }}/{{ .jobs_config }} \
+  --env2conf /opt/fissile/env2conf.yml \
+  --bosh-deployment-manifest {{ .harness }}/{{ .manifest }}
+
+if [ -x /var/vcap/jobs/{{ .job.Name }}/bin/pre-start ] ; then
+  echo "Running the pre-start script of {{ .job.Name }}"
+  /var/vcap/jobs/{{ .job.Name }}/bin/pre-start
+fi
+{{ if eq .instance_group.Type "bosh-task" }}
+if [ ! -x /var/vcap/jobs/{{ .job.Name }}/bin/run ] ; then
+  echo "Job {{ .job.Name }} has no run script" 1>&2
+  exit 1
+fi
+echo "Running {{ .job.Name }}"
+exec /var/vcap/jobs/{{ .job.Name }}/bin/run
+{{ else }}
+echo "Starting {{ .job.Name }} with monit"
+chmod 0600 /etc/monitrc
+monit -I &
+monit_pid=$!
+trap 'monit stop all ; monit quit' SIGTERM SIGINT
+
+# Give the job time to create its logs, then follow them.
+sleep 5
+shopt -s nullglob globstar
+logs=(/var/vcap/sys/log/{{ .job.Name }}/**/*.log)
+if [ ${#logs[@]} -gt 0 ] ; then
+  tail -n +1 -F "${logs[@]}" &
+fi
+wait "${monit_pid}"
+{{ end -}}
+`))
@@ -0,0 +1,94 @@
+package harness
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/model/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func loadTestManifest(t *testing.T) *model.RoleManifest {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	roleManifest, err := loader.LoadRoleManifest(filepath.Join(workDir, "../test-assets/role-manifests/builder/tor-good.yml"), model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{filepath.Join(workDir, "../test-assets/tor-boshrelease")},
+			BOSHCacheDir:     filepath.Join(workDir, "../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+	return roleManifest
+}
+
+func TestHarness(t *testing.T) {
+	roleManifest := loadTestManifest(t)
+	tempDir, err := ioutil.TempDir("", "fissile-harness-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	_, err = New(roleManifest.LookupInstanceGroup("myrole"), "nats")
+	assert.EqualError(t, err, "Instance group myrole has no job nats")
+
+	h, err := New(roleManifest.LookupInstanceGroup("myrole"), "tor")
+	require.NoError(t, err)
+
+	propertiesPath := filepath.Join(tempDir, "properties.yml")
+	require.NoError(t, ioutil.WriteFile(propertiesPath, []byte("tor:\n  hostname: localhost\n"), 0644))
+	require.NoError(t, h.LoadProperties(propertiesPath))
+
+	harnessDir := filepath.Join(tempDir, "harness")
+	require.NoError(t, h.WriteTo(harnessDir))
+
+	contents, err := ioutil.ReadFile(filepath.Join(harnessDir, deploymentManifestName))
+	require.NoError(t, err)
+	var manifest struct {
+		InstanceGroups []struct {
+			Name string
+			Jobs []struct {
+				Name       string
+				Properties map[string]map[string]string
+			}
+		} `yaml:"instance_groups"`
+	}
+	require.NoError(t, yaml.Unmarshal(contents, &manifest))
+	require.Len(t, manifest.InstanceGroups, 1)
+	assert.Equal(t, "myrole", manifest.InstanceGroups[0].Name)
+	require.Len(t, manifest.InstanceGroups[0].Jobs, 1)
+	assert.Equal(t, "tor", manifest.InstanceGroups[0].Jobs[0].Name)
+	assert.Equal(t, "localhost", manifest.InstanceGroups[0].Jobs[0].Properties["tor"]["hostname"])
+
+	contents, err = ioutil.ReadFile(filepath.Join(harnessDir, jobsConfigName))
+	require.NoError(t, err)
+	var jobsConfig map[string]interface{}
+	require.NoError(t, json.Unmarshal(contents, &jobsConfig))
+	assert.Contains(t, jobsConfig, "tor")
+	assert.NotContains(t, jobsConfig, "new_hostname", "Only the job to run is rendered")
+
+	script, err := ioutil.ReadFile(filepath.Join(harnessDir, ScriptName))
+	require.NoError(t, err)
+	assert.Contains(t, string(script), "--jobs /opt/fissile/harness/job_config.json")
+	assert.Contains(t, string(script), "/var/vcap/jobs/tor/bin/pre-start")
+	assert.Contains(t, string(script), "monit -I &")
+	assert.NotContains(t, string(script), "/var/vcap/jobs/tor/bin/run")
+}
+
+func TestHarnessTask(t *testing.T) {
+	roleManifest := loadTestManifest(t)
+
+	h, err := New(roleManifest.LookupInstanceGroup("foorole"), "tor")
+	require.NoError(t, err)
+	script, err := h.Script()
+	require.NoError(t, err)
+	assert.Contains(t, string(script), "exec /var/vcap/jobs/tor/bin/run")
+	assert.NotContains(t, string(script), "monit")
+}
@@ -33,16 +33,30 @@ options, like the max line length for comments, or the YAML indentation level:
 
   NewEncoder(os.Stdout, Indent(4), Wrap(80)).Encode(documentRoot)
 
+Block actions are written without the {{ }} delimiters and must be an if,
+range, or with action, because the encoder closes every block with {{- end }}.
+The If, Range, and With modifiers construct them, and Template, QuotedTemplate,
+Quote, and Fail help building template actions for scalar values.
+
+Mistakes in template fragments normally only show up when helm renders the
+chart. Validate checks a node tree for misused blocks and template syntax
+errors; the Validation encoder option runs this check before writing:
+
+  NewEncoder(os.Stdout, Validation(true)).Encode(documentRoot)
+
+This package is a supported API for programs generating helm charts on top of
+fissile's output.
+
 Tricks:
 
 * Throw an error if the the configuration cannot possibly work
 
-    list.Add(NewNode(`{{ fail "Cannot proceed" }}`, Block("if le (int .count) 0")))
+    list.Add(NewNode(Fail("Cannot proceed"), If("le (int .count) 0")))
 
 * Use a block action to generate multiple list elements
 
     tcp := NewMapping()
-    tcp.Set(Block("range $key, $value := .Values.tcp"))
+    tcp.Set(Range("$key, $value := .Values.tcp"))
     tcp.Add("name", NewNode("\"{{ $key }}-tcp\""))
     tcp.Add("containerPort", NewNode("$key"))
     tcp.Add("protocol", NewNode("TCP"))
@@ -220,6 +234,12 @@ func (scalar *Scalar) String() string {
 	return scalar.value
 }
 
+// Literal returns the value of a scalar node as written to YAML, including
+// the quotes of literal strings.
+func (scalar *Scalar) Literal() string {
+	return scalar.value
+}
+
 func (scalar Scalar) write(enc *Encoder, prefix string) {
 	fmt.Fprintln(enc, prefix+" "+strings.Replace(scalar.value, "\n", "\\n", -1))
 }
@@ -396,6 +416,10 @@ type Encoder struct {
 	// separator ("---\n")
 	separator bool
 
+	// validate specifies that the node tree should be checked with
+	// Validate() before anything is written.
+	validate bool
+
 	// pendingNewline is an internal flag to only emit a single empty line
 	// between elements that both require surrounding empty lines.
 	pendingNewline bool
@@ -430,6 +454,14 @@ func Separator(separator bool) func(*Encoder) {
 	}
 }
 
+// Validation selects if the node tree is checked with Validate() before it is
+// encoded; nothing is written if the check fails. The default value is false.
+func Validation(validate bool) func(*Encoder) {
+	return func(enc *Encoder) {
+		enc.validate = validate
+	}
+}
+
 // Wrap sets the maximum line length for comments. This number includes the
 // columns needed for indentation, so comments on more deeply nested nodes have
 // more tightly wrapped comments than outer level nodes. Wrapping applies only
@@ -463,6 +495,15 @@ func NewEncoder(writer io.Writer, modifiers ...func(*Encoder)) *Encoder {
 
 // Encode writes the config mapping held by the node to the stream.
 func (enc *Encoder) Encode(node Node) error {
+	if enc.validate {
+		if err := Validate(node); err != nil {
+			return err
+		}
+	}
+	return enc.encode(node)
+}
+
+func (enc *Encoder) encode(node Node) error {
 	enc.pendingNewline = false
 	prefix := ""
 	if enc.separator {
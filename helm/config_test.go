@@ -46,6 +46,9 @@ func equal(t *testing.T, config Node, expect string, modifiers ...func(*Encoder)
 func TestHelmScalar(t *testing.T) {
 	scalar := NewNode("Foo\nBar")
 	equal(t, scalar, fmt.Sprintf("---\n %q\n", scalar))
+	assert.Equal(t, `"Foo\nBar"`, scalar.(*Scalar).Literal())
+	assert.Equal(t, "~", NewNode(nil).(*Scalar).Literal())
+	assert.Equal(t, "42", NewNode(42).(*Scalar).Literal())
 
 	root := NewMapping("Scalar", scalar)
 
@@ -0,0 +1,259 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Chart is a helm chart loaded from disk, e.g. the output of `fissile build
+// helm`.
+type Chart struct {
+	Renderer
+	// Name is the name of the chart, from Chart.yaml or the directory name.
+	Name string
+	// Templates maps the paths of the templates, relative to the templates
+	// directory of the chart, to their text.  Helper templates (whose names
+	// start with an underscore) are only part of Renderer.Helpers.
+	Templates map[string]string
+
+	// parsed holds the helpers and templates, parsed on the first render;
+	// they must not change afterwards.
+	parsed *template.Template
+}
+
+// chartMetadata holds the parts of Chart.yaml exposed to the templates.
+type chartMetadata struct {
+	Name       string `yaml:"name"`
+	Version    string `yaml:"version"`
+	AppVersion string `yaml:"appVersion"`
+}
+
+// LoadChart reads the values and templates of the chart in the directory.
+func LoadChart(dir string) (*Chart, error) {
+	chart := &Chart{
+		Renderer:  Renderer{Values: map[string]interface{}{}},
+		Name:      filepath.Base(dir),
+		Templates: make(map[string]string),
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "Chart.yaml"))
+	if err == nil {
+		var metadata chartMetadata
+		if err := yaml.Unmarshal(contents, &metadata); err != nil {
+			return nil, fmt.Errorf("Error reading Chart.yaml: %v", err)
+		}
+		if metadata.Name != "" {
+			chart.Name = metadata.Name
+		}
+		chart.Chart = map[string]interface{}{
+			"Name":       metadata.Name,
+			"Version":    metadata.Version,
+			"AppVersion": metadata.AppVersion,
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	contents, err = ioutil.ReadFile(filepath.Join(dir, "values.yaml"))
+	if err == nil {
+		if err := chart.mergeValuesYAML(contents); err != nil {
+			return nil, fmt.Errorf("Error reading values.yaml: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	templatesDir := filepath.Join(dir, "templates")
+	var helpers []string
+	err = filepath.Walk(templatesDir, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(templatesDir, file)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(filepath.Base(name), "_") {
+			helpers = append(helpers, name)
+			chart.Templates[name] = string(contents)
+		} else if ext := filepath.Ext(name); ext == ".yaml" || ext == ".yml" {
+			chart.Templates[name] = string(contents)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error reading chart templates: %v", err)
+	}
+
+	sort.Strings(helpers)
+	for _, name := range helpers {
+		chart.Helpers += chart.Templates[name] + "\n"
+		delete(chart.Templates, name)
+	}
+
+	return chart, nil
+}
+
+// MergeValuesFile merges the values from the YAML file into the chart values
+// the way helm does for values files: mappings are merged recursively, and
+// all other values are replaced.
+func (c *Chart) MergeValuesFile(valuesPath string) error {
+	contents, err := ioutil.ReadFile(valuesPath)
+	if err != nil {
+		return err
+	}
+	if err := c.mergeValuesYAML(contents); err != nil {
+		return fmt.Errorf("Error reading values file %s: %v", valuesPath, err)
+	}
+	return nil
+}
+
+func (c *Chart) mergeValuesYAML(contents []byte) error {
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(contents, &values); err != nil {
+		return err
+	}
+	mergeValues(c.Values, copyValues(values))
+	return nil
+}
+
+// MergeValues merges the values into the chart values like MergeValuesFile,
+// e.g. those of ParseSetValues.
+func (c *Chart) MergeValues(values map[string]interface{}) {
+	mergeValues(c.Values, copyValues(values))
+}
+
+// mergeValues merges src into dst, recursing into mappings present in both.
+func mergeValues(dst, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, srcIsMap := value.(map[string]interface{})
+		dstMap, dstIsMap := dst[key].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeValues(dstMap, srcMap)
+		} else {
+			dst[key] = value
+		}
+	}
+}
+
+// TemplateNames returns the sorted names of all templates of the chart.
+func (c *Chart) TemplateNames() []string {
+	names := make([]string, 0, len(c.Templates))
+	for name := range c.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RenderTemplateText renders the named template with the given overrides
+// (see Renderer.Render).  Templates may include any template of the chart.
+func (c *Chart) RenderTemplateText(name string, overrides interface{}) ([]byte, error) {
+	if _, ok := c.Templates[name]; !ok {
+		return nil, fmt.Errorf("Chart has no template %s", name)
+	}
+	context, err := c.context(overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	basePath := path.Join(c.Name, "templates")
+	tmpl, err := c.parse(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	context["Template"] = map[string]interface{}{
+		"BasePath": basePath,
+		"Name":     path.Join(basePath, name),
+	}
+	var output bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&output, path.Join(basePath, name), context); err != nil {
+		return nil, fmt.Errorf("Error rendering %s: %v", name, err)
+	}
+	return output.Bytes(), nil
+}
+
+// parse returns the helpers and templates of the chart, parsed once, with
+// the templates named by their path below basePath.
+func (c *Chart) parse(basePath string) (*template.Template, error) {
+	if c.parsed != nil {
+		return c.parsed, nil
+	}
+	tmpl := newTemplate(nil)
+	if _, err := tmpl.Parse(c.Helpers); err != nil {
+		return nil, fmt.Errorf("Error parsing helper templates: %v", err)
+	}
+	for _, templateName := range c.TemplateNames() {
+		if _, err := tmpl.New(path.Join(basePath, templateName)).Parse(c.Templates[templateName]); err != nil {
+			return nil, fmt.Errorf("Error parsing %s: %v", templateName, err)
+		}
+	}
+	c.parsed = tmpl
+	return tmpl, nil
+}
+
+// RenderTemplate renders the named template like RenderTemplateText and
+// returns the YAML documents it produces; see ParseDocuments.
+func (c *Chart) RenderTemplate(name string, overrides interface{}) ([]interface{}, error) {
+	rendered, err := c.RenderTemplateText(name, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	documents, err := ParseDocuments(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing rendered %s: %v", name, err)
+	}
+	return documents, nil
+}
+
+// ParseDocuments parses the YAML documents of a rendered template.
+// Documents which are empty after rendering are omitted.
+func ParseDocuments(rendered []byte) ([]interface{}, error) {
+	documents := []interface{}{}
+	decoder := yaml.NewDecoder(bytes.NewReader(rendered))
+	for {
+		var document interface{}
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if document != nil {
+			documents = append(documents, document)
+		}
+	}
+	return documents, nil
+}
+
+// RenderAll renders all templates of the chart with the given overrides,
+// returning the documents of each template by name.
+func (c *Chart) RenderAll(overrides interface{}) (map[string][]interface{}, error) {
+	result := make(map[string][]interface{}, len(c.Templates))
+	for _, name := range c.TemplateNames() {
+		documents, err := c.RenderTemplate(name, overrides)
+		if err != nil {
+			return nil, err
+		}
+		result[name] = documents
+	}
+	return result, nil
+}
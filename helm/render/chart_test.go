@@ -0,0 +1,49 @@
+package render_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/charttest"
+	"code.cloudfoundry.org/fissile/helm/render"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadChart(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	chart, err := render.LoadChart(filepath.Join(workDir, "../../test-assets/charttest/chart"))
+	require.NoError(t, err)
+
+	assert.Equal([]string{"service.yaml"}, chart.TemplateNames())
+	assert.Contains(chart.Helpers, `define "example.name"`)
+	assert.Equal("example", chart.Chart["Name"])
+
+	documents, err := chart.RenderTemplate("service.yaml", nil)
+	if assert.NoError(err) {
+		charttest.AssertGolden(assert, filepath.Join(workDir, "../../test-assets/charttest/service.golden.yaml"), documents)
+	}
+
+	all, err := chart.RenderAll(map[string]interface{}{
+		"Values.services.loadbalanced": true,
+	})
+	if assert.NoError(err) && assert.Len(all["service.yaml"], 2) {
+		charttest.IsYAMLSubsetString(assert, `---
+			spec:
+				type: LoadBalancer
+		`, all["service.yaml"][0])
+		charttest.IsYAMLSubsetString(assert, `---
+			kind: ConfigMap
+			metadata:
+				name: example-myrelease-lb
+		`, all["service.yaml"][1])
+	}
+
+	_, err = chart.RenderTemplate("missing.yaml", nil)
+	assert.Error(err)
+}
@@ -0,0 +1,491 @@
+/*
+Package render renders helm charts generated by fissile without a helm
+installation, e.g. for `fissile helm template` and for checking the generated
+objects.
+
+A Renderer evaluates templates with a set of chart values and the built-in
+helm objects (Capabilities, Chart, Release, Template), which follow helm 3
+unless KubeVersion and ReleaseService say otherwise. Overrides are given as a
+map whose keys are dotted paths into the template context:
+
+	renderer, _ := render.NewRenderer(kube.MakeValues(settings), kube.GetHelmTemplateHelpers()...)
+	actual, _ := renderer.RoundtripNode(statefulSet, map[string]interface{}{
+	    "Values.sizing.router.count": 3,
+	})
+
+Charts already written to disk are loaded with LoadChart, and values given
+like the --set flag of helm are parsed with ParseSetValues.
+
+Besides the sprig functions, templates can use the functions helm adds:
+include, tpl, required, toYaml, fromYaml, toJson, and fromJson.
+*/
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"github.com/Masterminds/sprig"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// These are the defaults of the built-in objects which depend on the helm
+// and Kubernetes versions: those of helm 3.
+const (
+	DefaultKubeVersion    = "1.18"
+	DefaultReleaseService = "Helm"
+)
+
+// APIVersions exists to hang the `.Capabilities.APIVersions.Has` method off
+// the fake helm context.
+type APIVersions map[string]interface{}
+
+// Has indicates whether a version ("batch/v1") is enabled on the cluster.
+func (v *APIVersions) Has(name string) bool {
+	_, ok := (*v)[name]
+	return ok
+}
+
+// Renderer renders templates the way helm would for a given set of values.
+type Renderer struct {
+	// Values are the default chart values, as read from values.yaml.
+	Values map[string]interface{}
+	// Helpers holds the text of templates defining named templates, like
+	// the _helpers.tpl of a chart.
+	Helpers string
+	// Chart, if set, replaces the fake metadata of the built-in Chart
+	// object; the keys are those of Chart.yaml (e.g. "Name", "Version").
+	Chart map[string]interface{}
+	// KubeVersion is the Kubernetes version in .Capabilities.KubeVersion,
+	// as major.minor (e.g. "1.18"); DefaultKubeVersion if empty.
+	KubeVersion string
+	// ReleaseService is .Release.Service, the tool installing the chart
+	// (e.g. "Tiller" for helm 2); DefaultReleaseService if empty.
+	ReleaseService string
+
+	// helpers holds the parsed Helpers, once rendering started; Helpers
+	// must not change afterwards.
+	helpers *template.Template
+}
+
+// NewRenderer creates a renderer using the values (usually kube.MakeValues())
+// as defaults, and the given nodes as template helpers.
+func NewRenderer(values helm.Node, helpers ...helm.Node) (*Renderer, error) {
+	renderer := &Renderer{Values: map[string]interface{}{}}
+	if values != nil {
+		var err error
+		renderer.Values, err = ValuesFromNode(values)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buffer bytes.Buffer
+	for _, helper := range helpers {
+		if err := helm.NewEncoder(&buffer).Encode(helper); err != nil {
+			return nil, err
+		}
+	}
+	renderer.Helpers = buffer.String()
+	return renderer, nil
+}
+
+// context returns the template context with the overrides applied.  The
+// overrides may be nil, or map[string]interface{}.  Keys containing dots are
+// interpreted as the paths to the elements to override; keys without dots
+// replace top level objects.
+func (r *Renderer) context(overrides interface{}) (map[string]interface{}, error) {
+	kubeVersion := r.KubeVersion
+	if kubeVersion == "" {
+		kubeVersion = DefaultKubeVersion
+	}
+	major, minor, err := parseKubeVersion(kubeVersion)
+	if err != nil {
+		return nil, err
+	}
+	releaseService := r.ReleaseService
+	if releaseService == "" {
+		releaseService = DefaultReleaseService
+	}
+
+	context := map[string]interface{}{
+		// Copy the values so that overrides do not modify the defaults
+		"Values": copyValues(r.Values),
+		"Capabilities": map[string]interface{}{
+			"KubeVersion": map[string]interface{}{
+				"Major": major,
+				"Minor": minor,
+			},
+			"APIVersions": &APIVersions{
+				"apps/v1":                      true,
+				"rbac.authorization.k8s.io/v1": true,
+				"networking.k8s.io/v1":         true,
+				"policy/v1beta1":               true,
+			},
+		},
+		"Template": map[string]interface{}{
+			"BasePath": "",
+		},
+		"Chart": map[string]interface{}{
+			"AppVersion": "1.22.333.4444",
+			"Name":       "MyChart",
+			"Version":    "42.1+foo",
+		},
+		"Release": map[string]interface{}{
+			"Name":    "MyRelease",
+			"Service": releaseService,
+		},
+	}
+	if r.Chart != nil {
+		context["Chart"] = copyValues(r.Chart)
+	}
+	if overrideMap, ok := overrides.(map[string]interface{}); ok {
+		for k, v := range overrideMap {
+			context = mergeMap(context, v, 0, strings.Split(k, ".")...)
+		}
+	} else if overrides != nil {
+		return nil, fmt.Errorf("Invalid config %+v", overrides)
+	}
+	return context, nil
+}
+
+// parseKubeVersion splits a Kubernetes version like 1.18 or v1.18.3 into its
+// major and minor versions.
+func parseKubeVersion(version string) (string, string, error) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) < 2 {
+		return "", "", fmt.Errorf("Invalid Kubernetes version '%s', expected <major>.<minor>", version)
+	}
+	for _, part := range parts[:2] {
+		if _, err := strconv.Atoi(part); err != nil {
+			return "", "", fmt.Errorf("Invalid Kubernetes version '%s', expected <major>.<minor>", version)
+		}
+	}
+	return parts[0], parts[1], nil
+}
+
+// Render renders the template text with the given overrides.  The helpers
+// are parsed once, and the text is added to a copy of them.
+func (r *Renderer) Render(text string, overrides interface{}) ([]byte, error) {
+	context, err := r.context(overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.helpers == nil {
+		helpers, err := newTemplate(placeholderFile).Parse(r.Helpers)
+		if err != nil {
+			return nil, err
+		}
+		r.helpers = helpers
+	}
+	tmpl, err := r.helpers.Clone()
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err = bindFunctions(tmpl, placeholderFile).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var output bytes.Buffer
+	if err = tmpl.Execute(&output, context); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// RenderNode renders a helm node with the given overrides; see Render.
+func (r *Renderer) RenderNode(node helm.Node, overrides interface{}) ([]byte, error) {
+	if node == nil {
+		node = helm.NewNode(nil)
+	}
+	var text bytes.Buffer
+	if err := helm.NewEncoder(&text).Encode(node); err != nil {
+		return nil, err
+	}
+	return r.Render(text.String(), overrides)
+}
+
+// RoundtripNode renders a helm node and unmarshals the resulting YAML.  The
+// overrides are identical to Render().
+func (r *Renderer) RoundtripNode(node helm.Node, overrides interface{}) (interface{}, error) {
+	actualBytes, err := r.RenderNode(node, overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	var actual interface{}
+	if err := yaml.Unmarshal(actualBytes, &actual); err != nil {
+		return nil, err
+	}
+	return actual, nil
+}
+
+// RoundtripKube serializes and then unserializes a helm node without
+// performing any type of template resolution. As such the
+// unserialization step will only work if the helm node has no
+// templating (blocks), i.e. is destined for a kube output.
+func RoundtripKube(node helm.Node) (interface{}, error) {
+	var yamlConfig bytes.Buffer
+
+	if err := helm.NewEncoder(&yamlConfig).Encode(node); err != nil {
+		return nil, err
+	}
+
+	var actual interface{}
+	if err := yaml.Unmarshal(yamlConfig.Bytes(), &actual); err != nil {
+		return nil, err
+	}
+	return actual, nil
+}
+
+// ValuesFromNode converts a helm node holding chart values (which must not
+// contain any templating) into plain maps, lists, and scalars.
+func ValuesFromNode(node helm.Node) (map[string]interface{}, error) {
+	var convertNode func(node helm.Node, path []string) (interface{}, error)
+	convertNode = func(node helm.Node, path []string) (interface{}, error) {
+		switch n := node.(type) {
+		case *helm.Scalar:
+			var v interface{}
+			buffer := &bytes.Buffer{}
+			err := helm.NewEncoder(buffer).Encode(n)
+			if err != nil {
+				return nil, fmt.Errorf("Error encoding node at %s: %s", strings.Join(path, "."), err)
+			}
+			err = yaml.Unmarshal(buffer.Bytes(), &v)
+			if err != nil {
+				return nil, fmt.Errorf("Error parsing node at %s: %s", strings.Join(path, "."), err)
+			}
+			return v, nil
+		case *helm.List:
+			var values []interface{}
+			for i, v := range n.Values() {
+				converted, err := convertNode(v, append(path, fmt.Sprintf("%d", i)))
+				if err != nil {
+					return nil, err
+				}
+				values = append(values, converted)
+			}
+			return values, nil
+		case *helm.Mapping:
+			values := make(map[string]interface{}, len(n.Names()))
+			for _, k := range n.Names() {
+				converted, err := convertNode(n.Get(k), append(path, k))
+				if err != nil {
+					return nil, err
+				}
+				values[k] = converted
+			}
+			return values, nil
+		default:
+			return nil, fmt.Errorf("Invalid node type at %s", strings.Join(path, "."))
+		}
+	}
+
+	converted, err := convertNode(node, nil)
+	if err != nil {
+		return nil, err
+	}
+	values, ok := converted.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Values must be a mapping")
+	}
+	return values, nil
+}
+
+// copyValues returns a deep copy of the values.  The map[interface{}]interface{}
+// maps produced by the YAML parser are converted into map[string]interface{},
+// so that overrides can be merged into them.
+func copyValues(value map[string]interface{}) map[string]interface{} {
+	return copyValue(value).(map[string]interface{})
+}
+
+// copyValue returns a deep copy of the value, with maps converted like in
+// copyValues.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			result[fmt.Sprintf("%v", key)] = copyValue(element)
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			result[key] = copyValue(element)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, element := range v {
+			result[i] = copyValue(element)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// mergeMap returns the input map, but with an override applied.  An override
+// is a key path and a value to replace with.
+func mergeMap(obj map[string]interface{}, value interface{}, index int, key ...string) map[string]interface{} {
+	if len(key) < 1 {
+		panic("No keys")
+	}
+	if index > len(key) || index < 0 {
+		panic(fmt.Sprintf("Invalid index %d in keys %v", index, key))
+	}
+	if index == len(key)-1 {
+		// This will only work for untyped nil values
+		if value == nil {
+			delete(obj, key[index])
+		} else {
+			obj[key[index]] = value
+		}
+		return obj
+	}
+	if _, ok := obj[key[index]]; !ok {
+		obj[key[index]] = make(map[string]interface{})
+	}
+	if _, ok := obj[key[index]].(map[string]interface{}); !ok {
+		panic(fmt.Sprintf("Invalid object at %s: is not a map: %+v",
+			strings.Join(key[:index], "."),
+			obj[key[index]]))
+	}
+	obj[key[index]] = mergeMap(obj[key[index]].(map[string]interface{}), value, index+1, key...)
+	return obj
+}
+
+// maxIncludeDepth limits the nesting of include calls, so that templates
+// including themselves fail instead of exhausting the stack
+const maxIncludeDepth = 1000
+
+// placeholderFile stands in for the other files of a chart when rendering a
+// single template outside of one: including a file (e.g. the secrets.yaml
+// whose checksum is taken) yields its base name instead of its contents.
+func placeholderFile(name string) (string, bool) {
+	if !strings.Contains(name, "/") {
+		return "", false
+	}
+	return path.Base(name), true
+}
+
+// newTemplate returns an empty template with the functions available to
+// helm templates; see bindFunctions.
+func newTemplate(missing func(name string) (string, bool)) *template.Template {
+	// Note: Replicate helm's behaviour on missing keys.
+	return bindFunctions(template.New("").Option("missingkey=zero"), missing)
+}
+
+// bindFunctions adds the functions available to helm templates to the
+// template, and returns it.  include and tpl work with the templates
+// associated with it, so clones of a template need their own functions;
+// missing, if not nil, supplies the text of included templates that are not
+// associated.
+func bindFunctions(tmpl *template.Template, missing func(name string) (string, bool)) *template.Template {
+	depth := 0
+
+	include := func(name string, data interface{}) (string, error) {
+		if depth >= maxIncludeDepth {
+			return "", fmt.Errorf("Including %s exceeds the maximum depth of %d", name, maxIncludeDepth)
+		}
+		depth++
+		defer func() { depth-- }()
+
+		if missing != nil && tmpl.Lookup(name) == nil {
+			if text, ok := missing(name); ok {
+				return text, nil
+			}
+		}
+
+		var buffer bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&buffer, name, data); err != nil {
+			return "", err
+		}
+		return buffer.String(), nil
+	}
+
+	tpl := func(text string, data interface{}) (string, error) {
+		clone, err := tmpl.Clone()
+		if err != nil {
+			return "", err
+		}
+		clone, err = clone.New("tpl").Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("Error parsing tpl text: %v", err)
+		}
+		var buffer bytes.Buffer
+		if err := clone.Execute(&buffer, data); err != nil {
+			return "", err
+		}
+		return buffer.String(), nil
+	}
+
+	functions := sprig.TxtFuncMap()
+	functions["include"] = include
+	functions["tpl"] = tpl
+	functions["required"] = renderRequired
+	functions["toYaml"] = renderToYaml
+	functions["fromYaml"] = renderFromYaml
+	functions["toJson"] = renderToJSON
+	functions["fromJson"] = renderFromJSON
+	return tmpl.Funcs(functions)
+}
+
+func renderRequired(msg string, v interface{}) (interface{}, error) {
+	if v == nil {
+		return v, fmt.Errorf("%s", msg)
+	} else if _, ok := v.(string); ok {
+		if v == "" {
+			return v, fmt.Errorf("%s", msg)
+		}
+	}
+	return v, nil
+}
+
+func renderToYaml(data interface{}) (string, error) {
+	yml, err := yaml.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(yml), "\n"), nil
+}
+
+// renderFromYaml parses YAML into a map; like helm, errors are returned in
+// the map under the Error key.
+func renderFromYaml(text string) map[string]interface{} {
+	var values map[string]interface{}
+	if err := yaml.Unmarshal([]byte(text), &values); err != nil {
+		return map[string]interface{}{"Error": err.Error()}
+	}
+	if values == nil {
+		return map[string]interface{}{}
+	}
+	return copyValues(values)
+}
+
+func renderToJSON(data interface{}) (string, error) {
+	buf, err := json.Marshal(copyValue(data))
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// renderFromJSON parses JSON into a map; like helm, errors are returned in
+// the map under the Error key.
+func renderFromJSON(text string) map[string]interface{} {
+	values := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(text), &values); err != nil {
+		return map[string]interface{}{"Error": err.Error()}
+	}
+	return values
+}
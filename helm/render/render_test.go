@@ -0,0 +1,97 @@
+package render_test
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/fissile/charttest"
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/helm/render"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderNode(t *testing.T) {
+	assert := assert.New(t)
+
+	values := helm.NewMapping("replicas", 1, "name", "default")
+	helper := helm.NewNode(`{{ define "test.name" }}{{ .Release.Name }}-{{ .Values.name }}{{ end }}`)
+	renderer, err := render.NewRenderer(values, helper)
+	require.NoError(t, err)
+
+	node := helm.NewMapping()
+	node.Add("name", `{{ template "test.name" . }}`)
+	node.Add("replicas", "{{ .Values.replicas }}")
+	node.Add("ha", true, helm.If(`eq .Capabilities.KubeVersion.Minor "8"`))
+	node.Add("service", "{{ .Release.Service }}")
+
+	actual, err := renderer.RoundtripNode(node, nil)
+	if assert.NoError(err) {
+		charttest.IsYAMLEqualString(assert, `---
+			name: MyRelease-default
+			replicas: 1
+			service: Helm
+		`, actual)
+	}
+
+	renderer.KubeVersion = "v1.8.4"
+	renderer.ReleaseService = "Tiller"
+	actual, err = renderer.RoundtripNode(node, nil)
+	if assert.NoError(err) {
+		charttest.IsYAMLEqualString(assert, `---
+			name: MyRelease-default
+			replicas: 1
+			ha: true
+			service: Tiller
+		`, actual)
+	}
+
+	actual, err = renderer.RoundtripNode(node, map[string]interface{}{
+		"Values.replicas":                3,
+		"Release.Name":                   "other",
+		"Capabilities.KubeVersion.Minor": "9",
+	})
+	if assert.NoError(err) {
+		charttest.IsYAMLEqualString(assert, `---
+			name: other-default
+			replicas: 3
+			service: Tiller
+		`, actual)
+	}
+
+	assert.Equal(1, renderer.Values["replicas"], "Overrides should not change the default values")
+
+	_, err = renderer.RoundtripNode(node, "invalid")
+	assert.Error(err)
+
+	renderer.KubeVersion = "latest"
+	_, err = renderer.RoundtripNode(node, nil)
+	assert.EqualError(err, "Invalid Kubernetes version 'latest', expected <major>.<minor>")
+}
+
+func TestRoundtripKube(t *testing.T) {
+	assert := assert.New(t)
+
+	actual, err := render.RoundtripKube(helm.NewMapping("kind", "Pod", "spec", helm.NewMapping("replicas", 2)))
+	if assert.NoError(err) {
+		charttest.IsYAMLEqualString(assert, `---
+			kind: Pod
+			spec:
+				replicas: 2
+		`, actual)
+	}
+}
+
+func TestValuesFromNode(t *testing.T) {
+	assert := assert.New(t)
+
+	values, err := render.ValuesFromNode(helm.NewMapping("list", helm.NewList(1, "two"), "map", helm.NewMapping("key", true)))
+	if assert.NoError(err) {
+		assert.Equal(map[string]interface{}{
+			"list": []interface{}{1, "two"},
+			"map":  map[string]interface{}{"key": true},
+		}, values)
+	}
+
+	_, err = render.ValuesFromNode(helm.NewList(1))
+	assert.Error(err)
+}
@@ -0,0 +1,181 @@
+package render
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseSetValues parses values given the way of the --set flag of helm:
+// comma separated assignments of dotted paths, like
+//
+//	sizing.router.count=3,env.DOMAINS={a.example.com,b.example.com},list[1].name=x
+//
+// Values in braces are lists, and list elements are addressed by their
+// index.  A backslash escapes the next character, e.g. commas in values or
+// dots in keys.  Like helm, true, false, null, and integers are typed; all
+// other values are strings.
+func ParseSetValues(set string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	parser := &setParser{input: []rune(set)}
+	for !parser.done() {
+		if err := parser.assignment(values); err != nil {
+			return nil, fmt.Errorf("Invalid value assignment '%s': %v", set, err)
+		}
+	}
+	return values, nil
+}
+
+// setParser parses the assignments of ParseSetValues.
+type setParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *setParser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+// next returns the next rune, or zero at the end of the input.
+func (p *setParser) next() rune {
+	if p.done() {
+		return 0
+	}
+	r := p.input[p.pos]
+	p.pos++
+	return r
+}
+
+// until reads up to the first unescaped rune of stop, which it returns as
+// well (zero at the end of the input).  Escaped runes are unescaped.
+func (p *setParser) until(stop string) (string, rune) {
+	var text []rune
+	for !p.done() {
+		r := p.next()
+		if r == '\\' && !p.done() {
+			text = append(text, p.next())
+			continue
+		}
+		if strings.ContainsRune(stop, r) {
+			return string(text), r
+		}
+		text = append(text, r)
+	}
+	return string(text), 0
+}
+
+// assignment parses one assignment into the values, up to and including the
+// comma ending it.
+func (p *setParser) assignment(values map[string]interface{}) error {
+	key, stop := p.until("=.[,")
+	if key == "" {
+		return fmt.Errorf("empty key")
+	}
+	switch stop {
+	case '=':
+		value, err := p.value()
+		if err != nil {
+			return err
+		}
+		values[key] = value
+		return nil
+	case '.':
+		child, ok := values[key].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			values[key] = child
+		}
+		return p.assignment(child)
+	case '[':
+		list, _ := values[key].([]interface{})
+		list, err := p.listElement(list)
+		if err != nil {
+			return err
+		}
+		values[key] = list
+		return nil
+	default:
+		return fmt.Errorf("key %s has no value", key)
+	}
+}
+
+// listElement parses the assignment of the list element whose index follows
+// into the list, and returns the list grown as needed.
+func (p *setParser) listElement(list []interface{}) ([]interface{}, error) {
+	text, stop := p.until("]")
+	index, err := strconv.Atoi(text)
+	if stop != ']' || err != nil || index < 0 {
+		return nil, fmt.Errorf("invalid list index [%s", text)
+	}
+	for len(list) <= index {
+		list = append(list, nil)
+	}
+	switch p.next() {
+	case '=':
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		list[index] = value
+	case '.':
+		child, ok := list[index].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			list[index] = child
+		}
+		if err := p.assignment(child); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("list element [%d] has no value", index)
+	}
+	return list, nil
+}
+
+// value parses the value of an assignment, up to and including the comma
+// ending it.
+func (p *setParser) value() (interface{}, error) {
+	if p.done() || p.input[p.pos] != '{' {
+		text, _ := p.until(",")
+		return typedSetValue(text), nil
+	}
+
+	p.next()
+	list := []interface{}{}
+	for {
+		text, stop := p.until(",}")
+		switch stop {
+		case ',':
+			list = append(list, typedSetValue(text))
+		case '}':
+			if text != "" || len(list) > 0 {
+				list = append(list, typedSetValue(text))
+			}
+			if r := p.next(); r != ',' && r != 0 {
+				return nil, fmt.Errorf("unexpected %q after list", r)
+			}
+			return list, nil
+		default:
+			return nil, fmt.Errorf("list is not closed")
+		}
+	}
+}
+
+// typedSetValue returns the value of the text, typed like helm does.
+func typedSetValue(text string) interface{} {
+	switch text {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	// Numbers with leading zeros, like versions or octal modes, stay strings
+	if text == "0" || !strings.HasPrefix(strings.TrimPrefix(text, "-"), "0") {
+		if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return value
+		}
+	}
+	return text
+}
@@ -0,0 +1,47 @@
+package render_test
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/fissile/helm/render"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSetValues(t *testing.T) {
+	t.Parallel()
+
+	for set, expected := range map[string]map[string]interface{}{
+		"name=value": {"name": "value"},
+		"a.b=1,a.c=true,d=null,e=": {
+			"a": map[string]interface{}{"b": int64(1), "c": true},
+			"d": nil,
+			"e": "",
+		},
+		"version=0755,negative=-3,float=1.5": {"version": "0755", "negative": int64(-3), "float": "1.5"},
+		"list={a,b,3},empty={}":              {"list": []interface{}{"a", "b", int64(3)}, "empty": []interface{}{}},
+		`escaped=a\,b,dotted\.key=c`:         {"escaped": "a,b", "dotted.key": "c"},
+		"list[1]=x,list[0].name=y": {
+			"list": []interface{}{map[string]interface{}{"name": "y"}, "x"},
+		},
+		"url=https://example.com/?a=b": {"url": "https://example.com/?a=b"},
+	} {
+		actual, err := render.ParseSetValues(set)
+		if assert.NoError(t, err, set) {
+			assert.Equal(t, expected, actual, set)
+		}
+	}
+
+	for set, message := range map[string]string{
+		"name":          "key name has no value",
+		"=value":        "empty key",
+		"list[x]=1":     "invalid list index [x",
+		"list[0]":       "list element [0] has no value",
+		"list={a,b":     "list is not closed",
+		"list={a}b,c=d": `unexpected 'b' after list`,
+	} {
+		_, err := render.ParseSetValues(set)
+		if assert.Error(t, err, set) {
+			assert.Contains(t, err.Error(), message, set)
+		}
+	}
+}
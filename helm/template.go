@@ -0,0 +1,155 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// blockActions lists the template actions that can be used as node blocks.
+// Each of them encloses the node and is terminated by the {{- end }} that the
+// encoder emits after the node.
+var blockActions = []string{"if", "range", "with"}
+
+// If returns a modifier that only emits the node when the condition (a
+// template pipeline like `.Values.enabled`) is true.
+func If(condition string) NodeModifier {
+	return Block("if " + condition)
+}
+
+// Range returns a modifier that emits the node once for every element of the
+// pipeline, e.g. `$key, $value := .Values.tcp`.
+func Range(pipeline string) NodeModifier {
+	return Block("range " + pipeline)
+}
+
+// With returns a modifier that emits the node with dot set to the value of
+// the pipeline, if that value is not empty.
+func With(pipeline string) NodeModifier {
+	return Block("with " + pipeline)
+}
+
+// Template returns a template action evaluating the pipeline, e.g.
+// Template(".Values.name") returns `{{ .Values.name }}`.
+func Template(pipeline string) string {
+	return "{{ " + pipeline + " }}"
+}
+
+// QuotedTemplate returns a template action that evaluates the pipeline and
+// renders the result as a quoted YAML string.
+func QuotedTemplate(pipeline string) string {
+	return Template(pipeline + " | quote")
+}
+
+// Quote returns the string as a literal usable inside template actions, e.g.
+// as the argument of a function call.
+func Quote(value string) string {
+	return strconv.Quote(value)
+}
+
+// Fail returns a template action that aborts rendering of the chart with the
+// given message.  It is usually combined with an If modifier to check the
+// configuration:
+//
+//	NewNode(Fail("count must be positive"), If("le (int .Values.count) 0"))
+func Fail(message string) string {
+	return Template("fail " + Quote(message))
+}
+
+// Validate checks the template fragments of the node tree for errors that
+// would otherwise only be noticed when helm renders the chart: blocks must be
+// a single if, range, or with action without delimiters, and the document
+// generated from the tree must parse as a template.  Errors in blocks name
+// the path of the offending node.
+func Validate(node Node) error {
+	var problems []string
+	validateBlocks(node, "", &problems)
+	if len(problems) == 0 {
+		buffer := &bytes.Buffer{}
+		if err := NewEncoder(buffer).encode(node); err != nil {
+			return err
+		}
+		// Functions are not checked because the helm and sprig
+		// functions are not known here.
+		tree := parse.New("document")
+		tree.Mode = parse.SkipFuncCheck
+		if _, err := tree.Parse(buffer.String(), "", "", make(map[string]*parse.Tree)); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("Invalid helm template:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// validateBlocks checks that the blocks of all nodes are actions that will be
+// closed by the {{- end }} emitted after the node.
+func validateBlocks(node Node, path string, problems *[]string) {
+	if block := node.Block(); block != "" {
+		if err := validateBlock(block); err != nil {
+			name := path
+			if name == "" {
+				name = "(root)"
+			}
+			*problems = append(*problems, fmt.Sprintf("%s: block %q %s", name, block, err))
+		}
+	}
+
+	switch node := node.(type) {
+	case *List:
+		for i, element := range node.nodes {
+			validateBlocks(element, fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+	case *Mapping:
+		for _, namedNode := range node.nodes {
+			childPath := namedNode.name
+			if path != "" {
+				childPath = path + "." + namedNode.name
+			}
+			validateBlocks(namedNode.node, childPath, problems)
+		}
+	}
+}
+
+// RewriteTemplates replaces the template text of the node tree with the
+// result of rewrite: the blocks, comments, mapping keys and scalar values of
+// all nodes.  Scalars are rewritten as written to YAML, including the quotes
+// of literal strings.
+func RewriteTemplates(node Node, rewrite func(string) string) {
+	if block := node.Block(); block != "" {
+		node.Set(Block(rewrite(block)))
+	}
+	if comment := node.Comment(); comment != "" {
+		node.Set(Comment(rewrite(comment)))
+	}
+
+	switch node := node.(type) {
+	case *Scalar:
+		node.value = rewrite(node.value)
+	case *List:
+		for _, element := range node.nodes {
+			RewriteTemplates(element, rewrite)
+		}
+	case *Mapping:
+		for i := range node.nodes {
+			node.nodes[i].name = rewrite(node.nodes[i].name)
+			RewriteTemplates(node.nodes[i].node, rewrite)
+		}
+	}
+}
+
+func validateBlock(block string) error {
+	if strings.Contains(block, "{{") || strings.Contains(block, "}}") {
+		return fmt.Errorf("must not include the {{ }} delimiters")
+	}
+	fields := strings.Fields(block)
+	for _, action := range blockActions {
+		if len(fields) > 0 && fields[0] == action {
+			return nil
+		}
+	}
+	return fmt.Errorf("must start with one of: %s", strings.Join(blockActions, ", "))
+}
@@ -0,0 +1,110 @@
+package helm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHelmTemplateHelpers(t *testing.T) {
+	assert := assert.New(t)
+
+	root := NewMapping()
+	root.Add("enabled", Template(".Values.enabled"), If(".Values.feature"))
+	root.Add("name", QuotedTemplate(".Values.name"), With(".Values.name"))
+	root.Add("_count", Fail(`count "must" be positive`), If("le (int .Values.count) 0"))
+
+	port := NewMapping("containerPort", Template("$port"))
+	port.Set(Range("$port := .Values.ports"))
+	root.Add("ports", NewList(port))
+
+	assert.NoError(Validate(root))
+	equal(t, root, `---
+{{- if .Values.feature }}
+enabled: {{ .Values.enabled }}
+{{- end }}
+{{- with .Values.name }}
+name: {{ .Values.name | quote }}
+{{- end }}
+{{- if le (int .Values.count) 0 }}
+_count: {{ fail "count \"must\" be positive" }}
+{{- end }}
+ports:
+{{- range $port := .Values.ports }}
+- containerPort: {{ $port }}
+{{- end }}
+`)
+}
+
+func TestHelmValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	t.Run("BlockDelimiters", func(t *testing.T) {
+		root := NewMapping("foo", NewMapping("bar", 1))
+		root.Get("foo", "bar").Set(Block("{{ if .Values.bar }}"))
+		err := Validate(root)
+		if assert.Error(err) {
+			assert.Contains(err.Error(), `foo.bar: block "{{ if .Values.bar }}" must not include the {{ }} delimiters`)
+		}
+	})
+
+	t.Run("BlockNotEnclosing", func(t *testing.T) {
+		root := NewList(1, 2)
+		root.Values()[1].Set(Block("toYaml .Values.bar"))
+		err := Validate(root)
+		if assert.Error(err) {
+			assert.Contains(err.Error(), `[1]: block "toYaml .Values.bar" must start with one of: if, range, with`)
+		}
+	})
+
+	t.Run("BadSyntax", func(t *testing.T) {
+		root := NewMapping("foo", NewNode(1, If("and (.Values.a .Values.b")))
+		err := Validate(root)
+		if assert.Error(err) {
+			assert.Contains(err.Error(), "Invalid helm template")
+		}
+	})
+
+	t.Run("UndefinedVariable", func(t *testing.T) {
+		root := NewMapping("foo", Template("$undefined"))
+		assert.Error(Validate(root))
+	})
+
+	t.Run("EncoderValidation", func(t *testing.T) {
+		root := NewMapping("foo", NewNode(1, Block("end")))
+		buffer := &bytes.Buffer{}
+		assert.NoError(NewEncoder(buffer).Encode(root), "Validation should be off by default")
+
+		buffer.Reset()
+		assert.Error(NewEncoder(buffer, Validation(true)).Encode(root))
+		assert.Empty(buffer.String(), "Nothing should be written for an invalid document")
+	})
+}
+
+func TestHelmRewriteTemplates(t *testing.T) {
+	t.Parallel()
+
+	root := NewMapping(
+		"{{ .Values.key }}", NewNode(Template(".Values.value"), If(".Values.enabled"), Comment("See .Values.comment")),
+		"list", NewList(".Values.literal", 1))
+	RewriteTemplates(root, func(text string) string {
+		return strings.Replace(text, ".Values.", ".Values.global.", -1)
+	})
+
+	buffer := &bytes.Buffer{}
+	require.NoError(t, NewEncoder(buffer).Encode(root))
+	assert.Equal(t, `---
+
+# See .Values.global.comment
+{{- if .Values.global.enabled }}
+{{ .Values.global.key }}: {{ .Values.global.value }}
+{{- end }}
+
+list:
+- ".Values.global.literal"
+- 1
+`, buffer.String())
+}
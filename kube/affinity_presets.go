@@ -0,0 +1,63 @@
+package kube
+
+import (
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
+)
+
+// DedicatedNodeKey is the key of the node label selecting, and of the node
+// taint reserving, the nodes of instance groups with the dedicate-node
+// affinity preset; the value is the name of the instance group.
+const DedicatedNodeKey = "fissile.cloudfoundry.org/dedicated"
+
+// presetAffinityTopologyKey is the topology the spread and pack presets
+// distribute the pods over
+const presetAffinityTopologyKey = "kubernetes.io/hostname"
+
+// presetAffinity returns the kind and rules of the affinity the preset of the
+// instance group expands to, or the empty string and nil without a preset.
+// The rules of the spread and pack presets are preferences, so that pods can
+// still be scheduled on clusters with too few nodes.
+func presetAffinity(instanceGroup *model.InstanceGroup) (string, helm.Node) {
+	if instanceGroup.Run == nil {
+		return "", nil
+	}
+	name := kubeName(instanceGroup.Name)
+
+	podAffinityTerm := func() helm.Node {
+		expression := helm.NewMapping("key", RoleNameLabel, "operator", "In", "values", helm.NewList(name))
+		return helm.NewMapping(
+			"preferredDuringSchedulingIgnoredDuringExecution", helm.NewList(helm.NewMapping(
+				"weight", 100,
+				"podAffinityTerm", helm.NewMapping(
+					"labelSelector", helm.NewMapping("matchExpressions", helm.NewList(expression)),
+					"topologyKey", presetAffinityTopologyKey))))
+	}
+
+	switch instanceGroup.Run.AffinityPreset {
+	case model.AffinityPresetSpread:
+		return "podAntiAffinity", podAffinityTerm()
+	case model.AffinityPresetPack:
+		return "podAffinity", podAffinityTerm()
+	case model.AffinityPresetDedicateNode:
+		expression := helm.NewMapping("key", DedicatedNodeKey, "operator", "In", "values", helm.NewList(name))
+		return "nodeAffinity", helm.NewMapping(
+			"requiredDuringSchedulingIgnoredDuringExecution", helm.NewMapping(
+				"nodeSelectorTerms", helm.NewList(helm.NewMapping(
+					"matchExpressions", helm.NewList(expression)))))
+	}
+	return "", nil
+}
+
+// presetTolerations returns the tolerations the preset of the instance group
+// expands to, or nil if it needs none
+func presetTolerations(instanceGroup *model.InstanceGroup) helm.Node {
+	if instanceGroup.Run == nil || instanceGroup.Run.AffinityPreset != model.AffinityPresetDedicateNode {
+		return nil
+	}
+	return helm.NewList(helm.NewMapping(
+		"key", DedicatedNodeKey,
+		"operator", "Equal",
+		"value", kubeName(instanceGroup.Name),
+		"effect", "NoSchedule"))
+}
@@ -1,23 +1,39 @@
 package kube
 
 import (
+	"bytes"
+	b64 "encoding/base64"
 	"fmt"
 
 	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
 )
 
+// deploymentManifestSecretName returns the name of the secret holding the
+// deployment manifest; see immutableConfigName
+func deploymentManifestSecretName(settings ExportSettings) string {
+	return immutableConfigName("deployment-manifest", settings, ".Values.bosh")
+}
+
 // MakeBoshDeploymentManifestSecret generates a template for a secret that holds the content of a BOSH deployment manifest
 func MakeBoshDeploymentManifestSecret(settings ExportSettings) (helm.Node, error) {
 	value := ""
 	if settings.CreateHelmChart {
 		value = "{{ .Values.bosh | toYaml | b64enc }}"
+	} else if settings.DeploymentManifest {
+		var manifest bytes.Buffer
+		err := helm.NewEncoder(&manifest).Encode(MakeDeploymentManifest(settings.RoleManifest))
+		if err != nil {
+			return nil, err
+		}
+		value = b64.StdEncoding.EncodeToString(manifest.Bytes())
 	}
 
 	cb := NewConfigBuilder().
 		SetSettings(&settings).
 		SetAPIVersion("v1").
 		SetKind("Secret").
-		SetName("deployment-manifest")
+		setConfigName(deploymentManifestSecretName(settings))
 	secret, err := cb.Build()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build a new kube config: %v", err)
@@ -25,7 +41,29 @@ func MakeBoshDeploymentManifestSecret(settings ExportSettings) (helm.Node, error
 
 	data := helm.NewMapping("deployment-manifest", value)
 	secret.Add("data", data)
+	addImmutable(secret, settings)
 	secret.Add("type", "Opaque")
 
 	return secret, nil
 }
+
+// MakeDeploymentManifest generates the BOSH deployment manifest mounted into
+// the pods from the role manifest: the instance groups with their jobs and the
+// job properties set in the role manifest.  Property values referring to
+// variables keep their ((NAME)) placeholders, so that no secret values end up
+// in the manifest.
+func MakeDeploymentManifest(roleManifest *model.RoleManifest) *helm.Mapping {
+	instanceGroups := helm.NewList()
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		jobs := helm.NewList()
+		for _, job := range instanceGroup.JobReferences {
+			jobNode := helm.NewMapping("name", job.Name, "release", job.ReleaseName)
+			if len(job.ContainerProperties.Properties) > 0 {
+				jobNode.Add("properties", job.ContainerProperties.Properties)
+			}
+			jobs.Add(jobNode)
+		}
+		instanceGroups.Add(helm.NewMapping("name", instanceGroup.Name, "jobs", jobs))
+	}
+	return helm.NewMapping("instance_groups", instanceGroups)
+}
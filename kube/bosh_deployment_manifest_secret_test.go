@@ -4,8 +4,11 @@ import (
 	b64 "encoding/base64"
 	"testing"
 
+	"code.cloudfoundry.org/fissile/model"
 	"code.cloudfoundry.org/fissile/testhelpers"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func TestMakeBoshDeploymentManifestSecretKube(t *testing.T) {
@@ -75,3 +78,96 @@ func TestMakeBoshDeploymentManifestSecretHelm(t *testing.T) {
 	type: "Opaque"
 	`, actual)
 }
+
+func TestMakeBoshDeploymentManifestSecretGenerated(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "deployment-manifest.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	expected := `---
+		instance_groups:
+		-	name: myrole
+			jobs:
+			-	name: tor
+				release: tor
+				properties:
+					tor:
+						hostname: example.onion
+						private_key: ((PRIVATE_KEY))
+	`
+
+	t.Run("Kube", func(t *testing.T) {
+		t.Parallel()
+		manifestSecret, err := MakeBoshDeploymentManifestSecret(ExportSettings{
+			RoleManifest:       manifest,
+			DeploymentManifest: true,
+		})
+		require.NoError(t, err)
+
+		actual, err := RoundtripKube(manifestSecret)
+		require.NoError(t, err)
+		data := actual.(map[interface{}]interface{})["data"].(map[interface{}]interface{})
+		payload, err := b64.StdEncoding.DecodeString(data["deployment-manifest"].(string))
+		require.NoError(t, err)
+		var deploymentManifest interface{}
+		require.NoError(t, yaml.Unmarshal(payload, &deploymentManifest))
+		testhelpers.IsYAMLEqualString(assert, expected, deploymentManifest)
+	})
+
+	t.Run("Helm", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{
+			RoleManifest:       manifest,
+			CreateHelmChart:    true,
+			DeploymentManifest: true,
+		}
+		manifestSecret, err := MakeBoshDeploymentManifestSecret(settings)
+		require.NoError(t, err)
+
+		renderer, err := newTestRenderer(MakeValues(settings))
+		require.NoError(t, err)
+		actual, err := renderer.RoundtripNode(manifestSecret, nil)
+		require.NoError(t, err)
+		data := actual.(map[interface{}]interface{})["data"].(map[interface{}]interface{})
+		payload, err := b64.StdEncoding.DecodeString(data["deployment-manifest"].(string))
+		require.NoError(t, err)
+		var deploymentManifest interface{}
+		require.NoError(t, yaml.Unmarshal(payload, &deploymentManifest))
+		testhelpers.IsYAMLEqualString(assert, expected, deploymentManifest)
+	})
+}
+
+func TestMakeBoshDeploymentManifestSecretHelmImmutableConfig(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	settings := ExportSettings{CreateHelmChart: true, ImmutableConfig: true}
+	manifestSecret, err := MakeBoshDeploymentManifestSecret(settings)
+	require.NoError(t, err)
+	mount := getNonClaimVolumes(&model.InstanceGroup{Run: &model.RoleRun{}}, settings)
+
+	render := func(config map[string]interface{}) (string, string) {
+		actual, err := RoundtripNode(manifestSecret, config)
+		require.NoError(t, err)
+		secret := actual.(map[interface{}]interface{})
+		assert.Equal(true, secret["immutable"])
+		name := secret["metadata"].(map[interface{}]interface{})["name"].(string)
+
+		actual, err = RoundtripNode(mount, config)
+		require.NoError(t, err)
+		volumes := actual.([]interface{})
+		volume := volumes[len(volumes)-1].(map[interface{}]interface{})
+		return name, volume["secret"].(map[interface{}]interface{})["secretName"].(string)
+	}
+
+	name, secretName := render(nil)
+	assert.Regexp(`^deployment-manifest-[0-9a-f]{8}$`, name)
+	assert.Equal(name, secretName, "The pods mount the secret by its hashed name")
+
+	changedName, _ := render(map[string]interface{}{"Values.bosh.foo": "bar"})
+	assert.NotEqual(name, changedName, "A changed deployment manifest renames the secret")
+}
@@ -29,12 +29,14 @@ func NewDeployment(instanceGroup *model.InstanceGroup, settings ExportSettings,
 		SetConditionalAPIVersion("apps/v1", "extensions/v1beta1").
 		SetKind("Deployment").
 		SetName(instanceGroup.Name).
+		SetInstanceGroup(instanceGroup).
 		AddModifier(helm.Comment(instanceGroup.GetLongDescription()))
 	deployment, err := cb.Build()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to build a new kube config: %v", err)
 	}
 	deployment.Add("spec", spec)
+	addReloaderAnnotations(deployment, podTemplate, settings)
 	addFeatureCheck(instanceGroup, deployment, svc)
 	err = replicaCheck(instanceGroup, deployment, settings)
 	if err != nil {
@@ -44,18 +46,34 @@ func NewDeployment(instanceGroup *model.InstanceGroup, settings ExportSettings,
 	return deployment, svc, err
 }
 
-// getAffinityBlock returns an affinity block to add to a podspec
+// getAffinityBlock returns an affinity block to add to a podspec.  The pod
+// anti affinity, and the node affinity of the dedicate-node preset, are left
+// out in development mode, so all pods fit on a single node.
 func getAffinityBlock(instanceGroup *model.InstanceGroup) *helm.Mapping {
 	affinity := helm.NewMapping()
+	devMode := helm.Block("if not .Values.config.dev_mode")
 
 	if instanceGroup.Run != nil && instanceGroup.Run.Affinity != nil && instanceGroup.Run.Affinity.PodAntiAffinity != nil {
 		// Add pod anti affinity from role manifest
-		affinity.Add("podAntiAffinity", instanceGroup.Run.Affinity.PodAntiAffinity)
+		affinity.Add("podAntiAffinity", instanceGroup.Run.Affinity.PodAntiAffinity, devMode)
+	}
+
+	// Add pod (anti) affinity from the affinity preset; the node affinity of
+	// presets is the default of the values
+	if kind, rules := presetAffinity(instanceGroup); rules != nil && kind != "nodeAffinity" {
+		if kind == "podAntiAffinity" {
+			affinity.Add(kind, rules, devMode)
+		} else {
+			affinity.Add(kind, rules)
+		}
 	}
 
 	// Add node affinity template to be filled in by values.yaml
 	roleName := makeVarName(instanceGroup.Name)
 	nodeCond := fmt.Sprintf("if .Values.sizing.%s.affinity.nodeAffinity", roleName)
+	if kind, _ := presetAffinity(instanceGroup); kind == "nodeAffinity" {
+		nodeCond = fmt.Sprintf("if and .Values.sizing.%s.affinity.nodeAffinity (not .Values.config.dev_mode)", roleName)
+	}
 	nodeAffinity := fmt.Sprintf("{{ toJson .Values.sizing.%s.affinity.nodeAffinity }}", roleName)
 	affinity.Add("nodeAffinity", nodeAffinity, helm.Block(nodeCond))
 
@@ -74,12 +92,20 @@ func addAffinityRules(instanceGroup *model.InstanceGroup, spec *helm.Mapping, se
 		}
 	}
 
+	podSpec := spec.Get("template", "spec").(*helm.Mapping)
 	if settings.CreateHelmChart {
-		podSpec := spec.Get("template", "spec").(*helm.Mapping)
-
 		podSpec.Add("affinity", getAffinityBlock(instanceGroup))
-		podSpec.Sort()
+	} else if kind, rules := presetAffinity(instanceGroup); rules != nil {
+		podSpec.Add("affinity", helm.NewMapping(kind, rules))
+	}
+	if tolerations := presetTolerations(instanceGroup); tolerations != nil {
+		if settings.CreateHelmChart {
+			podSpec.Add("tolerations", tolerations, helm.Block("if not .Values.config.dev_mode"))
+		} else {
+			podSpec.Add("tolerations", tolerations)
+		}
 	}
+	podSpec.Sort()
 
 	meta := spec.Get("template", "metadata").(*helm.Mapping)
 	if meta.Get("annotations") == nil {
@@ -163,20 +189,50 @@ func addFeatureCheck(instanceGroup *model.InstanceGroup, nodes ...helm.Node) {
 
 }
 
-func notNil(variable string) string {
-	return fmt.Sprintf(`(ne (typeOf %s) "<nil>")`, variable)
+// jobFeatureCondition returns the template expression that is true when a job
+// with an if_feature or unless_feature is included, or the empty string if
+// the job is always included.
+func jobFeatureCondition(job *model.JobReference) string {
+	feature, enabled := job.FeatureCondition()
+	if feature == "" {
+		return ""
+	}
+	if enabled {
+		return fmt.Sprintf(".Values.enable.%s", feature)
+	}
+	return fmt.Sprintf("(not .Values.enable.%s)", feature)
+}
+
+// addJobFeatureCheck adds a conditional if a job is dependent on a feature
+// flag, such that the nodes will only be included when the job is.
+func addJobFeatureCheck(job *model.JobReference, nodes ...helm.Node) {
+	condition := jobFeatureCondition(job)
+	if condition == "" {
+		return
+	}
+	for _, node := range nodes {
+		if node != nil {
+			node.Set(helm.Block("if " + condition))
+		}
+	}
 }
 
+// replicaCount returns the template rendering the number of replicas of the
+// instance group, optionally as a quoted string.
 func replicaCount(instanceGroup *model.InstanceGroup, quoted bool) string {
-	quote := ""
-	if quoted {
-		quote = " | quote"
-	}
-	count := fmt.Sprintf(".Values.sizing.%s.count", makeVarName(instanceGroup.Name))
-	return fmt.Sprintf(`{{ if %s }}{{ %s%s }}{{ else }}`+
-		`{{ if .Values.config.HA }}{{ %d%s }}{{ else }}{{ %d%s }}{{ end }}{{ end }}`,
-		notNil(count), count, quote,
-		instanceGroup.Run.Scaling.HA, quote, instanceGroup.Run.Scaling.Min, quote)
+	return fmt.Sprintf(`{{ template "fissile.ReplicaCount" (dict "count" .Values.sizing.%s.count `+
+		`"config" .Values.config "min" %d "ha" %d "quote" %t) }}`,
+		makeVarName(instanceGroup.Name), instanceGroup.Run.Scaling.Min, instanceGroup.Run.Scaling.HA, quoted)
+}
+
+// replicaCountCheck returns the template validating the configured number of
+// replicas of the instance group against its scaling limits.
+func replicaCountCheck(instanceGroup *model.InstanceGroup) string {
+	roleName := makeVarName(instanceGroup.Name)
+	return fmt.Sprintf(`{{ template "fissile.CheckReplicaCount" (dict "name" %q "count" .Values.sizing.%s.count `+
+		`"config" .Values.config "min" %d "max" %d "ha" %d "odd" %t) }}`,
+		roleName, roleName, instanceGroup.Run.Scaling.Min, instanceGroup.Run.Scaling.Max,
+		instanceGroup.Run.Scaling.HA, instanceGroup.Run.Scaling.MustBeOdd)
 }
 
 // replicaCheck adds various guards to validate the number of replicas
@@ -196,36 +252,8 @@ func replicaCheck(instanceGroup *model.InstanceGroup, controller *helm.Mapping,
 		return nil
 	}
 
-	spec.Add("replicas", replicaCount(instanceGroup, false))
+	spec.Add("replicas", replicaCountCheck(instanceGroup)+replicaCount(instanceGroup, false))
 	spec.Sort()
 
-	roleName := makeVarName(instanceGroup.Name)
-	count := fmt.Sprintf(".Values.sizing.%s.count", roleName)
-
-	// min replica check
-	fail := fmt.Sprintf(`{{ fail "%s must have at least %d instances" }}`, roleName, instanceGroup.Run.Scaling.Min)
-	block := fmt.Sprintf("if and %s (lt (int %s) %d)", notNil(count), count, instanceGroup.Run.Scaling.Min)
-	controller.Add("_minReplicas", fail, helm.Block(block))
-
-	// min HA replica check
-	fail = fmt.Sprintf(`{{ fail "%s must have at least %d instances for HA" }}`, roleName, instanceGroup.Run.Scaling.HA)
-	block = fmt.Sprintf("if and .Values.config.HA .Values.config.HA_strict %s (lt (int %s) %d)",
-		notNil(count), count, instanceGroup.Run.Scaling.HA)
-	controller.Add("_minHAReplicas", fail, helm.Block(block))
-
-	// max replica check
-	fail = fmt.Sprintf(`{{ fail "%s cannot have more than %d instances" }}`, roleName, instanceGroup.Run.Scaling.Max)
-	block = fmt.Sprintf("if and %s (gt (int %s) %d)", notNil(count), count, instanceGroup.Run.Scaling.Max)
-	controller.Add("_maxReplicas", fail, helm.Block(block))
-
-	// odd replica check
-	if instanceGroup.Run.Scaling.MustBeOdd {
-		fail := fmt.Sprintf(`{{ fail "%s must have an odd instance count" }}`, roleName)
-		block := fmt.Sprintf("if and %s (eq (mod (int %s) 2) 0)", notNil(count), count)
-		controller.Add("_oddReplicas", fail, helm.Block(block))
-	}
-
-	controller.Sort()
-
 	return nil
 }
@@ -0,0 +1,130 @@
+package kube
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/builder"
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/util"
+)
+
+// DeploymentInfoName is the name of the ConfigMap describing the deployment
+const DeploymentInfoName = "deployment-info"
+
+// deploymentInfoInstanceGroup is the description of an instance group in the
+// deployment info, see MakeDeploymentInfo
+type deploymentInfoInstanceGroup struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Image    string `json:"image"`
+	Replicas int    `json:"replicas"`
+	Min      int    `json:"min"`
+	Max      int    `json:"max"`
+}
+
+// MakeDeploymentInfo generates a ConfigMap describing the deployment, for
+// tooling running in the cluster and for support bundles.  It holds the
+// versions of the chart and of fissile, the SHA256 of the role manifest, the
+// feature flags, and the images and replica counts of the instance groups.
+// The feature flags and instance groups are JSON documents; in helm charts
+// they reflect the values the chart is rendered with.
+func MakeDeploymentInfo(settings ExportSettings, grapher util.ModelGrapher) (helm.Node, error) {
+	manifest := settings.RoleManifest
+	hash := sha256.Sum256(manifest.ManifestContent)
+
+	data := helm.NewMapping()
+	if settings.CreateHelmChart {
+		data.Add("chart-name", "{{ .Chart.Name | quote }}")
+		data.Add("chart-version", "{{ .Chart.Version | quote }}")
+	}
+	data.Add("fissile-version", settings.FissileVersion)
+	data.Add("role-manifest-sha256", hex.EncodeToString(hash[:]))
+
+	var features []string
+	for name := range manifest.Features {
+		features = append(features, name)
+	}
+	sort.Strings(features)
+
+	if settings.CreateHelmChart {
+		var pairs []string
+		for _, name := range features {
+			pairs = append(pairs, fmt.Sprintf("%q .Values.enable.%s", name, name))
+		}
+		data.Add("features.json", fmt.Sprintf("{{ dict %s | toJson | quote }}", strings.Join(pairs, " ")))
+	} else {
+		buf, err := json.Marshal(manifest.Features)
+		if err != nil {
+			return nil, err
+		}
+		data.Add("features.json", string(buf))
+	}
+
+	var instanceGroups []deploymentInfoInstanceGroup
+	for _, instanceGroup := range manifest.InstanceGroups {
+		devVersion, err := instanceGroup.GetRoleDevVersion(settings.Opinions, settings.TagExtra, settings.FissileVersion, settings.ImageOptions, grapher)
+		if err != nil {
+			return nil, err
+		}
+		info := deploymentInfoInstanceGroup{
+			Name:     instanceGroup.Name,
+			Type:     string(instanceGroup.Type),
+			Replicas: instanceGroup.Run.Scaling.Min,
+			Min:      instanceGroup.Run.Scaling.Min,
+			Max:      instanceGroup.Run.Scaling.Max,
+		}
+		if settings.CreateHelmChart {
+			info.Image = builder.GetRoleDevImageName("", "", settings.Repository, instanceGroup, devVersion)
+		} else {
+			imageName, err := getContainerImageName(instanceGroup, settings, grapher)
+			if err != nil {
+				return nil, err
+			}
+			info.Image = imageName
+		}
+		instanceGroups = append(instanceGroups, info)
+	}
+
+	if settings.CreateHelmChart {
+		// The images and replica counts depend on the values, so the document
+		// is built by the template, using fissile.ImageName and
+		// fissile.ReplicaCount
+		var dicts []string
+		for _, info := range instanceGroups {
+			image := fmt.Sprintf(`(include "fissile.ImageName" (dict "kube" .Values.kube "image" %q))`, info.Image)
+			replicas := fmt.Sprintf("%d", info.Replicas)
+			instanceGroup := manifest.LookupInstanceGroup(info.Name)
+			if !instanceGroup.IsColocated() {
+				replicas = fmt.Sprintf(`(int (include "fissile.ReplicaCount" (dict "count" .Values.sizing.%s.count "config" .Values.config "min" %d "ha" %d "quote" false)))`,
+					makeVarName(info.Name), instanceGroup.Run.Scaling.Min, instanceGroup.Run.Scaling.HA)
+			}
+			dicts = append(dicts, fmt.Sprintf(`(dict "name" %q "type" %q "image" %s "replicas" %s "min" %d "max" %d)`,
+				info.Name, info.Type, image, replicas, info.Min, info.Max))
+		}
+		data.Add("instance-groups.json", fmt.Sprintf("{{ list %s | toJson | quote }}", strings.Join(dicts, " ")))
+	} else {
+		buf, err := json.Marshal(instanceGroups)
+		if err != nil {
+			return nil, err
+		}
+		data.Add("instance-groups.json", string(buf))
+	}
+
+	cb := NewConfigBuilder().
+		SetSettings(&settings).
+		SetAPIVersion("v1").
+		SetKind("ConfigMap").
+		SetName(DeploymentInfoName)
+	configMap, err := cb.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build a new kube config: %v", err)
+	}
+	configMap.Add("data", data)
+
+	return configMap.Sort(), nil
+}
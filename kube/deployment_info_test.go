@@ -0,0 +1,102 @@
+package kube
+
+import (
+	"encoding/json"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeDeploymentInfoKube(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "job-features.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	configMap, err := MakeDeploymentInfo(ExportSettings{
+		RoleManifest:   manifest,
+		FissileVersion: "7.0.0",
+		Registry:       "example.com",
+		Organization:   "org",
+		Repository:     "repo",
+	}, nil)
+	require.NoError(t, err)
+
+	actual, err := RoundtripKube(configMap)
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		apiVersion: v1
+		kind: ConfigMap
+		metadata:
+			name: deployment-info
+		data:
+			fissile-version: "7.0.0"
+			features.json: '{"hostname":false}'
+	`, actual)
+
+	data := actual.(map[interface{}]interface{})["data"].(map[interface{}]interface{})
+	assert.Len(data["role-manifest-sha256"], 64)
+	assert.NotContains(data, "chart-version")
+
+	var instanceGroups []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(data["instance-groups.json"].(string)), &instanceGroups))
+	require.Len(t, instanceGroups, 1)
+	assert.Equal("myrole", instanceGroups[0]["name"])
+	assert.Equal("bosh", instanceGroups[0]["type"])
+	assert.Regexp("^example.com/org/repo-myrole:", instanceGroups[0]["image"])
+	assert.Equal(1.0, instanceGroups[0]["replicas"])
+}
+
+func TestMakeDeploymentInfoHelm(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "job-features.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	configMap, err := MakeDeploymentInfo(ExportSettings{
+		RoleManifest:    manifest,
+		CreateHelmChart: true,
+		Repository:      "repo",
+	}, nil)
+	require.NoError(t, err)
+
+	actual, err := RoundtripNode(configMap, map[string]interface{}{
+		"Values.enable.hostname":        true,
+		"Values.kube.registry.hostname": "example.com",
+		"Values.kube.organization":      "org",
+		"Values.sizing.myrole.count":    3,
+	})
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		data:
+			chart-version: "42.1+foo"
+			features.json: '{"hostname":true}'
+	`, actual)
+
+	data := actual.(map[interface{}]interface{})["data"].(map[interface{}]interface{})
+	var instanceGroups []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(data["instance-groups.json"].(string)), &instanceGroups))
+	require.Len(t, instanceGroups, 1)
+	assert.Regexp("^example.com/org/repo-myrole:", instanceGroups[0]["image"])
+	assert.Equal(3.0, instanceGroups[0]["replicas"])
+	assert.Equal(1.0, instanceGroups[0]["min"])
+
+	// Without a configured count, the minimum is used
+	actual, err = RoundtripNode(configMap, map[string]interface{}{
+		"Values.enable.hostname":     true,
+		"Values.sizing.myrole.count": nil,
+	})
+	require.NoError(t, err)
+	data = actual.(map[interface{}]interface{})["data"].(map[interface{}]interface{})
+	require.NoError(t, json.Unmarshal([]byte(data["instance-groups.json"].(string)), &instanceGroups))
+	require.Len(t, instanceGroups, 1)
+	assert.Equal(1.0, instanceGroups[0]["replicas"])
+}
@@ -115,7 +115,7 @@ func TestNewDeploymentHelm(t *testing.T) {
 		}
 		_, err := RenderNode(deployment, config)
 		assert.EqualError(err,
-			`template: :15:17: executing "" at <fail "some_group must have at least 1 instances">: error calling fail: some_group must have at least 1 instances`)
+			`template: :51:135: executing "fissile.CheckReplicaCount" at <fail (printf "%s must have at least %d instances" .name .min)>: error calling fail: some_group must have at least 1 instances`)
 	})
 
 	t.Run("Configured, not enough replicas for HA", func(t *testing.T) {
@@ -131,7 +131,7 @@ func TestNewDeploymentHelm(t *testing.T) {
 		}
 		_, err := RenderNode(deployment, config)
 		assert.EqualError(err,
-			`template: :11:19: executing "" at <fail "some_group must have at least 2 instances for HA">: error calling fail: some_group must have at least 2 instances for HA`)
+			`template: :51:328: executing "fissile.CheckReplicaCount" at <fail (printf "%s must have at least %d instances for HA" .name .ha)>: error calling fail: some_group must have at least 2 instances for HA`)
 	})
 
 	t.Run("Configured, too many replicas", func(t *testing.T) {
@@ -145,7 +145,7 @@ func TestNewDeploymentHelm(t *testing.T) {
 		}
 		_, err := RenderNode(deployment, config)
 		assert.EqualError(err,
-			`template: :7:17: executing "" at <fail "some_group cannot have more than 3 instances">: error calling fail: some_group cannot have more than 3 instances`)
+			`template: :51:470: executing "fissile.CheckReplicaCount" at <fail (printf "%s cannot have more than %d instances" .name .max)>: error calling fail: some_group cannot have more than 3 instances`)
 	})
 
 	t.Run("Configured, bad key sizing.HA", func(t *testing.T) {
@@ -156,7 +156,7 @@ func TestNewDeploymentHelm(t *testing.T) {
 		}
 		_, err := RenderNode(deployment, config)
 		assert.EqualError(err,
-			`template: :19:21: executing "" at <fail "Bad use of moved variable sizing.HA. The new name to use is config.HA">: error calling fail: Bad use of moved variable sizing.HA. The new name to use is config.HA`)
+			`template: :7:21: executing "" at <fail "Bad use of moved variable sizing.HA. The new name to use is config.HA">: error calling fail: Bad use of moved variable sizing.HA. The new name to use is config.HA`)
 	})
 
 	t.Run("Configured, bad key sizing.memory.limits", func(t *testing.T) {
@@ -167,7 +167,7 @@ func TestNewDeploymentHelm(t *testing.T) {
 		}
 		_, err := RenderNode(deployment, config)
 		assert.EqualError(err,
-			`template: :31:70: executing "" at <fail "Bad use of moved variable sizing.memory.limits. The new name to use is config.memory.limits">: error calling fail: Bad use of moved variable sizing.memory.limits. The new name to use is config.memory.limits`)
+			`template: :19:70: executing "" at <fail "Bad use of moved variable sizing.memory.limits. The new name to use is config.memory.limits">: error calling fail: Bad use of moved variable sizing.memory.limits. The new name to use is config.memory.limits`)
 	})
 
 	t.Run("Configured, bad key sizing.memory.requests", func(t *testing.T) {
@@ -178,7 +178,7 @@ func TestNewDeploymentHelm(t *testing.T) {
 		}
 		_, err := RenderNode(deployment, config)
 		assert.EqualError(err,
-			`template: :35:74: executing "" at <fail "Bad use of moved variable sizing.memory.requests. The new name to use is config.memory.requests">: error calling fail: Bad use of moved variable sizing.memory.requests. The new name to use is config.memory.requests`)
+			`template: :23:74: executing "" at <fail "Bad use of moved variable sizing.memory.requests. The new name to use is config.memory.requests">: error calling fail: Bad use of moved variable sizing.memory.requests. The new name to use is config.memory.requests`)
 	})
 
 	t.Run("Configured, bad key sizing.cpu.limits", func(t *testing.T) {
@@ -189,7 +189,7 @@ func TestNewDeploymentHelm(t *testing.T) {
 		}
 		_, err := RenderNode(deployment, config)
 		assert.EqualError(err,
-			`template: :23:64: executing "" at <fail "Bad use of moved variable sizing.cpu.limits. The new name to use is config.cpu.limits">: error calling fail: Bad use of moved variable sizing.cpu.limits. The new name to use is config.cpu.limits`)
+			`template: :11:64: executing "" at <fail "Bad use of moved variable sizing.cpu.limits. The new name to use is config.cpu.limits">: error calling fail: Bad use of moved variable sizing.cpu.limits. The new name to use is config.cpu.limits`)
 	})
 
 	t.Run("Configured, bad key sizing.cpu.requests", func(t *testing.T) {
@@ -200,7 +200,7 @@ func TestNewDeploymentHelm(t *testing.T) {
 		}
 		_, err := RenderNode(deployment, config)
 		assert.EqualError(err,
-			`template: :27:68: executing "" at <fail "Bad use of moved variable sizing.cpu.requests. The new name to use is config.cpu.requests">: error calling fail: Bad use of moved variable sizing.cpu.requests. The new name to use is config.cpu.requests`)
+			`template: :15:68: executing "" at <fail "Bad use of moved variable sizing.cpu.requests. The new name to use is config.cpu.requests">: error calling fail: Bad use of moved variable sizing.cpu.requests. The new name to use is config.cpu.requests`)
 	})
 
 	t.Run("Configured", func(t *testing.T) {
@@ -253,7 +253,8 @@ func TestNewDeploymentHelm(t *testing.T) {
 							skiff-role-name: "some-group"
 							version: 1.22.333.4444
 						annotations:
-							checksum/config: 08c80ed11902eefef09739d41c91408238bb8b5e7be7cc1e5db933b7c8de65c3
+							checksum/config: 3f3c8fdbee612f6612c297efc42564296c0f46924715a5bbd7bbb6d9473d4fbf
+							jobs.fissile.cloudfoundry.org/some-group: tor
 							sidecar.istio.io/inject: "false"
 					spec:
 						affinity:
@@ -285,7 +286,7 @@ func TestNewDeploymentHelm(t *testing.T) {
 								value: "2048"
 							-	name: "VCAP_SOFT_NPROC"
 								value: "1024"
-							image: "docker.suse.fake/splat/the_repos-some-group:3b960ef56f837ae186cdd546d03750cca62676bc"
+							image: "docker.suse.fake/splat/the_repos-some-group:d98d13856384144cf77994404104bd90fd4f5a00"
 							lifecycle:
 								preStop:
 									exec:
@@ -394,7 +395,8 @@ func TestNewDeploymentIstioManagedHelm(t *testing.T) {
 							skiff-role-name: "istio-managed-group"
 							version: 1.22.333.4444
 						annotations:
-							checksum/config: 08c80ed11902eefef09739d41c91408238bb8b5e7be7cc1e5db933b7c8de65c3
+							checksum/config: 182b4e7525f368729ee58958791ae679693d6362e26b478165283efc7e4d285c
+							jobs.fissile.cloudfoundry.org/istio-managed-group: tor
 					spec:
 						affinity:
 							podAntiAffinity:
@@ -425,7 +427,7 @@ func TestNewDeploymentIstioManagedHelm(t *testing.T) {
 								value: "2048"
 							-	name: "VCAP_SOFT_NPROC"
 								value: "1024"
-							image: "docker.suse.fake/splat/the_repos-istio-managed-group:3b960ef56f837ae186cdd546d03750cca62676bc"
+							image: "docker.suse.fake/splat/the_repos-istio-managed-group:d98d13856384144cf77994404104bd90fd4f5a00"
 							lifecycle:
 								preStop:
 									exec:
@@ -460,6 +462,64 @@ func TestNewDeploymentIstioManagedHelm(t *testing.T) {
 	})
 }
 
+func TestNewDeploymentMetadataHelm(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	instanceGroup := deploymentTestLoad(assert, "some-group", "pod-with-valid-pod-anti-affinity.yml")
+	if instanceGroup == nil {
+		return
+	}
+	instanceGroup.Configuration.Metadata = model.ConfigurationMetadata{
+		Kinds: map[string]model.ObjectMetadata{
+			"Pod": {Annotations: map[string]string{"prometheus.io/scrape": "true"}},
+		},
+	}
+
+	settings := ExportSettings{
+		CreateHelmChart: true,
+		Repository:      "the_repos",
+		RoleManifest: &model.RoleManifest{
+			Configuration: &model.Configuration{
+				Metadata: model.ConfigurationMetadata{
+					ObjectMetadata: model.ObjectMetadata{
+						Labels: map[string]string{"cost-center": "1234"},
+					},
+				},
+			},
+		},
+	}
+
+	deployment, _, err := NewDeployment(instanceGroup, settings, nil)
+	if !assert.NoError(err) {
+		return
+	}
+
+	config := map[string]interface{}{
+		"Values.sizing.some_group.count":                 "1",
+		"Values.sizing.some_group.affinity.nodeAffinity": "snafu",
+	}
+	actual, err := RoundtripNode(deployment, config)
+	if !assert.NoError(err) {
+		return
+	}
+	testhelpers.IsYAMLSubsetString(assert, `---
+		metadata:
+			labels:
+				cost-center: "1234"
+		spec:
+			template:
+				metadata:
+					labels:
+						cost-center: "1234"
+					annotations:
+						checksum/config: 3f3c8fdbee612f6612c297efc42564296c0f46924715a5bbd7bbb6d9473d4fbf
+						prometheus.io/scrape: "true"
+	`, actual)
+	assert.Nil(deployment.Get("metadata", "annotations", "prometheus.io/scrape"), "Pod annotations are only added to the pod template")
+	assert.Nil(deployment.Get("metadata", "annotations", "checksum/config"), "Pod annotations are only added to the pod template")
+}
+
 func TestGetAffinityBlock(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -591,6 +651,128 @@ func TestAddAffinityRules(t *testing.T) {
 	assert.NoError(err)
 }
 
+func TestAddAffinityRulesPresets(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	instanceGroup := deploymentTestLoad(assert, "spread-group", "affinity-presets.yml")
+	if instanceGroup == nil {
+		return
+	}
+	spec := createEmptySpec()
+	if !assert.NoError(addAffinityRules(instanceGroup, spec, ExportSettings{CreateHelmChart: true})) {
+		return
+	}
+	actual, err := RoundtripNode(spec, map[string]interface{}{
+		"Values.sizing.spread_group.affinity.nodeAffinity": "snafu",
+	})
+	if !assert.NoError(err) {
+		return
+	}
+	testhelpers.IsYAMLEqualString(assert, `---
+		template:
+			metadata:
+				annotations: {}
+			spec:
+				affinity:
+					podAntiAffinity:
+						preferredDuringSchedulingIgnoredDuringExecution:
+						-	weight: 100
+							podAffinityTerm:
+								labelSelector:
+									matchExpressions:
+									-	key: app.kubernetes.io/component
+										operator: In
+										values: [spread-group]
+								topologyKey: kubernetes.io/hostname
+					nodeAffinity: snafu
+	`, actual)
+
+	instanceGroup = deploymentTestLoad(assert, "pack-group", "affinity-presets.yml")
+	if instanceGroup == nil {
+		return
+	}
+	spec = createEmptySpec()
+	if !assert.NoError(addAffinityRules(instanceGroup, spec, ExportSettings{})) {
+		return
+	}
+	assert.Nil(spec.Get("template", "spec", "affinity", "podAntiAffinity"))
+	assert.NotNil(spec.Get("template", "spec", "affinity", "podAffinity"), "Presets apply without a helm chart")
+	assert.Nil(spec.Get("template", "spec", "tolerations"))
+
+	instanceGroup = deploymentTestLoad(assert, "dedicated-group", "affinity-presets.yml")
+	if instanceGroup == nil {
+		return
+	}
+	spec = createEmptySpec()
+	if !assert.NoError(addAffinityRules(instanceGroup, spec, ExportSettings{})) {
+		return
+	}
+	actual, err = RoundtripKube(spec)
+	if !assert.NoError(err) {
+		return
+	}
+	testhelpers.IsYAMLEqualString(assert, `---
+		template:
+			metadata:
+				annotations: {}
+			spec:
+				affinity:
+					nodeAffinity:
+						requiredDuringSchedulingIgnoredDuringExecution:
+							nodeSelectorTerms:
+							-	matchExpressions:
+								-	key: fissile.cloudfoundry.org/dedicated
+									operator: In
+									values: [dedicated-group]
+				tolerations:
+				-	key: fissile.cloudfoundry.org/dedicated
+					operator: Equal
+					value: dedicated-group
+					effect: NoSchedule
+	`, actual)
+
+	// With a helm chart, the node affinity of the preset is the default of
+	// the values, so that it can still be overridden
+	spec = createEmptySpec()
+	if !assert.NoError(addAffinityRules(instanceGroup, spec, ExportSettings{CreateHelmChart: true})) {
+		return
+	}
+	assert.Equal("if and .Values.sizing.dedicated_group.affinity.nodeAffinity (not .Values.config.dev_mode)",
+		spec.Get("template", "spec", "affinity", "nodeAffinity").Block())
+	assert.NotNil(spec.Get("template", "spec", "tolerations"))
+
+	settings := ExportSettings{
+		CreateHelmChart: true,
+		RoleManifest: &model.RoleManifest{
+			InstanceGroups: model.InstanceGroups{instanceGroup},
+			Configuration:  &model.Configuration{},
+		},
+	}
+	values := MakeValues(settings)
+	assert.NotNil(values.Get("sizing", "dedicated_group", "affinity", "nodeAffinity", "requiredDuringSchedulingIgnoredDuringExecution"))
+
+	// Development mode drops the dedicated node, so all pods fit on one node
+	renderer, err := newTestRenderer(values)
+	if !assert.NoError(err) {
+		return
+	}
+	actual, err = renderer.RoundtripNode(spec, map[string]interface{}{"Values.config.dev_mode": true})
+	if !assert.NoError(err) {
+		return
+	}
+	podSpec := actual.(map[interface{}]interface{})["template"].(map[interface{}]interface{})["spec"].(map[interface{}]interface{})
+	assert.Empty(podSpec["affinity"])
+	assert.NotContains(podSpec, "tolerations")
+	actual, err = renderer.RoundtripNode(spec, nil)
+	if !assert.NoError(err) {
+		return
+	}
+	podSpec = actual.(map[interface{}]interface{})["template"].(map[interface{}]interface{})["spec"].(map[interface{}]interface{})
+	assert.Contains(podSpec["affinity"], "nodeAffinity")
+	assert.Contains(podSpec, "tolerations")
+}
+
 func TestNewDeploymentWithEmptyDirVolume(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -622,7 +804,7 @@ func TestNewDeploymentWithEmptyDirVolume(t *testing.T) {
 		}
 		_, err := RenderNode(deployment, config)
 		assert.EqualError(err,
-			`template: :15:17: executing "" at <fail "some_group must have at least 1 instances">: error calling fail: some_group must have at least 1 instances`)
+			`template: :51:135: executing "fissile.CheckReplicaCount" at <fail (printf "%s must have at least %d instances" .name .min)>: error calling fail: some_group must have at least 1 instances`)
 	})
 
 	t.Run("Configured", func(t *testing.T) {
@@ -630,6 +812,8 @@ func TestNewDeploymentWithEmptyDirVolume(t *testing.T) {
 		config := map[string]interface{}{
 			"Values.sizing.some_group.affinity":    map[string]interface{}{},
 			"Values.sizing.some_group.count":       "1",
+			"Values.sizing.some_group.command":     nil,
+			"Values.sizing.colocated.command":      nil,
 			"Values.kube.registry.hostname":        "docker.suse.fake",
 			"Values.kube.organization":             "splat",
 			"Values.env.KUBERNETES_CLUSTER_DOMAIN": "cluster.local",
@@ -0,0 +1,100 @@
+package kube
+
+import (
+	"strings"
+
+	"code.cloudfoundry.org/fissile/model"
+)
+
+// EnvVarSource describes where the value of an environment variable of a
+// container comes from
+type EnvVarSource string
+
+// Sources of environment variables
+const (
+	EnvVarSourceUser            = EnvVarSource("user value")       // a variable the user sets in values.yaml
+	EnvVarSourceUserSecret      = EnvVarSource("user secret")      // a secret variable the user sets
+	EnvVarSourceGeneratedSecret = EnvVarSource("generated secret") // a secret fissile generates
+	EnvVarSourceSizing          = EnvVarSource("sizing")           // the sizing of an instance group
+	EnvVarSourceFeature         = EnvVarSource("feature flag")     // whether a feature is enabled
+	EnvVarSourceBuiltIn         = EnvVarSource("built-in")         // set by fissile or the role manifest
+)
+
+// EnvVar describes an environment variable of the containers of an instance
+// group.  Value is the value or helm template it is set to, and Default the
+// default of variables the user sets.  Variables read from secrets name the
+// secrets instead; generated secrets which the user can override name both.
+type EnvVar struct {
+	Name    string       `json:"name" yaml:"name"`
+	Source  EnvVarSource `json:"source" yaml:"source"`
+	Value   string       `json:"value,omitempty" yaml:"value,omitempty"`
+	Default string       `json:"default,omitempty" yaml:"default,omitempty"`
+	Secrets []string     `json:"secrets,omitempty" yaml:"secrets,omitempty"`
+}
+
+// GetEnvVars returns the environment variables of the containers of the
+// instance group, sorted by name, along with where their values come from.
+func GetEnvVars(role *model.InstanceGroup, settings ExportSettings) ([]EnvVar, error) {
+	env, err := getEnvVars(role, settings)
+	if err != nil {
+		return nil, err
+	}
+	configs, err := role.GetVariablesForRole()
+	if err != nil {
+		return nil, err
+	}
+	configsByName := make(map[string]*model.VariableDefinition)
+	for _, config := range configs {
+		configsByName[config.Name] = config
+	}
+
+	var result []EnvVar
+	for _, node := range env.Values() {
+		envVar := EnvVar{Name: node.Get("name").String()}
+
+		if secretKeyRef := node.Get("valueFrom", "secretKeyRef"); secretKeyRef != nil {
+			secretName := secretKeyRef.Get("name").String()
+			// Overridable generated secrets appear twice, once for each secret
+			if n := len(result); n > 0 && result[n-1].Name == envVar.Name {
+				result[n-1].Secrets = append(result[n-1].Secrets, secretName)
+				continue
+			}
+			envVar.Secrets = []string{secretName}
+			switch {
+			case secretName == generatedSecretsName:
+				envVar.Source = EnvVarSourceGeneratedSecret
+			case configsByName[envVar.Name] != nil:
+				envVar.Source = EnvVarSourceUserSecret
+			default:
+				envVar.Source = EnvVarSourceBuiltIn
+			}
+			result = append(result, envVar)
+			continue
+		}
+
+		if value := node.Get("value"); value != nil {
+			envVar.Value = value.String()
+		} else if fieldRef := node.Get("valueFrom", "fieldRef"); fieldRef != nil {
+			envVar.Value = fieldRef.Get("fieldPath").String()
+		}
+		config := configsByName[envVar.Name]
+		switch {
+		case config == nil:
+			envVar.Source = EnvVarSourceBuiltIn
+		case model.FeatureVariablePattern.MatchString(envVar.Name):
+			envVar.Source = EnvVarSourceFeature
+		case model.SizingCountVariablePattern.MatchString(envVar.Name) || model.SizingPortsVariablePattern.MatchString(envVar.Name):
+			envVar.Source = EnvVarSourceSizing
+		case strings.HasPrefix(envVar.Name, "KUBE_") || strings.HasPrefix(envVar.Name, "KUBERNETES_") || envVar.Name == "HELM_IS_INSTALL":
+			envVar.Source = EnvVarSourceBuiltIn
+		case config.CVOptions.Type == model.CVTypeEnv:
+			envVar.Source = EnvVarSourceBuiltIn
+		default:
+			envVar.Source = EnvVarSourceUser
+			_, envVar.Default = config.Value()
+		}
+		result = append(result, envVar)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package kube
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetEnvVarsSources(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	role := podTemplateTestLoadRole(assert)
+	require.NotNil(t, role)
+
+	manifest := role.Manifest()
+	manifest.Features["foo"] = true
+	for _, variable := range []*model.VariableDefinition{
+		{Name: "USER_VAR", CVOptions: model.CVOptions{Type: model.CVTypeUser, Internal: true, Default: "hello"}},
+		{Name: "GENERATED_PASSWORD", Type: "password", CVOptions: model.CVOptions{Type: model.CVTypeUser, Internal: true, Secret: true}},
+		{Name: "FEATURE_FOO_ENABLED", CVOptions: model.CVOptions{Type: model.CVTypeUser, Internal: true}},
+		{Name: "KUBE_SIZING_MYROLE_COUNT", CVOptions: model.CVOptions{Type: model.CVTypeUser, Internal: true}},
+	} {
+		manifest.Variables = append(manifest.Variables, variable)
+	}
+
+	envVars, err := GetEnvVars(role, ExportSettings{
+		CreateHelmChart: true,
+		RoleManifest:    manifest,
+	})
+	require.NoError(t, err)
+
+	byName := make(map[string]EnvVar)
+	for i, envVar := range envVars {
+		if i > 0 {
+			assert.True(envVars[i-1].Name < envVar.Name, "Variables should be sorted and unique")
+		}
+		byName[envVar.Name] = envVar
+	}
+
+	assert.Equal(string(EnvVarSourceUser), string(byName["USER_VAR"].Source))
+	assert.Equal("hello", byName["USER_VAR"].Default)
+	assert.Contains(byName["USER_VAR"].Value, ".Values.env.USER_VAR")
+
+	assert.Equal(EnvVar{
+		Name:    "SECRET_VAR",
+		Source:  EnvVarSourceUserSecret,
+		Secrets: []string{userSecretsName},
+	}, byName["SECRET_VAR"])
+	assert.Equal(EnvVar{
+		Name:    "GENERATED_PASSWORD",
+		Source:  EnvVarSourceGeneratedSecret,
+		Secrets: []string{generatedSecretsName, userSecretsName},
+	}, byName["GENERATED_PASSWORD"], "Overridable generated secrets name both secrets")
+
+	assert.Equal(string(EnvVarSourceFeature), string(byName["FEATURE_FOO_ENABLED"].Source))
+	assert.Equal(string(EnvVarSourceSizing), string(byName["KUBE_SIZING_MYROLE_COUNT"].Source))
+	assert.Equal(EnvVar{
+		Name:   "KUBERNETES_NAMESPACE",
+		Source: EnvVarSourceBuiltIn,
+		Value:  "metadata.namespace",
+	}, byName["KUBERNETES_NAMESPACE"])
+	assert.Equal(string(EnvVarSourceBuiltIn), string(byName["VCAP_HARD_NPROC"].Source))
+}
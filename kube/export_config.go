@@ -0,0 +1,160 @@
+package kube
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/validation"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// ExportConfig holds the export settings read from a YAML file, so that they
+// can be versioned next to the role manifest instead of being passed as flags
+// to every build.  Fields missing from the file keep the values of the flags.
+// Relative paths are relative to the directory of the file.  Credentials are
+// deliberately left out.
+type ExportConfig struct {
+	OutputDir          *string  `yaml:"output_dir"`
+	Repository         *string  `yaml:"repository"`
+	Registry           *string  `yaml:"registry"`
+	Organization       *string  `yaml:"organization"`
+	UseMemoryLimits    *bool    `yaml:"use_memory_limits"`
+	UseCPULimits       *bool    `yaml:"use_cpu_limits"`
+	TagExtra           *string  `yaml:"tag_extra"`
+	AuthType           *string  `yaml:"auth_type"`
+	KubeSchemaDir      *string  `yaml:"kube_schema_dir"`
+	ServiceNaming      *string  `yaml:"service_naming"`
+	SecretGrouping     *string  `yaml:"secret_grouping"`
+	ConfigChecksum     *string  `yaml:"config_checksum"`
+	ImmutableConfig    *bool    `yaml:"immutable_config"`
+	ValuesDocs         *string  `yaml:"values_docs"`
+	DefaultsFiles      []string `yaml:"defaults_files"`
+	DebugRoles         []string `yaml:"debug_roles"`
+	Roles              []string `yaml:"roles"`
+	SkipRoles          []string `yaml:"skip_roles"`
+	OverlayDir         *string  `yaml:"overlay_dir"`
+	Layout             *string  `yaml:"layout"`
+	OpenShift          *bool    `yaml:"openshift"`
+	PortRanges         *string  `yaml:"port_ranges"`
+	NodePorts          *bool    `yaml:"node_ports"`
+	DeploymentManifest *bool    `yaml:"deployment_manifest"`
+	SubCharts          *bool    `yaml:"sub_charts"`
+	VMTypes            *string  `yaml:"vm_types"`
+}
+
+// LoadExportConfig reads the export settings from a YAML file.  Unknown keys
+// and unsupported values are rejected.
+func LoadExportConfig(path string) (ExportConfig, error) {
+	var config ExportConfig
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("Error reading export config %s: %v", path, err)
+	}
+	if err := yaml.UnmarshalStrict(contents, &config); err != nil {
+		return config, fmt.Errorf("Error reading export config %s: %v", path, err)
+	}
+	if errs := config.Validate(); len(errs) != 0 {
+		return config, fmt.Errorf("Invalid export config %s:\n%s", path, errs.Error())
+	}
+
+	if config.Registry != nil {
+		*config.Registry = strings.TrimSuffix(*config.Registry, "/")
+	}
+	dir := filepath.Dir(path)
+	for _, p := range []*string{config.OutputDir, config.KubeSchemaDir, config.OverlayDir, config.VMTypes} {
+		if p != nil && *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	for i, p := range config.DefaultsFiles {
+		if !filepath.IsAbs(p) {
+			config.DefaultsFiles[i] = filepath.Join(dir, p)
+		}
+	}
+	return config, nil
+}
+
+// Validate checks that the strategies and formats of the config are
+// supported
+func (c ExportConfig) Validate() validation.ErrorList {
+	allErrs := validation.ErrorList{}
+	oneOf := func(field string, value *string, validValues ...string) {
+		if value == nil {
+			return
+		}
+		for _, validValue := range validValues {
+			if *value == validValue {
+				return
+			}
+		}
+		allErrs = append(allErrs, validation.NotSupported(field, *value, validValues))
+	}
+	oneOf("service_naming", c.ServiceNaming, string(ServiceNamingTruncate), string(ServiceNamingStrict))
+	oneOf("secret_grouping", c.SecretGrouping, string(SecretGroupingSingle), string(SecretGroupingInstanceGroup))
+	oneOf("config_checksum", c.ConfigChecksum, string(ConfigChecksumChart), string(ConfigChecksumInstanceGroup))
+	oneOf("values_docs", c.ValuesDocs, "", ValuesDocsMarkdown, ValuesDocsCSV)
+	oneOf("layout", c.Layout, string(LayoutInstanceGroup), string(LayoutObject), string(LayoutGitOps), string(LayoutStream))
+	oneOf("port_ranges", c.PortRanges, string(PortRangesExpand), string(PortRangesAnnotate))
+	return allErrs
+}
+
+// Apply sets the export settings given by the config, for those whose flag
+// the command uses, as reported by useConfig; settings whose flag was given
+// on the command line, or which the command does not support, are kept.
+func (c ExportConfig) Apply(settings *ExportSettings, useConfig func(flag string) bool) {
+	setString := func(flag string, value *string, setting *string) {
+		if value != nil && useConfig(flag) {
+			*setting = *value
+		}
+	}
+	setBool := func(flag string, value *bool, setting *bool) {
+		if value != nil && useConfig(flag) {
+			*setting = *value
+		}
+	}
+	setList := func(flag string, value []string, setting *[]string) {
+		if value != nil && useConfig(flag) {
+			*setting = value
+		}
+	}
+
+	setString("output-dir", c.OutputDir, &settings.OutputDir)
+	setString("repository", c.Repository, &settings.Repository)
+	setString("docker-registry", c.Registry, &settings.Registry)
+	setString("docker-organization", c.Organization, &settings.Organization)
+	setBool("use-memory-limits", c.UseMemoryLimits, &settings.UseMemoryLimits)
+	setBool("use-cpu-limits", c.UseCPULimits, &settings.UseCPULimits)
+	setString("tag-extra", c.TagExtra, &settings.TagExtra)
+	setString("auth-type", c.AuthType, &settings.AuthType)
+	setString("kube-schema-dir", c.KubeSchemaDir, &settings.KubeSchemaDir)
+	setBool("immutable-config", c.ImmutableConfig, &settings.ImmutableConfig)
+	setString("values-docs", c.ValuesDocs, &settings.ValuesDocs)
+	setList("defaults-file", c.DefaultsFiles, &settings.DefaultsFiles)
+	setList("debug-roles", c.DebugRoles, &settings.DebugRoles)
+	setList("roles", c.Roles, &settings.Roles)
+	setList("skip-roles", c.SkipRoles, &settings.SkipRoles)
+	setString("overlay-dir", c.OverlayDir, &settings.OverlayDir)
+	setBool("openshift", c.OpenShift, &settings.OpenShift)
+	setBool("node-ports", c.NodePorts, &settings.NodePorts)
+	setBool("deployment-manifest", c.DeploymentManifest, &settings.DeploymentManifest)
+	setBool("sub-charts", c.SubCharts, &settings.SubCharts)
+	setString("vm-types", c.VMTypes, &settings.VMTypes)
+
+	if c.ServiceNaming != nil && useConfig("service-naming") {
+		settings.ServiceNaming = ServiceNamingStrategy(*c.ServiceNaming)
+	}
+	if c.SecretGrouping != nil && useConfig("secret-grouping") {
+		settings.SecretGrouping = SecretGrouping(*c.SecretGrouping)
+	}
+	if c.ConfigChecksum != nil && useConfig("config-checksum") {
+		settings.ConfigChecksum = ConfigChecksum(*c.ConfigChecksum)
+	}
+	if c.Layout != nil && useConfig("layout") {
+		settings.Layout = Layout(*c.Layout)
+	}
+	if c.PortRanges != nil && useConfig("port-ranges") {
+		settings.PortRanges = PortRangeStrategy(*c.PortRanges)
+	}
+}
@@ -0,0 +1,92 @@
+package kube
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadExportConfig(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "fissile-export-config-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("Valid", func(t *testing.T) {
+		path := filepath.Join(dir, "valid.yml")
+		require.NoError(t, ioutil.WriteFile(path, []byte(`---
+output_dir: out
+registry: registry.example.com/
+use_memory_limits: false
+tag_extra: v2
+service_naming: strict
+layout: gitops
+defaults_files: [defaults.yml, /etc/defaults.yml]
+roles: [api]
+`), 0644))
+
+		config, err := LoadExportConfig(path)
+		require.NoError(t, err)
+		require.NotNil(t, config.OutputDir)
+		assert.Equal(t, filepath.Join(dir, "out"), *config.OutputDir, "Paths are relative to the file")
+		assert.Equal(t, "registry.example.com", *config.Registry)
+		assert.False(t, *config.UseMemoryLimits)
+		assert.Nil(t, config.UseCPULimits)
+		assert.Equal(t, []string{filepath.Join(dir, "defaults.yml"), "/etc/defaults.yml"}, config.DefaultsFiles)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.yml")
+		require.NoError(t, ioutil.WriteFile(path, []byte(`---
+service_naming: shorten
+layout: flat
+`), 0644))
+
+		_, err := LoadExportConfig(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `service_naming: Unsupported value: "shorten": supported values: truncate, strict`)
+		assert.Contains(t, err.Error(), `layout: Unsupported value: "flat": supported values: instance-group, object, gitops, stream`)
+	})
+
+	t.Run("UnknownKey", func(t *testing.T) {
+		path := filepath.Join(dir, "unknown.yml")
+		require.NoError(t, ioutil.WriteFile(path, []byte("docker_password: secret\n"), 0644))
+
+		_, err := LoadExportConfig(path)
+		assert.Error(t, err, "Credentials cannot be given")
+	})
+}
+
+func TestExportConfigApply(t *testing.T) {
+	t.Parallel()
+
+	tagExtra := "from-config"
+	layout := string(LayoutGitOps)
+	openShift := true
+	config := ExportConfig{
+		TagExtra:  &tagExtra,
+		Layout:    &layout,
+		OpenShift: &openShift,
+		Roles:     []string{"api"},
+	}
+	settings := ExportSettings{
+		TagExtra:        "from-flag",
+		UseMemoryLimits: true,
+		Layout:          LayoutInstanceGroup,
+	}
+
+	// The tag was given on the command line, and the command has no layout
+	config.Apply(&settings, func(flag string) bool {
+		return flag != "tag-extra" && flag != "layout"
+	})
+	assert.Equal(t, "from-flag", settings.TagExtra)
+	assert.Equal(t, LayoutInstanceGroup, settings.Layout)
+	assert.True(t, settings.OpenShift)
+	assert.True(t, settings.UseMemoryLimits, "Settings missing from the config are kept")
+	assert.Equal(t, []string{"api"}, settings.Roles)
+}
@@ -1,23 +1,71 @@
 package kube
 
 import (
+	"io"
+
 	"code.cloudfoundry.org/fissile/model"
 )
 
 // ExportSettings are configuration for creating Kubernetes configs
 type ExportSettings struct {
-	OutputDir       string
-	Repository      string
-	Registry        string
-	Username        string
-	Password        string
-	Organization    string
-	UseMemoryLimits bool
-	UseCPULimits    bool
-	FissileVersion  string
-	TagExtra        string
-	RoleManifest    *model.RoleManifest
-	Opinions        *model.Opinions
-	CreateHelmChart bool
-	AuthType        string
+	OutputDir          string
+	Repository         string
+	Registry           string
+	Username           string
+	Password           string
+	Organization       string
+	UseMemoryLimits    bool
+	UseCPULimits       bool
+	FissileVersion     string
+	TagExtra           string
+	ImageOptions       model.RoleImageOptions // Options the role images were built with, which are part of their tags
+	RoleManifest       *model.RoleManifest
+	Opinions           *model.Opinions
+	CreateHelmChart    bool
+	AuthType           string
+	KubeSchemaDir      string
+	ServiceNaming      ServiceNamingStrategy // How to handle service names too long for kubernetes
+	SecretGrouping     SecretGrouping        // How to split the user secrets into Secret objects
+	ConfigChecksum     ConfigChecksum        // What the checksum/config annotation rolling the pods covers
+	ImmutableConfig    bool                  // Make the Secret and ConfigMap objects the pods consume immutable, named after a hash of their values
+	ValuesDocs         string                // Format of the values documentation to write with the chart, if any
+	DefaultsFiles      []string              // Files overriding the defaults of variables, later files take precedence
+	Substitutions      Substitutions         // Concrete values for configs generated without a helm chart
+	DebugRoles         []string              // Instance groups whose containers sleep instead of running their jobs
+	Roles              []string              // Instance groups to generate, all of them if empty
+	SkipRoles          []string              // Instance groups not to generate
+	OverlayDir         string                // Directory of user files merged into the generated chart
+	Layout             Layout                // How the objects are written without a helm chart
+	OpenShift          bool                  // Generate routes, security context constraints, and no fixed user ids for OpenShift
+	PortRanges         PortRangeStrategy     // How services expose port definitions with more than one port
+	NodePorts          bool                  // Expose public services on node ports instead of external IPs, without a helm chart
+	DeploymentManifest bool                  // Generate the deployment manifest secret from the role manifest
+	SubCharts          bool                  // Write the instance groups of each group into a helm sub-chart of their own
+	VMTypes            string                // File mapping the BOSH vm_types of instance groups to default resource requests
+	PruneFrom          string                // Objects manifest of the previous configs, to write a script deleting the objects no longer generated
+	Stream             io.Writer             // Where the stream layout writes the objects, usually stdout
+}
+
+// Layout is the way the Kubernetes configs are written
+type Layout string
+
+// These are the valid layouts
+const (
+	LayoutInstanceGroup = Layout("instance-group") // One file per instance group, plus files for shared objects (the default)
+	LayoutObject        = Layout("object")         // One file per object, named <kind>-<name>.yaml
+	LayoutStream        = Layout("stream")         // All objects as a single multi-document stream to ExportSettings.Stream
+	LayoutGitOps        = Layout("gitops")         // One file per object in the output directory, listed in a kustomization.yaml
+)
+
+// IsDebugRole returns true if the containers of the named instance group are
+// generated for debugging: they sleep instead of running the jobs, have no
+// probes and run privileged, so that operators can exec into them and run
+// the jobs manually.
+func (settings ExportSettings) IsDebugRole(name string) bool {
+	for _, debugRole := range settings.DebugRoles {
+		if debugRole == name {
+			return true
+		}
+	}
+	return false
 }
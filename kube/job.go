@@ -35,6 +35,7 @@ func NewJob(instanceGroup *model.InstanceGroup, settings ExportSettings, grapher
 		SetAPIVersion("batch/v1").
 		SetKind("Job").
 		SetName(name).
+		SetInstanceGroup(instanceGroup).
 		AddModifier(helm.Comment(instanceGroup.GetLongDescription()))
 	job, err := cb.Build()
 	if err != nil {
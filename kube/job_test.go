@@ -153,6 +153,7 @@ func TestJobHelm(t *testing.T) {
 		"Values.kube.registry.username":        "U",
 		"Values.kube.organization":             "splat",
 		"Values.env.KUBERNETES_CLUSTER_DOMAIN": "cluster.local",
+		"Values.sizing.pre_role.command":       nil,
 	}
 
 	actual, err := RoundtripNode(job, config)
@@ -185,7 +186,8 @@ func TestJobHelm(t *testing.T) {
 						helm.sh/chart: MyChart-42.1_foo
 						skiff-role-name: "pre-role"
 					annotations:
-						checksum/config: 08c80ed11902eefef09739d41c91408238bb8b5e7be7cc1e5db933b7c8de65c3
+						checksum/config: e1c940617f9a3259580c67007eb837ba26b1bef1a166582042cc09692ce1b453
+						jobs.fissile.cloudfoundry.org/pre-role: new_hostname
 				spec:
 					containers:
 					-	env:
@@ -237,3 +239,31 @@ func TestJobHelm(t *testing.T) {
 							secretName: deployment-manifest
 	`, actual)
 }
+
+func TestJobNetworkIdentity(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	instanceGroup := jobTestLoadRole(assert, "task-role", "network-identity.yml")
+	if instanceGroup == nil {
+		return
+	}
+
+	job, err := NewJob(instanceGroup, ExportSettings{
+		Opinions: model.NewEmptyOpinions(),
+	}, nil)
+	if !assert.NoError(err) {
+		return
+	}
+
+	actual, err := RoundtripKube(job)
+	if !assert.NoError(err) {
+		return
+	}
+	testhelpers.IsYAMLSubsetString(assert, `---
+		spec:
+			template:
+				spec:
+					hostname: migrator
+					subdomain: tor-nodes
+	`, actual)
+}
@@ -0,0 +1,300 @@
+package kube
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
+)
+
+// These are the default images of the log sidecars; helm charts read them
+// from logging.tail.image and logging.forwarder.image
+const (
+	LogTailImage      = "busybox:1.31"
+	LogForwarderImage = "fluent/fluent-bit:1.3"
+)
+
+// LogForwarderOutputs is the default [OUTPUT] section of the configuration
+// of the forwarder, printing the records to its standard output.  Helm charts
+// read it from logging.forwarder.outputs.
+const LogForwarderOutputs = `[OUTPUT]
+    Name  stdout
+    Match *
+`
+
+// logSidecarName is the name of the log sidecar container
+const logSidecarName = "log-sidecar"
+
+// sysLogVolumeName is the name of the volume the jobs write their log files
+// to, when the instance group has no volume for them
+const sysLogVolumeName = "sys-log"
+
+// logForwarderConfigDir is the directory the forwarder reads its
+// configuration from
+const logForwarderConfigDir = "/fluent-bit/etc"
+
+// logSidecarCondition returns the helm condition selecting the log sidecar
+func logSidecarCondition(sidecar model.LogSidecar) string {
+	if sidecar == model.LogSidecarNone {
+		return ".Values.logging.sidecar"
+	}
+	return fmt.Sprintf("eq (toString .Values.logging.sidecar) %q", sidecar)
+}
+
+// hasLogSidecar returns whether the pods of the instance group may get the
+// log sidecar: helm charts decide with logging.sidecar, kube configs with
+// the log sidecar of the role manifest.  Only long running instance groups
+// have one, as a sidecar would keep the pods of tasks from completing.
+func hasLogSidecar(role *model.InstanceGroup, settings ExportSettings, sidecar model.LogSidecar) bool {
+	if role.Type != model.RoleTypeBosh {
+		return false
+	}
+	if settings.CreateHelmChart {
+		return true
+	}
+	configured := model.LogSidecarNone
+	if settings.RoleManifest != nil && settings.RoleManifest.Configuration != nil {
+		configured = settings.RoleManifest.Configuration.LogSidecar
+	}
+	if sidecar == model.LogSidecarNone {
+		return configured != model.LogSidecarNone
+	}
+	return configured == sidecar
+}
+
+// sysLogVolume returns the name of the volume holding the log files of the
+// instance group, and whether it is the volume added for the log sidecar
+// rather than a volume of the instance group
+func sysLogVolume(role *model.InstanceGroup) (string, bool) {
+	for _, volume := range role.Run.Volumes {
+		if volume.Path == model.SysLogDir && volume.Type != model.VolumeTypeNone {
+			return volume.Tag, false
+		}
+	}
+	return sysLogVolumeName, true
+}
+
+// addLogSidecarVolumes adds the volume shared by the containers and the log
+// sidecar, and the configuration of the forwarder, to the volumes of the pod
+func addLogSidecarVolumes(role *model.InstanceGroup, settings ExportSettings, volumes *helm.List) {
+	if name, added := sysLogVolume(role); added && hasLogSidecar(role, settings, model.LogSidecarNone) {
+		volume := helm.NewMapping("name", name, "emptyDir", map[interface{}]interface{}{})
+		if settings.CreateHelmChart {
+			volume.Set(helm.Block("if " + logSidecarCondition(model.LogSidecarNone)))
+		}
+		volumes.Add(volume)
+	}
+	if hasLogSidecar(role, settings, model.LogSidecarForwarder) {
+		volume := helm.NewMapping(
+			"name", "log-forwarder-config",
+			"configMap", helm.NewMapping("name", logForwarderConfigName(role, settings)))
+		if settings.CreateHelmChart {
+			volume.Set(helm.Block("if " + logSidecarCondition(model.LogSidecarForwarder)))
+		}
+		volumes.Add(volume)
+	}
+}
+
+// sysLogMount returns the mount of the volume shared with the log sidecar
+// for the containers of the pod, or nil if the instance group has no log
+// sidecar or mounts a volume of its own there
+func sysLogMount(role *model.InstanceGroup, settings ExportSettings) helm.Node {
+	name, added := sysLogVolume(role)
+	if !added || !hasLogSidecar(role, settings, model.LogSidecarNone) {
+		return nil
+	}
+	mount := helm.NewMapping("mountPath", model.SysLogDir, "name", name)
+	if settings.CreateHelmChart {
+		mount.Set(helm.Block("if " + logSidecarCondition(model.LogSidecarNone)))
+	}
+	return mount
+}
+
+// getLogSidecars returns the log sidecar containers of the pods of the
+// instance group.  Helm charts get both, each conditional on
+// logging.sidecar.
+func getLogSidecars(role *model.InstanceGroup, settings ExportSettings) []helm.Node {
+	var sidecars []helm.Node
+	logPaths := podLogPaths(role)
+	volumeName, _ := sysLogVolume(role)
+	sysLogMount := helm.NewMapping("mountPath", model.SysLogDir, "name", volumeName, "readOnly", true)
+
+	if hasLogSidecar(role, settings, model.LogSidecarTail) {
+		image := LogTailImage
+		if settings.CreateHelmChart {
+			image = "{{ .Values.logging.tail.image | quote }}"
+		}
+		container := helm.NewMapping(
+			"name", logSidecarName,
+			"image", image,
+			"command", helm.NewList("/bin/sh", "-c", logTailScript(logPaths)),
+			"resources", logSidecarResources(settings),
+			"volumeMounts", helm.NewList(sysLogMount))
+		if settings.CreateHelmChart {
+			container.Set(helm.Block("if " + logSidecarCondition(model.LogSidecarTail)))
+		}
+		sidecars = append(sidecars, container)
+	}
+
+	if hasLogSidecar(role, settings, model.LogSidecarForwarder) {
+		image := LogForwarderImage
+		if settings.CreateHelmChart {
+			image = "{{ .Values.logging.forwarder.image | quote }}"
+		}
+		podName := helm.NewMapping("name", "POD_NAME", "valueFrom", helm.NewMapping(
+			"fieldRef", helm.NewMapping("fieldPath", "metadata.name")))
+		configMount := helm.NewMapping("mountPath", logForwarderConfigDir, "name", "log-forwarder-config", "readOnly", true)
+		container := helm.NewMapping(
+			"name", logSidecarName,
+			"image", image,
+			"env", helm.NewList(podName),
+			"resources", logSidecarResources(settings),
+			"volumeMounts", helm.NewList(sysLogMount, configMount))
+		if settings.CreateHelmChart {
+			container.Set(helm.Block("if " + logSidecarCondition(model.LogSidecarForwarder)))
+		}
+		sidecars = append(sidecars, container)
+	}
+
+	return sidecars
+}
+
+// logSidecarResources returns the resource requests and limits of the log
+// sidecar containers.  Helm charts read them from logging.resources, and
+// apply them like those of the instance groups.
+func logSidecarResources(settings ExportSettings) helm.Node {
+	if !settings.UseMemoryLimits && !settings.UseCPULimits {
+		return nil
+	}
+	requests := helm.NewMapping()
+	limits := helm.NewMapping()
+	if settings.UseMemoryLimits {
+		if settings.CreateHelmChart {
+			requests.Add("memory",
+				helm.NewNode(sizingQuantity(".Values.logging.resources.memory.request", "Mi"),
+					helm.Block("if and .Values.config.memory.requests (not .Values.config.dev_mode) .Values.logging.resources.memory.request")))
+			limits.Add("memory",
+				helm.NewNode(sizingQuantity(".Values.logging.resources.memory.limit", "Mi"),
+					helm.Block("if and .Values.config.memory.limits .Values.logging.resources.memory.limit")))
+		} else {
+			requests.Add("memory", fmt.Sprintf("%dMi", model.LogSidecarMemoryRequest))
+			limits.Add("memory", fmt.Sprintf("%dMi", model.LogSidecarMemoryLimit))
+		}
+	}
+	if settings.UseCPULimits {
+		if settings.CreateHelmChart {
+			requests.Add("cpu",
+				helm.NewNode(sizingQuantity(".Values.logging.resources.cpu.request", "m"),
+					helm.Block("if and .Values.config.cpu.requests (not .Values.config.dev_mode) .Values.logging.resources.cpu.request")))
+			limits.Add("cpu",
+				helm.NewNode(sizingQuantity(".Values.logging.resources.cpu.limit", "m"),
+					helm.Block("if and .Values.config.cpu.limits .Values.logging.resources.cpu.limit")))
+		} else {
+			requests.Add("cpu", fmt.Sprintf("%gm", 1000*model.LogSidecarCPURequest))
+			limits.Add("cpu", fmt.Sprintf("%gm", 1000*model.LogSidecarCPULimit))
+		}
+	}
+	return helm.NewMapping("requests", requests, "limits", limits)
+}
+
+// podLogPaths returns the log paths of the containers of the pods of the
+// instance group
+func podLogPaths(role *model.InstanceGroup) []string {
+	logPaths := append([]string{}, role.Run.LogPaths...)
+	for _, colocated := range role.GetColocatedRoles() {
+		logPaths = append(logPaths, colocated.Run.LogPaths...)
+	}
+	return logPaths
+}
+
+// logTailScript returns the script of the tail sidecar.  The log files are
+// created by the jobs after the sidecar starts, so the globs are expanded
+// periodically, and each new file is followed by a tail of its own.
+func logTailScript(logPaths []string) string {
+	return fmt.Sprintf(`touch /tmp/tailed
+while true; do
+  for file in %s; do
+    if [ -f "$file" ] && ! grep -qxF "$file" /tmp/tailed; then
+      echo "$file" >> /tmp/tailed
+      tail -n +1 -F "$file" &
+    fi
+  done
+  sleep 10
+done
+`, strings.Join(logPaths, " "))
+}
+
+// logForwarderConfigName returns the name of the ConfigMap holding the
+// configuration of the forwarder of the instance group; see
+// immutableConfigName
+func logForwarderConfigName(role *model.InstanceGroup, settings ExportSettings) string {
+	return immutableConfigName(kubeName(role.Name)+"-log-forwarder", settings, logForwarderConfigValues(role)...)
+}
+
+// logForwarderConfigValues returns the template values the ConfigMap of the
+// forwarder of the instance group is rendered from: the digest of the
+// generated configuration, and the outputs.
+func logForwarderConfigValues(role *model.InstanceGroup) []string {
+	digest := fmt.Sprintf("%x", sha256.Sum256([]byte(logForwarderConfig(role))))
+	return []string{fmt.Sprintf("%q", digest), ".Values.logging.forwarder.outputs"}
+}
+
+// logForwarderConfig returns the fluent-bit configuration of the forwarder of
+// the instance group, except for the outputs: the log paths of its jobs,
+// tagged with the instance group and the pod.
+func logForwarderConfig(role *model.InstanceGroup) string {
+	return fmt.Sprintf(`[SERVICE]
+    Flush     5
+    Log_Level info
+
+[INPUT]
+    Name             tail
+    Path             %s
+    Path_Key         file
+    Tag              %s.*
+    Refresh_Interval 10
+
+[FILTER]
+    Name   record_modifier
+    Match  *
+    Record instance_group %s
+    Record pod ${POD_NAME}
+
+@INCLUDE outputs.conf
+`, strings.Join(podLogPaths(role), ","), kubeName(role.Name), role.Name)
+}
+
+// NewLogForwarderConfig returns the ConfigMap holding the fluent-bit
+// configuration of the forwarder sidecar of the instance group (see
+// logForwarderConfig).  It returns nil if the pods of the instance group have
+// no forwarder.
+func NewLogForwarderConfig(role *model.InstanceGroup, settings ExportSettings) (helm.Node, error) {
+	if !hasLogSidecar(role, settings, model.LogSidecarForwarder) {
+		return nil, nil
+	}
+
+	outputs := LogForwarderOutputs
+	if settings.CreateHelmChart {
+		outputs = "{{ .Values.logging.forwarder.outputs | quote }}"
+	}
+
+	cb := NewConfigBuilder().
+		SetSettings(&settings).
+		SetAPIVersion("v1").
+		SetKind("ConfigMap").
+		setConfigName(logForwarderConfigName(role, settings)).
+		SetInstanceGroup(role)
+	if settings.CreateHelmChart {
+		cb.AddModifier(helm.Block("if " + logSidecarCondition(model.LogSidecarForwarder)))
+	}
+	configMap, err := cb.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build a new kube config: %v", err)
+	}
+	configMap.Add("data", helm.NewMapping("fluent-bit.conf", logForwarderConfig(role), "outputs.conf", outputs))
+	addImmutable(configMap, settings)
+
+	return configMap.Sort(), nil
+}
@@ -0,0 +1,222 @@
+package kube
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogSidecarKube(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	manifest, role := statefulSetTestLoadManifest(assert, "log-sidecar.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+	assert.Equal([]string{
+		"/var/vcap/sys/log/tor/*.log",
+		"/var/vcap/sys/log/tor/audit/*.json",
+		"/var/vcap/sys/log/new_hostname/*.log",
+	}, role.Run.LogPaths)
+
+	settings := ExportSettings{RoleManifest: manifest, Opinions: model.NewEmptyOpinions()}
+	podTemplate, err := NewPodTemplate(role, settings, nil)
+	require.NoError(t, err)
+	actual, err := RoundtripKube(podTemplate)
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		spec:
+			containers:
+			-	name: myrole
+				volumeMounts:
+				-	name: deployment-manifest
+				-	mountPath: /var/vcap/sys/log
+					name: sys-log
+			-	name: log-sidecar
+				image: fluent/fluent-bit:1.3
+				volumeMounts:
+				-	mountPath: /var/vcap/sys/log
+					name: sys-log
+					readOnly: true
+				-	mountPath: /fluent-bit/etc
+					name: log-forwarder-config
+					readOnly: true
+			volumes:
+			-	name: deployment-manifest
+			-	name: sys-log
+				emptyDir: {}
+			-	name: log-forwarder-config
+				configMap:
+					name: myrole-log-forwarder
+	`, actual)
+
+	configMap, err := NewLogForwarderConfig(role, settings)
+	require.NoError(t, err)
+	require.NotNil(t, configMap)
+	actual, err = RoundtripKube(configMap)
+	require.NoError(t, err)
+	data := actual.(map[interface{}]interface{})["data"].(map[interface{}]interface{})
+	assert.Contains(data["fluent-bit.conf"], "Path             /var/vcap/sys/log/tor/*.log,/var/vcap/sys/log/tor/audit/*.json,/var/vcap/sys/log/new_hostname/*.log\n")
+	assert.Contains(data["fluent-bit.conf"], "Record instance_group myrole\n")
+	assert.Equal(LogForwarderOutputs, data["outputs.conf"])
+
+	resourceSettings := settings
+	resourceSettings.UseMemoryLimits = true
+	resourceSettings.UseCPULimits = true
+	sidecars := getLogSidecars(role, resourceSettings)
+	require.Len(t, sidecars, 1)
+	actual, err = RoundtripKube(sidecars[0])
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		resources:
+			requests:
+				memory: 16Mi
+				cpu: 10m
+			limits:
+				memory: 64Mi
+				cpu: 100m
+	`, actual)
+
+	task := manifest.LookupInstanceGroup("mytask")
+	require.NotNil(t, task)
+	configMap, err = NewLogForwarderConfig(task, settings)
+	require.NoError(t, err)
+	assert.Nil(configMap, "Tasks have no log sidecar")
+	assert.Empty(getLogSidecars(task, settings))
+}
+
+func TestLogSidecarHelm(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	manifest, role := statefulSetTestLoadManifest(assert, "log-sidecar.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	settings := ExportSettings{RoleManifest: manifest, CreateHelmChart: true, Opinions: model.NewEmptyOpinions()}
+	values := MakeValues(settings)
+	assert.Equal("forwarder", values.Get("logging", "sidecar").String())
+
+	podTemplate, err := NewPodTemplate(role, settings, nil)
+	require.NoError(t, err)
+	renderer, err := newTestRenderer(values)
+	require.NoError(t, err)
+	render := func(sidecar string) map[interface{}]interface{} {
+		actual, err := renderer.RoundtripNode(podTemplate, map[string]interface{}{
+			"Values.logging.sidecar": sidecar,
+		})
+		require.NoError(t, err)
+		return actual.(map[interface{}]interface{})["spec"].(map[interface{}]interface{})
+	}
+
+	spec := render("")
+	assert.Len(spec["containers"], 1)
+	for _, volume := range spec["volumes"].([]interface{}) {
+		assert.NotEqual("sys-log", volume.(map[interface{}]interface{})["name"])
+	}
+
+	spec = render("tail")
+	containers := spec["containers"].([]interface{})
+	require.Len(t, containers, 2)
+	sidecar := containers[1].(map[interface{}]interface{})
+	assert.Equal("log-sidecar", sidecar["name"])
+	assert.Equal(LogTailImage, sidecar["image"])
+	command := sidecar["command"].([]interface{})
+	require.Len(t, command, 3)
+	assert.Contains(command[2], "for file in /var/vcap/sys/log/tor/*.log /var/vcap/sys/log/tor/audit/*.json /var/vcap/sys/log/new_hostname/*.log; do")
+
+	spec = render("forwarder")
+	containers = spec["containers"].([]interface{})
+	require.Len(t, containers, 2)
+	assert.Equal(LogForwarderImage, containers[1].(map[interface{}]interface{})["image"])
+
+	// The resources of the sidecars follow the flags of the instance groups
+	settings.UseMemoryLimits = true
+	settings.UseCPULimits = true
+	podTemplate, err = NewPodTemplate(role, settings, nil)
+	require.NoError(t, err)
+	actual, err := renderer.RoundtripNode(podTemplate, map[string]interface{}{
+		"Values.logging.sidecar":       "tail",
+		"Values.config.memory.limits":  true,
+		"Values.config.cpu.requests":   true,
+		"Values.logging.resources.cpu": map[string]interface{}{"request": 50},
+		"Values.sizing.myrole.memory":  map[string]interface{}{},
+		"Values.sizing.myrole.cpu":     map[string]interface{}{},
+	})
+	require.NoError(t, err)
+	sidecar = actual.(map[interface{}]interface{})["spec"].(map[interface{}]interface{})["containers"].([]interface{})[1].(map[interface{}]interface{})
+	assert.Equal(map[interface{}]interface{}{"cpu": "50m"}, sidecar["resources"].(map[interface{}]interface{})["requests"])
+	assert.Equal(map[interface{}]interface{}{"memory": "64Mi"}, sidecar["resources"].(map[interface{}]interface{})["limits"])
+
+	configMap, err := NewLogForwarderConfig(role, settings)
+	require.NoError(t, err)
+	actual, err = RoundtripNode(configMap, map[string]interface{}{
+		"Values.logging.sidecar":           "forwarder",
+		"Values.logging.forwarder.outputs": "[OUTPUT]\n    Name es\n",
+	})
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		kind: ConfigMap
+		metadata:
+			name: myrole-log-forwarder
+		data:
+			outputs.conf: "[OUTPUT]\n    Name es\n"
+	`, actual)
+
+	actual, err = RoundtripNode(configMap, map[string]interface{}{"Values.logging.sidecar": "tail"})
+	require.NoError(t, err)
+	assert.Nil(actual, "The forwarder configuration is only created for the forwarder")
+}
+
+func TestLogSidecarHelmImmutableConfig(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	manifest, role := statefulSetTestLoadManifest(assert, "log-sidecar.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	settings := ExportSettings{RoleManifest: manifest, CreateHelmChart: true, ImmutableConfig: true, Opinions: model.NewEmptyOpinions()}
+	podTemplate, err := NewPodTemplate(role, settings, nil)
+	require.NoError(t, err)
+	configMap, err := NewLogForwarderConfig(role, settings)
+	require.NoError(t, err)
+	renderer, err := newTestRenderer(MakeValues(settings))
+	require.NoError(t, err)
+
+	// render returns the name of the config map, the name of the config map
+	// volume of the pods, and the checksum annotation of the pods
+	render := func(outputs string) (string, string, string) {
+		config := map[string]interface{}{"Values.logging.forwarder.outputs": outputs}
+		actual, err := renderer.RoundtripNode(configMap, config)
+		require.NoError(t, err)
+		object := actual.(map[interface{}]interface{})
+		assert.Equal(true, object["immutable"])
+		name := object["metadata"].(map[interface{}]interface{})["name"].(string)
+
+		actual, err = renderer.RoundtripNode(podTemplate, config)
+		require.NoError(t, err)
+		pod := actual.(map[interface{}]interface{})
+		var volumeName string
+		for _, volume := range pod["spec"].(map[interface{}]interface{})["volumes"].([]interface{}) {
+			volume := volume.(map[interface{}]interface{})
+			if volume["name"] == "log-forwarder-config" {
+				volumeName = volume["configMap"].(map[interface{}]interface{})["name"].(string)
+			}
+		}
+		annotations := pod["metadata"].(map[interface{}]interface{})["annotations"].(map[interface{}]interface{})
+		return name, volumeName, annotations["checksum/config"].(string)
+	}
+
+	name, volumeName, checksum := render(LogForwarderOutputs)
+	assert.Regexp(`^myrole-log-forwarder-[0-9a-f]{8}$`, name)
+	assert.Equal(name, volumeName, "The pods mount the config map by its hashed name")
+
+	changedName, changedVolumeName, changedChecksum := render("[OUTPUT]\n    Name es\n")
+	assert.NotEqual(name, changedName, "Changed outputs rename the config map")
+	assert.Equal(changedName, changedVolumeName)
+	assert.NotEqual(checksum, changedChecksum, "Changed outputs roll the pods")
+}
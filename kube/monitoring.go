@@ -0,0 +1,243 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
+)
+
+// MonitoringDashboardsName is the name of the ConfigMap holding the Grafana
+// dashboard, and of the PrometheusRule holding the alert rules
+const MonitoringDashboardsName = "monitoring-dashboards"
+
+// GrafanaDashboardLabel is the label the Grafana sidecar looks for on the
+// ConfigMaps holding dashboards
+const GrafanaDashboardLabel = "grafana_dashboard"
+
+// monitoringNamespace is the placeholder for the namespace in the dashboard,
+// replaced with the namespace of the release when the chart is rendered
+const monitoringNamespace = "__NAMESPACE__"
+
+// MetricsInstanceGroups returns the long running instance groups with ports
+// serving Prometheus metrics, in the order of the role manifest
+func MetricsInstanceGroups(manifest *model.RoleManifest) model.InstanceGroups {
+	var instanceGroups model.InstanceGroups
+	for _, instanceGroup := range manifest.InstanceGroups {
+		if instanceGroup.Type == model.RoleTypeBosh && hasMetricsPort(instanceGroup) {
+			instanceGroups = append(instanceGroups, instanceGroup)
+		}
+	}
+	return instanceGroups
+}
+
+// hasMetricsPort returns whether a job of the instance group serves metrics
+func hasMetricsPort(instanceGroup *model.InstanceGroup) bool {
+	for _, job := range instanceGroup.JobReferences {
+		for _, port := range job.ContainerProperties.BoshContainerization.Ports {
+			if port.Metrics != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MakeMonitoring generates the starter Grafana dashboard and the alert rule
+// stubs for the instance groups serving Prometheus metrics.  The dashboard
+// shows the pod health, restarts, and resource usage of each instance group;
+// the alert rules fire on crash loops and failing readiness probes.  Both are
+// only created if .Values.monitoring.dashboards.enabled is set, and the
+// alert rules only if the cluster has the Prometheus operator.  It returns
+// nothing for plain kube configs, or if no instance group serves metrics.
+func MakeMonitoring(settings ExportSettings) ([]helm.Node, error) {
+	instanceGroups := MetricsInstanceGroups(settings.RoleManifest)
+	if !settings.CreateHelmChart || len(instanceGroups) == 0 {
+		return nil, nil
+	}
+
+	dashboard, err := makeGrafanaDashboard(instanceGroups)
+	if err != nil {
+		return nil, err
+	}
+	cb := NewConfigBuilder().
+		SetSettings(&settings).
+		SetAPIVersion("v1").
+		SetKind("ConfigMap").
+		SetName(MonitoringDashboardsName).
+		AddModifier(helm.Block("if .Values.monitoring.dashboards.enabled")).
+		AddModifier(helm.Comment("Grafana dashboard of the instance groups serving metrics"))
+	configMap, err := cb.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build a new kube config: %v", err)
+	}
+	configMap.Get("metadata", "labels").(*helm.Mapping).Add(GrafanaDashboardLabel, "1")
+	// The dashboard is a raw string, so that the legends of the panels are
+	// left to Grafana
+	configMap.Add("data", helm.NewMapping(
+		"instance-groups.json",
+		fmt.Sprintf("{{ `%s` | replace %q .Release.Namespace | quote }}", dashboard, monitoringNamespace)))
+
+	cb = NewConfigBuilder().
+		SetSettings(&settings).
+		SetAPIVersion("monitoring.coreos.com/v1").
+		SetKind("PrometheusRule").
+		SetName(MonitoringDashboardsName).
+		AddModifier(helm.Block(`if and .Values.monitoring.dashboards.enabled (.Capabilities.APIVersions.Has "monitoring.coreos.com/v1")`)).
+		AddModifier(helm.Comment("Alert rules of the instance groups serving metrics"))
+	prometheusRule, err := cb.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build a new kube config: %v", err)
+	}
+	rules := helm.NewList()
+	for _, instanceGroup := range instanceGroups {
+		for _, rule := range makeAlertRules(instanceGroup) {
+			rules.Add(rule)
+		}
+	}
+	prometheusRule.Add("spec", helm.NewMapping("groups", helm.NewList(helm.NewMapping(
+		"name", "{{ .Release.Name }}.instance-groups",
+		"rules", rules))))
+
+	return []helm.Node{configMap.Sort(), prometheusRule.Sort()}, nil
+}
+
+// containerSelector returns the PromQL label matchers selecting the main
+// container of the instance group in the namespace
+func containerSelector(instanceGroup *model.InstanceGroup, namespace string) string {
+	return fmt.Sprintf(`namespace="%s", container="%s"`, namespace, kubeName(instanceGroup.Name))
+}
+
+// makeAlertRules returns the alert rule stubs of the instance group
+func makeAlertRules(instanceGroup *model.InstanceGroup) []helm.Node {
+	name := kubeName(instanceGroup.Name)
+	selector := containerSelector(instanceGroup, "{{ .Release.Namespace }}")
+	alertName := func(suffix string) string {
+		return alertPrefix(instanceGroup.Name) + suffix
+	}
+
+	crashLooping := helm.NewMapping(
+		"alert", alertName("CrashLooping"),
+		"expr", fmt.Sprintf("increase(kube_pod_container_status_restarts_total{%s}[15m]) > 2", selector),
+		"for", "5m",
+		"labels", helm.NewMapping("severity", "warning"),
+		"annotations", helm.NewMapping(
+			"summary", fmt.Sprintf("The %s container is crash looping", name),
+			"description", fmt.Sprintf("{{`{{ $labels.pod }}`}} restarted the %s container {{`{{ $value }}`}} times in 15 minutes.", name)))
+
+	notReady := helm.NewMapping(
+		"alert", alertName("NotReady"),
+		"expr", fmt.Sprintf("kube_pod_container_status_ready{%s} == 0", selector),
+		"for", "15m",
+		"labels", helm.NewMapping("severity", "warning"),
+		"annotations", helm.NewMapping(
+			"summary", fmt.Sprintf("The readiness probe of the %s container is failing", name),
+			"description", fmt.Sprintf("The %s container of {{`{{ $labels.pod }}`}} has not been ready for 15 minutes.", name)))
+
+	return []helm.Node{crashLooping, notReady}
+}
+
+// alertPrefix turns an instance group name into the CamelCase prefix of its
+// alert names, e.g. "diego-cell" into "DiegoCell"
+func alertPrefix(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, "")
+}
+
+// grafanaPanel is a graph panel of the Grafana dashboard
+type grafanaPanel struct {
+	ID          int                    `json:"id"`
+	Title       string                 `json:"title"`
+	Type        string                 `json:"type"`
+	Datasource  string                 `json:"datasource"`
+	GridPos     map[string]int         `json:"gridPos"`
+	Targets     []grafanaTarget        `json:"targets,omitempty"`
+	FieldConfig map[string]interface{} `json:"fieldConfig,omitempty"`
+	Collapsed   *bool                  `json:"collapsed,omitempty"`
+}
+
+// grafanaTarget is a Prometheus query of a panel
+type grafanaTarget struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+	RefID        string `json:"refId"`
+}
+
+// makeGrafanaDashboard returns the JSON of the dashboard, with a row of
+// panels for each instance group
+func makeGrafanaDashboard(instanceGroups model.InstanceGroups) (string, error) {
+	var panels []grafanaPanel
+	y := 0
+	for _, instanceGroup := range instanceGroups {
+		selector := containerSelector(instanceGroup, monitoringNamespace)
+		collapsed := false
+		panels = append(panels, grafanaPanel{
+			ID:         len(panels) + 1,
+			Title:      instanceGroup.Name,
+			Type:       "row",
+			Datasource: "$datasource",
+			GridPos:    map[string]int{"x": 0, "y": y, "w": 24, "h": 1},
+			Collapsed:  &collapsed,
+		})
+		y++
+
+		queries := []struct {
+			title string
+			unit  string
+			expr  string
+		}{
+			{"Ready pods", "short", fmt.Sprintf("sum(kube_pod_container_status_ready{%s})", selector)},
+			{"Restarts", "short", fmt.Sprintf("sum by (pod) (increase(kube_pod_container_status_restarts_total{%s}[5m]))", selector)},
+			{"CPU usage", "short", fmt.Sprintf("sum by (pod) (rate(container_cpu_usage_seconds_total{%s}[5m]))", selector)},
+			{"Memory usage", "bytes", fmt.Sprintf("sum by (pod) (container_memory_working_set_bytes{%s})", selector)},
+		}
+		for i, query := range queries {
+			legend := "{{pod}}"
+			if i == 0 {
+				legend = "ready"
+			}
+			panels = append(panels, grafanaPanel{
+				ID:          len(panels) + 1,
+				Title:       query.title,
+				Type:        "timeseries",
+				Datasource:  "$datasource",
+				GridPos:     map[string]int{"x": i * 6, "y": y, "w": 6, "h": 8},
+				Targets:     []grafanaTarget{{Expr: query.expr, LegendFormat: legend, RefID: "A"}},
+				FieldConfig: map[string]interface{}{"defaults": map[string]string{"unit": query.unit}},
+			})
+		}
+		y += 8
+	}
+
+	dashboard := map[string]interface{}{
+		"title":         "Instance groups (" + monitoringNamespace + ")",
+		"uid":           "fissile-" + monitoringNamespace,
+		"tags":          []string{"fissile"},
+		"timezone":      "browser",
+		"schemaVersion": 27,
+		"refresh":       "30s",
+		"time":          map[string]string{"from": "now-6h", "to": "now"},
+		"templating": map[string]interface{}{
+			"list": []map[string]interface{}{{
+				"name":  "datasource",
+				"label": "Data source",
+				"type":  "datasource",
+				"query": "prometheus",
+			}},
+		},
+		"panels": panels,
+	}
+	buf, err := json.Marshal(dashboard)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,123 @@
+package kube
+
+import (
+	"encoding/json"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/helm/render"
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeMonitoring(t *testing.T) {
+	t.Parallel()
+
+	t.Run("NoMetrics", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+		manifest, role := serviceTestLoadRole(assert, "exposed-ports.yml")
+		if manifest == nil || role == nil {
+			return
+		}
+		assert.Empty(MetricsInstanceGroups(manifest))
+
+		nodes, err := MakeMonitoring(ExportSettings{RoleManifest: manifest, CreateHelmChart: true})
+		require.NoError(t, err)
+		assert.Empty(nodes)
+	})
+
+	t.Run("Kube", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+		manifest, role := serviceTestLoadRole(assert, "exposed-ports-metrics.yml")
+		if manifest == nil || role == nil {
+			return
+		}
+
+		nodes, err := MakeMonitoring(ExportSettings{RoleManifest: manifest})
+		require.NoError(t, err)
+		assert.Empty(nodes)
+	})
+
+	t.Run("Helm", func(t *testing.T) {
+		t.Parallel()
+		assert := assert.New(t)
+		manifest, role := serviceTestLoadRole(assert, "exposed-ports-metrics.yml")
+		if manifest == nil || role == nil {
+			return
+		}
+		assert.Equal([]string{"myrole"}, []string{MetricsInstanceGroups(manifest)[0].Name})
+
+		nodes, err := MakeMonitoring(ExportSettings{RoleManifest: manifest, CreateHelmChart: true})
+		require.NoError(t, err)
+		require.Len(t, nodes, 2)
+
+		config := map[string]interface{}{
+			"Release.Namespace":                    "cf",
+			"Values.monitoring.dashboards.enabled": true,
+		}
+
+		actual, err := RoundtripNode(nodes[0], config)
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert, `---
+			apiVersion: v1
+			kind: ConfigMap
+			metadata:
+				name: monitoring-dashboards
+				labels:
+					grafana_dashboard: "1"
+		`, actual)
+
+		data := actual.(map[interface{}]interface{})["data"].(map[interface{}]interface{})
+		var dashboard struct {
+			Title  string `json:"title"`
+			Panels []struct {
+				Title   string `json:"title"`
+				Targets []struct {
+					Expr         string `json:"expr"`
+					LegendFormat string `json:"legendFormat"`
+				} `json:"targets"`
+			} `json:"panels"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(data["instance-groups.json"].(string)), &dashboard))
+		assert.Equal("Instance groups (cf)", dashboard.Title)
+		require.Len(t, dashboard.Panels, 5)
+		assert.Equal("myrole", dashboard.Panels[0].Title)
+		assert.Equal("Restarts", dashboard.Panels[2].Title)
+		require.Len(t, dashboard.Panels[2].Targets, 1)
+		assert.Equal(`sum by (pod) (increase(kube_pod_container_status_restarts_total{namespace="cf", container="myrole"}[5m]))`,
+			dashboard.Panels[2].Targets[0].Expr)
+		assert.Equal("{{pod}}", dashboard.Panels[2].Targets[0].LegendFormat)
+
+		actual, err = RoundtripNode(nodes[1], config)
+		require.NoError(t, err)
+		assert.Nil(actual, "Alert rules need the Prometheus operator")
+
+		config["Capabilities.APIVersions"] = &render.APIVersions{"monitoring.coreos.com/v1": true}
+		actual, err = RoundtripNode(nodes[1], config)
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert, `---
+			apiVersion: monitoring.coreos.com/v1
+			kind: PrometheusRule
+			metadata:
+				name: monitoring-dashboards
+			spec:
+				groups:
+				-	rules:
+					-	alert: MyroleCrashLooping
+						expr: increase(kube_pod_container_status_restarts_total{namespace="cf", container="myrole"}[15m]) > 2
+						annotations:
+							description: "{{ $labels.pod }} restarted the myrole container {{ $value }} times in 15 minutes."
+					-	alert: MyroleNotReady
+						expr: kube_pod_container_status_ready{namespace="cf", container="myrole"} == 0
+		`, actual)
+
+		config["Values.monitoring.dashboards.enabled"] = false
+		for _, node := range nodes {
+			actual, err = RoundtripNode(node, config)
+			require.NoError(t, err)
+			assert.Nil(actual)
+		}
+	})
+}
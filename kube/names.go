@@ -0,0 +1,149 @@
+package kube
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+	"code.cloudfoundry.org/fissile/validation"
+)
+
+const (
+	// maxKubeNameLength is the maximum length of object names and label values
+	maxKubeNameLength = 63
+	// maxPortNameLength is the maximum length of port names (IANA service names)
+	maxPortNameLength = 15
+)
+
+// kubeName converts a name from the role manifest into a valid kubernetes
+// object name, container name, or label value.  Valid names are unchanged.
+func kubeName(name string) string {
+	return util.SanitizeKubeName(name, maxKubeNameLength)
+}
+
+// makePortName returns the name of one port of a port definition with
+// multiple ports.  The name of the definition is cut as needed to leave room
+// for the suffix within the kubernetes limit for port names.
+func makePortName(name string, suffix interface{}) string {
+	suffixString := fmt.Sprintf("-%v", suffix)
+	if len(name)+len(suffixString) > maxPortNameLength && !strings.Contains(suffixString, "{{") {
+		if cut := maxPortNameLength - len(suffixString); cut < len(name) {
+			name = strings.TrimRight(name[:cut], "-")
+		}
+	}
+	return name + suffixString
+}
+
+// ValidateNames checks that converting the names of the role manifest into
+// kubernetes names (see kubeName and makePortName) keeps them distinct:
+// instance groups, service accounts, and roles must not share a name, and the
+// ports of a pod, or of the services of an instance group, must not share a
+// port name.
+func ValidateNames(settings ExportSettings) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+	manifest := settings.RoleManifest
+
+	var instanceGroupNames []string
+	for _, instanceGroup := range manifest.InstanceGroups {
+		instanceGroupNames = append(instanceGroupNames, instanceGroup.Name)
+	}
+	allErrs = append(allErrs, validateDistinctNames("instance_groups", instanceGroupNames)...)
+
+	if manifest.Configuration != nil {
+		authorization := manifest.Configuration.Authorization
+		var accountNames, roleNames, clusterRoleNames []string
+		for name := range authorization.Accounts {
+			accountNames = append(accountNames, name)
+		}
+		for name := range authorization.Roles {
+			roleNames = append(roleNames, name)
+		}
+		for name := range authorization.ClusterRoles {
+			clusterRoleNames = append(clusterRoleNames, name)
+		}
+		for name := range authorization.AggregatedClusterRoles {
+			clusterRoleNames = append(clusterRoleNames, name)
+		}
+		allErrs = append(allErrs, validateDistinctNames("configuration.auth.accounts", accountNames)...)
+		allErrs = append(allErrs, validateDistinctNames("configuration.auth.roles", roleNames)...)
+		allErrs = append(allErrs, validateDistinctNames("configuration.auth.cluster-roles", clusterRoleNames)...)
+	}
+
+	for _, instanceGroup := range manifest.InstanceGroups {
+		if instanceGroup.IsColocated() {
+			continue
+		}
+		containerPorts := make(map[string]string)
+		servicePorts := make(map[string]string)
+		for _, candidate := range append(model.InstanceGroups{instanceGroup}, instanceGroup.GetColocatedRoles()...) {
+			for _, job := range candidate.JobReferences {
+				for _, port := range job.ContainerProperties.BoshContainerization.Ports {
+					field := fmt.Sprintf("instance_groups[%s].jobs[%s].properties.bosh_containerization.ports[%s]",
+						candidate.Name, job.Name, port.Name)
+					containerNames, serviceNames := portNames(port, settings)
+					allErrs = append(allErrs, claimPortNames(containerPorts, field, containerNames)...)
+					if candidate == instanceGroup {
+						allErrs = append(allErrs, claimPortNames(servicePorts, field, serviceNames)...)
+					}
+				}
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// validateDistinctNames checks that no two of the names are the same once
+// converted into kubernetes names.
+func validateDistinctNames(field string, names []string) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+	owners := make(map[string]string)
+	sort.Strings(names)
+	for _, name := range names {
+		converted := kubeName(name)
+		if owner, ok := owners[converted]; ok {
+			allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("%s[%s]", field, name), converted,
+				fmt.Sprintf("kubernetes name is also used by %s[%s]", field, owner)))
+			continue
+		}
+		owners[converted] = name
+	}
+	return allErrs
+}
+
+// portNames returns the names of the container ports and of the service ports
+// generated for a port definition.
+func portNames(port model.JobExposedPort, settings ExportSettings) ([]string, []string) {
+	if port.Max <= 1 {
+		return []string{port.Name}, []string{port.Name}
+	}
+	var containerNames, serviceNames []string
+	if settings.CreateHelmChart && port.CountIsConfigurable {
+		for index := 0; index < port.Max; index++ {
+			containerNames = append(containerNames, makePortName(port.Name, index))
+		}
+		return containerNames, containerNames
+	}
+	for index := 0; index < port.Count; index++ {
+		containerNames = append(containerNames, makePortName(port.Name, port.InternalPort+index))
+		serviceNames = append(serviceNames, makePortName(port.Name, index))
+	}
+	return containerNames, serviceNames
+}
+
+// claimPortNames records the port names of a port definition, and returns
+// errors for names already used by another port definition.
+func claimPortNames(owners map[string]string, field string, names []string) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+	for _, name := range names {
+		if owner, ok := owners[name]; ok && owner != field {
+			allErrs = append(allErrs, validation.Invalid(field, name,
+				fmt.Sprintf("port name is also used by %s", owner)))
+			continue
+		}
+		owners[name] = field
+	}
+	return allErrs
+}
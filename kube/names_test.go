@@ -0,0 +1,126 @@
+package kube
+
+import (
+	"strings"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakePortName(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	assert.Equal("http-0", makePortName("http", 0))
+	assert.Equal("http-8080", makePortName("http", 8080))
+	assert.Equal("tcp-route-{{ $port }}", makePortName("tcp-route", "{{ $port }}"))
+	assert.Equal("long-name-20000", makePortName("long-name-port", 20000))
+	assert.Equal("abcdefgh-20000", makePortName("abcdefgh-xyz", 20000), "Dashes before the suffix should be removed")
+	for _, name := range []string{makePortName("fifteen-letters", 12345), makePortName("fifteen-letters", 1)} {
+		assert.True(len(name) <= maxPortNameLength, "Port name %s is too long", name)
+	}
+}
+
+func TestNewKubeConfigSanitizesName(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	cb := NewConfigBuilder().
+		SetSettings(&ExportSettings{}).
+		SetAPIVersion("v1").
+		SetKind("Pod").
+		SetName("My_Role")
+	kubeConfig, err := cb.Build()
+	require.NoError(t, err)
+
+	actual, err := RoundtripKube(kubeConfig)
+	require.NoError(t, err)
+	testhelpers.IsYAMLEqualString(assert, `---
+		apiVersion: "v1"
+		kind: "Pod"
+		metadata:
+			name: "my-role"
+			labels:
+				app.kubernetes.io/component: "my-role"
+	`, actual)
+
+	cb = NewConfigBuilder().
+		SetSettings(&ExportSettings{}).
+		SetAPIVersion("v1").
+		SetKind("Pod").
+		SetName(strings.Repeat("x", 100))
+	kubeConfig, err = cb.Build()
+	require.NoError(t, err)
+	name := kubeConfig.Get("metadata", "name").String()
+	assert.Len(name, maxKubeNameLength)
+	assert.Equal(name, newSelector(&model.InstanceGroup{Name: strings.Repeat("x", 100)}, ExportSettings{}).
+		Get("matchLabels", "skiff-role-name").String(), "Selectors must match the sanitized name")
+}
+
+func TestValidateNames(t *testing.T) {
+	t.Parallel()
+
+	newInstanceGroup := func(name string, ports ...model.JobExposedPort) *model.InstanceGroup {
+		job := &model.JobReference{Name: "job"}
+		job.ContainerProperties.BoshContainerization.Ports = ports
+		return &model.InstanceGroup{
+			Name:          name,
+			Type:          model.RoleTypeBosh,
+			JobReferences: model.JobReferences{job},
+		}
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{RoleManifest: &model.RoleManifest{
+			InstanceGroups: model.InstanceGroups{
+				newInstanceGroup("one",
+					model.JobExposedPort{Name: "http", InternalPort: 80, Count: 1, Max: 1},
+					model.JobExposedPort{Name: "ports", InternalPort: 2000, Count: 10, Max: 10}),
+				newInstanceGroup("two",
+					model.JobExposedPort{Name: "http", InternalPort: 80, Count: 1, Max: 1}),
+			},
+		}}
+		assert.Empty(t, ValidateNames(settings))
+	})
+
+	t.Run("InstanceGroups", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{RoleManifest: &model.RoleManifest{
+			InstanceGroups: model.InstanceGroups{newInstanceGroup("my-role"), newInstanceGroup("my_role")},
+		}}
+		assert.Equal(t, []string{
+			`instance_groups[my_role]: Invalid value: "my-role": kubernetes name is also used by instance_groups[my-role]`,
+		}, ValidateNames(settings).ErrorStrings())
+	})
+
+	t.Run("Accounts", func(t *testing.T) {
+		t.Parallel()
+		configuration := &model.Configuration{}
+		configuration.Authorization.Accounts = map[string]model.AuthAccount{
+			"Some_Account": {},
+			"some-account": {},
+		}
+		settings := ExportSettings{RoleManifest: &model.RoleManifest{Configuration: configuration}}
+		assert.Equal(t, []string{
+			`configuration.auth.accounts[some-account]: Invalid value: "some-account": kubernetes name is also used by configuration.auth.accounts[Some_Account]`,
+		}, ValidateNames(settings).ErrorStrings())
+	})
+
+	t.Run("Ports", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{RoleManifest: &model.RoleManifest{
+			InstanceGroups: model.InstanceGroups{
+				newInstanceGroup("myrole",
+					model.JobExposedPort{Name: "routers-alpha", InternalPort: 20000, Count: 2, Max: 2},
+					model.JobExposedPort{Name: "routers-alpine", InternalPort: 20001, Count: 2, Max: 2}),
+			},
+		}}
+		assert.Equal(t, []string{
+			`instance_groups[myrole].jobs[job].properties.bosh_containerization.ports[routers-alpine]: Invalid value: "routers-a-20001": port name is also used by instance_groups[myrole].jobs[job].properties.bosh_containerization.ports[routers-alpha]`,
+		}, ValidateNames(settings).ErrorStrings())
+	})
+}
@@ -0,0 +1,178 @@
+package kube
+
+import (
+	"fmt"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
+)
+
+// RouteTLSTermination is the TLS termination of the generated OpenShift
+// routes of ports without TLS settings, unless overridden in values.yaml.
+// Those ports serve plain traffic, so the router terminates TLS.
+const RouteTLSTermination = "edge"
+
+// newRoutes creates an OpenShift route for each public port of the job,
+// pointing at its public service.  Port ranges cannot be routed, and neither
+// can UDP ports.  Ports with TLS settings get edge or passthrough termination.
+func newRoutes(role *model.InstanceGroup, job *model.JobReference, settings ExportSettings) ([]helm.Node, error) {
+	var routes []helm.Node
+	serviceName := job.ServiceName(role.Name) + "-public"
+
+	for _, port := range job.ContainerProperties.BoshContainerization.Ports {
+		if !port.Public || port.Max > 1 || port.Protocol == "UDP" {
+			continue
+		}
+
+		spec := helm.NewMapping()
+		spec.Add("to", helm.NewMapping(
+			"kind", "Service",
+			"name", serviceName,
+			"weight", 100))
+		spec.Add("port", helm.NewMapping("targetPort", port.Name))
+		if port.TLS != nil {
+			// The TLS settings of the port take precedence over the chart values
+			termination := "edge"
+			if port.TLS.Terminate == model.PortTLSPassthrough {
+				termination = "passthrough"
+			}
+			spec.Add("tls", helm.NewMapping("termination", termination))
+		} else if settings.CreateHelmChart {
+			tls := helm.NewMapping("termination", "{{ .Values.routes.tls_termination | quote }}")
+			tls.Set(helm.Block("if .Values.routes.tls_termination"))
+			spec.Add("tls", tls)
+		} else {
+			spec.Add("tls", helm.NewMapping("termination", RouteTLSTermination))
+		}
+
+		cb := NewConfigBuilder().
+			SetSettings(&settings).
+			SetAPIVersion("route.openshift.io/v1").
+			SetKind("Route").
+			SetName(fmt.Sprintf("%s-%s", serviceName, port.Name)).
+			SetInstanceGroup(role)
+		if settings.CreateHelmChart {
+			condition := ".Values.routes.enabled"
+			if port.CountIsConfigurable {
+				condition = fmt.Sprintf("and %s (int .Values.sizing.%s.ports.%s.count)",
+					condition, makeVarName(role.Name), makeVarName(port.Name))
+			}
+			cb.AddModifier(helm.Block("if " + condition))
+		}
+		route, err := cb.Build()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build a new kube config: %v", err)
+		}
+		route.Add("spec", spec.Sort())
+		routes = append(routes, route)
+	}
+
+	return routes, nil
+}
+
+// sccRuleFor returns the RBAC rule granting the use of the security context
+// constraints generated for the pod security policies of the rule, as
+// OpenShift enforces those instead.
+func sccRuleFor(ruleSpec model.AuthRule, settings ExportSettings) helm.Node {
+	resourceNames := helm.NewList()
+	for _, resourceName := range ruleSpec.ResourceNames {
+		if settings.CreateHelmChart {
+			resourceNames.Add(fmt.Sprintf(
+				`{{ if .Values.kube.scc.%[1]s }}{{ .Values.kube.scc.%[1]s }}{{ else }}`+
+					`{{ template "fissile.SanitizeName" (printf "%%s-scc-%[1]s" .Release.Namespace) }}{{ end }}`, resourceName))
+		} else {
+			resourceNames.Add(resourceName)
+		}
+	}
+	rule := helm.NewMapping(
+		"apiGroups", helm.NewList("security.openshift.io"),
+		"resources", helm.NewList("securitycontextconstraints"),
+		"verbs", helm.NewList("use"),
+		"resourceNames", resourceNames)
+	return rule.Sort()
+}
+
+// NewSecurityContextConstraints creates the OpenShift security context
+// constraints equivalent to a pod security policy.  Fixed user and group ranges
+// are not carried over: the constraints use the ranges OpenShift assigns to
+// the namespace instead.
+func NewSecurityContextConstraints(name string, psp *model.PodSecurityPolicy, settings ExportSettings) (helm.Node, error) {
+	definition, _ := psp.Definition.(map[interface{}]interface{})
+	boolean := func(key string, defaultValue bool) bool {
+		if value, ok := definition[key].(bool); ok {
+			return value
+		}
+		return defaultValue
+	}
+	strategy := func(key string) string {
+		if value, ok := definition[key].(map[interface{}]interface{}); ok {
+			rule, _ := value["rule"].(string)
+			return rule
+		}
+		return ""
+	}
+	names := func(key string) []string {
+		var items []string
+		if values, ok := definition[key].([]interface{}); ok {
+			for _, value := range values {
+				items = append(items, fmt.Sprintf("%v", value))
+			}
+		}
+		return items
+	}
+
+	volumes := names("volumes")
+	allowHostDir := util.StringInSlice("hostPath", volumes) || util.StringInSlice("*", volumes)
+	hostPorts, _ := definition["hostPorts"].([]interface{})
+
+	// PSP rules are MustRunAs, MustRunAsNonRoot, MayRunAs, or RunAsAny, while
+	// SCCs only know about ranges assigned to the namespace.
+	runAsUser := "MustRunAsRange"
+	switch strategy("runAsUser") {
+	case "RunAsAny", "MustRunAsNonRoot":
+		runAsUser = strategy("runAsUser")
+	}
+	groupStrategy := func(key string) string {
+		if strategy(key) == "RunAsAny" {
+			return "RunAsAny"
+		}
+		return "MustRunAs"
+	}
+
+	cb := NewConfigBuilder().
+		SetSettings(&settings).
+		SetAPIVersion("security.openshift.io/v1").
+		SetKind("SecurityContextConstraints").
+		AddModifier(helm.Comment(fmt.Sprintf(`Security context constraints for pod security policy "%s"`, name)))
+	if settings.CreateHelmChart {
+		cb.AddModifier(helm.Block(fmt.Sprintf(`if and (%s) (not .Values.kube.scc.%s)`,
+			`eq (printf "%s" .Values.kube.auth) "rbac"`, name)))
+		cb.SetNameHelmExpression(fmt.Sprintf(`{{ template "fissile.SanitizeName" (printf "%%s-scc-%s" .Release.Namespace) }}`, name))
+	} else {
+		cb.SetName(name)
+	}
+	node, err := cb.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build a new kube config: %v", err)
+	}
+	node.Add("allowPrivilegedContainer", boolean("privileged", false))
+	node.Add("allowPrivilegeEscalation", boolean("allowPrivilegeEscalation", true))
+	node.Add("allowHostDirVolumePlugin", allowHostDir)
+	node.Add("allowHostIPC", boolean("hostIPC", false))
+	node.Add("allowHostNetwork", boolean("hostNetwork", false))
+	node.Add("allowHostPID", boolean("hostPID", false))
+	node.Add("allowHostPorts", len(hostPorts) > 0)
+	node.Add("readOnlyRootFilesystem", boolean("readOnlyRootFilesystem", false))
+	node.Add("allowedCapabilities", names("allowedCapabilities"))
+	node.Add("defaultAddCapabilities", names("defaultAddCapabilities"))
+	node.Add("requiredDropCapabilities", names("requiredDropCapabilities"))
+	node.Add("volumes", volumes)
+	node.Add("runAsUser", helm.NewMapping("type", runAsUser))
+	node.Add("seLinuxContext", helm.NewMapping("type", groupStrategy("seLinux")))
+	node.Add("fsGroup", helm.NewMapping("type", groupStrategy("fsGroup")))
+	node.Add("supplementalGroups", helm.NewMapping("type", groupStrategy("supplementalGroups")))
+	node.Add("users", helm.NewList())
+	node.Add("groups", helm.NewList())
+	return node, nil
+}
@@ -0,0 +1,284 @@
+package kube
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestNewRoutesKube(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "exposed-ports.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	routes, err := newRoutes(role, role.JobReferences[0], ExportSettings{OpenShift: true})
+	require.NoError(t, err)
+	require.Len(t, routes, 1, "Only the public port is routed")
+
+	actual, err := RoundtripKube(routes[0])
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		apiVersion: route.openshift.io/v1
+		kind: Route
+		metadata:
+			name: myrole-tor-public-https
+		spec:
+			to:
+				kind: Service
+				name: myrole-tor-public
+				weight: 100
+			port:
+				targetPort: https
+			tls:
+				termination: edge
+	`, actual)
+}
+
+func TestNewRoutesHelm(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "exposed-ports.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	routes, err := newRoutes(role, role.JobReferences[0], ExportSettings{OpenShift: true, CreateHelmChart: true})
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(routes[0], map[string]interface{}{
+			"Values.routes.enabled": false,
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLEqualString(assert, `---
+		`, actual)
+	})
+
+	t.Run("Edge", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(routes[0], map[string]interface{}{
+			"Values.routes.enabled":         true,
+			"Values.routes.tls_termination": "edge",
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert, `---
+			spec:
+				port:
+					targetPort: https
+				tls:
+					termination: edge
+		`, actual)
+	})
+
+	t.Run("NoTLS", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(routes[0], map[string]interface{}{
+			"Values.routes.enabled":         true,
+			"Values.routes.tls_termination": "",
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert, `---
+			spec:
+				port:
+					targetPort: https
+				to:
+					kind: Service
+					name: myrole-tor-public
+					weight: 100
+		`, actual)
+		assert.NotContains(actual, "tls")
+	})
+}
+
+func TestNewRoutesPortTLS(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "exposed-ports-tls.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	routes, err := newRoutes(role, role.JobReferences[0], ExportSettings{OpenShift: true, CreateHelmChart: true})
+	require.NoError(t, err)
+	require.Len(t, routes, 4)
+
+	expected := []string{"edge", "edge", "passthrough"}
+	for i, termination := range expected {
+		actual, err := RoundtripNode(routes[i], map[string]interface{}{
+			"Values.routes.enabled":         true,
+			"Values.routes.tls_termination": "reencrypt",
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert, `---
+			spec:
+				tls:
+					termination: `+termination+`
+		`, actual)
+	}
+
+	actual, err := RoundtripNode(routes[3], map[string]interface{}{
+		"Values.routes.enabled":         true,
+		"Values.routes.tls_termination": "reencrypt",
+	})
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		spec:
+			port:
+				targetPort: http
+			tls:
+				termination: reencrypt
+	`, actual)
+}
+
+func TestServiceListOpenShift(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "exposed-ports.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	kinds := func(settings ExportSettings) []string {
+		list, err := NewServiceList(role, false, settings)
+		require.NoError(t, err)
+		var result []string
+		for _, item := range list.Get("items").Values() {
+			result = append(result, item.Get("kind").String())
+		}
+		return result
+	}
+	assert.Equal([]string{"Service", "Service"}, kinds(ExportSettings{}))
+	assert.Equal([]string{"Service", "Service", "Route"}, kinds(ExportSettings{OpenShift: true}))
+}
+
+func TestNewSecurityContextConstraints(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	psp := &model.PodSecurityPolicy{}
+	require.NoError(t, yaml.Unmarshal([]byte(`
+privileged: true
+allowedCapabilities: [NET_ADMIN]
+volumes: [configMap, hostPath]
+hostNetwork: true
+hostPorts:
+- min: 0
+  max: 65535
+runAsUser:
+  rule: MustRunAs
+  ranges:
+  - min: 1000
+    max: 1000
+fsGroup:
+  rule: RunAsAny
+`), psp))
+
+	scc, err := NewSecurityContextConstraints("privileged", psp, ExportSettings{})
+	require.NoError(t, err)
+	actual, err := RoundtripKube(scc)
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		apiVersion: security.openshift.io/v1
+		kind: SecurityContextConstraints
+		metadata:
+			name: privileged
+		allowPrivilegedContainer: true
+		allowPrivilegeEscalation: true
+		allowHostDirVolumePlugin: true
+		allowHostIPC: false
+		allowHostNetwork: true
+		allowHostPID: false
+		allowHostPorts: true
+		readOnlyRootFilesystem: false
+		allowedCapabilities: [NET_ADMIN]
+		volumes: [configMap, hostPath]
+		runAsUser:
+			type: MustRunAsRange
+		seLinuxContext:
+			type: MustRunAs
+		fsGroup:
+			type: RunAsAny
+		supplementalGroups:
+			type: MustRunAs
+	`, actual)
+
+	scc, err = NewSecurityContextConstraints("privileged", psp, ExportSettings{CreateHelmChart: true})
+	require.NoError(t, err)
+
+	actual, err = RoundtripNode(scc, map[string]interface{}{
+		"Values.kube.auth":           "rbac",
+		"Values.kube.scc.privileged": "anyuid",
+	})
+	require.NoError(t, err)
+	testhelpers.IsYAMLEqualString(assert, `---
+	`, actual)
+
+	actual, err = RoundtripNode(scc, map[string]interface{}{
+		"Values.kube.auth":           "rbac",
+		"Values.kube.scc.privileged": "",
+		"Release.Namespace":          "namespace",
+	})
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		metadata:
+			name: namespace-scc-privileged
+		allowPrivilegedContainer: true
+	`, actual)
+}
+
+func TestNewRBACRoleOpenShift(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	rules := []model.AuthRule{
+		{
+			APIGroups:     []string{"policy"},
+			Resources:     []string{"podsecuritypolicies"},
+			ResourceNames: []string{"privileged"},
+			Verbs:         []string{"use"},
+		},
+	}
+
+	rbacRole, err := NewRBACRole("the-name", RBACRoleKindRole, rules, ExportSettings{OpenShift: true})
+	require.NoError(t, err)
+	actual, err := RoundtripKube(rbacRole)
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		rules:
+		-	apiGroups: [policy]
+			resources: [podsecuritypolicies]
+			resourceNames: [privileged]
+			verbs: [use]
+		-	apiGroups: [security.openshift.io]
+			resources: [securitycontextconstraints]
+			resourceNames: [privileged]
+			verbs: [use]
+	`, actual)
+
+	rbacRole, err = NewRBACRole("the-name", RBACRoleKindRole, rules, ExportSettings{OpenShift: true, CreateHelmChart: true})
+	require.NoError(t, err)
+	actual, err = RoundtripNode(rbacRole, map[string]interface{}{
+		"Values.kube.auth":           "rbac",
+		"Values.kube.psp.privileged": "restricted",
+		"Values.kube.scc.privileged": "anyuid",
+	})
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		rules:
+		-	resourceNames: [restricted]
+		-	resourceNames: [anyuid]
+	`, actual)
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -19,6 +18,10 @@ import (
 // defaultInitialDelaySeconds is the default initial delay for liveness probes
 const defaultInitialDelaySeconds = 600
 
+// devModeInitialDelaySeconds is the longest initial delay of probes in
+// development mode
+const devModeInitialDelaySeconds = 30
+
 // NewPodTemplate creates a new pod template spec for a given role, as well as
 // any objects it depends on
 func NewPodTemplate(role *model.InstanceGroup, settings ExportSettings, grapher util.ModelGrapher) (helm.Node, error) {
@@ -33,22 +36,42 @@ func NewPodTemplate(role *model.InstanceGroup, settings ExportSettings, grapher
 			return nil, err
 		}
 
+		if mount := sysLogMount(role, settings); mount != nil {
+			containerMapping.Get("volumeMounts").(*helm.List).Add(mount)
+		}
 		node := helm.NewNode(containerMapping)
 		addFeatureCheck(candidate, node)
 		containers.Add(node)
 	}
+	for _, sidecar := range getLogSidecars(role, settings) {
+		containers.Add(sidecar)
+	}
 
-	imagePullSecrets := helm.NewMapping("name", "registry-credentials")
+	initContainers, err := getStartupInitContainers(role, settings, grapher)
+	if err != nil {
+		return nil, err
+	}
 
 	spec := helm.NewMapping()
 	spec.Add("containers", containers)
-	spec.Add("imagePullSecrets", helm.NewList(imagePullSecrets))
+	if initContainers != nil {
+		spec.Add("initContainers", initContainers)
+	}
+	spec.Add("imagePullSecrets", getImagePullSecrets(settings))
 	spec.Add("dnsPolicy", "ClusterFirst")
-	spec.Add("volumes", getNonClaimVolumes(role, settings))
+	volumes := getNonClaimVolumes(role, settings)
+	addLogSidecarVolumes(role, settings, volumes.(*helm.List))
+	spec.Add("volumes", volumes)
 	spec.Add("restartPolicy", "Always")
-	spec.Add("serviceAccountName", role.Run.ServiceAccount, authModeRBAC(settings))
-	if settings.CreateHelmChart {
-		spec.Get("imagePullSecrets").Set(helm.Block(`if ne .Values.kube.registry.username ""`))
+	spec.Add("serviceAccountName", kubeName(role.Run.ServiceAccount), authModeRBAC(settings))
+	if securityContext := getPodSecurityContext(role, settings); securityContext != nil {
+		spec.Add("securityContext", securityContext)
+	}
+	if role.Run.Hostname != "" {
+		spec.Add("hostname", role.Run.Hostname)
+	}
+	if role.Run.Subdomain != "" {
+		spec.Add("subdomain", role.Run.Subdomain)
 	}
 	// BOSH can potentially have an infinite termination grace period; we don't
 	// really trust that, so we'll just go with ten minutes and hope it's enough
@@ -62,19 +85,29 @@ func NewPodTemplate(role *model.InstanceGroup, settings ExportSettings, grapher
 		SetSettings(&settings).
 		SetAPIVersion("v1").
 		SetKind("Pod").
-		SetName(role.Name)
+		SetName(role.Name).
+		SetInstanceGroup(role)
 	pod, err := cb.Build()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build a new kube config: %v", err)
 	}
 	meta := pod.Get("metadata").(*helm.Mapping)
+	addContainerJobsAnnotations(meta, role, settings)
 	if settings.CreateHelmChart {
-		annotations := helm.NewMapping()
-		annotations.Add("checksum/config", `{{ include (print $.Template.BasePath "/secrets.yaml") . | sha256sum }}`)
+		annotations, ok := meta.Get("annotations").(*helm.Mapping)
+		if !ok {
+			annotations = helm.NewMapping()
+			meta.Add("annotations", annotations)
+		}
+		checksum, err := configChecksum(role, settings)
+		if err != nil {
+			return nil, err
+		}
+		annotations.Add("checksum/config", checksum)
 		if role.Type == model.RoleTypeBosh && !role.HasTag(model.RoleTagIstioManaged) {
 			annotations.Add("sidecar.istio.io/inject", "false", helm.Block("if .Values.config.use_istio"))
 		}
-		meta.Add("annotations", annotations)
+		annotations.Sort()
 	}
 	podTemplate.Add("metadata", meta)
 	podTemplate.Add("spec", spec)
@@ -82,6 +115,83 @@ func NewPodTemplate(role *model.InstanceGroup, settings ExportSettings, grapher
 	return podTemplate, nil
 }
 
+// defaultPullSecretCondition is true when the pods use the registry-credentials
+// secret: the list of pull secrets is not set, and there is a registry user
+const defaultPullSecretCondition = `and (not (kindIs "slice" .Values.kube.registry.pull_secrets)) (ne .Values.kube.registry.username "")`
+
+// getImagePullSecrets returns the image pull secrets of the pods.  Helm charts
+// use the secrets listed in kube.registry.pull_secrets, or when that is not set,
+// the registry-credentials secret if there is a registry user.  An empty list
+// uses no pull secret, for public registries.
+func getImagePullSecrets(settings ExportSettings) helm.Node {
+	defaultSecret := helm.NewMapping("name", "registry-credentials")
+	if !settings.CreateHelmChart {
+		return helm.NewList(defaultSecret)
+	}
+	defaultSecret.Set(helm.If(defaultPullSecretCondition))
+	listedSecret := helm.NewMapping("name", helm.QuotedTemplate("."))
+	listedSecret.Set(helm.Range(".Values.kube.registry.pull_secrets"))
+	pullSecrets := helm.NewList(listedSecret, defaultSecret)
+	pullSecrets.Set(helm.If(fmt.Sprintf("or .Values.kube.registry.pull_secrets (%s)", defaultPullSecretCondition)))
+	return pullSecrets
+}
+
+// ConfigChecksum determines what the checksum/config annotation of the pods
+// covers; a change of the checksum rolls the pods
+type ConfigChecksum string
+
+// These are the supported config checksums
+const (
+	ConfigChecksumChart         = ConfigChecksum("chart")          // The secrets, deployment manifest, and log forwarder outputs of the chart (the default)
+	ConfigChecksumInstanceGroup = ConfigChecksum("instance-group") // The secrets, deployment manifest entries, and log forwarder outputs the instance group consumes
+)
+
+// configChecksum returns the template of the checksum/config annotation of
+// the pods of the instance group.  For the chart, the checksum covers the
+// user secrets and the deployment manifest objects, and the log forwarder
+// ConfigMap of the pod if it has one.  Per instance group, it covers the user
+// secrets consumed by the containers of the pod (the generated secrets are
+// versioned, so their names in the pod spec change instead), the entries of
+// the instance group in the deployment manifest, and the log forwarder
+// ConfigMap.
+func configChecksum(role *model.InstanceGroup, settings ExportSettings) (string, error) {
+	var forwarder string
+	if hasLogSidecar(role, settings, model.LogSidecarForwarder) {
+		forwarder = " " + strings.Join(logForwarderConfigValues(role), " ")
+	}
+
+	if settings.ConfigChecksum != ConfigChecksumInstanceGroup {
+		return `{{ list (include (print $.Template.BasePath "/secrets.yaml") .)` +
+			` (include (print $.Template.BasePath "/deployment-manifest-secret.yaml") .)` +
+			forwarder + ` | toJson | sha256sum }}`, nil
+	}
+
+	var secrets []string
+	seen := map[string]bool{}
+	for _, candidate := range append([]*model.InstanceGroup{role}, role.GetColocatedRoles()...) {
+		variables, err := candidate.GetVariablesForRole()
+		if err != nil {
+			return "", err
+		}
+		for _, variable := range variables {
+			// Users cannot override immutable secrets that are generated
+			if variable.CVOptions.Secret && !(variable.CVOptions.Immutable && variable.Type != "") && !seen[variable.Name] {
+				seen[variable.Name] = true
+				secrets = append(secrets, variable.Name)
+			}
+		}
+	}
+	sort.Strings(secrets)
+	var values []string
+	for _, name := range secrets {
+		values = append(values, fmt.Sprintf(".Values.secrets.%s", name))
+	}
+
+	return fmt.Sprintf(`{{ $bosh := list }}`+
+		`{{ range .Values.bosh.instance_groups }}{{ if eq (toString .name) %q }}{{ $bosh = append $bosh . }}{{ end }}{{ end }}`+
+		`{{ list $bosh %s%s | toJson | sha256sum }}`, role.Name, strings.Join(values, " "), forwarder), nil
+}
+
 // NewPod creates a new Pod for the given role, as well as any objects it depends on
 func NewPod(role *model.InstanceGroup, settings ExportSettings, grapher util.ModelGrapher) (helm.Node, error) {
 	podTemplate, err := NewPodTemplate(role, settings, grapher)
@@ -104,16 +214,59 @@ func NewPod(role *model.InstanceGroup, settings ExportSettings, grapher util.Mod
 		SetAPIVersion("v1").
 		SetKind("Pod").
 		SetName(role.Name).
+		SetInstanceGroup(role).
 		AddModifier(helm.Comment(role.GetLongDescription()))
 	pod, err := cb.Build()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build a new kube config: %v", err)
 	}
+	addContainerJobsAnnotations(pod.Get("metadata").(*helm.Mapping), role, settings)
 	pod.Add("spec", podTemplate.Get("spec"))
 
 	return pod.Sort(), nil
 }
 
+// addContainerJobsAnnotations adds an annotation for each container of the
+// pod of the role listing the jobs it runs, so that metrics and logs of
+// colocated containers can be attributed to the jobs.
+func addContainerJobsAnnotations(meta *helm.Mapping, role *model.InstanceGroup, settings ExportSettings) {
+	annotations, ok := meta.Get("annotations").(*helm.Mapping)
+	if !ok {
+		annotations = helm.NewMapping()
+		meta.Add("annotations", annotations)
+	}
+	for _, candidate := range append([]*model.InstanceGroup{role}, role.GetColocatedRoles()...) {
+		annotations.Add(ContainerJobsAnnotationPrefix+kubeName(candidate.Name), containerJobs(candidate, settings))
+		addFeatureCheck(candidate, annotations.Get(ContainerJobsAnnotationPrefix+kubeName(candidate.Name)))
+	}
+	annotations.Sort()
+}
+
+// containerJobs returns the comma separated names of the jobs run by the
+// container of the role.  In helm charts, jobs with a feature condition are
+// only listed when they are included.
+func containerJobs(role *model.InstanceGroup, settings ExportSettings) string {
+	var names, terms []string
+	conditional := false
+	for _, job := range role.JobReferences {
+		names = append(names, job.Name)
+		condition := ""
+		if settings.CreateHelmChart {
+			condition = jobFeatureCondition(job)
+		}
+		if condition == "" {
+			terms = append(terms, strconv.Quote(job.Name))
+		} else {
+			terms = append(terms, fmt.Sprintf(`(ternary %q "" %s)`, job.Name, condition))
+			conditional = true
+		}
+	}
+	if !conditional {
+		return strings.Join(names, ",")
+	}
+	return fmt.Sprintf(`{{ list %s | compact | join "," | quote }}`, strings.Join(terms, " "))
+}
+
 // getContainerMapping returns the container list entry mapping for the provided role
 func getContainerMapping(role *model.InstanceGroup, settings ExportSettings, grapher util.ModelGrapher) (*helm.Mapping, error) {
 	roleName := util.ConvertNameToKey(role.Name)
@@ -137,17 +290,21 @@ func getContainerMapping(role *model.InstanceGroup, settings ExportSettings, gra
 	if settings.UseMemoryLimits {
 		if settings.CreateHelmChart {
 			requests.Add("memory",
-				helm.NewNode(fmt.Sprintf("{{ int .Values.sizing.%s.memory.request }}Mi", roleVarName),
-					helm.Block(fmt.Sprintf("if and .Values.config.memory.requests .Values.sizing.%s.memory.request", roleVarName))))
+				helm.NewNode(sizingQuantity(fmt.Sprintf(".Values.sizing.%s.memory.request", roleVarName), "Mi"),
+					helm.Block(fmt.Sprintf("if and .Values.config.memory.requests (not .Values.config.dev_mode) .Values.sizing.%s.memory.request", roleVarName))))
 			limits.Add("memory",
-				helm.NewNode(fmt.Sprintf("{{ int .Values.sizing.%s.memory.limit }}Mi", roleVarName),
+				helm.NewNode(sizingQuantity(fmt.Sprintf(".Values.sizing.%s.memory.limit", roleVarName), "Mi"),
 					helm.Block(fmt.Sprintf("if and .Values.config.memory.limits .Values.sizing.%s.memory.limit", roleVarName))))
 		} else {
 			if role.Run.Memory != nil {
-				if role.Run.Memory.Request != nil {
+				if role.Run.Memory.RequestQuantity != "" {
+					requests.Add("memory", role.Run.Memory.RequestQuantity)
+				} else if role.Run.Memory.Request != nil {
 					requests.Add("memory", fmt.Sprintf("%dMi", *role.Run.Memory.Request))
 				}
-				if role.Run.Memory.Limit != nil {
+				if role.Run.Memory.LimitQuantity != "" {
+					limits.Add("memory", role.Run.Memory.LimitQuantity)
+				} else if role.Run.Memory.Limit != nil {
 					limits.Add("memory", fmt.Sprintf("%dMi", *role.Run.Memory.Limit))
 				}
 			}
@@ -156,24 +313,28 @@ func getContainerMapping(role *model.InstanceGroup, settings ExportSettings, gra
 	if settings.UseCPULimits {
 		if settings.CreateHelmChart {
 			requests.Add("cpu",
-				helm.NewNode(fmt.Sprintf("{{ int .Values.sizing.%s.cpu.request }}m", roleVarName),
-					helm.Block(fmt.Sprintf("if and .Values.config.cpu.requests .Values.sizing.%s.cpu.request", roleVarName))))
+				helm.NewNode(sizingQuantity(fmt.Sprintf(".Values.sizing.%s.cpu.request", roleVarName), "m"),
+					helm.Block(fmt.Sprintf("if and .Values.config.cpu.requests (not .Values.config.dev_mode) .Values.sizing.%s.cpu.request", roleVarName))))
 			limits.Add("cpu",
-				helm.NewNode(fmt.Sprintf("{{ int .Values.sizing.%s.cpu.limit }}m", roleVarName),
+				helm.NewNode(sizingQuantity(fmt.Sprintf(".Values.sizing.%s.cpu.limit", roleVarName), "m"),
 					helm.Block(fmt.Sprintf("if and .Values.config.cpu.limits .Values.sizing.%s.cpu.limit", roleVarName))))
 		} else {
 			if role.Run.CPU != nil {
-				if role.Run.CPU.Request != nil {
+				if role.Run.CPU.RequestQuantity != "" {
+					requests.Add("cpu", role.Run.CPU.RequestQuantity)
+				} else if role.Run.CPU.Request != nil {
 					requests.Add("cpu", fmt.Sprintf("%dm", int(*role.Run.CPU.Request*1000+0.5)))
 				}
-				if role.Run.CPU.Limit != nil {
+				if role.Run.CPU.LimitQuantity != "" {
+					limits.Add("cpu", role.Run.CPU.LimitQuantity)
+				} else if role.Run.CPU.Limit != nil {
 					limits.Add("cpu", fmt.Sprintf("%dm", int(*role.Run.CPU.Limit*1000+0.5)))
 				}
 			}
 		}
 	}
 
-	securityContext := getSecurityContext(role)
+	securityContext := getSecurityContext(role, settings)
 	ports, err := getContainerPorts(role, settings)
 	if err != nil {
 		return nil, err
@@ -190,10 +351,25 @@ func getContainerMapping(role *model.InstanceGroup, settings ExportSettings, gra
 	if err != nil {
 		return nil, err
 	}
+	if settings.CreateHelmChart {
+		devModeProbe(livenessProbe)
+		devModeProbe(readinessProbe)
+	}
+	if settings.IsDebugRole(role.Name) {
+		livenessProbe = nil
+		readinessProbe = nil
+		securityContext = helm.NewMapping("allowPrivilegeEscalation", true, "privileged", true)
+	}
 
 	container := helm.NewMapping()
-	container.Add("name", role.Name)
+	container.Add("name", kubeName(role.Name))
 	container.Add("image", image)
+	if settings.CreateHelmChart {
+		container.Add("imagePullPolicy", helm.QuotedTemplate(fmt.Sprintf(".Values.sizing.%s.image_pull_policy", roleVarName)),
+			helm.If(fmt.Sprintf(".Values.sizing.%s.image_pull_policy", roleVarName)))
+	} else if role.Run.ImagePullPolicy != "" {
+		container.Add("imagePullPolicy", role.Run.ImagePullPolicy)
+	}
 	container.Add("ports", ports)
 	container.Add("volumeMounts", getVolumeMounts(role, settings))
 	container.Add("env", vars)
@@ -206,25 +382,113 @@ func getContainerMapping(role *model.InstanceGroup, settings ExportSettings, gra
 			helm.NewMapping("exec",
 				helm.NewMapping("command",
 					[]string{"/opt/fissile/pre-stop.sh"}))))
+	addContainerCommand(role, container, settings)
 	container.Sort()
 
 	return container, nil
 }
 
+// addContainerCommand overrides the entrypoint (/opt/fissile/run.sh) and
+// arguments of the container image as set in the role manifest.  Helm charts
+// read them from values.yaml, so that they can be changed at install time.
+// Containers of debug roles sleep instead.
+func addContainerCommand(role *model.InstanceGroup, container *helm.Mapping, settings ExportSettings) {
+	if settings.IsDebugRole(role.Name) {
+		container.Add("command", []string{"sleep", "infinity"})
+		return
+	}
+	if settings.CreateHelmChart {
+		roleVarName := makeVarName(role.Name)
+		for _, key := range []string{"command", "args"} {
+			cond := fmt.Sprintf("if .Values.sizing.%s.%s", roleVarName, key)
+			value := fmt.Sprintf("{{ toJson .Values.sizing.%s.%s }}", roleVarName, key)
+			container.Add(key, value, helm.Block(cond))
+		}
+		return
+	}
+	if len(role.Run.Command) > 0 {
+		container.Add("command", role.Run.Command)
+	}
+	if len(role.Run.Args) > 0 {
+		container.Add("args", role.Run.Args)
+	}
+}
+
+// envValueTemplate returns the template rendering the value of a user
+// variable.  Whether the variable names an image or is required is known when
+// generating the chart, so only the helper for its kind of value is called;
+// the type of the configured value is checked once, by the helper.
+func envValueTemplate(config *model.VariableDefinition) string {
+	if config.CVOptions.ImageName {
+		// Imagenames including a slash already include at least an org name.
+		// All others will be prefixed with the registry and org from values.yaml.
+		tmpl := `{{ template "fissile.EnvImageName" (dict "kube" .Values.kube "value" .Values.env.%s "name" "env.%s" "required" %t) }}`
+		return fmt.Sprintf(tmpl, config.Name, config.Name, config.CVOptions.Required)
+	}
+	tmpl := `{{ template "fissile.EnvValue" (dict "value" .Values.env.%s "name" "env.%s" "required" %t) }}`
+	return fmt.Sprintf(tmpl, config.Name, config.Name, config.CVOptions.Required)
+}
+
+// getStartupInitContainers returns the init containers waiting for the
+// instance groups preceding the instance group in the startup order of the
+// role manifest to be ready, i.e. until their headless services resolve, or
+// nil if it does not wait for any.  They use the image of the instance group.
+func getStartupInitContainers(role *model.InstanceGroup, settings ExportSettings, grapher util.ModelGrapher) (helm.Node, error) {
+	roleManifest := role.Manifest()
+	if roleManifest == nil {
+		return nil, nil
+	}
+	dependencies := roleManifest.StartupDependencies(role.Name)
+	if len(dependencies) == 0 {
+		return nil, nil
+	}
+
+	image, err := getContainerImageName(role, settings, grapher)
+	if err != nil {
+		return nil, err
+	}
+
+	initContainers := helm.NewList()
+	for _, name := range dependencies {
+		dependency := roleManifest.LookupInstanceGroup(name)
+		if dependency == nil {
+			return nil, fmt.Errorf("Instance group %s waits for unknown instance group %s", role.Name, name)
+		}
+		serviceName := clusteringServiceName(dependency)
+		script := fmt.Sprintf("until getent hosts %s > /dev/null; do echo 'Waiting for %s'; sleep 5; done", serviceName, dependency.Name)
+		container := helm.NewMapping(
+			"name", kubeName("wait-for-"+dependency.Name),
+			"image", image,
+			"command", helm.NewList("/bin/sh", "-c", script))
+		node := helm.NewNode(container)
+		// Do not wait for instance groups which are not deployed
+		addFeatureCheck(dependency, node)
+		initContainers.Add(node)
+	}
+	return initContainers, nil
+}
+
 // getContainerImageName returns the name of the docker image to use for a role
 func getContainerImageName(role *model.InstanceGroup, settings ExportSettings, grapher util.ModelGrapher) (string, error) {
-	devVersion, err := role.GetRoleDevVersion(settings.Opinions, settings.TagExtra, settings.FissileVersion, grapher)
+	devVersion, err := role.GetRoleDevVersion(settings.Opinions, settings.TagExtra, settings.FissileVersion, settings.ImageOptions, grapher)
 	if err != nil {
 		return "", err
 	}
 
 	var imageName string
 	if settings.CreateHelmChart {
-		registry := "{{ .Values.kube.registry.hostname }}"
-		org := "{{ .Values.kube.organization }}"
-		imageName = builder.GetRoleDevImageName(registry, org, settings.Repository, role, devVersion)
+		image := builder.GetRoleDevImageName("", "", settings.Repository, role, devVersion)
+		imageName = fmt.Sprintf(`{{ template "fissile.ImageName" (dict "kube" .Values.kube "image" %q) }}`, image)
 	} else {
-		imageName = builder.GetRoleDevImageName(settings.Registry, settings.Organization, settings.Repository, role, devVersion)
+		registry := settings.Registry
+		if settings.Substitutions.Registry != "" {
+			registry = settings.Substitutions.Registry
+		}
+		org := settings.Organization
+		if settings.Substitutions.Organization != "" {
+			org = settings.Substitutions.Organization
+		}
+		imageName = builder.GetRoleDevImageName(registry, org, settings.Repository, role, devVersion)
 	}
 
 	return imageName, nil
@@ -234,6 +498,7 @@ func getContainerImageName(role *model.InstanceGroup, settings ExportSettings, g
 func getContainerPorts(role *model.InstanceGroup, settings ExportSettings) (helm.Node, error) {
 	var ports []helm.Node
 	for _, job := range role.JobReferences {
+		condition := jobFeatureCondition(job)
 		for _, port := range job.ContainerProperties.BoshContainerization.Ports {
 			if settings.CreateHelmChart && port.CountIsConfigurable {
 				sizing := fmt.Sprintf(".Values.sizing.%s.ports.%s", makeVarName(role.Name), makeVarName(port.Name))
@@ -246,12 +511,17 @@ func getContainerPorts(role *model.InstanceGroup, settings ExportSettings) (helm
 				block = fmt.Sprintf("if lt (int %s.count) 1", sizing)
 				ports = append(ports, helm.NewNode(fail, helm.Block(block)))
 
-				block = fmt.Sprintf("range $port := until (int %s.count)", sizing)
+				// A node has a single block, so the job condition is folded into the range
+				count := fmt.Sprintf("int %s.count", sizing)
+				if condition != "" {
+					count = fmt.Sprintf("ternary (int %s.count) 0 %s", sizing, condition)
+				}
+				block = fmt.Sprintf("range $port := until (%s)", count)
 				newPort := helm.NewMapping()
 				newPort.Set(helm.Block(block))
 				newPort.Add("containerPort", fmt.Sprintf("{{ add %d $port }}", port.InternalPort))
 				if port.Max > 1 {
-					newPort.Add("name", fmt.Sprintf("%s-{{ $port }}", port.Name))
+					newPort.Add("name", makePortName(port.Name, "{{ $port }}"))
 				} else {
 					newPort.Add("name", port.Name)
 				}
@@ -262,11 +532,12 @@ func getContainerPorts(role *model.InstanceGroup, settings ExportSettings) (helm
 					newPort := helm.NewMapping()
 					newPort.Add("containerPort", portNumber)
 					if port.Max > 1 {
-						newPort.Add("name", fmt.Sprintf("%s-%d", port.Name, portNumber))
+						newPort.Add("name", makePortName(port.Name, portNumber))
 					} else {
 						newPort.Add("name", port.Name)
 					}
 					newPort.Add("protocol", port.Protocol)
+					addJobFeatureCheck(job, newPort)
 					ports = append(ports, newPort)
 				}
 			}
@@ -308,14 +579,8 @@ const userSecretsName = "secrets"
 const versionSuffix = "{{ .Chart.Version }}-{{ .Values.kube.secrets_generation_counter }}"
 const generatedSecretsName = "secrets-" + versionSuffix
 
-func makeSecretVar(name string, generated bool, modifiers ...helm.NodeModifier) helm.Node {
-	secretKeyRef := helm.NewMapping("key", util.ConvertNameToKey(name))
-	if generated {
-		secretKeyRef.Add("name", generatedSecretsName)
-	} else {
-		secretKeyRef.Add("name", userSecretsName)
-	}
-
+func makeSecretVar(name string, secretName string, modifiers ...helm.NodeModifier) helm.Node {
+	secretKeyRef := helm.NewMapping("key", util.ConvertNameToKey(name), "name", secretName)
 	envVar := helm.NewMapping("name", name, "valueFrom", helm.NewMapping("secretKeyRef", secretKeyRef))
 	envVar.Set(modifiers...)
 	return envVar
@@ -347,7 +612,7 @@ func getNonClaimVolumes(role *model.InstanceGroup, settings ExportSettings) helm
 	// Mount the deployment manifest secret if it is available
 	mount := helm.NewMapping("name", "deployment-manifest")
 	items := helm.NewList(helm.NewMapping("key", "deployment-manifest", "path", "deployment-manifest.yml"))
-	secret := helm.NewMapping("secretName", "deployment-manifest", "items", items)
+	secret := helm.NewMapping("secretName", deploymentManifestSecretName(settings), "items", items)
 	mount.Add("secret", secret)
 	mounts = append(mounts, mount)
 
@@ -360,7 +625,11 @@ func getEnvVars(role *model.InstanceGroup, settings ExportSettings) (helm.Node,
 		return nil, err
 	}
 
-	env, err := getEnvVarsFromConfigs(configs, settings)
+	userSecrets, err := UserSecretsName(role, settings)
+	if err != nil {
+		return nil, err
+	}
+	env, err := getEnvVarsFromConfigs(configs, userSecrets, settings)
 	if err != nil {
 		return nil, err
 	}
@@ -384,7 +653,7 @@ func getEnvVars(role *model.InstanceGroup, settings ExportSettings) (helm.Node,
 		for _, job := range role.JobReferences {
 			for _, consumer := range job.ResolvedConsumes {
 				roleName := consumer.JobLinkInfo.RoleName
-				if seen[roleName] {
+				if consumer.External != nil || seen[roleName] {
 					continue
 				}
 				seen[roleName] = true
@@ -394,7 +663,7 @@ func getEnvVars(role *model.InstanceGroup, settings ExportSettings) (helm.Node,
 				// The environment variables are not actually used for anything else.
 				name := "CONFIGGIN_IMPORT_" + strings.ToUpper(makeVarName(roleName))
 				envVar := helm.NewMapping("name", name)
-				secretKeyRef := helm.NewMapping("name", roleName, "key", versionSuffix)
+				secretKeyRef := helm.NewMapping("name", kubeName(roleName), "key", versionSuffix)
 				envVar.Add("valueFrom", helm.NewMapping("secretKeyRef", secretKeyRef))
 
 				// Make sure not to wait for roles that have been disabled, e.g. credhub
@@ -412,15 +681,11 @@ func getEnvVars(role *model.InstanceGroup, settings ExportSettings) (helm.Node,
 	return helm.NewNode(env), nil
 }
 
-func getEnvVarsFromConfigs(configs model.Variables, settings ExportSettings) ([]helm.Node, error) {
-	featureRexgexp := regexp.MustCompile("^FEATURE_([A-Z][A-Z_]*)_ENABLED$")
-	sizingCountRegexp := regexp.MustCompile("^KUBE_SIZING_([A-Z][A-Z_]*)_COUNT$")
-	sizingPortsRegexp := regexp.MustCompile("^KUBE_SIZING_([A-Z][A-Z_]*)_PORTS_([A-Z][A-Z_]*)_(MIN|MAX)$")
-
+func getEnvVarsFromConfigs(configs model.Variables, userSecrets string, settings ExportSettings) ([]helm.Node, error) {
 	var env []helm.Node
 	for _, config := range configs {
 		// FEATURE_flag
-		match := featureRexgexp.FindStringSubmatch(config.Name)
+		match := model.FeatureVariablePattern.FindStringSubmatch(config.Name)
 		if match != nil {
 			feature := strings.ToLower(match[1])
 			if _, exists := settings.RoleManifest.Features[feature]; !exists {
@@ -435,7 +700,7 @@ func getEnvVarsFromConfigs(configs model.Variables, settings ExportSettings) ([]
 		}
 
 		// KUBE_SIZING_role_COUNT
-		match = sizingCountRegexp.FindStringSubmatch(config.Name)
+		match = model.SizingCountVariablePattern.FindStringSubmatch(config.Name)
 		if match != nil {
 			roleName := util.ConvertNameToKey(match[1])
 			role := settings.RoleManifest.LookupInstanceGroup(roleName)
@@ -456,7 +721,7 @@ func getEnvVarsFromConfigs(configs model.Variables, settings ExportSettings) ([]
 		}
 
 		// KUBE_SIZING_role_PORTS_port_MIN/MAX
-		match = sizingPortsRegexp.FindStringSubmatch(config.Name)
+		match = model.SizingPortsVariablePattern.FindStringSubmatch(config.Name)
 		if match != nil {
 			roleName := util.ConvertNameToKey(match[1])
 			role := settings.RoleManifest.LookupInstanceGroup(roleName)
@@ -507,7 +772,7 @@ func getEnvVarsFromConfigs(configs model.Variables, settings ExportSettings) ([]
 		}
 
 		if config.Name == "KUBERNETES_STORAGE_CLASS_PERSISTENT" {
-			value := "persistent"
+			value := settings.Substitutions.storageClass(model.VolumeTypePersistent)
 			if settings.CreateHelmChart {
 				value = "{{ .Values.kube.storage_class.persistent }}"
 			}
@@ -535,20 +800,20 @@ func getEnvVarsFromConfigs(configs model.Variables, settings ExportSettings) ([]
 
 		if config.CVOptions.Secret {
 			if !settings.CreateHelmChart {
-				env = append(env, makeSecretVar(config.Name, false))
+				env = append(env, makeSecretVar(config.Name, userSecrets))
 			} else {
 				if config.CVOptions.Immutable && config.Type != "" {
 					// Users cannot override immutable secrets that are generated
-					env = append(env, makeSecretVar(config.Name, true))
+					env = append(env, makeSecretVar(config.Name, generatedSecretsName))
 				} else if config.Type == "" && independentSecret(config.Name) {
-					env = append(env, makeSecretVar(config.Name, false))
+					env = append(env, makeSecretVar(config.Name, userSecrets))
 				} else {
 					// Generated secrets can be overridden by the user (unless immutable)
 					block := helm.Block(fmt.Sprintf("if not .Values.secrets.%s", config.Name))
-					env = append(env, makeSecretVar(config.Name, true, block))
+					env = append(env, makeSecretVar(config.Name, generatedSecretsName, block))
 
 					block = helm.Block(fmt.Sprintf("if .Values.secrets.%s", config.Name))
-					env = append(env, makeSecretVar(config.Name, false, block))
+					env = append(env, makeSecretVar(config.Name, userSecrets, block))
 				}
 			}
 			continue
@@ -556,25 +821,7 @@ func getEnvVarsFromConfigs(configs model.Variables, settings ExportSettings) ([]
 
 		var stringifiedValue string
 		if settings.CreateHelmChart && config.CVOptions.Type == model.CVTypeUser {
-			required := `""`
-			if config.CVOptions.Required {
-				required = fmt.Sprintf(`{{fail "env.%s has not been set"}}`, config.Name)
-			}
-			name := ".Values.env." + config.Name
-			if config.CVOptions.ImageName {
-				// Imagenames including a slash already include at least an org name.
-				// All others will be prefixed with the registry and org from values.yaml.
-				kube := ".Values.kube"
-				tmpl := `{{if contains "/" %s}}{{%s | quote}}{{else}}` +
-					`{{print %s.registry.hostname "/" %s.organization "/" %s | quote}}{{end}}`
-				stringifiedValue = fmt.Sprintf(tmpl, name, name, kube, kube, name)
-			} else {
-				tmpl := `{{if has (kindOf %s) (list "map" "slice")}}` +
-					`{{%s | toJson | quote}}{{else}}{{%s | quote}}{{end}}`
-				stringifiedValue = fmt.Sprintf(tmpl, name, name, name)
-			}
-			tmpl := `{{if ne (typeOf %s) "<nil>"}}%s{{else}}%s{{end}}`
-			stringifiedValue = fmt.Sprintf(tmpl, name, stringifiedValue, required)
+			stringifiedValue = envValueTemplate(config)
 		} else {
 			var ok bool
 			ok, stringifiedValue = config.Value()
@@ -615,9 +862,99 @@ func getEnvVarsFromConfigs(configs model.Variables, settings ExportSettings) ([]
 	return env, nil
 }
 
-func getSecurityContext(instanceGroup *model.InstanceGroup) helm.Node {
+// getPodSecurityContext returns the security context of the pod of the role,
+// setting the users and groups its containers run as and the group owning its
+// volumes, or nil if there is none.  Helm charts read it from values.yaml,
+// defaulting to the role manifest.  OpenShift assigns the users and groups
+// from the ranges of the namespace, so only supplemental groups are kept.
+func getPodSecurityContext(role *model.InstanceGroup, settings ExportSettings) helm.Node {
+	if settings.CreateHelmChart {
+		values := fmt.Sprintf(".Values.sizing.%s.security_context", makeVarName(role.Name))
+		sc := helm.NewMapping()
+		if !settings.OpenShift {
+			for _, field := range []struct{ name, key string }{
+				{"runAsUser", "run_as_user"},
+				{"runAsGroup", "run_as_group"},
+				{"fsGroup", "fs_group"},
+			} {
+				sc.Add(field.name, fmt.Sprintf("{{ int %s.%s }}", values, field.key),
+					helm.Block(fmt.Sprintf(`if not (kindIs "invalid" %s.%s)`, values, field.key)))
+			}
+			sc.Add("fsGroupChangePolicy", fmt.Sprintf("{{ %s.fs_group_change_policy | quote }}", values),
+				helm.Block(fmt.Sprintf("if and %s.fs_group_change_policy (%s)", values, minKubeVersion(1, 20))))
+		}
+		sc.Add("supplementalGroups", fmt.Sprintf("{{ toJson %s.supplemental_groups }}", values),
+			helm.Block(fmt.Sprintf("if %s.supplemental_groups", values)))
+		sc.Set(helm.Block("if " + values))
+		return sc
+	}
+
+	securityContext := role.Run.SecurityContext
+	if securityContext == nil {
+		return nil
+	}
 	sc := helm.NewMapping()
-	if len(instanceGroup.Run.Capabilities) > 0 {
+	if !settings.OpenShift {
+		if securityContext.RunAsUser != nil {
+			sc.Add("runAsUser", int(*securityContext.RunAsUser))
+		}
+		if securityContext.RunAsGroup != nil {
+			sc.Add("runAsGroup", int(*securityContext.RunAsGroup))
+		}
+		if securityContext.FSGroup != nil {
+			sc.Add("fsGroup", int(*securityContext.FSGroup))
+		}
+		if securityContext.FSGroupChangePolicy != "" {
+			sc.Add("fsGroupChangePolicy", securityContext.FSGroupChangePolicy)
+		}
+	}
+	if len(securityContext.SupplementalGroups) > 0 {
+		sc.Add("supplementalGroups", supplementalGroups(securityContext.SupplementalGroups))
+	}
+	if len(sc.Names()) == 0 {
+		return nil
+	}
+	return sc
+}
+
+// supplementalGroups returns the list of the supplemental group IDs
+func supplementalGroups(ids []int64) *helm.List {
+	list := helm.NewList()
+	for _, id := range ids {
+		list.Add(int(id))
+	}
+	return list
+}
+
+// getSecurityContext returns the security context of the container of the
+// instance group.  Containers dropping capabilities drop ALL and add back the
+// retained ones (see model.RoleRun.RetainedCapabilities); helm charts read
+// whether to drop them from values.yaml, defaulting to the role manifest.
+func getSecurityContext(instanceGroup *model.InstanceGroup, settings ExportSettings) helm.Node {
+	sc := helm.NewMapping()
+	canDrop := !instanceGroup.Run.Privileged && !util.StringInSlice("ALL", instanceGroup.Run.Capabilities)
+	switch {
+	case settings.CreateHelmChart && canDrop:
+		dropBlock := helm.Block(fmt.Sprintf("if .Values.sizing.%s.drop_capabilities", makeVarName(instanceGroup.Name)))
+		add := helm.NewList()
+		for _, capability := range instanceGroup.Run.RetainedCapabilities() {
+			if util.StringInSlice(capability, instanceGroup.Run.Capabilities) {
+				add.Add(capability)
+			} else {
+				add.Add(helm.NewNode(capability, dropBlock))
+			}
+		}
+		capabilities := helm.NewMapping("add", add)
+		capabilities.Add("drop", helm.NewList("ALL"), dropBlock)
+		if len(instanceGroup.Run.Capabilities) == 0 {
+			capabilities.Set(dropBlock)
+		}
+		sc.Add("capabilities", capabilities)
+	case instanceGroup.Run.DropCapabilities && canDrop:
+		sc.Add("capabilities", helm.NewMapping(
+			"add", helm.NewNode(instanceGroup.Run.RetainedCapabilities()),
+			"drop", helm.NewList("ALL")))
+	case len(instanceGroup.Run.Capabilities) > 0:
 		sc.Add("capabilities", helm.NewMapping("add", helm.NewNode(instanceGroup.Run.Capabilities)))
 	}
 	if instanceGroup.Run.Privileged {
@@ -635,6 +972,26 @@ func getSecurityContext(instanceGroup *model.InstanceGroup) helm.Node {
 	return sc.Sort()
 }
 
+// devModeProbe caps the initial delay of the probe of a helm chart to
+// devModeInitialDelaySeconds in development mode
+func devModeProbe(probe helm.Node) {
+	mapping, ok := probe.(*helm.Mapping)
+	if !ok || mapping == nil {
+		return
+	}
+	delay, ok := mapping.Get("initialDelaySeconds").(*helm.Scalar)
+	if !ok || delay == nil {
+		return
+	}
+	seconds, err := strconv.Atoi(delay.String())
+	if err != nil || seconds <= devModeInitialDelaySeconds {
+		return
+	}
+	mapping.Add("initialDelaySeconds", fmt.Sprintf("{{ if .Values.config.dev_mode }}%d{{ else }}%d{{ end }}",
+		devModeInitialDelaySeconds, seconds))
+	mapping.Sort()
+}
+
 func getContainerLivenessProbe(role *model.InstanceGroup) (helm.Node, error) {
 	if role.Run == nil {
 		return nil, nil
@@ -799,3 +1156,10 @@ func getContainerURLProbe(role *model.InstanceGroup, probeName string, roleProbe
 
 	return helm.NewMapping("httpGet", httpGet), nil
 }
+
+// sizingQuantity returns the template of a memory or cpu value of the sizing
+// of an instance group: plain numbers get the unit of the value, MiB or
+// millicores, while quantities like 1Gi or 250m are used as they are.
+func sizingQuantity(value, unit string) string {
+	return fmt.Sprintf("{{ if regexMatch `^[0-9.]+$` (toString %[1]s) }}{{ int %[1]s }}%[2]s{{ else }}{{ %[1]s }}{{ end }}", value, unit)
+}
@@ -141,7 +141,7 @@ func TestPodGetVolumes(t *testing.T) {
 		return
 	}
 
-	claims := getVolumeClaims(role, false)
+	claims := getVolumeClaims(role, ExportSettings{})
 	assert.Len(claims, 2, "expected two claims")
 
 	var persistentVolume, sharedVolume *model.RoleRunVolume
@@ -211,7 +211,7 @@ func TestPodGetVolumesHelm(t *testing.T) {
 		return
 	}
 
-	claims := getVolumeClaims(role, true)
+	claims := getVolumeClaims(role, ExportSettings{CreateHelmChart: true})
 	assert.Len(claims, 2, "expected two claims")
 
 	var persistentVolume, sharedVolume *model.RoleRunVolume
@@ -402,7 +402,7 @@ func TestPodGetEnvVarsFromConfigSizingCountKube(t *testing.T) {
 		&model.VariableDefinition{
 			Name: "KUBE_SIZING_FOO_COUNT",
 		},
-	}, ExportSettings{
+	}, userSecretsName, ExportSettings{
 		RoleManifest: &model.RoleManifest{
 			InstanceGroups: []*model.InstanceGroup{
 				&model.InstanceGroup{
@@ -446,7 +446,7 @@ func TestPodGetEnvVarsFromConfigSizingCountHelm(t *testing.T) {
 		&model.VariableDefinition{
 			Name: "KUBE_SIZING_FOO_COUNT",
 		},
-	}, ExportSettings{
+	}, userSecretsName, ExportSettings{
 		CreateHelmChart: true,
 		RoleManifest: &model.RoleManifest{
 			InstanceGroups: []*model.InstanceGroup{
@@ -544,7 +544,7 @@ func TestPodGetEnvVarsFromConfigSizingPortsKube(t *testing.T) {
 		&model.VariableDefinition{
 			Name: "KUBE_SIZING_FOO_PORTS_STORE_MAX",
 		},
-	}, ExportSettings{
+	}, userSecretsName, ExportSettings{
 		RoleManifest: &model.RoleManifest{
 			InstanceGroups: []*model.InstanceGroup{
 				&model.InstanceGroup{
@@ -604,7 +604,7 @@ func TestPodGetEnvVarsFromConfigSizingPortsHelm(t *testing.T) {
 		&model.VariableDefinition{
 			Name: "KUBE_SIZING_FOO_PORTS_STORE_MAX",
 		},
-	}, ExportSettings{
+	}, userSecretsName, ExportSettings{
 		CreateHelmChart: true,
 		RoleManifest: &model.RoleManifest{
 			InstanceGroups: []*model.InstanceGroup{
@@ -665,7 +665,7 @@ func TestPodGetEnvVarsFromConfigGenerationCounterKube(t *testing.T) {
 		&model.VariableDefinition{
 			Name: "KUBE_SECRETS_GENERATION_COUNTER",
 		},
-	}, ExportSettings{
+	}, userSecretsName, ExportSettings{
 		RoleManifest: &model.RoleManifest{
 			InstanceGroups: []*model.InstanceGroup{
 				&model.InstanceGroup{
@@ -704,7 +704,7 @@ func TestPodGetEnvVarsFromConfigGenerationCounterHelm(t *testing.T) {
 		&model.VariableDefinition{
 			Name: "KUBE_SECRETS_GENERATION_COUNTER",
 		},
-	}, ExportSettings{
+	}, userSecretsName, ExportSettings{
 		CreateHelmChart: true,
 		RoleManifest: &model.RoleManifest{
 			InstanceGroups: []*model.InstanceGroup{
@@ -748,7 +748,7 @@ func TestPodGetEnvVarsFromConfigGenerationNameKube(t *testing.T) {
 		&model.VariableDefinition{
 			Name: "KUBE_SECRETS_GENERATION_NAME",
 		},
-	}, ExportSettings{
+	}, userSecretsName, ExportSettings{
 		RoleManifest: &model.RoleManifest{
 			InstanceGroups: []*model.InstanceGroup{
 				&model.InstanceGroup{
@@ -787,7 +787,7 @@ func TestPodGetEnvVarsFromConfigGenerationNameHelm(t *testing.T) {
 		&model.VariableDefinition{
 			Name: "KUBE_SECRETS_GENERATION_NAME",
 		},
-	}, ExportSettings{
+	}, userSecretsName, ExportSettings{
 		CreateHelmChart: true,
 		RoleManifest: &model.RoleManifest{
 			InstanceGroups: []*model.InstanceGroup{
@@ -834,7 +834,7 @@ func TestPodGetEnvVarsFromConfigSecretsKube(t *testing.T) {
 				Secret: true,
 			},
 		},
-	}, ExportSettings{
+	}, userSecretsName, ExportSettings{
 		RoleManifest: &model.RoleManifest{
 			InstanceGroups: []*model.InstanceGroup{
 				&model.InstanceGroup{
@@ -892,7 +892,7 @@ func TestPodGetEnvVarsFromConfigSecretsHelm(t *testing.T) {
 					Secret: true,
 				},
 			},
-		}, settings)
+		}, userSecretsName, settings)
 		if !assert.NoError(err) {
 			return
 		}
@@ -937,7 +937,7 @@ func TestPodGetEnvVarsFromConfigSecretsHelm(t *testing.T) {
 			"Values.secrets.A_SECRET":                "",
 		}
 
-		ev, err := getEnvVarsFromConfigs(cv, settings)
+		ev, err := getEnvVarsFromConfigs(cv, userSecretsName, settings)
 		if !assert.NoError(err) {
 			return
 		}
@@ -995,7 +995,7 @@ func TestPodGetEnvVarsFromConfigSecretsHelm(t *testing.T) {
 		})
 
 		cv[0].CVOptions.Immutable = true
-		ev, err = getEnvVarsFromConfigs(cv, settings)
+		ev, err = getEnvVarsFromConfigs(cv, userSecretsName, settings)
 		if !assert.NoError(err) {
 			return
 		}
@@ -1047,7 +1047,7 @@ func TestPodGetEnvVarsFromConfigNonSecretKube(t *testing.T) {
 					Default: []string{"or", "other"},
 				},
 			},
-		}, settings)
+		}, userSecretsName, settings)
 		if !assert.NoError(err) {
 			return
 		}
@@ -1083,7 +1083,7 @@ func TestPodGetEnvVarsFromConfigNonSecretKube(t *testing.T) {
 					Type: model.CVTypeEnv,
 				},
 			},
-		}, settings)
+		}, userSecretsName, settings)
 
 		actual, err := RoundtripNode(helm.NewNode(ev), nil)
 		if !assert.NoError(err) {
@@ -1115,7 +1115,7 @@ func TestPodGetEnvVarsFromConfigNonSecretHelmUserOptional(t *testing.T) {
 				Type: model.CVTypeUser,
 			},
 		},
-	}, ExportSettings{
+	}, userSecretsName, ExportSettings{
 		CreateHelmChart: true,
 		RoleManifest: &model.RoleManifest{
 			InstanceGroups: []*model.InstanceGroup{
@@ -1191,7 +1191,7 @@ func TestPodGetEnvVarsFromConfigNonSecretHelmUserRequired(t *testing.T) {
 				Required: true,
 			},
 		},
-	}, ExportSettings{
+	}, userSecretsName, ExportSettings{
 		CreateHelmChart: true,
 		RoleManifest: &model.RoleManifest{
 			InstanceGroups: []*model.InstanceGroup{
@@ -1207,7 +1207,7 @@ func TestPodGetEnvVarsFromConfigNonSecretHelmUserRequired(t *testing.T) {
 		t.Parallel()
 		_, err := RenderNode(helm.NewNode(ev), nil)
 		assert.EqualError(err,
-			`template: :7:219: executing "" at <fail "env.SOMETHING has not been set">: error calling fail: env.SOMETHING has not been set`)
+			`template: :21:40: executing "fissile.Required" at <fail (printf "%s has not been set" .)>: error calling fail: env.SOMETHING has not been set`)
 	})
 
 	t.Run("Undefined", func(t *testing.T) {
@@ -1217,7 +1217,7 @@ func TestPodGetEnvVarsFromConfigNonSecretHelmUserRequired(t *testing.T) {
 		}
 		_, err := RenderNode(helm.NewNode(ev), config)
 		assert.EqualError(err,
-			`template: :7:219: executing "" at <fail "env.SOMETHING has not been set">: error calling fail: env.SOMETHING has not been set`)
+			`template: :21:40: executing "fissile.Required" at <fail (printf "%s has not been set" .)>: error calling fail: env.SOMETHING has not been set`)
 	})
 
 	t.Run("Present", func(t *testing.T) {
@@ -1283,7 +1283,7 @@ func TestPodGetEnvVarsFromConfigNonSecretHelmImagename(t *testing.T) {
 				ImageName: true,
 			},
 		},
-	}, ExportSettings{
+	}, userSecretsName, ExportSettings{
 		CreateHelmChart: true,
 		RoleManifest: &model.RoleManifest{
 			InstanceGroups: []*model.InstanceGroup{
@@ -2014,6 +2014,7 @@ func TestPodPreFlightHelm(t *testing.T) {
 		"Values.kube.registry.username":        "U",
 		"Values.kube.organization":             "O",
 		"Values.env.KUBERNETES_CLUSTER_DOMAIN": "cluster.local",
+		"Values.sizing.pre_role.command":       nil,
 	}
 
 	actual, err := RoundtripNode(pod, config)
@@ -2025,6 +2026,8 @@ func TestPodPreFlightHelm(t *testing.T) {
 		kind: "Pod"
 		metadata:
 			name: "pre-role"
+			annotations:
+				jobs.fissile.cloudfoundry.org/pre-role: new_hostname
 			labels:
 				app.kubernetes.io/component: pre-role
 				app.kubernetes.io/instance: MyRelease
@@ -2136,6 +2139,7 @@ func TestPodPostFlightHelm(t *testing.T) {
 		"Values.kube.registry.username":        "U",
 		"Values.kube.organization":             "O",
 		"Values.env.KUBERNETES_CLUSTER_DOMAIN": "cluster.local",
+		"Values.sizing.post_role.command":      nil,
 	}
 
 	actual, err := RoundtripNode(pod, config)
@@ -2147,6 +2151,8 @@ func TestPodPostFlightHelm(t *testing.T) {
 		kind: "Pod"
 		metadata:
 			name: "post-role"
+			annotations:
+				jobs.fissile.cloudfoundry.org/post-role: tor
 			labels:
 				app.kubernetes.io/component: post-role
 				app.kubernetes.io/instance: MyRelease
@@ -2279,6 +2285,8 @@ func TestPodMemoryHelmDisabled(t *testing.T) {
 		kind: "Pod"
 		metadata:
 			name: "pre-role"
+			annotations:
+				jobs.fissile.cloudfoundry.org/pre-role: new_hostname
 			labels:
 				app.kubernetes.io/component: pre-role
 				app.kubernetes.io/instance: MyRelease
@@ -2374,6 +2382,8 @@ func TestPodMemoryHelmActive(t *testing.T) {
 		kind: "Pod"
 		metadata:
 			name: "pre-role"
+			annotations:
+				jobs.fissile.cloudfoundry.org/pre-role: new_hostname
 			labels:
 				app.kubernetes.io/component: pre-role
 				app.kubernetes.io/instance: MyRelease
@@ -2472,6 +2482,138 @@ func TestPodCPUKube(t *testing.T) {
 	`, actual)
 }
 
+func TestPodCommandKube(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	role := podTestLoadRole(assert, "pre-role")
+	if role == nil {
+		return
+	}
+	role.Run.Command = []string{"/usr/bin/tini", "--"}
+	role.Run.Args = []string{"/opt/fissile/run.sh"}
+	pod, err := NewPod(role, ExportSettings{
+		Opinions: model.NewEmptyOpinions(),
+	}, nil)
+	if !assert.NoError(err, "Failed to create pod from role pre-role") {
+		return
+	}
+
+	actual, err := RoundtripKube(pod)
+	if !assert.NoError(err) {
+		return
+	}
+	testhelpers.IsYAMLSubsetString(assert, `---
+		spec:
+			containers:
+			-
+				name: pre-role
+				command:
+				-	/usr/bin/tini
+				-	--
+				args:
+				-	/opt/fissile/run.sh
+	`, actual)
+}
+
+func TestPodCommandHelm(t *testing.T) {
+	t.Parallel()
+	role := podTestLoadRole(assert.New(t), "pre-role")
+	require.NotNil(t, role)
+	pod, err := NewPod(role, ExportSettings{
+		CreateHelmChart: true,
+		Repository:      "theRepo",
+		Opinions:        model.NewEmptyOpinions(),
+	}, nil)
+	require.NoError(t, err, "Failed to create pod from role pre-role")
+
+	config := map[string]interface{}{
+		"Values.kube.registry.hostname":        "R",
+		"Values.kube.organization":             "O",
+		"Values.env.KUBERNETES_CLUSTER_DOMAIN": "cluster.local",
+		"Values.sizing.pre_role.command":       nil,
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(pod, config)
+		require.NoError(t, err)
+		container := actual.(map[interface{}]interface{})["spec"].(map[interface{}]interface{})["containers"].([]interface{})[0].(map[interface{}]interface{})
+		assert.NotContains(t, container, "command")
+		assert.NotContains(t, container, "args")
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		t.Parallel()
+		overrides := map[string]interface{}{
+			"Values.sizing.pre_role.args": []string{"sleep 3600"},
+		}
+		for key, value := range config {
+			overrides[key] = value
+		}
+		overrides["Values.sizing.pre_role.command"] = []string{"/bin/sh", "-c"}
+		actual, err := RoundtripNode(pod, overrides)
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert.New(t), `---
+			spec:
+				containers:
+				-
+					name: pre-role
+					command:
+					-	/bin/sh
+					-	-c
+					args:
+					-	sleep 3600
+		`, actual)
+	})
+}
+
+func TestPodDebugRole(t *testing.T) {
+	t.Parallel()
+	role := podTestLoadRole(assert.New(t), "pre-role")
+	require.NotNil(t, role)
+	role.Run.Command = []string{"/usr/bin/tini", "--"}
+	role.Run.HealthCheck = &model.HealthCheck{
+		Liveness:  &model.HealthProbe{Port: 8080},
+		Readiness: &model.HealthProbe{Port: 8080},
+	}
+
+	pod, err := NewPod(role, ExportSettings{
+		Opinions:   model.NewEmptyOpinions(),
+		DebugRoles: []string{"pre-role"},
+	}, nil)
+	require.NoError(t, err, "Failed to create pod from role pre-role")
+
+	actual, err := RoundtripKube(pod)
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert.New(t), `---
+		spec:
+			containers:
+			-
+				name: pre-role
+				command:
+				-	sleep
+				-	infinity
+				securityContext:
+					allowPrivilegeEscalation: true
+					privileged: true
+	`, actual)
+	container := actual.(map[interface{}]interface{})["spec"].(map[interface{}]interface{})["containers"].([]interface{})[0].(map[interface{}]interface{})
+	assert.Nil(t, container["livenessProbe"])
+	assert.Nil(t, container["readinessProbe"])
+	assert.NotContains(t, container, "args")
+
+	pod, err = NewPod(role, ExportSettings{
+		Opinions:   model.NewEmptyOpinions(),
+		DebugRoles: []string{"post-role"},
+	}, nil)
+	require.NoError(t, err, "Failed to create pod from role pre-role")
+	actual, err = RoundtripKube(pod)
+	require.NoError(t, err)
+	container = actual.(map[interface{}]interface{})["spec"].(map[interface{}]interface{})["containers"].([]interface{})[0].(map[interface{}]interface{})
+	assert.Equal(t, []interface{}{"/usr/bin/tini", "--"}, container["command"], "Other roles are not debugged")
+	assert.NotNil(t, container["livenessProbe"])
+}
+
 func TestPodCPUHelmDisabled(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -2508,6 +2650,8 @@ func TestPodCPUHelmDisabled(t *testing.T) {
 		kind: "Pod"
 		metadata:
 			name: "pre-role"
+			annotations:
+				jobs.fissile.cloudfoundry.org/pre-role: new_hostname
 			labels:
 				app.kubernetes.io/component: pre-role
 				app.kubernetes.io/instance: MyRelease
@@ -2603,6 +2747,8 @@ func TestPodCPUHelmActive(t *testing.T) {
 		kind: "Pod"
 		metadata:
 			name: "pre-role"
+			annotations:
+				jobs.fissile.cloudfoundry.org/pre-role: new_hostname
 			labels:
 				app.kubernetes.io/component: pre-role
 				app.kubernetes.io/instance: MyRelease
@@ -2662,6 +2808,96 @@ func TestPodCPUHelmActive(t *testing.T) {
 	`, actual)
 }
 
+func TestPodQuantitiesKube(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	role := podTestLoadRole(assert, "pre-role")
+	if role == nil {
+		return
+	}
+	request, limit, cores := int64(1024), int64(2048), 0.25
+	role.Run.Memory = &model.RoleRunMemory{Request: &request, RequestQuantity: "1Gi", Limit: &limit}
+	role.Run.CPU = &model.RoleRunCPU{Request: &cores, RequestQuantity: "250m"}
+
+	pod, err := NewPod(role, ExportSettings{
+		Opinions:        model.NewEmptyOpinions(),
+		UseMemoryLimits: true,
+		UseCPULimits:    true,
+	}, nil)
+	if !assert.NoError(err, "Failed to create pod from role pre-role") {
+		return
+	}
+
+	actual, err := RoundtripNode(pod, nil)
+	if !assert.NoError(err) {
+		return
+	}
+	testhelpers.IsYAMLSubsetString(assert, `---
+		spec:
+			containers:
+			-
+				name: pre-role
+				resources:
+					requests:
+						cpu: 250m
+						memory: 1Gi
+					limits:
+						memory: 2048Mi
+	`, actual)
+}
+
+func TestPodQuantitiesHelm(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	role := podTestLoadRole(assert, "pre-role")
+	if role == nil {
+		return
+	}
+	pod, err := NewPod(role, ExportSettings{
+		CreateHelmChart: true,
+		Repository:      "theRepo",
+		Opinions:        model.NewEmptyOpinions(),
+		UseMemoryLimits: true,
+		UseCPULimits:    true,
+	}, nil)
+	if !assert.NoError(err, "Failed to create pod from role pre-role") {
+		return
+	}
+
+	config := map[string]interface{}{
+		"Values.config.cpu.limits":              "true",
+		"Values.config.cpu.requests":            "true",
+		"Values.config.memory.limits":           "true",
+		"Values.config.memory.requests":         "true",
+		"Values.env.KUBERNETES_CLUSTER_DOMAIN":  "cluster.local",
+		"Values.kube.organization":              "O",
+		"Values.kube.registry.hostname":         "R",
+		"Values.kube.registry.username":         "U",
+		"Values.sizing.pre_role.cpu.limit":      "1500m",
+		"Values.sizing.pre_role.cpu.request":    "500",
+		"Values.sizing.pre_role.memory.limit":   "2Gi",
+		"Values.sizing.pre_role.memory.request": "512",
+	}
+
+	actual, err := RoundtripNode(pod, config)
+	if !assert.NoError(err) {
+		return
+	}
+	testhelpers.IsYAMLSubsetString(assert, `---
+		spec:
+			containers:
+			-
+				name: pre-role
+				resources:
+					requests:
+						cpu: 500m
+						memory: 512Mi
+					limits:
+						cpu: 1500m
+						memory: 2Gi
+	`, actual)
+}
+
 func TestGetSecurityContextCapList(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -2671,7 +2907,7 @@ func TestGetSecurityContextCapList(t *testing.T) {
 		return
 	}
 
-	sc := getSecurityContext(role)
+	sc := getSecurityContext(role, ExportSettings{})
 	if !assert.NotNil(sc) {
 		return
 	}
@@ -2701,7 +2937,7 @@ func TestGetSecurityContextNil(t *testing.T) {
 
 	role.Run.Capabilities = []string{}
 
-	sc := getSecurityContext(role)
+	sc := getSecurityContext(role, ExportSettings{})
 	if !assert.NotNil(sc) {
 		return
 	}
@@ -2733,7 +2969,7 @@ func TestGetSecurityContextPrivileged(t *testing.T) {
 	role.Run.Capabilities[0] = "ALL"
 	role.Run.Privileged = false
 
-	sc := getSecurityContext(role)
+	sc := getSecurityContext(role, ExportSettings{})
 	if !assert.NotNil(sc) {
 		return
 	}
@@ -2750,6 +2986,138 @@ func TestGetSecurityContextPrivileged(t *testing.T) {
 	`, actual)
 }
 
+func TestGetSecurityContextDropCapabilities(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	role := podTemplateTestLoadRole(assert)
+	if role == nil {
+		return
+	}
+	role.Run.Capabilities = []string{"NET_ADMIN", "SETUID"}
+	role.Run.DropCapabilities = true
+
+	actual, err := RoundtripKube(getSecurityContext(role, ExportSettings{}))
+	if !assert.NoError(err) {
+		return
+	}
+	testhelpers.IsYAMLEqualString(assert, `---
+		allowPrivilegeEscalation: false
+		capabilities:
+			add: [CHOWN, DAC_OVERRIDE, FOWNER, KILL, NET_ADMIN, SETGID, SETUID]
+			drop: [ALL]
+	`, actual)
+
+	sc := getSecurityContext(role, ExportSettings{CreateHelmChart: true})
+	actual, err = RoundtripNode(sc, map[string]interface{}{"Values.sizing.myrole.drop_capabilities": true})
+	if assert.NoError(err) {
+		testhelpers.IsYAMLEqualString(assert, `---
+			allowPrivilegeEscalation: false
+			capabilities:
+				add: [CHOWN, DAC_OVERRIDE, FOWNER, KILL, NET_ADMIN, SETGID, SETUID]
+				drop: [ALL]
+		`, actual)
+	}
+	actual, err = RoundtripNode(sc, map[string]interface{}{"Values.sizing.myrole.drop_capabilities": false})
+	if assert.NoError(err) {
+		testhelpers.IsYAMLEqualString(assert, `---
+			allowPrivilegeEscalation: false
+			capabilities:
+				add: [NET_ADMIN, SETUID]
+		`, actual)
+	}
+
+	role.Run.Capabilities = nil
+	sc = getSecurityContext(role, ExportSettings{CreateHelmChart: true})
+	actual, err = RoundtripNode(sc, map[string]interface{}{"Values.sizing.myrole.drop_capabilities": false})
+	if assert.NoError(err) {
+		testhelpers.IsYAMLEqualString(assert, `---
+			allowPrivilegeEscalation: false
+		`, actual)
+	}
+
+	// Privileged containers keep all capabilities
+	role.Run.Privileged = true
+	actual, err = RoundtripNode(getSecurityContext(role, ExportSettings{CreateHelmChart: true}), nil)
+	if assert.NoError(err) {
+		testhelpers.IsYAMLEqualString(assert, `---
+			allowPrivilegeEscalation: true
+			privileged: true
+		`, actual)
+	}
+}
+
+func TestGetPodSecurityContext(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	role := podTemplateTestLoadRole(assert)
+	if role == nil {
+		return
+	}
+	assert.Nil(getPodSecurityContext(role, ExportSettings{}))
+
+	user, group := int64(1000), int64(2000)
+	role.Run.SecurityContext = &model.RoleRunSecurity{
+		RunAsUser:           &user,
+		FSGroup:             &group,
+		FSGroupChangePolicy: "OnRootMismatch",
+		SupplementalGroups:  []int64{3000, 3001},
+	}
+	actual, err := RoundtripKube(getPodSecurityContext(role, ExportSettings{}))
+	if assert.NoError(err) {
+		testhelpers.IsYAMLEqualString(assert, `---
+			runAsUser: 1000
+			fsGroup: 2000
+			fsGroupChangePolicy: OnRootMismatch
+			supplementalGroups: [3000, 3001]
+		`, actual)
+	}
+
+	// OpenShift assigns the users and groups itself
+	actual, err = RoundtripKube(getPodSecurityContext(role, ExportSettings{OpenShift: true}))
+	if assert.NoError(err) {
+		testhelpers.IsYAMLEqualString(assert, `---
+			supplementalGroups: [3000, 3001]
+		`, actual)
+	}
+
+	sc := getPodSecurityContext(role, ExportSettings{CreateHelmChart: true})
+	actual, err = RoundtripNode(sc, map[string]interface{}{
+		"Values.sizing.myrole.security_context": map[string]interface{}{
+			"run_as_user":            0,
+			"fs_group":               2000,
+			"fs_group_change_policy": "OnRootMismatch",
+			"supplemental_groups":    []interface{}{3000},
+		},
+		"Capabilities.KubeVersion.Major": "1",
+		"Capabilities.KubeVersion.Minor": "20",
+	})
+	if assert.NoError(err) {
+		testhelpers.IsYAMLEqualString(assert, `---
+			runAsUser: 0
+			fsGroup: 2000
+			fsGroupChangePolicy: OnRootMismatch
+			supplementalGroups: [3000]
+		`, actual)
+	}
+
+	// fsGroupChangePolicy is only known to kube 1.20 and later
+	actual, err = RoundtripNode(sc, map[string]interface{}{
+		"Values.sizing.myrole.security_context": map[string]interface{}{
+			"fs_group":               2000,
+			"fs_group_change_policy": "OnRootMismatch",
+		},
+		"Capabilities.KubeVersion.Major": "1",
+		"Capabilities.KubeVersion.Minor": "19",
+	})
+	if assert.NoError(err) {
+		testhelpers.IsYAMLEqualString(assert, `---
+			fsGroup: 2000
+		`, actual)
+	}
+}
+
 func TestPodGetContainerImageNameKube(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -2770,7 +3138,7 @@ func TestPodGetContainerImageNameKube(t *testing.T) {
 
 	assert.Nil(err)
 	assert.NotNil(name)
-	assert.Equal(`R/O/theRepo-myrole:d0aca33ba5bc55dce697d9d57b46e1b23688659c`, name)
+	assert.Equal(`R/O/theRepo-myrole:fa6f9f25dcd5bb6c0e635677d1a718e958a172db`, name)
 }
 
 func TestPodGetContainerImageNameHelm(t *testing.T) {
@@ -2809,7 +3177,7 @@ func TestPodGetContainerImageNameHelm(t *testing.T) {
 	}
 
 	testhelpers.IsYAMLEqualString(assert, `---
-		R/O/theRepo-myrole:d0aca33ba5bc55dce697d9d57b46e1b23688659c
+		R/O/theRepo-myrole:fa6f9f25dcd5bb6c0e635677d1a718e958a172db
 	`, actual)
 }
 
@@ -2914,11 +3282,165 @@ func TestPodGetContainerPortsHelmCountConfigurable(t *testing.T) {
 	`, actual)
 }
 
+func TestPodGetContainerPortsHelmJobFeatures(t *testing.T) {
+	t.Parallel()
+	role := podTestLoadRoleFrom(assert.New(t), "myrole", "job-features.yml")
+	require.NotNil(t, role)
+
+	ports, err := getContainerPorts(role, ExportSettings{CreateHelmChart: true})
+	require.NoError(t, err)
+	require.NotNil(t, ports)
+
+	t.Run("Enabled", func(t *testing.T) {
+		t.Parallel()
+		config := map[string]interface{}{
+			"Values.enable.hostname":                     true,
+			"Values.sizing.myrole.ports.tcp_route.count": "2",
+		}
+		actual, err := RoundtripNode(ports, config)
+		require.NoError(t, err)
+		testhelpers.IsYAMLEqualString(assert.New(t), `---
+			-	containerPort: 8080
+				name: "http"
+				protocol: "TCP"
+			-	containerPort: 20000
+				name: "tcp-route-0"
+				protocol: "TCP"
+			-	containerPort: 20001
+				name: "tcp-route-1"
+				protocol: "TCP"
+		`, actual)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+		config := map[string]interface{}{
+			"Values.enable.hostname":                     false,
+			"Values.sizing.myrole.ports.tcp_route.count": "2",
+		}
+		actual, err := RoundtripNode(ports, config)
+		require.NoError(t, err)
+		testhelpers.IsYAMLEqualString(assert.New(t), `---
+			-	containerPort: 8080
+				name: "http"
+				protocol: "TCP"
+			-	containerPort: 9000
+				name: "hash"
+				protocol: "TCP"
+		`, actual)
+	})
+}
+
+func TestPodGetEnvVarsJobFeatures(t *testing.T) {
+	t.Parallel()
+	role := podTestLoadRoleFrom(assert.New(t), "myrole", "job-features.yml")
+	require.NotNil(t, role)
+
+	env, err := getEnvVars(role, ExportSettings{
+		CreateHelmChart: true,
+		RoleManifest:    role.Manifest(),
+	})
+	require.NoError(t, err)
+
+	actual, err := RoundtripNode(env, map[string]interface{}{"Values.enable.hostname": true})
+	require.NoError(t, err)
+	assert.Contains(t, actual, map[interface{}]interface{}{
+		"name":  "FEATURE_HOSTNAME_ENABLED",
+		"value": "true",
+	})
+}
+
+func TestPodContainerJobsAnnotations(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Colocated", func(t *testing.T) {
+		t.Parallel()
+		workDir, err := os.Getwd()
+		require.NoError(t, err)
+
+		roleManifest, err := loader.LoadRoleManifest(filepath.Join(workDir, "../test-assets/role-manifests/kube/colocated-containers.yml"), model.LoadRoleManifestOptions{
+			ReleaseOptions: model.ReleaseOptions{
+				ReleasePaths: []string{
+					filepath.Join(workDir, "../test-assets/tor-boshrelease"),
+					filepath.Join(workDir, "../test-assets/ntp-release"),
+				},
+				BOSHCacheDir:     filepath.Join(workDir, "../test-assets/bosh-cache"),
+				FinalReleasesDir: filepath.Join(workDir, "../test-assets/.final_releases")},
+			ValidationOptions: model.RoleManifestValidationOptions{
+				AllowMissingScripts: true,
+			}})
+		require.NoError(t, err)
+
+		meta := helm.NewMapping()
+		addContainerJobsAnnotations(meta, roleManifest.LookupInstanceGroup("main-role"), ExportSettings{})
+		actual, err := RoundtripKube(meta)
+		require.NoError(t, err)
+		testhelpers.IsYAMLEqualString(assert.New(t), `---
+			annotations:
+				jobs.fissile.cloudfoundry.org/main-role: "new_hostname,tor"
+				jobs.fissile.cloudfoundry.org/to-be-colocated: "ntpd"
+		`, actual)
+	})
+
+	t.Run("JobFeatures", func(t *testing.T) {
+		t.Parallel()
+		role := podTestLoadRoleFrom(assert.New(t), "myrole", "job-features.yml")
+		require.NotNil(t, role)
+
+		meta := helm.NewMapping()
+		addContainerJobsAnnotations(meta, role, ExportSettings{CreateHelmChart: true})
+		for enabled, expected := range map[bool]string{true: "tor,new_hostname", false: "tor,hashmat"} {
+			actual, err := RoundtripNode(meta, map[string]interface{}{"Values.enable.hostname": enabled})
+			require.NoError(t, err)
+			testhelpers.IsYAMLEqualString(assert.New(t), fmt.Sprintf(`---
+				annotations:
+					jobs.fissile.cloudfoundry.org/myrole: %q
+			`, expected), actual)
+		}
+	})
+}
+
+func TestPodGetEnvVarsExternalLinks(t *testing.T) {
+	t.Parallel()
+	role := podTestLoadRoleFrom(assert.New(t), "myrole", "exposed-ports.yml")
+	require.NotNil(t, role)
+
+	role.JobReferences[0].ResolvedConsumes["db"] = model.JobConsumesInfo{
+		JobLinkInfo: model.JobLinkInfo{Name: "db", Type: "database"},
+		External: &model.JobExternalLink{
+			Address:    "db.example.com",
+			Properties: map[string]interface{}{"db": map[interface{}]interface{}{"port": 5432}},
+		},
+	}
+	role.JobReferences[0].ResolvedConsumes["nats"] = model.JobConsumesInfo{
+		JobLinkInfo: model.JobLinkInfo{Name: "nats", Type: "nats"},
+		External: &model.JobExternalLink{
+			Namespace:     "messaging",
+			InstanceGroup: "nats",
+			Job:           "nats",
+			ServiceName:   "nats-nats",
+		},
+	}
+
+	for _, createHelmChart := range []bool{false, true} {
+		env, err := getEnvVars(role, ExportSettings{
+			CreateHelmChart: createHelmChart,
+			RoleManifest:    role.Manifest(),
+		})
+		require.NoError(t, err)
+
+		for _, envVar := range env.Values() {
+			name := envVar.Get("name").String()
+			assert.False(t, strings.HasPrefix(name, "CONFIGGIN_IMPORT_"), "External links must not wait for secrets")
+		}
+	}
+}
+
 func TestPodMakeSecretVarPlain(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
 
-	sv := makeSecretVar("foo", false)
+	sv := makeSecretVar("foo", userSecretsName)
 
 	actual, err := RoundtripNode(sv, nil)
 	if !assert.NoError(err) {
@@ -2937,7 +3459,7 @@ func TestPodMakeSecretVarGenerated(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
 
-	sv := makeSecretVar("foo", true)
+	sv := makeSecretVar("foo", generatedSecretsName)
 
 	config := map[string]interface{}{
 		"Chart.Version":                          "CV",
@@ -3051,6 +3573,8 @@ func TestPodIstioManagedHelm(t *testing.T) {
 		kind: "Pod"
 		metadata:
 			name: "istio-managed-role"
+			annotations:
+				jobs.fissile.cloudfoundry.org/istio-managed-role: tor
 			labels:
 				app: istio-managed-role
 				app.kubernetes.io/component: istio-managed-role
@@ -3078,7 +3602,7 @@ func TestPodIstioManagedHelm(t *testing.T) {
 					value: "2048"
 				-	name: "VCAP_SOFT_NPROC"
 					value: "1024"
-				image: "R/O/theRepo-istio-managed-role:e9f459d3c3576bf1129a6b18ca2763f73fa19645"
+				image: "R/O/theRepo-istio-managed-role:030900795817b45a1e29417391fcf92d8cf39ecb"
 				lifecycle:
 					preStop:
 						exec:
@@ -3112,3 +3636,225 @@ func TestPodIstioManagedHelm(t *testing.T) {
 					secretName: deployment-manifest
 	`, actual)
 }
+
+// BenchmarkPodGetEnvVarsHelm tracks the time to render the environment of a
+// chart with many variables, like the ~500 of a full deployment.
+func BenchmarkPodGetEnvVarsHelm(b *testing.B) {
+	var variables model.Variables
+	config := map[string]interface{}{}
+	for i := 0; i < 500; i++ {
+		name := fmt.Sprintf("VARIABLE_%d", i)
+		variables = append(variables, &model.VariableDefinition{
+			Name: name,
+			CVOptions: model.CVOptions{
+				Type:      model.CVTypeUser,
+				Required:  i%5 == 0,
+				ImageName: i%50 == 0,
+			},
+		})
+		switch i % 3 {
+		case 0:
+			config["Values.env."+name] = "value"
+		case 1:
+			config["Values.env."+name] = []interface{}{"a", "b"}
+		}
+		if i%5 == 0 {
+			config["Values.env."+name] = "required"
+		}
+	}
+	ev, err := getEnvVarsFromConfigs(variables, userSecretsName, ExportSettings{
+		CreateHelmChart: true,
+		RoleManifest: &model.RoleManifest{
+			InstanceGroups: []*model.InstanceGroup{
+				&model.InstanceGroup{
+					Name: "foo",
+				},
+			},
+		},
+	})
+	require.NoError(b, err)
+	node := helm.NewNode(ev)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := RenderNode(node, config)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestPodConfigChecksumInstanceGroup(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "config-checksum.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	settings := ExportSettings{
+		RoleManifest:    manifest,
+		CreateHelmChart: true,
+		ConfigChecksum:  ConfigChecksumInstanceGroup,
+	}
+	podTemplate, err := NewPodTemplate(role, settings, nil)
+	require.NoError(t, err)
+	renderer, err := newTestRenderer(MakeValues(settings))
+	require.NoError(t, err)
+
+	checksum := func(config map[string]interface{}) string {
+		actual, err := renderer.RoundtripNode(podTemplate, config)
+		require.NoError(t, err)
+		metadata := actual.(map[interface{}]interface{})["metadata"].(map[interface{}]interface{})
+		annotations := metadata["annotations"].(map[interface{}]interface{})
+		return annotations["checksum/config"].(string)
+	}
+
+	base := checksum(nil)
+	assert.Len(base, 64)
+	assert.Equal(base, checksum(map[string]interface{}{
+		"Values.secrets.OTHER_PRIVATE_KEY": "changed",
+	}), "Secrets of other instance groups do not roll the pods")
+	assert.NotEqual(base, checksum(map[string]interface{}{
+		"Values.secrets.PRIVATE_KEY": "changed",
+	}), "Consumed secrets roll the pods")
+	assert.NotEqual(base, checksum(map[string]interface{}{
+		"Values.secrets.CONTROL_PASSWORD": "changed",
+	}), "Overridden generated secrets roll the pods")
+
+	otherRole := map[interface{}]interface{}{"name": "otherrole", "jobs": []interface{}{}}
+	assert.Equal(base, checksum(map[string]interface{}{
+		"Values.bosh.instance_groups": []interface{}{otherRole},
+	}), "Deployment manifest entries of other instance groups do not roll the pods")
+	myRole := map[interface{}]interface{}{"name": "myrole", "jobs": []interface{}{}}
+	assert.NotEqual(base, checksum(map[string]interface{}{
+		"Values.bosh.instance_groups": []interface{}{otherRole, myRole},
+	}), "Deployment manifest entries of the instance group roll the pods")
+}
+
+func TestPodImagePullKube(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "image-pull-policy.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	podTemplate, err := NewPodTemplate(role, ExportSettings{RoleManifest: manifest}, nil)
+	require.NoError(t, err)
+	actual, err := RoundtripKube(podTemplate)
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		spec:
+			containers:
+			-	imagePullPolicy: Always
+			imagePullSecrets:
+			-	name: registry-credentials
+	`, actual)
+}
+
+func TestPodImagePullHelm(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "image-pull-policy.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	settings := ExportSettings{
+		RoleManifest:    manifest,
+		CreateHelmChart: true,
+	}
+	podTemplate, err := NewPodTemplate(role, settings, nil)
+	require.NoError(t, err)
+	renderer, err := newTestRenderer(MakeValues(settings))
+	require.NoError(t, err)
+
+	render := func(config map[string]interface{}) map[interface{}]interface{} {
+		actual, err := renderer.RoundtripNode(podTemplate, config)
+		require.NoError(t, err)
+		return actual.(map[interface{}]interface{})["spec"].(map[interface{}]interface{})
+	}
+	container := func(spec map[interface{}]interface{}) map[interface{}]interface{} {
+		return spec["containers"].([]interface{})[0].(map[interface{}]interface{})
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		spec := render(nil)
+		assert.Equal("Always", container(spec)["imagePullPolicy"], "The role manifest sets the default policy")
+		assert.NotContains(spec, "imagePullSecrets", "No pull secret without a registry user")
+	})
+
+	t.Run("Overridden", func(t *testing.T) {
+		spec := render(map[string]interface{}{
+			"Values.sizing.myrole.image_pull_policy": "IfNotPresent",
+			"Values.kube.registry.username":          "user",
+		})
+		assert.Equal("IfNotPresent", container(spec)["imagePullPolicy"])
+		assert.Equal([]interface{}{
+			map[interface{}]interface{}{"name": "registry-credentials"},
+		}, spec["imagePullSecrets"])
+	})
+
+	t.Run("No policy", func(t *testing.T) {
+		spec := render(map[string]interface{}{
+			"Values.sizing.myrole.image_pull_policy": nil,
+		})
+		assert.NotContains(container(spec), "imagePullPolicy")
+	})
+
+	t.Run("Pull secrets", func(t *testing.T) {
+		spec := render(map[string]interface{}{
+			"Values.kube.registry.username":     "user",
+			"Values.kube.registry.pull_secrets": []interface{}{"first", "second"},
+		})
+		assert.Equal([]interface{}{
+			map[interface{}]interface{}{"name": "first"},
+			map[interface{}]interface{}{"name": "second"},
+		}, spec["imagePullSecrets"])
+	})
+
+	t.Run("No pull secrets", func(t *testing.T) {
+		spec := render(map[string]interface{}{
+			"Values.kube.registry.username":     "user",
+			"Values.kube.registry.pull_secrets": []interface{}{},
+		})
+		assert.NotContains(spec, "imagePullSecrets", "An empty list uses no pull secret")
+	})
+}
+
+func TestPodStartupOrder(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "startup-order.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+	settings := ExportSettings{
+		RoleManifest: manifest,
+		Opinions:     model.NewEmptyOpinions(),
+		Repository:   "repo",
+	}
+
+	podTemplate, err := NewPodTemplate(role, settings, nil)
+	require.NoError(t, err)
+	actual, err := RoundtripKube(podTemplate)
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		spec:
+			initContainers:
+			-	name: wait-for-db
+				command:
+				-	/bin/sh
+				-	-c
+				-	until getent hosts db-set > /dev/null; do echo 'Waiting for db'; sleep 5; done
+	`, actual)
+
+	podTemplate, err = NewPodTemplate(manifest.LookupInstanceGroup("db"), settings, nil)
+	require.NoError(t, err)
+	assert.Nil(podTemplate.Get("spec", "initContainers"), "The first instance group does not wait")
+}
@@ -63,8 +63,9 @@ func NewRBACAccount(accountName string, config *model.Configuration, settings Ex
 		resources = append(resources, serviceAccount)
 	}
 
-	// For each role, create a role binding
-	for _, roleName := range account.Roles {
+	// For each role, create a role binding; roles listed more than once
+	// are bound once
+	for _, roleName := range uniqueNames(account.Roles) {
 		// Embed the role first, if it's only used by this binding
 		var usedByAccounts []string
 		for accountName := range config.Authorization.RoleUsedBy[roleName] {
@@ -98,35 +99,35 @@ func NewRBACAccount(accountName string, config *model.Configuration, settings Ex
 		}
 		subjects := helm.NewList(helm.NewMapping(
 			"kind", "ServiceAccount",
-			"name", accountName))
+			"name", kubeName(accountName)))
 		binding.Add("subjects", subjects)
 		binding.Add("roleRef", helm.NewMapping(
 			"apiGroup", "rbac.authorization.k8s.io",
 			"kind", "Role",
-			"name", roleName))
+			"name", kubeName(roleName)))
 		resources = append(resources, binding)
 	}
 
-	// We have no proper namespace default for kube configuration.
+	// We have no proper namespace default for kube configuration, unless
+	// it is substituted.
 	namespace := "~"
+	if settings.Substitutions.Namespace != "" {
+		namespace = settings.Substitutions.Namespace
+	}
 	if settings.CreateHelmChart {
 		namespace = "{{ .Release.Namespace }}"
 	}
 
 	// For each cluster role, create a cluster role binding
 	// And if the cluster role is only used here, embed that too
-	for _, clusterRoleName := range account.ClusterRoles {
+	for _, clusterRoleName := range uniqueNames(account.ClusterRoles) {
 		// Embed the cluster role first, if it's only used by this binding
 		var accountNames []string
 		for accountName := range config.Authorization.ClusterRoleUsedBy[clusterRoleName] {
 			accountNames = append(accountNames, accountName)
 		}
 		if len(accountNames) < 2 {
-			role, err := NewRBACRole(
-				clusterRoleName,
-				RBACRoleKindClusterRole,
-				config.Authorization.ClusterRoles[clusterRoleName],
-				settings)
+			role, err := NewRBACClusterRole(clusterRoleName, config.Authorization, settings)
 			if err != nil {
 				return nil, err
 			}
@@ -156,7 +157,7 @@ func NewRBACAccount(accountName string, config *model.Configuration, settings Ex
 		}
 		subjects := helm.NewList(helm.NewMapping(
 			"kind", "ServiceAccount",
-			"name", accountName,
+			"name", kubeName(accountName),
 			"namespace", namespace))
 		binding.Add("subjects", subjects)
 		roleRef := helm.NewMapping(
@@ -165,7 +166,7 @@ func NewRBACAccount(accountName string, config *model.Configuration, settings Ex
 		if settings.CreateHelmChart {
 			roleRef.Add("name", fmt.Sprintf(`{{ template "fissile.SanitizeName" (printf "%%s-cluster-role-%s" .Release.Namespace) }}`, clusterRoleName))
 		} else {
-			roleRef.Add("name", clusterRoleName)
+			roleRef.Add("name", kubeName(clusterRoleName))
 		}
 		binding.Add("roleRef", roleRef)
 		resources = append(resources, binding)
@@ -174,8 +175,118 @@ func NewRBACAccount(accountName string, config *model.Configuration, settings Ex
 	return resources, nil
 }
 
+// uniqueNames returns the names without repetitions, keeping the first of each
+func uniqueNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	var unique []string
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	return unique
+}
+
 // NewRBACRole creates a new (Kubernetes RBAC) role / cluster role
 func NewRBACRole(name string, kind RBACRoleKind, authRole model.AuthRole, settings ExportSettings) (helm.Node, error) {
+	role, err := newRBACRoleMapping(name, kind, settings)
+	if err != nil {
+		return nil, err
+	}
+	role.Add("rules", newRBACRules(authRole, settings))
+
+	return role.Sort(), nil
+}
+
+// ClusterRoleNamespaceKey is the key of the label helm charts add to the
+// labeled cluster roles, and to the selectors of aggregated cluster roles
+// matching them; the value is the namespace of the release, so that the
+// cluster roles of releases in different namespaces are not aggregated
+// together.
+const ClusterRoleNamespaceKey = "fissile.cloudfoundry.org/namespace"
+
+// NewRBACClusterRole creates a new (Kubernetes RBAC) cluster role, which is
+// either aggregated from other cluster roles by label, or has its own rules.
+// The cluster role labels of the configuration are added.
+func NewRBACClusterRole(name string, auth model.ConfigurationAuthorization, settings ExportSettings) (helm.Node, error) {
+	role, err := newRBACRoleMapping(name, RBACRoleKindClusterRole, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if aggregation, ok := auth.AggregatedClusterRoles[name]; ok {
+		selectors := helm.NewList()
+		for _, selector := range aggregation.Selectors {
+			matchLabels := helm.NewMapping()
+			for _, key := range sortedKeys(selector) {
+				matchLabels.Add(key, selector[key])
+			}
+			if settings.CreateHelmChart && selectsLabeledClusterRole(auth, selector) {
+				matchLabels.Add(ClusterRoleNamespaceKey, "{{ .Release.Namespace | quote }}")
+			}
+			selectors.Add(helm.NewMapping("matchLabels", matchLabels))
+		}
+		role.Add("aggregationRule", helm.NewMapping("clusterRoleSelectors", selectors))
+		// Kubernetes fills in the rules
+		role.Add("rules", helm.NewList())
+	} else {
+		role.Add("rules", newRBACRules(auth.ClusterRoles[name], settings))
+	}
+
+	if labels := auth.ClusterRoleLabels[name]; len(labels) > 0 {
+		labelsNode := role.Get("metadata", "labels").(*helm.Mapping)
+		for _, key := range sortedKeys(labels) {
+			labelsNode.Add(key, labels[key])
+		}
+		if settings.CreateHelmChart {
+			labelsNode.Add(ClusterRoleNamespaceKey, "{{ .Release.Namespace | quote }}")
+		}
+	}
+
+	return role.Sort(), nil
+}
+
+// selectsLabeledClusterRole returns whether the selector of an aggregated
+// cluster role matches a cluster role labeled by the configuration, rather
+// than only cluster roles from outside the chart
+func selectsLabeledClusterRole(auth model.ConfigurationAuthorization, selector map[string]string) bool {
+	for _, labels := range auth.ClusterRoleLabels {
+		matches := true
+		for key, value := range selector {
+			if labels[key] != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// newRBACRoleMapping creates a role / cluster role without rules
+func newRBACRoleMapping(name string, kind RBACRoleKind, settings ExportSettings) (*helm.Mapping, error) {
+	cb := NewConfigBuilder().
+		SetSettings(&settings).
+		SetAPIVersion("rbac.authorization.k8s.io/v1").
+		SetKind(string(kind)).
+		AddModifier(authModeRBAC(settings))
+	if kind == RBACRoleKindClusterRole && settings.CreateHelmChart {
+		cb.SetNameHelmExpression(fmt.Sprintf(`{{ template "fissile.SanitizeName" (printf "%%s-cluster-role-%s" .Release.Namespace) }}`, name))
+	} else {
+		cb.SetName(name)
+	}
+	role, err := cb.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build a new kube config: %v", err)
+	}
+	return role, nil
+}
+
+// newRBACRules creates the rules of a role / cluster role
+func newRBACRules(authRole model.AuthRole, settings ExportSettings) *helm.List {
 	rules := helm.NewList()
 	for _, ruleSpec := range authRole {
 		rule := helm.NewMapping()
@@ -197,25 +308,11 @@ func NewRBACRole(name string, kind RBACRoleKind, authRole model.AuthRole, settin
 			rule.Add("resourceNames", resourceNames)
 		}
 		rules.Add(rule.Sort())
+		if settings.OpenShift && ruleSpec.IsPodSecurityPolicyRule() && len(ruleSpec.ResourceNames) > 0 {
+			rules.Add(sccRuleFor(ruleSpec, settings))
+		}
 	}
-
-	cb := NewConfigBuilder().
-		SetSettings(&settings).
-		SetAPIVersion("rbac.authorization.k8s.io/v1").
-		SetKind(string(kind)).
-		AddModifier(authModeRBAC(settings))
-	if kind == RBACRoleKindClusterRole && settings.CreateHelmChart {
-		cb.SetNameHelmExpression(fmt.Sprintf(`{{ template "fissile.SanitizeName" (printf "%%s-cluster-role-%s" .Release.Namespace) }}`, name))
-	} else {
-		cb.SetName(name)
-	}
-	role, err := cb.Build()
-	if err != nil {
-		return nil, fmt.Errorf("failed to build a new kube config: %v", err)
-	}
-	role.Add("rules", rules)
-
-	return role.Sort(), nil
+	return rules
 }
 
 // NewRBACPSP creates a (Kubernetes RBAC) pod security policy
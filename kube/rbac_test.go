@@ -308,6 +308,162 @@ func TestNewRBACRoleHelm(t *testing.T) {
 	})
 }
 
+func TestNewRBACClusterRoleAggregatedKube(t *testing.T) {
+	t.Parallel()
+
+	auth := model.ConfigurationAuthorization{
+		AggregatedClusterRoles: map[string]model.AuthAggregation{
+			"aggregate": {Selectors: []map[string]string{
+				{"example.com/aggregate-to": "aggregate"},
+			}},
+		},
+		ClusterRoleLabels: map[string]map[string]string{
+			"aggregate": {"example.com/owner": "fissile"},
+		},
+	}
+	resource, err := NewRBACClusterRole("aggregate", auth, ExportSettings{})
+	require.NoError(t, err)
+
+	actual, err := RoundtripKube(resource)
+	require.NoError(t, err)
+	testhelpers.IsYAMLEqualString(assert.New(t), `---
+		apiVersion: "rbac.authorization.k8s.io/v1"
+		kind: "ClusterRole"
+		metadata:
+			name: "aggregate"
+			labels:
+				app.kubernetes.io/component: aggregate
+				example.com/owner: fissile
+		aggregationRule:
+			clusterRoleSelectors:
+			-	matchLabels:
+					example.com/aggregate-to: aggregate
+		rules: []
+	`, actual)
+}
+
+func TestNewRBACClusterRoleLabelsHelm(t *testing.T) {
+	t.Parallel()
+
+	auth := model.ConfigurationAuthorization{
+		ClusterRoles: map[string]model.AuthRole{
+			"nodes": {{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"list"}}},
+		},
+		ClusterRoleLabels: map[string]map[string]string{
+			"nodes": {"example.com/aggregate-to": "aggregate"},
+		},
+	}
+	resource, err := NewRBACClusterRole("nodes", auth, ExportSettings{CreateHelmChart: true})
+	require.NoError(t, err)
+
+	config := map[string]interface{}{
+		"Values.kube.auth":  "rbac",
+		"Release.Namespace": "namespace",
+	}
+	actual, err := RoundtripNode(resource, config)
+	require.NoError(t, err)
+	testhelpers.IsYAMLEqualString(assert.New(t), `---
+		apiVersion: "rbac.authorization.k8s.io/v1"
+		kind: "ClusterRole"
+		metadata:
+			name: "namespace-cluster-role-nodes"
+			labels:
+				app.kubernetes.io/component: namespace-cluster-role-nodes
+				app.kubernetes.io/instance: MyRelease
+				app.kubernetes.io/managed-by: Tiller
+				app.kubernetes.io/name: MyChart
+				app.kubernetes.io/version: 1.22.333.4444
+				example.com/aggregate-to: aggregate
+				fissile.cloudfoundry.org/namespace: namespace
+				helm.sh/chart: MyChart-42.1_foo
+				skiff-role-name: "namespace-cluster-role-nodes"
+		rules:
+		-	apiGroups:
+			-	""
+			resources:
+			-	"nodes"
+			verbs:
+			-	"list"
+	`, actual)
+}
+
+func TestNewRBACClusterRoleAggregatedHelm(t *testing.T) {
+	t.Parallel()
+
+	auth := model.ConfigurationAuthorization{
+		AggregatedClusterRoles: map[string]model.AuthAggregation{
+			"aggregate": {Selectors: []map[string]string{
+				{"example.com/aggregate-to": "aggregate"},
+				{"rbac.example.com/aggregate-to-view": "true"},
+			}},
+		},
+		ClusterRoleLabels: map[string]map[string]string{
+			"nodes": {"example.com/aggregate-to": "aggregate", "example.com/owner": "fissile"},
+		},
+	}
+	resource, err := NewRBACClusterRole("aggregate", auth, ExportSettings{CreateHelmChart: true})
+	require.NoError(t, err)
+
+	config := map[string]interface{}{
+		"Values.kube.auth":  "rbac",
+		"Release.Namespace": "namespace",
+	}
+	actual, err := RoundtripNode(resource, config)
+	require.NoError(t, err)
+	// Only the selector of cluster roles of the chart is limited to the
+	// namespace of the release
+	testhelpers.IsYAMLSubsetString(assert.New(t), `---
+		metadata:
+			name: "namespace-cluster-role-aggregate"
+		aggregationRule:
+			clusterRoleSelectors:
+			-	matchLabels:
+					example.com/aggregate-to: aggregate
+					fissile.cloudfoundry.org/namespace: namespace
+			-	matchLabels:
+					rbac.example.com/aggregate-to-view: "true"
+	`, actual)
+	selectors := actual.(map[interface{}]interface{})["aggregationRule"].(map[interface{}]interface{})["clusterRoleSelectors"].([]interface{})
+	assert.Len(t, selectors[1].(map[interface{}]interface{})["matchLabels"], 1)
+}
+
+func TestNewRBACAccountDeduplicatesRoles(t *testing.T) {
+	t.Parallel()
+
+	resources, err := NewRBACAccount("the-name",
+		&model.Configuration{
+			Authorization: model.ConfigurationAuthorization{
+				Accounts: map[string]model.AuthAccount{
+					"the-name": {
+						Roles:        []string{"a-role", "a-role"},
+						ClusterRoles: []string{"aggregate", "aggregate"},
+						UsedBy:       map[string]struct{}{"foo": struct{}{}},
+					},
+				},
+				AggregatedClusterRoles: map[string]model.AuthAggregation{
+					"aggregate": {Selectors: []map[string]string{{"aggregate": "true"}}},
+				},
+			},
+		}, ExportSettings{})
+	require.NoError(t, err)
+
+	kinds := make(map[string]int)
+	for _, resource := range resources {
+		kinds[resource.Get("kind").String()]++
+	}
+	assert.Equal(t, map[string]int{
+		"ServiceAccount":     1,
+		"Role":               1,
+		"RoleBinding":        1,
+		"ClusterRole":        1,
+		"ClusterRoleBinding": 1,
+	}, kinds)
+
+	clusterRole := findKind(resources, "ClusterRole")
+	require.NotNil(t, clusterRole)
+	assert.NotNil(t, clusterRole.Get("aggregationRule"), "cluster role should be aggregated")
+}
+
 /*
 func TestNewRBACClusterRolePSPKube(t *testing.T) {
 	t.Parallel()
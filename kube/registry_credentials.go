@@ -6,10 +6,14 @@ import (
 	"code.cloudfoundry.org/fissile/helm"
 )
 
-// MakeRegistryCredentials generates a template that contains Docker Registry credentials
+// MakeRegistryCredentials generates a template that contains Docker Registry
+// credentials.  Helm charts generate them from the kube.registry values when a
+// username is set, as a kubernetes.io/dockercfg secret, or as a
+// kubernetes.io/dockerconfigjson secret when kube.registry.config_json is set.
 func MakeRegistryCredentials(settings ExportSettings) (helm.Node, error) {
 
-	value := ""
+	data := helm.NewMapping(".dockercfg", "")
+	secretType := "kubernetes.io/dockercfg"
 	if settings.CreateHelmChart {
 		// Registry secrets are in json format:
 		// {
@@ -20,18 +24,26 @@ func MakeRegistryCredentials(settings ExportSettings) (helm.Node, error) {
 		//   }
 		// }
 		//
-		// where "auth" is a base64 encoded "username:password"
+		// where "auth" is a base64 encoded "username:password".  The
+		// dockerconfigjson format wraps this in {"auths": ...}.
 
-		value = `{{ printf "{%q:{%q:%q,%q:%q,%q:%q}}" ` +
+		registry := `printf "{%q:{%q:%q,%q:%q,%q:%q}}" ` +
 			`.Values.kube.registry.hostname ` +
 			`"username" .Values.kube.registry.username ` +
 			`"password" .Values.kube.registry.password ` +
-			`"auth" (printf "%s:%s" .Values.kube.registry.username .Values.kube.registry.password | b64enc) ` +
-			`| b64enc }}`
+			`"auth" (printf "%s:%s" .Values.kube.registry.username .Values.kube.registry.password | b64enc)`
+
+		// The type of a secret cannot change, so upgrades of releases
+		// keep the dockercfg secret unless asked otherwise
+		data = helm.NewMapping()
+		data.Add(".dockercfg", helm.Template(registry+" | b64enc"),
+			helm.Block("if not .Values.kube.registry.config_json"))
+		data.Add(".dockerconfigjson", helm.Template(fmt.Sprintf(`printf "{%%q:%%s}" "auths" (%s) | b64enc`, registry)),
+			helm.Block("if .Values.kube.registry.config_json"))
+		secretType = helm.QuotedTemplate(`ternary "kubernetes.io/dockerconfigjson" "kubernetes.io/dockercfg" ` +
+			`(.Values.kube.registry.config_json | default false)`)
 	}
 
-	data := helm.NewMapping(".dockercfg", value)
-
 	cb := NewConfigBuilder().
 		SetSettings(&settings).
 		SetAPIVersion("v1").
@@ -45,7 +57,7 @@ func MakeRegistryCredentials(settings ExportSettings) (helm.Node, error) {
 		return nil, fmt.Errorf("failed to build a new kube config: %v", err)
 	}
 	secret.Add("data", data)
-	secret.Add("type", "kubernetes.io/dockercfg")
+	secret.Add("type", secretType)
 
 	return secret.Sort(), nil
 }
@@ -96,3 +96,66 @@ func TestMakeRegistryCredentialsHelm(t *testing.T) {
 	}
 	assert.Nil(actual, "There should be no credentials when the username is empty")
 }
+
+func TestMakeRegistryCredentialsHelmUpgrade(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	registryCredentials, err := MakeRegistryCredentials(ExportSettings{
+		CreateHelmChart: true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+
+	// The values of releases installed from charts generated with the
+	// kubernetes.io/dockercfg secret lack kube.registry.config_json; the type
+	// of the secret cannot change, so their upgrades must keep it
+	config := map[string]interface{}{
+		"Values.kube.registry.hostname":    "the-host",
+		"Values.kube.registry.username":    "the-user",
+		"Values.kube.registry.password":    "the-password",
+		"Values.kube.registry.config_json": nil,
+	}
+	actual, err := RoundtripNode(registryCredentials, config)
+	if !assert.NoError(err) {
+		return
+	}
+	testhelpers.IsYAMLSubsetString(assert, fmt.Sprintf(`---
+		data:
+			.dockercfg: %s
+		type: "kubernetes.io/dockercfg"
+	`, RenderEncodeBase64(fmt.Sprintf(`{"the-host":{"username":"the-user","password":"the-password","auth":%q}}`,
+		RenderEncodeBase64("the-user:the-password")))), actual)
+	assert.Len(actual.(map[interface{}]interface{})["data"], 1)
+}
+
+func TestMakeRegistryCredentialsHelmConfigJSON(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	registryCredentials, err := MakeRegistryCredentials(ExportSettings{
+		CreateHelmChart: true,
+	})
+	if !assert.NoError(err) {
+		return
+	}
+
+	config := map[string]interface{}{
+		"Values.kube.registry.hostname":    "the-host",
+		"Values.kube.registry.username":    "the-user",
+		"Values.kube.registry.password":    "the-password",
+		"Values.kube.registry.config_json": true,
+	}
+	actual, err := RoundtripNode(registryCredentials, config)
+	if !assert.NoError(err) {
+		return
+	}
+	testhelpers.IsYAMLSubsetString(assert, fmt.Sprintf(`---
+		data:
+			.dockerconfigjson: %s
+		type: "kubernetes.io/dockerconfigjson"
+	`, RenderEncodeBase64(fmt.Sprintf(`{"auths":{"the-host":{"username":"the-user","password":"the-password","auth":%q}}}`,
+		RenderEncodeBase64("the-user:the-password")))), actual)
+	assert.Len(actual.(map[interface{}]interface{})["data"], 1)
+}
@@ -0,0 +1,99 @@
+package kube
+
+import (
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/helm"
+)
+
+// Annotations of workloads listing the secrets and config maps their pods
+// consume, for a reloader (e.g. https://github.com/stakater/Reloader) to roll
+// the pods of only those workloads when the secrets or config maps change.
+const (
+	ReloaderSecretAnnotation    = "secret.reloader.stakater.com/reload"
+	ReloaderConfigMapAnnotation = "configmap.reloader.stakater.com/reload"
+)
+
+// reloaderCondition is the condition of the reloader annotations in helm charts
+const reloaderCondition = "if .Values.config.reloader"
+
+// addReloaderAnnotations adds the reloader annotations for the secrets and
+// config maps the pod template consumes to the metadata of the workload, in
+// helm charts when the config.reloader value is set
+func addReloaderAnnotations(workload *helm.Mapping, podTemplate helm.Node, settings ExportSettings) {
+	if !settings.CreateHelmChart {
+		return
+	}
+	secrets, configMaps := podTemplateReferences(podTemplate)
+
+	annotations := helm.NewMapping()
+	if len(secrets) > 0 {
+		annotations.Add(ReloaderSecretAnnotation, strings.Join(secrets, ","))
+	}
+	if len(configMaps) > 0 {
+		annotations.Add(ReloaderConfigMapAnnotation, strings.Join(configMaps, ","))
+	}
+	if len(annotations.Names()) == 0 {
+		return
+	}
+
+	metadata := workload.Get("metadata").(*helm.Mapping)
+	existing, ok := metadata.Get("annotations").(*helm.Mapping)
+	if !ok {
+		metadata.Add("annotations", annotations, helm.Block(reloaderCondition))
+		return
+	}
+	for _, name := range annotations.Names() {
+		existing.Add(name, annotations.Get(name), helm.Block(reloaderCondition))
+	}
+	existing.Sort()
+}
+
+// podTemplateReferences returns the sorted names of the secrets and config
+// maps the environment variables and volumes of the pod template refer to
+func podTemplateReferences(podTemplate helm.Node) ([]string, []string) {
+	secrets := map[string]bool{}
+	configMaps := map[string]bool{}
+	var walk func(node helm.Node)
+	walk = func(node helm.Node) {
+		switch node := node.(type) {
+		case *helm.Mapping:
+			for _, name := range node.Names() {
+				value := node.Get(name)
+				switch name {
+				case "secretKeyRef":
+					addReference(secrets, value.Get("name"))
+				case "secret":
+					addReference(secrets, value.Get("secretName"))
+				case "configMapKeyRef", "configMap":
+					addReference(configMaps, value.Get("name"))
+				}
+				walk(value)
+			}
+		case *helm.List:
+			for _, value := range node.Values() {
+				walk(value)
+			}
+		}
+	}
+	walk(podTemplate)
+	return sortedReferences(secrets), sortedReferences(configMaps)
+}
+
+// addReference adds the name of a secret or config map to the references
+func addReference(references map[string]bool, name helm.Node) {
+	if name != nil && name.String() != "" {
+		references[name.String()] = true
+	}
+}
+
+// sortedReferences returns the sorted names of the references
+func sortedReferences(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,104 @@
+package kube
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/validation"
+)
+
+// SchemaValidator checks Kubernetes objects against the OpenAPI schemas of
+// a Kubernetes version.  The schemas are read from a directory in the layout
+// used by kubeval (e.g. the v1.14.0-standalone-strict directory of
+// https://github.com/instrumenta/kubernetes-json-schema): one file per kind,
+// named <kind>-<group>-<version>.json, like deployment-apps-v1.json.
+type SchemaValidator struct {
+	dir     string
+	schemas map[string]*validation.JSONSchema
+}
+
+// NewSchemaValidator creates a validator for the schemas in the directory.
+func NewSchemaValidator(dir string) (*SchemaValidator, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading kube schema directory: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("Kube schema directory %s is not a directory", dir)
+	}
+	return &SchemaValidator{dir: dir, schemas: make(map[string]*validation.JSONSchema)}, nil
+}
+
+// schemaFileName returns the name of the schema file for an object.
+func schemaFileName(apiVersion, kind string) string {
+	name := strings.ToLower(kind)
+	parts := strings.SplitN(apiVersion, "/", 2)
+	if len(parts) == 2 {
+		// Only the first component of the group is used,
+		// e.g. rbac.authorization.k8s.io/v1 -> rbac-v1
+		group := strings.SplitN(parts[0], ".", 2)[0]
+		name += "-" + strings.ToLower(group)
+	}
+	return name + "-" + strings.ToLower(parts[len(parts)-1]) + ".json"
+}
+
+// schemaFor returns the schema for the kind, or nil if there is none.
+func (v *SchemaValidator) schemaFor(apiVersion, kind string) (*validation.JSONSchema, error) {
+	fileName := schemaFileName(apiVersion, kind)
+	if schema, ok := v.schemas[fileName]; ok {
+		return schema, nil
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(v.dir, fileName))
+	if os.IsNotExist(err) {
+		v.schemas[fileName] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var schema validation.JSONSchema
+	if err := json.Unmarshal(contents, &schema); err != nil {
+		return nil, fmt.Errorf("Error reading schema %s: %v", fileName, err)
+	}
+	v.schemas[fileName] = &schema
+	return &schema, nil
+}
+
+// Validate checks a Kubernetes object (as unmarshalled from YAML) against
+// the schema of its kind.  The fields of the errors are prefixed with the
+// name of the object, like `Deployment/router: spec.replicas`.  The boolean
+// result is false if there is no schema for the kind of the object, in which
+// case nothing was checked.
+func (v *SchemaValidator) Validate(object interface{}) (validation.ErrorList, bool) {
+	obj, ok := validation.NormalizeObject(object).(map[string]interface{})
+	if !ok {
+		return validation.ErrorList{validation.Invalid("(object)", object, "not a mapping")}, true
+	}
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	if apiVersion == "" || kind == "" {
+		return validation.ErrorList{validation.Required("(object)", "apiVersion and kind are required")}, true
+	}
+
+	prefix := kind
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		if name, ok := metadata["name"].(string); ok {
+			prefix = fmt.Sprintf("%s/%s", kind, name)
+		}
+	}
+
+	schema, err := v.schemaFor(apiVersion, kind)
+	if err != nil {
+		return validation.ErrorList{validation.InternalError(prefix, err)}, true
+	}
+	if schema == nil {
+		return nil, false
+	}
+
+	return schema.Validate(obj, prefix+":"), true
+}
@@ -0,0 +1,138 @@
+package kube
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func newTestSchemaValidator(t *testing.T) *SchemaValidator {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	validator, err := NewSchemaValidator(filepath.Join(workDir, "../test-assets/kube-schemas"))
+	require.NoError(t, err)
+	return validator
+}
+
+func parseTestObject(t *testing.T, text string) interface{} {
+	var object interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(text), &object))
+	return object
+}
+
+func TestSchemaFileName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("secret-v1.json", schemaFileName("v1", "Secret"))
+	assert.Equal("statefulset-apps-v1.json", schemaFileName("apps/v1", "StatefulSet"))
+	assert.Equal("role-rbac-v1.json", schemaFileName("rbac.authorization.k8s.io/v1", "Role"))
+}
+
+func TestSchemaValidatorValid(t *testing.T) {
+	assert := assert.New(t)
+	validator := newTestSchemaValidator(t)
+
+	errs, known := validator.Validate(parseTestObject(t, `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: router
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: router
+        ports:
+        - containerPort: 80
+          targetPort: http
+`))
+	assert.True(known)
+	assert.Empty(errs)
+
+	errs, known = validator.Validate(parseTestObject(t, `---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: secrets
+  labels: ~
+data:
+  password: c2VjcmV0
+`))
+	assert.True(known)
+	assert.Empty(errs)
+}
+
+func TestSchemaValidatorErrors(t *testing.T) {
+	assert := assert.New(t)
+	validator := newTestSchemaValidator(t)
+
+	errs, known := validator.Validate(parseTestObject(t, `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: router
+spec:
+  replicas: "2"
+  unknown: true
+  template:
+    spec:
+      containers:
+      - ports:
+        - containerPort: 1.5
+          targetPort: [80]
+`))
+	assert.True(known)
+	assert.Equal(validation.ErrorList{
+		validation.Invalid("Deployment/router: spec.replicas", "2", "expected integer or null, found string"),
+		validation.Required("Deployment/router: spec.template.spec.containers[0].name", ""),
+		validation.Invalid("Deployment/router: spec.template.spec.containers[0].ports[0].containerPort", 1.5, "expected integer or null, found number"),
+		validation.Invalid("Deployment/router: spec.template.spec.containers[0].ports[0].targetPort", []interface{}{80}, "does not match any of the allowed schemas"),
+		validation.Forbidden("Deployment/router: spec.unknown", "unknown field"),
+	}, errs)
+
+	errs, known = validator.Validate(parseTestObject(t, `---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: secrets
+  annotations: {}
+data:
+  password: 42
+`))
+	assert.True(known)
+	assert.Equal(validation.ErrorList{
+		validation.Invalid("Secret/secrets: data.password", 42, "expected string or null, found integer"),
+		validation.Forbidden("Secret/secrets: metadata.annotations", "unknown field"),
+	}, errs)
+}
+
+func TestSchemaValidatorUnknownKind(t *testing.T) {
+	assert := assert.New(t)
+	validator := newTestSchemaValidator(t)
+
+	errs, known := validator.Validate(parseTestObject(t, `---
+apiVersion: v1
+kind: Service
+metadata:
+  name: router
+`))
+	assert.False(known)
+	assert.Empty(errs)
+
+	errs, known = validator.Validate(parseTestObject(t, `---
+metadata:
+  name: router
+`))
+	assert.True(known)
+	assert.Len(errs, 1)
+
+	_, err := NewSchemaValidator(filepath.Join(os.TempDir(), "does-not-exist"))
+	assert.Error(err)
+}
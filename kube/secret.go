@@ -3,6 +3,7 @@ package kube
 import (
 	"encoding/base64"
 	"fmt"
+	"sort"
 	"strings"
 
 	"code.cloudfoundry.org/fissile/helm"
@@ -10,9 +11,98 @@ import (
 	"code.cloudfoundry.org/fissile/util"
 )
 
+// SecretGrouping determines how the user secrets are split into Secret objects
+type SecretGrouping string
+
+// These are the supported secret groupings
+const (
+	SecretGroupingSingle        = SecretGrouping("single")         // All user secrets in one Secret object (the default)
+	SecretGroupingInstanceGroup = SecretGrouping("instance-group") // One Secret object per consuming instance group
+)
+
+// UserSecretsName returns the name of the Secret object holding the user
+// secrets of the instance group.  With the instance-group grouping the name is
+// derived from the instance group name only, so it stays the same across
+// upgrades, unless the config is immutable (see immutableConfigName): the
+// name then changes with the values of the secrets the object holds.
+func UserSecretsName(instanceGroup *model.InstanceGroup, settings ExportSettings) (string, error) {
+	if settings.SecretGrouping != SecretGroupingInstanceGroup {
+		return immutableConfigName(userSecretsName, settings, ".Values.secrets"), nil
+	}
+	secrets, err := instanceGroupSecrets(instanceGroup)
+	if err != nil {
+		return "", err
+	}
+	var values []string
+	for _, name := range sortedSecretNames(secrets) {
+		values = append(values, fmt.Sprintf(".Values.secrets.%s", name))
+	}
+	return immutableConfigName(kubeName(userSecretsName+"-"+instanceGroup.Name), settings, values...), nil
+}
+
+// instanceGroupSecrets returns the secret variables the instance group
+// consumes
+func instanceGroupSecrets(instanceGroup *model.InstanceGroup) (model.CVMap, error) {
+	variables, err := instanceGroup.GetVariablesForRole()
+	if err != nil {
+		return nil, err
+	}
+	secrets := model.CVMap{}
+	for _, variable := range variables {
+		if variable.CVOptions.Secret {
+			secrets[variable.Name] = variable
+		}
+	}
+	return secrets, nil
+}
+
+// sortedSecretNames returns the names of the secrets in order
+func sortedSecretNames(secrets model.CVMap) []string {
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // MakeSecrets creates Secret KubeConfig filled with the
 // key/value pairs from the specified map.
 func MakeSecrets(secrets model.CVMap, settings ExportSettings) (helm.Node, error) {
+	return makeSecrets(immutableConfigName(userSecretsName, settings, ".Values.secrets"), secrets, settings)
+}
+
+// MakeInstanceGroupSecrets creates one Secret KubeConfig per instance group
+// (see UserSecretsName), each filled with the secrets the instance group
+// consumes.  Instance groups without secrets get no Secret object.  The
+// objects are sorted by instance group name.
+func MakeInstanceGroupSecrets(settings ExportSettings) ([]helm.Node, error) {
+	instanceGroups := append(model.InstanceGroups{}, settings.RoleManifest.InstanceGroups...)
+	sort.Slice(instanceGroups, func(i, j int) bool { return instanceGroups[i].Name < instanceGroups[j].Name })
+
+	var nodes []helm.Node
+	for _, instanceGroup := range instanceGroups {
+		secrets, err := instanceGroupSecrets(instanceGroup)
+		if err != nil {
+			return nil, err
+		}
+		if len(secrets) == 0 {
+			continue
+		}
+		name, err := UserSecretsName(instanceGroup, settings)
+		if err != nil {
+			return nil, err
+		}
+		node, err := makeSecrets(name, secrets, settings)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func makeSecrets(secretName string, secrets model.CVMap, settings ExportSettings) (helm.Node, error) {
 	data := helm.NewMapping()
 	generated := helm.NewMapping()
 
@@ -28,14 +118,8 @@ func MakeSecrets(secrets model.CVMap, settings ExportSettings) (helm.Node, error
 					comment += "\nThis value is immutable and must not be changed once set."
 				}
 				comment += formattedExample(cv.CVOptions.Example)
-				required := `{{"" | b64enc | quote}}`
-				if cv.CVOptions.Required {
-					required = fmt.Sprintf(`{{fail "secrets.%s has not been set"}}`, cv.Name)
-				}
-				name := ".Values.secrets." + cv.Name
-				tmpl := `{{if ne (typeOf %s) "<nil>"}}{{if has (kindOf %s) (list "map" "slice")}}` +
-					`{{%s | toJson | b64enc | quote}}{{else}}{{%s | b64enc | quote}}{{end}}{{else}}%s{{end}}`
-				value = fmt.Sprintf(tmpl, name, name, name, name, required)
+				tmpl := `{{ template "fissile.SecretValue" (dict "value" .Values.secrets.%s "name" "secrets.%s" "required" %t) }}`
+				value = fmt.Sprintf(tmpl, cv.Name, cv.Name, cv.CVOptions.Required)
 				data.Add(key, helm.NewNode(value, helm.Comment(comment)))
 			} else if !cv.CVOptions.Immutable {
 				comment += formattedExample(cv.CVOptions.Example)
@@ -58,12 +142,13 @@ func MakeSecrets(secrets model.CVMap, settings ExportSettings) (helm.Node, error
 		SetSettings(&settings).
 		SetAPIVersion("v1").
 		SetKind("Secret").
-		SetName(userSecretsName)
+		setConfigName(secretName)
 	secret, err := cb.Build()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build a new kube config: %v", err)
 	}
 	secret.Add("data", data)
+	addImmutable(secret, settings)
 
 	return secret.Sort(), nil
 }
@@ -8,6 +8,7 @@ import (
 	"code.cloudfoundry.org/fissile/model"
 	"code.cloudfoundry.org/fissile/testhelpers"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMakeSecretsEmpty(t *testing.T) {
@@ -215,7 +216,7 @@ func TestMakeSecretsHelm(t *testing.T) {
 
 		_, err := RenderNode(secret, nil)
 		assert.EqualError(err,
-			`template: :6:237: executing "" at <fail "secrets.const has not been set">: error calling fail: secrets.const has not been set`)
+			`template: :21:40: executing "fissile.Required" at <fail (printf "%s has not been set" .)>: error calling fail: secrets.const has not been set`)
 	})
 
 	t.Run("Undefined", func(t *testing.T) {
@@ -231,7 +232,7 @@ func TestMakeSecretsHelm(t *testing.T) {
 
 		_, err := RenderNode(secret, config)
 		assert.EqualError(err,
-			`template: :6:237: executing "" at <fail "secrets.const has not been set">: error calling fail: secrets.const has not been set`)
+			`template: :21:40: executing "fissile.Required" at <fail (printf "%s has not been set" .)>: error calling fail: secrets.const has not been set`)
 	})
 
 	t.Run("Present", func(t *testing.T) {
@@ -312,3 +313,134 @@ func TestMakeSecretsHelm(t *testing.T) {
 		`, varConstB64, varDescB64, varMinB64, varValuedB64, varStructuredB64, varGenieB64), actual)
 	})
 }
+
+func TestMakeInstanceGroupSecrets(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "secrets.yml")
+	if manifest == nil {
+		return
+	}
+	settings := ExportSettings{
+		RoleManifest:   manifest,
+		SecretGrouping: SecretGroupingInstanceGroup,
+	}
+
+	name, err := UserSecretsName(role, ExportSettings{RoleManifest: manifest})
+	assert.NoError(err)
+	assert.Equal("secrets", name)
+	name, err = UserSecretsName(role, settings)
+	assert.NoError(err)
+	assert.Equal("secrets-myrole", name)
+
+	secrets, err := MakeInstanceGroupSecrets(settings)
+	if !assert.NoError(err) || !assert.Len(secrets, 2) {
+		return
+	}
+
+	actual, err := RoundtripKube(secrets[0])
+	if !assert.NoError(err) {
+		return
+	}
+	testhelpers.IsYAMLEqualString(assert, `---
+		apiVersion: "v1"
+		data:
+			control-password: ""
+			internal-token: ""
+			private-key: ""
+		kind: "Secret"
+		metadata:
+			name: "secrets-myrole"
+			labels:
+				app.kubernetes.io/component: "secrets-myrole"
+	`, actual)
+
+	actual, err = RoundtripKube(secrets[1])
+	if !assert.NoError(err) {
+		return
+	}
+	testhelpers.IsYAMLEqualString(assert, `---
+		apiVersion: "v1"
+		data:
+			control-password: ""
+			internal-token: ""
+			other-private-key: ""
+		kind: "Secret"
+		metadata:
+			name: "secrets-otherrole"
+			labels:
+				app.kubernetes.io/component: "secrets-otherrole"
+	`, actual)
+
+	env, err := getEnvVars(role, settings)
+	if !assert.NoError(err) {
+		return
+	}
+	actualEnv, err := RoundtripKube(env)
+	if !assert.NoError(err) {
+		return
+	}
+	assert.Contains(actualEnv, map[interface{}]interface{}{
+		"name": "INTERNAL_TOKEN",
+		"valueFrom": map[interface{}]interface{}{
+			"secretKeyRef": map[interface{}]interface{}{
+				"key":  "internal-token",
+				"name": "secrets-myrole",
+			},
+		},
+	})
+}
+
+func TestMakeInstanceGroupSecretsImmutable(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "secrets.yml")
+	if manifest == nil {
+		return
+	}
+	settings := ExportSettings{
+		RoleManifest:    manifest,
+		CreateHelmChart: true,
+		SecretGrouping:  SecretGroupingInstanceGroup,
+		ImmutableConfig: true,
+	}
+
+	secrets, err := MakeInstanceGroupSecrets(settings)
+	require.NoError(t, err)
+	require.Len(t, secrets, 2)
+	env, err := getEnvVars(role, settings)
+	require.NoError(t, err)
+	renderer, err := newTestRenderer(MakeValues(settings))
+	require.NoError(t, err)
+
+	render := func(config map[string]interface{}) (map[interface{}]interface{}, string) {
+		actual, err := renderer.RoundtripNode(secrets[0], config)
+		require.NoError(t, err)
+		secret := actual.(map[interface{}]interface{})
+		assert.Equal(true, secret["immutable"])
+
+		actual, err = renderer.RoundtripNode(env, config)
+		require.NoError(t, err)
+		for _, envVar := range actual.([]interface{}) {
+			envVar := envVar.(map[interface{}]interface{})
+			if envVar["name"] == "INTERNAL_TOKEN" {
+				ref := envVar["valueFrom"].(map[interface{}]interface{})["secretKeyRef"].(map[interface{}]interface{})
+				return secret, ref["name"].(string)
+			}
+		}
+		require.Fail(t, "INTERNAL_TOKEN is not in the environment")
+		return nil, ""
+	}
+
+	secret, ref := render(nil)
+	name := secret["metadata"].(map[interface{}]interface{})["name"].(string)
+	assert.Regexp(`^secrets-myrole-[0-9a-f]{8}$`, name)
+	assert.Equal(name, ref, "The pods refer to the secret by its hashed name")
+
+	_, changedRef := render(map[string]interface{}{"Values.secrets.INTERNAL_TOKEN": "changed"})
+	assert.NotEqual(ref, changedRef, "Consumed secrets rename the secret")
+	_, otherRef := render(map[string]interface{}{"Values.secrets.OTHER_PRIVATE_KEY": "changed"})
+	assert.Equal(ref, otherRef, "Secrets of other instance groups do not rename the secret")
+}
@@ -2,12 +2,62 @@ package kube
 
 import (
 	"fmt"
+	"strings"
 
 	"code.cloudfoundry.org/fissile/helm"
 	"code.cloudfoundry.org/fissile/model"
 	"code.cloudfoundry.org/fissile/util"
+	"code.cloudfoundry.org/fissile/validation"
 )
 
+// ServiceNamingStrategy determines how service names which are too long for
+// kubernetes are handled
+type ServiceNamingStrategy string
+
+// Service naming strategies
+const (
+	ServiceNamingTruncate = ServiceNamingStrategy("truncate") // Truncate long names, adding a hash suffix (the default)
+	ServiceNamingStrict   = ServiceNamingStrategy("strict")   // Reject names which would have to be truncated
+)
+
+// PortRangeStrategy determines how services expose port definitions with
+// more than one port
+type PortRangeStrategy string
+
+// Port range strategies
+const (
+	PortRangesExpand   = PortRangeStrategy("expand")   // One service port per port (the default)
+	PortRangesAnnotate = PortRangeStrategy("annotate") // Only the first port, with the whole range in an annotation
+)
+
+// PortRangeAnnotationPrefix prefixes the annotations of services listing the
+// port ranges exposed with the annotate strategy, for load balancers able to
+// forward whole ranges.  The annotation for each port definition is named
+// after it, with a value of <first>-<last>/<protocol>.
+const PortRangeAnnotationPrefix = "port-ranges.fissile.cloudfoundry.org/"
+
+// Annotations of public services describing how TLS connections to their
+// ports are handled, for load balancers and routers; each is named after the
+// port.  The terminate annotation is "terminate" or "passthrough", and the
+// certificate and key annotations are <secret>/<key> references to the
+// certificate and private key used to terminate TLS.
+const (
+	PortTLSAnnotationPrefix     = "tls.fissile.cloudfoundry.org/"
+	PortTLSCertAnnotationPrefix = "tls-cert.fissile.cloudfoundry.org/"
+	PortTLSKeyAnnotationPrefix  = "tls-key.fissile.cloudfoundry.org/"
+)
+
+// MaxServicePorts is the number of ports above which services are rejected:
+// Kubernetes limits the size of objects, and proxies program rules for every
+// service port.
+const MaxServicePorts = 1000
+
+// annotatesPortRange returns true if the service ports of the port definition
+// are collapsed into its first port, with an annotation for the range
+func (settings ExportSettings) annotatesPortRange(port model.JobExposedPort) bool {
+	return settings.PortRanges == PortRangesAnnotate && port.Max > 1
+}
+
 // NewServiceList creates a list of services
 // clustering should be true if a kubernetes headless service should be created
 // (for self-clustering roles, to reach each pod individually)
@@ -31,6 +81,7 @@ func NewServiceList(role *model.InstanceGroup, clustering bool, settings ExportS
 			if err != nil {
 				return nil, err
 			}
+			addJobFeatureCheck(job, svc)
 			if svc != nil {
 				items = append(items, svc)
 			}
@@ -41,6 +92,7 @@ func NewServiceList(role *model.InstanceGroup, clustering bool, settings ExportS
 		if err != nil {
 			return nil, err
 		}
+		addJobFeatureCheck(job, svc)
 		if svc != nil {
 			items = append(items, svc)
 		}
@@ -50,9 +102,26 @@ func NewServiceList(role *model.InstanceGroup, clustering bool, settings ExportS
 		if err != nil {
 			return nil, err
 		}
+		addJobFeatureCheck(job, svc)
 		if svc != nil {
 			items = append(items, svc)
 		}
+
+		if settings.OpenShift && svc != nil {
+			routes, err := newRoutes(role, job, settings)
+			if err != nil {
+				return nil, err
+			}
+			addJobFeatureCheck(job, routes...)
+			items = append(items, routes...)
+		}
+
+		aliases, err := newAliasServices(role, job, settings)
+		if err != nil {
+			return nil, err
+		}
+		addJobFeatureCheck(job, aliases...)
+		items = append(items, aliases...)
 	}
 
 	if len(items) == 0 {
@@ -76,16 +145,25 @@ const (
 )
 
 // createPorts generates a helm mapping according to the JobExposedPort
-func createPorts(settings ExportSettings, serviceType newServiceType, roleName string, port model.JobExposedPort) []helm.Node {
+// The ports are only included when the condition (see jobFeatureCondition)
+// holds, unless it is empty.
+func createPorts(settings ExportSettings, serviceType newServiceType, roleName string, port model.JobExposedPort, condition string) []helm.Node {
 	var ports []helm.Node
 	if settings.CreateHelmChart && port.CountIsConfigurable {
 		sizing := fmt.Sprintf(".Values.sizing.%s.ports.%s", makeVarName(roleName), makeVarName(port.Name))
 
-		block := fmt.Sprintf("range $port := until (int %s.count)", sizing)
+		count := fmt.Sprintf("int %s.count", sizing)
+		if settings.annotatesPortRange(port) {
+			count = fmt.Sprintf("int (min 1 (%s))", count)
+		}
+		if condition != "" {
+			count = fmt.Sprintf("ternary (%s) 0 %s", count, condition)
+		}
+		block := fmt.Sprintf("range $port := until (%s)", count)
 
 		portName := port.Name
 		if port.Max > 1 {
-			portName = fmt.Sprintf("%s-{{ $port }}", portName)
+			portName = makePortName(portName, "{{ $port }}")
 		}
 
 		var portNumber string
@@ -106,12 +184,20 @@ func createPorts(settings ExportSettings, serviceType newServiceType, roleName s
 		} else {
 			newPort.Add("targetPort", portName)
 		}
+		if serviceType == newServiceTypePublic && port.NodePort != 0 {
+			newPort.Add("nodePort", fmt.Sprintf("{{ add (int $%s.node_port) $port }}", sizing),
+				helm.Block("if $.Values.services.node_port"))
+		}
 		ports = append(ports, newPort)
 	} else {
-		for portIndex := 0; portIndex < port.Count; portIndex++ {
+		count := port.Count
+		if settings.annotatesPortRange(port) && count > 1 {
+			count = 1
+		}
+		for portIndex := 0; portIndex < count; portIndex++ {
 			portName := port.Name
 			if port.Max > 1 {
-				portName = fmt.Sprintf("%s-%d", portName, portIndex)
+				portName = makePortName(portName, portIndex)
 			}
 
 			var portNumber interface{}
@@ -135,6 +221,18 @@ func createPorts(settings ExportSettings, serviceType newServiceType, roleName s
 				// port definitions with the same internal port
 				newPort.Add("targetPort", port.InternalPort+portIndex)
 			}
+			if serviceType == newServiceTypePublic && port.NodePort != 0 {
+				if settings.CreateHelmChart {
+					newPort.Add("nodePort", fmt.Sprintf("{{ add (int $.Values.sizing.%s.ports.%s.node_port) %d }}",
+						makeVarName(roleName), makeVarName(port.Name), portIndex),
+						helm.Block("if $.Values.services.node_port"))
+				} else if settings.NodePorts {
+					newPort.Add("nodePort", port.NodePort+portIndex)
+				}
+			}
+			if condition != "" {
+				newPort.Set(helm.Block("if " + condition))
+			}
 			ports = append(ports, newPort)
 		}
 	}
@@ -142,14 +240,144 @@ func createPorts(settings ExportSettings, serviceType newServiceType, roleName s
 	return ports
 }
 
+// portRangeAnnotations returns the annotations for the port ranges of the
+// port definitions collapsed by the annotate strategy, which are only included
+// when the condition (see jobFeatureCondition) holds, unless it is empty.
+func portRangeAnnotations(settings ExportSettings, roleName string, ports []model.JobExposedPort, condition string) *helm.Mapping {
+	annotations := helm.NewMapping()
+	for _, port := range ports {
+		if !settings.annotatesPortRange(port) {
+			continue
+		}
+		key := PortRangeAnnotationPrefix + port.Name
+		if !settings.CreateHelmChart || !(port.PortIsConfigurable || port.CountIsConfigurable) {
+			value := fmt.Sprintf("%d-%d/%s", port.ExternalPort, port.ExternalPort+port.Count-1, port.Protocol)
+			if condition != "" {
+				annotations.Add(key, value, helm.Block("if "+condition))
+			} else {
+				annotations.Add(key, value)
+			}
+			continue
+		}
+
+		sizing := fmt.Sprintf("$.Values.sizing.%s.ports.%s", makeVarName(roleName), makeVarName(port.Name))
+		first := fmt.Sprint(port.ExternalPort)
+		if port.PortIsConfigurable {
+			first = fmt.Sprintf("(int %s.port)", sizing)
+		}
+		count := fmt.Sprint(port.Count)
+		if port.CountIsConfigurable {
+			count = fmt.Sprintf("(int %s.count)", sizing)
+		}
+		value := fmt.Sprintf("{{ %s }}-{{ add %s (sub %s 1) }}/%s", first, first, count, port.Protocol)
+
+		var conditions []string
+		if condition != "" {
+			conditions = append(conditions, condition)
+		}
+		if port.CountIsConfigurable {
+			// There is no range to forward without any ports
+			conditions = append(conditions, fmt.Sprintf("(gt %s 0)", count))
+		}
+		switch len(conditions) {
+		case 0:
+			annotations.Add(key, value)
+		case 1:
+			annotations.Add(key, value, helm.Block("if "+conditions[0]))
+		default:
+			annotations.Add(key, value, helm.Block(fmt.Sprintf("if and %s", strings.Join(conditions, " "))))
+		}
+	}
+	return annotations
+}
+
+// portTLSAnnotations returns the annotations describing the TLS handling of
+// the ports (see PortTLSAnnotationPrefix)
+func portTLSAnnotations(role *model.InstanceGroup, ports []model.JobExposedPort, settings ExportSettings) (*helm.Mapping, error) {
+	annotations := helm.NewMapping()
+	for _, port := range ports {
+		if port.TLS == nil {
+			continue
+		}
+		if port.TLS.Terminate == model.PortTLSPassthrough {
+			annotations.Add(PortTLSAnnotationPrefix+port.Name, "passthrough")
+		} else {
+			annotations.Add(PortTLSAnnotationPrefix+port.Name, "terminate")
+		}
+		if port.TLS.Secret == "" {
+			continue
+		}
+		cert := port.TLS.Secret + "/tls.crt"
+		key := port.TLS.Secret + "/tls.key"
+		if settings.RoleManifest != nil {
+			if variable := port.TLS.SecretVariable(settings.RoleManifest.Variables); variable != nil {
+				keyVariable := settings.RoleManifest.Variables.Lookup(variable.Name + "_KEY")
+				secretName, err := variableSecretName(role, variable, settings)
+				if err != nil {
+					return nil, err
+				}
+				cert = secretName + "/" + util.ConvertNameToKey(variable.Name)
+				if keyVariable != nil {
+					secretName, err = variableSecretName(role, keyVariable, settings)
+					if err != nil {
+						return nil, err
+					}
+					key = secretName + "/" + util.ConvertNameToKey(keyVariable.Name)
+				}
+			}
+		}
+		annotations.Add(PortTLSCertAnnotationPrefix+port.Name, cert)
+		annotations.Add(PortTLSKeyAnnotationPrefix+port.Name, key)
+	}
+	return annotations, nil
+}
+
+// variableSecretName returns the name of the Secret object holding the value
+// of the secret variable, the same way the environment variables of the pods
+// refer to it
+func variableSecretName(role *model.InstanceGroup, variable *model.VariableDefinition, settings ExportSettings) (string, error) {
+	userSecrets, err := UserSecretsName(role, settings)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case !settings.CreateHelmChart:
+		return userSecrets, nil
+	case variable.CVOptions.Immutable && variable.Type != "":
+		return generatedSecretsName, nil
+	case variable.Type == "" && independentSecret(variable.Name):
+		return userSecrets, nil
+	default:
+		return fmt.Sprintf("{{ if .Values.secrets.%s }}%s{{ else }}%s{{ end }}", variable.Name, userSecrets, generatedSecretsName), nil
+	}
+}
+
+// addServiceAnnotations adds the annotations to the metadata of the service,
+// next to those configured in the role manifest
+func addServiceAnnotations(service *helm.Mapping, annotations *helm.Mapping) {
+	if len(annotations.Names()) == 0 {
+		return
+	}
+	metadata := service.Get("metadata").(*helm.Mapping)
+	if existing, ok := metadata.Get("annotations").(*helm.Mapping); ok {
+		existing.Merge(annotations)
+		existing.Sort()
+		return
+	}
+	metadata.Add("annotations", annotations.Sort())
+}
+
 // newClusteringService creates a new k8s service for the overall instance group.
 // This allows individual pods to be addressed by their index.
 func newClusteringService(role *model.InstanceGroup, settings ExportSettings) (helm.Node, error) {
 	var ports []helm.Node
+	annotations := helm.NewMapping()
 	for _, job := range role.JobReferences {
+		condition := jobFeatureCondition(job)
 		for _, port := range job.ContainerProperties.BoshContainerization.Ports {
-			ports = append(ports, createPorts(settings, newServiceTypeHeadless, role.Name, port)...)
+			ports = append(ports, createPorts(settings, newServiceTypeHeadless, role.Name, port, condition)...)
 		}
+		annotations.Merge(portRangeAnnotations(settings, role.Name, job.ContainerProperties.BoshContainerization.Ports, condition))
 	}
 
 	if len(ports) == 0 {
@@ -160,12 +388,12 @@ func newClusteringService(role *model.InstanceGroup, settings ExportSettings) (h
 
 	spec := helm.NewMapping()
 
-	selector := helm.NewMapping(RoleNameLabel, role.Name)
+	selector := helm.NewMapping(RoleNameLabel, kubeName(role.Name))
 	if role.HasTag(model.RoleTagActivePassive) {
 		selector.Add("skiff-role-active", "true")
 	}
 	if role.HasTag(model.RoleTagIstioManaged) && settings.CreateHelmChart {
-		selector.Add(AppNameLabel, role.Name, helm.Block("if .Values.config.use_istio"))
+		selector.Add(AppNameLabel, kubeName(role.Name), helm.Block("if .Values.config.use_istio"))
 	}
 	spec.Add("selector", selector)
 
@@ -176,11 +404,13 @@ func newClusteringService(role *model.InstanceGroup, settings ExportSettings) (h
 		SetSettings(&settings).
 		SetAPIVersion("v1").
 		SetKind("Service").
-		SetName(fmt.Sprintf("%s-set", role.Name))
+		SetName(clusteringServiceName(role)).
+		SetInstanceGroup(role)
 	service, err := cb.Build()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build a new kube config: %v", err)
 	}
+	addServiceAnnotations(service, annotations)
 	service.Add("spec", spec.Sort())
 
 	return service, nil
@@ -188,7 +418,26 @@ func newClusteringService(role *model.InstanceGroup, settings ExportSettings) (h
 
 // newService creates a new k8s service (ClusterIP or LoadBalanced) for a job
 func newService(role *model.InstanceGroup, job *model.JobReference, serviceType newServiceType, settings ExportSettings) (helm.Node, error) {
+	serviceName := job.ServiceName(role.Name)
+
+	switch serviceType {
+	case newServiceTypeHeadless:
+		serviceName += "-set"
+	case newServiceTypePrivate:
+		// all set
+	case newServiceTypePublic:
+		serviceName += "-public"
+	default:
+		panic(fmt.Sprintf("Unexpected service type %d", serviceType))
+	}
+
+	return newNamedService(role, job, serviceType, serviceName, settings)
+}
+
+// newNamedService creates a new k8s service of the given type and name for a job
+func newNamedService(role *model.InstanceGroup, job *model.JobReference, serviceType newServiceType, serviceName string, settings ExportSettings) (helm.Node, error) {
 	var ports []helm.Node
+	var exposedPorts []model.JobExposedPort
 
 	for _, port := range job.ContainerProperties.BoshContainerization.Ports {
 		if serviceType == newServiceTypePublic && !port.Public {
@@ -196,7 +445,9 @@ func newService(role *model.InstanceGroup, job *model.JobReference, serviceType
 			continue
 		}
 
-		ports = append(ports, createPorts(settings, serviceType, role.Name, port)...)
+		// Services of jobs with a feature condition are wrapped as a whole
+		ports = append(ports, createPorts(settings, serviceType, role.Name, port, "")...)
+		exposedPorts = append(exposedPorts, port)
 	}
 	if len(ports) == 0 {
 		// Kubernetes refuses to create services with no ports, so we should
@@ -206,13 +457,13 @@ func newService(role *model.InstanceGroup, job *model.JobReference, serviceType
 
 	spec := helm.NewMapping()
 
-	selector := helm.NewMapping(RoleNameLabel, role.Name)
+	selector := helm.NewMapping(RoleNameLabel, kubeName(role.Name))
 	if role.HasTag(model.RoleTagActivePassive) {
 		selector.Add("skiff-role-active", "true")
 	}
 
 	if role.HasTag(model.RoleTagIstioManaged) && settings.CreateHelmChart {
-		selector.Add(AppNameLabel, role.Name, helm.Block("if .Values.config.use_istio"))
+		selector.Add(AppNameLabel, kubeName(role.Name), helm.Block("if .Values.config.use_istio"))
 	}
 	spec.Add("selector", selector)
 
@@ -222,38 +473,34 @@ func newService(role *model.InstanceGroup, job *model.JobReference, serviceType
 	if serviceType == newServiceTypePublic {
 		if settings.CreateHelmChart {
 			spec.Add("externalIPs", "{{ .Values.kube.external_ips | toJson }}", helm.Block("if not (or .Values.services.loadbalanced .Values.ingress.enabled)"))
-			spec.Add("type", "LoadBalancer", helm.Block("if .Values.services.loadbalanced"))
+			spec.Add("type", "{{ if .Values.services.loadbalanced }}LoadBalancer{{ else }}NodePort{{ end }}",
+				helm.Block("if or .Values.services.loadbalanced .Values.services.node_port"))
+		} else if settings.NodePorts {
+			spec.Add("type", "NodePort")
 		} else {
-			spec.Add("externalIPs", []string{"192.168.77.77"})
+			spec.Add("externalIPs", settings.Substitutions.externalIPs())
 		}
 	}
 	spec.Add("ports", helm.NewNode(ports))
 
-	serviceName := job.ContainerProperties.BoshContainerization.ServiceName
-	if len(serviceName) == 0 {
-		serviceName = util.ConvertNameToKey(role.Name + "-" + job.Name)
-	}
-
-	switch serviceType {
-	case newServiceTypeHeadless:
-		serviceName += "-set"
-	case newServiceTypePrivate:
-		// all set
-	case newServiceTypePublic:
-		serviceName += "-public"
-	default:
-		panic(fmt.Sprintf("Unexpected service type %d", serviceType))
-	}
-
 	cb := NewConfigBuilder().
 		SetSettings(&settings).
 		SetAPIVersion("v1").
 		SetKind("Service").
-		SetName(serviceName)
+		SetName(serviceName).
+		SetInstanceGroup(role)
 	service, err := cb.Build()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build a new kube config: %v", err)
 	}
+	addServiceAnnotations(service, portRangeAnnotations(settings, role.Name, exposedPorts, ""))
+	if serviceType == newServiceTypePublic {
+		annotations, err := portTLSAnnotations(role, exposedPorts, settings)
+		if err != nil {
+			return nil, err
+		}
+		addServiceAnnotations(service, annotations)
+	}
 	service.Add("spec", spec.Sort())
 
 	if settings.CreateHelmChart && serviceType == newServiceTypePublic {
@@ -264,3 +511,158 @@ func newService(role *model.InstanceGroup, job *model.JobReference, serviceType
 
 	return service, nil
 }
+
+// newAliasServices creates the headless services named after the DNS aliases
+// of the link providers of a job, so that the names BOSH jobs expect for their
+// providers resolve to the pods of the job
+func newAliasServices(role *model.InstanceGroup, job *model.JobReference, settings ExportSettings) ([]helm.Node, error) {
+	var services []helm.Node
+	for _, alias := range job.ProviderAliases() {
+		service, err := newNamedService(role, job, newServiceTypeHeadless, alias.ServiceName(), settings)
+		if err != nil {
+			return nil, err
+		}
+		if service != nil {
+			services = append(services, service)
+		}
+	}
+	return services, nil
+}
+
+// clusteringServiceName returns the name of the headless service for the
+// whole instance group, which is also the service of its stateful set: the
+// service-name of the role manifest, or else <name>-set
+func clusteringServiceName(role *model.InstanceGroup) string {
+	if role.Run != nil && role.Run.ServiceName != "" {
+		return role.Run.ServiceName
+	}
+	return kubeName(role.Name + "-set")
+}
+
+// ValidateServiceNames checks the names of all services generated for the
+// role manifest: names set in the role manifest must fit the kubernetes limits,
+// and no two services may have the same name.  With the strict naming
+// strategy, derived names which would have to be truncated are rejected too.
+func ValidateServiceNames(settings ExportSettings) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	strategies := []string{string(ServiceNamingTruncate), string(ServiceNamingStrict)}
+	switch settings.ServiceNaming {
+	case "", ServiceNamingTruncate, ServiceNamingStrict:
+	default:
+		return append(allErrs, validation.NotSupported("service-naming", settings.ServiceNaming, strategies))
+	}
+	strict := settings.ServiceNaming == ServiceNamingStrict
+
+	owners := make(map[string]string)
+	claim := func(field, name string) {
+		if owner, ok := owners[name]; ok && owner != field {
+			allErrs = append(allErrs, validation.Invalid(field, name,
+				fmt.Sprintf("service name is also used by %s", owner)))
+			return
+		}
+		owners[name] = field
+	}
+
+	for _, role := range settings.RoleManifest.InstanceGroups {
+		if role.Type != model.RoleTypeBosh || role.IsColocated() {
+			continue
+		}
+		hasPorts := false
+		for _, job := range role.JobReferences {
+			ports := job.ContainerProperties.BoshContainerization.Ports
+			if len(ports) == 0 {
+				continue
+			}
+			hasPorts = true
+
+			field := fmt.Sprintf("instance_groups[%s].jobs[%s]", role.Name, job.Name)
+			if explicit := job.ContainerProperties.BoshContainerization.ServiceName; explicit != "" {
+				if len(explicit) > model.MaxServiceNameLength {
+					allErrs = append(allErrs, validation.TooLong(field+".service_name", explicit, model.MaxServiceNameLength))
+				}
+			} else if name := job.DefaultServiceName(role.Name); strict && len(name) > model.MaxServiceNameLength {
+				allErrs = append(allErrs, validation.TooLong(field, name, model.MaxServiceNameLength))
+			}
+
+			name := job.ServiceName(role.Name)
+			claim(field, name)
+			claim(field, name+"-set")
+			for _, port := range ports {
+				if port.Public {
+					claim(field, name+"-public")
+					break
+				}
+			}
+			for _, alias := range job.ProviderAliases() {
+				claim(fmt.Sprintf("%s.aliases[%s]", field, alias.Domain), alias.ServiceName())
+			}
+		}
+		if !hasPorts {
+			continue
+		}
+
+		field := fmt.Sprintf("instance_groups[%s]", role.Name)
+		if name := role.Name + "-set"; strict && (role.Run == nil || role.Run.ServiceName == "") && len(name) > maxKubeNameLength {
+			allErrs = append(allErrs, validation.TooLong(field, name, maxKubeNameLength))
+		}
+		claim(field, clusteringServiceName(role))
+	}
+
+	return allErrs
+}
+
+// ValidateServicePorts checks that no service generated for the role manifest
+// exceeds MaxServicePorts, counting the largest configurable number of ports.
+// Port definitions collapsed by the annotate strategy count as a single port.
+func ValidateServicePorts(settings ExportSettings) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	strategies := []string{string(PortRangesExpand), string(PortRangesAnnotate)}
+	switch settings.PortRanges {
+	case "", PortRangesExpand, PortRangesAnnotate:
+	default:
+		return append(allErrs, validation.NotSupported("port-ranges", settings.PortRanges, strategies))
+	}
+
+	portCount := func(port model.JobExposedPort) int {
+		if settings.annotatesPortRange(port) {
+			return 1
+		}
+		if settings.CreateHelmChart && port.CountIsConfigurable {
+			return port.Max
+		}
+		return port.Count
+	}
+	check := func(field, serviceName string, count int) {
+		if count > MaxServicePorts {
+			allErrs = append(allErrs, validation.Invalid(field, count,
+				fmt.Sprintf("service %s would have more than %d ports; use the annotate port range strategy", serviceName, MaxServicePorts)))
+		}
+	}
+
+	for _, role := range settings.RoleManifest.InstanceGroups {
+		if role.Type != model.RoleTypeBosh || role.IsColocated() {
+			continue
+		}
+		clusteringCount := 0
+		for _, job := range role.JobReferences {
+			privateCount, publicCount := 0, 0
+			for _, port := range job.ContainerProperties.BoshContainerization.Ports {
+				privateCount += portCount(port)
+				if port.Public {
+					publicCount += portCount(port)
+				}
+			}
+			clusteringCount += privateCount
+
+			field := fmt.Sprintf("instance_groups[%s].jobs[%s].properties.bosh_containerization.ports", role.Name, job.Name)
+			name := job.ServiceName(role.Name)
+			check(field, name, privateCount)
+			check(field, name+"-public", publicCount)
+		}
+		check(fmt.Sprintf("instance_groups[%s]", role.Name), clusteringServiceName(role), clusteringCount)
+	}
+
+	return allErrs
+}
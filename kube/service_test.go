@@ -1,6 +1,7 @@
 package kube
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -872,3 +873,556 @@ func expectedYAML(settings ExportSettings, expected string) string {
 	}
 	return expected
 }
+
+func TestServiceListJobFeaturesHelm(t *testing.T) {
+	t.Parallel()
+
+	manifest, role := serviceTestLoadRole(assert.New(t), "job-features.yml")
+	require.NotNil(t, manifest)
+	require.NotNil(t, role)
+
+	services, err := NewServiceList(role, true, ExportSettings{CreateHelmChart: true})
+	require.NoError(t, err)
+	require.NotNil(t, services)
+
+	for _, enabled := range []bool{true, false} {
+		func(enabled bool) {
+			t.Run(fmt.Sprintf("enabled=%v", enabled), func(t *testing.T) {
+				t.Parallel()
+				config := map[string]interface{}{
+					"Values.enable.hostname":                     enabled,
+					"Values.sizing.myrole.ports.tcp_route.count": "1",
+				}
+				actual, err := RoundtripNode(services, config)
+				require.NoError(t, err)
+
+				names := []string{}
+				var clusterPorts []string
+				for _, item := range actual.(map[interface{}]interface{})["items"].([]interface{}) {
+					service := item.(map[interface{}]interface{})
+					name := service["metadata"].(map[interface{}]interface{})["name"].(string)
+					names = append(names, name)
+					if name == "myrole-set" {
+						for _, port := range service["spec"].(map[interface{}]interface{})["ports"].([]interface{}) {
+							clusterPorts = append(clusterPorts, port.(map[interface{}]interface{})["name"].(string))
+						}
+					}
+				}
+
+				if enabled {
+					assert.ElementsMatch(t, []string{
+						"myrole-set",
+						"myrole-tor-set", "myrole-tor",
+						"myrole-new-hostname-set", "myrole-new-hostname", "myrole-new-hostname-public",
+					}, names)
+					assert.Equal(t, []string{"http", "tcp-route-0"}, clusterPorts)
+				} else {
+					assert.ElementsMatch(t, []string{
+						"myrole-set",
+						"myrole-tor-set", "myrole-tor",
+						"myrole-hashmat-set", "myrole-hashmat",
+					}, names)
+					assert.Equal(t, []string{"http", "hash"}, clusterPorts)
+				}
+			})
+		}(enabled)
+	}
+}
+
+func TestValidateServiceNames(t *testing.T) {
+	t.Parallel()
+
+	longName := strings.Repeat("long-instance-group-name-", 3)
+	newJob := func(name, serviceName string, public bool) *model.JobReference {
+		job := &model.JobReference{Name: name}
+		job.ContainerProperties.BoshContainerization.ServiceName = serviceName
+		job.ContainerProperties.BoshContainerization.Ports = []model.JobExposedPort{
+			{Name: "http", Protocol: "TCP", Public: public},
+		}
+		return job
+	}
+	newSettings := func(strategy ServiceNamingStrategy, instanceGroups ...*model.InstanceGroup) ExportSettings {
+		for _, instanceGroup := range instanceGroups {
+			instanceGroup.Type = model.RoleTypeBosh
+		}
+		return ExportSettings{
+			ServiceNaming: strategy,
+			RoleManifest:  &model.RoleManifest{InstanceGroups: instanceGroups},
+		}
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		t.Parallel()
+		settings := newSettings("",
+			&model.InstanceGroup{Name: "one", JobReferences: model.JobReferences{newJob("job", "", true)}},
+			&model.InstanceGroup{Name: "two", JobReferences: model.JobReferences{newJob("job", "", true)}})
+		assert.Empty(t, ValidateServiceNames(settings))
+	})
+
+	t.Run("Collisions", func(t *testing.T) {
+		t.Parallel()
+		settings := newSettings(ServiceNamingTruncate,
+			&model.InstanceGroup{Name: "one", JobReferences: model.JobReferences{newJob("a-job", "", false)}},
+			&model.InstanceGroup{Name: "one-a", JobReferences: model.JobReferences{newJob("job", "", false)}},
+			&model.InstanceGroup{Name: "two", JobReferences: model.JobReferences{newJob("job", "one-a-job-set", false)}})
+		assert.Equal(t, []string{
+			`instance_groups[one-a].jobs[job]: Invalid value: "one-a-job": service name is also used by instance_groups[one].jobs[a-job]`,
+			`instance_groups[one-a].jobs[job]: Invalid value: "one-a-job-set": service name is also used by instance_groups[one].jobs[a-job]`,
+			`instance_groups[two].jobs[job]: Invalid value: "one-a-job-set": service name is also used by instance_groups[one].jobs[a-job]`,
+		}, ValidateServiceNames(settings).ErrorStrings())
+	})
+
+	t.Run("TooLong", func(t *testing.T) {
+		t.Parallel()
+		explicit := strings.Repeat("x", model.MaxServiceNameLength+1)
+		settings := newSettings(ServiceNamingTruncate,
+			&model.InstanceGroup{Name: longName, JobReferences: model.JobReferences{newJob("job", "", true)}},
+			&model.InstanceGroup{Name: "explicit", JobReferences: model.JobReferences{newJob("job", explicit, false)}})
+		assert.Equal(t, []string{
+			fmt.Sprintf(`instance_groups[explicit].jobs[job].service_name: Too long: must have at most %d characters`, model.MaxServiceNameLength),
+		}, ValidateServiceNames(settings).ErrorStrings())
+	})
+
+	t.Run("Strict", func(t *testing.T) {
+		t.Parallel()
+		settings := newSettings(ServiceNamingStrict,
+			&model.InstanceGroup{Name: longName, JobReferences: model.JobReferences{newJob("job", "", true)}})
+		errs := ValidateServiceNames(settings).ErrorStrings()
+		if assert.Len(t, errs, 2) {
+			assert.Contains(t, errs[0], fmt.Sprintf("instance_groups[%s].jobs[job]: Too long", longName))
+			assert.Contains(t, errs[1], fmt.Sprintf("instance_groups[%s]: Too long", longName))
+		}
+	})
+
+	t.Run("InvalidStrategy", func(t *testing.T) {
+		t.Parallel()
+		settings := newSettings("shorten")
+		assert.Equal(t, []string{
+			`service-naming: Unsupported value: "shorten": supported values: truncate, strict`,
+		}, ValidateServiceNames(settings).ErrorStrings())
+	})
+}
+
+func TestServiceNameTruncation(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	longName := strings.Repeat("long-instance-group-name-", 3) + "x"
+	job := &model.JobReference{Name: "job"}
+	job.ContainerProperties.BoshContainerization.Ports = []model.JobExposedPort{
+		{Name: "http", Protocol: "TCP", Count: 1, ExternalPort: 80, InternalPort: 8080, Public: true},
+	}
+	role := &model.InstanceGroup{Name: longName, Type: model.RoleTypeBosh, JobReferences: model.JobReferences{job}}
+
+	for _, serviceType := range []newServiceType{newServiceTypeHeadless, newServiceTypePrivate, newServiceTypePublic} {
+		service, err := newService(role, job, serviceType, ExportSettings{})
+		require.NoError(t, err)
+		actual, err := RoundtripKube(service)
+		require.NoError(t, err)
+		name := actual.(map[interface{}]interface{})["metadata"].(map[interface{}]interface{})["name"].(string)
+		assert.True(len(name) <= 63, "Service name %s is too long", name)
+		assert.True(strings.HasPrefix(name, job.ServiceName(role.Name)), "Service name %s should start with the job service name", name)
+	}
+
+	service, err := newClusteringService(role, ExportSettings{})
+	require.NoError(t, err)
+	actual, err := RoundtripKube(service)
+	require.NoError(t, err)
+	name := actual.(map[interface{}]interface{})["metadata"].(map[interface{}]interface{})["name"].(string)
+	assert.Equal(clusteringServiceName(role), name)
+	assert.Len(name, 63)
+}
+
+func TestServicePortRangesKube(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "exposed-port-ranges.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	settings := ExportSettings{RoleManifest: manifest, PortRanges: PortRangesAnnotate}
+	service, err := newService(role, role.JobReferences[0], newServiceTypePrivate, settings)
+	require.NoError(t, err)
+	actual, err := RoundtripKube(service)
+	require.NoError(t, err)
+	testhelpers.IsYAMLEqualString(assert, `---
+		apiVersion: v1
+		kind: Service
+		metadata:
+			name: myrole-tor
+			labels:
+				app.kubernetes.io/component: myrole-tor
+			annotations:
+				port-ranges.fissile.cloudfoundry.org/dynamic: 30000-30004/TCP
+				port-ranges.fissile.cloudfoundry.org/router: 20000-20009/TCP
+		spec:
+			ports:
+			-	name: router-0
+				port: 20000
+				protocol: TCP
+				targetPort: 20000
+			-	name: dynamic-0
+				port: 30000
+				protocol: TCP
+				targetPort: 30000
+			selector:
+				app.kubernetes.io/component: myrole
+	`, actual)
+
+	service, err = newService(role, role.JobReferences[0], newServiceTypePublic, settings)
+	require.NoError(t, err)
+	rendered, err := RenderNode(service, nil)
+	require.NoError(t, err)
+	assert.Contains(string(rendered), "port-ranges.fissile.cloudfoundry.org/router")
+	assert.NotContains(string(rendered), "port-ranges.fissile.cloudfoundry.org/dynamic", "Private ports are not in the public service")
+
+	settings.PortRanges = PortRangesExpand
+	service, err = newService(role, role.JobReferences[0], newServiceTypePrivate, settings)
+	require.NoError(t, err)
+	rendered, err = RenderNode(service, nil)
+	require.NoError(t, err)
+	assert.NotContains(string(rendered), "annotations")
+	assert.Contains(string(rendered), "router-9")
+	assert.Contains(string(rendered), "dynamic-4")
+}
+
+func TestServicePortRangesHelm(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "exposed-port-ranges.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	settings := ExportSettings{RoleManifest: manifest, PortRanges: PortRangesAnnotate, CreateHelmChart: true}
+	service, err := newService(role, role.JobReferences[0], newServiceTypePrivate, settings)
+	require.NoError(t, err)
+
+	t.Run("Configured", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(service, map[string]interface{}{
+			"Values.sizing.myrole.ports.dynamic.count": 20,
+			"Values.sizing.myrole.ports.dynamic.port":  31000,
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert, `---
+			metadata:
+				annotations:
+					port-ranges.fissile.cloudfoundry.org/dynamic: 31000-31019/TCP
+					port-ranges.fissile.cloudfoundry.org/router: 20000-20009/TCP
+			spec:
+				ports:
+				-	name: router-0
+					port: 20000
+				-	name: dynamic-0
+					port: 31000
+					targetPort: dynamic-0
+		`, actual)
+		rendered, err := RenderNode(service, map[string]interface{}{
+			"Values.sizing.myrole.ports.dynamic.count": 20,
+			"Values.sizing.myrole.ports.dynamic.port":  31000,
+		})
+		require.NoError(t, err)
+		assert.NotContains(string(rendered), "dynamic-1")
+	})
+
+	t.Run("NoPorts", func(t *testing.T) {
+		t.Parallel()
+		rendered, err := RenderNode(service, map[string]interface{}{
+			"Values.sizing.myrole.ports.dynamic.count": 0,
+			"Values.sizing.myrole.ports.dynamic.port":  31000,
+		})
+		require.NoError(t, err)
+		assert.NotContains(string(rendered), "dynamic")
+		assert.Contains(string(rendered), "port-ranges.fissile.cloudfoundry.org/router")
+	})
+}
+
+func TestValidateServicePorts(t *testing.T) {
+	t.Parallel()
+
+	newSettings := func(strategy PortRangeStrategy, count int) ExportSettings {
+		job := &model.JobReference{Name: "job"}
+		job.ContainerProperties.BoshContainerization.Ports = []model.JobExposedPort{
+			{Name: "range", Protocol: "TCP", Public: true, Count: count, Max: count},
+			{Name: "http", Protocol: "TCP", Count: 1, Max: 1},
+		}
+		return ExportSettings{
+			PortRanges: strategy,
+			RoleManifest: &model.RoleManifest{InstanceGroups: model.InstanceGroups{
+				&model.InstanceGroup{Name: "router", Type: model.RoleTypeBosh, JobReferences: model.JobReferences{job}},
+			}},
+		}
+	}
+
+	assert.Empty(t, ValidateServicePorts(newSettings("", MaxServicePorts-1)))
+	assert.Equal(t, []string{
+		`instance_groups[router].jobs[job].properties.bosh_containerization.ports: Invalid value: 1001: service router-job would have more than 1000 ports; use the annotate port range strategy`,
+		`instance_groups[router]: Invalid value: 1001: service router-set would have more than 1000 ports; use the annotate port range strategy`,
+	}, ValidateServicePorts(newSettings(PortRangesExpand, MaxServicePorts)).ErrorStrings())
+	assert.Empty(t, ValidateServicePorts(newSettings(PortRangesAnnotate, 5000)))
+	assert.Equal(t, []string{
+		`port-ranges: Unsupported value: "collapse": supported values: expand, annotate`,
+	}, ValidateServicePorts(newSettings("collapse", 1)).ErrorStrings())
+}
+
+func TestServiceNodePortsKube(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "exposed-node-ports.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	service, err := newService(role, role.JobReferences[0], newServiceTypePublic, ExportSettings{NodePorts: true})
+	require.NoError(t, err)
+	actual, err := RoundtripKube(service)
+	require.NoError(t, err)
+	testhelpers.IsYAMLEqualString(assert, `---
+		apiVersion: v1
+		kind: Service
+		metadata:
+			name: myrole-tor-public
+			labels:
+				app.kubernetes.io/component: myrole-tor-public
+		spec:
+			type: NodePort
+			ports:
+			-	name: https
+				port: 443
+				protocol: TCP
+				targetPort: 443
+				nodePort: 30443
+			-	name: tcp-0
+				port: 2000
+				protocol: TCP
+				targetPort: 2000
+				nodePort: 31000
+			-	name: tcp-1
+				port: 2001
+				protocol: TCP
+				targetPort: 2001
+				nodePort: 31001
+			-	name: http
+				port: 80
+				protocol: TCP
+				targetPort: 80
+			selector:
+				app.kubernetes.io/component: myrole
+	`, actual)
+
+	service, err = newService(role, role.JobReferences[0], newServiceTypePrivate, ExportSettings{NodePorts: true})
+	require.NoError(t, err)
+	rendered, err := RenderNode(service, nil)
+	require.NoError(t, err)
+	assert.NotContains(string(rendered), "nodePort", "Only public services use node ports")
+}
+
+func TestServiceNodePortsHelm(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "exposed-node-ports.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	service, err := newService(role, role.JobReferences[0], newServiceTypePublic, ExportSettings{CreateHelmChart: true})
+	require.NoError(t, err)
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Parallel()
+		rendered, err := RenderNode(service, map[string]interface{}{
+			"Values.sizing.myrole.ports.tcp.count":     2,
+			"Values.sizing.myrole.ports.tcp.node_port": 31000,
+		})
+		require.NoError(t, err)
+		assert.NotContains(string(rendered), "nodePort")
+		assert.NotContains(string(rendered), "type:")
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(service, map[string]interface{}{
+			"Values.services.node_port":                  true,
+			"Values.sizing.myrole.ports.tcp.count":       3,
+			"Values.sizing.myrole.ports.tcp.node_port":   32000,
+			"Values.sizing.myrole.ports.https.node_port": 30444,
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert, `---
+			spec:
+				type: NodePort
+				ports:
+				-	name: https
+					nodePort: 30444
+				-	name: tcp-0
+					nodePort: 32000
+				-	name: tcp-1
+					nodePort: 32001
+				-	name: tcp-2
+					nodePort: 32002
+				-	name: http
+		`, actual)
+	})
+
+	t.Run("LoadBalanced", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(service, map[string]interface{}{
+			"Values.services.loadbalanced":               true,
+			"Values.services.node_port":                  true,
+			"Values.sizing.myrole.ports.tcp.count":       1,
+			"Values.sizing.myrole.ports.tcp.node_port":   32000,
+			"Values.sizing.myrole.ports.https.node_port": 30444,
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert, `---
+			spec:
+				type: LoadBalancer
+				ports:
+				-	name: https
+					nodePort: 30444
+				-	name: tcp-0
+					nodePort: 32000
+				-	name: http
+		`, actual)
+	})
+}
+
+func TestServicePortTLSKube(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "exposed-ports-tls.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	service, err := newService(role, role.JobReferences[0], newServiceTypePublic, ExportSettings{RoleManifest: manifest})
+	require.NoError(t, err)
+	actual, err := RoundtripKube(service)
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		metadata:
+			name: myrole-tor-public
+			annotations:
+				tls.fissile.cloudfoundry.org/grpc: passthrough
+				tls.fissile.cloudfoundry.org/https: terminate
+				tls.fissile.cloudfoundry.org/wss: terminate
+				tls-cert.fissile.cloudfoundry.org/https: secrets/router-cert
+				tls-key.fissile.cloudfoundry.org/https: secrets/router-cert-key
+				tls-cert.fissile.cloudfoundry.org/wss: websocket-tls/tls.crt
+				tls-key.fissile.cloudfoundry.org/wss: websocket-tls/tls.key
+	`, actual)
+
+	rendered, err := RenderNode(service, nil)
+	require.NoError(t, err)
+	assert.NotContains(string(rendered), "fissile.cloudfoundry.org/http:", "Ports without TLS settings are not annotated")
+	assert.NotContains(string(rendered), "tls-cert.fissile.cloudfoundry.org/grpc", "Passthrough ports have no certificate")
+
+	service, err = newService(role, role.JobReferences[0], newServiceTypePrivate, ExportSettings{RoleManifest: manifest})
+	require.NoError(t, err)
+	rendered, err = RenderNode(service, nil)
+	require.NoError(t, err)
+	assert.NotContains(string(rendered), "tls.fissile.cloudfoundry.org", "Only public services are annotated")
+}
+
+func TestServicePortTLSHelm(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "exposed-ports-tls.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	service, err := newService(role, role.JobReferences[0], newServiceTypePublic, ExportSettings{
+		RoleManifest:    manifest,
+		CreateHelmChart: true,
+	})
+	require.NoError(t, err)
+
+	t.Run("Generated", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(service, nil)
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert, `---
+			metadata:
+				annotations:
+					tls-cert.fissile.cloudfoundry.org/https: secrets-42.1+foo-1/router-cert
+					tls-key.fissile.cloudfoundry.org/https: secrets-42.1+foo-1/router-cert-key
+		`, actual)
+	})
+
+	t.Run("User", func(t *testing.T) {
+		t.Parallel()
+		actual, err := RoundtripNode(service, map[string]interface{}{
+			"Values.secrets.ROUTER_CERT":     "cert",
+			"Values.secrets.ROUTER_CERT_KEY": "key",
+		})
+		require.NoError(t, err)
+		testhelpers.IsYAMLSubsetString(assert, `---
+			metadata:
+				annotations:
+					tls-cert.fissile.cloudfoundry.org/https: secrets/router-cert
+					tls-key.fissile.cloudfoundry.org/https: secrets/router-cert-key
+		`, actual)
+	})
+}
+
+func TestServiceProviderAliases(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+	manifest, err := loader.LoadRoleManifest(filepath.Join(workDir, "../test-assets/role-manifests/kube/provider-aliases.yml"), model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{filepath.Join(workDir, "../test-assets/ntp-release")},
+			BOSHCacheDir:     filepath.Join(workDir, "../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+	role := manifest.LookupInstanceGroup("myrole")
+	require.NotNil(t, role)
+
+	settings := ExportSettings{RoleManifest: manifest}
+	services, err := NewServiceList(role, true, settings)
+	require.NoError(t, err)
+
+	aliases := map[string]helm.Node{}
+	for _, item := range services.Get("items").Values() {
+		name := item.Get("metadata", "name").String()
+		if name == "ntp" || name == "time" {
+			aliases[name] = item
+		}
+	}
+	require.Len(t, aliases, 2, "Each alias has a service named after its first label")
+
+	actual, err := RoundtripKube(aliases["ntp"])
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		kind: Service
+		metadata:
+			name: ntp
+		spec:
+			clusterIP: None
+			ports:
+			-
+				name: ntp
+				port: 123
+				protocol: UDP
+			selector:
+				app.kubernetes.io/component: myrole
+	`, actual)
+
+	assert.Empty(ValidateServiceNames(settings))
+	role.JobReferences[0].ExportedProvides["ntp-server"].Aliases[1].Domain = "myrole-ntpd"
+	assert.NotEmpty(ValidateServiceNames(settings), "Alias services must not collide with other services")
+}
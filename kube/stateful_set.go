@@ -26,10 +26,10 @@ func NewStatefulSet(role *model.InstanceGroup, settings ExportSettings, grapher
 		return nil, nil, err
 	}
 
-	claims := getVolumeClaims(role, settings.CreateHelmChart)
+	claims := getVolumeClaims(role, settings)
 
 	spec := helm.NewMapping()
-	spec.Add("serviceName", fmt.Sprintf("%s-set", role.Name))
+	spec.Add("serviceName", clusteringServiceName(role))
 	spec.Add("selector", newSelector(role, settings))
 	spec.Add("template", podTemplate)
 	// "updateStrategy" is new in kube 1.7, so we don't add anything to non-helm configs
@@ -52,12 +52,14 @@ func NewStatefulSet(role *model.InstanceGroup, settings ExportSettings, grapher
 		SetConditionalAPIVersion("apps/v1", "apps/v1beta1").
 		SetKind("StatefulSet").
 		SetName(role.Name).
+		SetInstanceGroup(role).
 		AddModifier(helm.Comment(role.GetLongDescription()))
 	statefulSet, err := cb.Build()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to build a new kube config: %v", err)
 	}
 	statefulSet.Add("spec", spec)
+	addReloaderAnnotations(statefulSet, podTemplate, settings)
 	addFeatureCheck(role, statefulSet, svcList)
 	err = replicaCheck(role, statefulSet, settings)
 	if err != nil {
@@ -68,7 +70,7 @@ func NewStatefulSet(role *model.InstanceGroup, settings ExportSettings, grapher
 }
 
 // getVolumeClaims returns the list of persistent and shared volume claims from a role
-func getVolumeClaims(role *model.InstanceGroup, createHelmChart bool) []helm.Node {
+func getVolumeClaims(role *model.InstanceGroup, settings ExportSettings) []helm.Node {
 	var claims []helm.Node
 	for _, volume := range role.Run.Volumes {
 		var accessMode string
@@ -81,8 +83,8 @@ func getVolumeClaims(role *model.InstanceGroup, createHelmChart bool) []helm.Nod
 		case model.VolumeTypeShared:
 			accessMode = "ReadWriteMany"
 		}
-		storageClass := string(volume.Type)
-		if createHelmChart {
+		storageClass := settings.Substitutions.storageClass(volume.Type)
+		if settings.CreateHelmChart {
 			storageClass = fmt.Sprintf("{{ .Values.kube.storage_class.%s | quote }}", storageClass)
 		}
 
@@ -95,7 +97,7 @@ func getVolumeClaims(role *model.InstanceGroup, createHelmChart bool) []helm.Nod
 		meta.Add("annotations", annotationList)
 
 		var size string
-		if createHelmChart {
+		if settings.CreateHelmChart {
 			size = fmt.Sprintf("{{ .Values.sizing.%s.disk_sizes.%s }}G", makeVarName(role.Name), makeVarName(volume.Tag))
 		} else {
 			size = fmt.Sprintf("%dG", volume.Size)
@@ -801,3 +801,149 @@ func TestStatefulSetEmptyDirVolumesKube(t *testing.T) {
 	`
 	testhelpers.IsYAMLSubsetString(assert, expected, actual)
 }
+
+func TestStatefulSetServiceName(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	manifest, role := statefulSetTestLoadManifest(assert, "network-identity.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	statefulSet, deps, err := NewStatefulSet(role, ExportSettings{RoleManifest: manifest}, nil)
+	require.NoError(t, err)
+	assert.Equal("tor-nodes", statefulSet.Get("spec", "serviceName").String())
+
+	var names []string
+	for _, item := range deps.Get("items").Values() {
+		names = append(names, item.Get("metadata", "name").String())
+	}
+	assert.Contains(names, "tor-nodes", "The headless service of the instance group has the service name")
+	assert.NotContains(names, "myrole-set")
+
+	assert.Empty(ValidateServiceNames(ExportSettings{RoleManifest: manifest, ServiceNaming: ServiceNamingStrict}))
+}
+
+func TestStatefulSetReloaderAnnotations(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	manifest, role := statefulSetTestLoadManifest(assert, "exposed-ports.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	settings := ExportSettings{
+		CreateHelmChart: true,
+		RoleManifest:    manifest,
+		Opinions:        model.NewEmptyOpinions(),
+	}
+	statefulSet, _, err := NewStatefulSet(role, settings, nil)
+	require.NoError(t, err)
+
+	renderer, err := newTestRenderer(MakeValues(settings))
+	require.NoError(t, err)
+	render := func(config map[string]interface{}) map[interface{}]interface{} {
+		actual, err := renderer.RoundtripNode(statefulSet, config)
+		require.NoError(t, err)
+		return actual.(map[interface{}]interface{})["metadata"].(map[interface{}]interface{})
+	}
+
+	metadata := render(map[string]interface{}{
+		"Chart.Version":          "CV",
+		"Values.config.reloader": true,
+	})
+	assert.Equal(map[interface{}]interface{}{
+		ReloaderSecretAnnotation:    "configgin,deployment-manifest",
+		ReloaderConfigMapAnnotation: "myrole-log-forwarder",
+	}, metadata["annotations"])
+
+	metadata = render(nil)
+	assert.Nil(metadata["annotations"], "The annotations are only added with config.reloader")
+}
+
+func TestStatefulSetDevMode(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	manifest, role := statefulSetTestLoadManifest(assert, "dev-mode.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	settings := ExportSettings{
+		CreateHelmChart: true,
+		RoleManifest:    manifest,
+		Opinions:        model.NewEmptyOpinions(),
+		UseMemoryLimits: true,
+	}
+	statefulSet, _, err := NewStatefulSet(role, settings, nil)
+	require.NoError(t, err)
+
+	renderer, err := newTestRenderer(MakeValues(settings))
+	require.NoError(t, err)
+	nodeAffinity := map[string]interface{}{
+		"requiredDuringSchedulingIgnoredDuringExecution": map[string]interface{}{
+			"nodeSelectorTerms": []interface{}{map[string]interface{}{
+				"matchExpressions": []interface{}{map[string]interface{}{
+					"key": "disktype", "operator": "In", "values": []interface{}{"ssd"},
+				}},
+			}},
+		},
+	}
+	render := func(devMode bool) map[interface{}]interface{} {
+		actual, err := renderer.RoundtripNode(statefulSet, map[string]interface{}{
+			"Values.config.HA":                           true,
+			"Values.config.memory.requests":              true,
+			"Values.config.dev_mode":                     devMode,
+			"Values.sizing.myrole.affinity.nodeAffinity": nodeAffinity,
+		})
+		require.NoError(t, err)
+		return actual.(map[interface{}]interface{})
+	}
+
+	testhelpers.IsYAMLSubsetString(assert, `---
+		spec:
+			replicas: 3
+			template:
+				spec:
+					affinity:
+						podAntiAffinity: {}
+						nodeAffinity:
+							requiredDuringSchedulingIgnoredDuringExecution:
+								nodeSelectorTerms:
+								-	matchExpressions:
+									-	key: disktype
+					containers:
+					-	name: myrole
+						livenessProbe:
+							initialDelaySeconds: 600
+						readinessProbe:
+							initialDelaySeconds: 60
+						resources:
+							requests:
+								memory: 128Mi
+	`, render(false))
+
+	actual := render(true)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		spec:
+			replicas: 1
+			template:
+				spec:
+					affinity:
+						nodeAffinity:
+							requiredDuringSchedulingIgnoredDuringExecution:
+								nodeSelectorTerms:
+								-	matchExpressions:
+									-	key: disktype
+					containers:
+					-	name: myrole
+						livenessProbe:
+							initialDelaySeconds: 30
+						readinessProbe:
+							initialDelaySeconds: 30
+	`, actual)
+	podSpec := actual["spec"].(map[interface{}]interface{})["template"].(map[interface{}]interface{})["spec"].(map[interface{}]interface{})
+	assert.NotContains(podSpec["affinity"], "podAntiAffinity", "Development mode drops the pod anti affinity")
+	container := podSpec["containers"].([]interface{})[0].(map[interface{}]interface{})
+	assert.Nil(container["resources"].(map[interface{}]interface{})["requests"], "Development mode drops the requests")
+}
@@ -0,0 +1,84 @@
+package kube
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/validation"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Substitutions are the concrete values used for kube configs generated
+// without a helm chart, in place of the values a chart would be rendered with.
+// Empty fields keep the defaults.
+type Substitutions struct {
+	Registry       string            `yaml:"registry"`
+	Organization   string            `yaml:"organization"`
+	Namespace      string            `yaml:"namespace"`
+	ExternalIPs    []string          `yaml:"external_ips"`
+	StorageClasses map[string]string `yaml:"storage_classes"`
+}
+
+// defaultExternalIPs are the external IPs of public services without
+// substitutions
+var defaultExternalIPs = []string{"192.168.77.77"}
+
+// LoadSubstitutions reads the substitutions from a YAML file.
+func LoadSubstitutions(path string) (Substitutions, error) {
+	var substitutions Substitutions
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return substitutions, fmt.Errorf("Error reading substitutions %s: %v", path, err)
+	}
+	if err := yaml.UnmarshalStrict(contents, &substitutions); err != nil {
+		return substitutions, fmt.Errorf("Error reading substitutions %s: %v", path, err)
+	}
+	if errs := substitutions.Validate(); len(errs) != 0 {
+		return substitutions, fmt.Errorf("Invalid substitutions %s:\n%s", path, errs.Error())
+	}
+	return substitutions, nil
+}
+
+// Validate checks that the namespace is a valid kubernetes name, and that
+// storage classes are only given for the volume types with claims.
+func (s Substitutions) Validate() validation.ErrorList {
+	allErrs := validation.ErrorList{}
+	if s.Namespace != "" && s.Namespace != kubeName(s.Namespace) {
+		allErrs = append(allErrs, validation.Invalid("namespace", s.Namespace, "must be a valid kubernetes name"))
+	}
+	volumeTypes := make([]string, 0, len(s.StorageClasses))
+	for volumeType := range s.StorageClasses {
+		volumeTypes = append(volumeTypes, volumeType)
+	}
+	sort.Strings(volumeTypes)
+	for _, volumeType := range volumeTypes {
+		switch model.VolumeType(volumeType) {
+		case model.VolumeTypePersistent, model.VolumeTypeShared:
+		default:
+			allErrs = append(allErrs, validation.NotSupported(
+				"storage_classes",
+				volumeType,
+				[]string{string(model.VolumeTypePersistent), string(model.VolumeTypeShared)}))
+		}
+	}
+	return allErrs
+}
+
+// externalIPs returns the external IPs of public services.
+func (s Substitutions) externalIPs() []string {
+	if len(s.ExternalIPs) == 0 {
+		return defaultExternalIPs
+	}
+	return s.ExternalIPs
+}
+
+// storageClass returns the storage class of the claims for volumes of the
+// given type, which defaults to the name of the type.
+func (s Substitutions) storageClass(volumeType model.VolumeType) string {
+	if storageClass := s.StorageClasses[string(volumeType)]; storageClass != "" {
+		return storageClass
+	}
+	return string(volumeType)
+}
@@ -0,0 +1,148 @@
+package kube
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSubstitutions(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "fissile-substitutions-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	t.Run("Valid", func(t *testing.T) {
+		path := filepath.Join(dir, "valid.yml")
+		require.NoError(t, ioutil.WriteFile(path, []byte(`---
+registry: registry.example.com
+namespace: scf
+external_ips: [10.0.0.1, 10.0.0.2]
+storage_classes:
+  persistent: fast
+`), 0644))
+
+		substitutions, err := LoadSubstitutions(path)
+		require.NoError(t, err)
+		assert.Equal(t, Substitutions{
+			Registry:       "registry.example.com",
+			Namespace:      "scf",
+			ExternalIPs:    []string{"10.0.0.1", "10.0.0.2"},
+			StorageClasses: map[string]string{"persistent": "fast"},
+		}, substitutions)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		path := filepath.Join(dir, "invalid.yml")
+		require.NoError(t, ioutil.WriteFile(path, []byte(`---
+namespace: My_Namespace
+storage_classes:
+  host: local
+`), 0644))
+
+		_, err := LoadSubstitutions(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `namespace: Invalid value: "My_Namespace": must be a valid kubernetes name`)
+		assert.Contains(t, err.Error(), `storage_classes: Unsupported value: "host": supported values: persistent, shared`)
+	})
+
+	t.Run("UnknownKey", func(t *testing.T) {
+		path := filepath.Join(dir, "unknown.yml")
+		require.NoError(t, ioutil.WriteFile(path, []byte("external_ip: 10.0.0.1\n"), 0644))
+
+		_, err := LoadSubstitutions(path)
+		assert.Error(t, err)
+	})
+}
+
+func TestSubstitutionsKube(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	manifest, role := serviceTestLoadRole(assert, "exposed-ports.yml")
+	if manifest == nil || role == nil {
+		return
+	}
+
+	settings := ExportSettings{
+		Substitutions: Substitutions{
+			Namespace:   "scf",
+			ExternalIPs: []string{"10.0.0.1"},
+		},
+	}
+	service, err := newService(role, role.JobReferences[0], newServiceTypePublic, settings)
+	require.NoError(t, err)
+	require.NotNil(t, service)
+
+	actual, err := RoundtripKube(service)
+	require.NoError(t, err)
+	testhelpers.IsYAMLSubsetString(assert, `---
+		metadata:
+			name: myrole-tor-public
+			namespace: scf
+		spec:
+			externalIPs: [ 10.0.0.1 ]
+	`, actual)
+
+	settings.CreateHelmChart = true
+	service, err = newService(role, role.JobReferences[0], newServiceTypePublic, settings)
+	require.NoError(t, err)
+	require.NotNil(t, service)
+	assert.Nil(service.Get("metadata", "namespace"), "Helm charts should not have substituted namespaces")
+}
+
+func TestSubstitutionsNamespacedKinds(t *testing.T) {
+	t.Parallel()
+
+	settings := ExportSettings{Substitutions: Substitutions{Namespace: "scf"}}
+	for kind, namespaced := range map[string]bool{
+		"ClusterRole":    false,
+		"ConfigMap":      true,
+		"PrometheusRule": true,
+		"Route":          true,
+		"Secret":         true,
+	} {
+		config, err := NewConfigBuilder().
+			SetSettings(&settings).
+			SetAPIVersion("v1").
+			SetKind(kind).
+			SetName("object").
+			Build()
+		require.NoError(t, err)
+		if namespaced {
+			assert.Equal(t, "scf", config.Get("metadata", "namespace").String(), "%s should be namespaced", kind)
+		} else {
+			assert.Nil(t, config.Get("metadata", "namespace"), "%s should not be namespaced", kind)
+		}
+	}
+}
+
+func TestSubstitutionsStorageClass(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	role := podTemplateTestLoadRole(assert)
+	if role == nil {
+		return
+	}
+
+	settings := ExportSettings{
+		Substitutions: Substitutions{
+			StorageClasses: map[string]string{"persistent": "fast"},
+		},
+	}
+	storageClasses := make(map[string]string)
+	for _, claim := range getVolumeClaims(role, settings) {
+		name := claim.Get("metadata", "name").String()
+		storageClasses[name] = claim.Get("metadata", "annotations", VolumeStorageClassAnnotation).String()
+	}
+	assert.Equal(map[string]string{
+		"persistent-volume": "fast",
+		"shared-volume":     "shared",
+	}, storageClasses)
+}
@@ -1,29 +1,186 @@
 package kube
 
 import (
+	"fmt"
 	"strings"
 
 	"code.cloudfoundry.org/fissile/helm"
 )
 
+// HelmHelpersFileName is the name of the chart template defining the named
+// templates of GetHelmTemplateHelpers.  Helm does not render templates whose
+// name starts with an underscore, but makes their definitions available to
+// all other templates.
+const HelmHelpersFileName = "_fissile_helpers.tpl"
+
+// helmTemplateHelper is a named template shared by the generated templates
+type helmTemplateHelper struct {
+	name    string
+	comment string
+	lines   []string
+}
+
+var helmTemplateHelpers = []helmTemplateHelper{
+	{
+		name: "fissile.SanitizeName",
+		comment: `
+			fissile.SanitizeName returns the given parameter, up to 63 characters long.
+			This should be called as {{ template "fissile.SanitizeName" "foo" }}
+			`,
+		lines: []string{
+			`    {{- if lt (len .) 1 }}{{ fail "No name given for node" }}{{ end }}`,
+			`    {{- if gt (len .) 63 }}`,
+			`        {{- . | trunc 54 }}-{{ . | sha256sum | trunc 8 }}`,
+			`    {{- else }}`,
+			`        {{- . }}`,
+			`    {{- end }}`,
+		},
+	},
+	{
+		name: "fissile.ImageName",
+		comment: `
+			fissile.ImageName returns the name of an image in the registry and
+			organization configured in the kube values.
+			This should be called with a dict holding .Values.kube as "kube", and the
+			image name and tag as "image".
+			`,
+		lines: []string{
+			`    {{- .kube.registry.hostname }}/{{ .kube.organization }}/{{ .image }}`,
+		},
+	},
+	{
+		name: "fissile.Required",
+		comment: `
+			fissile.Required fails rendering because the value with the given name
+			has not been set.
+			This should be called as {{ template "fissile.Required" "env.FOO" }}
+			`,
+		lines: []string{
+			`    {{- fail (printf "%s has not been set" .) }}`,
+		},
+	},
+	{
+		name: "fissile.SecretValue",
+		comment: `
+			fissile.SecretValue returns the base64 encoded value of a secret, with maps
+			and lists encoded as JSON first.  Unset secrets are empty, unless required.
+			This should be called with a dict holding the value (.Values.secrets.FOO) as
+			"value", its name (secrets.FOO) as "name", and whether it is required as
+			"required".
+			`,
+		lines: []string{
+			`    {{- if ne (typeOf .value) "<nil>" }}`,
+			`        {{- if has (kindOf .value) (list "map" "slice") }}`,
+			`            {{- .value | toJson | b64enc | quote }}`,
+			`        {{- else }}`,
+			`            {{- .value | b64enc | quote }}`,
+			`        {{- end }}`,
+			`    {{- else if .required }}`,
+			`        {{- template "fissile.Required" .name }}`,
+			`    {{- else }}`,
+			`        {{- "" | b64enc | quote }}`,
+			`    {{- end }}`,
+		},
+	},
+	{
+		name: "fissile.ReplicaCount",
+		comment: `
+			fissile.ReplicaCount returns the number of instances of an instance group:
+			the configured count, or else the minimum (or HA) count.  Development mode
+			ignores the HA count.
+			This should be called with a dict holding the configured count as "count",
+			.Values.config as "config", the scaling limits as "min" and "ha", and
+			whether to quote the result as "quote".
+			`,
+		lines: []string{
+			`    {{- $default := ternary .ha .min (and (not (not .config.HA)) (not .config.dev_mode)) }}`,
+			`    {{- $count := ternary .count $default (ne (typeOf .count) "<nil>") }}`,
+			`    {{- if .quote }}`,
+			`        {{- $count | quote }}`,
+			`    {{- else }}`,
+			`        {{- $count }}`,
+			`    {{- end }}`,
+		},
+	},
+	{
+		name: "fissile.CheckReplicaCount",
+		comment: `
+			fissile.CheckReplicaCount fails if the configured number of instances of an
+			instance group is outside of the allowed range.  It renders nothing.  The HA
+			minimum is not checked in development mode.
+			This should be called with a dict holding the name of the instance group as
+			"name", the configured count as "count", .Values.config as "config", the
+			scaling limits as "min", "max", and "ha", and whether the count must be odd
+			as "odd".
+			`,
+		lines: []string{
+			`    {{- if ne (typeOf .count) "<nil>" }}`,
+			`        {{- if lt (int .count) .min }}`,
+			`            {{- fail (printf "%s must have at least %d instances" .name .min) }}`,
+			`        {{- end }}`,
+			`        {{- if and .config.HA .config.HA_strict (not .config.dev_mode) (lt (int .count) .ha) }}`,
+			`            {{- fail (printf "%s must have at least %d instances for HA" .name .ha) }}`,
+			`        {{- end }}`,
+			`        {{- if gt (int .count) .max }}`,
+			`            {{- fail (printf "%s cannot have more than %d instances" .name .max) }}`,
+			`        {{- end }}`,
+			`        {{- if and .odd (eq (mod (int .count) 2) 0) }}`,
+			`            {{- fail (printf "%s must have an odd instance count" .name) }}`,
+			`        {{- end }}`,
+			`    {{- end }}`,
+		},
+	},
+	{
+		name: "fissile.EnvValue",
+		comment: `
+			fissile.EnvValue returns the quoted value of an environment variable, with
+			maps and lists encoded as JSON first.  Unset values are empty, unless
+			required.
+			This should be called with a dict holding the value (.Values.env.FOO) as
+			"value", its name (env.FOO) as "name", and whether it is required as
+			"required".
+			`,
+		lines: []string{
+			`    {{- $kind := kindOf .value }}`,
+			`    {{- if eq $kind "invalid" }}`,
+			`        {{- if .required }}{{ template "fissile.Required" .name }}{{ else }}""{{ end }}`,
+			`    {{- else if or (eq $kind "map") (eq $kind "slice") }}`,
+			`        {{- .value | toJson | quote }}`,
+			`    {{- else }}`,
+			`        {{- .value | quote }}`,
+			`    {{- end }}`,
+		},
+	},
+	{
+		name: "fissile.EnvImageName",
+		comment: `
+			fissile.EnvImageName returns the quoted value of an environment variable
+			naming an image.  Image names without a slash are prefixed with the registry
+			and organization configured in the kube values.
+			This should be called like fissile.EnvValue, with .Values.kube added to the
+			dict as "kube".
+			`,
+		lines: []string{
+			`    {{- if eq (kindOf .value) "invalid" }}`,
+			`        {{- if .required }}{{ template "fissile.Required" .name }}{{ else }}""{{ end }}`,
+			`    {{- else if contains "/" .value }}`,
+			`        {{- .value | quote }}`,
+			`    {{- else }}`,
+			`        "{{- template "fissile.ImageName" (dict "kube" .kube "image" .value) }}"`,
+			`    {{- end }}`,
+		},
+	},
+}
+
 // GetHelmTemplateHelpers returns the helm templates needed throughout the code.
+// They are written to the _fissile_helpers.tpl of the chart, so that the
+// generated templates can call them instead of repeating the same template
+// logic.
 func GetHelmTemplateHelpers() []helm.Node {
-	sanitizeNameHelper := []string{
-		`{{ define "fissile.SanitizeName" }}`,
-		`    {{- if lt (len .) 1 }}{{ fail "No name given for node" }}{{ end }}`,
-		`    {{- if gt (len .) 63 }}`,
-		`        {{- . | trunc 54 }}-{{ . | sha256sum | trunc 8 }}`,
-		`    {{- else }}`,
-		`        {{- . }}`,
-		`    {{- end }}`,
-		`{{ end }}`,
-	}
-	return []helm.Node{
-		helm.NewNode(
-			strings.Join(sanitizeNameHelper, ""),
-			helm.Comment(`
-				fissile.SanitizeName returns the given parameter, up to 63 characters long.
-				This should be called as {{ template "fissile.SanitizeName" "foo" }}
-				`)),
+	var nodes []helm.Node
+	for _, helper := range helmTemplateHelpers {
+		text := fmt.Sprintf(`{{ define "%s" }}%s{{ end }}`, helper.name, strings.Join(helper.lines, ""))
+		nodes = append(nodes, helm.NewNode(text, helm.Comment(helper.comment)))
 	}
+	return nodes
 }
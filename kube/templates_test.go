@@ -38,4 +38,65 @@ func TestGetHelmTemplateHelpers(t *testing.T) {
 			}(testcase.length, testcase.expected)
 		}
 	})
+
+	t.Run("fissile.ImageName", func(t *testing.T) {
+		t.Parallel()
+		node := helm.NewNode(`{{ template "fissile.ImageName" (dict "kube" .Values.kube "image" "foo:tag") }}`)
+		rendered, err := RoundtripNode(node, map[string]interface{}{
+			"Values.kube.registry.hostname": "R",
+			"Values.kube.organization":      "O",
+		})
+		if assert.NoError(t, err) {
+			assert.Equal(t, "R/O/foo:tag", rendered)
+		}
+	})
+
+	t.Run("fissile.SecretValue", func(t *testing.T) {
+		t.Parallel()
+		tmpl := `{{ template "fissile.SecretValue" (dict "value" .Values.secrets.FOO "name" "secrets.FOO" "required" %t) }}`
+		rendered, err := RoundtripNode(helm.NewNode(fmt.Sprintf(tmpl, false)), map[string]interface{}{
+			"Values.secrets.FOO": []interface{}{"a"},
+		})
+		if assert.NoError(t, err) {
+			assert.Equal(t, "WyJhIl0=", rendered, "Lists are encoded as JSON")
+		}
+		rendered, err = RoundtripNode(helm.NewNode(fmt.Sprintf(tmpl, false)), nil)
+		if assert.NoError(t, err) {
+			assert.Equal(t, "", rendered)
+		}
+		_, err = RoundtripNode(helm.NewNode(fmt.Sprintf(tmpl, true)), nil)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "secrets.FOO has not been set")
+		}
+	})
+
+	t.Run("fissile.ReplicaCount", func(t *testing.T) {
+		t.Parallel()
+		tmpl := `{{ template "fissile.CheckReplicaCount" (dict "name" "foo" "count" .Values.count ` +
+			`"config" .Values.config "min" 1 "max" 5 "ha" 2 "odd" true) }}` +
+			`{{ template "fissile.ReplicaCount" (dict "count" .Values.count "config" .Values.config "min" 1 "ha" 2 "quote" false) }}`
+		for _, testcase := range []struct {
+			config   map[string]interface{}
+			expected interface{}
+			err      string
+		}{
+			{config: nil, expected: 1},
+			{config: map[string]interface{}{"Values.config.HA": true}, expected: 2},
+			{config: map[string]interface{}{"Values.count": 3}, expected: 3},
+			{config: map[string]interface{}{"Values.count": 0}, err: "foo must have at least 1 instances"},
+			{config: map[string]interface{}{"Values.count": 7}, err: "foo cannot have more than 5 instances"},
+			{config: map[string]interface{}{"Values.count": 4}, err: "foo must have an odd instance count"},
+		} {
+			rendered, err := RoundtripNode(helm.NewNode(tmpl), testcase.config)
+			if testcase.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), testcase.err)
+				}
+				continue
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, testcase.expected, rendered)
+			}
+		}
+	})
 }
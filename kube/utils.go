@@ -2,6 +2,7 @@ package kube
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"code.cloudfoundry.org/fissile/helm"
@@ -18,8 +19,28 @@ const (
 	AppVersionLabel = "version"
 	// VolumeStorageClassAnnotation is the annotation label for storage/v1beta1/StorageClass
 	VolumeStorageClassAnnotation = "volume.beta.kubernetes.io/storage-class"
+	// ContainerJobsAnnotationPrefix is the prefix of the pod annotations listing
+	// the jobs run by each container, keyed by the container name
+	ContainerJobsAnnotationPrefix = "jobs.fissile.cloudfoundry.org/"
 )
 
+// namespacedKinds are the kinds of the namespaced objects fissile generates;
+// cluster roles, their bindings, and pod security policies are not namespaced.
+var namespacedKinds = map[string]bool{
+	"ConfigMap":      true,
+	"Deployment":     true,
+	"Job":            true,
+	"Pod":            true,
+	"PrometheusRule": true,
+	"Role":           true,
+	"RoleBinding":    true,
+	"Route":          true,
+	"Secret":         true,
+	"Service":        true,
+	"ServiceAccount": true,
+	"StatefulSet":    true,
+}
+
 func newTypeMeta(apiVersion, kind string, modifiers ...helm.NodeModifier) *helm.Mapping {
 	mapping := helm.NewMapping("apiVersion", apiVersion, "kind", kind)
 	mapping.Set(modifiers...)
@@ -28,9 +49,9 @@ func newTypeMeta(apiVersion, kind string, modifiers ...helm.NodeModifier) *helm.
 
 func newSelector(role *model.InstanceGroup, settings ExportSettings) *helm.Mapping {
 	// XXX We need to match on legacy RoleNameLabel to maintain upgradability of stateful sets
-	matchLabels := helm.NewMapping("skiff-role-name", role.Name)
+	matchLabels := helm.NewMapping("skiff-role-name", kubeName(role.Name))
 	if role.HasTag(model.RoleTagIstioManaged) && settings.CreateHelmChart {
-		matchLabels.Add(AppNameLabel, role.Name, helm.Block("if .Values.config.use_istio"))
+		matchLabels.Add(AppNameLabel, kubeName(role.Name), helm.Block("if .Values.config.use_istio"))
 		matchLabels.Add(AppVersionLabel, `{{ default .Chart.Version .Chart.AppVersion | quote }}`, helm.Block("if .Values.config.use_istio"))
 	}
 
@@ -41,11 +62,12 @@ func newSelector(role *model.InstanceGroup, settings ExportSettings) *helm.Mappi
 
 // ConfigBuilder sets up a generic Kube resource structure with minimal metadata.
 type ConfigBuilder struct {
-	settings   *ExportSettings
-	apiVersion string
-	kind       string
-	name       string
-	modifiers  []helm.NodeModifier
+	settings      *ExportSettings
+	apiVersion    string
+	kind          string
+	name          string
+	instanceGroup *model.InstanceGroup
+	modifiers     []helm.NodeModifier
 
 	err error
 }
@@ -98,15 +120,22 @@ func (b *ConfigBuilder) SetKind(kind string) *ConfigBuilder {
 	return b
 }
 
-// SetName sets the name of the resource to build.
+// SetName sets the name of the resource to build.  The name is converted into
+// a valid kubernetes name if necessary (see kubeName).
 func (b *ConfigBuilder) SetName(name string) *ConfigBuilder {
-	if len(name) > 63 {
-		b.setError(fmt.Errorf("kube name exceeds 63 characters"))
-	}
-	b.name = name
+	b.name = kubeName(name)
 	return b
 }
 
+// setConfigName sets the name of the Secret or ConfigMap object to build, as
+// returned by immutableConfigName.
+func (b *ConfigBuilder) setConfigName(name string) *ConfigBuilder {
+	if strings.HasPrefix(name, "{{") {
+		return b.SetNameHelmExpression(name)
+	}
+	return b.SetName(name)
+}
+
 // SetNameHelmExpression sets the name of the resource to build as a Helm template expression.
 func (b *ConfigBuilder) SetNameHelmExpression(name string) *ConfigBuilder {
 	if b.settings == nil {
@@ -127,6 +156,13 @@ func (b *ConfigBuilder) SetNameHelmExpression(name string) *ConfigBuilder {
 	return b
 }
 
+// SetInstanceGroup sets the instance group the resource to build belongs to,
+// whose configured labels and annotations are added to it.
+func (b *ConfigBuilder) SetInstanceGroup(instanceGroup *model.InstanceGroup) *ConfigBuilder {
+	b.instanceGroup = instanceGroup
+	return b
+}
+
 // AddModifier adds a modifier to be used by the builder.
 func (b *ConfigBuilder) AddModifier(modifier helm.NodeModifier) *ConfigBuilder {
 	b.modifiers = append(b.modifiers, modifier)
@@ -173,11 +209,73 @@ func (b *ConfigBuilder) Build() (*helm.Mapping, error) {
 	}
 
 	config := newTypeMeta(b.apiVersion, b.kind, b.modifiers...)
-	config.Add("metadata", helm.NewMapping("name", b.name, "labels", labels))
+	metadata := helm.NewMapping("name", b.name)
+	if !b.settings.CreateHelmChart && b.settings.Substitutions.Namespace != "" && namespacedKinds[b.kind] {
+		metadata.Add("namespace", b.settings.Substitutions.Namespace)
+	}
+	extra := b.extraMetadata()
+	for _, key := range sortedKeys(extra.Labels) {
+		labels.Add(key, extra.Labels[key])
+	}
+	metadata.Add("labels", labels)
+	if len(extra.Annotations) > 0 {
+		annotations := helm.NewMapping()
+		for _, key := range sortedKeys(extra.Annotations) {
+			annotations.Add(key, extra.Annotations[key])
+		}
+		metadata.Add("annotations", annotations)
+	}
+	config.Add("metadata", metadata)
 
 	return config, nil
 }
 
+// extraMetadata returns the labels and annotations configured in the role
+// manifest for the resource to build.  The instance group configuration takes
+// precedence over the global one, and within each the kind specific entries
+// take precedence.
+func (b *ConfigBuilder) extraMetadata() model.ObjectMetadata {
+	var extra model.ObjectMetadata
+	if b.settings.RoleManifest != nil && b.settings.RoleManifest.Configuration != nil {
+		extra.Merge(b.settings.RoleManifest.Configuration.Metadata.ForKind(b.kind))
+	}
+	if b.instanceGroup != nil && b.instanceGroup.Configuration != nil {
+		extra.Merge(b.instanceGroup.Configuration.Metadata.ForKind(b.kind))
+	}
+	return extra
+}
+
+// sortedKeys returns the keys of the map in order, so that the generated
+// configs are stable.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// immutableConfigName returns the name of a Secret or ConfigMap object the
+// pods consume.  In helm charts with immutable config, the name gets a suffix
+// of the sha256 of the values the object is rendered from, so that changing
+// them creates a new object and rolls the pods consuming it; the name is
+// then a helm expression.
+func immutableConfigName(name string, settings ExportSettings, values ...string) string {
+	if !settings.CreateHelmChart || !settings.ImmutableConfig {
+		return name
+	}
+	return fmt.Sprintf(`{{ print %q (list %s | toJson | sha256sum | trunc 8) }}`, kubeName(name)+"-", strings.Join(values, " "))
+}
+
+// addImmutable marks the Secret or ConfigMap object immutable in helm charts
+// with immutable config; see immutableConfigName.
+func addImmutable(object *helm.Mapping, settings ExportSettings) {
+	if settings.CreateHelmChart && settings.ImmutableConfig {
+		object.Add("immutable", true)
+	}
+}
+
 func makeVarName(name string) string {
 	return strings.Replace(name, "-", "_", -1)
 }
@@ -227,11 +325,29 @@ func MakeBasicValues() *helm.Mapping {
 				"requests", helm.NewNode(false, helm.Comment("Flag to activate cpu requests")),
 				"limits", helm.NewNode(false, helm.Comment("Flag to activate cpu limits")),
 			), helm.Comment("Global CPU configuration")),
-			"use_istio", helm.NewNode(false, helm.Comment("Flag to specify whether to add Istio related annotations and labels"))),
+			"use_istio", helm.NewNode(false, helm.Comment("Flag to specify whether to add Istio related annotations and labels")),
+			"reloader", helm.NewNode(false, helm.Comment("Flag to annotate workloads with the secrets and config maps they consume, for a reloader to roll their pods on changes")),
+			"dev_mode", helm.NewNode(false, helm.Comment("Flag to run on small clusters like minikube: no resource requests, affinity, or HA minimums, minimal instance counts, and short probe delays"))),
 		"bosh", helm.NewMapping("instance_groups", helm.NewList()),
 		"env", helm.NewMapping(),
 		"sizing", helm.NewMapping(),
 		"secrets", helm.NewMapping(),
-		"services", helm.NewMapping("loadbalanced", false),
-		"ingress", helm.NewMapping("enabled", false))
+		"services", helm.NewMapping(
+			"loadbalanced", false,
+			"node_port", helm.NewNode(false, helm.Comment("Expose public services on node ports, unless loadbalanced; see sizing.*.ports.*.node_port"))),
+		"ingress", helm.NewMapping("enabled", false),
+		"logging", helm.NewMapping(
+			"sidecar", helm.NewNode("", helm.Comment("Sidecar added to the pods to get the log files of the jobs to the cluster logging: tail prints them to its standard output, forwarder ships them with fluent-bit; empty for none")),
+			"tail", helm.NewMapping("image", helm.NewNode(LogTailImage, helm.Comment("Image of the tail sidecar, with a POSIX shell and tail"))),
+			"forwarder", helm.NewMapping(
+				"image", helm.NewNode(LogForwarderImage, helm.Comment("Image of the forwarder sidecar, a fluent-bit compatible one")),
+				"outputs", helm.NewNode(LogForwarderOutputs, helm.Comment("The [OUTPUT] sections of the fluent-bit configuration of the forwarder"))),
+			"resources", helm.NewNode(helm.NewMapping(
+				"memory", helm.NewMapping(
+					"request", int(model.LogSidecarMemoryRequest),
+					"limit", int(model.LogSidecarMemoryLimit)),
+				"cpu", helm.NewMapping(
+					"request", 1000.*model.LogSidecarCPURequest,
+					"limit", 1000.*model.LogSidecarCPULimit),
+			), helm.Comment("Memory [MiB] and CPU [millicore] requests and limits of the log sidecars, applied like those of the instance groups with config.memory and config.cpu"))))
 }
@@ -103,6 +103,65 @@ func TestNewKubeConfig(t *testing.T) {
 	`, actual)
 }
 
+func TestNewKubeConfigMetadata(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	roleManifest := &model.RoleManifest{
+		Configuration: &model.Configuration{
+			Metadata: model.ConfigurationMetadata{
+				ObjectMetadata: model.ObjectMetadata{
+					Labels:      map[string]string{"cost-center": "1234", "team": "platform"},
+					Annotations: map[string]string{"owner": "platform@example.com"},
+				},
+				Kinds: map[string]model.ObjectMetadata{
+					"thekind":   {Labels: map[string]string{"team": "kind"}},
+					"Service":   {Labels: map[string]string{"team": "network"}},
+					"otherkind": {Annotations: map[string]string{"owner": "other"}},
+				},
+			},
+		},
+	}
+	instanceGroup := &model.InstanceGroup{
+		Name: "thename",
+		Configuration: &model.Configuration{
+			Metadata: model.ConfigurationMetadata{
+				ObjectMetadata: model.ObjectMetadata{
+					Annotations: map[string]string{"owner": "thename@example.com"},
+				},
+			},
+		},
+	}
+
+	cb := NewConfigBuilder().
+		SetSettings(&ExportSettings{RoleManifest: roleManifest}).
+		SetAPIVersion("theApiVersion").
+		SetKind("thekind").
+		SetName("thename").
+		SetInstanceGroup(instanceGroup)
+	kubeConfig, err := cb.Build()
+	if !assert.NoError(err) {
+		return
+	}
+
+	actual, err := RoundtripKube(kubeConfig)
+	if !assert.NoError(err) {
+		return
+	}
+	testhelpers.IsYAMLEqualString(assert, `---
+		apiVersion: "theApiVersion"
+		kind: "thekind"
+		metadata:
+			name: "thename"
+			labels:
+				app.kubernetes.io/component: "thename"
+				cost-center: "1234"
+				team: "kind"
+			annotations:
+				owner: "thename@example.com"
+	`, actual)
+}
+
 func TestMakeVarName(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
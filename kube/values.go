@@ -26,6 +26,9 @@ func formattedExample(example string) string {
 // MakeValues returns a Mapping with all default values for the Helm chart.
 func MakeValues(settings ExportSettings) helm.Node {
 	values := MakeBasicValues()
+	if settings.RoleManifest.Configuration != nil && settings.RoleManifest.Configuration.LogSidecar != model.LogSidecarNone {
+		values.Get("logging", "sidecar").SetValue(string(settings.RoleManifest.Configuration.LogSidecar))
+	}
 	env := helm.NewMapping()
 	secrets := helm.NewMapping()
 	generated := helm.NewMapping()
@@ -92,6 +95,11 @@ func MakeValues(settings ExportSettings) helm.Node {
 	values.Add("secrets", secrets.Sort())
 	values.Add("env", env.Sort())
 
+	if settings.DeploymentManifest {
+		values.Add("bosh", MakeDeploymentManifest(settings.RoleManifest),
+			helm.Comment("The deployment manifest mounted into the pods, generated from the role manifest"))
+	}
+
 	sizing := helm.NewMapping()
 	sizing.Set(helm.Comment(strings.Join(strings.Fields(`
 		The sizing section contains configuration to change each individual instance
@@ -145,13 +153,17 @@ func MakeValues(settings ExportSettings) helm.Node {
 		entry.Add("count", nil, helm.Comment(comment))
 		if settings.UseMemoryLimits {
 			var request helm.Node
-			if instanceGroup.Run.Memory.Request == nil {
+			if instanceGroup.Run.Memory.RequestQuantity != "" {
+				request = helm.NewNode(instanceGroup.Run.Memory.RequestQuantity)
+			} else if instanceGroup.Run.Memory.Request == nil {
 				request = helm.NewNode(nil)
 			} else {
 				request = helm.NewNode(int(*instanceGroup.Run.Memory.Request))
 			}
 			var limit helm.Node
-			if instanceGroup.Run.Memory.Limit == nil {
+			if instanceGroup.Run.Memory.LimitQuantity != "" {
+				limit = helm.NewNode(instanceGroup.Run.Memory.LimitQuantity)
+			} else if instanceGroup.Run.Memory.Limit == nil {
 				limit = helm.NewNode(nil)
 			} else {
 				limit = helm.NewNode(int(*instanceGroup.Run.Memory.Limit))
@@ -160,17 +172,21 @@ func MakeValues(settings ExportSettings) helm.Node {
 			entry.Add("memory", helm.NewMapping(
 				"request", request,
 				"limit", limit),
-				helm.Comment("Unit [MiB]"))
+				helm.Comment("Unit [MiB], or a quantity like 1Gi"))
 		}
 		if settings.UseCPULimits {
 			var request helm.Node
-			if instanceGroup.Run.CPU.Request == nil {
+			if instanceGroup.Run.CPU.RequestQuantity != "" {
+				request = helm.NewNode(instanceGroup.Run.CPU.RequestQuantity)
+			} else if instanceGroup.Run.CPU.Request == nil {
 				request = helm.NewNode(nil)
 			} else {
 				request = helm.NewNode(1000. * *instanceGroup.Run.CPU.Request)
 			}
 			var limit helm.Node
-			if instanceGroup.Run.CPU.Limit == nil {
+			if instanceGroup.Run.CPU.LimitQuantity != "" {
+				limit = helm.NewNode(instanceGroup.Run.CPU.LimitQuantity)
+			} else if instanceGroup.Run.CPU.Limit == nil {
 				limit = helm.NewNode(nil)
 			} else {
 				limit = helm.NewNode(1000. * *instanceGroup.Run.CPU.Limit)
@@ -179,7 +195,7 @@ func MakeValues(settings ExportSettings) helm.Node {
 			entry.Add("cpu", helm.NewMapping(
 				"request", request,
 				"limit", limit),
-				helm.Comment("Unit [millicore]"))
+				helm.Comment("Unit [millicore], or a quantity like 250m"))
 		}
 
 		diskSizes := helm.NewMapping()
@@ -202,6 +218,9 @@ func MakeValues(settings ExportSettings) helm.Node {
 				if port.CountIsConfigurable {
 					config.Add("count", port.Count)
 				}
+				if port.NodePort != 0 {
+					config.Add("node_port", port.NodePort)
+				}
 				if len(config.Names()) > 0 {
 					ports.Add(makeVarName(port.Name), config)
 				}
@@ -211,7 +230,62 @@ func MakeValues(settings ExportSettings) helm.Node {
 			entry.Add("ports", ports.Sort())
 		}
 
-		entry.Add("affinity", helm.NewMapping(), helm.Comment("Node affinity rules can be specified here"))
+		affinity := helm.NewMapping()
+		if kind, rules := presetAffinity(instanceGroup); kind == "nodeAffinity" {
+			affinity.Add(kind, rules)
+		}
+		entry.Add("affinity", affinity, helm.Comment("Node affinity rules can be specified here"))
+
+		var command, args interface{}
+		if len(instanceGroup.Run.Command) > 0 {
+			command = instanceGroup.Run.Command
+		}
+		if len(instanceGroup.Run.Args) > 0 {
+			args = instanceGroup.Run.Args
+		}
+		entry.Add("command", command, helm.Comment(fmt.Sprintf(
+			"The command to run instead of the entrypoint of the %s image (/opt/fissile/run.sh)", makeVarName(instanceGroup.Name))))
+		entry.Add("args", args, helm.Comment("The arguments to the command"))
+		var imagePullPolicy interface{}
+		if instanceGroup.Run.ImagePullPolicy != "" {
+			imagePullPolicy = instanceGroup.Run.ImagePullPolicy
+		}
+		entry.Add("image_pull_policy", imagePullPolicy, helm.Comment(fmt.Sprintf(
+			"The image pull policy of the %s containers: Always, IfNotPresent, or Never; kube decides if not set",
+			makeVarName(instanceGroup.Name))))
+		if instanceGroup.Type != model.RoleTypeColocatedContainer {
+			securityContext := helm.NewMapping()
+			comment := strings.Join([]string{
+				"The users and groups of the pods: run_as_user, run_as_group, fs_group, supplemental_groups,",
+				"and fs_group_change_policy (Always or OnRootMismatch; kube 1.20 and newer only)",
+			}, "\n")
+			if settings.OpenShift {
+				comment = "The supplemental_groups of the pods; OpenShift assigns their users and groups"
+			}
+			if manifestContext := instanceGroup.Run.SecurityContext; manifestContext != nil && !settings.OpenShift {
+				if manifestContext.RunAsUser != nil {
+					securityContext.Add("run_as_user", int(*manifestContext.RunAsUser))
+				}
+				if manifestContext.RunAsGroup != nil {
+					securityContext.Add("run_as_group", int(*manifestContext.RunAsGroup))
+				}
+				if manifestContext.FSGroup != nil {
+					securityContext.Add("fs_group", int(*manifestContext.FSGroup))
+				}
+				if manifestContext.FSGroupChangePolicy != "" {
+					securityContext.Add("fs_group_change_policy", manifestContext.FSGroupChangePolicy)
+				}
+			}
+			if manifestContext := instanceGroup.Run.SecurityContext; manifestContext != nil && len(manifestContext.SupplementalGroups) > 0 {
+				securityContext.Add("supplemental_groups", supplementalGroups(manifestContext.SupplementalGroups))
+			}
+			entry.Add("security_context", securityContext, helm.Comment(comment))
+		}
+		if !instanceGroup.Run.Privileged && !util.StringInSlice("ALL", instanceGroup.Run.Capabilities) {
+			entry.Add("drop_capabilities", instanceGroup.Run.DropCapabilities, helm.Comment(fmt.Sprintf(
+				"Drop all capabilities of the %s containers but those declared in the role manifest and those fissile needs",
+				makeVarName(instanceGroup.Name))))
+		}
 
 		sizing.Add(makeVarName(instanceGroup.Name), entry.Sort(), helm.Comment(instanceGroup.GetLongDescription()))
 	}
@@ -229,7 +303,15 @@ func MakeValues(settings ExportSettings) helm.Node {
 	kube.Add("registry", helm.NewMapping(
 		"hostname", registry,
 		"username", settings.Username,
-		"password", settings.Password))
+		"password", settings.Password,
+		"config_json", helm.NewNode(false, helm.Comment(strings.Join([]string{
+			"Generate registry-credentials as a kubernetes.io/dockerconfigjson secret instead of",
+			"kubernetes.io/dockercfg; the type of an existing secret cannot change on upgrade",
+		}, "\n"))),
+		"pull_secrets", helm.NewNode(nil, helm.Comment(strings.Join([]string{
+			"The names of the image pull secrets of the pods, instead of registry-credentials",
+			"(generated when the username is set); an empty list uses no pull secret",
+		}, "\n")))))
 	kube.Add("organization", settings.Organization)
 	if settings.AuthType != "" {
 		kube.Add("auth", settings.AuthType)
@@ -239,6 +321,13 @@ func MakeValues(settings ExportSettings) helm.Node {
 		psps.Add(pspName, nil)
 	}
 	kube.Add("psp", psps.Sort())
+	if settings.OpenShift {
+		sccs := helm.NewMapping()
+		for pspName := range settings.RoleManifest.Configuration.Authorization.PodSecurityPolicies {
+			sccs.Add(pspName, nil)
+		}
+		kube.Add("scc", sccs.Sort(), helm.Comment("Existing security context constraints to use instead of those generated for the pod security policies"))
+	}
 	kube.Add(
 		"limits", helm.NewMapping(
 			"nproc", helm.NewMapping(
@@ -262,6 +351,18 @@ func MakeValues(settings ExportSettings) helm.Node {
 				unlessFeatures = append(unlessFeatures, makeVarName(instanceGroup.Name))
 			}
 		}
+		var ifJobs []string
+		var unlessJobs []string
+		for _, instanceGroup := range settings.RoleManifest.InstanceGroups {
+			for _, job := range instanceGroup.JobReferences {
+				jobName := fmt.Sprintf("%s/%s", makeVarName(instanceGroup.Name), job.Name)
+				if job.IfFeature == name {
+					ifJobs = append(ifJobs, jobName)
+				} else if job.UnlessFeature == name {
+					unlessJobs = append(unlessJobs, jobName)
+				}
+			}
+		}
 		var comment string
 		if len(ifFeatures) > 0 {
 			comment = fmt.Sprintf("The %s feature enables these instance groups: %s",
@@ -276,6 +377,20 @@ func MakeValues(settings ExportSettings) helm.Node {
 					util.WordList(unlessFeatures, "and"))
 			}
 		}
+		if len(ifJobs) > 0 {
+			if len(comment) > 0 {
+				comment += "\n"
+			}
+			comment += fmt.Sprintf("The %s feature enables these jobs: %s",
+				name, util.WordList(ifJobs, "and"))
+		}
+		if len(unlessJobs) > 0 {
+			if len(comment) > 0 {
+				comment += "\n"
+			}
+			comment += fmt.Sprintf("The %s feature disables these jobs: %s",
+				name, util.WordList(unlessJobs, "and"))
+		}
 		enable.Add(name, value, helm.Comment(comment))
 	}
 	values.Add("enable", enable.Sort())
@@ -286,5 +401,18 @@ func MakeValues(settings ExportSettings) helm.Node {
 	ingress.Add("tls", helm.NewMapping(), helm.Comment("ingress.tls.crt and ingress.tls.key, when specified, are used by the TLS secret for the Ingress resource."))
 	values.Add("ingress", ingress.Sort())
 
+	if len(MetricsInstanceGroups(settings.RoleManifest)) > 0 {
+		dashboards := helm.NewMapping()
+		dashboards.Add("enabled", false, helm.Comment("monitoring.dashboards.enabled creates a Grafana dashboard (for the Grafana sidecar) and Prometheus alert rules (for the Prometheus operator) of the instance groups serving metrics."))
+		values.Add("monitoring", helm.NewMapping("dashboards", dashboards))
+	}
+
+	if settings.OpenShift {
+		routes := helm.NewMapping()
+		routes.Add("enabled", true, helm.Comment("routes.enabled creates an OpenShift route for each public port."))
+		routes.Add("tls_termination", RouteTLSTermination, helm.Comment("routes.tls_termination is the TLS termination of the routes: passthrough, edge, reencrypt, or empty for none."))
+		values.Add("routes", routes.Sort())
+	}
+
 	return values
 }
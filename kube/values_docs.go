@@ -0,0 +1,143 @@
+package kube
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/helm"
+	"code.cloudfoundry.org/fissile/model"
+)
+
+// These are the supported formats of the values documentation
+const (
+	ValuesDocsMarkdown = "markdown"
+	ValuesDocsCSV      = "csv"
+)
+
+// ValueDoc documents one key of the values of the helm chart
+type ValueDoc struct {
+	Key         string
+	Type        string
+	Default     string
+	Required    bool
+	Description string
+}
+
+// MakeValuesDocs returns the documentation of every key of the values
+// generated by MakeValues, in the same order.  Keys with mappings as values
+// are documented by their elements, except for empty mappings.  The
+// descriptions are the comments of the values, and the keys for variables are
+// marked as required as in the role manifest.
+func MakeValuesDocs(settings ExportSettings) []ValueDoc {
+	variables := model.MakeMapOfVariables(settings.RoleManifest)
+	var docs []ValueDoc
+	var walk func(prefix string, node helm.Node, comment string)
+	walk = func(prefix string, node helm.Node, comment string) {
+		doc := ValueDoc{Key: prefix, Description: strings.Join(strings.Fields(comment), " ")}
+		switch value := node.(type) {
+		case *helm.Mapping:
+			if len(value.Names()) > 0 {
+				for _, name := range value.Names() {
+					element := value.Get(name)
+					walk(joinValuesKey(prefix, name), element, element.Comment())
+				}
+				return
+			}
+			doc.Type = "map"
+			doc.Default = "{}"
+		case *helm.List:
+			doc.Type = "list"
+			var elements []string
+			for _, element := range value.Values() {
+				_, text := scalarValueDoc(element)
+				elements = append(elements, text)
+			}
+			doc.Default = "[" + strings.Join(elements, ", ") + "]"
+		default:
+			doc.Type, doc.Default = scalarValueDoc(node)
+		}
+
+		parts := strings.SplitN(prefix, ".", 2)
+		if len(parts) == 2 && (parts[0] == "env" || parts[0] == "secrets") {
+			if variable, ok := variables[parts[1]]; ok {
+				doc.Required = variable.CVOptions.Required
+				if doc.Type == "" {
+					doc.Type = "string"
+				}
+			}
+		}
+		if doc.Type == "" {
+			doc.Type = "any"
+		}
+		docs = append(docs, doc)
+	}
+	walk("", MakeValues(settings), "")
+	return docs
+}
+
+// scalarValueDoc returns the type and the default of a scalar value.  The
+// type of null values is left empty.
+func scalarValueDoc(node helm.Node) (string, string) {
+	scalar, ok := node.(*helm.Scalar)
+	if !ok {
+		return "", strings.TrimSpace(strings.TrimPrefix(node.String(), "---"))
+	}
+	literal := scalar.Literal()
+	switch {
+	case literal == "~":
+		return "", ""
+	case strings.HasPrefix(literal, `"`):
+		return "string", scalar.String()
+	case literal == "true" || literal == "false":
+		return "boolean", literal
+	}
+	if _, err := strconv.ParseInt(literal, 10, 64); err == nil {
+		return "integer", literal
+	}
+	if _, err := strconv.ParseFloat(literal, 64); err == nil {
+		return "number", literal
+	}
+	return "string", literal
+}
+
+func joinValuesKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// WriteValuesDocs writes the documentation of the values as a table in the
+// given format.
+func WriteValuesDocs(writer io.Writer, docs []ValueDoc, format string) error {
+	switch format {
+	case ValuesDocsMarkdown:
+		fmt.Fprintln(writer, "| Key | Type | Default | Required | Description |")
+		fmt.Fprintln(writer, "| --- | --- | --- | --- | --- |")
+		escape := strings.NewReplacer("|", `\|`, "\n", " ")
+		for _, doc := range docs {
+			defaultValue := ""
+			if doc.Default != "" {
+				defaultValue = "`" + escape.Replace(doc.Default) + "`"
+			}
+			required := ""
+			if doc.Required {
+				required = "yes"
+			}
+			fmt.Fprintf(writer, "| `%s` | %s | %s | %s | %s |\n",
+				doc.Key, doc.Type, defaultValue, required, escape.Replace(doc.Description))
+		}
+		return nil
+	case ValuesDocsCSV:
+		csvWriter := csv.NewWriter(writer)
+		records := [][]string{{"key", "type", "default", "required", "description"}}
+		for _, doc := range docs {
+			records = append(records, []string{doc.Key, doc.Type, doc.Default, strconv.FormatBool(doc.Required), doc.Description})
+		}
+		return csvWriter.WriteAll(records)
+	}
+	return fmt.Errorf("Invalid values documentation format '%s', expected one of %s or %s", format, ValuesDocsMarkdown, ValuesDocsCSV)
+}
@@ -0,0 +1,77 @@
+package kube
+
+import (
+	"bytes"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeValuesDocs(t *testing.T) {
+	t.Parallel()
+
+	settings := ExportSettings{
+		RoleManifest: &model.RoleManifest{
+			InstanceGroups: model.InstanceGroups{},
+			Configuration:  &model.Configuration{},
+			Variables: model.Variables{
+				&model.VariableDefinition{
+					Name: "DOMAIN",
+					CVOptions: model.CVOptions{
+						Description: "The domain\nof the cluster",
+						Required:    true,
+					},
+				},
+				&model.VariableDefinition{
+					Name: "PASSWORD",
+					CVOptions: model.CVOptions{
+						Description: "A password | with a pipe",
+						Default:     "secret",
+						Secret:      true,
+					},
+				},
+			},
+		},
+	}
+
+	docs := MakeValuesDocs(settings)
+	byKey := make(map[string]ValueDoc)
+	for _, doc := range docs {
+		byKey[doc.Key] = doc
+	}
+
+	assert.Equal(t, ValueDoc{Key: "env.DOMAIN", Type: "string", Required: true, Description: "The domain of the cluster"}, byKey["env.DOMAIN"])
+	assert.Equal(t, ValueDoc{Key: "secrets.PASSWORD", Type: "string", Default: "secret", Description: "A password | with a pipe"}, byKey["secrets.PASSWORD"])
+	assert.Equal(t, ValueDoc{Key: "kube.secrets_generation_counter", Type: "integer", Default: "1",
+		Description: "Increment this counter to rotate all generated secrets"}, byKey["kube.secrets_generation_counter"])
+	assert.Equal(t, ValueDoc{Key: "kube.registry.hostname", Type: "string", Default: "docker.io"}, byKey["kube.registry.hostname"])
+	assert.Equal(t, ValueDoc{Key: "kube.external_ips", Type: "list", Default: "[]"}, byKey["kube.external_ips"])
+	assert.Equal(t, "boolean", byKey["config.HA"].Type)
+	assert.Equal(t, "map", byKey["kube.psp"].Type)
+	assert.NotContains(t, byKey, "kube", "Mappings are documented by their elements")
+
+	t.Run("Markdown", func(t *testing.T) {
+		t.Parallel()
+		buf := &bytes.Buffer{}
+		require.NoError(t, WriteValuesDocs(buf, docs, ValuesDocsMarkdown))
+		assert.Contains(t, buf.String(), "| Key | Type | Default | Required | Description |\n| --- | --- | --- | --- | --- |\n")
+		assert.Contains(t, buf.String(), "| `env.DOMAIN` | string |  | yes | The domain of the cluster |\n")
+		assert.Contains(t, buf.String(), "| `secrets.PASSWORD` | string | `secret` |  | A password \\| with a pipe |\n")
+		assert.Contains(t, buf.String(), "| `kube.registry.hostname` | string | `docker.io` |  |  |\n")
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		t.Parallel()
+		buf := &bytes.Buffer{}
+		require.NoError(t, WriteValuesDocs(buf, docs, ValuesDocsCSV))
+		assert.Contains(t, buf.String(), "key,type,default,required,description\n")
+		assert.Contains(t, buf.String(), "env.DOMAIN,string,,true,The domain of the cluster\n")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		t.Parallel()
+		assert.Error(t, WriteValuesDocs(&bytes.Buffer{}, docs, "html"))
+	})
+}
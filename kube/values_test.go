@@ -3,6 +3,7 @@ package kube
 import (
 	"testing"
 
+	"code.cloudfoundry.org/fissile/helm"
 	"code.cloudfoundry.org/fissile/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -35,6 +36,96 @@ func TestMakeValues(t *testing.T) {
 		assert.Contains(t, sizing.Comment(), "underscore")
 	})
 
+	t.Run("Command", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{
+			RoleManifest: &model.RoleManifest{
+				InstanceGroups: model.InstanceGroups{
+					&model.InstanceGroup{
+						Name: "arole",
+						Run: &model.RoleRun{
+							Scaling: &model.RoleRunScaling{},
+							Command: []string{"/usr/bin/tini", "--", "/opt/fissile/run.sh"},
+						},
+					},
+				},
+				Configuration: &model.Configuration{},
+			},
+		}
+
+		node := MakeValues(settings)
+		require.NotNil(t, node)
+
+		entry := node.Get("sizing", "arole")
+		require.NotNil(t, entry)
+		command, ok := entry.Get("command").(*helm.List)
+		require.True(t, ok, "command should be a list")
+		require.Len(t, command.Values(), 3)
+		assert.Equal(t, "/usr/bin/tini", command.Values()[0].String())
+		assert.Equal(t, "~", entry.Get("args").String(), "Unset args default to nil")
+	})
+
+	t.Run("NodePort", func(t *testing.T) {
+		t.Parallel()
+		job := &model.JobReference{Job: &model.Job{Name: "tor"}, Name: "tor"}
+		job.ContainerProperties.BoshContainerization.Ports = []model.JobExposedPort{
+			{Name: "https", Public: true, Count: 1, Max: 1, NodePort: 30443},
+			{Name: "http", Public: true, Count: 1, Max: 1},
+		}
+		settings := ExportSettings{
+			RoleManifest: &model.RoleManifest{
+				InstanceGroups: model.InstanceGroups{
+					&model.InstanceGroup{
+						Name:          "arole",
+						JobReferences: model.JobReferences{job},
+						Run: &model.RoleRun{
+							Scaling: &model.RoleRunScaling{},
+						},
+					},
+				},
+				Configuration: &model.Configuration{},
+			},
+		}
+
+		node := MakeValues(settings)
+		require.NotNil(t, node)
+
+		assert.Equal(t, "30443", node.Get("sizing", "arole", "ports", "https", "node_port").String())
+		assert.Nil(t, node.Get("sizing", "arole", "ports", "http"), "Ports without configuration have no values")
+		assert.Equal(t, "false", node.Get("services", "node_port").String())
+	})
+
+	t.Run("DropCapabilities", func(t *testing.T) {
+		t.Parallel()
+		settings := ExportSettings{
+			RoleManifest: &model.RoleManifest{
+				InstanceGroups: model.InstanceGroups{
+					&model.InstanceGroup{
+						Name: "arole",
+						Run: &model.RoleRun{
+							Scaling:          &model.RoleRunScaling{},
+							DropCapabilities: true,
+						},
+					},
+					&model.InstanceGroup{
+						Name: "privileged",
+						Run: &model.RoleRun{
+							Scaling:    &model.RoleRunScaling{},
+							Privileged: true,
+						},
+					},
+				},
+				Configuration: &model.Configuration{},
+			},
+		}
+
+		node := MakeValues(settings)
+		require.NotNil(t, node)
+
+		assert.Equal(t, "true", node.Get("sizing", "arole", "drop_capabilities").String())
+		assert.Nil(t, node.Get("sizing", "privileged", "drop_capabilities"), "Privileged containers cannot drop capabilities")
+	})
+
 	t.Run("Check Default Registry", func(t *testing.T) {
 		t.Parallel()
 		settings := ExportSettings{
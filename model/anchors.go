@@ -0,0 +1,464 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/validation"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// anchorsKey is the key of the anchors in role manifests.
+//
+// Anchors are named fragments of instance groups, defined once in the
+// top-level `anchors` section of the role manifest and referenced by name from
+// the `anchors` list of instance groups (or of other anchors):
+//
+//	anchors:
+//	  small:
+//	    run:
+//	      memory: 256
+//	      scaling: {min: 1, max: 3}
+//	instance_groups:
+//	- name: api
+//	  anchors: [small]
+//
+// The referenced anchors are merged into the instance group in order, and the
+// instance group itself is merged last.  Mappings are merged recursively;
+// lists and all other values replace the earlier ones.  The `run` of anchors is
+// merged into the run of the first job of the instance group with
+// `properties.bosh_containerization.run`, or the first job if there is none.
+//
+// The anchors are expanded when the manifest is loaded.  The origin of every
+// value taken from an anchor is recorded, so that validation errors can point
+// at the anchor instead of the instance group; see AnnotateAnchorOrigins.
+const anchorsKey = "anchors"
+
+// expandedAnchor is an anchor merged with the anchors it references.
+type expandedAnchor struct {
+	values yaml.MapSlice
+	// origins maps the paths of values (relative to the anchor) to the name
+	// of the anchor they were defined in.
+	origins map[string]string
+}
+
+type anchorExpander struct {
+	definitions map[string]interface{}
+	// expanded holds the anchors expanded so far; nil for invalid anchors.
+	expanded map[string]*expandedAnchor
+	// expanding lists the anchors being expanded, to detect cycles.
+	expanding []string
+	// errs collects the errors of all anchors, reported once per anchor.
+	errs validation.ErrorList
+}
+
+// expandAnchors expands the anchors of the role manifest content.  It returns
+// the content unchanged if it does not use anchors, and the origins of values
+// taken from anchors by their path, like `instance_groups[api].run.memory`.
+func expandAnchors(content []byte) ([]byte, map[string]string, error) {
+	var document yaml.MapSlice
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, nil, err
+	}
+
+	definitions, hasAnchors := mapSliceValue(document, anchorsKey)
+	if !hasAnchors {
+		return content, nil, nil
+	}
+
+	e := &anchorExpander{
+		definitions: make(map[string]interface{}),
+		expanded:    make(map[string]*expandedAnchor),
+	}
+	allErrs := validation.ErrorList{}
+
+	if definitions != nil {
+		definitionMap, ok := definitions.(yaml.MapSlice)
+		if !ok {
+			return nil, nil, validation.ErrorList{validation.Invalid(anchorsKey, definitions, "must be a mapping of anchor names to fragments")}
+		}
+		for _, item := range definitionMap {
+			e.definitions[fmt.Sprintf("%v", item.Key)] = item.Value
+		}
+	}
+
+	origins := make(map[string]string)
+	instanceGroups, _ := mapSliceValue(document, "instance_groups")
+	instanceGroupList, _ := instanceGroups.([]interface{})
+	for i, instanceGroup := range instanceGroupList {
+		group, ok := instanceGroup.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+		name, _ := mapSliceValue(group, "name")
+		groupPath := fmt.Sprintf("instance_groups[%v]", name)
+
+		expanded, errs := e.expandFragment(group, "", groupPath)
+		if len(errs) > 0 {
+			allErrs = append(allErrs, errs...)
+			continue
+		}
+
+		values, errs := moveAnchorRun(expanded.values, groupPath, expanded.origins)
+		allErrs = append(allErrs, errs...)
+		instanceGroupList[i] = values
+
+		for path, origin := range expanded.origins {
+			origins[groupPath+"."+path] = origin
+		}
+	}
+
+	// Anchors which are not referenced are still checked
+	for _, name := range sortedAnchorNames(e.definitions) {
+		e.expand(name)
+	}
+	allErrs = append(e.errs, allErrs...)
+
+	if len(allErrs) > 0 {
+		return nil, nil, allErrs
+	}
+
+	document = removeMapSliceKey(document, anchorsKey)
+	expandedContent, err := yaml.Marshal(document)
+	if err != nil {
+		return nil, nil, err
+	}
+	return expandedContent, origins, nil
+}
+
+// expand returns the named anchor merged with the anchors it references, or
+// nil if the anchor is invalid.  The errors of the anchor are added to e.errs.
+func (e *anchorExpander) expand(name string) *expandedAnchor {
+	if expanded, ok := e.expanded[name]; ok {
+		return expanded
+	}
+
+	path := fmt.Sprintf("anchors[%s]", name)
+	for i, expanding := range e.expanding {
+		if expanding == name {
+			cycle := append(append([]string{}, e.expanding[i:]...), name)
+			e.errs = append(e.errs, validation.Invalid(path+"."+anchorsKey, name,
+				"cyclic anchor references: "+strings.Join(cycle, " -> ")))
+			return nil
+		}
+	}
+
+	definition, ok := e.definitions[name].(yaml.MapSlice)
+	if !ok {
+		e.errs = append(e.errs, validation.Invalid(path, e.definitions[name], "must be a mapping"))
+		e.expanded[name] = nil
+		return nil
+	}
+
+	e.expanding = append(e.expanding, name)
+	expanded, errs := e.expandFragment(definition, name, path)
+	e.expanding = e.expanding[:len(e.expanding)-1]
+	e.errs = append(e.errs, errs...)
+
+	e.expanded[name] = expanded
+	return expanded
+}
+
+// expandFragment merges the anchors referenced by the fragment (an instance
+// group or an anchor) and then the fragment itself.  The origin is the name
+// of the anchor being expanded, or empty for instance groups.
+func (e *anchorExpander) expandFragment(fragment yaml.MapSlice, origin, path string) (*expandedAnchor, validation.ErrorList) {
+	result := &expandedAnchor{values: yaml.MapSlice{}, origins: make(map[string]string)}
+	allErrs := validation.ErrorList{}
+
+	references, _ := mapSliceValue(fragment, anchorsKey)
+	var names []string
+	switch references := references.(type) {
+	case nil:
+	case []interface{}:
+		for i, reference := range references {
+			name, ok := reference.(string)
+			if !ok {
+				allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("%s.anchors[%d]", path, i), reference, "must be the name of an anchor"))
+				continue
+			}
+			if _, ok := e.definitions[name]; !ok {
+				allErrs = append(allErrs, validation.NotFound(fmt.Sprintf("%s.anchors[%d]", path, i), name))
+				continue
+			}
+			names = append(names, name)
+		}
+	default:
+		allErrs = append(allErrs, validation.Invalid(path+"."+anchorsKey, references, "must be a list of anchor names"))
+	}
+
+	for _, name := range names {
+		referenced := e.expand(name)
+		if referenced == nil {
+			// The errors of the anchor are reported for the anchor itself
+			allErrs = append(allErrs, validation.Invalid(path+"."+anchorsKey, name, "references an invalid anchor"))
+			continue
+		}
+		// The referenced anchor keeps the origins of its own values
+		values := copyAnchorValue(referenced.values).(yaml.MapSlice)
+		errs := mergeAnchorValues(result, values, "", "", path)
+		for valuePath, valueOrigin := range referenced.origins {
+			result.origins[valuePath] = valueOrigin
+		}
+		allErrs = append(allErrs, errs...)
+	}
+	if len(allErrs) > 0 {
+		return nil, allErrs
+	}
+
+	own := copyAnchorValue(removeMapSliceKey(fragment, anchorsKey)).(yaml.MapSlice)
+	allErrs = append(allErrs, mergeAnchorValues(result, own, origin, "", path)...)
+	if len(allErrs) > 0 {
+		return nil, allErrs
+	}
+	return result, nil
+}
+
+// mergeAnchorValues merges src into the values of dst at the relative path
+// prefix, recording the origin of the merged values.
+func mergeAnchorValues(dst *expandedAnchor, src yaml.MapSlice, origin, prefix, path string) validation.ErrorList {
+	merged, errs := mergeAnchorMapping(dst.values, src, origin, prefix, path, dst.origins)
+	dst.values = merged
+	return errs
+}
+
+func mergeAnchorMapping(dst, src yaml.MapSlice, origin, prefix, path string, origins map[string]string) (yaml.MapSlice, validation.ErrorList) {
+	allErrs := validation.ErrorList{}
+	for _, item := range src {
+		key := fmt.Sprintf("%v", item.Key)
+		itemPath := key
+		if prefix != "" {
+			itemPath = prefix + "." + key
+		}
+
+		index := -1
+		for i, existing := range dst {
+			if fmt.Sprintf("%v", existing.Key) == key {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			dst = append(dst, item)
+			setAnchorOrigin(origins, itemPath, origin, item.Value)
+			continue
+		}
+
+		dstMapping, dstIsMapping := dst[index].Value.(yaml.MapSlice)
+		srcMapping, srcIsMapping := item.Value.(yaml.MapSlice)
+		if dstIsMapping && srcIsMapping {
+			merged, errs := mergeAnchorMapping(dstMapping, srcMapping, origin, itemPath, path, origins)
+			dst[index].Value = merged
+			allErrs = append(allErrs, errs...)
+			continue
+		}
+		if (dstIsMapping || srcIsMapping) && dst[index].Value != nil && item.Value != nil {
+			detail := "cannot be merged with a mapping"
+			if from := anchorOrigin(origins, itemPath); from != "" {
+				detail += " from anchors[" + from + "]"
+			}
+			allErrs = append(allErrs, validation.Invalid(path+"."+itemPath, item.Value, detail))
+			continue
+		}
+		dst[index].Value = item.Value
+		setAnchorOrigin(origins, itemPath, origin, item.Value)
+	}
+	return dst, allErrs
+}
+
+// setAnchorOrigin records the origin of the value at the path, replacing the
+// origins of the values it replaced.  Origins are recorded for the values in
+// mappings, so that they stay correct when parts of a mapping are replaced.
+func setAnchorOrigin(origins map[string]string, path, origin string, value interface{}) {
+	for existing := range origins {
+		if anchorPathContains(path, existing) {
+			delete(origins, existing)
+		}
+	}
+	if origin == "" {
+		return
+	}
+	if mapping, ok := value.(yaml.MapSlice); ok && len(mapping) > 0 {
+		for _, item := range mapping {
+			setAnchorOrigin(origins, fmt.Sprintf("%s.%v", path, item.Key), origin, item.Value)
+		}
+		return
+	}
+	origins[path] = origin
+}
+
+// anchorOrigin returns the anchor that defined the value at the path (or any
+// of its children), or an empty string.
+func anchorOrigin(origins map[string]string, path string) string {
+	paths := make([]string, 0, len(origins))
+	for existing := range origins {
+		if anchorPathContains(path, existing) || anchorPathContains(existing, path) {
+			paths = append(paths, existing)
+		}
+	}
+	if len(paths) == 0 {
+		return ""
+	}
+	sort.Strings(paths)
+	return origins[paths[0]]
+}
+
+// anchorPathContains returns whether the path is the parent path, or one of
+// its children.
+func anchorPathContains(parent, path string) bool {
+	if !strings.HasPrefix(path, parent) {
+		return false
+	}
+	rest := path[len(parent):]
+	return rest == "" || strings.HasPrefix(rest, ".") || strings.HasPrefix(rest, "[")
+}
+
+// moveAnchorRun moves the `run` merged from anchors into the job that holds
+// the run of the instance group.
+func moveAnchorRun(group yaml.MapSlice, groupPath string, origins map[string]string) (yaml.MapSlice, validation.ErrorList) {
+	run, hasRun := mapSliceValue(group, "run")
+	if !hasRun {
+		return group, nil
+	}
+	group = removeMapSliceKey(group, "run")
+
+	jobs, _ := mapSliceValue(group, "jobs")
+	jobList, _ := jobs.([]interface{})
+	target := -1
+	for i, job := range jobList {
+		jobMapping, ok := job.(yaml.MapSlice)
+		if !ok {
+			continue
+		}
+		if target < 0 {
+			target = i
+		}
+		if _, ok := mapSliceValue(jobMapping, "properties", "bosh_containerization", "run"); ok {
+			target = i
+			break
+		}
+	}
+	if target < 0 {
+		return group, validation.ErrorList{validation.Required(groupPath+".jobs", "a job is needed for the run of the anchors")}
+	}
+
+	runMapping, ok := run.(yaml.MapSlice)
+	if !ok {
+		return group, validation.ErrorList{validation.Invalid(groupPath+".run", run, "must be a mapping")}
+	}
+
+	job := jobList[target].(yaml.MapSlice)
+	jobRun, _ := mapSliceValue(job, "properties", "bosh_containerization", "run")
+	if jobRunMapping, ok := jobRun.(yaml.MapSlice); ok {
+		// The run of the job takes precedence
+		var errs validation.ErrorList
+		runMapping, errs = mergeAnchorMapping(runMapping, jobRunMapping, "", "run", groupPath, origins)
+		if len(errs) > 0 {
+			return group, errs
+		}
+	}
+	jobList[target] = setMapSliceValue(job, runMapping, "properties", "bosh_containerization", "run")
+	return group, nil
+}
+
+// AnnotateAnchorOrigins adds the anchor that defined the offending value to
+// the details of the errors, for values which were taken from anchors.
+func (m *RoleManifest) AnnotateAnchorOrigins(allErrs validation.ErrorList) validation.ErrorList {
+	if len(m.AnchorOrigins) == 0 {
+		return allErrs
+	}
+
+	for _, err := range allErrs {
+		origin := anchorOrigin(m.AnchorOrigins, err.Field)
+		if origin == "" {
+			continue
+		}
+		note := fmt.Sprintf("(from anchors[%s])", origin)
+		if err.Detail == "" {
+			err.Detail = note
+		} else {
+			err.Detail += " " + note
+		}
+	}
+	return allErrs
+}
+
+func sortedAnchorNames(definitions map[string]interface{}) []string {
+	names := make([]string, 0, len(definitions))
+	for name := range definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mapSliceValue returns the value at the path of keys in nested mappings.
+func mapSliceValue(mapping yaml.MapSlice, keys ...string) (interface{}, bool) {
+	for _, item := range mapping {
+		if fmt.Sprintf("%v", item.Key) != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			return item.Value, true
+		}
+		child, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			return nil, false
+		}
+		return mapSliceValue(child, keys[1:]...)
+	}
+	return nil, false
+}
+
+// setMapSliceValue sets the value at the path of keys, creating mappings as
+// needed.
+func setMapSliceValue(mapping yaml.MapSlice, value interface{}, keys ...string) yaml.MapSlice {
+	for i, item := range mapping {
+		if fmt.Sprintf("%v", item.Key) != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			mapping[i].Value = value
+		} else {
+			child, _ := item.Value.(yaml.MapSlice)
+			mapping[i].Value = setMapSliceValue(child, value, keys[1:]...)
+		}
+		return mapping
+	}
+	if len(keys) == 1 {
+		return append(mapping, yaml.MapItem{Key: keys[0], Value: value})
+	}
+	return append(mapping, yaml.MapItem{Key: keys[0], Value: setMapSliceValue(nil, value, keys[1:]...)})
+}
+
+func removeMapSliceKey(mapping yaml.MapSlice, key string) yaml.MapSlice {
+	result := make(yaml.MapSlice, 0, len(mapping))
+	for _, item := range mapping {
+		if fmt.Sprintf("%v", item.Key) != key {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// copyAnchorValue returns a deep copy of the value, so that anchors used by
+// several instance groups are not modified by merging.
+func copyAnchorValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case yaml.MapSlice:
+		result := make(yaml.MapSlice, len(value))
+		for i, item := range value {
+			result[i] = yaml.MapItem{Key: item.Key, Value: copyAnchorValue(item.Value)}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, element := range value {
+			result[i] = copyAnchorValue(element)
+		}
+		return result
+	default:
+		return value
+	}
+}
@@ -0,0 +1,148 @@
+package model
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/fissile/validation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestExpandAnchorsWithoutAnchors(t *testing.T) {
+	content := []byte("instance_groups:\n- name: myrole\n")
+	expanded, origins, err := expandAnchors(content)
+	require.NoError(t, err)
+	assert.Equal(t, content, expanded)
+	assert.Empty(t, origins)
+}
+
+func TestExpandAnchors(t *testing.T) {
+	assert := assert.New(t)
+
+	expanded, origins, err := expandAnchors([]byte(`---
+anchors:
+  base:
+    run:
+      memory: 128
+      scaling: {min: 1, max: 3}
+    tags: [one]
+  derived:
+    anchors: [base]
+    run:
+      scaling: {max: 4}
+    configuration:
+      templates:
+        properties.a: b
+instance_groups:
+- name: first
+  anchors: [derived]
+  tags: [two]
+  jobs:
+  - name: without-run
+  - name: with-run
+    properties:
+      bosh_containerization:
+        run:
+          memory: 256
+- name: second
+  anchors: [base]
+  jobs:
+  - name: job
+`))
+	require.NoError(t, err)
+
+	var actual interface{}
+	require.NoError(t, yaml.Unmarshal(expanded, &actual))
+	var expected interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(`---
+instance_groups:
+- name: first
+  tags: [two]
+  jobs:
+  - name: without-run
+  - name: with-run
+    properties:
+      bosh_containerization:
+        run:
+          memory: 256
+          scaling: {min: 1, max: 4}
+  configuration:
+    templates:
+      properties.a: b
+- name: second
+  tags: [one]
+  jobs:
+  - name: job
+    properties:
+      bosh_containerization:
+        run:
+          memory: 128
+          scaling: {min: 1, max: 3}
+`), &expected))
+	assert.Equal(expected, actual)
+
+	assert.Equal(map[string]string{
+		"instance_groups[first].run.scaling.min":                      "base",
+		"instance_groups[first].run.scaling.max":                      "derived",
+		"instance_groups[first].configuration.templates.properties.a": "derived",
+		"instance_groups[second].run.memory":                          "base",
+		"instance_groups[second].run.scaling.min":                     "base",
+		"instance_groups[second].run.scaling.max":                     "base",
+		"instance_groups[second].tags":                                "base",
+	}, origins)
+}
+
+func TestExpandAnchorsErrors(t *testing.T) {
+	_, _, err := expandAnchors([]byte(`---
+anchors:
+  first:
+    anchors: [second]
+  second:
+    anchors: [first]
+  mapping:
+    run:
+      scaling: {min: 1}
+  scalar: 42
+instance_groups:
+- name: myrole
+  anchors: [missing, scalar]
+- name: conflict
+  anchors: [mapping]
+  run:
+    scaling: 3
+- name: nojobs
+  anchors: [mapping]
+`))
+	require.IsType(t, validation.ErrorList{}, err)
+	assert.Equal(t, []string{
+		`anchors[scalar]: Invalid value: 42: must be a mapping`,
+		`anchors[first].anchors: Invalid value: "first": cyclic anchor references: first -> second -> first`,
+		`anchors[second].anchors: Invalid value: "first": references an invalid anchor`,
+		`anchors[first].anchors: Invalid value: "second": references an invalid anchor`,
+		`instance_groups[myrole].anchors[0]: Not found: "missing"`,
+		`instance_groups[myrole].anchors: Invalid value: "scalar": references an invalid anchor`,
+		`instance_groups[conflict].run.scaling: Invalid value: 3: cannot be merged with a mapping from anchors[mapping]`,
+		`instance_groups[nojobs].jobs: Required value: a job is needed for the run of the anchors`,
+	}, err.(validation.ErrorList).ErrorStrings())
+}
+
+func TestAnnotateAnchorOrigins(t *testing.T) {
+	m := NewRoleManifest()
+	m.AnchorOrigins = map[string]string{
+		"instance_groups[myrole].run.memory":  "small",
+		"instance_groups[myrole].run.volumes": "storage",
+	}
+	errs := m.AnnotateAnchorOrigins(validation.ErrorList{
+		validation.Invalid("instance_groups[myrole].run.memory", -10, "must be positive"),
+		validation.Required("instance_groups[myrole].run.volumes[data]", ""),
+		validation.Invalid("instance_groups[myrole].run.mem.request", -10, "must be positive"),
+		validation.Invalid("instance_groups[myrole].run.memoryx", -10, ""),
+	})
+	assert.Equal(t, []string{
+		"instance_groups[myrole].run.memory: Invalid value: -10: must be positive (from anchors[small])",
+		"instance_groups[myrole].run.volumes[data]: Required value: (from anchors[storage])",
+		"instance_groups[myrole].run.mem.request: Invalid value: -10: must be positive",
+		"instance_groups[myrole].run.memoryx: Invalid value: -10",
+	}, errs.ErrorStrings())
+}
@@ -0,0 +1,206 @@
+package model
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// CompilationConfig contains settings used when compiling BOSH packages.
+// Environment variables listed under Env are passed to every compilation;
+// those listed under a package name are only passed to that package and
+// take precedence over the global ones.  Packages matching an entry of
+// Isolation are compiled with its settings.  Verify is a script, relative to
+// the role manifest, run against the output of every compiled package;
+// packages may have a script of their own instead.
+type CompilationConfig struct {
+	Env       map[string]string                    `yaml:"env,omitempty"`
+	Packages  map[string]*PackageCompilationConfig `yaml:"packages,omitempty"`
+	Isolation []*CompilationIsolation              `yaml:"isolation,omitempty"`
+	Verify    string                               `yaml:"verify,omitempty"`
+}
+
+// CompilationIsolation contains the settings for compiling the packages
+// whose release and package names match the glob patterns Release and
+// Packages (empty patterns match all names): at most MaxParallel of them are
+// compiled at the same time (no cap if zero), and with docker, in containers
+// using NetworkMode instead of the one given on the command line.
+type CompilationIsolation struct {
+	Release     string `yaml:"release,omitempty"`
+	Packages    string `yaml:"packages,omitempty"`
+	MaxParallel int    `yaml:"max_parallel,omitempty"`
+	NetworkMode string `yaml:"network_mode,omitempty"`
+}
+
+// PackageCompilationConfig contains the compilation settings for a single package
+type PackageCompilationConfig struct {
+	Env    map[string]string `yaml:"env,omitempty"`
+	Verify string            `yaml:"verify,omitempty"`
+}
+
+// compilationProxyVars are environment variables that only affect how
+// sources are fetched, not the compiled output, so they are not recorded
+// in the package fingerprint.
+var compilationProxyVars = map[string]struct{}{
+	"http_proxy":  {},
+	"https_proxy": {},
+	"no_proxy":    {},
+	"ftp_proxy":   {},
+}
+
+// IsCompilationProxyVar returns true if the named environment variable is a
+// proxy setting that does not influence the compiled package.
+func IsCompilationProxyVar(name string) bool {
+	_, ok := compilationProxyVars[strings.ToLower(name)]
+	return ok
+}
+
+// PackageEnv returns the merged compilation environment for the named
+// package, with the package specific values overriding the global ones.
+func (c *CompilationConfig) PackageEnv(packageName string) map[string]string {
+	if c == nil {
+		return nil
+	}
+	env := make(map[string]string, len(c.Env))
+	for name, value := range c.Env {
+		env[name] = value
+	}
+	if pkgConfig, ok := c.Packages[packageName]; ok && pkgConfig != nil {
+		for name, value := range pkgConfig.Env {
+			env[name] = value
+		}
+	}
+	if len(env) == 0 {
+		return nil
+	}
+	return env
+}
+
+// PackageVerifyScript returns the verification script of the role manifest
+// for the named package, as given, or an empty string if there is none.
+func (c *CompilationConfig) PackageVerifyScript(packageName string) string {
+	if c == nil {
+		return ""
+	}
+	if pkgConfig, ok := c.Packages[packageName]; ok && pkgConfig != nil && pkgConfig.Verify != "" {
+		return pkgConfig.Verify
+	}
+	return c.Verify
+}
+
+// Matches returns true if the isolation settings apply to the package.
+// Invalid patterns match nothing.
+func (i *CompilationIsolation) Matches(pkg *Package) bool {
+	match := func(pattern, name string) bool {
+		if pattern == "" {
+			return true
+		}
+		matched, err := path.Match(pattern, name)
+		return err == nil && matched
+	}
+	return match(i.Release, pkg.Release.Name) && match(i.Packages, pkg.Name)
+}
+
+// PackageIsolation returns the first isolation settings matching the
+// package, or nil if there are none.
+func (c *CompilationConfig) PackageIsolation(pkg *Package) *CompilationIsolation {
+	if c == nil {
+		return nil
+	}
+	for _, isolation := range c.Isolation {
+		if isolation != nil && isolation.Matches(pkg) {
+			return isolation
+		}
+	}
+	return nil
+}
+
+// SetCompilationEnv records the environment to use when compiling the
+// package.  Any variables which may affect the compiled output are folded
+// into the package fingerprint, so that packages compiled with different
+// settings do not share a compilation or cache entry.  The fingerprints of
+// the packages depending on it must then be updated with
+// UpdateCompilationFingerprints.
+func (p *Package) SetCompilationEnv(env map[string]string) {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if p.sourceFingerprint == "" {
+		p.sourceFingerprint = p.Fingerprint
+	}
+
+	p.CompilationEnv = make([]string, 0, len(names))
+	hasher := sha1.New()
+	hasher.Write([]byte(p.sourceFingerprint))
+	affectsOutput := false
+	for _, name := range names {
+		p.CompilationEnv = append(p.CompilationEnv, fmt.Sprintf("%s=%s", name, env[name]))
+		if IsCompilationProxyVar(name) {
+			continue
+		}
+		affectsOutput = true
+		hasher.Write([]byte(fmt.Sprintf("\000%s=%s", name, env[name])))
+	}
+
+	if affectsOutput {
+		p.envFingerprint = hex.EncodeToString(hasher.Sum(nil))
+	} else {
+		p.envFingerprint = p.sourceFingerprint
+	}
+	p.Fingerprint = p.envFingerprint
+}
+
+// UpdateCompilationFingerprints folds the fingerprints of the dependencies
+// of the packages into the fingerprints of the packages depending on them,
+// in dependency order.  Packages are compiled against their compiled
+// dependencies, so a dependency compiled with a different environment
+// changes the packages depending on it as well.  Packages whose dependencies
+// all keep the fingerprint of their release only have their own environment
+// folded in.
+func UpdateCompilationFingerprints(packages Packages) {
+	done := make(map[*Package]bool)
+	var update func(p *Package)
+	update = func(p *Package) {
+		if done[p] {
+			return
+		}
+		done[p] = true
+
+		if p.sourceFingerprint == "" {
+			p.sourceFingerprint = p.Fingerprint
+		}
+		if p.envFingerprint == "" {
+			p.envFingerprint = p.sourceFingerprint
+		}
+
+		var changed []*Package
+		for _, dependency := range p.Dependencies {
+			update(dependency)
+			if dependency.Fingerprint != dependency.sourceFingerprint {
+				changed = append(changed, dependency)
+			}
+		}
+		if len(changed) == 0 {
+			p.Fingerprint = p.envFingerprint
+			return
+		}
+
+		sort.Slice(changed, func(i, j int) bool { return changed[i].Name < changed[j].Name })
+		hasher := sha1.New()
+		hasher.Write([]byte(p.envFingerprint))
+		for _, dependency := range changed {
+			hasher.Write([]byte(fmt.Sprintf("\000%s:%s", dependency.Name, dependency.Fingerprint)))
+		}
+		p.Fingerprint = hex.EncodeToString(hasher.Sum(nil))
+	}
+
+	for _, p := range packages {
+		update(p)
+	}
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompilationConfigPackageEnv(t *testing.T) {
+	t.Parallel()
+
+	var nilConfig *CompilationConfig
+	assert.Nil(t, nilConfig.PackageEnv("foo"))
+
+	config := &CompilationConfig{
+		Env: map[string]string{"A": "global", "B": "global"},
+		Packages: map[string]*PackageCompilationConfig{
+			"foo": {Env: map[string]string{"B": "foo"}},
+		},
+	}
+	assert.Equal(t, map[string]string{"A": "global", "B": "foo"}, config.PackageEnv("foo"))
+	assert.Equal(t, map[string]string{"A": "global", "B": "global"}, config.PackageEnv("bar"))
+	assert.Nil(t, (&CompilationConfig{}).PackageEnv("foo"))
+}
+
+func TestPackageSetCompilationEnv(t *testing.T) {
+	t.Parallel()
+
+	t.Run("proxy settings keep the fingerprint", func(t *testing.T) {
+		t.Parallel()
+		pkg := &Package{Fingerprint: "abc"}
+		pkg.SetCompilationEnv(map[string]string{"https_proxy": "http://proxy", "NO_PROXY": "localhost"})
+		assert.Equal(t, "abc", pkg.Fingerprint)
+		assert.Equal(t, []string{"NO_PROXY=localhost", "https_proxy=http://proxy"}, pkg.CompilationEnv)
+	})
+
+	t.Run("other settings change the fingerprint", func(t *testing.T) {
+		t.Parallel()
+		pkg := &Package{Fingerprint: "abc"}
+		pkg.SetCompilationEnv(map[string]string{"CFLAGS": "-O2"})
+		changed := pkg.Fingerprint
+		assert.NotEqual(t, "abc", changed)
+
+		// Applying the same settings again must be stable
+		pkg.SetCompilationEnv(map[string]string{"CFLAGS": "-O2"})
+		assert.Equal(t, changed, pkg.Fingerprint)
+
+		pkg.SetCompilationEnv(map[string]string{"CFLAGS": "-O3"})
+		assert.NotEqual(t, changed, pkg.Fingerprint)
+
+		pkg.SetCompilationEnv(nil)
+		assert.Equal(t, "abc", pkg.Fingerprint)
+	})
+}
+
+func TestUpdateCompilationFingerprints(t *testing.T) {
+	t.Parallel()
+
+	libevent := &Package{Name: "libevent", Fingerprint: "libevent"}
+	tor := &Package{Name: "tor", Fingerprint: "tor", Dependencies: Packages{libevent}}
+	client := &Package{Name: "client", Fingerprint: "client", Dependencies: Packages{tor}}
+	other := &Package{Name: "other", Fingerprint: "other"}
+	packages := Packages{client, tor, libevent, other}
+
+	UpdateCompilationFingerprints(packages)
+	for _, pkg := range packages {
+		assert.Equal(t, pkg.Name, pkg.Fingerprint, "Without settings the fingerprint of %s is kept", pkg.Name)
+	}
+
+	libevent.SetCompilationEnv(map[string]string{"CFLAGS": "-O2"})
+	UpdateCompilationFingerprints(packages)
+	assert.NotEqual(t, "libevent", libevent.Fingerprint)
+	assert.NotEqual(t, "tor", tor.Fingerprint, "The dependent package changes with its dependency")
+	assert.NotEqual(t, "client", client.Fingerprint, "Transitive dependents change too")
+	assert.Equal(t, "other", other.Fingerprint)
+
+	// Updating again must be stable
+	fingerprints := []string{client.Fingerprint, tor.Fingerprint, libevent.Fingerprint}
+	UpdateCompilationFingerprints(packages)
+	assert.Equal(t, fingerprints, []string{client.Fingerprint, tor.Fingerprint, libevent.Fingerprint})
+
+	libevent.SetCompilationEnv(map[string]string{"CFLAGS": "-O3"})
+	UpdateCompilationFingerprints(packages)
+	assert.NotEqual(t, fingerprints[0], client.Fingerprint)
+	assert.NotEqual(t, fingerprints[1], tor.Fingerprint)
+
+	libevent.SetCompilationEnv(nil)
+	UpdateCompilationFingerprints(packages)
+	for _, pkg := range packages {
+		assert.Equal(t, pkg.Name, pkg.Fingerprint, "Without settings the fingerprint of %s is restored", pkg.Name)
+	}
+}
+
+func TestCompilationConfigPackageIsolation(t *testing.T) {
+	t.Parallel()
+
+	release := &Release{Name: "cf-mysql"}
+	galera := &Package{Name: "galera", Release: release}
+	golang := &Package{Name: "golang-1.11", Release: &Release{Name: "routing"}}
+
+	var nilConfig *CompilationConfig
+	assert.Nil(t, nilConfig.PackageIsolation(galera))
+
+	config := &CompilationConfig{
+		Isolation: []*CompilationIsolation{
+			{Release: "cf-mysql", MaxParallel: 1},
+			{Packages: "golang-*", NetworkMode: "host"},
+			{Release: "*", MaxParallel: 4},
+		},
+	}
+	assert.Equal(t, config.Isolation[0], config.PackageIsolation(galera))
+	assert.Equal(t, config.Isolation[1], config.PackageIsolation(golang), "The first matching settings apply")
+	assert.Equal(t, config.Isolation[2], config.PackageIsolation(&Package{Name: "nginx", Release: &Release{Name: "nginx"}}))
+	assert.Nil(t, (&CompilationConfig{}).PackageIsolation(galera))
+}
+
+func TestCompilationConfigPackageVerifyScript(t *testing.T) {
+	t.Parallel()
+
+	var nilConfig *CompilationConfig
+	assert.Empty(t, nilConfig.PackageVerifyScript("foo"))
+
+	config := &CompilationConfig{
+		Verify: "verify.sh",
+		Packages: map[string]*PackageCompilationConfig{
+			"foo": {Verify: "verify-foo.sh"},
+			"bar": {Env: map[string]string{"A": "bar"}},
+		},
+	}
+	assert.Equal(t, "verify-foo.sh", config.PackageVerifyScript("foo"))
+	assert.Equal(t, "verify.sh", config.PackageVerifyScript("bar"))
+	assert.Equal(t, "verify.sh", config.PackageVerifyScript("baz"))
+	assert.Empty(t, (&CompilationConfig{}).PackageVerifyScript("foo"))
+}
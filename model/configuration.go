@@ -9,8 +9,80 @@ import (
 // resulting images
 type Configuration struct {
 	Authorization ConfigurationAuthorization       `yaml:"auth,omitempty"`
+	Metadata      ConfigurationMetadata            `yaml:"metadata,omitempty"`
 	RawTemplates  yaml.MapSlice                    `yaml:"templates"`
 	Templates     map[string]ConfigurationTemplate `yaml:"-"`
+	Budget        *ResourceBudget                  `yaml:"budget,omitempty"`      // Budget of the resource requests of all instance groups
+	HABudget      *ResourceBudget                  `yaml:"ha-budget,omitempty"`   // Budget at HA sizing, if different
+	LogSidecar    LogSidecar                       `yaml:"log-sidecar,omitempty"` // Sidecar forwarding the log files of the jobs
+}
+
+// LogSidecar is the kind of sidecar added to the pods of the instance groups
+// to get the log files of the jobs to the logging stack of the cluster
+type LogSidecar string
+
+// These are the log sidecars
+const (
+	LogSidecarNone      = LogSidecar("")          // No sidecar
+	LogSidecarTail      = LogSidecar("tail")      // Prints the log files to the standard output of the sidecar
+	LogSidecarForwarder = LogSidecar("forwarder") // Ships the log files with fluent-bit
+)
+
+// These are the resource requests and limits of the log sidecar containers,
+// in MiB and cores
+const (
+	LogSidecarMemoryRequest = int64(16)
+	LogSidecarMemoryLimit   = int64(64)
+	LogSidecarCPURequest    = 0.01
+	LogSidecarCPULimit      = 0.1
+)
+
+// ResourceBudget is the overall memory (in MiB) and CPU (in cores) the
+// instance groups of the role manifest may request together
+type ResourceBudget struct {
+	Memory *int64   `json:"memory,omitempty" yaml:"memory,omitempty"`
+	CPU    *float64 `json:"cpu,omitempty" yaml:"cpu,omitempty"`
+}
+
+// ObjectMetadata are the extra labels and annotations of generated kube
+// objects
+type ObjectMetadata struct {
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// ConfigurationMetadata defines Configuration.Metadata: the extra labels and
+// annotations of all generated kube objects, and of the objects of a kind
+// (e.g. Service).  The kind specific metadata takes precedence.
+type ConfigurationMetadata struct {
+	ObjectMetadata `yaml:",inline"`
+	Kinds          map[string]ObjectMetadata `yaml:"kinds,omitempty"`
+}
+
+// ForKind returns the extra labels and annotations of the objects of the
+// given kind
+func (m ConfigurationMetadata) ForKind(kind string) ObjectMetadata {
+	result := ObjectMetadata{}
+	result.Merge(m.ObjectMetadata)
+	result.Merge(m.Kinds[kind])
+	return result
+}
+
+// Merge adds the labels and annotations of other, replacing existing ones
+// of the same name
+func (m *ObjectMetadata) Merge(other ObjectMetadata) {
+	for key, value := range other.Labels {
+		if m.Labels == nil {
+			m.Labels = make(map[string]string)
+		}
+		m.Labels[key] = value
+	}
+	for key, value := range other.Annotations {
+		if m.Annotations == nil {
+			m.Annotations = make(map[string]string)
+		}
+		m.Annotations[key] = value
+	}
 }
 
 // ConfigurationTemplate contains one entry in a configuration template; this is
@@ -28,12 +100,25 @@ func (t ConfigurationTemplate) MarshalYAML() (interface{}, error) {
 
 // ConfigurationAuthorization defines Configuration.Authorization
 type ConfigurationAuthorization struct {
-	RoleUsedBy          map[string]map[string]struct{} `yaml:"-"`
-	Roles               map[string]AuthRole            `yaml:"roles,omitempty"`
-	ClusterRoles        map[string]AuthRole            `yaml:"cluster-roles,omitempty"`
-	ClusterRoleUsedBy   map[string]map[string]struct{} `yaml:"-"`
-	PodSecurityPolicies map[string]*PodSecurityPolicy  `yaml:"pod-security-policies,omitempty"`
-	Accounts            map[string]AuthAccount         `yaml:"accounts,omitempty"`
+	RoleUsedBy             map[string]map[string]struct{} `yaml:"-"`
+	Roles                  map[string]AuthRole            `yaml:"roles,omitempty"`
+	ClusterRoles           map[string]AuthRole            `yaml:"cluster-roles,omitempty"`
+	ClusterRoleUsedBy      map[string]map[string]struct{} `yaml:"-"`
+	PodSecurityPolicies    map[string]*PodSecurityPolicy  `yaml:"pod-security-policies,omitempty"`
+	Accounts               map[string]AuthAccount         `yaml:"accounts,omitempty"`
+	RuleSets               map[string]AuthRole            `yaml:"rule-sets,omitempty"`                // Rules shared by roles and cluster roles
+	AggregatedClusterRoles map[string]AuthAggregation     `yaml:"aggregated-cluster-roles,omitempty"` // Cluster roles whose rules Kubernetes aggregates
+	ClusterRoleLabels      map[string]map[string]string   `yaml:"cluster-role-labels,omitempty"`      // Labels of cluster roles, for aggregation
+}
+
+// IsClusterRole returns true if there is a cluster role of the given name,
+// aggregated or not
+func (auth *ConfigurationAuthorization) IsClusterRole(name string) bool {
+	if _, ok := auth.ClusterRoles[name]; ok {
+		return true
+	}
+	_, ok := auth.AggregatedClusterRoles[name]
+	return ok
 }
 
 // Notes: It was decided to use a separate `RoleUse` map to hold the
@@ -41,12 +126,15 @@ type ConfigurationAuthorization struct {
 // yaml.  Going to a structure for AuthRole, with a new field for the
 // counter would change the structure of the yaml as well.
 
-// An AuthRule is a single rule for a RBAC authorization role
+// An AuthRule is a single rule for a RBAC authorization role.  A rule with
+// only RuleSet set stands for the rules of that rule set; the resolver
+// replaces it with them.
 type AuthRule struct {
 	APIGroups     []string `yaml:"apiGroups"`
 	Resources     []string `yaml:"resources"`
 	ResourceNames []string `yaml:"resourceNames"`
 	Verbs         []string `yaml:"verbs"`
+	RuleSet       string   `yaml:"rule-set,omitempty"`
 }
 
 // IsPodSecurityPolicyRule checks if the rule is a pod security policy rule
@@ -73,6 +161,13 @@ func (rule *AuthRule) IsPodSecurityPolicyRule() bool {
 // An AuthRole is a role for RBAC authorization
 type AuthRole []AuthRule
 
+// AuthAggregation describes an aggregated cluster role: Kubernetes fills in
+// its rules from all cluster roles matching any of the selectors, each a set
+// of labels
+type AuthAggregation struct {
+	Selectors []map[string]string `yaml:"selectors"`
+}
+
 // An AuthAccount is a service account for RBAC authorization
 // The NumGroups field records the number of instance groups
 // referencing the account in question.
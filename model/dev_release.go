@@ -69,6 +69,14 @@ func NewDevRelease(path, releaseName, version, boshCacheDir string) (*Release, e
 	return release, nil
 }
 
+// DefaultDevReleaseName returns the name of the dev release in the release
+// directory at path when no name is given: the dev name configured in
+// config/dev.yml, or the final name in config/final.yml.
+func DefaultDevReleaseName(path string) (string, error) {
+	release := &Release{Path: path}
+	return release.getDefaultDevReleaseName()
+}
+
 func (r *Release) getDefaultDevReleaseName() (ver string, err error) {
 	var releaseConfig map[interface{}]interface{}
 	var name string
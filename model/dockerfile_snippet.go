@@ -0,0 +1,97 @@
+package model
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DockerfileSnippet is a fragment appended to the generated Dockerfile of an
+// instance group: environment variables, files copied from the assets
+// directory of the instance group, and commands run while building the image,
+// in that order.
+type DockerfileSnippet struct {
+	Assets string            `yaml:"assets,omitempty"` // Directory of the assets, relative to the role manifest
+	Env    map[string]string `yaml:"env,omitempty"`
+	Copy   []DockerfileCopy  `yaml:"copy,omitempty"`
+	Run    []string          `yaml:"run,omitempty"`
+}
+
+// DockerfileCopy is a file or directory of the assets directory copied into
+// the image
+type DockerfileCopy struct {
+	Source      string `yaml:"source"`      // Path relative to the assets directory
+	Destination string `yaml:"destination"` // Absolute path in the image
+}
+
+// DockerfileAssetsDir is the directory of the docker build context holding
+// the assets of the Dockerfile snippet
+const DockerfileAssetsDir = "assets"
+
+// GetDockerfileAssetsPath returns the path of the assets directory of the
+// Dockerfile snippet of the instance group, or the empty string if it has none
+func (g *InstanceGroup) GetDockerfileAssetsPath() string {
+	if g.Dockerfile == nil || g.Dockerfile.Assets == "" {
+		return ""
+	}
+	return filepath.Join(filepath.Dir(g.roleManifest.ManifestFilePath), g.Dockerfile.Assets)
+}
+
+// GetDockerfileSignature returns the SHA1 of the Dockerfile snippet of the
+// instance group, including the names and contents of its assets
+func (g *InstanceGroup) GetDockerfileSignature() (string, error) {
+	hasher := sha1.New()
+	if g.Dockerfile == nil {
+		return hex.EncodeToString(hasher.Sum(nil)), nil
+	}
+
+	names := make([]string, 0, len(g.Dockerfile.Env))
+	for name := range g.Dockerfile.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(hasher, "env\x00%s\x00%s\x00", name, g.Dockerfile.Env[name])
+	}
+	for _, assetCopy := range g.Dockerfile.Copy {
+		fmt.Fprintf(hasher, "copy\x00%s\x00%s\x00", assetCopy.Source, assetCopy.Destination)
+	}
+	for _, command := range g.Dockerfile.Run {
+		fmt.Fprintf(hasher, "run\x00%s\x00", command)
+	}
+
+	assetsPath := g.GetDockerfileAssetsPath()
+	if assetsPath == "" {
+		return hex.EncodeToString(hasher.Sum(nil)), nil
+	}
+	// filepath.Walk visits the files in lexical order, keeping the hash stable
+	err := filepath.Walk(assetsPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relpath, err := filepath.Rel(assetsPath, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hasher, "asset\x00%s\x00%o\x00", filepath.ToSlash(relpath), info.Mode())
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(hasher, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
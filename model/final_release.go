@@ -17,37 +17,47 @@ func NewFinalRelease(path string) (release *Release, err error) {
 		FinalRelease: true,
 	}
 
-	release.Name, err = release.getFinalReleaseName()
-	if err != nil {
+	if err := release.loadFinalRelease(); err != nil {
 		return nil, err
 	}
 
-	release.Version, err = release.getFinalReleaseVersion()
+	return release, nil
+}
+
+// loadFinalRelease loads the release from its release.MF file and the job and
+// package archives alongside it.
+func (r *Release) loadFinalRelease() (err error) {
+	r.Name, err = r.getFinalReleaseName()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if err := release.loadMetadata(); err != nil {
-		return nil, err
+	r.Version, err = r.getFinalReleaseVersion()
+	if err != nil {
+		return err
 	}
 
-	if err := release.loadPackages(); err != nil {
-		return nil, err
+	if err := r.loadMetadata(); err != nil {
+		return err
 	}
 
-	if err := release.loadDependenciesForPackages(); err != nil {
-		return nil, err
+	if err := r.loadPackages(); err != nil {
+		return err
 	}
 
-	if err := release.loadJobs(); err != nil {
-		return nil, err
+	if err := r.loadDependenciesForPackages(); err != nil {
+		return err
 	}
 
-	if err := release.loadLicense(); err != nil {
-		return nil, err
+	if err := r.extractJobArchives(); err != nil {
+		return err
 	}
 
-	return release, nil
+	if err := r.loadJobs(); err != nil {
+		return err
+	}
+
+	return r.loadLicense()
 }
 
 func (r *Release) getFinalReleaseName() (name string, err error) {
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"fmt"
+	"math"
+)
+
+// SizingProfile selects the number of replicas of the instance groups
+type SizingProfile string
+
+// These are the sizing profiles
+const (
+	SizingDefault = SizingProfile("default") // The minimum number of replicas
+	SizingHA      = SizingProfile("ha")      // The number of replicas for high availability
+)
+
+// SizingProfiles are the sizing profiles, in the order of reports
+var SizingProfiles = []SizingProfile{SizingDefault, SizingHA}
+
+// Footprint is the sum of the resources of the containers of instance groups.
+// Memory is in MiB, CPU in cores, like the requests and limits of instance
+// groups.  Containers without a limit do not add to the limit; they are
+// counted as unlimited instead.
+type Footprint struct {
+	Replicas        int     `json:"replicas" yaml:"replicas"`
+	MemoryRequest   int64   `json:"memory_request" yaml:"memory_request"`
+	MemoryLimit     int64   `json:"memory_limit" yaml:"memory_limit"`
+	UnlimitedMemory int     `json:"unlimited_memory,omitempty" yaml:"unlimited_memory,omitempty"`
+	CPURequest      float64 `json:"cpu_request" yaml:"cpu_request"`
+	CPULimit        float64 `json:"cpu_limit" yaml:"cpu_limit"`
+	UnlimitedCPU    int     `json:"unlimited_cpu,omitempty" yaml:"unlimited_cpu,omitempty"`
+}
+
+// Add adds the resources of another footprint
+func (f *Footprint) Add(other Footprint) {
+	f.Replicas += other.Replicas
+	f.MemoryRequest += other.MemoryRequest
+	f.MemoryLimit += other.MemoryLimit
+	f.UnlimitedMemory += other.UnlimitedMemory
+	f.CPURequest = roundCPU(f.CPURequest + other.CPURequest)
+	f.CPULimit = roundCPU(f.CPULimit + other.CPULimit)
+	f.UnlimitedCPU += other.UnlimitedCPU
+}
+
+// Footprint returns the resources of all replicas of the instance group at
+// the sizing profile, including its colocated containers and the log sidecar
+// of the role manifest.  Only long running instance groups have a footprint;
+// tasks and colocated containers (which are part of the pods of other
+// instance groups) have none.
+func (g *InstanceGroup) Footprint(profile SizingProfile) Footprint {
+	if g.Type != RoleTypeBosh || g.Run == nil || g.Run.Scaling == nil {
+		return Footprint{}
+	}
+	replicas := g.Run.Scaling.Min
+	if profile == SizingHA {
+		replicas = g.Run.Scaling.HA
+	}
+
+	pod := Footprint{}
+	for _, container := range append(InstanceGroups{g}, g.GetColocatedRoles()...) {
+		run := container.Run
+		if run == nil {
+			continue
+		}
+		if run.Memory != nil && run.Memory.Request != nil {
+			pod.MemoryRequest += *run.Memory.Request
+		}
+		if run.Memory != nil && run.Memory.Limit != nil {
+			pod.MemoryLimit += *run.Memory.Limit
+		} else {
+			pod.UnlimitedMemory++
+		}
+		if run.CPU != nil && run.CPU.Request != nil {
+			pod.CPURequest += *run.CPU.Request
+		}
+		if run.CPU != nil && run.CPU.Limit != nil {
+			pod.CPULimit += *run.CPU.Limit
+		} else {
+			pod.UnlimitedCPU++
+		}
+	}
+	if m := g.Manifest(); m != nil && m.Configuration != nil && m.Configuration.LogSidecar != LogSidecarNone {
+		pod.MemoryRequest += LogSidecarMemoryRequest
+		pod.MemoryLimit += LogSidecarMemoryLimit
+		pod.CPURequest += LogSidecarCPURequest
+		pod.CPULimit += LogSidecarCPULimit
+	}
+
+	return Footprint{
+		Replicas:        replicas,
+		MemoryRequest:   pod.MemoryRequest * int64(replicas),
+		MemoryLimit:     pod.MemoryLimit * int64(replicas),
+		UnlimitedMemory: pod.UnlimitedMemory * replicas,
+		CPURequest:      roundCPU(pod.CPURequest * float64(replicas)),
+		CPULimit:        roundCPU(pod.CPULimit * float64(replicas)),
+		UnlimitedCPU:    pod.UnlimitedCPU * replicas,
+	}
+}
+
+// roundCPU rounds the cores to millicores, the unit of the generated requests
+func roundCPU(cores float64) float64 {
+	return math.Round(cores*1000) / 1000
+}
+
+// Footprint returns the resources of all instance groups of the role
+// manifest at the sizing profile
+func (m *RoleManifest) Footprint(profile SizingProfile) Footprint {
+	total := Footprint{}
+	for _, instanceGroup := range m.InstanceGroups {
+		total.Add(instanceGroup.Footprint(profile))
+	}
+	return total
+}
+
+// Budget returns the resource budget for the sizing profile, or nil if the
+// role manifest has none.  The HA budget defaults to the budget.
+func (m *RoleManifest) Budget(profile SizingProfile) *ResourceBudget {
+	if m.Configuration == nil {
+		return nil
+	}
+	if profile == SizingHA && m.Configuration.HABudget != nil {
+		return m.Configuration.HABudget
+	}
+	return m.Configuration.Budget
+}
+
+// ExceededBudget describes the requests of the footprint which exceed the
+// budget; it returns nothing without a budget.
+func (f Footprint) ExceededBudget(budget *ResourceBudget) []string {
+	if budget == nil {
+		return nil
+	}
+	var exceeded []string
+	if budget.Memory != nil && f.MemoryRequest > *budget.Memory {
+		exceeded = append(exceeded, fmt.Sprintf("the memory requests add up to %d MiB, more than the budget of %d MiB", f.MemoryRequest, *budget.Memory))
+	}
+	if budget.CPU != nil && f.CPURequest > *budget.CPU {
+		exceeded = append(exceeded, fmt.Sprintf("the CPU requests add up to %g cores, more than the budget of %g cores", f.CPURequest, *budget.CPU))
+	}
+	return exceeded
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ReadinessProbeScript is the readiness probe of the long running instance
+// groups, which the kube configs run too
+const ReadinessProbeScript = "/opt/fissile/readiness-probe.sh"
+
+// DockerHealthcheck returns the HEALTHCHECK instruction of the Dockerfile of
+// the instance group, for running its image outside of kube (e.g. with docker
+// compose), or the empty string if it has none.  It is part of the role image
+// tag, see GetRoleDevVersion.  It runs the readiness probe
+// script with the readiness commands, like the kube readiness probe; its
+// timing is that of the readiness probe, or of the liveness probe where the
+// readiness probe has none.  Only long running instance groups have one.
+func (g *InstanceGroup) DockerHealthcheck() (string, error) {
+	if g.Type != RoleTypeBosh || g.Run == nil {
+		return "", nil
+	}
+
+	command := []string{ReadinessProbeScript}
+	var readiness, liveness HealthProbe
+	if healthCheck := g.Run.HealthCheck; healthCheck != nil {
+		if healthCheck.Readiness != nil {
+			readiness = *healthCheck.Readiness
+			command = append(command, readiness.Command...)
+		}
+		if healthCheck.Liveness != nil {
+			liveness = *healthCheck.Liveness
+		}
+	}
+
+	var options []string
+	addOption := func(name string, value, fallback int, unit string) {
+		if value == 0 {
+			value = fallback
+		}
+		if value != 0 {
+			options = append(options, fmt.Sprintf("--%s=%d%s", name, value, unit))
+		}
+	}
+	addOption("interval", readiness.Period, liveness.Period, "s")
+	addOption("timeout", readiness.Timeout, liveness.Timeout, "s")
+	addOption("start-period", readiness.InitialDelay, liveness.InitialDelay, "s")
+	addOption("retries", readiness.FailureThreshold, liveness.FailureThreshold, "")
+
+	// The exec form, so that the commands are passed to the script as they are
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(command); err != nil {
+		return "", err
+	}
+
+	instruction := append([]string{"HEALTHCHECK"}, options...)
+	instruction = append(instruction, "CMD", strings.TrimSpace(buf.String()))
+	return strings.Join(instruction, " "), nil
+}
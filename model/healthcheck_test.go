@@ -0,0 +1,70 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerHealthcheck(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		instanceGroup InstanceGroup
+		expected      string
+	}{
+		{
+			name: "default",
+			instanceGroup: InstanceGroup{
+				Type: RoleTypeBosh,
+				Run:  &RoleRun{},
+			},
+			expected: `HEALTHCHECK CMD ["/opt/fissile/readiness-probe.sh"]`,
+		},
+		{
+			name: "readiness",
+			instanceGroup: InstanceGroup{
+				Type: RoleTypeBosh,
+				Run: &RoleRun{HealthCheck: &HealthCheck{
+					Readiness: &HealthProbe{
+						Command:          []string{`curl -sf "http://localhost:8080/health"`, "test -e /tmp/up && true"},
+						Period:           5,
+						InitialDelay:     30,
+						FailureThreshold: 6,
+					},
+					Liveness: &HealthProbe{
+						Period:  60,
+						Timeout: 10,
+					},
+				}},
+			},
+			expected: `HEALTHCHECK --interval=5s --timeout=10s --start-period=30s --retries=6 CMD ["/opt/fissile/readiness-probe.sh","curl -sf \"http://localhost:8080/health\"","test -e /tmp/up && true"]`,
+		},
+		{
+			name: "task",
+			instanceGroup: InstanceGroup{
+				Type: RoleTypeBoshTask,
+				Run:  &RoleRun{},
+			},
+		},
+		{
+			name: "colocated container",
+			instanceGroup: InstanceGroup{
+				Type: RoleTypeColocatedContainer,
+				Run:  &RoleRun{},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			actual, err := tc.instanceGroup.DockerHealthcheck()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, actual)
+		})
+	}
+}
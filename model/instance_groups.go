@@ -35,19 +35,23 @@ func (igs InstanceGroups) Swap(i, j int) {
 
 // InstanceGroup represents a collection of jobs that are colocated on a container
 type InstanceGroup struct {
-	Name              string         `yaml:"name"`
-	DefaultFeature    string         `yaml:"default_feature"`
-	IfFeature         string         `yaml:"if_feature"`
-	UnlessFeature     string         `yaml:"unless_feature"`
-	Description       string         `yaml:"description"`
-	EnvironScripts    []string       `yaml:"environment_scripts"`
-	Scripts           []string       `yaml:"scripts"`
-	PostConfigScripts []string       `yaml:"post_config_scripts"`
-	Type              RoleType       `yaml:"type,omitempty"`
-	JobReferences     JobReferences  `yaml:"jobs"`
-	Configuration     *Configuration `yaml:"configuration"`
-	Tags              []RoleTag      `yaml:"tags"`
-	Run               *RoleRun       `yaml:"-"`
+	Name              string             `yaml:"name"`
+	DefaultFeature    string             `yaml:"default_feature"`
+	IfFeature         string             `yaml:"if_feature"`
+	UnlessFeature     string             `yaml:"unless_feature"`
+	Description       string             `yaml:"description"`
+	EnvironScripts    []string           `yaml:"environment_scripts"`
+	Scripts           []string           `yaml:"scripts"`
+	PostConfigScripts []string           `yaml:"post_config_scripts"`
+	Type              RoleType           `yaml:"type,omitempty"`
+	JobReferences     JobReferences      `yaml:"jobs"`
+	Configuration     *Configuration     `yaml:"configuration"`
+	Tags              []RoleTag          `yaml:"tags"`
+	Group             string             `yaml:"group,omitempty"`
+	VMType            string             `yaml:"vm_type,omitempty"`
+	Dockerfile        *DockerfileSnippet `yaml:"dockerfile,omitempty"`
+	PackageOverrides  *PackageOverrides  `yaml:"packages,omitempty"`
+	Run               *RoleRun           `yaml:"-"`
 
 	roleManifest *RoleManifest
 }
@@ -110,6 +114,8 @@ func (g *InstanceGroup) CalculateRoleRun() validation.ErrorList {
 
 	g.Run.mergeVolumes(jobReferences)
 
+	g.Run.mergeLogPaths(g.JobReferences)
+
 	g.Run.setMaxFields(jobReferences)
 
 	if ok := jobReferences.atMostOnce(healthCheckPresent); ok {
@@ -134,6 +140,64 @@ func (g *InstanceGroup) CalculateRoleRun() validation.ErrorList {
 		allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("instance_groups[%s]", g.Name), property, "Cannot specify Run.ServiceAccount properties on more than one job of the same instance group"))
 	}
 
+	if property, err := jobReferences.uniqueStringProperty(func(j JobReference) string {
+		return j.ContainerProperties.BoshContainerization.Run.ImagePullPolicy
+	}); err == nil {
+		g.Run.ImagePullPolicy = property
+	} else {
+		allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("instance_groups[%s]", g.Name), property, "Cannot specify Run.ImagePullPolicy properties on more than one job of the same instance group"))
+	}
+
+	if property, err := jobReferences.uniqueStringProperty(func(j JobReference) string {
+		return j.ContainerProperties.BoshContainerization.Run.ServiceName
+	}); err == nil {
+		g.Run.ServiceName = property
+	} else {
+		allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("instance_groups[%s]", g.Name), property, "Cannot specify Run.ServiceName properties on more than one job of the same instance group"))
+	}
+
+	if property, err := jobReferences.uniqueStringProperty(func(j JobReference) string {
+		return j.ContainerProperties.BoshContainerization.Run.Hostname
+	}); err == nil {
+		g.Run.Hostname = property
+	} else {
+		allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("instance_groups[%s]", g.Name), property, "Cannot specify Run.Hostname properties on more than one job of the same instance group"))
+	}
+
+	if property, err := jobReferences.uniqueStringProperty(func(j JobReference) string {
+		return j.ContainerProperties.BoshContainerization.Run.Subdomain
+	}); err == nil {
+		g.Run.Subdomain = property
+	} else {
+		allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("instance_groups[%s]", g.Name), property, "Cannot specify Run.Subdomain properties on more than one job of the same instance group"))
+	}
+
+	if property, err := jobReferences.uniqueStringProperty(func(j JobReference) string {
+		return string(j.ContainerProperties.BoshContainerization.Run.AffinityPreset)
+	}); err == nil {
+		g.Run.AffinityPreset = AffinityPreset(property)
+	} else {
+		allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("instance_groups[%s]", g.Name), property, "Cannot specify Run.AffinityPreset properties on more than one job of the same instance group"))
+	}
+
+	for _, jobReference := range jobReferences {
+		if budget := jobReference.ContainerProperties.BoshContainerization.Run.PodBudget; budget != nil {
+			if g.Run.PodBudget != nil {
+				allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("instance_groups[%s]", g.Name), budget, "Cannot specify Run.PodBudget properties on more than one job of the same instance group"))
+			}
+			g.Run.PodBudget = budget
+		}
+	}
+
+	for _, jobReference := range jobReferences {
+		if securityContext := jobReference.ContainerProperties.BoshContainerization.Run.SecurityContext; securityContext != nil {
+			if g.Run.SecurityContext != nil {
+				allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("instance_groups[%s]", g.Name), securityContext, "Cannot specify Run.SecurityContext properties on more than one job of the same instance group"))
+			}
+			g.Run.SecurityContext = securityContext
+		}
+	}
+
 	if ok := jobReferences.atMostOnce(affinityPresent); ok {
 		g.Run.Affinity = jobReferences.firstAffinity()
 	} else {
@@ -234,11 +298,18 @@ func (g *InstanceGroup) GetTemplateSignatures() (string, error) {
 	return hex.EncodeToString(hasher.Sum(nil)), nil
 }
 
+// RoleImageOptions are the options of role image builds changing the contents
+// of the images, which are thus part of their tags
+type RoleImageOptions struct {
+	NoHealthcheck bool // Leave out the HEALTHCHECK instruction
+	Attributions  bool // Write the licenses of the releases and packages
+}
+
 // GetRoleDevVersion determines the version hash for the role, using the basic
 // role dev version, and the aggregated spec and opinion
 // information. In this manner opinion changes cause a rebuild of the
 // associated role images.
-func (g *InstanceGroup) GetRoleDevVersion(opinions *Opinions, tagExtra, fissileVersion string, grapher util.ModelGrapher) (string, error) {
+func (g *InstanceGroup) GetRoleDevVersion(opinions *Opinions, tagExtra, fissileVersion string, imageOptions RoleImageOptions, grapher util.ModelGrapher) (string, error) {
 
 	// Basic role version
 	jobPkgVersion, inputSigs, err := g.getRoleJobAndPackagesSignature(grapher)
@@ -261,6 +332,31 @@ func (g *InstanceGroup) GetRoleDevVersion(opinions *Opinions, tagExtra, fissileV
 		[]string{"extra/", tagExtra},
 	}
 
+	// The run script of images copying the log files to the output differs,
+	// and lists the log files
+	if g.Run != nil && g.Run.LogToStdout {
+		signatures = append(signatures, "log-to-stdout")
+		signatures = append(signatures, g.Run.LogPaths...)
+		extraGraphEdges = append(extraGraphEdges, []string{"run/", "log-to-stdout " + strings.Join(g.Run.LogPaths, " ")})
+	}
+
+	if imageOptions.Attributions {
+		signatures = append(signatures, "attributions")
+		extraGraphEdges = append(extraGraphEdges, []string{"image/", "attributions"})
+	}
+
+	// So does the HEALTHCHECK instruction of the Dockerfile
+	if !imageOptions.NoHealthcheck {
+		healthcheck, err := g.DockerHealthcheck()
+		if err != nil {
+			return "", err
+		}
+		if healthcheck != "" {
+			signatures = append(signatures, healthcheck)
+			extraGraphEdges = append(extraGraphEdges, []string{"healthcheck/", healthcheck})
+		}
+	}
+
 	if opinions != nil {
 		// Job order comes from the role manifest, and is sort of
 		// fix. Avoid sorting for now.  Also note, if a property is
@@ -355,18 +451,26 @@ func (g *InstanceGroup) getRoleJobAndPackagesSignature(grapher util.ModelGrapher
 	// significant, in particular for bosh-task roles.
 	for _, jobReference := range g.JobReferences {
 		roleSignature = fmt.Sprintf("%s\n%s", roleSignature, jobReference.SHA1)
-		packages = append(packages, jobReference.Packages...)
+		for _, link := range g.PackageLinks(jobReference) {
+			packages = append(packages, link.Package)
+		}
 		inputs = append(inputs, jobReference.Fingerprint)
 		if grapher != nil {
 			_ = grapher.GraphNode(jobReference.Fingerprint,
 				map[string]string{"label": fmt.Sprintf("job/%s/%s", jobReference.ReleaseName, jobReference.Name)})
 			_ = grapher.GraphEdge("release/"+jobReference.ReleaseName, jobReference.Fingerprint, nil)
-			for _, pkg := range jobReference.Packages {
-				_ = grapher.GraphEdge("release/"+jobReference.ReleaseName, pkg.Fingerprint, nil)
+			for _, link := range g.PackageLinks(jobReference) {
+				_ = grapher.GraphEdge("release/"+link.Package.Release.Name, link.Package.Fingerprint, nil)
 			}
 		}
 	}
 
+	// Excluding a package, or substituting it with one already in the image,
+	// changes which packages are linked where rather than the packages
+	if g.PackageOverrides != nil {
+		roleSignature = fmt.Sprintf("%s\n%s", roleSignature, g.PackageOverrides.Signature())
+	}
+
 	sort.Sort(packages)
 	for _, pkg := range packages {
 		roleSignature = fmt.Sprintf("%s\n%s", roleSignature, pkg.SHA1)
@@ -392,6 +496,16 @@ func (g *InstanceGroup) getRoleJobAndPackagesSignature(grapher util.ModelGrapher
 		roleSignature = fmt.Sprintf("%s\n%s", roleSignature, sig)
 	}
 
+	// If there is a Dockerfile snippet, generate a signature for it and its
+	// assets
+	if g.Dockerfile != nil {
+		sig, err = g.GetDockerfileSignature()
+		if err != nil {
+			return "", nil, err
+		}
+		roleSignature = fmt.Sprintf("%s\n%s", roleSignature, sig)
+	}
+
 	hasher := sha1.New()
 	hasher.Write([]byte(roleSignature))
 	return hex.EncodeToString(hasher.Sum(nil)), inputs, nil
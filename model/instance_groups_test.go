@@ -114,3 +114,24 @@ func TestGetTemplateSignatures(t *testing.T) {
 	differentTemplateHash2, _ := differentTemplate2.GetTemplateSignatures()
 	assert.NotEqual(differentTemplateHash1, differentTemplateHash2, "template hash should be dependent on template contents")
 }
+
+func TestGetRoleVersionRecordTemplates(t *testing.T) {
+	assert := assert.New(t)
+
+	instanceGroup := &InstanceGroup{
+		Name:          "aaa",
+		JobReferences: JobReferences{},
+		Configuration: &Configuration{
+			Templates: map[string]ConfigurationTemplate{
+				"properties.password": ConfigurationTemplate{
+					Value: "((PASSWORD))",
+				}}},
+	}
+
+	record, err := instanceGroup.GetRoleVersionRecord(nil, "", "", RoleImageOptions{NoHealthcheck: true})
+	if assert.NoError(err) {
+		assert.Equal(map[string]string{
+			"properties.password": "41a16e3a9870ff45503e67f5fa32a643c43d293d6508d37a2371dba0083b501d",
+		}, record.Templates, "templates should be recorded as sha256 digests")
+	}
+}
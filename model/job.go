@@ -1,14 +1,18 @@
 package model
 
 import (
+	"archive/tar"
 	"crypto/sha1"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"reflect"
 	"sort"
+	"strings"
 
 	"code.cloudfoundry.org/archiver/extractor"
 	"code.cloudfoundry.org/fissile/util"
@@ -27,17 +31,56 @@ type JobLinkInfo struct {
 // JobProvidesInfo describes a BOSH link provider
 type JobProvidesInfo struct {
 	JobLinkInfo
-	Alias      string `yaml:"as"`
-	Shared     bool   `yaml:"shared"`
+	Alias      string             `yaml:"as"`
+	Shared     bool               `yaml:"shared"`
+	Aliases    []JobProvidesAlias `yaml:"aliases,omitempty"` // Additional DNS names of the job, as with BOSH DNS
 	Properties []string
 }
 
+// JobProvidesAlias is an additional DNS name the provider of a link is
+// reachable at, e.g. a legacy BOSH name like nats.service.cf.internal
+type JobProvidesAlias struct {
+	Domain string `yaml:"domain"`
+}
+
+// ServiceName returns the name of the service generated for the alias: the
+// first label of its domain
+func (a JobProvidesAlias) ServiceName() string {
+	return strings.SplitN(a.Domain, ".", 2)[0]
+}
+
 // JobConsumesInfo describes the BOSH links a job consumes
 type JobConsumesInfo struct {
 	JobLinkInfo
-	Alias    string `yaml:"from"`
-	Ignore   bool   `yaml:"ignore"`
+	Alias    string           `yaml:"from"`
+	Ignore   bool             `yaml:"ignore"`
+	External *JobExternalLink `yaml:"external"` // Provider outside of the role manifest
 	Optional bool
+	// How the consumer was resolved; only set by the resolver
+	Resolution LinkResolution `yaml:"-"`
+}
+
+// LinkResolution describes how a consumed link was matched to its provider
+type LinkResolution string
+
+// Ways a consumed link can be resolved
+const (
+	LinkResolutionExplicit = LinkResolution("explicit") // named in the role manifest
+	LinkResolutionName     = LinkResolution("name")     // implicitly, by the name of the link
+	LinkResolutionType     = LinkResolution("type")     // implicitly, as the only provider of the type
+	LinkResolutionExternal = LinkResolution("external") // provided outside of the role manifest
+)
+
+// JobExternalLink describes a link provider outside of the role manifest.  It
+// is either a fixed address with its properties, or a job deployed into
+// another namespace.
+type JobExternalLink struct {
+	Address       string                 `yaml:"address"`
+	Properties    map[string]interface{} `yaml:"properties"`
+	Namespace     string                 `yaml:"namespace"`
+	InstanceGroup string                 `yaml:"instance_group"`
+	Job           string                 `yaml:"job"`
+	ServiceName   string                 `yaml:"service_name"`
 }
 
 // Job represents a BOSH job
@@ -61,7 +104,7 @@ type Job struct {
 // Jobs is an array of Job*
 type Jobs []*Job
 
-func newJob(release *Release, jobReleaseInfo map[interface{}]interface{}) (*Job, error) {
+func newJob(release *Release, jobReleaseInfo map[interface{}]interface{}, cache *releaseMetadataCache) (*Job, error) {
 	job := &Job{
 		Release: release,
 
@@ -72,7 +115,7 @@ func newJob(release *Release, jobReleaseInfo map[interface{}]interface{}) (*Job,
 		return nil, err
 	}
 
-	if err := job.loadJobSpec(); err != nil {
+	if err := job.loadJobSpec(cache); err != nil {
 		return nil, err
 	}
 
@@ -92,6 +135,9 @@ func (j *Job) getProperty(name string) (*JobProperty, error) {
 // ValidateSHA1 validates that the SHA1 of the actual job archive is the same
 // as the one from the release manifest
 func (j *Job) ValidateSHA1() error {
+	if err := j.Release.ensureArchive(j.Path); err != nil {
+		return err
+	}
 	file, err := os.Open(j.Path)
 	if err != nil {
 		return fmt.Errorf("Error opening the job archive %s for sha1 calculation", j.Path)
@@ -124,6 +170,9 @@ func (j *Job) Extract(destination string) (string, error) {
 		return "", err
 	}
 
+	if err := j.Release.ensureArchive(j.Path); err != nil {
+		return "", err
+	}
 	if err := extractor.NewTgz().Extract(j.Path, targetDir); err != nil {
 		return "", err
 	}
@@ -147,37 +196,102 @@ func (j *Job) loadJobInfo() (err error) {
 	return nil
 }
 
-func (j *Job) loadJobSpec() (err error) {
+// loadJobSpec loads the job spec, from the metadata cache if possible, or
+// else from the job archive.  The contents of the templates are not loaded,
+// only the link properties they read; see JobTemplate.Load.
+func (j *Job) loadJobSpec(cache *releaseMetadataCache) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err = fmt.Errorf("Error trying to load job spec: %s", r)
 		}
 	}()
 
-	tempJobDir, err := ioutil.TempDir("", "fissile-job-dir")
-	defer func() {
-		if cleanupErr := os.RemoveAll(tempJobDir); cleanupErr != nil && err != nil {
-			err = fmt.Errorf("Error loading job spec: %v,  cleanup error: %v", err, cleanupErr)
-		} else if cleanupErr != nil {
-			err = fmt.Errorf("Error cleaning up after load job spec: %v", cleanupErr)
+	contents, ok := cache.lookup(j)
+	if !ok {
+		contents, err = j.readArchiveContents()
+		if err != nil {
+			return err
 		}
-	}()
-	if err != nil {
-		return err
+		cache.store(j, contents)
 	}
 
-	jobDir, err := j.Extract(tempJobDir)
+	return j.parseJobSpec(contents)
+}
+
+// readArchiveContents reads the job spec and the link properties of the
+// templates from the job archive, in a single pass.  The contents of the
+// templates are not kept.
+func (j *Job) readArchiveContents() (*jobArchiveContents, error) {
+	archive, err := os.Open(j.Path)
 	if err != nil {
-		return fmt.Errorf("Error extracting archive (%s) for job %s: %s", j.Path, j.Name, err.Error())
+		return nil, fmt.Errorf("Error reading archive (%s) for job %s: %s", j.Path, j.Name, err.Error())
 	}
+	defer archive.Close()
+
+	contents := &jobArchiveContents{LinkProperties: make(map[string][]LinkProperty)}
+	foundSpec := false
+	err = util.TargzIterate(j.Path, archive, func(reader *tar.Reader, header *tar.Header) error {
+		name := path.Clean(header.Name)
+		if name != "job.MF" && !strings.HasPrefix(name, "templates/") {
+			return nil
+		}
+		buf, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		if name == "job.MF" {
+			contents.Spec = string(buf)
+			foundSpec = true
+		} else if properties := scanLinkProperties(string(buf)); len(properties) > 0 {
+			contents.LinkProperties[strings.TrimPrefix(name, "templates/")] = properties
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error reading archive (%s) for job %s: %s", j.Path, j.Name, err.Error())
+	}
+	if !foundSpec {
+		return nil, fmt.Errorf("Error reading archive (%s) for job %s: job.MF not found", j.Path, j.Name)
+	}
+	return contents, nil
+}
 
-	specFile := filepath.Join(jobDir, "job.MF")
+// errArchiveFileFound stops the iteration over a job archive in
+// readArchiveFile
+var errArchiveFileFound = errors.New("found")
 
-	specContents, err := ioutil.ReadFile(specFile)
+// readArchiveFile returns the contents of a file in the job archive, reading
+// the archive up to the file without extracting it.
+func (j *Job) readArchiveFile(name string) ([]byte, error) {
+	archive, err := os.Open(j.Path)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("Error reading archive (%s) for job %s: %s", j.Path, j.Name, err.Error())
+	}
+	defer archive.Close()
+
+	var contents []byte
+	err = util.TargzIterate(j.Path, archive, func(reader *tar.Reader, header *tar.Header) error {
+		if path.Clean(header.Name) != name {
+			return nil
+		}
+		var err error
+		contents, err = ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		return errArchiveFileFound
+	})
+	switch err {
+	case errArchiveFileFound:
+		return contents, nil
+	case nil:
+		return nil, fmt.Errorf("Error reading archive (%s) for job %s: %s not found", j.Path, j.Name, name)
 	}
+	return nil, fmt.Errorf("Error reading archive (%s) for job %s: %s", j.Path, j.Name, err.Error())
+}
 
+// parseJobSpec fills in the job from the contents of its archive.
+func (j *Job) parseJobSpec(contents *jobArchiveContents) error {
 	// jobSpec describes the contents of "job.MF" files
 	var jobSpec struct {
 		Name        string
@@ -201,7 +315,7 @@ func (j *Job) loadJobSpec() (err error) {
 		}
 	}
 
-	if err := yaml.Unmarshal([]byte(specContents), &jobSpec); err != nil {
+	if err := yaml.Unmarshal([]byte(contents.Spec), &jobSpec); err != nil {
 		return err
 	}
 
@@ -217,18 +331,15 @@ func (j *Job) loadJobSpec() (err error) {
 	}
 
 	for source, destination := range jobSpec.Templates {
-		templateFile := filepath.Join(jobDir, "templates", source)
-
-		templateContent, err := ioutil.ReadFile(templateFile)
-		if err != nil {
-			return err
-		}
-
 		template := &JobTemplate{
 			SourcePath:      source,
 			DestinationPath: destination,
 			Job:             j,
-			Content:         string(templateContent),
+			linkProperties:  contents.LinkProperties[source],
+		}
+		template.load = func() (string, error) {
+			content, err := j.readArchiveFile(path.Join("templates", template.SourcePath))
+			return string(content), err
 		}
 
 		j.Templates = append(j.Templates, template)
@@ -303,6 +414,14 @@ type jobConfigTemplate struct {
 
 // GetPropertiesForJob returns the parameters for the given job, using its specs and opinions
 func (j *Job) GetPropertiesForJob(opinions *Opinions) (map[string]interface{}, error) {
+	return j.getPropertiesForJob(opinions, nil)
+}
+
+// getPropertiesForJob returns the parameters for the given job, using its
+// specs, the opinions, and the overrides keyed by property name.  Overrides
+// take precedence over light opinions; setting a property excluded by the dark
+// opinions is an error.
+func (j *Job) getPropertiesForJob(opinions *Opinions, overrides map[string]interface{}) (map[string]interface{}, error) {
 	props := make(map[string]interface{})
 	lightOpinions, ok := opinions.Light["properties"]
 	if !ok {
@@ -337,21 +456,27 @@ func (j *Job) GetPropertiesForJob(opinions *Opinions) (map[string]interface{}, e
 		// or no value at all we consider the key to be an
 		// inner node which is not excluded.
 
+		override, hasOverride := overrides[property.Name]
 		darkValue, ok := getOpinionValue(darkOpinionsByString, keyPieces)
 		if ok {
-			if darkValue == nil {
-				// Ignore dark opinions
-				continue
+			dark := darkValue == nil
+			if !dark {
+				kind := reflect.TypeOf(darkValue).Kind()
+				dark = kind != reflect.Map && kind != reflect.Array
 			}
-			kind := reflect.TypeOf(darkValue).Kind()
-			if kind != reflect.Map && kind != reflect.Array {
+			if dark {
+				if hasOverride {
+					return nil, fmt.Errorf("Property %s of job %s is set in the role manifest, but excluded by the dark opinions", property.Name, j.Name)
+				}
 				// Ignore dark opinions
 				continue
 			}
 		}
 		lightValue, hasLightValue := getOpinionValue(lightOpinionsByString, keyPieces)
 		var finalValue interface{}
-		if hasLightValue && lightValue != nil {
+		if hasOverride {
+			finalValue = override
+		} else if hasLightValue && lightValue != nil {
 			finalValue = lightValue
 		} else {
 			finalValue = property.Default
@@ -3,6 +3,22 @@ package model
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"code.cloudfoundry.org/fissile/util"
+)
+
+// MaxServiceNameLength is the maximum length of the name of the service of a
+// job.  Kubernetes limits service names to 63 characters, and the headless and
+// public services of a job add the suffixes "-set" and "-public".
+const MaxServiceNameLength = 63 - len("-public")
+
+// The range of node ports kubernetes allocates from by default
+const (
+	MinNodePort = 30000
+	MaxNodePort = 32767
 )
 
 // JobReference from the deployment manifest, references a job spec from a release by ReleaseName
@@ -14,11 +30,70 @@ type JobReference struct {
 	ResolvedConsumes    map[string]JobConsumesInfo `yaml:"consumes"`    // Instance groups that this job links to & requires
 	ResolvedConsumedBy  map[string][]JobLinkInfo   `yaml:"consumed_by"` // Instance groups that consume a link
 	ContainerProperties JobContainerProperties     `yaml:"properties"`
+	IfFeature           string                     `yaml:"if_feature,omitempty"`     // Only include the job when the feature is enabled
+	UnlessFeature       string                     `yaml:"unless_feature,omitempty"` // Only include the job when the feature is disabled
+	PropertyOverrides   map[string]interface{}     `yaml:"-"`                        // Job properties from the role manifest, by property name
+}
+
+// FeatureCondition returns the feature the job depends on, and whether the
+// feature must be enabled (if_feature) or disabled (unless_feature) for the job
+// to be included.  The feature is empty for jobs that are always included.
+func (j *JobReference) FeatureCondition() (string, bool) {
+	if j.IfFeature != "" {
+		return j.IfFeature, true
+	}
+	return j.UnlessFeature, false
+}
+
+// FeatureVariable returns the name of the environment variable telling whether
+// the feature in the job's condition is enabled, or the empty string for jobs
+// that are always included.
+func (j *JobReference) FeatureVariable() string {
+	feature, _ := j.FeatureCondition()
+	if feature == "" {
+		return ""
+	}
+	return fmt.Sprintf("FEATURE_%s_ENABLED", strings.ToUpper(feature))
+}
+
+// DefaultServiceName returns the name of the service of a job in an instance
+// group, before any truncation, unless it is set in the role manifest.
+func (j *JobReference) DefaultServiceName(instanceGroupName string) string {
+	return util.ConvertNameToKey(instanceGroupName + "-" + j.Name)
+}
+
+// ServiceName returns the name of the kubernetes service of a job in an
+// instance group, which is also the address link consumers use to reach it.
+// Derived names are converted into valid kubernetes names, and truncated with
+// a hash suffix when too long; names set in the role manifest are used as is.
+func (j *JobReference) ServiceName(instanceGroupName string) string {
+	if j.ContainerProperties.BoshContainerization.ServiceName != "" {
+		return j.ContainerProperties.BoshContainerization.ServiceName
+	}
+	return util.SanitizeKubeName(j.DefaultServiceName(instanceGroupName), MaxServiceNameLength)
+}
+
+// ProviderAliases returns the DNS aliases of the link providers of the job,
+// sorted by provider
+func (j *JobReference) ProviderAliases() []JobProvidesAlias {
+	names := make([]string, 0, len(j.ExportedProvides))
+	for name := range j.ExportedProvides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var aliases []JobProvidesAlias
+	for _, name := range names {
+		aliases = append(aliases, j.ExportedProvides[name].Aliases...)
+	}
+	return aliases
 }
 
 // JobContainerProperties describes job configuration
 type JobContainerProperties struct {
 	BoshContainerization JobBoshContainerization `yaml:"bosh_containerization"`
+	// Properties holds the job properties set in the role manifest, nested
+	// like in a BOSH deployment manifest.
+	Properties map[string]interface{} `yaml:",inline"`
 }
 
 // JobBoshContainerization describes settings specific to containerization
@@ -31,19 +106,41 @@ type JobBoshContainerization struct {
 
 // JobExposedPort describes a port to be available to other jobs, or the outside world
 type JobExposedPort struct {
-	Name                string `yaml:"name"`
-	Protocol            string `yaml:"protocol"`
-	External            string `yaml:"external"`
-	Internal            string `yaml:"internal"`
-	Public              bool   `yaml:"public"`
-	Count               int    `yaml:"count"`
-	Max                 int    `yaml:"max"`
-	PortIsConfigurable  bool   `yaml:"port-configurable"`
-	CountIsConfigurable bool   `yaml:"count-configurable"`
+	Name                string             `yaml:"name"`
+	Protocol            string             `yaml:"protocol"`
+	External            string             `yaml:"external"`
+	Internal            string             `yaml:"internal"`
+	Public              bool               `yaml:"public"`
+	Count               int                `yaml:"count"`
+	Max                 int                `yaml:"max"`
+	PortIsConfigurable  bool               `yaml:"port-configurable"`
+	CountIsConfigurable bool               `yaml:"count-configurable"`
+	NodePort            int                `yaml:"node-port"`
+	TLS                 *JobExposedPortTLS `yaml:"tls"`
+	Metrics             string             `yaml:"metrics,omitempty"` // HTTP path of the Prometheus metrics served on the port
 	InternalPort        int
 	ExternalPort        int
 }
 
+// JobExposedPortTLS describes how TLS connections to a public port are handled
+// outside of the cluster, by load balancers or routers
+type JobExposedPortTLS struct {
+	Secret    string `yaml:"secret"`    // A certificate variable (along with its _KEY variable), or the name of a kubernetes.io/tls secret
+	Terminate string `yaml:"terminate"` // PortTLSTerminate or PortTLSPassthrough
+}
+
+// The ways TLS connections to a port are handled
+const (
+	PortTLSTerminate   = "true"        // TLS is terminated in front of the port, using the secret
+	PortTLSPassthrough = "passthrough" // TLS connections are passed through to the port
+)
+
+// SecretVariable returns the certificate variable the TLS secret refers to, or
+// nil if it is the name of a kubernetes secret
+func (tls *JobExposedPortTLS) SecretVariable(variables Variables) *VariableDefinition {
+	return variables.Lookup(tls.Secret)
+}
+
 func runPropertyPresent(j JobReference) bool {
 	if j.ContainerProperties.BoshContainerization.Run == nil {
 		return false
@@ -171,6 +268,13 @@ func (jobs JobReferences) firstAffinity() *RoleRunAffinity {
 	return nil
 }
 
+// GetPropertiesForJob returns the parameters for the job, using its specs,
+// the opinions, and the properties set in the role manifest, which take
+// precedence over the light opinions.
+func (j *JobReference) GetPropertiesForJob(opinions *Opinions) (map[string]interface{}, error) {
+	return j.Job.getPropertiesForJob(opinions, j.PropertyOverrides)
+}
+
 // WriteConfigs merges the job's spec with the opinions and returns the result as JSON.
 func (j *JobReference) WriteConfigs(instanceGroup *InstanceGroup, lightOpinionsPath, darkOpinionsPath string) ([]byte, error) {
 	var config struct {
@@ -197,6 +301,10 @@ func (j *JobReference) WriteConfigs(instanceGroup *InstanceGroup, lightOpinionsP
 	config.Job.Name = instanceGroup.Name
 
 	for _, consumer := range j.ResolvedConsumes {
+		if consumer.External != nil {
+			// External links are passed to configgin by the pod
+			continue
+		}
 		config.Consumes[consumer.Name] = consumer.JobLinkInfo
 	}
 	config.ConsumedBy = j.ResolvedConsumedBy
@@ -205,7 +313,7 @@ func (j *JobReference) WriteConfigs(instanceGroup *InstanceGroup, lightOpinionsP
 	if err != nil {
 		return nil, err
 	}
-	properties, err := j.Job.GetPropertiesForJob(opinions)
+	properties, err := j.GetPropertiesForJob(opinions)
 	if err != nil {
 		return nil, err
 	}
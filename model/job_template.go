@@ -1,15 +1,42 @@
 package model
 
+import "regexp"
+
 // JobTemplate represents a BOSH job template
 type JobTemplate struct {
 	SourcePath      string
 	DestinationPath string
 	Job             *Job
-	Content         string
+	Content         string // empty until loaded; see Load
+
+	load func() (string, error)
+	// linkProperties are the link properties read by the template, found
+	// when the job is loaded; see LinkProperties
+	linkProperties []LinkProperty
+}
+
+// Load reads the content of the template from the job archive, unless it has
+// been loaded already.  Loading a release only reads the names of the
+// templates, since few operations need their contents.
+func (t *JobTemplate) Load() error {
+	if t.load == nil {
+		return nil
+	}
+	content, err := t.load()
+	if err != nil {
+		return err
+	}
+	t.Content = content
+	t.load = nil
+	return nil
 }
 
 // Marshal implements the util.Marshaler interface
 func (t *JobTemplate) Marshal() (interface{}, error) {
+	if err := t.Load(); err != nil {
+		return nil, err
+	}
+
 	var jobFingerprint string
 	if t.Job != nil {
 		jobFingerprint = t.Job.Fingerprint
@@ -22,3 +49,65 @@ func (t *JobTemplate) Marshal() (interface{}, error) {
 		"content":         t.Content,
 	}, nil
 }
+
+// LinkProperty is a property of a link read by a job template
+type LinkProperty struct {
+	Link     string `json:"link"`     // The name of the consumed link
+	Property string `json:"property"` // The name of the property
+	Required bool   `json:"required"` // Whether the template fails if the property is missing
+}
+
+// linkPropertyPattern matches, in order of the alternatives: assignments of a
+// link to a variable, if_link blocks binding the link to a variable, property
+// reads directly from a link, and property reads from a variable.
+var linkPropertyPattern = regexp.MustCompile(
+	`(\w+)\s*=\s*link\(\s*["']([^"']+)["']\s*\)\s*(?:$|[;%\n-])` +
+		`|if_link\(\s*["']([^"']+)["']\s*\)\s*(?:do|\{)\s*\|\s*(\w+)\s*\|` +
+		`|link\(\s*["']([^"']+)["']\s*\)\s*\.\s*(p|if_p)\(\s*["']([^"']+)["']\s*([,)])` +
+		`|\b(\w+)\s*\.\s*(p|if_p)\(\s*["']([^"']+)["']\s*([,)])`)
+
+// LinkProperties returns the properties of consumed links read by the
+// template, in the order they appear.  They are found when the job is loaded
+// (and kept in the release metadata cache), so the template need not be
+// loaded; see scanLinkProperties.
+func (t *JobTemplate) LinkProperties() []LinkProperty {
+	if t.load == nil {
+		return scanLinkProperties(t.Content)
+	}
+	return t.linkProperties
+}
+
+// scanLinkProperties returns the properties of consumed links read by the
+// template content.  The ERB source is only scanned for calls of p and if_p
+// on link(...) and on variables bound to a link; reads using any other
+// construct are not found.  Reading a property with p and no default value is
+// required, everything else is optional.
+func scanLinkProperties(content string) []LinkProperty {
+	var result []LinkProperty
+	variables := make(map[string]string)
+	for _, match := range linkPropertyPattern.FindAllStringSubmatch(content, -1) {
+		switch {
+		case match[1] != "":
+			variables[match[1]] = match[2]
+		case match[3] != "":
+			variables[match[4]] = match[3]
+		case match[5] != "":
+			result = append(result, LinkProperty{
+				Link:     match[5],
+				Property: match[7],
+				Required: match[6] == "p" && match[8] == ")",
+			})
+		case match[9] != "":
+			link, ok := variables[match[9]]
+			if !ok {
+				continue
+			}
+			result = append(result, LinkProperty{
+				Link:     link,
+				Property: match[11],
+				Required: match[10] == "p" && match[12] == ")",
+			})
+		}
+	}
+	return result
+}
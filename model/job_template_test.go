@@ -3,6 +3,7 @@ package model
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -25,6 +26,10 @@ func TestJobTemplatesContentOk(t *testing.T) {
 
 	for _, template := range release.Jobs[0].Templates {
 		assert.NotEmpty(template)
+		assert.Empty(template.Content, "Template %s should not be loaded yet", template.SourcePath)
+		if assert.NoError(template.Load()) {
+			assert.NotEmpty(template.Content, "Template %s should have been loaded", template.SourcePath)
+		}
 	}
 }
 
@@ -77,3 +82,23 @@ func TestJobTemplateMarshal(t *testing.T) {
 		})
 	}
 }
+
+func TestJobTemplateLinkProperties(t *testing.T) {
+	template := &JobTemplate{
+		Content: strings.Join([]string{
+			`<%= link("db").p("db.port") %>`,
+			`<%= link('db').p('db.host', 'localhost') %>`,
+			`<%- nats = link("nats") -%>`,
+			`<%= nats.p("nats.user") %>`,
+			`<% if_link("nats") do |l| %><%= l.if_p("nats.password") { |x| x } %><% end %>`,
+			`<%= p("not.a.link") %>`,
+			`<%= unknown.p("not.a.link") %>`,
+		}, "\n"),
+	}
+	assert.Equal(t, []LinkProperty{
+		{Link: "db", Property: "db.port", Required: true},
+		{Link: "db", Property: "db.host", Required: false},
+		{Link: "nats", Property: "nats.user", Required: true},
+		{Link: "nats", Property: "nats.password", Required: false},
+	}, template.LinkProperties())
+}
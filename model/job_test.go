@@ -1,6 +1,8 @@
 package model
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"encoding/json"
 	"io/ioutil"
 	"os"
@@ -12,6 +14,7 @@ import (
 	"code.cloudfoundry.org/fissile/testhelpers"
 	"code.cloudfoundry.org/fissile/util"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -69,6 +72,7 @@ func TestDevAndFinalReleaseJob(t *testing.T) {
 	t.Run("Dev release testGetJobPropertyNotOk", testGetJobPropertyNotOk(devRelease, 3))
 	t.Run("Dev release testJobLinksOk", testJobLinksOk(devRelease))
 	t.Run("Dev release testJobsProperties", testJobsProperties(devRelease))
+	t.Run("Dev release testJobsPropertiesOverrides", testJobsPropertiesOverrides(devRelease))
 
 	t.Run("Final release testJobInfoOk", testJobInfoOk(finalRelease, finalJobInfo))
 	t.Run("Final release testJobExtractOk", testJobExtractOk(finalRelease))
@@ -268,6 +272,43 @@ func testJobsProperties(fakeRelease *Release) func(*testing.T) {
 	}
 }
 
+func testJobsPropertiesOverrides(fakeRelease *Release) func(*testing.T) {
+	return func(t *testing.T) {
+		workDir, err := os.Getwd()
+		require.NoError(t, err)
+
+		lightOpinionsPath := filepath.Join(workDir, "../test-assets/ntp-opinions/opinions.yml")
+		darkOpinionsPath := filepath.Join(workDir, "../test-assets/ntp-opinions/dark-opinions.yml")
+		opinions, err := NewOpinions(lightOpinionsPath, darkOpinionsPath)
+		require.NoError(t, err)
+
+		jobReference := &JobReference{
+			Job: fakeRelease.Jobs[0],
+			PropertyOverrides: map[string]interface{}{
+				"ntp_conf":          "override.conf",
+				"with.json.default": map[interface{}]interface{}{"other": "value"},
+			},
+		}
+		properties, err := jobReference.GetPropertiesForJob(opinions)
+		require.NoError(t, err)
+		actualJSON, err := json.Marshal(properties)
+		if assert.NoError(t, err) {
+			assert.JSONEq(t, `{
+				"ntp_conf" : "override.conf",
+				"with": {
+					"json": {
+						"default": { "other": "value" }
+					}
+				}
+			}`, string(actualJSON), "Overrides should take precedence over opinions and defaults")
+		}
+
+		jobReference.PropertyOverrides = map[string]interface{}{"tor.private_key": "secret"}
+		_, err = jobReference.GetPropertiesForJob(opinions)
+		assert.EqualError(t, err, "Property tor.private_key of job ntpd is set in the role manifest, but excluded by the dark opinions")
+	}
+}
+
 func testFinalJobsProperties(fakeRelease *Release) func(*testing.T) {
 	return func(t *testing.T) {
 		assert := assert.New(t)
@@ -427,3 +468,37 @@ func TestJobMarshal(t *testing.T) {
 		})
 	}
 }
+
+func TestJobLinkPropertiesWithoutLoading(t *testing.T) {
+	archiveFile, err := ioutil.TempFile("", "fissile-job-")
+	require.NoError(t, err)
+	defer os.Remove(archiveFile.Name())
+
+	gzipWriter := gzip.NewWriter(archiveFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range map[string]string{
+		"./job.MF":               "name: consumer\ntemplates:\n  config.erb: config/config\n  plain.erb: config/plain\n",
+		"./templates/config.erb": `port=<%= link("db").p("db.port") %>`,
+		"./templates/plain.erb":  `port=<%= p("port") %>`,
+		"./monit":                "",
+	} {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+		_, err := tarWriter.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+	require.NoError(t, archiveFile.Close())
+
+	job := &Job{Name: "consumer", Path: archiveFile.Name(), Release: &Release{}}
+	require.NoError(t, job.loadJobSpec(nil))
+	require.Len(t, job.Templates, 2)
+	for _, template := range job.Templates {
+		assert.Empty(t, template.Content, "Templates must not be loaded with the job")
+		if template.SourcePath == "config.erb" {
+			assert.Equal(t, []LinkProperty{{Link: "db", Property: "db.port", Required: true}}, template.LinkProperties())
+		} else {
+			assert.Empty(t, template.LinkProperties())
+		}
+	}
+}
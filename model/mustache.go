@@ -2,12 +2,22 @@ package model
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 
 	"code.cloudfoundry.org/fissile/mustache"
 )
 
+// Names of the variables which are set from feature flags and from the sizing
+// of instance groups rather than from their value
+var (
+	FeatureVariablePattern     = regexp.MustCompile("^FEATURE_([A-Z][A-Z_]*)_ENABLED$")
+	SizingCountVariablePattern = regexp.MustCompile("^KUBE_SIZING_([A-Z][A-Z_]*)_COUNT$")
+	SizingPortsVariablePattern = regexp.MustCompile("^KUBE_SIZING_([A-Z][A-Z_]*)_PORTS_([A-Z][A-Z_]*)_(MIN|MAX)$")
+)
+
 // MakeMapOfVariables converts the sequence of configuration variables
 // into a map we can manipulate more directly by name.
 func MakeMapOfVariables(roleManifest *RoleManifest) CVMap {
@@ -89,6 +99,25 @@ func (g *InstanceGroup) GetVariablesForRole() (Variables, error) {
 		},
 	}
 
+	// Jobs with if_feature or unless_feature need to know whether the
+	// feature is enabled, to decide at startup if they should run.
+	for _, jobReference := range g.JobReferences {
+		feature, _ := jobReference.FeatureCondition()
+		if feature == "" {
+			continue
+		}
+		name := jobReference.FeatureVariable()
+		if _, ok := configs[name]; !ok {
+			configs[name] = &VariableDefinition{
+				Name: name,
+				CVOptions: CVOptions{
+					Type:    CVTypeEnv,
+					Default: strconv.FormatBool(g.roleManifest.Features[feature]),
+				},
+			}
+		}
+	}
+
 	result := make(Variables, 0, len(configs))
 
 	for _, value := range configs {
@@ -19,8 +19,23 @@ type Package struct {
 	Release      *Release
 	Path         string
 	Dependencies Packages
+	// CompilationEnv holds extra KEY=VALUE environment variables to pass to
+	// the compilation of this package
+	CompilationEnv []string
+	// CompilationIsolation holds the parallelism cap and network mode to
+	// compile this package with, if any
+	CompilationIsolation *CompilationIsolation
+	// VerifyScripts are the paths of the scripts to run against the output
+	// of the package once compiled, the one of the release first
+	VerifyScripts []string
 
 	packageReleaseInfo map[interface{}]interface{}
+	// sourceFingerprint is the fingerprint from the release, before any
+	// compilation settings were folded in
+	sourceFingerprint string
+	// envFingerprint is the fingerprint with the compilation environment of
+	// the package folded in, but not the ones of its dependencies
+	envFingerprint string
 }
 
 // Packages is an array of *Package
@@ -43,6 +58,9 @@ func newPackage(release *Release, packageReleaseInfo map[interface{}]interface{}
 // ValidateSHA1 validates that the SHA1 of the actual package archive is the same
 // as the one from the release manifest
 func (p *Package) ValidateSHA1() error {
+	if err := p.Release.ensureArchive(p.Path); err != nil {
+		return err
+	}
 	file, err := os.Open(p.Path)
 	if err != nil {
 		return fmt.Errorf("Error opening the package archive %s for SHA1 calculation", p.Path)
@@ -75,6 +93,9 @@ func (p *Package) Extract(destination string) (string, error) {
 		return "", err
 	}
 
+	if err := p.Release.ensureArchive(p.Path); err != nil {
+		return "", err
+	}
 	if err := extractor.NewTgz().Extract(p.Path, targetDir); err != nil {
 		return "", err
 	}
@@ -163,6 +184,25 @@ func (p *Package) GetPackageCompiledTempDir(workDir string) string {
 	return filepath.Join(workDir, p.Fingerprint, "compiled-temp")
 }
 
+// GetPackageVerifyDir returns the path to the verification scripts of the
+// package, within its sources
+func (p *Package) GetPackageVerifyDir(workDir string) string {
+	return filepath.Join(p.GetTargetPackageSourcesDir(workDir), "verify")
+}
+
+// ReleaseVerifyScript returns the path of the verification script a dev
+// release provides for the package, next to its packaging script, if any.
+func (p *Package) ReleaseVerifyScript() string {
+	if p.Release == nil || p.Release.FinalRelease || p.Release.Tarball != "" || p.Release.Path == "" {
+		return ""
+	}
+	script := filepath.Join(p.Release.Path, packagesDir, p.Name, "verify")
+	if info, err := os.Stat(script); err != nil || info.IsDir() {
+		return ""
+	}
+	return script
+}
+
 // GetPackageCompiledDir returns the path to the build result
 // directory of the package, underneath the main cache directory
 func (p *Package) GetPackageCompiledDir(workDir string) string {
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PackageOverrides changes the packages installed in the image of an
+// instance group, e.g. to leave out packages its jobs only need at build
+// time.  The jobs of the instance group must not need excluded packages at
+// runtime, as nothing checks that they do not.
+type PackageOverrides struct {
+	Exclude    []string          `yaml:"exclude,omitempty"`    // Packages left out of the image
+	Substitute map[string]string `yaml:"substitute,omitempty"` // Packages replaced by others, as [release/]package
+}
+
+// PackageLink is a package installed in the image of an instance group,
+// under the name its jobs know it by, which differs for substitutes
+type PackageLink struct {
+	Name    string   // The name of the package in /var/vcap/packages
+	Package *Package // The package installed under that name
+}
+
+// Excludes returns whether the package is excluded from the image
+func (o *PackageOverrides) Excludes(packageName string) bool {
+	if o == nil {
+		return false
+	}
+	for _, name := range o.Exclude {
+		if name == packageName {
+			return true
+		}
+	}
+	return false
+}
+
+// Signature returns the overrides as a string, stable across map orders,
+// for the dev version of the instance group
+func (o *PackageOverrides) Signature() string {
+	if o == nil {
+		return ""
+	}
+	excluded := append([]string{}, o.Exclude...)
+	sort.Strings(excluded)
+	substituted := make([]string, 0, len(o.Substitute))
+	for name, substitute := range o.Substitute {
+		substituted = append(substituted, name+"="+substitute)
+	}
+	sort.Strings(substituted)
+	return fmt.Sprintf("exclude:%s\nsubstitute:%s", strings.Join(excluded, ","), strings.Join(substituted, ","))
+}
+
+// LookupSubstitute returns the package replacing the given package in the
+// image of the instance group, or nil if it is not substituted.  Substitutes
+// without a release name come from the release of the replaced package.
+func (g *InstanceGroup) LookupSubstitute(pkg *Package) (*Package, error) {
+	if g.PackageOverrides == nil {
+		return nil, nil
+	}
+	substitute, ok := g.PackageOverrides.Substitute[pkg.Name]
+	if !ok {
+		return nil, nil
+	}
+
+	releaseName := pkg.Release.Name
+	packageName := substitute
+	if parts := strings.SplitN(substitute, "/", 2); len(parts) == 2 {
+		releaseName, packageName = parts[0], parts[1]
+	}
+	if g.roleManifest != nil {
+		for _, release := range g.roleManifest.LoadedReleases {
+			if release.Name == releaseName {
+				return release.LookupPackage(packageName)
+			}
+		}
+	}
+	return nil, fmt.Errorf("Cannot find release %s", releaseName)
+}
+
+// PackageLinks returns the packages of the job installed in the image of the
+// instance group: excluded packages are left out, and substituted ones are
+// replaced.  Packages whose substitute cannot be found are kept; the role
+// manifest validation reports them.
+func (g *InstanceGroup) PackageLinks(jobReference *JobReference) []PackageLink {
+	links := make([]PackageLink, 0, len(jobReference.Packages))
+	for _, pkg := range jobReference.Packages {
+		if g.PackageOverrides.Excludes(pkg.Name) {
+			continue
+		}
+		link := PackageLink{Name: pkg.Name, Package: pkg}
+		if substitute, err := g.LookupSubstitute(pkg); err == nil && substitute != nil {
+			link.Package = substitute
+		}
+		links = append(links, link)
+	}
+	return links
+}
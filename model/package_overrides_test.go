@@ -0,0 +1,103 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPackageOverridesInstanceGroup(overrides *PackageOverrides) *InstanceGroup {
+	tor := &Release{Name: "tor"}
+	other := &Release{Name: "other"}
+	tor.Packages = Packages{
+		{Name: "libevent", Fingerprint: "libevent-fp", SHA1: "libevent-sha1", Release: tor},
+		{Name: "tor", Fingerprint: "tor-fp", SHA1: "tor-sha1", Release: tor},
+		{Name: "golang", Fingerprint: "golang-fp", SHA1: "golang-sha1", Release: tor},
+		{Name: "tor-slim", Fingerprint: "tor-slim-fp", SHA1: "tor-slim-sha1", Release: tor},
+	}
+	other.Packages = Packages{{Name: "libevent", Fingerprint: "other-libevent-fp", SHA1: "other-libevent-sha1", Release: other}}
+
+	instanceGroup := &InstanceGroup{
+		Name: "myrole",
+		JobReferences: JobReferences{{
+			Name: "tor",
+			Job: &Job{
+				Name:        "tor",
+				Fingerprint: "job-fp",
+				SHA1:        "job-sha1",
+				Packages:    Packages{tor.Packages[0], tor.Packages[1], tor.Packages[2]},
+			},
+		}},
+		PackageOverrides: overrides,
+	}
+	instanceGroup.SetRoleManifest(&RoleManifest{LoadedReleases: Releases{tor, other}})
+	return instanceGroup
+}
+
+func TestPackageLinks(t *testing.T) {
+	t.Parallel()
+
+	instanceGroup := newPackageOverridesInstanceGroup(nil)
+	links := instanceGroup.PackageLinks(instanceGroup.JobReferences[0])
+	require.Len(t, links, 3)
+	for i, name := range []string{"libevent", "tor", "golang"} {
+		assert.Equal(t, name, links[i].Name)
+		assert.Equal(t, name, links[i].Package.Name)
+	}
+
+	instanceGroup = newPackageOverridesInstanceGroup(&PackageOverrides{
+		Exclude:    []string{"golang"},
+		Substitute: map[string]string{"tor": "tor-slim", "libevent": "other/libevent"},
+	})
+	links = instanceGroup.PackageLinks(instanceGroup.JobReferences[0])
+	require.Len(t, links, 2)
+	assert.Equal(t, "libevent", links[0].Name)
+	assert.Equal(t, "other-libevent-fp", links[0].Package.Fingerprint)
+	assert.Equal(t, "tor", links[1].Name)
+	assert.Equal(t, "tor-slim", links[1].Package.Name)
+}
+
+func TestLookupSubstitute(t *testing.T) {
+	t.Parallel()
+
+	instanceGroup := newPackageOverridesInstanceGroup(&PackageOverrides{
+		Substitute: map[string]string{"tor": "missing/tor"},
+	})
+	pkg := instanceGroup.JobReferences[0].Packages[0]
+	substitute, err := instanceGroup.LookupSubstitute(pkg)
+	assert.NoError(t, err)
+	assert.Nil(t, substitute, "libevent is not substituted")
+
+	pkg = instanceGroup.JobReferences[0].Packages[1]
+	_, err = instanceGroup.LookupSubstitute(pkg)
+	assert.EqualError(t, err, "Cannot find release missing")
+
+	links := instanceGroup.PackageLinks(instanceGroup.JobReferences[0])
+	require.Len(t, links, 3)
+	assert.Equal(t, pkg, links[1].Package, "Packages without a substitute are kept")
+}
+
+func TestPackageOverridesDevVersion(t *testing.T) {
+	t.Parallel()
+
+	devVersion := func(overrides *PackageOverrides) string {
+		version, err := newPackageOverridesInstanceGroup(overrides).GetRoleDevVersion(nil, "", "", RoleImageOptions{}, nil)
+		require.NoError(t, err)
+		return version
+	}
+
+	unchanged := devVersion(nil)
+	excluded := devVersion(&PackageOverrides{Exclude: []string{"golang"}})
+	substituted := devVersion(&PackageOverrides{Substitute: map[string]string{"tor": "tor-slim"}})
+	// Linking libevent in place of tor changes no package of the image
+	relinked := devVersion(&PackageOverrides{Substitute: map[string]string{"tor": "libevent"}})
+	excludedTor := devVersion(&PackageOverrides{Exclude: []string{"tor"}})
+
+	assert.NotEqual(t, unchanged, excluded)
+	assert.NotEqual(t, unchanged, substituted)
+	assert.NotEqual(t, excluded, substituted)
+	assert.NotEqual(t, relinked, excludedTor)
+	assert.Equal(t, excluded, devVersion(&PackageOverrides{Exclude: []string{"golang"}, Substitute: map[string]string{}}),
+		"An empty list of substitutes is no change")
+}
@@ -0,0 +1,188 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+)
+
+// Memory and cpu of the run section are given either as plain numbers, in
+// MiB and cores, or as Kubernetes resource quantities with a suffix, like
+// "1Gi", "512M", or "250m".  Quantities are normalized to MiB (rounded up)
+// and cores, and kept as written, to be emitted verbatim into the kube
+// configs and helm charts.
+
+// quantityPattern matches the resource quantities with a suffix or an
+// exponent, as understood by Kubernetes
+var quantityPattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]*)?|\.[0-9]+)(?:[eE]([+-]?[0-9]+)|(Ki|Mi|Gi|Ti|Pi|Ei|n|u|m|k|M|G|T|P|E))$`)
+
+// plainNumberPattern matches the numbers without a suffix, which keep the
+// units of the field
+var plainNumberPattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]*)?|\.[0-9]+)$`)
+
+// quantitySuffixes are the multipliers of the suffixes of quantities
+var quantitySuffixes = map[string]*big.Rat{
+	"Ki": new(big.Rat).SetInt64(1 << 10),
+	"Mi": new(big.Rat).SetInt64(1 << 20),
+	"Gi": new(big.Rat).SetInt64(1 << 30),
+	"Ti": new(big.Rat).SetInt64(1 << 40),
+	"Pi": new(big.Rat).SetInt64(1 << 50),
+	"Ei": new(big.Rat).SetInt64(1 << 60),
+	"n":  big.NewRat(1, 1000000000),
+	"u":  big.NewRat(1, 1000000),
+	"m":  big.NewRat(1, 1000),
+	"k":  new(big.Rat).SetInt64(1e3),
+	"M":  new(big.Rat).SetInt64(1e6),
+	"G":  new(big.Rat).SetInt64(1e9),
+	"T":  new(big.Rat).SetInt64(1e12),
+	"P":  new(big.Rat).SetInt64(1e15),
+	"E":  new(big.Rat).SetInt64(1e18),
+}
+
+// mebibyte is the number of bytes of a MiB
+var mebibyte = new(big.Rat).SetInt64(1 << 20)
+
+// ParseQuantity returns the value of a resource quantity, in base units
+// (bytes or cores)
+func ParseQuantity(quantity string) (*big.Rat, error) {
+	match := quantityPattern.FindStringSubmatch(quantity)
+	if match == nil {
+		return nil, fmt.Errorf("'%s' is not a non-negative quantity like 1Gi, 512M, or 250m", quantity)
+	}
+	value, ok := new(big.Rat).SetString(match[1])
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a non-negative quantity like 1Gi, 512M, or 250m", quantity)
+	}
+	if match[2] != "" {
+		exponent, err := strconv.Atoi(match[2])
+		if err != nil || exponent > 18 || exponent < -9 {
+			return nil, fmt.Errorf("The exponent of '%s' is out of range", quantity)
+		}
+		scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(math.Abs(float64(exponent)))), nil))
+		if exponent < 0 {
+			scale.Inv(scale)
+		}
+		value.Mul(value, scale)
+	}
+	if match[3] != "" {
+		value.Mul(value, quantitySuffixes[match[3]])
+	}
+	return value, nil
+}
+
+// parseMemorySize returns the size in MiB of a memory value of the role
+// manifest, and the quantity it was written as, if any.  Nil values are not
+// set.
+func parseMemorySize(value interface{}) (*int64, string, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, "", nil
+	case int:
+		size := int64(value)
+		return &size, "", nil
+	case float64:
+		if value == math.Trunc(value) {
+			size := int64(value)
+			return &size, "", nil
+		}
+	case string:
+		if plainNumberPattern.MatchString(value) {
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, "", fmt.Errorf("'%s' is not a whole number of MiB", value)
+			}
+			return &size, "", nil
+		}
+		bytes, err := ParseQuantity(value)
+		if err != nil {
+			return nil, "", err
+		}
+		mib := new(big.Rat).Quo(bytes, mebibyte)
+		// Round up to whole MiB, so the normalized size covers the quantity
+		size := new(big.Int).Quo(mib.Num(), mib.Denom())
+		if !mib.IsInt() {
+			size.Add(size, big.NewInt(1))
+		}
+		if !size.IsInt64() {
+			return nil, "", fmt.Errorf("'%s' is too large", value)
+		}
+		result := size.Int64()
+		return &result, value, nil
+	}
+	return nil, "", fmt.Errorf("'%v' is neither a number of MiB nor a quantity", value)
+}
+
+// parseCPUCores returns the cores of a cpu value of the role manifest, and
+// the quantity it was written as, if any.  Nil values are not set.
+func parseCPUCores(value interface{}) (*float64, string, error) {
+	switch value := value.(type) {
+	case nil:
+		return nil, "", nil
+	case int:
+		cores := float64(value)
+		return &cores, "", nil
+	case float64:
+		return &value, "", nil
+	case string:
+		if plainNumberPattern.MatchString(value) {
+			cores, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, "", err
+			}
+			return &cores, "", nil
+		}
+		quantity, err := ParseQuantity(value)
+		if err != nil {
+			return nil, "", err
+		}
+		cores, _ := quantity.Float64()
+		return &cores, value, nil
+	}
+	return nil, "", fmt.Errorf("'%v' is neither a number of cores nor a quantity", value)
+}
+
+// UnmarshalYAML reads the request and limit of the memory as MiB or
+// quantities
+func (m *RoleRunMemory) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var fields struct {
+		Request interface{} `yaml:"request"`
+		Limit   interface{} `yaml:"limit"`
+	}
+	if err := unmarshal(&fields); err != nil {
+		return err
+	}
+	var err error
+	m.Request, m.RequestQuantity, err = parseMemorySize(fields.Request)
+	if err != nil {
+		return fmt.Errorf("Invalid memory request: %v", err)
+	}
+	m.Limit, m.LimitQuantity, err = parseMemorySize(fields.Limit)
+	if err != nil {
+		return fmt.Errorf("Invalid memory limit: %v", err)
+	}
+	return nil
+}
+
+// UnmarshalYAML reads the request and limit of the cpu as cores or
+// quantities
+func (c *RoleRunCPU) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var fields struct {
+		Request interface{} `yaml:"request"`
+		Limit   interface{} `yaml:"limit"`
+	}
+	if err := unmarshal(&fields); err != nil {
+		return err
+	}
+	var err error
+	c.Request, c.RequestQuantity, err = parseCPUCores(fields.Request)
+	if err != nil {
+		return fmt.Errorf("Invalid cpu request: %v", err)
+	}
+	c.Limit, c.LimitQuantity, err = parseCPUCores(fields.Limit)
+	if err != nil {
+		return fmt.Errorf("Invalid cpu limit: %v", err)
+	}
+	return nil
+}
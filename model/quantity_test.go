@@ -0,0 +1,66 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestParseQuantity(t *testing.T) {
+	t.Parallel()
+
+	for quantity, expected := range map[string]string{
+		"1Gi":  "1073741824",
+		"512M": "512000000",
+		"250m": "1/4",
+		"1.5k": "1500",
+		"2e3":  "2000",
+		"1e-3": "1/1000",
+		".5Ki": "512",
+	} {
+		value, err := ParseQuantity(quantity)
+		if assert.NoError(t, err, quantity) {
+			assert.Equal(t, expected, value.RatString(), quantity)
+		}
+	}
+
+	for _, quantity := range []string{"", "512", "-1Gi", "1GB", "1e3Mi", "Gi"} {
+		_, err := ParseQuantity(quantity)
+		assert.Error(t, err, quantity)
+	}
+}
+
+func TestRoleRunQuantities(t *testing.T) {
+	t.Parallel()
+
+	var run RoleRun
+	require.NoError(t, yaml.Unmarshal([]byte(`
+mem:
+  request: 1Gi
+  limit: 1500
+cpu:
+  request: 250m
+  limit: 2
+`), &run))
+
+	require.NotNil(t, run.Memory)
+	assert.Equal(t, int64(1024), *run.Memory.Request)
+	assert.Equal(t, "1Gi", run.Memory.RequestQuantity)
+	assert.Equal(t, int64(1500), *run.Memory.Limit)
+	assert.Equal(t, "", run.Memory.LimitQuantity, "Plain numbers are in MiB")
+	require.NotNil(t, run.CPU)
+	assert.Equal(t, 0.25, *run.CPU.Request)
+	assert.Equal(t, "250m", run.CPU.RequestQuantity)
+	assert.Equal(t, 2.0, *run.CPU.Limit)
+
+	require.NoError(t, yaml.Unmarshal([]byte("mem: {request: 1000M}\n"), &run))
+	assert.Equal(t, int64(954), *run.Memory.Request, "Sizes are rounded up to whole MiB")
+	assert.Nil(t, run.Memory.Limit)
+
+	err := yaml.Unmarshal([]byte("mem: {limit: 1GB}\n"), &run)
+	assert.EqualError(t, err, "Invalid memory limit: '1GB' is not a non-negative quantity like 1Gi, 512M, or 250m")
+	err = yaml.Unmarshal([]byte("cpu: {request: [1]}\n"), &run)
+	assert.EqualError(t, err, "Invalid cpu request: '[1]' is neither a number of cores nor a quantity")
+}
@@ -34,7 +34,10 @@ type Release struct {
 	Path               string
 	DevBOSHCacheDir    string
 	FinalRelease       bool
-	manifest           manifest
+	// Tarball is the release tarball the release was read from, if any
+	Tarball  string
+	manifest manifest
+	tarball  *releaseTarball
 }
 
 type manifest struct {
@@ -143,8 +146,9 @@ func (r *Release) loadJobs() (err error) {
 		}
 	}()
 
+	cache := loadReleaseMetadataCache(r)
 	for _, job := range r.manifest.Jobs {
-		j, err := newJob(r, job)
+		j, err := newJob(r, job, cache)
 		if err != nil {
 			return err
 		}
@@ -152,6 +156,7 @@ func (r *Release) loadJobs() (err error) {
 		r.Jobs = append(r.Jobs, j)
 	}
 
+	cache.save()
 	return nil
 }
 
@@ -186,28 +191,24 @@ func (r *Release) loadDependenciesForPackages() error {
 func (r *Release) loadLicense() error {
 	r.License.Files = make(map[string][]byte)
 
-	licenseFile, err := os.Open(r.licensePath())
-	if os.IsNotExist(err) {
-		// There were never licenses to load.
-		return nil
-	}
-	if err != nil {
-		return err
-	}
-	defer licenseFile.Close()
+	for _, licensePath := range r.licensePaths() {
+		licenseContents, err := ioutil.ReadFile(licensePath)
+		if os.IsNotExist(err) {
+			// There were never licenses to load.
+			continue
+		}
+		if err != nil {
+			return err
+		}
 
-	licenseContents, err := ioutil.ReadFile(r.licensePath())
-	if err != nil {
-		return err
-	}
+		licenseFilePath, err := filepath.Rel(r.Path, licensePath)
+		if err != nil {
+			return err
+		}
 
-	licenseFilePath, err := filepath.Rel(r.Path, r.licensePath())
-	if err != nil {
-		return err
+		r.License.Files[licenseFilePath] = licenseContents
 	}
 
-	r.License.Files[licenseFilePath] = licenseContents
-
 	return nil
 }
 
@@ -227,8 +228,13 @@ func (r *Release) validatePathStructure() error {
 	return util.ValidatePath(r.jobsDirPath(), true, "jobs directory")
 }
 
-func (r *Release) licensePath() string {
-	return filepath.Join(r.Path, "LICENSE")
+// licensePaths returns the paths of the LICENSE and NOTICE files of the release
+func (r *Release) licensePaths() []string {
+	var paths []string
+	for _, name := range util.DefaultLicensePrefixFilters {
+		paths = append(paths, filepath.Join(r.Path, name))
+	}
+	return paths
 }
 
 func (r *Release) packagesDirPath() string {
@@ -0,0 +1,142 @@
+package model
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ReleaseMetadataCacheDir is the directory where the metadata read from the
+// job archives of releases is cached between invocations, so that loading a
+// release only needs to read the archives of jobs which changed.  Caching
+// is disabled when it is empty.
+var ReleaseMetadataCacheDir string
+
+// releaseMetadataCacheVersion is incremented whenever the format of the cache
+// changes; caches of other versions are ignored.
+const releaseMetadataCacheVersion = 3
+
+// jobArchiveContents are the parts of a job archive fissile reads when loading
+// a release: the job spec (job.MF), and the link properties read by the
+// templates, keyed by their source path.  Templates are read on demand.
+type jobArchiveContents struct {
+	Spec           string                    `json:"spec"`
+	LinkProperties map[string][]LinkProperty `json:"link_properties,omitempty"`
+}
+
+// cachedJob is the cache entry for a job; the SHA1 of the archive must match.
+type cachedJob struct {
+	SHA1     string              `json:"sha1"`
+	Contents *jobArchiveContents `json:"contents"`
+}
+
+// releaseMetadataCache holds the contents of the job archives of one release,
+// keyed by the path of the release and the SHA1 of its release manifest.  A
+// nil cache (when caching is disabled) never has entries.
+type releaseMetadataCache struct {
+	Version      int                   `json:"version"`
+	Path         string                `json:"path"`
+	ManifestSHA1 string                `json:"manifest_sha1"`
+	Jobs         map[string]*cachedJob `json:"jobs"`
+
+	fileName string
+	changed  bool
+}
+
+// loadReleaseMetadataCache returns the metadata cache of the release.  A
+// missing, unreadable or outdated cache file results in an empty cache.
+func loadReleaseMetadataCache(r *Release) *releaseMetadataCache {
+	if ReleaseMetadataCacheDir == "" {
+		return nil
+	}
+	manifestContents, err := ioutil.ReadFile(r.ManifestFilePath())
+	if err != nil {
+		return nil
+	}
+	path, err := filepath.Abs(r.Path)
+	if err != nil {
+		return nil
+	}
+
+	fresh := &releaseMetadataCache{
+		Version:      releaseMetadataCacheVersion,
+		Path:         path,
+		ManifestSHA1: fmt.Sprintf("%x", sha1.Sum(manifestContents)),
+		Jobs:         make(map[string]*cachedJob),
+	}
+	key := sha256.Sum256([]byte(fresh.Path + "\x00" + fresh.ManifestSHA1))
+	fresh.fileName = filepath.Join(ReleaseMetadataCacheDir, fmt.Sprintf("%x.json", key))
+
+	contents, err := ioutil.ReadFile(fresh.fileName)
+	if err != nil {
+		return fresh
+	}
+	cache := &releaseMetadataCache{}
+	if err := json.Unmarshal(contents, cache); err != nil ||
+		cache.Version != fresh.Version ||
+		cache.Path != fresh.Path ||
+		cache.ManifestSHA1 != fresh.ManifestSHA1 ||
+		cache.Jobs == nil {
+		return fresh
+	}
+	cache.fileName = fresh.fileName
+	return cache
+}
+
+// lookup returns the cached contents of the archive of the job, if any.
+func (c *releaseMetadataCache) lookup(job *Job) (*jobArchiveContents, bool) {
+	if c == nil {
+		return nil, false
+	}
+	entry, ok := c.Jobs[job.Name]
+	if !ok || entry.SHA1 != job.SHA1 || entry.Contents == nil {
+		return nil, false
+	}
+	return entry.Contents, true
+}
+
+// store adds the contents of the archive of the job to the cache.
+func (c *releaseMetadataCache) store(job *Job, contents *jobArchiveContents) {
+	if c == nil {
+		return
+	}
+	c.Jobs[job.Name] = &cachedJob{SHA1: job.SHA1, Contents: contents}
+	c.changed = true
+}
+
+// save writes the cache if it changed.  The cache is an optimization only,
+// so failures are ignored; the next invocation reads the archives again.
+func (c *releaseMetadataCache) save() {
+	if c == nil || !c.changed {
+		return
+	}
+	contents, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(ReleaseMetadataCacheDir, 0755); err != nil {
+		return
+	}
+	// Write to a temporary file first, so concurrent invocations never
+	// read a partially written cache.
+	tempFile, err := ioutil.TempFile(ReleaseMetadataCacheDir, ".release-cache-")
+	if err != nil {
+		return
+	}
+	_, err = tempFile.Write(contents)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), c.fileName)
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return
+	}
+	c.changed = false
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleaseMetadataCache(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	cacheDir, err := ioutil.TempDir("", "fissile-release-cache-")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	ReleaseMetadataCacheDir = cacheDir
+	defer func() { ReleaseMetadataCacheDir = "" }()
+
+	ntpReleasePath := filepath.Join(workDir, "../test-assets/ntp-release")
+	ntpReleasePathBoshCache := filepath.Join(workDir, "../test-assets/bosh-cache")
+	release, err := NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	require.NoError(t, err)
+	job, err := release.LookupJob("ntpd")
+	require.NoError(t, err)
+	require.NotEmpty(t, job.Description)
+
+	cacheFiles, err := filepath.Glob(filepath.Join(cacheDir, "*.json"))
+	require.NoError(t, err)
+	require.Len(t, cacheFiles, 1, "Expected one cache file for the release")
+
+	// Change the cached job spec, to check that it is used instead of the
+	// job archive
+	contents, err := ioutil.ReadFile(cacheFiles[0])
+	require.NoError(t, err)
+	var cache releaseMetadataCache
+	require.NoError(t, json.Unmarshal(contents, &cache))
+	require.Contains(t, cache.Jobs, "ntpd")
+	require.Contains(t, cache.Jobs["ntpd"].Contents.Spec, job.Description)
+	cache.Jobs["ntpd"].Contents.Spec = strings.Replace(cache.Jobs["ntpd"].Contents.Spec, job.Description, "cached description", 1)
+	contents, err = json.Marshal(&cache)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(cacheFiles[0], contents, 0644))
+
+	release, err = NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	require.NoError(t, err)
+	job, err = release.LookupJob("ntpd")
+	require.NoError(t, err)
+	assert.Equal(t, "cached description", job.Description)
+
+	// Entries for other versions of the job are ignored
+	cache.Jobs["ntpd"].SHA1 = "outdated"
+	contents, err = json.Marshal(&cache)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(cacheFiles[0], contents, 0644))
+
+	release, err = NewDevRelease(ntpReleasePath, "", "", ntpReleasePathBoshCache)
+	require.NoError(t, err)
+	job, err = release.LookupJob("ntpd")
+	require.NoError(t, err)
+	assert.NotEqual(t, "cached description", job.Description)
+}
@@ -1,5 +1,7 @@
 package model
 
+import "code.cloudfoundry.org/fissile/util"
+
 // ReleaseOptions for releases
 type ReleaseOptions struct {
 	ReleasePaths     []string
@@ -7,6 +9,10 @@ type ReleaseOptions struct {
 	ReleaseVersions  []string
 	BOSHCacheDir     string
 	FinalReleasesDir string
+	// Offline forbids downloading releases which are not available locally
+	Offline bool
+	// RetryPolicy is used for downloading releases
+	RetryPolicy util.RetryPolicy
 }
 
 // ReleaseResolver loads job specs from releases and acts as a registry for
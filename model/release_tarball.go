@@ -0,0 +1,212 @@
+package model
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"code.cloudfoundry.org/fissile/util"
+)
+
+// releaseTarball is the tarball a release was read from.  The release.MF and
+// LICENSE files, and the job archives, are extracted when the release is
+// loaded; package archives are only extracted when they are needed, so that
+// packages which are compiled already never take up any disk space.
+type releaseTarball struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// IsReleaseTarball returns true if the path is a file rather than a directory,
+// which is then expected to be a release tarball.
+func IsReleaseTarball(releasePath string) bool {
+	info, err := os.Stat(releasePath)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// NewFinalReleaseFromTarball will create an instance of a BOSH release from a
+// release tarball, as created by `bosh create-release --tarball`.  The parts
+// of the tarball which are needed are extracted into a directory underneath
+// cacheDir, which is reused as long as the tarball does not change.
+func NewFinalReleaseFromTarball(tarballPath, cacheDir string) (*Release, error) {
+	if cacheDir == "" {
+		return nil, fmt.Errorf("No directory to extract release tarball %s into", tarballPath)
+	}
+	tarballPath, err := filepath.Abs(tarballPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(tarballPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Key the extracted files by the tarball, so that a changed tarball
+	// is never mixed up with files extracted from a previous one.
+	key := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d", tarballPath, info.Size(), info.ModTime().UnixNano())))
+	baseName := filepath.Base(tarballPath)
+	for _, extension := range []string{".tgz", ".tar.gz"} {
+		baseName = strings.TrimSuffix(baseName, extension)
+	}
+
+	release := &Release{
+		Path:         filepath.Join(cacheDir, fmt.Sprintf("%s-%x", baseName, key[:8])),
+		FinalRelease: true,
+		Tarball:      tarballPath,
+		tarball:      &releaseTarball{path: tarballPath},
+	}
+
+	if err := release.tarball.extract(release.Path, []string{manifestFile, "LICENSE"}, true); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(release.ManifestFilePath()); err != nil {
+		return nil, fmt.Errorf("Release tarball %s has no %s", tarballPath, manifestFile)
+	}
+
+	if err := release.loadFinalRelease(); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// extractJobArchives extracts the archives of all jobs of a release read from
+// a tarball, in one pass over the tarball.  Job archives are small, and they
+// are needed to load the job specs.
+func (r *Release) extractJobArchives() error {
+	if r.tarball == nil {
+		return nil
+	}
+	var names []string
+	for _, job := range r.manifest.Jobs {
+		if name, ok := job["name"].(string); ok {
+			names = append(names, path.Join(jobsDir, name+".tgz"))
+		}
+	}
+	return r.tarball.extract(r.Path, names, false)
+}
+
+// ExtractArchives makes sure the archives of the packages are available on
+// disk, extracting those of releases read from a tarball in one pass over each
+// tarball.  Packages of other releases are left alone.
+func (slice Packages) ExtractArchives() error {
+	names := make(map[*Release][]string)
+	var releases []*Release
+	for _, pkg := range slice {
+		if pkg.Release == nil || pkg.Release.tarball == nil {
+			continue
+		}
+		if _, ok := names[pkg.Release]; !ok {
+			releases = append(releases, pkg.Release)
+		}
+		names[pkg.Release] = append(names[pkg.Release], path.Join(packagesDir, pkg.Name+".tgz"))
+	}
+	for _, release := range releases {
+		if err := release.tarball.extract(release.Path, names[release], false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureArchive makes sure the archive at the given path within the release
+// is available on disk.
+func (r *Release) ensureArchive(archivePath string) error {
+	if r == nil || r.tarball == nil {
+		return nil
+	}
+	name, err := filepath.Rel(r.Path, archivePath)
+	if err != nil {
+		return err
+	}
+	return r.tarball.extract(r.Path, []string{filepath.ToSlash(name)}, false)
+}
+
+// extract extracts the named files of the tarball into the directory, unless
+// they were extracted before.  Missing files are an error unless optional is
+// set.
+func (t *releaseTarball) extract(dir string, names []string, optional bool) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); os.IsNotExist(err) {
+			wanted[name] = true
+		}
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+	if optional {
+		// Optional files are looked for once only; the marker records
+		// that the tarball was read.
+		if _, err := os.Stat(filepath.Join(dir, ".extracted")); err == nil {
+			return nil
+		}
+	}
+
+	file, err := os.Open(t.path)
+	if err != nil {
+		return fmt.Errorf("Error reading release tarball %s: %s", t.path, err)
+	}
+	defer file.Close()
+
+	err = util.TargzIterate(t.path, file, func(reader *tar.Reader, header *tar.Header) error {
+		name := path.Clean(header.Name)
+		if header.Typeflag != tar.TypeReg || !wanted[name] {
+			return nil
+		}
+		if err := extractFile(reader, filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			return fmt.Errorf("Error extracting %s from release tarball %s: %s", name, t.path, err)
+		}
+		delete(wanted, name)
+		if len(wanted) == 0 {
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	if optional {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(dir, ".extracted"), nil, 0644)
+	}
+	for name := range wanted {
+		return fmt.Errorf("Release tarball %s has no %s", t.path, name)
+	}
+	return nil
+}
+
+// extractFile writes the contents of the reader to the path, through a
+// temporary file so that an interrupted extraction leaves no partial file.
+func extractFile(reader io.Reader, destination string) error {
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return err
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(destination), ".extract-")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tempFile, reader)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), destination)
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+	}
+	return err
+}
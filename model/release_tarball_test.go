@@ -0,0 +1,112 @@
+package model
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeReleaseTarball packs the release directory into a tarball, with the
+// "./"-prefixed names `bosh create-release --tarball` uses.
+func writeReleaseTarball(t *testing.T, releasePath, tarballPath string) {
+	file, err := os.Create(tarballPath)
+	require.NoError(t, err)
+	defer file.Close()
+	gzipWriter := gzip.NewWriter(file)
+	defer gzipWriter.Close()
+	tarWriter := tar.NewWriter(gzipWriter)
+	defer tarWriter.Close()
+
+	err = filepath.Walk(releasePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(releasePath, path)
+		if err != nil {
+			return err
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		err = tarWriter.WriteHeader(&tar.Header{
+			Name:     "./" + filepath.ToSlash(name),
+			Mode:     0644,
+			Size:     int64(len(contents)),
+			Typeflag: tar.TypeReg,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tarWriter.Write(contents)
+		return err
+	})
+	require.NoError(t, err)
+}
+
+func TestFinalReleaseFromTarball(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+	tempDir, err := ioutil.TempDir("", "fissile-release-tarball-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	tarballPath := filepath.Join(tempDir, "ntp-4.tgz")
+	writeReleaseTarball(t, filepath.Join(workDir, "../test-assets/ntp-final-release"), tarballPath)
+	assert.True(t, IsReleaseTarball(tarballPath))
+	assert.False(t, IsReleaseTarball(tempDir))
+
+	cacheDir := filepath.Join(tempDir, "cache")
+	release, err := NewFinalReleaseFromTarball(tarballPath, cacheDir)
+	require.NoError(t, err)
+	assert.Equal(t, "ntp", release.Name)
+	assert.Equal(t, "4", release.Version)
+	assert.Equal(t, tarballPath, release.Tarball)
+	assert.Contains(t, string(release.License.Files["LICENSE"]), "unencumbered")
+
+	job, err := release.LookupJob("ntpd")
+	require.NoError(t, err)
+	assert.NoError(t, job.ValidateSHA1(), "Job archives are extracted when loading")
+
+	pkg, err := release.LookupPackage("ntp")
+	require.NoError(t, err)
+	_, err = os.Stat(pkg.Path)
+	assert.True(t, os.IsNotExist(err), "Package archives are not extracted until needed")
+	require.NoError(t, Packages{pkg}.ExtractArchives())
+	assert.NoError(t, pkg.ValidateSHA1())
+
+	// Loading the tarball again reuses what was extracted
+	again, err := NewFinalReleaseFromTarball(tarballPath, cacheDir)
+	require.NoError(t, err)
+	assert.Equal(t, release.Path, again.Path)
+
+	// A package archive is extracted on demand, too
+	require.NoError(t, os.Remove(pkg.Path))
+	extracted, err := pkg.Extract(filepath.Join(tempDir, "extracted"))
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(extracted, "packaging"))
+	assert.NoError(t, err)
+}
+
+func TestFinalReleaseFromTarballInvalid(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "fissile-release-tarball-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	emptyDir := filepath.Join(tempDir, "empty")
+	require.NoError(t, os.Mkdir(emptyDir, 0755))
+	tarballPath := filepath.Join(tempDir, "empty.tgz")
+	writeReleaseTarball(t, emptyDir, tarballPath)
+
+	_, err = NewFinalReleaseFromTarball(tarballPath, filepath.Join(tempDir, "cache"))
+	assert.EqualError(t, err, "Release tarball "+tarballPath+" has no release.MF")
+
+	_, err = NewFinalReleaseFromTarball(tarballPath, "")
+	assert.EqualError(t, err, "No directory to extract release tarball "+tarballPath+" into")
+}
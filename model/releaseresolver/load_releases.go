@@ -29,7 +29,13 @@ func LoadReleasesFromDisk(options model.ReleaseOptions) ([]*model.Release, error
 		}
 		var release *model.Release
 		var err error
-		if _, err = isFinalReleasePath(releasePath); err == nil {
+		if model.IsReleaseTarball(releasePath) {
+			// Release tarballs have the layout of final releases, whether they were created as final or dev releases.
+			release, err = model.NewFinalReleaseFromTarball(releasePath, options.FinalReleasesDir)
+			if err != nil {
+				return nil, fmt.Errorf("Error loading release tarball: %s", err.Error())
+			}
+		} else if _, err = isFinalReleasePath(releasePath); err == nil {
 			// For final releases, only can use release name and version defined in release.MF, cannot specify them through flags.
 			release, err = model.NewFinalRelease(releasePath)
 			if err != nil {
@@ -67,7 +73,7 @@ func isFinalReleasePath(releasePath string) (bool, error) {
 
 // downloadReleaseReferences downloads/builds and loads releases referenced in the
 // manifest
-func downloadReleaseReferences(releaseRefs []*model.ReleaseRef, finalReleasesDir string) ([]*model.Release, error) {
+func downloadReleaseReferences(releaseRefs []*model.ReleaseRef, finalReleasesDir string, offline bool, retryPolicy util.RetryPolicy) ([]*model.Release, error) {
 	releases := []*model.Release{}
 
 	var allErrs error
@@ -98,6 +104,13 @@ func downloadReleaseReferences(releaseRefs []*model.ReleaseRef, finalReleasesDir
 				fmt.Sprintf("%s-%s-%s", releaseRef.Name, releaseRef.Version, releaseRef.SHA1))
 
 			if _, err := os.Stat(filepath.Join(finalReleaseUnpackedPath, "release.MF")); err != nil && os.IsNotExist(err) {
+				if offline {
+					allErrs = multierror.Append(allErrs, util.NewOfflineError(
+						fmt.Sprintf("Downloading release %s version %s from %s", releaseRef.Name, releaseRef.Version, releaseRef.URL),
+						fmt.Sprintf("download it ahead of time and unpack it into %s", finalReleaseUnpackedPath)))
+					return
+				}
+
 				err = os.MkdirAll(finalReleaseUnpackedPath, 0700)
 				if err != nil {
 					allErrs = multierror.Append(allErrs, err)
@@ -118,7 +131,7 @@ func downloadReleaseReferences(releaseRefs []*model.ReleaseRef, finalReleasesDir
 				lastPercentage := 0
 
 				// download the release in a directory next to the role manifest
-				err = util.DownloadFile(finalReleaseTarballPath, releaseRef.URL, func(percentage int) {
+				err = util.DownloadFile(finalReleaseTarballPath, releaseRef.URL, retryPolicy, func(percentage int) {
 					if isaTTY {
 						bar.IncrBy(percentage - lastPercentage)
 					}
@@ -26,7 +26,7 @@ func (r *ReleaseResolver) Load(options model.ReleaseOptions, releaseRefs []*mode
 		return nil, err
 	}
 
-	embeddedReleases, err := downloadReleaseReferences(releaseRefs, options.FinalReleasesDir)
+	embeddedReleases, err := downloadReleaseReferences(releaseRefs, options.FinalReleasesDir, options.Offline, options.RetryPolicy)
 	if err != nil {
 		return nil, err
 	}
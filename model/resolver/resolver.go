@@ -2,6 +2,9 @@ package resolver
 
 import (
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"code.cloudfoundry.org/fissile/model"
 	"code.cloudfoundry.org/fissile/util"
@@ -62,7 +65,7 @@ func (r *Resolver) Resolve() (*model.RoleManifest, error) {
 
 	// Parse CVOptions
 	var definitions internalVariableDefinitions
-	err = yaml.Unmarshal(m.ManifestContent, &definitions)
+	err = yaml.Unmarshal(m.ParsedContent(), &definitions)
 	if err != nil {
 		return nil, err
 	}
@@ -91,7 +94,7 @@ func (r *Resolver) ResolveRoleManifest() error {
 	// If template keys are not strings, we need to stop early to avoid panics
 	allErrs = append(allErrs, validateTemplateKeysAndValues(m)...)
 	if len(allErrs) != 0 {
-		return allErrs
+		return m.AnnotateAnchorOrigins(allErrs)
 	}
 
 	err := r.releaseResolver.MapReleases(m.LoadedReleases)
@@ -99,6 +102,15 @@ func (r *Resolver) ResolveRoleManifest() error {
 		return err
 	}
 
+	// The compilation environment changes package fingerprints, so it must
+	// be applied before anything depends on them
+	allErrs = append(allErrs, validateCompilation(m)...)
+	allErrs = append(allErrs, validateStemcellCompatibility(m)...)
+	if len(allErrs) != 0 {
+		return m.AnnotateAnchorOrigins(allErrs)
+	}
+	applyCompilationSettings(m)
+
 	if grapher != nil {
 		for _, release := range m.LoadedReleases {
 			grapher.GraphNode("release/"+release.Name, map[string]string{"label": "release/" + release.Name})
@@ -146,10 +158,22 @@ func (r *Resolver) ResolveRoleManifest() error {
 		m.AddFeature(instanceGroup.IfFeature, false)
 		m.AddFeature(instanceGroup.UnlessFeature, false)
 
+		for _, jobReference := range instanceGroup.JobReferences {
+			if jobReference.IfFeature != "" && jobReference.UnlessFeature != "" {
+				allErrs = append(allErrs, validation.Forbidden(
+					fmt.Sprintf("instance_groups[%s].jobs[%s]", instanceGroup.Name, jobReference.Name),
+					fmt.Sprintf("if_feature[%s] and unless_feature[%s] are mutually exclusive",
+						jobReference.IfFeature, jobReference.UnlessFeature)))
+			}
+			m.AddFeature(jobReference.IfFeature, false)
+			m.AddFeature(jobReference.UnlessFeature, false)
+		}
+
 		allErrs = append(allErrs, instanceGroup.CalculateRoleRun()...)
 		allErrs = append(allErrs, validateRoleTags(instanceGroup)...)
 		allErrs = append(allErrs, validateRoleRun(instanceGroup, m)...)
 		allErrs = append(allErrs, validateJobReferences(instanceGroup)...)
+		allErrs = append(allErrs, validateDropCapabilities(instanceGroup)...)
 
 		// Count how many instance groups use a particular
 		// service account. And its roles.
@@ -180,7 +204,7 @@ func (r *Resolver) ResolveRoleManifest() error {
 	}
 
 	if len(allErrs) != 0 {
-		return allErrs
+		return m.AnnotateAnchorOrigins(allErrs)
 	}
 
 	for _, instanceGroup := range m.InstanceGroups {
@@ -189,6 +213,11 @@ func (r *Resolver) ResolveRoleManifest() error {
 		if len(errorList) != 0 {
 			allErrs = append(allErrs, errorList...)
 		}
+		for _, jobReference := range instanceGroup.JobReferences {
+			if jobReference.Job != nil {
+				jobReference.PropertyOverrides, _ = jobPropertyOverrides(jobReference)
+			}
+		}
 
 		if grapher != nil {
 			for _, jobReference := range instanceGroup.JobReferences {
@@ -209,10 +238,24 @@ func (r *Resolver) ResolveRoleManifest() error {
 		}
 		allErrs = append(allErrs, validateVariableType(m.Variables)...)
 		allErrs = append(allErrs, validateVariablePreviousNames(m.Variables)...)
+		allErrs = append(allErrs, expandRuleSets(m)...)
 		allErrs = append(allErrs, validateServiceAccounts(m)...)
+		allErrs = append(allErrs, validateClusterRoleAggregation(m)...)
+		allErrs = append(allErrs, validateMetadata(m)...)
 		allErrs = append(allErrs, validateUnusedColocatedContainerRoles(m)...)
 		allErrs = append(allErrs, validateColocatedContainerPortCollisions(m)...)
+		allErrs = append(allErrs, validateNodePortCollisions(m)...)
+		allErrs = append(allErrs, validatePortTLS(m)...)
+		allErrs = append(allErrs, validateInstanceGroupGroups(m)...)
+		allErrs = append(allErrs, validateProviderAliases(m)...)
+		allErrs = append(allErrs, validateStartupOrder(m)...)
 		allErrs = append(allErrs, validateColocatedContainerVolumeShares(m)...)
+		allErrs = append(allErrs, validateColocatedContainerPrivileges(m)...)
+		allErrs = append(allErrs, ValidateResources(m)...)
+		allErrs = append(allErrs, validateResourceBudgets(m)...)
+		allErrs = append(allErrs, validateLogSidecar(m)...)
+		allErrs = append(allErrs, validateDockerfileSnippets(m)...)
+		allErrs = append(allErrs, validatePackageOverrides(m)...)
 		allErrs = append(allErrs, validateVariableDescriptions(m)...)
 		if !r.releaseResolver.CanValidate() {
 			allErrs = append(allErrs, validateScripts(m, r.options.ValidationOptions)...)
@@ -220,12 +263,170 @@ func (r *Resolver) ResolveRoleManifest() error {
 	}
 
 	if len(allErrs) != 0 {
-		return allErrs
+		return m.AnnotateAnchorOrigins(allErrs)
 	}
 
 	return nil
 }
 
+// jobPropertyOverrides returns the properties set for a job in the role
+// manifest by the name of the property they set, and the names of those which
+// are not declared in the job spec.  Nested mappings are followed until they
+// reach the name of a declared property, whose value is then used as a whole.
+func jobPropertyOverrides(jobReference *model.JobReference) (map[string]interface{}, []string) {
+	declared := make(map[string]bool)
+	for _, property := range jobReference.Job.Properties {
+		declared[property.Name] = true
+	}
+	isPrefix := func(prefix string) bool {
+		for name := range declared {
+			if strings.HasPrefix(name, prefix+".") {
+				return true
+			}
+		}
+		return false
+	}
+
+	overrides := make(map[string]interface{})
+	var undeclared []string
+	var walk func(name string, value interface{})
+	walk = func(name string, value interface{}) {
+		if declared[name] {
+			overrides[name] = value
+			return
+		}
+		if children, ok := value.(map[interface{}]interface{}); ok && isPrefix(name) {
+			keys := make([]string, 0, len(children))
+			for key := range children {
+				keys = append(keys, fmt.Sprintf("%v", key))
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(name+"."+key, children[key])
+			}
+			return
+		}
+		undeclared = append(undeclared, name)
+	}
+
+	names := make([]string, 0, len(jobReference.ContainerProperties.Properties))
+	for name := range jobReference.ContainerProperties.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		walk(name, jobReference.ContainerProperties.Properties[name])
+	}
+
+	return overrides, undeclared
+}
+
+// applyCompilationSettings records the compilation environment, isolation
+// settings, and verification scripts of the role manifest and the releases on
+// every package of the loaded releases.
+func applyCompilationSettings(m *model.RoleManifest) {
+	for _, release := range m.LoadedReleases {
+		for _, pkg := range release.Packages {
+			pkg.VerifyScripts = nil
+			if script := pkg.ReleaseVerifyScript(); script != "" {
+				pkg.VerifyScripts = append(pkg.VerifyScripts, script)
+			}
+			if m.Compilation == nil {
+				continue
+			}
+			if env := m.Compilation.PackageEnv(pkg.Name); env != nil {
+				pkg.SetCompilationEnv(env)
+			}
+			pkg.CompilationIsolation = m.Compilation.PackageIsolation(pkg)
+			if script := m.Compilation.PackageVerifyScript(pkg.Name); script != "" {
+				pkg.VerifyScripts = append(pkg.VerifyScripts, resolveManifestPath(m, script))
+			}
+		}
+		if m.Compilation != nil {
+			model.UpdateCompilationFingerprints(release.Packages)
+		}
+	}
+}
+
+// expandRuleSets replaces the rule set references in the rules of the roles
+// and cluster roles with the rules of the rule sets.  Rules which are the
+// same as an earlier rule of the role are dropped, so that roles combining
+// rule sets do not repeat them.
+func expandRuleSets(m *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+	auth := &m.Configuration.Authorization
+
+	for _, ruleSetName := range sortedRoleNames(auth.RuleSets) {
+		for index, rule := range auth.RuleSets[ruleSetName] {
+			if rule.RuleSet != "" {
+				allErrs = append(allErrs, validation.Forbidden(
+					fmt.Sprintf("configuration.auth.rule-sets[%s][%d].rule-set", ruleSetName, index),
+					"rule sets must not include other rule sets"))
+			}
+		}
+	}
+
+	expand := func(kind string, roles map[string]model.AuthRole) {
+		for _, roleName := range sortedRoleNames(roles) {
+			var expanded model.AuthRole
+			seen := make(map[string]bool)
+			add := func(rule model.AuthRule) {
+				key := fmt.Sprintf("%q", []interface{}{rule.APIGroups, rule.Resources, rule.ResourceNames, rule.Verbs})
+				if !seen[key] {
+					seen[key] = true
+					expanded = append(expanded, rule)
+				}
+			}
+			for index, rule := range roles[roleName] {
+				if rule.RuleSet == "" {
+					add(rule)
+					continue
+				}
+				fieldPath := fmt.Sprintf("configuration.auth.%s[%s][%d]", kind, roleName, index)
+				if len(rule.APIGroups)+len(rule.Resources)+len(rule.ResourceNames)+len(rule.Verbs) > 0 {
+					allErrs = append(allErrs, validation.Forbidden(fieldPath,
+						"a rule-set reference must not have other fields"))
+					continue
+				}
+				ruleSet, ok := auth.RuleSets[rule.RuleSet]
+				if !ok {
+					allErrs = append(allErrs, validation.NotFound(fieldPath+".rule-set", rule.RuleSet))
+					continue
+				}
+				for _, ruleSetRule := range ruleSet {
+					if ruleSetRule.RuleSet == "" {
+						add(ruleSetRule)
+					}
+				}
+			}
+			roles[roleName] = expanded
+		}
+	}
+	expand("roles", auth.Roles)
+	expand("cluster-roles", auth.ClusterRoles)
+
+	return allErrs
+}
+
+// sortedRoleNames returns the names of the roles in order, for stable errors
+func sortedRoleNames(roles map[string]model.AuthRole) []string {
+	names := make([]string, 0, len(roles))
+	for name := range roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolveManifestPath returns the path of a file given relative to the role
+// manifest
+func resolveManifestPath(m *model.RoleManifest, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(m.ManifestFilePath), path)
+}
+
 // ResolveLinks examines the BOSH links specified in the job specs and maps
 // them to the correct role / job that can be looked up at runtime.
 // This method was made public so tests can have their own package and we avoid import cycles.
@@ -240,10 +441,7 @@ func (r *Resolver) ResolveLinks() validation.ErrorList {
 	for _, instanceGroup := range m.InstanceGroups {
 		for _, jobReference := range instanceGroup.JobReferences {
 			var availableProviders []string
-			serviceName := jobReference.ContainerProperties.BoshContainerization.ServiceName
-			if serviceName == "" {
-				serviceName = fmt.Sprintf("%s-%s", util.ConvertNameToKey(instanceGroup.Name), util.ConvertNameToKey(jobReference.Name))
-			}
+			serviceName := jobReference.ServiceName(instanceGroup.Name)
 			for availableName, availableProvider := range jobReference.Job.AvailableProviders {
 				availableProviders = append(availableProviders, availableName)
 				if availableProvider.Type != "" {
@@ -295,6 +493,20 @@ func (r *Resolver) ResolveLinks() validation.ErrorList {
 				if consumerInfo.Alias != "" {
 					consumerAlias = consumerInfo.Alias
 				}
+				if consumerInfo.External != nil {
+					errors = append(errors, validateExternalLink(instanceGroup, jobReference, consumerName, consumerInfo.External)...)
+					consumerInfo.Name = consumerName
+					consumerInfo.Resolution = model.LinkResolutionExternal
+					for i := range expectedConsumers {
+						if expectedConsumers[i].Name == consumerName {
+							consumerInfo.Type = expectedConsumers[i].Type
+							expectedConsumers = append(expectedConsumers[:i], expectedConsumers[i+1:]...)
+							break
+						}
+					}
+					jobReference.ResolvedConsumes[consumerName] = consumerInfo
+					continue
+				}
 				if consumerAlias == "" {
 					// There was a consumer with an explicitly empty name
 					errors = append(errors, validation.Invalid(
@@ -312,9 +524,17 @@ func (r *Resolver) ResolveLinks() validation.ErrorList {
 				}
 				if consumerInfo.Ignore {
 					delete(jobReference.ResolvedConsumes, consumerName)
+				} else if !linkAvailable(m, jobReference, provider) {
+					errors = append(errors, validation.Invalid(
+						fmt.Sprintf(`instance_group[%s].job[%s].consumes[%s]`, instanceGroup.Name, jobReference.Name, consumerName),
+						consumerAlias,
+						fmt.Sprintf(`provider job %s in instance group %s is not included under the same feature condition`,
+							provider.JobName, provider.RoleName)))
+					continue
 				} else {
 					jobReference.ResolvedConsumes[consumerName] = model.JobConsumesInfo{
 						JobLinkInfo: provider.JobLinkInfo,
+						Resolution:  model.LinkResolutionExplicit,
 					}
 				}
 				for i := range expectedConsumers {
@@ -331,12 +551,24 @@ func (r *Resolver) ResolveLinks() validation.ErrorList {
 				// same type in the whole deployment
 				var provider model.JobProvidesInfo
 				var ok bool
+				resolution := model.LinkResolutionName
 				if consumerInfo.Name != "" {
 					provider, ok = providersByName[consumerInfo.Name]
+					// Providers from jobs that may be left out are pruned
+					ok = ok && linkAvailable(m, jobReference, provider)
 				}
-				if !ok && len(providersByType[consumerInfo.Type]) == 1 {
-					provider = providersByType[consumerInfo.Type][0]
-					ok = true
+				if !ok {
+					resolution = model.LinkResolutionType
+					var available []model.JobProvidesInfo
+					for _, candidate := range providersByType[consumerInfo.Type] {
+						if linkAvailable(m, jobReference, candidate) {
+							available = append(available, candidate)
+						}
+					}
+					if len(available) == 1 {
+						provider = available[0]
+						ok = true
+					}
 				}
 				if ok {
 					name := consumerInfo.Name
@@ -349,6 +581,7 @@ func (r *Resolver) ResolveLinks() validation.ErrorList {
 					info.RoleName = provider.RoleName
 					info.JobName = provider.JobName
 					info.ServiceName = provider.ServiceName
+					info.Resolution = resolution
 					jobReference.ResolvedConsumes[name] = info
 				} else if !consumerInfo.Optional {
 					errors = append(errors, validation.Required(
@@ -359,11 +592,66 @@ func (r *Resolver) ResolveLinks() validation.ErrorList {
 		}
 	}
 
+	errors = append(errors, validateLinkProperties(m)...)
 	errors = append(errors, r.recordJobConsumers(m)...)
 
 	return errors
 }
 
+// validateExternalLink checks the external provider of a consumer, and fills
+// in the default service name of providers in another namespace.
+func validateExternalLink(instanceGroup *model.InstanceGroup, jobReference *model.JobReference, consumerName string, external *model.JobExternalLink) validation.ErrorList {
+	errors := make(validation.ErrorList, 0)
+	field := fmt.Sprintf(`instance_group[%s].job[%s].consumes[%s].external`, instanceGroup.Name, jobReference.Name, consumerName)
+
+	switch {
+	case external.Address != "" && external.Namespace != "":
+		errors = append(errors, validation.Forbidden(field, "address and namespace are mutually exclusive"))
+	case external.Address != "":
+		if external.InstanceGroup != "" || external.Job != "" || external.ServiceName != "" {
+			errors = append(errors, validation.Forbidden(field,
+				"instance_group, job, and service_name are only allowed with namespace"))
+		}
+	case external.Namespace != "":
+		if external.InstanceGroup == "" {
+			errors = append(errors, validation.Required(field+".instance_group", "required with namespace"))
+		}
+		if external.Job == "" {
+			errors = append(errors, validation.Required(field+".job", "required with namespace"))
+		}
+		if len(external.Properties) > 0 {
+			errors = append(errors, validation.Forbidden(field+".properties", "properties are imported from the provider in the namespace"))
+		}
+		if external.ServiceName == "" {
+			external.ServiceName = util.SanitizeKubeName(util.ConvertNameToKey(external.InstanceGroup+"-"+external.Job), model.MaxServiceNameLength)
+		}
+	default:
+		errors = append(errors, validation.Required(field, "either address or namespace is required"))
+	}
+
+	return errors
+}
+
+// linkAvailable returns whether the job providing a link is always included
+// when the consumer job is, i.e. the provider job has no if_feature or
+// unless_feature, or the same one as the consumer.
+func linkAvailable(m *model.RoleManifest, consumer *model.JobReference, provider model.JobProvidesInfo) bool {
+	providerGroup := m.LookupInstanceGroup(provider.RoleName)
+	if providerGroup == nil {
+		return true
+	}
+	providerJob := providerGroup.LookupJob(provider.JobName)
+	if providerJob == nil {
+		return true
+	}
+	feature, enabled := providerJob.FeatureCondition()
+	if feature == "" {
+		return true
+	}
+	consumerFeature, consumerEnabled := consumer.FeatureCondition()
+	return feature == consumerFeature && enabled == consumerEnabled
+}
+
 // recordJobConsumers examines a role manifest and records in each job what
 // roles consume it.
 func (r *Resolver) recordJobConsumers(m *model.RoleManifest) validation.ErrorList {
@@ -372,6 +660,9 @@ func (r *Resolver) recordJobConsumers(m *model.RoleManifest) validation.ErrorLis
 	for _, consumerInstanceGroup := range m.InstanceGroups {
 		for _, consumerJob := range consumerInstanceGroup.JobReferences {
 			for linkName, consumer := range consumerJob.ResolvedConsumes {
+				if consumer.External != nil {
+					continue
+				}
 				providerInstanceGroup := m.LookupInstanceGroup(consumer.RoleName)
 				if providerInstanceGroup == nil {
 					// This should not happen: we resolved a link, but can no
@@ -241,6 +241,10 @@ func TestLoadRoleManifestBadType(t *testing.T) {
 		`variables[BAR].type: Invalid value: "invalid": Expected one of certificate, password, rsa, ssh or empty`)
 	require.Contains(t, err.Error(),
 		`variables[FOO].type: Invalid value: "rsa": The rsa type is not yet supported by the secret generator`)
+	require.Contains(t, err.Error(),
+		`variables[HOME].options.length: Forbidden: The secret generator does not support setting the length of passwords`)
+	require.Contains(t, err.Error(),
+		`variables[PELERINUL].options.key_bits: Forbidden: The secret generator does not support setting the size of keys`)
 	assert.Nil(t, roleManifest)
 }
 
@@ -316,6 +320,63 @@ func TestLoadRoleManifestMissingRBACRole(t *testing.T) {
 	assert.Nil(t, roleManifest)
 }
 
+func TestLoadRoleManifestRBACRuleSets(t *testing.T) {
+	workDir, err := os.Getwd()
+	assert.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/rbac-rule-sets.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+	require.NotNil(t, roleManifest)
+
+	auth := roleManifest.Configuration.Authorization
+	readPods := model.AuthRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}}
+	assert.Equal(t, model.AuthRole{
+		readPods,
+		{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"}},
+	}, auth.Roles["first-role"])
+	assert.Equal(t, model.AuthRole{readPods}, auth.Roles["second-role"], "repeated rules should be dropped")
+	assert.True(t, auth.IsClusterRole("aggregate"))
+	assert.True(t, auth.IsClusterRole("nodes"))
+	assert.False(t, auth.IsClusterRole("first-role"))
+}
+
+func TestLoadRoleManifestRBACRuleSetsBad(t *testing.T) {
+	workDir, err := os.Getwd()
+	assert.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/rbac-rule-sets-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.Error(t, err)
+	assert.Nil(t, roleManifest)
+	for _, message := range []string{
+		`configuration.auth.rule-sets[nested][0].rule-set: Forbidden: rule sets must not include other rule sets`,
+		`configuration.auth.roles[extra-fields][0]: Forbidden: a rule-set reference must not have other fields`,
+		`configuration.auth.roles[missing][0].rule-set: Not found: "missing-set"`,
+		`configuration.auth.aggregated-cluster-roles[aggregate]: Duplicate value: "aggregate"`,
+		`configuration.auth.aggregated-cluster-roles[aggregate].selectors: Required value: aggregated cluster roles need label selectors`,
+		`configuration.auth.cluster-role-labels: Not found: "missing-cluster-role"`,
+	} {
+		assert.Contains(t, err.Error(), message)
+	}
+}
+
 func TestLoadRoleManifestRunGeneral(t *testing.T) {
 	t.Parallel()
 
@@ -352,6 +413,57 @@ func TestLoadRoleManifestRunGeneral(t *testing.T) {
 				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[http].count: Invalid value: 2: count doesn't match port range 80-82`,
 			},
 		},
+		{
+			"bosh-run-bad-port-max.yml", []string{
+				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[tcp].max: Invalid value: 1000: internal ports starting at 65000 exceed 65535`,
+			},
+		},
+		{
+			"bosh-run-bad-node-ports.yml", []string{
+				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[private].node-port: Invalid value: 30080: node ports require a public port`,
+				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[low].node-port: Invalid value: 443: node ports must be between 30000 and 32767, inclusive, for all 1 ports`,
+				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[range].node-port: Invalid value: 32760: node ports must be between 30000 and 32767, inclusive, for all 10 ports`,
+			},
+		},
+		{
+			"bosh-run-bad-log-paths.yml", []string{
+				`instance_groups[myrole].run.log-paths[1]: Invalid value: "/var/vcap/store/tor/*.log": log paths must be in /var/vcap/sys/log`,
+				`instance_groups[myrole].run.log-paths[2]: Invalid value: "tor/*.log": log paths must be in /var/vcap/sys/log`,
+			},
+		},
+		{
+			"bosh-run-bad-log-sidecar.yml", []string{
+				`configuration.log-sidecar: Unsupported value: "syslog": supported values: tail, forwarder`,
+			},
+		},
+		{
+			"dockerfile-snippet-bad.yml", []string{
+				`instance_groups[myrole].dockerfile.env: Invalid value: "BAD-NAME": environment variable names must consist of letters, digits, and underscores`,
+				`instance_groups[myrole].dockerfile.env[MULTILINE]: Invalid value: "a\nb": environment variable values must be single lines`,
+				`instance_groups[myrole].dockerfile.copy[0].source: Invalid value: "../tor-good.yml": the source must be within the assets directory`,
+				`instance_groups[myrole].dockerfile.copy[1].source: Invalid value: "missing.conf": the source does not exist in the assets directory`,
+				`instance_groups[myrole].dockerfile.copy[1].destination: Invalid value: "etc/missing.conf": the destination must be an absolute path`,
+				`instance_groups[myrole].dockerfile.run[0]: Invalid value: "": commands must be single, non-empty lines`,
+				`instance_groups[myrole].dockerfile.run[1]: Invalid value: "true\nFROM scratch": commands must be single, non-empty lines`,
+				`instance_groups[outside].dockerfile.assets: Invalid value: "../outside": the assets directory must be within the role manifest directory`,
+			},
+		},
+		{
+			"package-overrides-bad.yml", []string{
+				`instance_groups[myrole].packages.exclude: Invalid value: "openssl": not a package of the jobs of the instance group`,
+				`instance_groups[myrole].packages.substitute[libevent]: Forbidden: the package is also excluded`,
+				`instance_groups[myrole].packages.substitute[ruby]: Invalid value: "ruby": not a package of the jobs of the instance group`,
+				`instance_groups[myrole].packages.substitute[tor]: Invalid value: "nosuch": Cannot find package nosuch in release`,
+				`instance_groups[other].packages.substitute[tor]: Invalid value: "other-release/tor": Cannot find release other-release`,
+			},
+		},
+		{
+			"bosh-run-bad-metrics.yml", []string{
+				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[relative].metrics: Invalid value: "metrics": the metrics path must start with /`,
+				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[udp].metrics: Invalid value: "/metrics": metrics are served over HTTP, which needs a TCP port`,
+				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[range].metrics: Invalid value: "/metrics": metrics must be served on a single port, not a port range`,
+			},
+		},
 		{
 			"bosh-run-bad-ports.yml", []string{
 				`instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports[https].internal: Invalid value: "-1": invalid syntax`,
@@ -688,6 +800,7 @@ func TestRoleResolveLinksMultipleProvider(t *testing.T) {
 				JobName:     "job-1",
 				ServiceName: "job-1-service",
 			},
+			Resolution: model.LinkResolutionType,
 		}, consumes["job-1-provider-1"], "found incorrect role by type")
 	}
 
@@ -703,6 +816,7 @@ func TestRoleResolveLinksMultipleProvider(t *testing.T) {
 				JobName:     "job-3",
 				ServiceName: "role-2-job-3",
 			},
+			Resolution: model.LinkResolutionName,
 		}, consumes["job-3-provider-3"], "did not find explicitly named provider")
 	}
 
@@ -715,6 +829,7 @@ func TestRoleResolveLinksMultipleProvider(t *testing.T) {
 				JobName:     "job-1",
 				ServiceName: "job-1-service",
 			},
+			Resolution: model.LinkResolutionExplicit,
 		}, consumes["actual-consumer-name"], "resolved to incorrect provider for alias")
 	}
 }
@@ -749,6 +864,64 @@ func TestLoadRoleManifestColocatedContainers(t *testing.T) {
 	}
 }
 
+func TestResolveLinksProperties(t *testing.T) {
+	provider := &model.Job{
+		Name: "provider",
+		AvailableProviders: map[string]model.JobProvidesInfo{
+			"db": {
+				JobLinkInfo: model.JobLinkInfo{Name: "db", Type: "database"},
+				Properties:  []string{"db.port", "db.tls"},
+			},
+		},
+	}
+	consumer := &model.Job{
+		Name: "consumer",
+		DesiredConsumers: []model.JobConsumesInfo{
+			{JobLinkInfo: model.JobLinkInfo{Name: "db", Type: "database"}},
+		},
+		Templates: []*model.JobTemplate{
+			{
+				SourcePath: "config.erb",
+				Content: strings.Join([]string{
+					`port=<%= link("db").p("db.port") %>`,
+					`ca=<%= link("db").p("db.tls.ca") %>`,
+					`<% db = link("db") %>`,
+					`user=<%= db.p("db.user") %>`,
+					`<% if_link("db") do |l| %>password=<%= l.p("db.password") %><% end %>`,
+					`host=<%= db.p("db.host", "localhost") %>`,
+					`<% db.if_p("db.timeout") do |timeout| %>timeout=<%= timeout %><% end %>`,
+					`user=<%= link("db").p("db.user") %>`,
+				}, "\n"),
+			},
+		},
+	}
+
+	roleManifest := &model.RoleManifest{
+		InstanceGroups: model.InstanceGroups{
+			&model.InstanceGroup{
+				Name:          "database",
+				JobReferences: model.JobReferences{{Job: provider}},
+			},
+			&model.InstanceGroup{
+				Name:          "app",
+				JobReferences: model.JobReferences{{Job: consumer}},
+			},
+		},
+	}
+	for _, r := range roleManifest.InstanceGroups {
+		for _, jobReference := range r.JobReferences {
+			jobReference.Name = jobReference.Job.Name
+			jobReference.ResolvedConsumes = make(map[string]model.JobConsumesInfo)
+			jobReference.ResolvedConsumedBy = make(map[string][]model.JobLinkInfo)
+		}
+	}
+
+	errors := resolver.NewResolver(roleManifest, nil, model.LoadRoleManifestOptions{}).ResolveLinks()
+	assert.EqualError(t, errors,
+		`instance_group[app].job[consumer].consumes[db]: Invalid value: "db.password, db.user": `+
+			`properties read by the templates are not exported by job provider in instance group database`)
+}
+
 func TestLoadRoleManifestColocatedContainersValidationMissingRole(t *testing.T) {
 	assert := assert.New(t)
 
@@ -812,6 +985,74 @@ func TestLoadRoleManifestColocatedContainersValidationPortCollisions(t *testing.
 		"instance_group[main-role]: Invalid value: \"TCP/80\": port collision, the same protocol/port is used by: main-role, to-be-colocated")
 }
 
+func TestLoadRoleManifestNodePortCollisions(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/node-port-collision.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	assert.Nil(t, roleManifest)
+	assert.EqualError(t, err, "instance_groups[second].jobs[tor].properties.bosh_containerization.ports[http].node-port: "+
+		"Invalid value: 30005: node port is also used by instance_groups[first].jobs[tor].properties.bosh_containerization.ports[range].node-port")
+}
+
+func TestLoadRoleManifestPortTLSInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/port-tls-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	assert.Nil(t, roleManifest)
+	field := "instance_groups[myrole].jobs[tor].properties.bosh_containerization.ports"
+	assert.EqualError(t, err, strings.Join([]string{
+		field + `[private].tls: Invalid value: "private": TLS settings require a public port`,
+		field + `[bogus].tls.terminate: Unsupported value: "yes please": supported values: true, passthrough`,
+		field + `[nosecret].tls.secret: Required value: terminating TLS requires a secret`,
+		field + `[notcert].tls.secret: Invalid value: "PASSWORD": variable must be of type certificate`,
+		field + `[nokey].tls.secret: Not found: "LONELY_CERT_KEY"`,
+		field + `[badname].tls.secret: Invalid value: "Missing_Variable": must be a variable or the name of a kubernetes secret`,
+	}, "\n"))
+}
+
+func TestLoadRoleManifestGroupsInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	ntpReleasePath := filepath.Join(workDir, "../../test-assets/ntp-release")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/groups-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath, ntpReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	assert.Nil(t, roleManifest)
+	assert.EqualError(t, err, strings.Join([]string{
+		`instance_groups[main-role].group: Invalid value: "Control_Plane": must consist of at most 63 lower case alphanumeric characters or '-'`,
+		`instance_groups[to-be-colocated].group: Invalid value: "data": colocated containers must be in the group of instance group main-role`,
+		`instance_groups[other-role].group: Invalid value: "global": is reserved for the values shared by the helm sub-charts`,
+	}, "\n"))
+}
+
 func TestLoadRoleManifestColocatedContainersValidationPortCollisionsWithProtocols(t *testing.T) {
 	assert := assert.New(t)
 
@@ -894,6 +1135,61 @@ func TestLoadRoleManifestColocatedContainersValidationOfMultipleColocatedContain
 	assert.Nil(err)
 }
 
+func TestLoadRoleManifestColocatedContainersValidationOfPrivileges(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	ntpReleasePath := filepath.Join(workDir, "../../test-assets/ntp-release")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/colocated-containers-with-privilege-issues.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath, ntpReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	assert.Nil(roleManifest)
+	assert.EqualError(err, strings.Join([]string{
+		"instance_group[main-role]: Forbidden: colocated container to-be-colocated is privileged, but the instance group is not",
+		"instance_group[main-role]: Forbidden: colocated container to-be-colocated needs capabilities the instance group does not have: NET_RAW, SYS_TIME",
+		"instance_group[main-role]: Forbidden: colocated container to-be-colocated uses service account ntp, but the pod runs with service account default",
+		`instance_groups[main-role].run.pod-budget.memory: Invalid value: 256: the memory limits of the containers add up to 384`,
+		`instance_groups[main-role].run.pod-budget.cpu: Invalid value: 1: the CPU limits of the containers add up to 1.5`,
+		"instance_groups[to-be-colocated].run.pod-budget: Forbidden: colocated containers are part of the pod of another instance group, which has the budget",
+	}, "\n"))
+}
+
+func TestLoadRoleManifestColocatedContainersPodBudget(t *testing.T) {
+	assert := assert.New(t)
+
+	workDir, err := os.Getwd()
+	assert.NoError(err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	ntpReleasePath := filepath.Join(workDir, "../../test-assets/ntp-release")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/colocated-containers-with-pod-budget.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath, ntpReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	if !assert.NoError(err) {
+		return
+	}
+	budget := roleManifest.LookupInstanceGroup("main-role").Run.PodBudget
+	if assert.NotNil(budget) {
+		assert.Equal(int64(512), *budget.Memory)
+		assert.Equal(1.5, *budget.CPU)
+	}
+}
+
 func TestLoadRoleManifestWithReleaseReferences(t *testing.T) {
 	workDir, err := os.Getwd()
 	assert.NoError(t, err)
@@ -912,3 +1208,639 @@ func TestLoadRoleManifestWithReleaseReferences(t *testing.T) {
 	assert.Equal(t, roleManifestPath, roleManifest.ManifestFilePath)
 	assert.Len(t, roleManifest.InstanceGroups, 1)
 }
+
+func TestLoadRoleManifestCompilationEnv(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/compilation-env.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+	require.NotNil(t, roleManifest)
+	require.Len(t, roleManifest.LoadedReleases, 1)
+
+	libevent, err := roleManifest.LoadedReleases[0].LookupPackage("libevent")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CFLAGS=-O2", "HTTP_PROXY=http://proxy.example.com:3128"}, libevent.CompilationEnv)
+	assert.NotEqual(t, libevent.Version, libevent.Fingerprint, "CFLAGS should change the fingerprint")
+
+	tor, err := roleManifest.LoadedReleases[0].LookupPackage("tor")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"HTTP_PROXY=http://proxy.example.com:3128"}, tor.CompilationEnv)
+	// Proxy settings alone keep the fingerprint, but tor depends on libevent
+	assert.NotEqual(t, tor.Version, tor.Fingerprint, "The CFLAGS of libevent should change the fingerprint of tor")
+}
+
+func TestLoadRoleManifestCompilationEnvInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/compilation-env-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	assert.EqualError(t, err, strings.Join([]string{
+		`compilation.env[BAD-NAME]: Invalid value: "BAD-NAME": Environment variable names must consist of letters, digits, and underscores`,
+		`compilation.packages[missing-package]: Not found: "package not found in any release"`,
+	}, "\n"))
+	assert.Nil(t, roleManifest)
+}
+
+func TestLoadRoleManifestCompilationIsolation(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/compilation-isolation.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+	require.NotNil(t, roleManifest)
+
+	libevent, err := roleManifest.LoadedReleases[0].LookupPackage("libevent")
+	require.NoError(t, err)
+	require.NotNil(t, libevent.CompilationIsolation)
+	assert.Equal(t, 1, libevent.CompilationIsolation.MaxParallel)
+	assert.Equal(t, "host", libevent.CompilationIsolation.NetworkMode)
+	assert.Equal(t, libevent.Version, libevent.Fingerprint, "Isolation should not change the fingerprint")
+
+	tor, err := roleManifest.LoadedReleases[0].LookupPackage("tor")
+	require.NoError(t, err)
+	require.NotNil(t, tor.CompilationIsolation)
+	assert.Equal(t, 2, tor.CompilationIsolation.MaxParallel)
+}
+
+func TestLoadRoleManifestCompilationIsolationInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/compilation-isolation-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	assert.EqualError(t, err, strings.Join([]string{
+		`compilation.isolation[0].release: Invalid value: "tor[": Invalid glob pattern`,
+		`compilation.isolation[0].max_parallel: Invalid value: -1: must not be negative`,
+		`compilation.isolation[1]: Not found: "no package of any release matches"`,
+	}, "\n"))
+	assert.Nil(t, roleManifest)
+}
+
+func TestLoadRoleManifestCompilationVerify(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/compilation-verify.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+	require.NotNil(t, roleManifest)
+
+	scriptsDir := filepath.Join(workDir, "../../test-assets/role-manifests/model/scripts/verify")
+
+	libevent, err := roleManifest.LoadedReleases[0].LookupPackage("libevent")
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(scriptsDir, "libevent.sh")}, libevent.VerifyScripts)
+	assert.Equal(t, libevent.Version, libevent.Fingerprint, "Verification should not change the fingerprint")
+
+	tor, err := roleManifest.LoadedReleases[0].LookupPackage("tor")
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(scriptsDir, "version.sh")}, tor.VerifyScripts)
+}
+
+func TestLoadRoleManifestCompilationVerifyInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/compilation-verify-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	assert.EqualError(t, err, strings.Join([]string{
+		`compilation.verify: Not found: "scripts/verify/missing.sh"`,
+		`compilation.packages[libevent].verify: Not found: "scripts/verify"`,
+	}, "\n"))
+	assert.Nil(t, roleManifest)
+}
+
+func TestLoadRoleManifestStemcellInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/stemcell-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	assert.EqualError(t, err, `stemcell.libc: Invalid value: "newer than 2.26": improper constraint: newer than 2.26`)
+	assert.Nil(t, roleManifest)
+}
+
+func TestLoadRoleManifestMetadataInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/metadata-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	assert.EqualError(t, err, strings.Join([]string{
+		`configuration.metadata.labels[skiff-role-name]: Forbidden: Label is set by fissile`,
+		`configuration.metadata.kinds[Service].labels[helm.sh/chart]: Forbidden: Label is set by fissile`,
+		`instance_groups[myrole].configuration.metadata.labels[app.kubernetes.io/component]: Forbidden: Label is set by fissile`,
+		`instance_groups[myrole].configuration.metadata.kinds[Services]: Unsupported value: "Services": supported values: ClusterRole, ClusterRoleBinding, ConfigMap, Deployment, Job, Pod, PodSecurityPolicy, PrometheusRule, Role, RoleBinding, Route, Secret, SecurityContextConstraints, Service, ServiceAccount, StatefulSet`,
+	}, "\n"))
+	assert.Nil(t, roleManifest)
+}
+
+func TestLoadRoleManifestDropCapabilitiesInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/drop-capabilities-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	assert.EqualError(t, err, strings.Join([]string{
+		`instance_groups[myrole].jobs[tor].ports[http]: Forbidden: Port 80 needs the NET_BIND_SERVICE capability, which is dropped`,
+		`instance_groups[privileged].run.drop-capabilities: Invalid value: true: Privileged instance groups and those adding ALL capabilities cannot drop capabilities`,
+	}, "\n"))
+	assert.Nil(t, roleManifest)
+}
+
+func TestLoadRoleManifestSecurityContextInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/security-context-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	assert.EqualError(t, err, strings.Join([]string{
+		`instance_groups[myrole].run.security-context.run-as-user: Invalid value: -1: must be greater than or equal to 0`,
+		`instance_groups[myrole].run.security-context.fs-group-change-policy: Unsupported value: "Never": supported values: Always, OnRootMismatch`,
+		`instance_groups[myrole].run.security-context.fs-group: Required value: fs-group-change-policy only applies to the fs-group`,
+	}, "\n"))
+	assert.Nil(t, roleManifest)
+}
+
+func TestLoadRoleManifestImagePullPolicyInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/image-pull-policy-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	assert.EqualError(t, err,
+		`instance_groups[myrole].run.image-pull-policy: Unsupported value: "latest": supported values: Always, IfNotPresent, Never`)
+	assert.Nil(t, roleManifest)
+}
+
+func TestLoadRoleManifestNetworkIdentityInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/network-identity-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(),
+		`instance_groups[myrole].run.service-name: Invalid value: "Tor_Nodes": must consist of at most 63 lower case alphanumeric characters or '-'`)
+	assert.Contains(t, err.Error(),
+		`instance_groups[myrole].run.hostname: Forbidden: only instance groups of type bosh-task can set it`)
+	assert.Nil(t, roleManifest)
+}
+
+func TestLoadRoleManifestAffinityPresetInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/affinity-presets-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(),
+		`instance_groups[myrole].run.affinity-preset: Invalid value: "spread": conflicts with run.affinity.podAntiAffinity`)
+	assert.Contains(t, err.Error(),
+		`instance_groups[other-role].run.affinity-preset: Unsupported value: "scatter": supported values: spread, pack, dedicate-node`)
+	assert.Contains(t, err.Error(),
+		`instance_groups[task-role].run.affinity-preset: Forbidden: only instance groups of type bosh can set it`)
+	assert.Nil(t, roleManifest)
+}
+
+func TestLoadRoleManifestResourceBudget(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/resource-budget.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{filepath.Join(workDir, "../../test-assets/tor-boshrelease")},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+
+	// Tasks and colocated containers have no footprint of their own; the
+	// colocated container is part of every pod of main-role
+	assert.Equal(t, model.Footprint{}, roleManifest.LookupInstanceGroup("task-role").Footprint(model.SizingDefault))
+	assert.Equal(t, model.Footprint{}, roleManifest.LookupInstanceGroup("to-be-colocated").Footprint(model.SizingDefault))
+	assert.Equal(t, model.Footprint{
+		Replicas:        2,
+		MemoryRequest:   384,
+		MemoryLimit:     512,
+		UnlimitedMemory: 2,
+		CPURequest:      1.5,
+		CPULimit:        3,
+	}, roleManifest.LookupInstanceGroup("main-role").Footprint(model.SizingHA))
+
+	footprint := roleManifest.Footprint(model.SizingDefault)
+	assert.Equal(t, model.Footprint{
+		Replicas:        3,
+		MemoryRequest:   704,
+		MemoryLimit:     1280,
+		UnlimitedMemory: 1,
+		CPURequest:      0.75,
+		CPULimit:        1.5,
+		UnlimitedCPU:    2,
+	}, footprint)
+	assert.Empty(t, footprint.ExceededBudget(roleManifest.Budget(model.SizingDefault)))
+
+	footprint = roleManifest.Footprint(model.SizingHA)
+	assert.Equal(t, 5, footprint.Replicas)
+	assert.Equal(t, []string{
+		"the CPU requests add up to 1.5 cores, more than the budget of 1 cores",
+	}, footprint.ExceededBudget(roleManifest.Budget(model.SizingHA)))
+
+	// The log sidecar is part of every pod of the long running instance groups
+	roleManifest.Configuration.LogSidecar = model.LogSidecarTail
+	assert.Equal(t, model.Footprint{}, roleManifest.LookupInstanceGroup("task-role").Footprint(model.SizingDefault))
+	assert.Equal(t, model.Footprint{
+		Replicas:        2,
+		MemoryRequest:   384 + 2*model.LogSidecarMemoryRequest,
+		MemoryLimit:     512 + 2*model.LogSidecarMemoryLimit,
+		UnlimitedMemory: 2,
+		CPURequest:      1.52,
+		CPULimit:        3.2,
+	}, roleManifest.LookupInstanceGroup("main-role").Footprint(model.SizingHA))
+}
+
+func TestLoadRoleManifestResourceBudgetInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/resource-budget-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{filepath.Join(workDir, "../../test-assets/tor-boshrelease")},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `configuration.budget.memory: Invalid value: -1: must be greater than or equal to 0`)
+	assert.Contains(t, err.Error(), `configuration.ha-budget.cpu: Invalid value: -0.5: must be greater than or equal to 0`)
+	assert.Contains(t, err.Error(),
+		`instance_groups[myrole].configuration.budget: Forbidden: resource budgets apply to the whole role manifest; use run.pod-budget instead`)
+	assert.Nil(t, roleManifest)
+}
+
+func TestLoadRoleManifestProviderAliasesInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/provider-aliases-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{filepath.Join(workDir, "../../test-assets/ntp-release")},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.Error(t, err)
+	field := "instance_groups[myrole].jobs[ntpd].provides[ntp-server].aliases[0].domain"
+	assert.Contains(t, err.Error(),
+		field+`: Invalid value: "NTP_server.service.cf.internal": must be a DNS name of lower case alphanumeric characters or '-'`)
+	assert.Contains(t, err.Error(), field+": Forbidden: only jobs exposing ports can have aliases")
+	assert.Nil(t, roleManifest)
+}
+
+func TestLoadRoleManifestStartupOrderInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/startup-order-bad.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(),
+		`startup_order[2][0]: Invalid value: "worker": only instance groups of type bosh exposing ports can be waited for`)
+	assert.Contains(t, err.Error(), `startup_order[2][2]: Not found: "missing"`)
+	assert.Contains(t, err.Error(),
+		`startup_order: Invalid value: "api": instance groups cannot wait for each other: api -> db -> api`)
+	assert.Nil(t, roleManifest)
+}
+
+func TestLoadRoleManifestAnchors(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/anchors.yml")
+	roleManifest, err := loader.LoadRoleManifest(roleManifestPath, model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}})
+	require.NoError(t, err)
+	require.NotNil(t, roleManifest)
+	require.Len(t, roleManifest.InstanceGroups, 2)
+
+	myrole := roleManifest.InstanceGroups[0]
+	assert.Equal(t, []model.RoleTag{model.RoleTagSequentialStartup}, myrole.Tags)
+	if assert.NotNil(t, myrole.Run.Memory) && assert.NotNil(t, myrole.Run.Memory.Request) {
+		assert.Equal(t, int64(128), *myrole.Run.Memory.Request)
+	}
+	assert.Equal(t, 1, myrole.Run.Scaling.Min)
+	assert.Equal(t, 5, myrole.Run.Scaling.Max, "The run of the job should take precedence")
+	assert.Equal(t, `"localhost"`, myrole.Configuration.Templates["properties.tor.hostname"].Value)
+	assert.Nil(t, myrole.JobReferences[0].ContainerProperties.BoshContainerization.Run)
+
+	foorole := roleManifest.InstanceGroups[1]
+	assert.Empty(t, foorole.Tags)
+	assert.Equal(t, 3, foorole.Run.Scaling.Max)
+}
+
+func TestLoadRoleManifestAnchorsInvalid(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	torReleasePath := filepath.Join(workDir, "../../test-assets/tor-boshrelease")
+	options := model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{torReleasePath},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}}
+
+	roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/anchors-invalid.yml")
+	_, err = loader.LoadRoleManifest(roleManifestPath, options)
+	assert.EqualError(t, err, strings.Join([]string{
+		`anchors[first].anchors: Invalid value: "first": cyclic anchor references: first -> second -> first`,
+		`anchors[second].anchors: Invalid value: "first": references an invalid anchor`,
+		`anchors[first].anchors: Invalid value: "second": references an invalid anchor`,
+		`anchors[scalar]: Invalid value: 42: must be a mapping`,
+		`instance_groups[myrole].anchors[0]: Not found: "missing"`,
+		`instance_groups[myrole].anchors: Invalid value: "first": references an invalid anchor`,
+		`instance_groups[foorole].anchors: Invalid value: "scalar": references an invalid anchor`,
+	}, "\n"))
+
+	roleManifestPath = filepath.Join(workDir, "../../test-assets/role-manifests/model/anchors-bad.yml")
+	_, err = loader.LoadRoleManifest(roleManifestPath, options)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "instance_groups[myrole].run.memory: Invalid value: -10: must be greater than or equal to 0 (from anchors[tiny])")
+	}
+}
+
+func TestLoadRoleManifestJobFeatures(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	options := model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths: []string{
+				filepath.Join(workDir, "../../test-assets/ntp-release"),
+				filepath.Join(workDir, "../../test-assets/tor-boshrelease"),
+			},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}}
+
+	t.Run("good", func(t *testing.T) {
+		roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/job-features.yml")
+		roleManifest, err := loader.LoadRoleManifest(roleManifestPath, options)
+		require.NoError(t, err)
+		require.NotNil(t, roleManifest)
+
+		assert.Equal(t, map[string]bool{"ntp": false, "tor": false}, roleManifest.Features)
+
+		// The conditional provider must not be picked for the unconditional consumer
+		job := roleManifest.LookupInstanceGroup("consumer").LookupJob("ntpd")
+		require.NotNil(t, job)
+		for _, name := range []string{"ntp-server", "ntp-client"} {
+			if assert.Contains(t, job.ResolvedConsumes, name) {
+				assert.Equal(t, "consumer", job.ResolvedConsumes[name].RoleName)
+			}
+		}
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/job-features-bad.yml")
+		_, err := loader.LoadRoleManifest(roleManifestPath, options)
+		assert.EqualError(t, err,
+			`instance_group[consumer].job[ntpd].consumes[ntp-server]: Invalid value: "ntp-server": provider job ntpd in instance group provider is not included under the same feature condition`)
+	})
+
+	t.Run("exclusive", func(t *testing.T) {
+		roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/job-features-exclusive.yml")
+		_, err := loader.LoadRoleManifest(roleManifestPath, options)
+		assert.EqualError(t, err,
+			`instance_groups[myrole].jobs[tor]: Forbidden: if_feature[tor] and unless_feature[tor] are mutually exclusive`)
+	})
+}
+
+func TestLoadRoleManifestJobProperties(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	options := model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{filepath.Join(workDir, "../../test-assets/tor-boshrelease")},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}}
+
+	t.Run("good", func(t *testing.T) {
+		roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/job-properties.yml")
+		roleManifest, err := loader.LoadRoleManifest(roleManifestPath, options)
+		require.NoError(t, err)
+		require.NotNil(t, roleManifest)
+
+		job := roleManifest.LookupInstanceGroup("myrole").LookupJob("tor")
+		require.NotNil(t, job)
+		assert.Equal(t, map[string]interface{}{
+			"tor.hostname":    "example.onion",
+			"tor.client_keys": map[interface{}]interface{}{"alice": "key"},
+		}, job.PropertyOverrides)
+		assert.NotNil(t, job.ContainerProperties.BoshContainerization.Run)
+		assert.NotContains(t, job.ContainerProperties.Properties, "bosh_containerization")
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/job-properties-bad.yml")
+		_, err := loader.LoadRoleManifest(roleManifestPath, options)
+		assert.EqualError(t, err, strings.Join([]string{
+			`instance_groups[myrole].jobs[tor].properties: Invalid value: "tor.missing": Property is not declared in the job spec`,
+			`instance_groups[myrole].jobs[tor].properties: Invalid value: "unknown": Property is not declared in the job spec`,
+		}, "\n"))
+	})
+}
+
+func TestLoadRoleManifestExternalLinks(t *testing.T) {
+	workDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	options := model.LoadRoleManifestOptions{
+		ReleaseOptions: model.ReleaseOptions{
+			ReleasePaths:     []string{filepath.Join(workDir, "../../test-assets/ntp-release")},
+			BOSHCacheDir:     filepath.Join(workDir, "../../test-assets/bosh-cache"),
+			FinalReleasesDir: filepath.Join(workDir, "../../test-assets/.final_releases")},
+		ValidationOptions: model.RoleManifestValidationOptions{
+			AllowMissingScripts: true,
+		}}
+
+	t.Run("good", func(t *testing.T) {
+		roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/external-links.yml")
+		roleManifest, err := loader.LoadRoleManifest(roleManifestPath, options)
+		require.NoError(t, err)
+		require.NotNil(t, roleManifest)
+
+		job := roleManifest.LookupInstanceGroup("myrole").LookupJob("ntpd")
+		require.NotNil(t, job)
+		if assert.Contains(t, job.ResolvedConsumes, "ntp-server") {
+			consumer := job.ResolvedConsumes["ntp-server"]
+			assert.Equal(t, "ntpd", consumer.Type)
+			assert.Equal(t, model.LinkResolutionExternal, consumer.Resolution)
+			assert.Equal(t, &model.JobExternalLink{
+				Address:    "ntp.example.com",
+				Properties: map[string]interface{}{"ntp_conf": "external.conf"},
+			}, consumer.External)
+		}
+
+		job = roleManifest.LookupInstanceGroup("otherrole").LookupJob("ntpd")
+		require.NotNil(t, job)
+		if assert.Contains(t, job.ResolvedConsumes, "ntp-server") {
+			assert.Equal(t, &model.JobExternalLink{
+				Namespace:     "time",
+				InstanceGroup: "ntp",
+				Job:           "ntpd",
+				ServiceName:   "ntp-ntpd",
+			}, job.ResolvedConsumes["ntp-server"].External)
+		}
+		assert.Empty(t, job.ResolvedConsumedBy["ntp-server"], "External links should not be recorded as consumers")
+	})
+
+	t.Run("bad", func(t *testing.T) {
+		roleManifestPath := filepath.Join(workDir, "../../test-assets/role-manifests/model/external-links-bad.yml")
+		_, err := loader.LoadRoleManifest(roleManifestPath, options)
+		assert.EqualError(t, err, strings.Join([]string{
+			`instance_group[myrole].job[ntpd].consumes[ntp-server].external: Forbidden: address and namespace are mutually exclusive`,
+			`instance_group[otherrole].job[ntpd].consumes[ntp-server].external.instance_group: Required value: required with namespace`,
+			`instance_group[otherrole].job[ntpd].consumes[ntp-server].external.job: Required value: required with namespace`,
+			`instance_group[otherrole].job[ntpd].consumes[ntp-server].external.properties: Forbidden: properties are imported from the provider in the namespace`,
+		}, "\n"))
+	})
+}
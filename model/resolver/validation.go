@@ -3,14 +3,19 @@ package resolver
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 
 	"code.cloudfoundry.org/fissile/model"
 	"code.cloudfoundry.org/fissile/validation"
+	"github.com/Masterminds/semver"
 )
 
+var envVarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 // Validate implements several checks for the instance group and its job references. It's run after the
 // instance groups are filtered and i.e. Run has been calculated.
 // It adds the releases Job spec to the instance groups JobReferences
@@ -44,6 +49,7 @@ func validateInstanceGroup(roleManifest *model.RoleManifest, g *model.InstanceGr
 			continue
 		}
 		jobReference.Job = job
+		allErrs = append(allErrs, validateJobProperties(g, jobReference)...)
 
 		if jobReference.ResolvedConsumes == nil {
 			// No explicitly specified consumers
@@ -82,6 +88,106 @@ func validateInstanceGroup(roleManifest *model.RoleManifest, g *model.InstanceGr
 	return allErrs
 }
 
+// validateJobProperties checks that the properties set for a job in the role
+// manifest are declared in the job spec; see jobPropertyOverrides.
+func validateJobProperties(g *model.InstanceGroup, jobReference *model.JobReference) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	_, undeclared := jobPropertyOverrides(jobReference)
+	for _, name := range undeclared {
+		allErrs = append(allErrs, validation.Invalid(
+			fmt.Sprintf("instance_groups[%s].jobs[%s].properties", g.Name, jobReference.Name),
+			name, "Property is not declared in the job spec"))
+	}
+
+	return allErrs
+}
+
+// validateLinkProperties checks that the link properties which the templates
+// of consumer jobs require (see JobTemplate.LinkProperties) are exported by
+// the jobs providing the links.
+func validateLinkProperties(m *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	for _, instanceGroup := range m.InstanceGroups {
+		for _, jobReference := range instanceGroup.JobReferences {
+			missing := make(map[string][]string)
+			for _, template := range jobReference.Job.Templates {
+				for _, property := range template.LinkProperties() {
+					if !property.Required {
+						continue
+					}
+					consumer, ok := jobReference.ResolvedConsumes[property.Link]
+					if !ok {
+						// Optional or ignored links are not checked
+						continue
+					}
+					exported, ok := exportedLinkProperties(m, consumer)
+					if !ok || linkPropertyExported(exported, property.Property) {
+						continue
+					}
+					found := false
+					for _, name := range missing[property.Link] {
+						found = found || name == property.Property
+					}
+					if !found {
+						missing[property.Link] = append(missing[property.Link], property.Property)
+					}
+				}
+			}
+
+			links := make([]string, 0, len(missing))
+			for link := range missing {
+				links = append(links, link)
+			}
+			sort.Strings(links)
+			for _, link := range links {
+				consumer := jobReference.ResolvedConsumes[link]
+				sort.Strings(missing[link])
+				allErrs = append(allErrs, validation.Invalid(
+					fmt.Sprintf("instance_group[%s].job[%s].consumes[%s]", instanceGroup.Name, jobReference.Name, link),
+					strings.Join(missing[link], ", "),
+					fmt.Sprintf("properties read by the templates are not exported by job %s in instance group %s",
+						consumer.JobName, consumer.RoleName)))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// exportedLinkProperties returns the properties exported by the provider of a
+// resolved link, and whether the provider could be found.
+func exportedLinkProperties(m *model.RoleManifest, consumer model.JobConsumesInfo) ([]string, bool) {
+	providerGroup := m.LookupInstanceGroup(consumer.RoleName)
+	if providerGroup == nil {
+		return nil, false
+	}
+	providerJob := providerGroup.LookupJob(consumer.JobName)
+	if providerJob == nil || providerJob.Job == nil {
+		return nil, false
+	}
+	provider, ok := providerJob.Job.AvailableProviders[consumer.Name]
+	if !ok {
+		return nil, false
+	}
+	return provider.Properties, true
+}
+
+// linkPropertyExported returns whether a property can be read from a link
+// exporting the given properties.  Reading a nested property of an exported
+// hash, as well as a hash containing exported properties, is allowed.
+func linkPropertyExported(exported []string, property string) bool {
+	for _, name := range exported {
+		if name == property ||
+			strings.HasPrefix(property, name+".") ||
+			strings.HasPrefix(name, property+".") {
+			return true
+		}
+	}
+	return false
+}
+
 // validateTemplateKeys tests whether all template keys are strings and that
 // global template values are strings
 func validateTemplateKeysAndValues(roleManifest *model.RoleManifest) validation.ErrorList {
@@ -205,6 +311,19 @@ func validateVariableType(variables model.Variables) validation.ErrorList {
 				cv.Type, "Expected one of certificate, password, rsa, ssh or empty"))
 		}
 
+		// The secret generator has fixed parameters; the options are only
+		// read to reject them instead of silently ignoring them.
+		if cv.CVOptions.Length != 0 {
+			allErrs = append(allErrs, validation.Forbidden(
+				fmt.Sprintf("variables[%s].options.length", cv.Name),
+				"The secret generator does not support setting the length of passwords"))
+		}
+		if cv.CVOptions.KeyBits != 0 {
+			allErrs = append(allErrs, validation.Forbidden(
+				fmt.Sprintf("variables[%s].options.key_bits", cv.Name),
+				"The secret generator does not support setting the size of keys"))
+		}
+
 		switch cv.CVOptions.Type {
 		case "":
 			cv.CVOptions.Type = model.CVTypeUser
@@ -266,6 +385,50 @@ func validateServiceAccounts(roleManifest *model.RoleManifest) validation.ErrorL
 	return allErrs
 }
 
+// validateClusterRoleAggregation checks the aggregated cluster roles, which
+// need selectors and must not clash with the other cluster roles, and that
+// cluster role labels are only given for cluster roles.
+func validateClusterRoleAggregation(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+	auth := &roleManifest.Configuration.Authorization
+
+	names := make([]string, 0, len(auth.AggregatedClusterRoles))
+	for name := range auth.AggregatedClusterRoles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fieldPath := fmt.Sprintf("configuration.auth.aggregated-cluster-roles[%s]", name)
+		if _, ok := auth.ClusterRoles[name]; ok {
+			allErrs = append(allErrs, validation.Duplicate(fieldPath, name))
+		}
+		aggregation := auth.AggregatedClusterRoles[name]
+		if len(aggregation.Selectors) == 0 {
+			allErrs = append(allErrs, validation.Required(fieldPath+".selectors", "aggregated cluster roles need label selectors"))
+		}
+		for index, selector := range aggregation.Selectors {
+			if len(selector) == 0 {
+				allErrs = append(allErrs, validation.Required(
+					fmt.Sprintf("%s.selectors[%d]", fieldPath, index),
+					"empty selectors would match every cluster role"))
+			}
+		}
+	}
+
+	names = names[:0]
+	for name := range auth.ClusterRoleLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !auth.IsClusterRole(name) {
+			allErrs = append(allErrs, validation.NotFound("configuration.auth.cluster-role-labels", name))
+		}
+	}
+
+	return allErrs
+}
+
 func validateUnusedColocatedContainerRoles(roleManifest *model.RoleManifest) validation.ErrorList {
 	counterMap := map[string]int{}
 	for _, instanceGroup := range roleManifest.InstanceGroups {
@@ -350,6 +513,273 @@ func validateColocatedContainerPortCollisions(roleManifest *model.RoleManifest)
 	return allErrs
 }
 
+// validateNodePortCollisions checks that no two port definitions use the same
+// node ports, counting up to the largest configurable number of ports
+func validateNodePortCollisions(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	owners := map[int]string{}
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		for _, job := range instanceGroup.JobReferences {
+			for _, exposedPort := range job.ContainerProperties.BoshContainerization.Ports {
+				if exposedPort.NodePort == 0 {
+					continue
+				}
+				field := fmt.Sprintf("instance_groups[%s].jobs[%s].properties.bosh_containerization.ports[%s].node-port",
+					instanceGroup.Name, job.Name, exposedPort.Name)
+				for i := 0; i < exposedPort.Max; i++ {
+					nodePort := exposedPort.NodePort + i
+					if owner, ok := owners[nodePort]; ok {
+						allErrs = append(allErrs, validation.Invalid(field, nodePort,
+							fmt.Sprintf("node port is also used by %s", owner)))
+						break
+					}
+					owners[nodePort] = field
+				}
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// kubeSecretNamePattern matches valid names of kubernetes secrets (DNS subdomains)
+var kubeSecretNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+// validatePortTLS checks the TLS settings of ports: they only apply to public
+// ports, and terminating TLS requires a secret, which is either a certificate
+// variable with a matching _KEY variable or the name of a kubernetes secret.
+func validatePortTLS(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		for _, job := range instanceGroup.JobReferences {
+			for _, exposedPort := range job.ContainerProperties.BoshContainerization.Ports {
+				tls := exposedPort.TLS
+				if tls == nil {
+					continue
+				}
+				field := fmt.Sprintf("instance_groups[%s].jobs[%s].properties.bosh_containerization.ports[%s].tls",
+					instanceGroup.Name, job.Name, exposedPort.Name)
+
+				if !exposedPort.Public {
+					allErrs = append(allErrs, validation.Invalid(field, exposedPort.Name,
+						"TLS settings require a public port"))
+				}
+				switch tls.Terminate {
+				case model.PortTLSTerminate:
+					if tls.Secret == "" {
+						allErrs = append(allErrs, validation.Required(field+".secret",
+							"terminating TLS requires a secret"))
+					}
+				case model.PortTLSPassthrough:
+				default:
+					allErrs = append(allErrs, validation.NotSupported(field+".terminate", tls.Terminate,
+						[]string{model.PortTLSTerminate, model.PortTLSPassthrough}))
+				}
+				if tls.Secret == "" {
+					continue
+				}
+
+				variable := tls.SecretVariable(roleManifest.Variables)
+				if variable == nil {
+					if !kubeSecretNamePattern.MatchString(tls.Secret) || len(tls.Secret) > 253 {
+						allErrs = append(allErrs, validation.Invalid(field+".secret", tls.Secret,
+							"must be a variable or the name of a kubernetes secret"))
+					}
+					continue
+				}
+				if variable.Type != "certificate" {
+					allErrs = append(allErrs, validation.Invalid(field+".secret", tls.Secret,
+						"variable must be of type certificate"))
+				} else if roleManifest.Variables.Lookup(tls.Secret+"_KEY") == nil {
+					allErrs = append(allErrs, validation.NotFound(field+".secret", tls.Secret+"_KEY"))
+				}
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// dnsLabelPattern matches DNS labels, as required for the groups of instance
+// groups, which become the names of helm sub-charts, and for the names of
+// services and hosts
+var dnsLabelPattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// validateInstanceGroupGroups checks the groups of the instance groups: they
+// are used as helm sub-chart names, and colocated containers go with the
+// instance group they are colocated with.
+func validateInstanceGroupGroups(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		field := fmt.Sprintf("instance_groups[%s].group", instanceGroup.Name)
+		switch {
+		case instanceGroup.Group == "":
+			// Instance groups without a group are part of the umbrella chart
+		case !dnsLabelPattern.MatchString(instanceGroup.Group) || len(instanceGroup.Group) > 63:
+			allErrs = append(allErrs, validation.Invalid(field, instanceGroup.Group,
+				"must consist of at most 63 lower case alphanumeric characters or '-'"))
+		case instanceGroup.Group == "global":
+			allErrs = append(allErrs, validation.Invalid(field, instanceGroup.Group,
+				"is reserved for the values shared by the helm sub-charts"))
+		}
+		for _, colocated := range instanceGroup.GetColocatedRoles() {
+			if colocated.Group != "" && colocated.Group != instanceGroup.Group {
+				allErrs = append(allErrs, validation.Invalid(
+					fmt.Sprintf("instance_groups[%s].group", colocated.Name), colocated.Group,
+					fmt.Sprintf("colocated containers must be in the group of instance group %s", instanceGroup.Name)))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// validateProviderAliases checks the DNS aliases of the link providers: they
+// must be valid DNS names, and are served by services of the ports of their
+// jobs, so only the jobs of bosh instance groups exposing ports can have them.
+func validateProviderAliases(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		for _, jobReference := range instanceGroup.JobReferences {
+			names := make([]string, 0, len(jobReference.ExportedProvides))
+			for name := range jobReference.ExportedProvides {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				for index, alias := range jobReference.ExportedProvides[name].Aliases {
+					field := fmt.Sprintf("instance_groups[%s].jobs[%s].provides[%s].aliases[%d].domain",
+						instanceGroup.Name, jobReference.Name, name, index)
+					if !validDNSName(alias.Domain) {
+						allErrs = append(allErrs, validation.Invalid(field, alias.Domain,
+							"must be a DNS name of lower case alphanumeric characters or '-'"))
+					}
+					if instanceGroup.Type != model.RoleTypeBosh || instanceGroup.IsColocated() {
+						allErrs = append(allErrs, validation.Forbidden(field,
+							"only the jobs of instance groups of type bosh can have aliases"))
+					} else if len(jobReference.ContainerProperties.BoshContainerization.Ports) == 0 {
+						allErrs = append(allErrs, validation.Forbidden(field,
+							"only jobs exposing ports can have aliases"))
+					}
+				}
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// validDNSName returns true if the name is a valid DNS name, of DNS labels
+func validDNSName(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !dnsLabelPattern.MatchString(label) || len(label) > 63 {
+			return false
+		}
+	}
+	return true
+}
+
+// validateStartupOrder checks the sequences of the startup order: they list
+// known instance groups, those waited for have a headless service the waiting
+// pods can resolve once they are ready, and there is no cycle, in which pods
+// would wait for each other forever.
+func validateStartupOrder(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	successors := make(map[string][]string)
+	for sequenceIndex, sequence := range roleManifest.StartupOrder {
+		seen := make(map[string]bool)
+		for index, name := range sequence {
+			field := fmt.Sprintf("startup_order[%d][%d]", sequenceIndex, index)
+			if seen[name] {
+				allErrs = append(allErrs, validation.Duplicate(field, name))
+				continue
+			}
+			seen[name] = true
+
+			instanceGroup := roleManifest.LookupInstanceGroup(name)
+			if instanceGroup == nil {
+				allErrs = append(allErrs, validation.NotFound(field, name))
+				continue
+			}
+			if instanceGroup.IsColocated() {
+				allErrs = append(allErrs, validation.Invalid(field, name,
+					"colocated containers start with the pods of their instance group"))
+				continue
+			}
+			if index < len(sequence)-1 && !hasClusteringService(instanceGroup) {
+				allErrs = append(allErrs, validation.Invalid(field, name,
+					"only instance groups of type bosh exposing ports can be waited for"))
+			}
+			if index > 0 {
+				successors[sequence[index-1]] = append(successors[sequence[index-1]], name)
+			}
+		}
+	}
+
+	// Depth first search for cycles, from every instance group in order
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(name string) []string
+	visit = func(name string) []string {
+		switch state[name] {
+		case visiting:
+			for index, candidate := range path {
+				if candidate == name {
+					return append(append([]string{}, path[index:]...), name)
+				}
+			}
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, successor := range successors[name] {
+			if cycle := visit(successor); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		if cycle := visit(instanceGroup.Name); cycle != nil {
+			allErrs = append(allErrs, validation.Invalid("startup_order", cycle[0],
+				fmt.Sprintf("instance groups cannot wait for each other: %s", strings.Join(cycle, " -> "))))
+			break
+		}
+	}
+
+	return allErrs
+}
+
+// hasClusteringService returns true if the instance group gets a headless
+// service for all its pods, i.e. it is of type bosh and exposes ports
+func hasClusteringService(instanceGroup *model.InstanceGroup) bool {
+	if instanceGroup.Type != model.RoleTypeBosh {
+		return false
+	}
+	for _, jobReference := range instanceGroup.JobReferences {
+		if len(jobReference.ContainerProperties.BoshContainerization.Ports) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func validateColocatedContainerVolumeShares(roleManifest *model.RoleManifest) validation.ErrorList {
 	allErrs := validation.ErrorList{}
 
@@ -415,6 +845,459 @@ func validateColocatedContainerVolumeShares(roleManifest *model.RoleManifest) va
 	return allErrs
 }
 
+// validateColocatedContainerPrivileges tests that colocated containers do not
+// need privileges their pod is not set up for.  The pod runs with the service
+// account of the main instance group, and so is admitted by the pod security
+// policy chosen for the privileges of the main instance group.
+func validateColocatedContainerPrivileges(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		capabilities := map[string]bool{}
+		for _, capability := range instanceGroup.Run.Capabilities {
+			capabilities[capability] = true
+		}
+		allCapabilities := instanceGroup.Run.Privileged || capabilities["ALL"]
+
+		for _, colocated := range instanceGroup.GetColocatedRoles() {
+			if colocated.Run.Privileged && !instanceGroup.Run.Privileged {
+				allErrs = append(allErrs, validation.Forbidden(
+					fmt.Sprintf("instance_group[%s]", instanceGroup.Name),
+					fmt.Sprintf("colocated container %s is privileged, but the instance group is not", colocated.Name)))
+			}
+
+			var missing []string
+			for _, capability := range colocated.Run.Capabilities {
+				if !allCapabilities && !capabilities[capability] {
+					missing = append(missing, capability)
+				}
+			}
+			if len(missing) > 0 {
+				sort.Strings(missing)
+				allErrs = append(allErrs, validation.Forbidden(
+					fmt.Sprintf("instance_group[%s]", instanceGroup.Name),
+					fmt.Sprintf("colocated container %s needs capabilities the instance group does not have: %s",
+						colocated.Name, strings.Join(missing, ", "))))
+			}
+
+			if colocated.Run.ServiceAccount != "default" && colocated.Run.ServiceAccount != instanceGroup.Run.ServiceAccount {
+				allErrs = append(allErrs, validation.Forbidden(
+					fmt.Sprintf("instance_group[%s]", instanceGroup.Name),
+					fmt.Sprintf("colocated container %s uses service account %s, but the pod runs with service account %s",
+						colocated.Name, colocated.Run.ServiceAccount, instanceGroup.Run.ServiceAccount)))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// ValidateResources tests that the memory and CPU requests of the instance
+// groups do not exceed their limits, and that the containers of each pod fit
+// into its pod budget.  It is part of the validation of role manifests, and
+// needs to be run again when requests or limits are changed afterwards.
+func ValidateResources(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validateResourceLimits(roleManifest)
+	allErrs = append(allErrs, validatePodBudgets(roleManifest)...)
+	return allErrs
+}
+
+// validateResourceLimits tests that the memory and CPU requests of the
+// instance groups are not larger than their limits.
+func validateResourceLimits(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		if instanceGroup.Run == nil {
+			continue
+		}
+		memory := instanceGroup.Run.Memory
+		if memory != nil && memory.Request != nil && memory.Limit != nil && *memory.Request > *memory.Limit {
+			allErrs = append(allErrs, validation.Invalid(
+				fmt.Sprintf("instance_groups[%s].run.memory.limit", instanceGroup.Name), *memory.Limit,
+				fmt.Sprintf("the limit is smaller than the request of %d", *memory.Request)))
+		}
+		cpu := instanceGroup.Run.CPU
+		if cpu != nil && cpu.Request != nil && cpu.Limit != nil && *cpu.Request > *cpu.Limit {
+			allErrs = append(allErrs, validation.Invalid(
+				fmt.Sprintf("instance_groups[%s].run.cpu.limit", instanceGroup.Name), *cpu.Limit,
+				fmt.Sprintf("the limit is smaller than the request of %g", *cpu.Request)))
+		}
+	}
+
+	return allErrs
+}
+
+// validatePodBudgets tests that the memory and CPU requests and limits of all
+// containers of a pod fit into the pod budget of the instance group, if any.
+// Only main instance groups can have a budget.
+func validatePodBudgets(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		if instanceGroup.Run == nil {
+			continue
+		}
+		budget := instanceGroup.Run.PodBudget
+		if budget == nil {
+			continue
+		}
+		path := fmt.Sprintf("instance_groups[%s].run.pod-budget", instanceGroup.Name)
+		if instanceGroup.Type == model.RoleTypeColocatedContainer {
+			allErrs = append(allErrs, validation.Forbidden(path,
+				"colocated containers are part of the pod of another instance group, which has the budget"))
+			continue
+		}
+
+		containers := append(model.InstanceGroups{instanceGroup}, instanceGroup.GetColocatedRoles()...)
+		if budget.Memory != nil && *budget.Memory < 0 {
+			allErrs = append(allErrs, validation.ValidateNonnegativeField(*budget.Memory, path+".memory")...)
+		} else if budget.Memory != nil {
+			var requests, limits int64
+			for _, container := range containers {
+				if container.Run.Memory != nil && container.Run.Memory.Request != nil {
+					requests += *container.Run.Memory.Request
+				}
+				if container.Run.Memory != nil && container.Run.Memory.Limit != nil {
+					limits += *container.Run.Memory.Limit
+				}
+			}
+			if requests > *budget.Memory {
+				allErrs = append(allErrs, validation.Invalid(path+".memory", *budget.Memory,
+					fmt.Sprintf("the memory requests of the containers add up to %d", requests)))
+			}
+			if limits > *budget.Memory {
+				allErrs = append(allErrs, validation.Invalid(path+".memory", *budget.Memory,
+					fmt.Sprintf("the memory limits of the containers add up to %d", limits)))
+			}
+		}
+		if budget.CPU != nil && *budget.CPU < 0 {
+			allErrs = append(allErrs, validation.ValidateNonnegativeFieldFloat(*budget.CPU, path+".cpu")...)
+		} else if budget.CPU != nil {
+			var requests, limits float64
+			for _, container := range containers {
+				if container.Run.CPU != nil && container.Run.CPU.Request != nil {
+					requests += *container.Run.CPU.Request
+				}
+				if container.Run.CPU != nil && container.Run.CPU.Limit != nil {
+					limits += *container.Run.CPU.Limit
+				}
+			}
+			if requests > *budget.CPU {
+				allErrs = append(allErrs, validation.Invalid(path+".cpu", *budget.CPU,
+					fmt.Sprintf("the CPU requests of the containers add up to %g", requests)))
+			}
+			if limits > *budget.CPU {
+				allErrs = append(allErrs, validation.Invalid(path+".cpu", *budget.CPU,
+					fmt.Sprintf("the CPU limits of the containers add up to %g", limits)))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// validateResourceBudgets tests that the resource budgets of the role manifest
+// are not negative.  Instance groups cannot have a budget of their own; their
+// pods can have a pod budget instead.
+func validateResourceBudgets(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	budgets := []struct {
+		path   string
+		budget *model.ResourceBudget
+	}{
+		{"configuration.budget", roleManifest.Configuration.Budget},
+		{"configuration.ha-budget", roleManifest.Configuration.HABudget},
+	}
+	for _, entry := range budgets {
+		if entry.budget == nil {
+			continue
+		}
+		if entry.budget.Memory != nil {
+			allErrs = append(allErrs, validation.ValidateNonnegativeField(*entry.budget.Memory, entry.path+".memory")...)
+		}
+		if entry.budget.CPU != nil {
+			allErrs = append(allErrs, validation.ValidateNonnegativeFieldFloat(*entry.budget.CPU, entry.path+".cpu")...)
+		}
+	}
+
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		if instanceGroup.Configuration == nil {
+			continue
+		}
+		path := fmt.Sprintf("instance_groups[%s].configuration", instanceGroup.Name)
+		if instanceGroup.Configuration.Budget != nil {
+			allErrs = append(allErrs, validation.Forbidden(path+".budget",
+				"resource budgets apply to the whole role manifest; use run.pod-budget instead"))
+		}
+		if instanceGroup.Configuration.HABudget != nil {
+			allErrs = append(allErrs, validation.Forbidden(path+".ha-budget",
+				"resource budgets apply to the whole role manifest; use run.pod-budget instead"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateLogSidecar tests that the log sidecar of the role manifest is
+// supported
+func validateLogSidecar(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	switch roleManifest.Configuration.LogSidecar {
+	case model.LogSidecarNone, model.LogSidecarTail, model.LogSidecarForwarder:
+	default:
+		allErrs = append(allErrs, validation.NotSupported("configuration.log-sidecar",
+			roleManifest.Configuration.LogSidecar,
+			[]string{string(model.LogSidecarTail), string(model.LogSidecarForwarder)}))
+	}
+
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		if instanceGroup.Configuration != nil && instanceGroup.Configuration.LogSidecar != model.LogSidecarNone {
+			allErrs = append(allErrs, validation.Forbidden(
+				fmt.Sprintf("instance_groups[%s].configuration.log-sidecar", instanceGroup.Name),
+				"the log sidecar applies to the whole role manifest; use run.log-paths to select the log files"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateDockerfileSnippets tests that the Dockerfile snippets of the
+// instance groups only add single line instructions, and only copy files
+// from their assets directories
+func validateDockerfileSnippets(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+	roleManifestDirName := filepath.Dir(roleManifest.ManifestFilePath)
+
+	// relativePath returns whether the path stays below the directory it is
+	// relative to
+	relativePath := func(path string) bool {
+		path = filepath.Clean(path)
+		return !filepath.IsAbs(path) && path != ".." && !strings.HasPrefix(path, "../")
+	}
+
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		snippet := instanceGroup.Dockerfile
+		if snippet == nil {
+			continue
+		}
+		path := fmt.Sprintf("instance_groups[%s].dockerfile", instanceGroup.Name)
+
+		assetsPath := ""
+		if snippet.Assets != "" {
+			if !relativePath(snippet.Assets) {
+				allErrs = append(allErrs, validation.Invalid(path+".assets", snippet.Assets,
+					"the assets directory must be within the role manifest directory"))
+			} else if info, err := os.Stat(filepath.Join(roleManifestDirName, snippet.Assets)); err != nil || !info.IsDir() {
+				allErrs = append(allErrs, validation.Invalid(path+".assets", snippet.Assets,
+					"the assets directory does not exist"))
+			} else {
+				assetsPath = filepath.Join(roleManifestDirName, snippet.Assets)
+			}
+		}
+
+		names := make([]string, 0, len(snippet.Env))
+		for name := range snippet.Env {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if !envVarNamePattern.MatchString(name) {
+				allErrs = append(allErrs, validation.Invalid(path+".env", name,
+					"environment variable names must consist of letters, digits, and underscores"))
+			}
+			if strings.ContainsAny(snippet.Env[name], "\r\n") {
+				allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("%s.env[%s]", path, name), snippet.Env[name],
+					"environment variable values must be single lines"))
+			}
+		}
+
+		if len(snippet.Copy) > 0 && snippet.Assets == "" {
+			allErrs = append(allErrs, validation.Required(path+".assets",
+				"files can only be copied from the assets directory"))
+		}
+		for index, assetCopy := range snippet.Copy {
+			copyPath := fmt.Sprintf("%s.copy[%d]", path, index)
+			switch {
+			case !relativePath(assetCopy.Source) || strings.ContainsAny(assetCopy.Source, "\r\n"):
+				allErrs = append(allErrs, validation.Invalid(copyPath+".source", assetCopy.Source,
+					"the source must be within the assets directory"))
+			case assetsPath != "":
+				if _, err := os.Stat(filepath.Join(assetsPath, assetCopy.Source)); err != nil {
+					allErrs = append(allErrs, validation.Invalid(copyPath+".source", assetCopy.Source,
+						"the source does not exist in the assets directory"))
+				}
+			}
+			if !filepath.IsAbs(assetCopy.Destination) || strings.ContainsAny(assetCopy.Destination, "\r\n") {
+				allErrs = append(allErrs, validation.Invalid(copyPath+".destination", assetCopy.Destination,
+					"the destination must be an absolute path"))
+			}
+		}
+
+		for index, command := range snippet.Run {
+			if strings.TrimSpace(command) == "" || strings.ContainsAny(command, "\r\n") {
+				allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("%s.run[%d]", path, index), command,
+					"commands must be single, non-empty lines"))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// validatePackageOverrides tests that the packages excluded from or
+// substituted in the images of the instance groups are packages of their
+// jobs, and that the substitutes exist
+func validatePackageOverrides(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		overrides := instanceGroup.PackageOverrides
+		if overrides == nil {
+			continue
+		}
+		path := fmt.Sprintf("instance_groups[%s].packages", instanceGroup.Name)
+
+		packages := map[string]*model.Package{}
+		for _, jobReference := range instanceGroup.JobReferences {
+			for _, pkg := range jobReference.Packages {
+				packages[pkg.Name] = pkg
+			}
+		}
+
+		for _, name := range overrides.Exclude {
+			if _, ok := packages[name]; !ok {
+				allErrs = append(allErrs, validation.Invalid(path+".exclude", name,
+					"not a package of the jobs of the instance group"))
+			}
+		}
+
+		names := make([]string, 0, len(overrides.Substitute))
+		for name := range overrides.Substitute {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			substitutePath := fmt.Sprintf("%s.substitute[%s]", path, name)
+			pkg, ok := packages[name]
+			switch {
+			case !ok:
+				allErrs = append(allErrs, validation.Invalid(substitutePath, name,
+					"not a package of the jobs of the instance group"))
+			case overrides.Excludes(name):
+				allErrs = append(allErrs, validation.Forbidden(substitutePath,
+					"the package is also excluded"))
+			default:
+				if _, err := instanceGroup.LookupSubstitute(pkg); err != nil {
+					allErrs = append(allErrs, validation.Invalid(substitutePath, overrides.Substitute[name], err.Error()))
+				}
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// metadataKinds are the kinds of the kube objects fissile generates, which
+// may be given extra labels and annotations
+var metadataKinds = []string{
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"ConfigMap",
+	"Deployment",
+	"Job",
+	"Pod",
+	"PodSecurityPolicy",
+	"PrometheusRule",
+	"Role",
+	"RoleBinding",
+	"Route",
+	"Secret",
+	"SecurityContextConstraints",
+	"Service",
+	"ServiceAccount",
+	"StatefulSet",
+}
+
+// reservedLabelPrefixes and reservedLabels are the labels set by fissile
+// itself, some of which are used by selectors; they may not be replaced.
+var (
+	reservedLabelPrefixes = []string{"app.kubernetes.io/", "helm.sh/"}
+	reservedLabels        = []string{"app", "skiff-role-active", "skiff-role-name", "version"}
+)
+
+// validateMetadata tests that the extra labels and annotations of the global
+// and instance group configurations are for known kinds, and do not replace
+// the labels set by fissile.
+func validateMetadata(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validateConfigurationMetadata("configuration.metadata", roleManifest.Configuration.Metadata)
+	for _, instanceGroup := range roleManifest.InstanceGroups {
+		if instanceGroup.Configuration != nil {
+			allErrs = append(allErrs, validateConfigurationMetadata(
+				fmt.Sprintf("instance_groups[%s].configuration.metadata", instanceGroup.Name),
+				instanceGroup.Configuration.Metadata)...)
+		}
+	}
+	return allErrs
+}
+
+func validateConfigurationMetadata(path string, metadata model.ConfigurationMetadata) validation.ErrorList {
+	allErrs := validateObjectLabels(path, metadata.Labels)
+
+	kinds := make([]string, 0, len(metadata.Kinds))
+	for kind := range metadata.Kinds {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		kindPath := fmt.Sprintf("%s.kinds[%s]", path, kind)
+		found := false
+		for _, metadataKind := range metadataKinds {
+			if kind == metadataKind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			allErrs = append(allErrs, validation.NotSupported(kindPath, kind, metadataKinds))
+			continue
+		}
+		allErrs = append(allErrs, validateObjectLabels(kindPath, metadata.Kinds[kind].Labels)...)
+	}
+	return allErrs
+}
+
+func validateObjectLabels(path string, labels map[string]string) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		reserved := false
+		for _, label := range reservedLabels {
+			if name == label {
+				reserved = true
+			}
+		}
+		for _, prefix := range reservedLabelPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				reserved = true
+			}
+		}
+		if reserved {
+			allErrs = append(allErrs, validation.Forbidden(
+				fmt.Sprintf("%s.labels[%s]", path, name),
+				"Label is set by fissile"))
+		}
+	}
+	return allErrs
+}
+
 // validateVariableDescriptions tests whether all variables have descriptions
 func validateVariableDescriptions(roleManifest *model.RoleManifest) validation.ErrorList {
 	allErrs := validation.ErrorList{}
@@ -554,3 +1437,131 @@ func validateHealthProbe(instanceGroup model.InstanceGroup, probeName string, pr
 
 	return allErrs
 }
+
+// validateCompilation checks the compilation settings of the role manifest;
+// the environment variable names must be valid, and any package-specific
+// settings must refer to packages in the loaded releases.  Isolation settings
+// need valid glob patterns matching at least one package, and verification
+// scripts must exist.
+func validateCompilation(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+	if roleManifest.Compilation == nil {
+		return allErrs
+	}
+
+	validateEnv := func(path string, env map[string]string) {
+		for name := range env {
+			if envVarNamePattern.FindString(name) == "" {
+				allErrs = append(allErrs, validation.Invalid(
+					fmt.Sprintf("%s[%s]", path, name),
+					name, "Environment variable names must consist of letters, digits, and underscores"))
+			}
+		}
+	}
+
+	validateVerify := func(path, script string) {
+		if script == "" {
+			return
+		}
+		info, err := os.Stat(resolveManifestPath(roleManifest, script))
+		if err != nil || info.IsDir() {
+			allErrs = append(allErrs, validation.NotFound(path, script))
+		}
+	}
+
+	validateEnv("compilation.env", roleManifest.Compilation.Env)
+	validateVerify("compilation.verify", roleManifest.Compilation.Verify)
+
+	packageNames := make([]string, 0, len(roleManifest.Compilation.Packages))
+	for packageName := range roleManifest.Compilation.Packages {
+		packageNames = append(packageNames, packageName)
+	}
+	sort.Strings(packageNames)
+
+	for _, packageName := range packageNames {
+		found := false
+		for _, release := range roleManifest.LoadedReleases {
+			if _, err := release.LookupPackage(packageName); err == nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			allErrs = append(allErrs, validation.NotFound(
+				fmt.Sprintf("compilation.packages[%s]", packageName),
+				"package not found in any release"))
+			continue
+		}
+		if pkgConfig := roleManifest.Compilation.Packages[packageName]; pkgConfig != nil {
+			validateEnv(fmt.Sprintf("compilation.packages[%s].env", packageName), pkgConfig.Env)
+			validateVerify(fmt.Sprintf("compilation.packages[%s].verify", packageName), pkgConfig.Verify)
+		}
+	}
+
+	for index, isolation := range roleManifest.Compilation.Isolation {
+		fieldPath := fmt.Sprintf("compilation.isolation[%d]", index)
+		if isolation == nil {
+			allErrs = append(allErrs, validation.Required(fieldPath, "isolation settings must not be empty"))
+			continue
+		}
+		validPatterns := true
+		for _, field := range []struct{ name, pattern string }{
+			{"release", isolation.Release},
+			{"packages", isolation.Packages},
+		} {
+			if _, err := path.Match(field.pattern, ""); err != nil {
+				allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("%s.%s", fieldPath, field.name), field.pattern, "Invalid glob pattern"))
+				validPatterns = false
+			}
+		}
+		if isolation.MaxParallel < 0 {
+			allErrs = append(allErrs, validation.Invalid(fmt.Sprintf("%s.max_parallel", fieldPath), isolation.MaxParallel, "must not be negative"))
+		}
+		if !validPatterns {
+			continue
+		}
+		found := false
+		for _, release := range roleManifest.LoadedReleases {
+			for _, pkg := range release.Packages {
+				if isolation.Matches(pkg) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			allErrs = append(allErrs, validation.NotFound(fieldPath, "no package of any release matches"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateStemcellCompatibility checks that the version constraints of the
+// stemcell compatibility declaration can be parsed.
+func validateStemcellCompatibility(roleManifest *model.RoleManifest) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+	if roleManifest.Stemcell == nil {
+		return allErrs
+	}
+
+	constraints := []struct {
+		name  string
+		value string
+	}{
+		{"os_version", roleManifest.Stemcell.OSVersion},
+		{"libc", roleManifest.Stemcell.Libc},
+		{"version", roleManifest.Stemcell.Version},
+	}
+	for _, constraint := range constraints {
+		if constraint.value == "" {
+			continue
+		}
+		if _, err := semver.NewConstraint(constraint.value); err != nil {
+			allErrs = append(allErrs, validation.Invalid(
+				fmt.Sprintf("stemcell.%s", constraint.name),
+				constraint.value, err.Error()))
+		}
+	}
+
+	return allErrs
+}
@@ -3,8 +3,10 @@ package resolver
 import (
 	"fmt"
 	"regexp"
+	"strings"
 
 	"code.cloudfoundry.org/fissile/model"
+	"code.cloudfoundry.org/fissile/util"
 	"code.cloudfoundry.org/fissile/validation"
 )
 
@@ -19,6 +21,32 @@ func validateRoleRun(instanceGroup *model.InstanceGroup, roleManifest *model.Rol
 	allErrs = append(allErrs, validateHealthCheck(*instanceGroup)...)
 	allErrs = append(allErrs, validateRoleMemory(*instanceGroup)...)
 	allErrs = append(allErrs, validateRoleCPU(*instanceGroup)...)
+	allErrs = append(allErrs, validateRoleSecurityContext(*instanceGroup)...)
+
+	switch instanceGroup.Run.ImagePullPolicy {
+	case "", "Always", "IfNotPresent", "Never":
+	default:
+		allErrs = append(allErrs, validation.NotSupported(
+			fmt.Sprintf("instance_groups[%s].run.image-pull-policy", instanceGroup.Name),
+			instanceGroup.Run.ImagePullPolicy, []string{"Always", "IfNotPresent", "Never"}))
+	}
+
+	allErrs = append(allErrs, validateRoleNetworkIdentity(*instanceGroup)...)
+	allErrs = append(allErrs, validateRoleAffinityPreset(*instanceGroup)...)
+
+	if instanceGroup.Run.LogToStdout && instanceGroup.Type == model.RoleTypeBoshTask {
+		allErrs = append(allErrs, validation.Invalid(
+			fmt.Sprintf("instance_groups[%s].run.log-to-stdout", instanceGroup.Name),
+			instanceGroup.Run.LogToStdout, "tasks run their jobs in the foreground; only long running instance groups copy their log files"))
+	}
+
+	for i, path := range instanceGroup.Run.LogPaths {
+		if !strings.HasPrefix(path, model.SysLogDir+"/") {
+			allErrs = append(allErrs, validation.Invalid(
+				fmt.Sprintf("instance_groups[%s].run.log-paths[%d]", instanceGroup.Name, i),
+				path, fmt.Sprintf("log paths must be in %s", model.SysLogDir)))
+		}
+	}
 
 	if instanceGroup.Run.ServiceAccount != "" {
 		accountName := instanceGroup.Run.ServiceAccount
@@ -60,6 +88,79 @@ func validateJobReferences(instanceGroup *model.InstanceGroup) validation.ErrorL
 	return allErrs
 }
 
+// validateRoleSecurityContext validates the users and groups of the pod.  The
+// pod of colocated containers is set up by their main instance group.
+func validateRoleSecurityContext(instanceGroup model.InstanceGroup) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+	securityContext := instanceGroup.Run.SecurityContext
+	if securityContext == nil {
+		return allErrs
+	}
+
+	path := fmt.Sprintf("instance_groups[%s].run.security-context", instanceGroup.Name)
+	if instanceGroup.Type == model.RoleTypeColocatedContainer {
+		allErrs = append(allErrs, validation.Forbidden(path,
+			"colocated containers run in the pod of another instance group, which sets its security context"))
+	}
+	if securityContext.RunAsUser != nil {
+		allErrs = append(allErrs, validation.ValidateNonnegativeField(*securityContext.RunAsUser, path+".run-as-user")...)
+	}
+	if securityContext.RunAsGroup != nil {
+		allErrs = append(allErrs, validation.ValidateNonnegativeField(*securityContext.RunAsGroup, path+".run-as-group")...)
+	}
+	if securityContext.FSGroup != nil {
+		allErrs = append(allErrs, validation.ValidateNonnegativeField(*securityContext.FSGroup, path+".fs-group")...)
+	}
+	for _, id := range securityContext.SupplementalGroups {
+		allErrs = append(allErrs, validation.ValidateNonnegativeField(id, path+".supplemental-groups")...)
+	}
+	switch securityContext.FSGroupChangePolicy {
+	case "", "Always", "OnRootMismatch":
+	default:
+		allErrs = append(allErrs, validation.NotSupported(path+".fs-group-change-policy",
+			securityContext.FSGroupChangePolicy, []string{"Always", "OnRootMismatch"}))
+	}
+	if securityContext.FSGroupChangePolicy != "" && securityContext.FSGroup == nil {
+		allErrs = append(allErrs, validation.Required(path+".fs-group",
+			"fs-group-change-policy only applies to the fs-group"))
+	}
+
+	return allErrs
+}
+
+// validateDropCapabilities tests that an instance group dropping capabilities
+// keeps those its jobs are known to need: privileged containers have all
+// capabilities, and binding ports below 1024 needs NET_BIND_SERVICE.  It must
+// be called after the exposed ports have been parsed.
+func validateDropCapabilities(instanceGroup *model.InstanceGroup) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+	if !instanceGroup.Run.DropCapabilities {
+		return allErrs
+	}
+
+	if instanceGroup.Run.Privileged || util.StringInSlice("ALL", instanceGroup.Run.Capabilities) {
+		allErrs = append(allErrs, validation.Invalid(
+			fmt.Sprintf("instance_groups[%s].run.drop-capabilities", instanceGroup.Name),
+			instanceGroup.Run.DropCapabilities,
+			"Privileged instance groups and those adding ALL capabilities cannot drop capabilities"))
+		return allErrs
+	}
+
+	if util.StringInSlice("NET_BIND_SERVICE", instanceGroup.Run.Capabilities) {
+		return allErrs
+	}
+	for _, job := range instanceGroup.JobReferences {
+		for _, port := range job.ContainerProperties.BoshContainerization.Ports {
+			if port.InternalPort < 1024 {
+				allErrs = append(allErrs, validation.Forbidden(
+					fmt.Sprintf("instance_groups[%s].jobs[%s].ports[%s]", instanceGroup.Name, job.Name, port.Name),
+					fmt.Sprintf("Port %d needs the NET_BIND_SERVICE capability, which is dropped", port.InternalPort)))
+			}
+		}
+	}
+	return allErrs
+}
+
 // normalizeFlightStage reports instance groups with a bad flightstage, and
 // fixes all instance groups without a flight stage to use the default
 // ('flight').
@@ -244,9 +345,130 @@ func validateExposedPorts(name, jobName string, exposedPorts *model.JobExposedPo
 				exposedPorts.Count, exposedPorts.Max)))
 	}
 
+	// Validate that the largest number of ports still fits the port numbers
+	if exposedPorts.InternalPort+exposedPorts.Max-1 > 65535 {
+		allErrs = append(allErrs, validation.Invalid(fieldName+".max", exposedPorts.Max,
+			fmt.Sprintf("internal ports starting at %d exceed 65535", exposedPorts.InternalPort)))
+	}
+	if exposedPorts.ExternalPort+exposedPorts.Max-1 > 65535 {
+		allErrs = append(allErrs, validation.Invalid(fieldName+".max", exposedPorts.Max,
+			fmt.Sprintf("external ports starting at %d exceed 65535", exposedPorts.ExternalPort)))
+	}
+
+	if exposedPorts.NodePort != 0 {
+		if !exposedPorts.Public {
+			allErrs = append(allErrs, validation.Invalid(fieldName+".node-port", exposedPorts.NodePort,
+				"node ports require a public port"))
+		}
+		if exposedPorts.NodePort < model.MinNodePort || exposedPorts.NodePort+exposedPorts.Max-1 > model.MaxNodePort {
+			allErrs = append(allErrs, validation.Invalid(fieldName+".node-port", exposedPorts.NodePort,
+				fmt.Sprintf("node ports must be between %d and %d, inclusive, for all %d ports",
+					model.MinNodePort, model.MaxNodePort, exposedPorts.Max)))
+		}
+	}
+
+	if exposedPorts.Metrics != "" {
+		if !strings.HasPrefix(exposedPorts.Metrics, "/") {
+			allErrs = append(allErrs, validation.Invalid(fieldName+".metrics", exposedPorts.Metrics,
+				"the metrics path must start with /"))
+		}
+		if strings.ToUpper(exposedPorts.Protocol) == "UDP" {
+			allErrs = append(allErrs, validation.Invalid(fieldName+".metrics", exposedPorts.Metrics,
+				"metrics are served over HTTP, which needs a TCP port"))
+		}
+		if exposedPorts.Max > 1 {
+			allErrs = append(allErrs, validation.Invalid(fieldName+".metrics", exposedPorts.Metrics,
+				"metrics must be served on a single port, not a port range"))
+		}
+	}
+
 	// Clear out legacy fields to make sure they aren't still be used elsewhere in the code
 	exposedPorts.Internal = ""
 	exposedPorts.External = ""
 
 	return allErrs
 }
+
+// validateRoleNetworkIdentity validates the names setting the DNS names of the
+// pods of the instance group: the headless service of the stateful sets of
+// bosh instance groups, and the hostname and subdomain of the pods of tasks.
+// Stateful sets set the hostname and subdomain of their pods themselves.
+func validateRoleNetworkIdentity(instanceGroup model.InstanceGroup) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+
+	names := []struct {
+		key, value string
+		roleType   model.RoleType
+	}{
+		{"service-name", instanceGroup.Run.ServiceName, model.RoleTypeBosh},
+		{"hostname", instanceGroup.Run.Hostname, model.RoleTypeBoshTask},
+		{"subdomain", instanceGroup.Run.Subdomain, model.RoleTypeBoshTask},
+	}
+	for _, name := range names {
+		if name.value == "" {
+			continue
+		}
+		field := fmt.Sprintf("instance_groups[%s].run.%s", instanceGroup.Name, name.key)
+		if !dnsLabelPattern.MatchString(name.value) || len(name.value) > 63 {
+			allErrs = append(allErrs, validation.Invalid(field, name.value,
+				"must consist of at most 63 lower case alphanumeric characters or '-'"))
+		}
+		if instanceGroup.Type != name.roleType {
+			allErrs = append(allErrs, validation.Forbidden(field,
+				fmt.Sprintf("only instance groups of type %s can set it", name.roleType)))
+		}
+	}
+
+	return allErrs
+}
+
+// validateRoleAffinityPreset validates the affinity preset of the instance
+// group, which cannot be combined with raw affinity rules of the same kind
+func validateRoleAffinityPreset(instanceGroup model.InstanceGroup) validation.ErrorList {
+	allErrs := validation.ErrorList{}
+	preset := instanceGroup.Run.AffinityPreset
+	if preset == "" {
+		return allErrs
+	}
+
+	field := fmt.Sprintf("instance_groups[%s].run.affinity-preset", instanceGroup.Name)
+	var conflicts []string
+	affinity := instanceGroup.Run.Affinity
+	if affinity == nil {
+		affinity = &model.RoleRunAffinity{}
+	}
+	switch preset {
+	case model.AffinityPresetSpread:
+		if affinity.PodAntiAffinity != nil {
+			conflicts = append(conflicts, "podAntiAffinity")
+		}
+	case model.AffinityPresetPack:
+		if affinity.PodAntiAffinity != nil {
+			conflicts = append(conflicts, "podAntiAffinity")
+		}
+		if affinity.PodAffinity != nil {
+			conflicts = append(conflicts, "podAffinity")
+		}
+	case model.AffinityPresetDedicateNode:
+		if affinity.NodeAffinity != nil {
+			conflicts = append(conflicts, "nodeAffinity")
+		}
+	default:
+		var presets []string
+		for _, preset := range model.AffinityPresets {
+			presets = append(presets, string(preset))
+		}
+		return append(allErrs, validation.NotSupported(field, preset, presets))
+	}
+
+	for _, conflict := range conflicts {
+		allErrs = append(allErrs, validation.Invalid(field, preset,
+			fmt.Sprintf("conflicts with run.affinity.%s", conflict)))
+	}
+	if instanceGroup.Type != model.RoleTypeBosh {
+		allErrs = append(allErrs, validation.Forbidden(field,
+			fmt.Sprintf("only instance groups of type %s can set it", model.RoleTypeBosh)))
+	}
+
+	return allErrs
+}
@@ -4,8 +4,11 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+
+	"code.cloudfoundry.org/fissile/util"
 )
 
 // RoleRun describes how a role should behave at runtime
@@ -13,6 +16,7 @@ type RoleRun struct {
 	Scaling            *RoleRunScaling  `yaml:"scaling"`
 	Capabilities       []string         `yaml:"capabilities"`
 	Privileged         bool             `yaml:"privileged"`
+	DropCapabilities   bool             `yaml:"drop-capabilities,omitempty"`
 	PersistentVolumes  []*RoleRunVolume `yaml:"persistent-volumes"` // Backwards compat only
 	SharedVolumes      []*RoleRunVolume `yaml:"shared-volumes"`     // Backwards compat only
 	Volumes            []*RoleRunVolume `yaml:"volumes"`
@@ -20,11 +24,43 @@ type RoleRun struct {
 	Memory             *RoleRunMemory   `yaml:"mem"`
 	VirtualCPUs        *float64         `yaml:"virtual-cpus"`
 	CPU                *RoleRunCPU      `yaml:"cpu"`
+	PodBudget          *RoleRunBudget   `yaml:"pod-budget,omitempty"`
+	SecurityContext    *RoleRunSecurity `yaml:"security-context,omitempty"`
 	FlightStage        FlightStage      `yaml:"flight-stage"`
 	HealthCheck        *HealthCheck     `yaml:"healthcheck,omitempty"`
 	ActivePassiveProbe string           `yaml:"active-passive-probe,omitempty"`
 	ServiceAccount     string           `yaml:"service-account,omitempty"`
 	Affinity           *RoleRunAffinity `yaml:"affinity,omitempty"`
+	AffinityPreset     AffinityPreset   `yaml:"affinity-preset,omitempty"`
+	Command            []string         `yaml:"command,omitempty"`
+	Args               []string         `yaml:"args,omitempty"`
+	ImagePullPolicy    string           `yaml:"image-pull-policy,omitempty"`
+	ServiceName        string           `yaml:"service-name,omitempty"` // Headless service of the stateful set, instead of <name>-set
+	Hostname           string           `yaml:"hostname,omitempty"`
+	Subdomain          string           `yaml:"subdomain,omitempty"`
+	LogPaths           []string         `yaml:"log-paths,omitempty"`     // Globs of the log files of the job, for log sidecars
+	LogToStdout        bool             `yaml:"log-to-stdout,omitempty"` // Copy the log files to the output of the container
+}
+
+// SysLogDir is the directory the jobs write their log files to
+const SysLogDir = "/var/vcap/sys/log"
+
+// RuntimeCapabilities are the capabilities the entrypoint of the role images
+// and monit need to prepare the jobs and run them as vcap; they are kept when
+// dropping capabilities.
+var RuntimeCapabilities = []string{"CHOWN", "DAC_OVERRIDE", "FOWNER", "KILL", "SETGID", "SETUID"}
+
+// RetainedCapabilities returns the capabilities the container keeps when
+// dropping capabilities: the declared ones, and the RuntimeCapabilities.
+func (r *RoleRun) RetainedCapabilities() []string {
+	capabilities := append([]string{}, r.Capabilities...)
+	for _, capability := range RuntimeCapabilities {
+		if !util.StringInSlice(capability, capabilities) {
+			capabilities = append(capabilities, capability)
+		}
+	}
+	sort.Strings(capabilities)
+	return capabilities
 }
 
 // RoleRunAffinity describes how a role should behave with regard to node / pod selection
@@ -34,16 +70,57 @@ type RoleRunAffinity struct {
 	NodeAffinity    interface{} `yaml:"nodeAffinity,omitempty"`
 }
 
+// AffinityPreset is a named combination of affinity rules and tolerations for
+// the pods of an instance group, used instead of writing them out
+type AffinityPreset string
+
+// These are the valid affinity presets
+const (
+	AffinityPresetSpread       = AffinityPreset("spread")        // Prefer to schedule the pods on different nodes
+	AffinityPresetPack         = AffinityPreset("pack")          // Prefer to schedule the pods on the same nodes
+	AffinityPresetDedicateNode = AffinityPreset("dedicate-node") // Schedule the pods only on the nodes labeled and tainted for the instance group
+)
+
+// AffinityPresets are the valid affinity presets, in the order of the docs
+var AffinityPresets = []AffinityPreset{AffinityPresetSpread, AffinityPresetPack, AffinityPresetDedicateNode}
+
 // RoleRunMemory describes how a role should behave with regard to memory usage.
+// The request and limit are in MiB; those given as quantities are also kept
+// as written.
 type RoleRunMemory struct {
-	Request *int64 `yaml:"request"`
-	Limit   *int64 `yaml:"limit"`
+	Request         *int64 `yaml:"request"`
+	Limit           *int64 `yaml:"limit"`
+	RequestQuantity string `yaml:"-"`
+	LimitQuantity   string `yaml:"-"`
 }
 
 // RoleRunCPU describes how a role should behave with regard to cpu usage.
+// The request and limit are in cores; those given as quantities are also
+// kept as written.
 type RoleRunCPU struct {
-	Request *float64 `yaml:"request"`
-	Limit   *float64 `yaml:"limit"`
+	Request         *float64 `yaml:"request"`
+	Limit           *float64 `yaml:"limit"`
+	RequestQuantity string   `yaml:"-"`
+	LimitQuantity   string   `yaml:"-"`
+}
+
+// RoleRunBudget limits the resources of all containers of the pod of a role
+// together, i.e. including its colocated containers.  Memory is in MiB, CPU
+// in cores, like the requests and limits of the containers.
+type RoleRunBudget struct {
+	Memory *int64   `yaml:"memory"`
+	CPU    *float64 `yaml:"cpu"`
+}
+
+// RoleRunSecurity describes the users and groups the containers of the pod of
+// a role run as, and the group owning its volumes, e.g. the GID an NFS backed
+// persistent volume requires.
+type RoleRunSecurity struct {
+	RunAsUser           *int64  `yaml:"run-as-user,omitempty"`
+	RunAsGroup          *int64  `yaml:"run-as-group,omitempty"`
+	FSGroup             *int64  `yaml:"fs-group,omitempty"`
+	FSGroupChangePolicy string  `yaml:"fs-group-change-policy,omitempty"`
+	SupplementalGroups  []int64 `yaml:"supplemental-groups,omitempty"`
 }
 
 // RoleRunScaling describes how a role should scale out at runtime
@@ -170,11 +247,40 @@ func (r *RoleRun) mergeCapabilities(jobReferences JobReferences) {
 		if j.ContainerProperties.BoshContainerization.Run.Privileged {
 			r.Privileged = true
 		}
+		if j.ContainerProperties.BoshContainerization.Run.DropCapabilities {
+			r.DropCapabilities = true
+		}
 	}
 
 	for k := range seen {
 		r.Capabilities = append(r.Capabilities, k)
 	}
+	sort.Strings(r.Capabilities)
+}
+
+// mergeLogPaths collects the log paths of all jobs, and copies the log files
+// to the output of the container if any job asks for it.  Jobs which declare
+// no log paths log to the *.log files of their directory in SysLogDir.
+func (r *RoleRun) mergeLogPaths(jobReferences JobReferences) {
+	seen := map[string]bool{}
+	for _, j := range jobReferences {
+		var paths []string
+		if run := j.ContainerProperties.BoshContainerization.Run; run != nil {
+			paths = run.LogPaths
+			if run.LogToStdout {
+				r.LogToStdout = true
+			}
+		}
+		if len(paths) == 0 {
+			paths = []string{fmt.Sprintf("%s/%s/*.log", SysLogDir, j.Name)}
+		}
+		for _, path := range paths {
+			if !seen[path] {
+				seen[path] = true
+				r.LogPaths = append(r.LogPaths, path)
+			}
+		}
+	}
 }
 
 // setVolumes collects uniq volumes from every job using a fingerprint, also
@@ -217,8 +323,10 @@ func (r *RoleRun) mergeVolumes(jobReferences JobReferences) {
 }
 
 func (r *RoleRun) setMaxFields(jobReferences JobReferences) {
-	var maxMem, maxMemLimit, maxMemRequest *int64
-	var maxVirtualCPUs, maxCPULimit, maxCPURequest *float64
+	var maxMem *int64
+	var maxVirtualCPUs *float64
+	var memory RoleRunMemory
+	var cpu RoleRunCPU
 
 	for _, j := range jobReferences {
 		run := j.ContainerProperties.BoshContainerization.Run
@@ -228,11 +336,11 @@ func (r *RoleRun) setMaxFields(jobReferences JobReferences) {
 			}
 		}
 		if run.Memory != nil {
-			if test := run.Memory.Limit; maxMemLimit == nil || *test > *maxMemLimit {
-				maxMemLimit = test
+			if test := run.Memory.Limit; test != nil && (memory.Limit == nil || *test > *memory.Limit) {
+				memory.Limit, memory.LimitQuantity = test, run.Memory.LimitQuantity
 			}
-			if test := run.Memory.Request; maxMemRequest == nil || *test > *maxMemRequest {
-				maxMemRequest = test
+			if test := run.Memory.Request; test != nil && (memory.Request == nil || *test > *memory.Request) {
+				memory.Request, memory.RequestQuantity = test, run.Memory.RequestQuantity
 			}
 		}
 		if run.VirtualCPUs != nil {
@@ -241,20 +349,20 @@ func (r *RoleRun) setMaxFields(jobReferences JobReferences) {
 			}
 		}
 		if run.CPU != nil {
-			if test := run.CPU.Limit; maxCPULimit == nil || *test > *maxCPULimit {
-				maxCPULimit = test
+			if test := run.CPU.Limit; test != nil && (cpu.Limit == nil || *test > *cpu.Limit) {
+				cpu.Limit, cpu.LimitQuantity = test, run.CPU.LimitQuantity
 			}
-			if test := run.CPU.Request; maxCPURequest == nil || *test > *maxCPURequest {
-				maxCPURequest = test
+			if test := run.CPU.Request; test != nil && (cpu.Request == nil || *test > *cpu.Request) {
+				cpu.Request, cpu.RequestQuantity = test, run.CPU.RequestQuantity
 			}
 		}
 	}
 	r.MemRequest = maxMem
-	if maxMemLimit != nil || maxMemRequest != nil {
-		r.Memory = &RoleRunMemory{Limit: maxMemLimit, Request: maxMemRequest}
+	if memory.Limit != nil || memory.Request != nil {
+		r.Memory = &memory
 	}
 	r.VirtualCPUs = maxVirtualCPUs
-	if maxCPULimit != nil || maxCPURequest != nil {
-		r.CPU = &RoleRunCPU{Limit: maxCPULimit, Request: maxCPURequest}
+	if cpu.Limit != nil || cpu.Request != nil {
+		r.CPU = &cpu
 	}
 }
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+)
+
+// RoleVersionRecord breaks the dev version of an instance group down into
+// the inputs it was calculated from.  Records are written at build time so
+// that the changes between two sets of images can be explained later.
+// Property values, scripts and configuration templates are only recorded as
+// sha256 digests, as they may be large or sensitive.
+type RoleVersionRecord struct {
+	DevVersion     string            `json:"dev_version" yaml:"dev_version"`
+	FissileVersion string            `json:"fissile_version" yaml:"fissile_version"`
+	TagExtra       string            `json:"tag_extra" yaml:"tag_extra"`
+	Jobs           map[string]string `json:"jobs" yaml:"jobs"`
+	Packages       map[string]string `json:"packages" yaml:"packages"`
+	Scripts        map[string]string `json:"scripts" yaml:"scripts"`
+	Templates      map[string]string `json:"templates" yaml:"templates"`
+	Properties     map[string]string `json:"properties" yaml:"properties"`
+	Dockerfile     string            `json:"dockerfile,omitempty" yaml:"dockerfile,omitempty"`
+	Healthcheck    string            `json:"healthcheck,omitempty" yaml:"healthcheck,omitempty"`
+}
+
+// ImageSetRecord holds the version records of all instance groups built together
+type ImageSetRecord struct {
+	Roles map[string]*RoleVersionRecord `json:"roles" yaml:"roles"`
+}
+
+func hashString(value string) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(value))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// GetRoleVersionRecord returns the inputs used to calculate the dev version of
+// the instance group, see GetRoleDevVersion.
+func (g *InstanceGroup) GetRoleVersionRecord(opinions *Opinions, tagExtra, fissileVersion string, imageOptions RoleImageOptions) (*RoleVersionRecord, error) {
+	devVersion, err := g.GetRoleDevVersion(opinions, tagExtra, fissileVersion, imageOptions, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &RoleVersionRecord{
+		DevVersion:     devVersion,
+		FissileVersion: fissileVersion,
+		TagExtra:       tagExtra,
+		Jobs:           make(map[string]string),
+		Packages:       make(map[string]string),
+		Scripts:        make(map[string]string),
+		Templates:      make(map[string]string),
+		Properties:     make(map[string]string),
+	}
+
+	for _, jobReference := range g.JobReferences {
+		record.Jobs[fmt.Sprintf("%s/%s", jobReference.ReleaseName, jobReference.Name)] = jobReference.SHA1
+		for _, link := range g.PackageLinks(jobReference) {
+			record.Packages[fmt.Sprintf("%s/%s", link.Package.Release.Name, link.Package.Name)] = link.Package.SHA1
+		}
+
+		if opinions != nil {
+			properties, err := jobReference.GetPropertiesForJob(opinions)
+			if err != nil {
+				return nil, err
+			}
+			for property, value := range FlattenOpinions(properties, true) {
+				record.Properties[fmt.Sprintf("%s/%s", jobReference.Name, property)] = hashString(value)
+			}
+		}
+	}
+
+	for filename, path := range g.GetScriptPaths() {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		record.Scripts[filename] = hashString(string(contents))
+	}
+
+	if g.Configuration != nil {
+		for key, template := range g.Configuration.Templates {
+			record.Templates[key] = hashString(template.Value)
+		}
+	}
+
+	if g.Dockerfile != nil {
+		record.Dockerfile, err = g.GetDockerfileSignature()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !imageOptions.NoHealthcheck {
+		record.Healthcheck, err = g.DockerHealthcheck()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return record, nil
+}
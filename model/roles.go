@@ -3,6 +3,7 @@ package model
 import (
 	"fmt"
 	"io/ioutil"
+	"sort"
 
 	"code.cloudfoundry.org/fissile/util"
 	yaml "gopkg.in/yaml.v2"
@@ -13,12 +14,24 @@ type RoleManifest struct {
 	InstanceGroups InstanceGroups `yaml:"instance_groups"`
 	Configuration  *Configuration `yaml:"configuration"`
 	Variables      Variables
-	Releases       []*ReleaseRef `yaml:"releases"`
+	Releases       []*ReleaseRef          `yaml:"releases"`
+	Compilation    *CompilationConfig     `yaml:"compilation,omitempty"`
+	Stemcell       *StemcellCompatibility `yaml:"stemcell,omitempty"`
+	StartupOrder   [][]string             `yaml:"startup_order,omitempty"` // Sequences of instance groups, each starting once the previous one is ready
 
 	LoadedReleases   Releases
 	Features         map[string]bool
 	ManifestFilePath string
-	ManifestContent  []byte `yaml:"-"`
+	// ManifestContent is the content of the role manifest file as read,
+	// still encrypted if the file is encrypted with SOPS, so that it can end
+	// up in generated output without exposing secrets.
+	ManifestContent []byte `yaml:"-"`
+	// parsedContent is the content the role manifest is parsed from:
+	// decrypted, with the anchors expanded.
+	parsedContent []byte
+	// AnchorOrigins maps the paths of values taken from anchors to the name
+	// of the anchor; see anchorsKey.
+	AnchorOrigins map[string]string `yaml:"-"`
 }
 
 // RoleManifestValidationOptions allows tests to skip some parts of validation
@@ -40,17 +53,37 @@ func NewRoleManifest() *RoleManifest {
 	return m
 }
 
-// LoadManifestFromFile loads the manifest content from a file
+// LoadManifestFromFile loads the manifest content from a file, which may be
+// encrypted with SOPS
 func (m *RoleManifest) LoadManifestFromFile(manifestFilePath string) (err error) {
 	m.ManifestContent, err = ioutil.ReadFile(manifestFilePath)
 	if err != nil {
 		return
 	}
 	m.ManifestFilePath = manifestFilePath
-	err = yaml.Unmarshal(m.ManifestContent, &m)
+	content, err := util.ReadSopsFile(manifestFilePath, util.SopsFormatYAML)
+	if err != nil {
+		return
+	}
+	m.parsedContent, m.AnchorOrigins, err = expandAnchors(content)
+	if err != nil {
+		return
+	}
+	err = yaml.Unmarshal(m.parsedContent, &m)
 	return
 }
 
+// ParsedContent returns the content the role manifest was parsed from: the
+// decrypted content of the file, with the anchors expanded, or
+// ManifestContent if it was not loaded from a file.  It must not end up in
+// generated output.
+func (m *RoleManifest) ParsedContent() []byte {
+	if m.parsedContent == nil {
+		return m.ManifestContent
+	}
+	return m.parsedContent
+}
+
 // AddFeature will add a feature name to the manifest.
 // A feature needs to be enabled only once to be enabled globally.
 func (m *RoleManifest) AddFeature(name string, enabledByDefault bool) {
@@ -61,6 +94,25 @@ func (m *RoleManifest) AddFeature(name string, enabledByDefault bool) {
 	}
 }
 
+// Copy returns a copy of the role manifest whose variables and instance
+// groups can be changed without affecting the original.  The instance groups
+// of the copy refer to the copy; their jobs and run settings are shared.
+func (m *RoleManifest) Copy() *RoleManifest {
+	result := *m
+	result.Variables = make(Variables, len(m.Variables))
+	for index, variable := range m.Variables {
+		copied := *variable
+		result.Variables[index] = &copied
+	}
+	result.InstanceGroups = make(InstanceGroups, len(m.InstanceGroups))
+	for index, instanceGroup := range m.InstanceGroups {
+		copied := *instanceGroup
+		copied.SetRoleManifest(&result)
+		result.InstanceGroups[index] = &copied
+	}
+	return &result
+}
+
 // LookupInstanceGroup will find the given instance group in the role manifest
 func (m *RoleManifest) LookupInstanceGroup(name string) *InstanceGroup {
 	for _, instanceGroup := range m.InstanceGroups {
@@ -71,6 +123,24 @@ func (m *RoleManifest) LookupInstanceGroup(name string) *InstanceGroup {
 	return nil
 }
 
+// StartupDependencies returns the sorted names of the instance groups which
+// must be ready before the named instance group starts: those preceding it in
+// the sequences of the startup order
+func (m *RoleManifest) StartupDependencies(name string) []string {
+	seen := make(map[string]bool)
+	var dependencies []string
+	for _, sequence := range m.StartupOrder {
+		for index, candidate := range sequence {
+			if candidate == name && index > 0 && !seen[sequence[index-1]] {
+				seen[sequence[index-1]] = true
+				dependencies = append(dependencies, sequence[index-1])
+			}
+		}
+	}
+	sort.Strings(dependencies)
+	return dependencies
+}
+
 // SelectInstanceGroups will find only the given instance groups in the role manifest
 func (m *RoleManifest) SelectInstanceGroups(roleNames []string) (InstanceGroups, error) {
 	if len(roleNames) == 0 {
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"code.cloudfoundry.org/fissile/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadManifestFromFileEncrypted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fissile-roles-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The fake sops prints the decrypted role manifest
+	fakeSops := filepath.Join(dir, "sops")
+	decrypted := "variables:\n- name: PASSWORD\n  options:\n    default: hunter2\n"
+	require.NoError(t, ioutil.WriteFile(fakeSops, []byte("#!/bin/sh\nprintf '"+decrypted+"'\n"), 0755))
+	defer func(command string) { util.SopsCommand = command }(util.SopsCommand)
+	util.SopsCommand = fakeSops
+
+	encrypted := "variables:\n- name: PASSWORD\n  options:\n    default: ENC[AES256_GCM,data:x]\nsops:\n  mac: ENC[AES256_GCM,data:y]\n"
+	path := filepath.Join(dir, "role-manifest.yml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(encrypted), 0644))
+
+	m := NewRoleManifest()
+	require.NoError(t, m.LoadManifestFromFile(path))
+	require.Len(t, m.Variables, 1)
+	assert.Equal(t, "PASSWORD", m.Variables[0].Name)
+	assert.Equal(t, encrypted, string(m.ManifestContent), "The decrypted values are kept out of the manifest content")
+	assert.Contains(t, string(m.ParsedContent()), "default: hunter2")
+}
@@ -0,0 +1,98 @@
+package model
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// StemcellCompatibility declares which stemcells the releases of a role
+// manifest may be compiled against.  OS must match the ID field of the
+// stemcell's /etc/os-release exactly; the other fields are version
+// constraints (e.g. ">= 2.26").  Empty fields are not checked.
+type StemcellCompatibility struct {
+	OS        string `yaml:"os,omitempty"`
+	OSVersion string `yaml:"os_version,omitempty"`
+	Libc      string `yaml:"libc,omitempty"`
+	Version   string `yaml:"version,omitempty"`
+}
+
+// StemcellInfo describes the properties of a stemcell image relevant to
+// compiling packages against it.
+type StemcellInfo struct {
+	OS        string
+	OSVersion string
+	Libc      string
+	Version   string
+}
+
+// ParseStemcellInfo parses the key=value lines printed by the stemcell
+// probe script.  Unknown keys are ignored.
+func ParseStemcellInfo(probeOutput string) *StemcellInfo {
+	info := &StemcellInfo{}
+	scanner := bufio.NewScanner(strings.NewReader(probeOutput))
+	for scanner.Scan() {
+		parts := strings.SplitN(strings.TrimSpace(scanner.Text()), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.Trim(parts[1], `"`)
+		switch parts[0] {
+		case "os":
+			info.OS = value
+		case "os_version":
+			info.OSVersion = value
+		case "libc":
+			info.Libc = value
+		case "version":
+			info.Version = value
+		}
+	}
+	return info
+}
+
+// Check verifies that the inspected stemcell satisfies the declaration,
+// returning an error listing every mismatch.
+func (c *StemcellCompatibility) Check(info *StemcellInfo) error {
+	if c == nil {
+		return nil
+	}
+
+	var problems []string
+	if c.OS != "" && c.OS != info.OS {
+		problems = append(problems, fmt.Sprintf("os: expected %q, found %q", c.OS, info.OS))
+	}
+
+	checkVersion := func(name, constraint, actual string) {
+		if constraint == "" {
+			return
+		}
+		if actual == "" {
+			problems = append(problems, fmt.Sprintf("%s: could not be determined, expected %s", name, constraint))
+			return
+		}
+		constraints, err := semver.NewConstraint(constraint)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: invalid constraint %q: %s", name, constraint, err))
+			return
+		}
+		version, err := semver.NewVersion(actual)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: cannot parse version %q: %s", name, actual, err))
+			return
+		}
+		if !constraints.Check(version) {
+			problems = append(problems, fmt.Sprintf("%s: %s does not satisfy %s", name, actual, constraint))
+		}
+	}
+	checkVersion("os_version", c.OSVersion, info.OSVersion)
+	checkVersion("libc", c.Libc, info.Libc)
+	checkVersion("version", c.Version, info.Version)
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
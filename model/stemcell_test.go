@@ -0,0 +1,40 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStemcellInfo(t *testing.T) {
+	info := ParseStemcellInfo(`os=opensuse-leap
+os_version="15.1"
+libc=2.26
+unknown=ignored
+garbage
+version=`)
+	assert.Equal(t, &StemcellInfo{
+		OS:        "opensuse-leap",
+		OSVersion: "15.1",
+		Libc:      "2.26",
+	}, info)
+}
+
+func TestStemcellCompatibilityCheck(t *testing.T) {
+	info := &StemcellInfo{OS: "opensuse-leap", OSVersion: "15.1", Libc: "2.26", Version: "42.1"}
+
+	var nilCompatibility *StemcellCompatibility
+	assert.NoError(t, nilCompatibility.Check(info))
+
+	compatibility := &StemcellCompatibility{OS: "opensuse-leap", OSVersion: "~15.1", Libc: ">= 2.26, < 3", Version: "42.x"}
+	assert.NoError(t, compatibility.Check(info))
+
+	compatibility = &StemcellCompatibility{OS: "ubuntu", OSVersion: ">= 16.04", Libc: ">= 2.27"}
+	assert.EqualError(t, compatibility.Check(info), `os: expected "ubuntu", found "opensuse-leap"
+os_version: 15.1 does not satisfy >= 16.04
+libc: 2.26 does not satisfy >= 2.27`)
+
+	compatibility = &StemcellCompatibility{Libc: ">= 2.26"}
+	assert.EqualError(t, compatibility.Check(&StemcellInfo{Libc: "unknown"}),
+		`libc: cannot parse version "unknown": Invalid Semantic Version`)
+}
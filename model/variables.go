@@ -48,6 +48,8 @@ type CVOptions struct {
 	IsCA          bool        `yaml:"is_ca,omitempty"`
 	RoleName      string      `yaml:"role_name,omitempty"`
 	AltNames      []string    `yaml:"alternative_names,omitempty"`
+	Length        int         `yaml:"length,omitempty"`
+	KeyBits       int         `yaml:"key_bits,omitempty"`
 }
 
 // CVType is the type of the configuration variable; see the constants below
@@ -89,6 +91,16 @@ func (config *VariableDefinition) Value() (bool, string) {
 	return true, stringifiedValue
 }
 
+// Lookup returns the variable with the given name, or nil if there is none
+func (confVars Variables) Lookup(name string) *VariableDefinition {
+	for _, variable := range confVars {
+		if variable.Name == name {
+			return variable
+		}
+	}
+	return nil
+}
+
 // Len is the number of ConfigurationVariables in the slice
 func (confVars Variables) Len() int {
 	return len(confVars)
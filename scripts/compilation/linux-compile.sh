@@ -3,7 +3,7 @@ set -o errexit -o nounset
 
 usage() {
   echo "Package ${1} not specified" >&2
-  echo "Usage: ${0} <package> <version> [buildroot]" >&2
+  echo "Usage: ${0} <package> <version> [buildroot [fingerprint]]" >&2
   exit 1
 }
 
@@ -17,6 +17,7 @@ if test -z "${packageVersion}" ; then
 fi
 
 if test -d "/fissile-in/var/vcap" ; then
+  verifyDir="/fissile-in/verify"
   mkdir -p "/var/vcap"
   cp -r "/fissile-in/var/vcap/"* /var/vcap
 else
@@ -25,8 +26,12 @@ else
   if test -z "${buildroot}" ; then
     usage "build root"
   fi
+  # The work directory is named after the package fingerprint, which
+  # differs from the version if compilation settings were applied
+  packageWorkDir="${buildroot}/${4:-${packageVersion}}"
+  verifyDir="${packageWorkDir}/sources/verify"
   mkdir -p /var/vcap
-  mount --bind "${buildroot}/${packageVersion}/sources/var/vcap" /var/vcap
+  mount --bind "${packageWorkDir}/sources/var/vcap" /var/vcap
 fi
 
 export BOSH_COMPILE_TARGET="/var/vcap/source/$packageName"
@@ -39,14 +44,33 @@ echo "Compiling to ${BOSH_INSTALL_TARGET}"
 if test -d "/fissile-out" ; then
   ln -s /fissile-out "${BOSH_INSTALL_TARGET}"
 else
-  rm -rf "${buildroot}/${packageVersion}/compiled-temp"
-  mkdir -p "${buildroot}/${packageVersion}/compiled-temp"
+  rm -rf "${packageWorkDir}/compiled-temp"
+  mkdir -p "${packageWorkDir}/compiled-temp"
   mkdir -p "${BOSH_INSTALL_TARGET}"
-  mount --bind "${buildroot}/${packageVersion}/compiled-temp" "${BOSH_INSTALL_TARGET}"
+  mount --bind "${packageWorkDir}/compiled-temp" "${BOSH_INSTALL_TARGET}"
 fi
 
 cd "${BOSH_COMPILE_TARGET}"
-bash ./packaging
+# The exit code of failed verifications is reserved; the packaging script
+# failing with it is reported as a plain failure, with its code in the log
+bash ./packaging || {
+  exitCode=$?
+  if test "${exitCode}" -eq 86 ; then
+    echo "Packaging script failed with exit code ${exitCode}" >&2
+    exit 1
+  fi
+  exit "${exitCode}"
+}
+
+# Check the compiled package with the verification scripts of the release
+# and the role manifest, if any; their failure has an exit code of its own
+if test -d "${verifyDir}" ; then
+  cd "${BOSH_INSTALL_TARGET}"
+  for script in "${verifyDir}"/* ; do
+    echo "Verifying with the ${script##*/} script"
+    bash "${script}" || exit 86
+  done
+fi
 
 chown -R "${HOST_USERID}:${HOST_USERGID}" "$(readlink --canonicalize "${BOSH_INSTALL_TARGET}")" 2>/dev/null \
   || echo "Warning - could not change ownership of compiled artifacts" 1>&2
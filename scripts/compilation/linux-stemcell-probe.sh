@@ -0,0 +1,25 @@
+#!/bin/bash
+
+# Prints the properties of the stemcell that compiled packages depend on, as
+# key=value lines.  Missing information results in empty values.
+
+if [ -r /etc/os-release ]; then
+    . /etc/os-release
+fi
+echo "os=${ID:-}"
+echo "os_version=${VERSION_ID:-}"
+
+libc=""
+if command -v getconf >/dev/null 2>&1; then
+    libc="$(getconf GNU_LIBC_VERSION 2>/dev/null | awk '{ print $2 }')"
+fi
+if [ -z "${libc}" ] && command -v ldd >/dev/null 2>&1; then
+    libc="$(ldd --version 2>/dev/null | head -n 1 | awk '{ print $NF }')"
+fi
+echo "libc=${libc}"
+
+version=""
+if [ -r /var/vcap/bosh/etc/stemcell_version ]; then
+    version="$(cat /var/vcap/bosh/etc/stemcell_version)"
+fi
+echo "version=${version}"
@@ -17,6 +17,13 @@ const (
 	CompilationScript = "compile"
 	// PrerequisitesScript is the script that installs prerequisites
 	PrerequisitesScript = "prerequisites"
+	// StemcellProbeScript is the script that reports the stemcell properties
+	StemcellProbeScript = "stemcell-probe"
+
+	// VerificationFailedExitCode is the exit code of the compilation
+	// script when a verification script rejects the compiled package; it
+	// exits with 1 instead when the packaging script fails with this code
+	VerificationFailedExitCode = 86
 )
 
 // SaveScript will write a script to the disk
@@ -151,6 +151,20 @@ configgin \
 unset {{ $secret }}
 {{- end }}
 
+# Remove jobs whose if_feature or unless_feature condition does not hold, so
+# that monit, pre-start and run skip them.
+{{- range $job := .instance_group.JobReferences }}
+{{- if $job.IfFeature }}
+if [ "${{ $job.FeatureVariable }}" != "true" ] ; then
+  rm -rf /var/vcap/jobs/{{ $job.Name }} /var/vcap/monit/{{ $job.Name }}.monitrc
+fi
+{{- else if $job.UnlessFeature }}
+if [ "${{ $job.FeatureVariable }}" = "true" ] ; then
+  rm -rf /var/vcap/jobs/{{ $job.Name }} /var/vcap/monit/{{ $job.Name }}.monitrc
+fi
+{{- end }}
+{{- end }}
+
 if [ -e /etc/monitrc ]
 then
   chmod 0600 /etc/monitrc
@@ -183,6 +197,32 @@ echo bash {{ script_path $script }}
 bash {{ script_path $script }}
 {{- end }}
 
+{{- if and .instance_group.Run.LogToStdout (ne .instance_group.Type "bosh-task") }}
+
+# Copy the log files of the jobs to the output of the container, so that
+# kubectl logs shows them. The jobs create their log files when they start,
+# so the globs are expanded periodically. Each line is prefixed with the path
+# of its file; *.stderr.log files go to stderr.
+mkdir -p /var/vcap/sys/log
+(
+  declare -A tailed
+  while true; do
+    for file in{{ range $path := .instance_group.Run.LogPaths }} {{ $path }}{{ end }}; do
+      if [ -f "${file}" ] && [ -z "${tailed[${file}]:-}" ]; then
+        tailed[${file}]=1
+        prefix="${file#/var/vcap/sys/log/}"
+        if [[ "${file}" == *.stderr.log ]]; then
+          tail -n +1 -F "${file}" 2>/dev/null | sed -u "s|^|[${prefix}] |" >&2 &
+        else
+          tail -n +1 -F "${file}" 2>/dev/null | sed -u "s|^|[${prefix}] |" &
+        fi
+      fi
+    done
+    sleep 10
+  done
+) &
+{{- end }}
+
 # Run pre-start scripts for each job.
 {{- range $job := .instance_group.JobReferences }}
 if [ -x /var/vcap/jobs/{{ $job.Name }}/bin/pre-start ] ; then
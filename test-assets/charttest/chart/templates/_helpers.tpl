@@ -0,0 +1,3 @@
+{{- define "example.name" -}}
+{{ .Chart.Name }}-{{ .Release.Name | lower }}
+{{- end -}}
@@ -0,0 +1,3 @@
+#!/bin/bash
+# Check that the compiled library is there
+test -f lib/libevent.so
@@ -0,0 +1,6 @@
+#!/bin/bash
+# Check that the compiled binaries run
+set -o errexit
+for binary in bin/* ; do
+  "${binary}" --version
+done
@@ -0,0 +1,4 @@
+echo "os=fake"
+echo "os_version=15.1"
+echo "libc=2.26"
+echo "version="
@@ -0,0 +1,36 @@
+package testhelpers
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+)
+
+// WriteTarGz writes a gzipped tarball holding the given files, like the
+// archives of BOSH jobs and packages
+func WriteTarGz(path string, files map[string]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, content := range files {
+		err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})
+		if err != nil {
+			return err
+		}
+		if _, err := tarWriter.Write([]byte(content)); err != nil {
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -2,6 +2,7 @@ package util
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
@@ -14,26 +15,71 @@ type progressDelegate func(int)
 
 // DownloadFile will download a url to a local file. It's efficient because it will
 // write as it downloads and not load the whole file into memory.
-func DownloadFile(filepath string, url string, progressEvent progressDelegate) error {
+// Failed downloads are retried according to the retry policy; if the server
+// supports range requests, retries resume where the last attempt stopped.
+func DownloadFile(filepath string, url string, retryPolicy RetryPolicy, progressEvent progressDelegate) error {
+	return retryPolicy.Do(func(attempt int) error {
+		return downloadFileAttempt(filepath, url, progressEvent, attempt > 1)
+	})
+}
 
-	// Create the file
-	out, err := os.Create(filepath)
+func downloadFileAttempt(filepath string, url string, progressEvent progressDelegate, resume bool) error {
+	var offset int64
+	if resume {
+		if info, err := os.Stat(filepath); err == nil {
+			offset = info.Size()
+		}
+	}
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return err
+		return PermanentError(err)
+	}
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
 	}
-	defer out.Close()
 
 	// Get the data
 	transport := &http.Transport{}
 	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
 	httpClient := &http.Client{Transport: transport}
-	resp, err := httpClient.Get(url)
+	resp, err := httpClient.Do(request)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		flags = os.O_WRONLY | os.O_APPEND
+	case resp.StatusCode == http.StatusOK:
+		// The server ignored the range request (or none was made); start over
+		offset = 0
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The previous attempt already got everything
+		return nil
+	default:
+		err := fmt.Errorf("Error downloading %s: %s", url, resp.Status)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+			resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+			return PermanentError(err)
+		}
+		return err
+	}
+
+	// Create the file
+	out, err := os.OpenFile(filepath, flags, 0644)
+	if err != nil {
+		return PermanentError(err)
+	}
+	defer out.Close()
+
 	size := resp.ContentLength
+	total := size
+	if size > 0 {
+		total += offset
+	}
 	reader := progress.NewReader(resp.Body)
 
 	go func() {
@@ -41,7 +87,11 @@ func DownloadFile(filepath string, url string, progressEvent progressDelegate) e
 		progressChan := progress.NewTicker(ctx, reader, size, 1*time.Second)
 
 		for p := range progressChan {
-			progressEvent(int(p.Percent()))
+			if total > 0 {
+				progressEvent(int((offset + p.N()) * 100 / total))
+			} else {
+				progressEvent(int(p.Percent()))
+			}
 		}
 	}()
 
@@ -1,16 +1,22 @@
 package util
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path"
 	"strconv"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDownloadFile(test *testing.T) {
@@ -71,7 +77,7 @@ func TestDownloadFile(test *testing.T) {
 
 	go server.Serve(listener)
 
-	downloaderr := DownloadFile(tempFile, u.String(), func(i int) {})
+	downloaderr := DownloadFile(tempFile, u.String(), RetryPolicy{MaxAttempts: 3}, func(i int) {})
 	if downloaderr != nil {
 		test.Fatal(downloaderr)
 	}
@@ -98,3 +104,62 @@ func servetestdata(b []byte) http.Handler {
 		w.Write(b)
 	})
 }
+
+func TestDownloadFileResume(t *testing.T) {
+	_, restore := mockRetryClock()
+	defer restore()
+
+	testData := []byte("Fissile resumable test data")
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			// Send only half of the data, then drop the connection
+			w.Header().Set("Content-Length", strconv.Itoa(len(testData)))
+			w.Write(testData[:10])
+			w.(http.Flusher).Flush()
+			hijacker, ok := w.(http.Hijacker)
+			if !ok {
+				t.Fatal("Cannot drop connection")
+			}
+			conn, _, _ := hijacker.Hijack()
+			conn.Close()
+			return
+		}
+		assert.Equal(t, "bytes=10-", r.Header.Get("Range"))
+		http.ServeContent(w, r, "data", time.Time{}, bytes.NewReader(testData))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "test_download_resume")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	target := path.Join(dir, "download")
+
+	require.NoError(t, DownloadFile(target, server.URL, RetryPolicy{MaxAttempts: 3}, func(int) {}))
+	assert.Equal(t, 2, requests)
+
+	contents, err := ioutil.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, testData, contents)
+}
+
+func TestDownloadFileNotFound(t *testing.T) {
+	_, restore := mockRetryClock()
+	defer restore()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "test_download_missing")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	err = DownloadFile(path.Join(dir, "download"), server.URL, RetryPolicy{MaxAttempts: 3}, func(int) {})
+	assert.EqualError(t, err, fmt.Sprintf("Error downloading %s: 404 Not Found", server.URL))
+	assert.Equal(t, 1, requests, "client errors should not be retried")
+}
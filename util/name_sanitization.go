@@ -6,7 +6,9 @@ import (
 )
 
 var (
-	rgxDockerNames = regexp.MustCompile(`(?i)[^a-z0-9_.-]+`)
+	rgxDockerNames         = regexp.MustCompile(`(?i)[^a-z0-9_.-]+`)
+	rgxKubeNames           = regexp.MustCompile(`[^a-z0-9-]+`)
+	rgxTemplateExpressions = regexp.MustCompile(`{{.*?}}`)
 )
 
 // SanitizeDockerName makes a string conform with the rules for Docker names
@@ -19,3 +21,38 @@ func SanitizeDockerName(name string) string {
 
 	return rgxDockerNames.ReplaceAllString(name, "-")
 }
+
+// SanitizeKubeName makes a string conform with the rules for kubernetes names
+// (DNS-1123 labels): lowercase alphanumeric characters and dashes, starting and
+// ending with an alphanumeric character, at most maxLength characters long.
+// Names which are too long are shortened with TruncateName.
+func SanitizeKubeName(name string, maxLength int) string {
+	// Only the literal parts of names with template expressions are mangled;
+	// the length can only be checked once the templates are rendered.
+	if rgxTemplateExpressions.MatchString(name) {
+		var result strings.Builder
+		last := 0
+		for _, match := range rgxTemplateExpressions.FindAllStringIndex(name, -1) {
+			result.WriteString(rgxKubeNames.ReplaceAllString(strings.ToLower(name[last:match[0]]), "-"))
+			result.WriteString(name[match[0]:match[1]])
+			last = match[1]
+		}
+		result.WriteString(rgxKubeNames.ReplaceAllString(strings.ToLower(name[last:]), "-"))
+		return result.String()
+	}
+
+	name = strings.Trim(rgxKubeNames.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	return TruncateName(name, maxLength)
+}
+
+// TruncateName shortens a name to at most maxLength characters.  Longer names
+// are cut, and get a suffix derived from the hash of the full name, so that
+// names which only differ after the cut remain distinct.
+func TruncateName(name string, maxLength int) string {
+	if len(name) <= maxLength {
+		return name
+	}
+	suffix := Hash(name)[:8]
+	prefix := strings.TrimRight(name[:maxLength-len(suffix)-1], "-")
+	return prefix + "-" + suffix
+}
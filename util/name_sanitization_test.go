@@ -1,6 +1,7 @@
 package util
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -20,3 +21,37 @@ func TestSanitizeDockerName(t *testing.T) {
 		assert.Equal(output, SanitizeDockerName(input), "Incorrect sanitization")
 	}
 }
+
+func TestTruncateName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("short-name", TruncateName("short-name", 10), "Names which fit should be unchanged")
+
+	long := "a-rather-long-instance-group-name"
+	truncated := TruncateName(long, 20)
+	assert.Len(truncated, 20)
+	assert.Equal("a-rather-lo-"+Hash(long)[:8], truncated)
+	assert.Equal(truncated, TruncateName(long, 20), "Truncation should be deterministic")
+	assert.NotEqual(truncated, TruncateName(long+"-2", 20), "Truncated names should remain distinct")
+
+	assert.Equal("abc-"+Hash("abc-defghijklmnop")[:8], TruncateName("abc-defghijklmnop", 13),
+		"Dashes before the hash suffix should be removed")
+}
+
+func TestSanitizeKubeName(t *testing.T) {
+	assert := assert.New(t)
+
+	for input, output := range map[string]string{
+		"valid-name":                   "valid-name",
+		"Mixed_Case":                   "mixed-case",
+		"_leading.and.trailing_":       "leading-and-trailing",
+		"many   spaces":                "many-spaces",
+		"name-{{ .Release.Revision }}": "name-{{ .Release.Revision }}",
+		"Name_{{ .Values.x }}_Suffix":  "name-{{ .Values.x }}-suffix",
+	} {
+		assert.Equal(output, SanitizeKubeName(input, 63), "Incorrect sanitization of %s", input)
+	}
+
+	long := strings.Repeat("Long_Name_", 10)
+	assert.Equal(TruncateName(strings.TrimSuffix(strings.Repeat("long-name-", 10), "-"), 63), SanitizeKubeName(long, 63))
+}
@@ -0,0 +1,10 @@
+package util
+
+import "fmt"
+
+// NewOfflineError returns the error reported when an operation needs network
+// access while fissile runs in offline mode.  The remedy tells the user what to
+// provide locally instead.
+func NewOfflineError(operation, remedy string) error {
+	return fmt.Errorf("%s requires network access, which is not available in offline mode; %s", operation, remedy)
+}
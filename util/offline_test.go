@@ -0,0 +1,13 @@
+package util_test
+
+import (
+	"testing"
+
+	"code.cloudfoundry.org/fissile/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewOfflineError(t *testing.T) {
+	err := util.NewOfflineError("Pulling stemcell image stemcell:42", "load it with `docker load` first")
+	assert.EqualError(t, err, "Pulling stemcell image stemcell:42 requires network access, which is not available in offline mode; load it with `docker load` first")
+}
@@ -0,0 +1,92 @@
+package util
+
+import (
+	"time"
+)
+
+// RetryPolicy describes how operations talking to remote services (docker
+// registries, release download servers) are retried when they fail.  The
+// delay between attempts grows exponentially from InitialDelay by
+// Multiplier, up to MaxDelay.  No further attempts are made once MaxAttempts
+// is reached, or when waiting for the next attempt would exceed the Budget.
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	// Budget is the total time allowed for all attempts; zero means unlimited
+	Budget time.Duration
+}
+
+// DefaultRetryPolicy returns the retry policy used for remote operations
+// unless the command line options ask for another one
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:  5,
+		InitialDelay: time.Second,
+		MaxDelay:     30 * time.Second,
+		Multiplier:   2,
+	}
+}
+
+// mocked out in tests
+var (
+	retrySleep = time.Sleep
+	retryNow   = time.Now
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+// PermanentError marks an error as one that retrying will not fix, causing
+// RetryPolicy.Do to return it immediately.
+func PermanentError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// Do calls the operation until it succeeds, returns a permanent error, or
+// the policy does not allow any more attempts.  The operation is passed the
+// number of the attempt, starting at 1.  The last error is returned as is.
+func (p RetryPolicy) Do(operation func(attempt int) error) error {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	start := retryNow()
+	delay := p.InitialDelay
+	for attempt := 1; ; attempt++ {
+		err := operation(attempt)
+		if err == nil {
+			return nil
+		}
+		if permanent, ok := err.(permanentError); ok {
+			return permanent.err
+		}
+		if attempt >= maxAttempts {
+			return err
+		}
+		if p.Budget > 0 && retryNow().Sub(start)+delay > p.Budget {
+			return err
+		}
+
+		retrySleep(delay)
+
+		delay = time.Duration(float64(delay) * multiplier)
+		if p.MaxDelay > 0 && delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mockRetryClock() (*[]time.Duration, func()) {
+	saveSleep, saveNow := retrySleep, retryNow
+	now := time.Unix(0, 0)
+	var sleeps []time.Duration
+	retrySleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+	}
+	retryNow = func() time.Time { return now }
+	return &sleeps, func() {
+		retrySleep, retryNow = saveSleep, saveNow
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	sleeps, restore := mockRetryClock()
+	defer restore()
+
+	policy := RetryPolicy{MaxAttempts: 5, InitialDelay: time.Second, MaxDelay: 3 * time.Second, Multiplier: 2}
+
+	attempts := 0
+	err := policy.Do(func(attempt int) error {
+		attempts++
+		assert.Equal(t, attempts, attempt)
+		return errors.New("transient")
+	})
+	assert.EqualError(t, err, "transient")
+	assert.Equal(t, 5, attempts)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}, *sleeps)
+}
+
+func TestRetryPolicySucceeds(t *testing.T) {
+	sleeps, restore := mockRetryClock()
+	defer restore()
+
+	err := DefaultRetryPolicy().Do(func(attempt int) error {
+		if attempt < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, *sleeps, 2)
+}
+
+func TestRetryPolicyPermanentError(t *testing.T) {
+	sleeps, restore := mockRetryClock()
+	defer restore()
+
+	attempts := 0
+	err := DefaultRetryPolicy().Do(func(attempt int) error {
+		attempts++
+		return PermanentError(errors.New("not found"))
+	})
+	assert.EqualError(t, err, "not found")
+	assert.Equal(t, 1, attempts)
+	assert.Empty(t, *sleeps)
+}
+
+func TestRetryPolicyBudget(t *testing.T) {
+	sleeps, restore := mockRetryClock()
+	defer restore()
+
+	policy := RetryPolicy{MaxAttempts: 10, InitialDelay: time.Second, Multiplier: 2, Budget: 5 * time.Second}
+
+	attempts := 0
+	err := policy.Do(func(attempt int) error {
+		attempts++
+		return errors.New("transient")
+	})
+	assert.Error(t, err)
+	// 1s + 2s fit into the budget, waiting another 4s would not
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, *sleeps)
+}
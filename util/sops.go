@@ -0,0 +1,75 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// SopsFormat is the format of a file which may be encrypted with SOPS, as
+// passed to the --input-type and --output-type options of sops
+type SopsFormat string
+
+const (
+	// SopsFormatYAML is the format of YAML (and JSON) files
+	SopsFormatYAML SopsFormat = "yaml"
+	// SopsFormatDotenv is the format of environment files with KEY=value lines
+	SopsFormatDotenv SopsFormat = "dotenv"
+)
+
+// SopsCommand is the sops executable used to decrypt files.  sops looks up
+// the age, PGP, or KMS keys itself, e.g. from SOPS_AGE_KEY_FILE.
+var SopsCommand = "sops"
+
+// ReadSopsFile returns the contents of the file, decrypted with sops if the
+// file is encrypted with SOPS.  Files which are not encrypted are returned
+// as they are, without requiring sops.
+func ReadSopsFile(path string, format SopsFormat) ([]byte, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !IsSopsEncrypted(contents, format) {
+		return contents, nil
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(SopsCommand, "--decrypt", "--input-type", string(format), "--output-type", string(format), path)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("Error decrypting %s with %s: %v: %s", path, SopsCommand, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// IsSopsEncrypted returns whether the contents are encrypted with SOPS, i.e.
+// have the metadata sops adds: a top level sops mapping with a MAC for YAML,
+// or a sops_mac line for environment files.
+func IsSopsEncrypted(contents []byte, format SopsFormat) bool {
+	switch format {
+	case SopsFormatYAML:
+		var document struct {
+			Sops struct {
+				Mac string `yaml:"mac"`
+			} `yaml:"sops"`
+		}
+		if err := yaml.Unmarshal(contents, &document); err != nil {
+			return false
+		}
+		return document.Sops.Mac != ""
+	case SopsFormatDotenv:
+		scanner := bufio.NewScanner(bytes.NewReader(contents))
+		for scanner.Scan() {
+			if strings.HasPrefix(strings.TrimSpace(scanner.Text()), "sops_mac=") {
+				return true
+			}
+		}
+	}
+	return false
+}
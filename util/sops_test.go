@@ -0,0 +1,51 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsSopsEncrypted(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, IsSopsEncrypted([]byte("password: ENC[AES256_GCM,data:x]\nsops:\n  mac: ENC[AES256_GCM,data:y]\n"), SopsFormatYAML))
+	assert.True(t, IsSopsEncrypted([]byte(`{"password": "ENC[x]", "sops": {"mac": "ENC[y]"}}`), SopsFormatYAML))
+	assert.False(t, IsSopsEncrypted([]byte("sops:\n  version: 3.5.0\n"), SopsFormatYAML))
+	assert.False(t, IsSopsEncrypted([]byte("- not a mapping\n"), SopsFormatYAML))
+	assert.True(t, IsSopsEncrypted([]byte("PASSWORD=ENC[x]\nsops_mac=ENC[y]\n"), SopsFormatDotenv))
+	assert.False(t, IsSopsEncrypted([]byte("PASSWORD=hunter2\n"), SopsFormatDotenv))
+}
+
+func TestReadSopsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fissile-sops-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The fake sops prints its arguments instead of the decrypted contents
+	fakeSops := filepath.Join(dir, "sops")
+	require.NoError(t, ioutil.WriteFile(fakeSops, []byte("#!/bin/sh\necho \"ARGS=$*\"\n"), 0755))
+	defer func(command string) { SopsCommand = command }(SopsCommand)
+	SopsCommand = fakeSops
+
+	plain := filepath.Join(dir, "plain.env")
+	require.NoError(t, ioutil.WriteFile(plain, []byte("PASSWORD=hunter2\n"), 0644))
+	contents, err := ReadSopsFile(plain, SopsFormatDotenv)
+	require.NoError(t, err)
+	assert.Equal(t, "PASSWORD=hunter2\n", string(contents))
+
+	encrypted := filepath.Join(dir, "encrypted.env")
+	require.NoError(t, ioutil.WriteFile(encrypted, []byte("PASSWORD=ENC[x]\nsops_mac=ENC[y]\n"), 0644))
+	contents, err = ReadSopsFile(encrypted, SopsFormatDotenv)
+	require.NoError(t, err)
+	assert.Equal(t, "ARGS=--decrypt --input-type dotenv --output-type dotenv "+encrypted+"\n", string(contents))
+
+	SopsCommand = filepath.Join(dir, "missing")
+	_, err = ReadSopsFile(encrypted, SopsFormatDotenv)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Error decrypting "+encrypted)
+}
@@ -8,6 +8,9 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"sort"
+	"strconv"
+	"time"
 )
 
 var (
@@ -120,3 +123,94 @@ func CopyFileToTarStream(stream *tar.Writer, path string, header *tar.Header) er
 	}
 	return nil
 }
+
+// ReproducibleModTime returns the modification time used for entries of
+// reproducible tar streams.  It honours the SOURCE_DATE_EPOCH convention and
+// falls back to the unix epoch.
+func ReproducibleModTime() time.Time {
+	if epoch, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0).UTC()
+	}
+	return time.Unix(0, 0).UTC()
+}
+
+// NormalizeTarHeader strips all the information from a tar header which
+// depends on the time or the machine the tar stream was created on.
+func NormalizeTarHeader(header *tar.Header) {
+	header.ModTime = ReproducibleModTime()
+	header.AccessTime = time.Time{}
+	header.ChangeTime = time.Time{}
+	header.Uid = 0
+	header.Gid = 0
+	header.Uname = ""
+	header.Gname = ""
+	// Let the writer pick the format; it only depends on the remaining fields
+	header.Format = tar.FormatUnknown
+	header.PAXRecords = nil
+}
+
+// NewReproducibleTarPopulator wraps a function populating a tar stream so that
+// the resulting stream is deterministic: entries are sorted by name and their
+// headers are normalized.  Entries can only be written once all of them are
+// known, so their contents are streamed into a temporary file, and only the
+// headers are kept in memory.
+func NewReproducibleTarPopulator(populator func(*tar.Writer) error) func(*tar.Writer) error {
+	return func(tarWriter *tar.Writer) error {
+		spool, err := ioutil.TempFile("", "fissile-reproducible-tar-")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(spool.Name())
+		defer spool.Close()
+
+		pipeReader, pipeWriter := io.Pipe()
+		go func() {
+			writer := tar.NewWriter(pipeWriter)
+			err := populator(writer)
+			if err == nil {
+				err = writer.Close()
+			}
+			pipeWriter.CloseWithError(err)
+		}()
+
+		type entry struct {
+			header *tar.Header
+			offset int64
+		}
+		var entries []entry
+		var offset int64
+		reader := tar.NewReader(pipeReader)
+		for {
+			header, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err == nil {
+				var size int64
+				size, err = io.Copy(spool, reader)
+				entries = append(entries, entry{header: header, offset: offset})
+				offset += size
+			}
+			if err != nil {
+				// Unblock the populator, if it is still writing
+				pipeReader.CloseWithError(err)
+				return err
+			}
+		}
+
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].header.Name < entries[j].header.Name
+		})
+
+		for _, e := range entries {
+			NormalizeTarHeader(e.header)
+			if err := tarWriter.WriteHeader(e.header); err != nil {
+				return err
+			}
+			if _, err := io.Copy(tarWriter, io.NewSectionReader(spool, e.offset, e.header.Size)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
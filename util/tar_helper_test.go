@@ -3,10 +3,12 @@ package util
 import (
 	"archive/tar"
 	"bytes"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -85,3 +87,50 @@ func TestCopyFileToTarStream(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal(expected, actual, "Incorrect data read")
 }
+
+func TestNewReproducibleTarPopulator(t *testing.T) {
+	assert := assert.New(t)
+
+	build := func(names []string, modTime time.Time) []byte {
+		populator := NewReproducibleTarPopulator(func(writer *tar.Writer) error {
+			for _, name := range names {
+				err := WriteToTarStream(writer, []byte(name), tar.Header{
+					Name:    name,
+					ModTime: modTime,
+					Uid:     1000,
+					Uname:   "user",
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		buf := bytes.Buffer{}
+		writer := tar.NewWriter(&buf)
+		assert.NoError(populator(writer))
+		assert.NoError(writer.Close())
+		return buf.Bytes()
+	}
+
+	first := build([]string{"b", "a", "c"}, time.Now())
+	second := build([]string{"c", "b", "a"}, time.Now().Add(time.Hour))
+	assert.Equal(first, second, "Tar streams differ")
+
+	reader := tar.NewReader(bytes.NewReader(first))
+	var names []string
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(err) {
+			break
+		}
+		names = append(names, header.Name)
+		assert.Equal(ReproducibleModTime(), header.ModTime.UTC())
+		assert.Equal(0, header.Uid)
+		assert.Empty(header.Uname)
+	}
+	assert.Equal([]string{"a", "b", "c"}, names)
+}
@@ -0,0 +1,222 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// JSONSchema is the subset of JSON schema used by the Kubernetes OpenAPI
+// schemas and by the exported fissile model.
+type JSONSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 interface{}            `json:"type"`
+	Properties           map[string]*JSONSchema `json:"properties"`
+	AdditionalProperties interface{}            `json:"additionalProperties"`
+	Items                *JSONSchema            `json:"items"`
+	Required             []string               `json:"required"`
+	Enum                 []interface{}          `json:"enum"`
+	OneOf                []*JSONSchema          `json:"oneOf"`
+	AnyOf                []*JSONSchema          `json:"anyOf"`
+	Format               string                 `json:"format"`
+	IntOrString          bool                   `json:"x-kubernetes-int-or-string"`
+	PreserveUnknown      bool                   `json:"x-kubernetes-preserve-unknown-fields"`
+	Definitions          map[string]*JSONSchema `json:"definitions"`
+}
+
+// NormalizeObject converts the map[interface{}]interface{} maps produced by
+// the YAML parser to map[string]interface{}.
+func NormalizeObject(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			result[fmt.Sprintf("%v", key)] = NormalizeObject(element)
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			result[key] = NormalizeObject(element)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, element := range v {
+			result[i] = NormalizeObject(element)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+// resolve follows $ref references into the definitions of the root schema.
+func resolve(root, schema *JSONSchema) *JSONSchema {
+	for schema != nil && schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/definitions/")
+		schema = root.Definitions[name]
+	}
+	return schema
+}
+
+// schemaTypes returns the types allowed by the schema.
+func schemaTypes(schema *JSONSchema) []string {
+	switch t := schema.Type.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, element := range t {
+			if name, ok := element.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// valueType returns the JSON schema type of a value.
+func valueType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func typeMatches(types []string, actual string) bool {
+	for _, expected := range types {
+		if expected == actual || (expected == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func joinPath(path, name string) string {
+	if strings.HasSuffix(path, ":") {
+		return path + " " + name
+	}
+	return path + "." + name
+}
+
+// Validate checks a value (as unmarshalled from JSON, or normalized with
+// NormalizeObject) against the schema.  The fields of the errors are
+// prefixed with the given path, like `(root):`.
+func (schema *JSONSchema) Validate(value interface{}, path string) ErrorList {
+	var allErrs ErrorList
+	validateSchema(schema, schema, value, path, &allErrs)
+	return allErrs
+}
+
+func validateSchema(root, schema *JSONSchema, value interface{}, path string, allErrs *ErrorList) {
+	schema = resolve(root, schema)
+	if schema == nil {
+		return
+	}
+	actual := valueType(value)
+
+	if schema.IntOrString || schema.Format == "int-or-string" {
+		if actual != "string" && actual != "integer" {
+			*allErrs = append(*allErrs, Invalid(path, value, "expected integer or string"))
+		}
+		return
+	}
+
+	if alternatives := append(schema.OneOf, schema.AnyOf...); len(alternatives) > 0 {
+		for _, alternative := range alternatives {
+			var errs ErrorList
+			validateSchema(root, alternative, value, path, &errs)
+			if len(errs) == 0 {
+				return
+			}
+		}
+		*allErrs = append(*allErrs, Invalid(path, value, "does not match any of the allowed schemas"))
+		return
+	}
+
+	if types := schemaTypes(schema); len(types) > 0 && !typeMatches(types, actual) {
+		if actual == "null" {
+			// Kubernetes treats null like a missing value
+			return
+		}
+		*allErrs = append(*allErrs, Invalid(path, value,
+			fmt.Sprintf("expected %s, found %s", strings.Join(types, " or "), actual)))
+		return
+	}
+
+	if len(schema.Enum) > 0 {
+		found := false
+		var allowed []string
+		for _, option := range schema.Enum {
+			allowed = append(allowed, fmt.Sprintf("%v", option))
+			if fmt.Sprintf("%v", option) == fmt.Sprintf("%v", value) {
+				found = true
+			}
+		}
+		if !found {
+			*allErrs = append(*allErrs, NotSupported(path, value, allowed))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range schema.Required {
+			if _, ok := v[name]; !ok {
+				*allErrs = append(*allErrs, Required(joinPath(path, name), ""))
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := schema.Properties[name]; ok {
+				validateSchema(root, property, v[name], joinPath(path, name), allErrs)
+				continue
+			}
+			switch additional := schema.AdditionalProperties.(type) {
+			case map[string]interface{}:
+				// Re-decode the schema of the additional properties
+				var additionalSchema JSONSchema
+				if buf, err := json.Marshal(additional); err == nil && json.Unmarshal(buf, &additionalSchema) == nil {
+					validateSchema(root, &additionalSchema, v[name], joinPath(path, name), allErrs)
+				}
+			case bool:
+				if !additional && !schema.PreserveUnknown {
+					*allErrs = append(*allErrs, Forbidden(joinPath(path, name), "unknown field"))
+				}
+			default:
+				if schema.Properties != nil && !schema.PreserveUnknown {
+					*allErrs = append(*allErrs, Forbidden(joinPath(path, name), "unknown field"))
+				}
+			}
+		}
+	case []interface{}:
+		if schema.Items != nil {
+			for i, element := range v {
+				validateSchema(root, schema.Items, element, fmt.Sprintf("%s[%d]", path, i), allErrs)
+			}
+		}
+	}
+}